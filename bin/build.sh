@@ -2,6 +2,7 @@
 
 cd "$(dirname "$0")"/..
 
-go build -o bin/app ./cmd/app/
+go build -tags sqlite_fts5 -o bin/app ./cmd/app/
 go build -o bin/guide ./cmd/guide/
 go build -o bin/auto-record ./cmd/auto-record/
+go build -o bin/dvrctl ./cmd/dvrctl/
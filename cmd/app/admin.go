@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// logBuffer keeps the most recent server log lines in memory so they can be
+// tailed over the API. It is installed as an extra log output in main().
+type logBuffer struct {
+	mu      sync.Mutex
+	size    int
+	lines   []LogLine
+	nextSeq int64
+	partial string
+}
+
+type LogLine struct {
+	Seq  int64  `json:"seq"`
+	Text string `json:"text"`
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{size: size, nextSeq: 1}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	text := b.partial + string(p)
+	parts := strings.Split(text, "\n")
+	b.partial = parts[len(parts)-1]
+	for _, line := range parts[:len(parts)-1] {
+		b.lines = append(b.lines, LogLine{Seq: b.nextSeq, Text: line})
+		b.nextSeq++
+	}
+	if over := len(b.lines) - b.size; over > 0 {
+		b.lines = append([]LogLine(nil), b.lines[over:]...)
+	}
+	return len(p), nil
+}
+
+// since returns buffered lines with a sequence number greater than seq, at
+// most limit of the newest, and the sequence number to pass next time.
+func (b *logBuffer) since(seq int64, limit int) ([]LogLine, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []LogLine
+	for _, l := range b.lines {
+		if l.Seq > seq {
+			out = append(out, l)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return append([]LogLine{}, out...), b.nextSeq - 1
+}
+
+func (a *App) getLogs(w http.ResponseWriter, r *http.Request) {
+	if a.logs == nil {
+		http.Error(w, "Log buffer not enabled", http.StatusNotFound)
+		return
+	}
+
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+	limit := 100
+	if v := r.URL.Query().Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid lines", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	lines, last := a.logs.since(since, limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"lines": lines, "last": last}) //nolint: errcheck
+}
+
+// startGuideRefresh runs the guide generator in the background. The file
+// watcher picks up the rewritten guide file when it finishes. It returns
+// false if a refresh is already running.
+func (a *App) startGuideRefresh() bool {
+	if !atomic.CompareAndSwapInt32(&a.guideRefreshing, 0, 1) {
+		return false
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&a.guideRefreshing, 0)
+		slog.Info("Refreshing guide", "command", a.cfg().GuideCommand)
+		cmd, err := a.commander.StartCommand(a.cfg().GuideCommand, log.Writer(), log.Writer())
+		if err == nil {
+			err = cmd.Run()
+		}
+		if err != nil {
+			slog.Error("Guide refresh failed", "err", err)
+			a.events.publish(eventGuideRefreshFailed, map[string]interface{}{"reason": err.Error()})
+			return
+		}
+		slog.Info("Guide refresh finished")
+		a.loadGuide()
+	}()
+	return true
+}
+
+// refreshGuide starts a guide refresh.
+func (a *App) refreshGuide(w http.ResponseWriter, r *http.Request) {
+	if !a.startGuideRefresh() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Guide refresh already running"}) //nolint: errcheck
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "started"}) //nolint: errcheck
+}
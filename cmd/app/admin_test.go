@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLogBuffer(t *testing.T) {
+	b := newLogBuffer(3)
+	fmt.Fprint(b, "one\ntwo\nthr")    //nolint: errcheck
+	fmt.Fprint(b, "ee\nfour\nfive\n") //nolint: errcheck
+
+	lines, last := b.since(0, 0)
+	if last != 5 || len(lines) != 3 || lines[0].Text != "three" || lines[2].Text != "five" {
+		t.Fatalf("unexpected lines %+v (last %d)", lines, last)
+	}
+	if lines, _ := b.since(4, 0); len(lines) != 1 || lines[0].Seq != 5 {
+		t.Errorf("since(4): unexpected lines %+v", lines)
+	}
+	if lines, _ := b.since(0, 2); len(lines) != 2 || lines[0].Text != "four" {
+		t.Errorf("limit 2: unexpected lines %+v", lines)
+	}
+}
+
+func TestGetLogsHandler(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.logs = newLogBuffer(10)
+	fmt.Fprintln(app.logs, "hello") //nolint: errcheck
+
+	req := httptest.NewRequest("GET", "/api/logs?since=0", nil)
+	rr := httptest.NewRecorder()
+	app.getLogs(rr, req)
+
+	var res struct {
+		Lines []LogLine `json:"lines"`
+		Last  int64     `json:"last"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || len(res.Lines) != 1 || res.Lines[0].Text != "hello" || res.Last != 1 {
+		t.Errorf("unexpected response %d %+v", rr.Code, res)
+	}
+}
+
+func TestRefreshGuideHandler(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.config.GuideCommand = "bin/guide"
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	app.commander = &MockCommander{
+		StartCommandFunc: func(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error) {
+			started <- name
+			<-release
+			return nil, fmt.Errorf("not really running %s", name)
+		},
+	}
+
+	req := httptest.NewRequest("POST", "/api/guide/refresh", nil)
+	rr := httptest.NewRecorder()
+	app.refreshGuide(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("got code %d, want %d", rr.Code, http.StatusAccepted)
+	}
+	if name := <-started; name != "bin/guide" {
+		t.Errorf("ran %q, want bin/guide", name)
+	}
+
+	rr = httptest.NewRecorder()
+	app.refreshGuide(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("second refresh: got code %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&app.guideRefreshing) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rr = httptest.NewRecorder()
+	app.refreshGuide(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("refresh after completion: got code %d, want %d", rr.Code, http.StatusAccepted)
+	}
+	<-started
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gorilla/mux"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to search for.
+const apiKeyPrefix = "dvr_"
+
+// APIKey is a key as listed; the key itself is only shown when created.
+// Prefix is its first characters, to tell keys apart.
+type APIKey struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`
+	CreatedAt  string `json:"createdAt"`
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+	RevokedAt  string `json:"revokedAt,omitempty"`
+}
+
+// hashAPIKey returns the digest stored for key. Keys are random, so a
+// plain SHA-256 is enough to make the stored value useless to a reader of
+// the database.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIKey creates a key named name and returns it with the key itself.
+func (a *App) createAPIKey(ctx context.Context, name string) (APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	k := APIKey{Name: name, Prefix: key[:len(apiKeyPrefix)+6]}
+	res, err := a.dbExecContext(ctx, "INSERT INTO api_keys (name, prefix, hash) VALUES (?, ?, ?)", k.Name, k.Prefix, hashAPIKey(key))
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	if k.ID, err = res.LastInsertId(); err != nil {
+		return APIKey{}, "", err
+	}
+	err = a.dbQueryRowContext(ctx, "SELECT created_at FROM api_keys WHERE id = ?", k.ID).Scan(&k.CreatedAt)
+	return k, key, err
+}
+
+// listAPIKeys returns every key, revoked ones included, oldest first.
+func (a *App) listAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT id, name, prefix, created_at, COALESCE(last_used_at, ''), COALESCE(revoked_at, '')
+		FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// revokeAPIKey revokes a key. It returns sql.ErrNoRows for a key that does
+// not exist or is already revoked.
+func (a *App) revokeAPIKey(ctx context.Context, id int64) error {
+	res, err := a.dbExecContext(ctx, "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// lookupAPIKey returns the unrevoked key matching key and records its use.
+// It returns sql.ErrNoRows for any other key.
+func (a *App) lookupAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	var k APIKey
+	err := a.dbQueryRowContext(ctx, `
+		SELECT id, name, prefix, created_at FROM api_keys WHERE hash = ? AND revoked_at IS NULL`,
+		hashAPIKey(key)).Scan(&k.ID, &k.Name, &k.Prefix, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.dbExecContext(ctx, "UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", k.ID); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// getAPIKeys lists the API keys.
+func (a *App) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.listAPIKeys(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys) //nolint: errcheck
+}
+
+// createdAPIKey answers POST /api/admin/keys, with the key itself.
+type createdAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyRequest is the body of POST /api/admin/keys.
+type APIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// createAPIKeyHandler creates a key from {"name": ...} and returns it,
+// with the key itself in "key"; it cannot be retrieved later.
+func (a *App) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	k, key, err := a.createAPIKey(r.Context(), strings.TrimSpace(req.Name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("API key created", "key_id", k.ID, "name", k.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdAPIKey{k, key}) //nolint: errcheck
+}
+
+// revokeAPIKeyHandler revokes a key; requests with it fail from then on.
+func (a *App) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+	if err := a.revokeAPIKey(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such key", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("API key revoked", "key_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runKeysCommand manages API keys from the command line, for creating the
+// first key once auth is enabled: "keys list", "keys create NAME" and
+// "keys revoke ID".
+func runKeysCommand(a *App, args []string, out io.Writer) error {
+	ctx := context.Background()
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		keys, err := a.listAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tCREATED\tLAST USED\tREVOKED") //nolint: errcheck
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.CreatedAt, k.LastUsedAt, k.RevokedAt) //nolint: errcheck
+		}
+		return tw.Flush()
+	case len(args) == 2 && args[0] == "create":
+		k, key, err := a.createAPIKey(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created key %d (%s): %s\n", k.ID, k.Name, key) //nolint: errcheck
+		return nil
+	case len(args) == 2 && args[0] == "revoke":
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid key ID %q", args[1])
+		}
+		if err := a.revokeAPIKey(ctx, id); errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no active key %d", id)
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked key %d\n", id) //nolint: errcheck
+		return nil
+	}
+	return errors.New("usage: app keys list | create NAME | revoke ID")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAPIKeys(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+
+	k, key, err := app.createAPIKey(ctx, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, k.Prefix) || !strings.HasPrefix(key, apiKeyPrefix) || len(key) < 32 {
+		t.Errorf("key %q, prefix %q", key, k.Prefix)
+	}
+	var stored string
+	if err := db.QueryRow("SELECT hash FROM api_keys WHERE id = ?", k.ID).Scan(&stored); err != nil || strings.Contains(stored, key) {
+		t.Errorf("stored %q, %v", stored, err)
+	}
+
+	if got, err := app.lookupAPIKey(ctx, key); err != nil || got.Name != "laptop" {
+		t.Errorf("lookup: %+v, %v", got, err)
+	}
+	if _, err := app.lookupAPIKey(ctx, key+"x"); err == nil {
+		t.Error("lookup of a wrong key succeeded")
+	}
+	keys, _ := app.listAPIKeys(ctx)
+	if len(keys) != 1 || keys[0].LastUsedAt == "" {
+		t.Errorf("keys %+v", keys)
+	}
+
+	if err := app.revokeAPIKey(ctx, k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.lookupAPIKey(ctx, key); err == nil {
+		t.Error("revoked key still works")
+	}
+	if err := app.revokeAPIKey(ctx, k.ID); err == nil {
+		t.Error("revoked a key twice")
+	}
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	rr := httptest.NewRecorder()
+	app.createAPIKeyHandler(rr, httptest.NewRequest("POST", "/api/v1/admin/keys", strings.NewReader(`{"name": "ha"}`)))
+	var created struct {
+		APIKey
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || rr.Code != http.StatusCreated || created.Key == "" {
+		t.Fatalf("create: %d %+v %v", rr.Code, created, err)
+	}
+
+	rr = httptest.NewRecorder()
+	app.getAPIKeys(rr, httptest.NewRequest("GET", "/api/v1/admin/keys", nil))
+	if strings.Contains(rr.Body.String(), created.Key) || !strings.Contains(rr.Body.String(), created.Prefix) {
+		t.Errorf("list: %s", rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/api/v1/admin/keys/1", nil), map[string]string{"id": "1"})
+	app.revokeAPIKeyHandler(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("revoke: %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	app.revokeAPIKeyHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("revoke again: %d", rr.Code)
+	}
+
+	var out bytes.Buffer
+	if err := runKeysCommand(app, []string{"create", "cli"}, &out); err != nil || !strings.Contains(out.String(), apiKeyPrefix) {
+		t.Errorf("keys create: %q, %v", out.String(), err)
+	}
+	out.Reset()
+	if err := runKeysCommand(app, []string{"list"}, &out); err != nil || !strings.Contains(out.String(), "cli") {
+		t.Errorf("keys list: %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// apiVersion is the version of the API served under apiPrefix.
+	apiVersion = "1"
+	apiPrefix  = "/api/v1"
+	// apiVersionHeader carries apiVersion on every API response. A request
+	// may send it too, to fail instead of being answered by another
+	// version than it was written for.
+	apiVersionHeader = "API-Version"
+)
+
+// withAPIVersion serves the unversioned /api paths the API had before
+// versioning as aliases of /api/v1, and adds apiVersionHeader to every API
+// response.
+func withAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p != "/api" && !strings.HasPrefix(p, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set(apiVersionHeader, apiVersion)
+		if v := r.Header.Get(apiVersionHeader); v != "" && v != apiVersion {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unsupported API version " + v + ", this server has " + apiVersion}) //nolint: errcheck
+			return
+		}
+		if p != apiPrefix && !strings.HasPrefix(p, apiPrefix+"/") {
+			u := *r.URL
+			u.Path = apiPrefix + strings.TrimPrefix(p, "/api")
+			u.RawPath = ""
+			r = r.WithContext(r.Context())
+			r.URL = &u
+		}
+		next.ServeHTTP(w, r)
+	})
+}
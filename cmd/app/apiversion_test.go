@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestWithAPIVersion(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/recordings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path) //nolint: errcheck
+	})
+	r.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {})
+	h := withAPIVersion(r)
+
+	for _, path := range []string{"/api/v1/recordings/7", "/api/recordings/7"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != "/api/v1/recordings/7" || rr.Header().Get(apiVersionHeader) != "1" {
+			t.Errorf("%s: got %d %q %v", path, rr.Code, rr.Body, rr.Header())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/recordings/7", nil)
+	req.Header.Set(apiVersionHeader, "2")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("unsupported version: got %d", rr.Code)
+	}
+
+	// Only the API is versioned.
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get(apiVersionHeader) != "" {
+		t.Errorf("metrics: got %d %v", rr.Code, rr.Header())
+	}
+}
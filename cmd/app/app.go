@@ -4,25 +4,30 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 
 	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
 	"github.com/prziborowski/hdhr-dvr/pkg/types"
 )
 
@@ -32,15 +37,30 @@ type RecordingRequest struct {
 	StartTime string  `json:"startTime"` // HH:MM
 	Duration  int     `json:"duration"`  // Duration in minutes
 	Title     *string `json:"title,omitempty"`
+	ProgramID *string `json:"programId,omitempty"`
+	// Commercials overrides the comskip mode for this recording.
+	Commercials *string `json:"commercials,omitempty"`
+	// Filters are built-in filters ("deinterlace", "loudnorm") queued as a
+	// transcode job once the recording finishes.
+	Filters []string `json:"filters,omitempty"`
 }
 
 const (
-	preRollSeconds   = 30
-	postRollMinutes  = 1
-	hdhomerunBaseURL = "http://hdhomerun.local"
-	queryTimeout     = 10 * time.Second
+	preRollSeconds  = 30
+	postRollMinutes = 1
+	queryTimeout    = 10 * time.Second
 )
 
+// padding returns how many seconds recordings start early and how many
+// minutes are added to their length: the configured padding, or
+// preRollSeconds and postRollMinutes when none is set.
+func (a *App) padding() (beforeSeconds, afterMinutes int) {
+	if p := a.cfg().Padding; p != nil {
+		return p.BeforeSeconds, p.AfterMinutes
+	}
+	return preRollSeconds, postRollMinutes
+}
+
 // recordingCh is used to queue new recordings for the scheduler.
 var recordingCh = make(chan types.Recording, 100)
 
@@ -49,8 +69,10 @@ var recordingCh = make(chan types.Recording, 100)
 type App struct {
 	store                types.Store
 	sqlDB                *sql.DB
-	config               *pkgcfg.Config
+	config               *pkgcfg.Config // read through cfg(), replaced on reload
+	configMu             sync.RWMutex   // guards config and notifiers
 	commander            Commander
+	storage              storage.Storage
 	tunerCount           int
 	guideData            types.Guide
 	guideDataMutex       sync.RWMutex
@@ -58,47 +80,102 @@ type App struct {
 	runningProcesses     sync.Map // key: recording ID, value: *exec.Cmd
 	enabledChannels      map[string]bool
 	enabledChannelsMutex sync.RWMutex
+	logs                 *logBuffer
+	guideRefreshing      int32
+	events               *eventBus
+	guideChanges         *guideChangeLog
+	extraRoots           []storageRoot
+	nextRoot             uint32
+	transcodeWake        chan struct{} // signalled when a transcode job is queued
+	metadataProviders    []metadataProvider
+	notifiers            []notifierEntry
+	fixedNotifiers       []notifierEntry // not from cfg.Notifications, kept on reload
+	diskLowMu            sync.Mutex
+	diskLow              map[string]bool // storage roots already reported low
+	metrics              *metrics
+	draining             int32 // set once shutdown begins
+	oidcMu               sync.Mutex
+	oidcProvider         *oidcProvider // discovered on first use
+	limiter              *rateLimiter
+	restoring            int32 // set while a backup is restored; pauses the scheduler
+	stmtMu               sync.Mutex
+	stmts                map[string]*sql.Stmt // prepared by dbPrepared, keyed by query
+	maintenanceMu        sync.Mutex
+	maintenance          *MaintenanceStatus // last database maintenance run
+	liveMu               sync.Mutex
+	liveStreams          []*liveStream // proxied to emulation clients, oldest first
 }
 
 func NewApp(cfg *pkgcfg.Config, store types.Store, commander Commander) *App {
 	return &App{
-		config:          cfg,
-		store:           store,
-		commander:       commander,
-		enabledChannels: make(map[string]bool),
+		config:            cfg,
+		store:             store,
+		commander:         commander,
+		storage:           storage.NewLocal(cfg.StorageDir),
+		enabledChannels:   make(map[string]bool),
+		events:            newEventBus(),
+		guideChanges:      newGuideChangeLog(50),
+		extraRoots:        extraStorageRoots(cfg),
+		transcodeWake:     make(chan struct{}, 1),
+		metadataProviders: newMetadataProviders(cfg.Metadata),
+		notifiers:         newNotifiers(cfg.Notifications),
+		metrics:           newMetrics(),
+		limiter:           newRateLimiter(),
 	}
 }
 
 func main() {
+	// Load configuration
+	cfg, err := pkgcfg.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Initialize database
-	var err error
-	db, err := sql.Open("sqlite3", "./recordings.db")
+	db, store, err := openDatabase(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close() //nolint: errcheck
 
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(0)
-
-	// Load configuration
-	cfg, err := pkgcfg.LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := runRestoreCommand(db, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-
-	store := types.NewStoreAdapter(db)
-	commander := &RealCommander{}
+	if err := applyStoredSettings(context.Background(), store, cfg); err != nil {
+		log.Fatalf("Failed to load saved settings: %v", err)
+	}
+	commander := &RealCommander{Paths: map[string]string{"ffmpeg": cfg.FFmpegPath, "ffprobe": cfg.FFprobePath}}
 	app := NewApp(cfg, store, commander)
 	app.sqlDB = db
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		app.createTables()
+		if err := runKeysCommand(app, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		app.createTables()
+		if err := runUsersCommand(app, os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	app.logs = newLogBuffer(1000)
+	if err := setupLogging(io.MultiWriter(os.Stderr, app.logs), cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatalf("Invalid logging config: %v", err)
+	}
 
 	app.tunerCount = app.fetchTunerCount()
-	log.Printf("System initialized with %d tuners", app.tunerCount)
+	slog.Info("System initialized", "tuners", app.tunerCount, "timezone", cfg.Timezone)
 
 	app.createTables()
 	app.loadEnabledChannels()
 	app.loadChannels()
+	app.checkChannelIntegrity(context.Background())
 
 	if app.loadGuide() {
 		go app.setupFileWatcher(app.config.GuideFile)
@@ -106,87 +183,228 @@ func main() {
 
 	app.loadRecordings()
 	app.cleanupOldRecordings()
+	app.applyRetention(context.Background(), time.Now())
+	app.purgeFFmpegLogs(time.Now())
+	app.storeLegacyFileNames(context.Background())
+	app.runReconcile(context.Background())
 
 	go app.startRecordingScheduler()
+	app.startTranscodeWorkers(context.Background())
+	if len(cfg.MediaServers) > 0 {
+		go app.watchMediaServers(context.Background(), mediaRefreshDelay)
+	}
+	if cfg.Telegram != nil && cfg.Telegram.Token != "" {
+		bot := newTelegramBot(app, *cfg.Telegram)
+		app.fixedNotifiers = append(app.fixedNotifiers, bot.entry())
+		app.notifiers = append(app.notifiers, bot.entry())
+		go bot.run(context.Background())
+	}
+	// Providers may be added by a reload, so this runs even without any.
+	go app.watchNotifications(context.Background())
+	go app.runBackupSchedule(context.Background())
+	go app.runMaintenanceSchedule(context.Background())
+	if cfg.DebugAddr != "" {
+		go app.serveDebug(cfg.DebugAddr)
+	}
+	if cfg.MQTT != nil && cfg.MQTT.Broker != "" {
+		go app.runMQTT(context.Background(), *cfg.MQTT)
+	}
+	if cfg.Emulation != nil || cfg.RecordEngine != nil {
+		go app.listenDiscovery()
+	}
+	if cfg.DLNA != nil {
+		go app.listenSSDP(context.Background())
+	}
+	app.checkDiskSpace()
 
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 		for range ticker.C {
 			app.cleanupOldRecordings()
+			app.applyRetention(context.Background(), time.Now())
+			app.purgeFFmpegLogs(time.Now())
+			app.runReconcile(context.Background())
+			app.checkDiskSpace()
 		}
 	}()
 
-	r := mux.NewRouter()
+	r := app.newRouter()
 
-	r.HandleFunc("/", app.serveHome).Methods("GET", "HEAD")
-	r.HandleFunc("/schedule", app.serveHome).Methods("GET", "HEAD")
-	r.HandleFunc("/recordings", app.serveHome).Methods("GET", "HEAD")
-	r.HandleFunc("/guide", app.serveHome).Methods("GET", "HEAD")
-	r.HandleFunc("/keywords", app.serveHome).Methods("GET", "HEAD")
-
-	r.HandleFunc("/api/channels", app.getChannels).Methods("GET")
-	r.HandleFunc("/api/recordings", app.getRecordings).Methods("GET")
-	r.HandleFunc("/api/recordings", app.createRecording).Methods("POST")
-	r.HandleFunc("/api/recordings/{id}", app.deleteRecording).Methods("DELETE")
-	r.HandleFunc("/api/recordings/{id}", app.updateRecording).Methods("PATCH")
-	r.HandleFunc("/api/recordings/{id}/file", app.getRecordingFile).Methods("GET", "HEAD")
-	r.HandleFunc("/api/guide", app.getGuide).Methods("GET")
-	r.HandleFunc("/api/keywords", app.getKeywords).Methods("GET")
-	r.HandleFunc("/api/keywords", app.createKeyword).Methods("POST")
-	r.HandleFunc("/api/keywords/{id}", app.deleteKeyword).Methods("DELETE")
-
-	log.Println("Server starting on :8080...")
+	addr := net.JoinHostPort(cfg.ListenAddr, strconv.Itoa(cfg.Port))
+	if cfg.TLS != nil && cfg.TLS.SelfSigned {
+		if err := ensureSelfSignedCert(cfg.TLS.CertFile, cfg.TLS.KeyFile, time.Now()); err != nil {
+			log.Fatalf("Failed to create self-signed certificate: %v", err)
+		}
+	}
+	slog.Info("Server starting", "addr", addr, "tls", cfg.TLS != nil)
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: r,
+		Addr:              addr,
+		Handler:           serverHandler(app.cors(withBasePath(cfg.BasePath, withAPIVersion(r)))),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
 	}
 
 	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-
-		log.Println("\nReceived shutdown signal...")
-
-		activeCount := 0
-		app.runningProcesses.Range(func(key, value interface{}) bool {
-			activeCount++
-			return true
-		})
-
-		if activeCount > 0 {
-			log.Printf("WARNING: %d recording(s) in progress. Terminating...", activeCount)
-
-			app.runningProcesses.Range(func(key, value interface{}) bool {
-				if cmd, ok := value.(*exec.Cmd); ok && cmd.Process != nil {
-					log.Printf("Terminating recording %d...", key)
-					if err := cmd.Process.Kill(); err != nil {
-						log.Printf("Error killing recording %d: %v", key, err)
-					}
-				}
-				return true
-			})
-
-			time.Sleep(2 * time.Second)
-			log.Println("Recordings terminated. Proceeding with shutdown...")
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			slog.Info("Received SIGHUP, reloading config")
+			app.reloadConfig() //nolint: errcheck
 		}
+	}()
 
-		log.Println("No active recordings. Shutting down gracefully...")
-		time.Sleep(1 * time.Second)
+	stopped := make(chan struct{})
+	go func() {
+		sigChan := make(chan os.Signal, 2)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
 
-		if err := server.Shutdown(context.Background()); err != nil {
-			log.Printf("Server shutdown error: %v", err)
-		}
+		grace := time.Duration(cfg.ShutdownGraceSeconds) * time.Second
+		slog.Info("Received shutdown signal, draining", "grace", grace)
+		go func() {
+			<-sigChan
+			slog.Warn("Second shutdown signal, exiting now")
+			os.Exit(1)
+		}()
+		app.shutdown(server, grace)
+		close(stopped)
 	}()
 
-	log.Fatal(server.ListenAndServe())
+	if cfg.TLS != nil {
+		err = server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+	slog.Info("Shutdown complete")
+}
+
+// newRouter registers every route the server answers.
+func (a *App) newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(a.instrument, a.rateLimit, a.rejectWhileDraining, a.audit, a.requireAuth)
+
+	for _, page := range uiPages {
+		r.HandleFunc(page, a.serveHome).Methods("GET", "HEAD")
+	}
+	r.HandleFunc("/login", a.serveLogin).Methods("GET", "HEAD")
+
+	r.HandleFunc("/api/v1/channels", a.getChannels).Methods("GET")
+	r.HandleFunc("/api/v1/channels/refresh", a.refreshChannels).Methods("POST")
+	r.HandleFunc("/api/v1/recordings", a.getRecordings).Methods("GET")
+	r.HandleFunc("/api/v1/recordings", a.createRecording).Methods("POST")
+	r.HandleFunc("/api/v1/recordings.rss", a.serveRecordingsFeed).Methods("GET")
+	r.HandleFunc("/api/v1/schedule.ics", a.serveScheduleICS).Methods("GET")
+	r.HandleFunc("/api/v1/graphql", a.serveGraphQL).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/openapi.json", a.serveOpenAPI(r)).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}", a.deleteRecording).Methods("DELETE")
+	r.HandleFunc("/api/v1/recordings/{id}", a.updateRecording).Methods("PATCH")
+	r.HandleFunc("/api/v1/recordings/{id}/file", a.getRecordingFile).Methods("GET", "HEAD")
+	r.HandleFunc("/api/v1/recordings/{id}/metadata", a.getRecordingMetadata).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/poster", a.getRecordingPoster).Methods("GET", "HEAD")
+	r.HandleFunc("/api/v1/recordings/{id}/enrich", a.enrichRecordingHandler).Methods("POST")
+	r.HandleFunc("/api/v1/recordings/{id}/log", a.getRecordingLog).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/history", a.getRecordingHistory).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/reports", a.getPlaybackReports).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/reports", a.createPlaybackReport).Methods("POST")
+	r.HandleFunc("/api/v1/recordings/{id}/watch", a.putWatchState).Methods("PUT")
+	r.HandleFunc("/api/v1/recordings/{id}/watch", a.deleteWatchState).Methods("DELETE")
+	r.HandleFunc("/api/v1/recordings/{id}/cancel", a.cancelRecordingHandler).Methods("POST")
+	r.HandleFunc("/api/v1/recordings/{id}/extend", a.extendRecordingHandler).Methods("POST")
+	r.HandleFunc("/api/v1/recordings/{id}/priority", a.setRecordingPriority).Methods("PUT")
+	r.HandleFunc("/api/v1/recordings/{id}/verification", a.getRecordingVerification).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/verify", a.verifyRecordingChecksum).Methods("POST")
+	r.HandleFunc("/api/v1/recordings/{id}/post-processing", a.getPostProcessing).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/edl", a.getRecordingEDL).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/commercials", a.setRecordingCommercials).Methods("PUT")
+	r.HandleFunc("/api/v1/recordings/{id}/transcode", a.createTranscodeJob).Methods("POST")
+	r.HandleFunc("/api/v1/transcode/profiles", a.getTranscodeProfiles).Methods("GET")
+	r.HandleFunc("/api/v1/transcode/profiles", a.createTranscodeProfile).Methods("POST")
+	r.HandleFunc("/api/v1/transcode/profiles/{id}", a.deleteTranscodeProfile).Methods("DELETE")
+	r.HandleFunc("/api/v1/jobs", a.getTranscodeJobs).Methods("GET")
+	r.HandleFunc("/api/v1/jobs/{id}", a.getTranscodeJob).Methods("GET")
+	r.HandleFunc("/api/v1/retention", a.getRetention).Methods("GET")
+	r.HandleFunc("/api/v1/audit", a.getAudit).Methods("GET")
+	r.HandleFunc("/api/v1/stats", a.getStats).Methods("GET")
+	r.HandleFunc("/api/v1/storage", a.getStorageStats).Methods("GET")
+	r.HandleFunc("/api/v1/storage/reconcile", a.reconcileStorageHandler).Methods("POST")
+	r.HandleFunc("/api/v1/storage/import", a.importRecording).Methods("POST")
+	r.HandleFunc("/api/v1/locks", a.getChannelLocks).Methods("GET")
+	r.HandleFunc("/api/v1/locks", a.createChannelLock).Methods("POST")
+	r.HandleFunc("/api/v1/locks/{id}", a.deleteChannelLock).Methods("DELETE")
+	r.HandleFunc("/api/v1/schedule/forecast", a.getScheduleForecast).Methods("GET")
+	r.HandleFunc("/api/v1/guide", a.getGuide).Methods("GET")
+	r.HandleFunc("/api/v1/guide/search", a.searchGuide).Methods("GET")
+	r.HandleFunc("/api/v1/guide/categories", a.getGuideCategories).Methods("GET")
+	r.HandleFunc("/api/v1/guide/now", a.getGuideNow).Methods("GET")
+	r.HandleFunc("/api/v1/guide/refresh", a.refreshGuide).Methods("POST")
+	r.HandleFunc("/api/v1/guide/changes", a.getGuideChanges).Methods("GET")
+	r.HandleFunc("/api/v1/events", a.streamEvents).Methods("GET")
+	r.HandleFunc("/ws", a.serveWebSocket).Methods("GET")
+	r.HandleFunc("/api/v1/notifications/test", a.testNotifications).Methods("POST")
+	r.HandleFunc("/api/v1/logs", a.getLogs).Methods("GET")
+	r.HandleFunc("/api/v1/admin/loglevel", a.getLogLevel).Methods("GET")
+	r.HandleFunc("/api/v1/admin/loglevel", a.putLogLevel).Methods("PUT")
+	r.HandleFunc("/api/v1/admin/reload", a.reloadConfigHandler).Methods("POST")
+	r.HandleFunc("/api/v1/admin/backup", a.postBackup).Methods("POST")
+	r.HandleFunc("/api/v1/admin/backups", a.getBackups).Methods("GET")
+	r.HandleFunc("/api/v1/admin/restore", a.postRestore).Methods("POST")
+	r.HandleFunc("/api/v1/login", a.login).Methods("POST")
+	r.HandleFunc("/api/v1/logout", a.logout).Methods("POST")
+	r.HandleFunc("/api/v1/session", a.getSession).Methods("GET")
+	r.HandleFunc("/api/v1/profile/watch", a.getWatchStates).Methods("GET")
+	r.HandleFunc("/api/v1/profile/favorites", a.getFavoriteChannels).Methods("GET")
+	r.HandleFunc("/api/v1/profile/favorites/{channel}", a.putFavoriteChannel).Methods("PUT")
+	r.HandleFunc("/api/v1/profile/favorites/{channel}", a.deleteFavoriteChannel).Methods("DELETE")
+	r.HandleFunc("/api/v1/oidc/login", a.oidcLogin).Methods("GET")
+	r.HandleFunc("/api/v1/oidc/callback", a.oidcCallback).Methods("GET")
+	r.HandleFunc("/api/v1/admin/keys", a.getAPIKeys).Methods("GET")
+	r.HandleFunc("/api/v1/admin/keys", a.createAPIKeyHandler).Methods("POST")
+	r.HandleFunc("/api/v1/admin/keys/{id}", a.revokeAPIKeyHandler).Methods("DELETE")
+	r.HandleFunc("/api/v1/settings", a.getSettings).Methods("GET")
+	r.HandleFunc("/api/v1/settings", a.putSettings).Methods("PUT")
+	r.HandleFunc("/metrics", a.serveMetrics).Methods("GET")
+	r.HandleFunc("/discover.json", a.serveDiscover).Methods("GET")
+	r.HandleFunc("/lineup.json", a.serveLineup).Methods("GET")
+	r.HandleFunc("/lineup_status.json", a.serveLineupStatus).Methods("GET")
+	r.HandleFunc("/auto/v{channel}", a.serveLiveStream).Methods("GET")
+	r.HandleFunc("/playlist.m3u", a.serveM3U).Methods("GET")
+	r.HandleFunc("/schedule.ics", a.serveScheduleICS).Methods("GET")
+	r.HandleFunc(graphqlRootRoute, a.serveGraphQL).Methods("GET", "POST")
+	r.HandleFunc("/xmltv.xml", a.serveXMLTV).Methods("GET")
+	r.HandleFunc("/record/discover.json", a.serveRecordEngineDiscover).Methods("GET")
+	r.HandleFunc("/record/recorded_files.json", a.serveRecordedFiles).Methods("GET")
+	r.HandleFunc("/record/recorded/play", a.serveRecordedPlay).Methods("GET", "HEAD")
+	r.HandleFunc("/record/recorded/image", a.serveRecordedImage).Methods("GET", "HEAD")
+	r.HandleFunc("/record/recorded/cmd", a.serveRecordedCmd).Methods("POST")
+	r.HandleFunc("/dlna/device.xml", a.serveDLNADevice).Methods("GET")
+	r.HandleFunc("/dlna/ContentDirectory.xml", a.serveDLNASCPD(contentDirectorySCPD)).Methods("GET")
+	r.HandleFunc("/dlna/ConnectionManager.xml", a.serveDLNASCPD(connectionManagerSCPD)).Methods("GET")
+	r.HandleFunc("/dlna/control/ContentDirectory", a.serveContentDirectory).Methods("POST")
+	r.HandleFunc("/dlna/control/ConnectionManager", a.serveConnectionManager).Methods("POST")
+	r.HandleFunc("/dlna/media/{id}", a.serveDLNAMedia).Methods("GET", "HEAD")
+	r.HandleFunc("/api/v1/diagnostics/throughput", a.runThroughputProbe).Methods("POST")
+	r.HandleFunc("/api/v1/keywords", a.getKeywords).Methods("GET")
+	r.HandleFunc("/api/v1/keywords", a.createKeyword).Methods("POST")
+	r.HandleFunc("/api/v1/keywords/{id}", a.deleteKeyword).Methods("DELETE")
+	return r
 }
 
 // ---------------------------------------------------------------------------
 // Recording creation handler
 // ---------------------------------------------------------------------------
 
+// RecordingUpdate is the body of PATCH /api/recordings/{id}.
+type RecordingUpdate struct {
+	Title *string `json:"title"`
+}
+
 func (a *App) updateRecording(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PATCH" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -207,9 +425,7 @@ func (a *App) updateRecording(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	var updateReq struct {
-		Title *string `json:"title"`
-	}
+	var updateReq RecordingUpdate
 
 	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -223,14 +439,14 @@ func (a *App) updateRecording(w http.ResponseWriter, r *http.Request) {
 
 	result, err := a.dbExecContext(ctx, "UPDATE recordings SET title = ? WHERE id = ? AND status = 'pending'", *updateReq.Title, id)
 	if err != nil {
-		log.Printf("Error updating recording: %v", err)
+		requestLogger(r).Error("Error updating recording", "err", err)
 		http.Error(w, "Failed to update recording", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
+		requestLogger(r).Error("Error getting rows affected", "err", err)
 	}
 	if rowsAffected == 0 {
 		http.Error(w, "Recording not found or not pending", http.StatusNotFound)
@@ -251,59 +467,85 @@ func (a *App) createRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
-
 	var req RecordingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Duration <= 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Duration must be positive"}) //nolint: errcheck
+	recording, err := a.scheduleRecording(r.Context(), req)
+	if err != nil {
+		se, ok := err.(*scheduleError)
+		switch {
+		case !ok:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case se.plain:
+			http.Error(w, se.msg, se.status)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(se.status)
+			json.NewEncoder(w).Encode(map[string]string{"error": se.msg}) //nolint: errcheck
+		}
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recording) //nolint: errcheck
+}
+
+// scheduleError is a scheduling failure and the HTTP status it maps to.
+// Plain errors are sent as text rather than JSON.
+type scheduleError struct {
+	status int
+	msg    string
+	plain  bool
+}
+
+func (e *scheduleError) Error() string { return e.msg }
+
+// scheduleRecording validates req and adds it as a pending recording,
+// linked to its guide program when there is one.
+func (a *App) scheduleRecording(ctx context.Context, req RecordingRequest) (types.Recording, error) {
+	if req.Duration <= 0 {
+		return types.Recording{}, &scheduleError{status: http.StatusBadRequest, msg: "Duration must be positive"}
+	}
+	if req.Commercials != nil && !validCommercialMode(*req.Commercials) {
+		return types.Recording{}, &scheduleError{status: http.StatusBadRequest, msg: "commercials must be mark or cut"}
+	}
+	filters, err := normalizeFilters(req.Filters)
+	if err != nil {
+		return types.Recording{}, &scheduleError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+
 	var exists bool
-	err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM channels WHERE guide_number = ?)", req.ChannelID).Scan(&exists)
+	err = a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM channels WHERE guide_number = ?)", req.ChannelID).Scan(&exists)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return types.Recording{}, err
 	}
 	if !exists {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Channel not found"}) //nolint: errcheck
-		return
+		return types.Recording{}, &scheduleError{status: http.StatusNotFound, msg: "Channel not found"}
 	}
 
 	var duplicateExists bool
 	err = a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recordings WHERE channel_id = ? AND date = ? AND start_time = ?)", req.ChannelID, req.Date, req.StartTime).Scan(&duplicateExists)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return types.Recording{}, err
 	}
 	if duplicateExists {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Recording already exists for this channel and time"}) //nolint: errcheck
-		return
+		return types.Recording{}, &scheduleError{status: http.StatusConflict, msg: "Recording already exists for this channel and time"}
 	}
 
 	// Validate tuner availability with the computed time window
 	if _, err := a.isTunerAvailable(ctx, req); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return types.Recording{}, err
 	}
 
 	txCtx, txCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer txCancel()
 	tx, err := a.store.BeginTx(txCtx, nil)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
+		return types.Recording{}, &scheduleError{status: http.StatusInternalServerError, msg: "Database error", plain: true}
 	}
 	defer tx.Rollback() //nolint: errcheck
 
@@ -312,7 +554,7 @@ func (a *App) createRecording(w http.ResponseWriter, r *http.Request) {
 		Date:      req.Date,
 		StartTime: req.StartTime,
 		Duration:  req.Duration,
-		Status:    "pending",
+		Status:    statusPending,
 		Title:     req.Title,
 	}
 
@@ -321,32 +563,59 @@ func (a *App) createRecording(w http.ResponseWriter, r *http.Request) {
         VALUES (?, ?, ?, ?, ?, ?)
      `, recording.ChannelID, recording.Date, recording.StartTime, recording.Duration, recording.Status, recording.Title)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create recording"}) //nolint: errcheck
-		return
+		return types.Recording{}, &scheduleError{status: http.StatusInternalServerError, msg: "Failed to create recording"}
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get recording ID"}) //nolint: errcheck
-		return
+		return types.Recording{}, &scheduleError{status: http.StatusInternalServerError, msg: "Failed to get recording ID"}
 	}
 	recording.ID = int(id)
+	if err := insertStatusEvent(ctx, tx, id, "", statusPending, "scheduled"); err != nil {
+		return types.Recording{}, &scheduleError{status: http.StatusInternalServerError, msg: "Failed to create recording"}
+	}
 
 	if err := tx.Commit(); err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
 		tx.Rollback() //nolint: errcheck
-		return
+		return types.Recording{}, &scheduleError{status: http.StatusInternalServerError, msg: "Database error", plain: true}
 	}
 
 	recordingCh <- recording
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(recording) //nolint: errcheck
+	var programID string
+	if req.ProgramID != nil {
+		programID = *req.ProgramID
+	}
+	if prog, ok := a.findGuideProgram(recording.ChannelID, recording.Date, recording.StartTime); ok {
+		if err := a.saveRecordingMetadata(ctx, recording.ID, prog); err != nil {
+			slog.Error("Error saving metadata for recording", "recording_id", recording.ID, "err", err)
+		} else if len(a.metadataProviders) > 0 {
+			go func(id int) {
+				if _, err := a.enrichRecording(context.Background(), id); err != nil {
+					slog.Error("Error enriching metadata of recording", "recording_id", id, "err", err)
+				}
+			}(recording.ID)
+		}
+		if programID == "" {
+			programID = prog.ID
+		}
+	}
+	if programID != "" {
+		if err := a.linkProgram(ctx, recording.ID, programID); err != nil {
+			slog.Error("Error linking recording to program", "recording_id", recording.ID, "program_id", programID, "err", err)
+		}
+	}
+	if req.Commercials != nil {
+		if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_commercials (recording_id, mode) VALUES (?, ?)", recording.ID, *req.Commercials); err != nil {
+			slog.Error("Error saving commercial mode of recording", "recording_id", recording.ID, "err", err)
+		}
+	}
+	if len(filters) > 0 {
+		if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_filters (recording_id, filters) VALUES (?, ?)", recording.ID, strings.Join(filters, ",")); err != nil {
+			slog.Error("Error saving filters of recording", "recording_id", recording.ID, "err", err)
+		}
+	}
+	return recording, nil
 }
 
 // isTunerAvailable returns true if there are fewer active tuners than the configured limit
@@ -359,12 +628,18 @@ func (a *App) isTunerAvailable(ctx context.Context, req RecordingRequest) (bool,
 	}
 	reqEnd := reqStart.Add(time.Duration(req.Duration) * time.Minute)
 
+	// Dates compare as text, so narrow the recordings down to those starting
+	// between the longest recording's duration before the request and its
+	// end, and check the overlap below.
+	var longest int
+	if err := a.dbQueryRowContext(ctx, "SELECT COALESCE(MAX(duration), 0) FROM recordings").Scan(&longest); err != nil {
+		return false, err
+	}
 	rows, err := a.dbQueryContext(ctx, `
 		SELECT date, start_time, duration
 		FROM recordings
-		WHERE datetime(date || ' ' || start_time) < datetime(?, '+' || ? || ' minutes')
-		  AND datetime(date || ' ' || start_time, '+' || duration || ' minutes') > datetime(?)`,
-		startStr, req.Duration, startStr)
+		WHERE date >= ? AND date <= ?`,
+		reqStart.Add(-time.Duration(longest)*time.Minute).Format("2006-01-02"), reqEnd.Format("2006-01-02"))
 	if err != nil {
 		return false, err
 	}
@@ -383,9 +658,25 @@ func (a *App) isTunerAvailable(ctx context.Context, req RecordingRequest) (bool,
 		}
 		st, _ := time.Parse("2006-01-02 15:04", d+" "+s)
 		et := st.Add(time.Duration(dur) * time.Minute)
+		if !st.Before(reqEnd) || !et.After(reqStart) {
+			continue
+		}
 		events = append(events, event{st, 1})
 		events = append(events, event{et, -1})
 	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	// Channel locks hold a tuner for live viewing. Recording times here are
+	// wall-clock values parsed as UTC, so expand the locks the same way.
+	locks, err := a.lockIntervals(ctx, reqStart, reqEnd, time.UTC)
+	if err != nil {
+		return false, err
+	}
+	for _, l := range locks {
+		events = append(events, event{l.start, 1}, event{l.end, -1})
+	}
 
 	sort.Slice(events, func(i, j int) bool {
 		if events[i].t.Equal(events[j].t) {
@@ -412,6 +703,7 @@ func (a *App) isTunerAvailable(ctx context.Context, req RecordingRequest) (bool,
 // ---------------------------------------------------------------------------
 
 func (a *App) getRecordingFile(w http.ResponseWriter, r *http.Request) {
+	noWriteTimeout(w)
 	ctx := r.Context()
 
 	idStr := mux.Vars(r)["id"]
@@ -425,12 +717,13 @@ func (a *App) getRecordingFile(w http.ResponseWriter, r *http.Request) {
 	var channelName string
 	err = a.dbQueryRowContext(ctx, `
         SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.status, r.title,
-               c.guide_name
+               c.guide_name, COALESCE(f.path, '')
          FROM recordings r
          LEFT JOIN channels c ON r.channel_id = c.guide_number
+         LEFT JOIN recording_files f ON f.recording_id = r.id
          WHERE r.id = ?
      `, id).Scan(&recording.ID, &recording.ChannelID, &recording.Date,
-		&recording.StartTime, &recording.Duration, &recording.Status, &recording.Title, &channelName)
+		&recording.StartTime, &recording.Duration, &recording.Status, &recording.Title, &channelName, &recording.FileName)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -441,19 +734,45 @@ func (a *App) getRecordingFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if recording.Status != "completed" {
+	if recording.Status != "completed" && recording.Status != statusPartial && recording.Status != statusArchived {
 		http.Error(w, "Recording not completed", http.StatusForbidden)
 		return
 	}
 
-	// After conversion completes, the original .ts is deleted and only .mp4 remains.
-	// Build the file path with .mp4 extension to match what's actually on disk.
-	originalPath := filepath.Join(a.config.StorageDir, recording.GetFilePath())
-	outputFile := strings.TrimSuffix(originalPath, filepath.Ext(originalPath)) + ".mp4"
+	if p := a.cfg().Parental; p != nil && recordingRestricted(p, recording.ChannelID, a.recordingCategory(ctx, id)) && !a.parentalUnlocked(r, p) {
+		http.Error(w, "Recording is restricted; a PIN is required", http.StatusForbidden)
+		return
+	}
+
+	// Only the name stored when the file was written is served, never one
+	// rebuilt from the title and channel.
+	if recording.FileName == "" {
+		http.Error(w, "Recording file not found", http.StatusNotFound)
+		return
+	}
+	file, err := a.recordingStorage(ctx, id).Open(recording.FileName)
+	if err != nil {
+		if errors.Is(err, storage.ErrOutsideRoot) {
+			requestLogger(r).Warn("Refused recording file outside its storage root", "recording_id", id, "path", recording.FileName)
+		}
+		if os.IsNotExist(err) || errors.Is(err, storage.ErrOutsideRoot) {
+			http.Error(w, "Recording file not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer file.Close() //nolint: errcheck
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Serve the file using http.ServeContent which handles Range requests,
 	// Content-Type detection, and Content-Length automatically.
-	http.ServeFile(w, r, outputFile)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
 }
 
 // ---------------------------------------------------------------------------
@@ -474,13 +793,13 @@ func (a *App) deleteRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = a.dbExecContext(ctx, "DELETE FROM recordings WHERE id = ?", id)
-	if err != nil {
+	if err := a.purgeRecording(ctx, id); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	recordingTimers.Delete(id)
+	a.events.publish(eventRecordingDeleted, map[string]interface{}{"id": id})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -501,22 +820,60 @@ func (a *App) dbQueryRowContext(ctx context.Context, query string, args ...inter
 	return a.store.QueryRowContext(ctx, query, args...)
 }
 
-func (a *App) markFailed(id int) {
-	log.Printf("Marking recording %d as failed", id)
-	_, err := a.dbExecContext(context.Background(), "UPDATE recordings SET status = 'failed' WHERE id = ?", id)
+// dbPrepared returns query prepared on the store, preparing it on first
+// use. It is for the statements the scheduler runs every minute; the
+// statements stay open for the life of the app.
+func (a *App) dbPrepared(ctx context.Context, query string) (*sql.Stmt, error) {
+	a.stmtMu.Lock()
+	defer a.stmtMu.Unlock()
+	if stmt, ok := a.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := a.store.PrepareContext(ctx, query)
 	if err != nil {
-		log.Printf("Error updating recording status to failed: %v", err)
+		return nil, err
+	}
+	if a.stmts == nil {
+		a.stmts = map[string]*sql.Stmt{}
+	}
+	a.stmts[query] = stmt
+	return stmt, nil
+}
+
+const (
+	pendingRecordingsQuery = `
+        SELECT id, channel_id, date, start_time, duration, status, title
+        FROM recordings
+        WHERE status = 'pending'
+        ORDER BY date, start_time`
+	recordingStillPendingQuery = "SELECT EXISTS(SELECT 1 FROM recordings WHERE id = ? AND status = 'pending' AND date = ? AND start_time = ?)"
+)
+
+func (a *App) markFailed(id int, reason string) {
+	slog.Warn("Marking recording as failed", "recording_id", id, "reason", reason)
+	err := a.setStatus(context.Background(), id, statusFailed, reason)
+	if errors.Is(err, errInvalidTransition) {
+		slog.Warn("Not marking recording as failed", "recording_id", id, "err", err)
+		return
+	} else if err != nil {
+		slog.Error("Error updating recording status to failed", "err", err)
 	}
+	a.events.publish(eventRecordingFailed, map[string]interface{}{"id": id})
 }
 
-// getLocalLocation returns the configured timezone location.
+// getLocalLocation returns the configured timezone location, or the
+// system's when none is configured.
 func (a *App) getLocalLocation() (*time.Location, error) {
-	tz := "America/Los_Angeles"
-	if a.config != nil && a.config.Timezone != "" {
-		tz = a.config.Timezone
+	tz := ""
+	if cfg := a.cfg(); cfg != nil {
+		tz = cfg.Timezone
+	}
+	if tz == "" {
+		return time.Local, nil
 	}
 	loc, err := time.LoadLocation(tz)
 	if err != nil {
+		slog.Error("Error loading timezone, using UTC", "timezone", tz, "err", err)
 		return time.UTC, nil
 	}
 	return loc, nil
@@ -534,6 +891,16 @@ func (a *App) createTables() {
             url TEXT,
             enabled INTEGER DEFAULT 1
          );
+        CREATE TABLE IF NOT EXISTS channel_lineup (
+            guide_number TEXT PRIMARY KEY,
+            video_codec TEXT NOT NULL DEFAULT '',
+            audio_codec TEXT NOT NULL DEFAULT '',
+            hd INTEGER NOT NULL DEFAULT 0,
+            signal_strength INTEGER NOT NULL DEFAULT 0,
+            signal_quality INTEGER NOT NULL DEFAULT 0,
+            last_seen DATETIME NOT NULL,
+            FOREIGN KEY(guide_number) REFERENCES channels(guide_number)
+         );
         CREATE TABLE IF NOT EXISTS recordings (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             channel_id TEXT,
@@ -547,6 +914,7 @@ func (a *App) createTables() {
             FOREIGN KEY(channel_id) REFERENCES channels(guide_number)
          );
         CREATE INDEX IF NOT EXISTS idx_recordings_channel ON recordings(channel_id);
+        CREATE INDEX IF NOT EXISTS idx_recordings_status_start ON recordings(status, date, start_time);
         CREATE TABLE IF NOT EXISTS keywords (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             name TEXT UNIQUE NOT NULL,
@@ -554,10 +922,260 @@ func (a *App) createTables() {
             enabled INTEGER DEFAULT 1,
             created_at DATETIME DEFAULT CURRENT_TIMESTAMP
          );
+        CREATE TABLE IF NOT EXISTS recording_metadata (
+            recording_id INTEGER PRIMARY KEY,
+            title TEXT,
+            subtitle TEXT,
+            description TEXT,
+            category TEXT,
+            season INTEGER DEFAULT 0,
+            episode INTEGER DEFAULT 0,
+            original_air_date TEXT,
+            year INTEGER DEFAULT 0,
+            rating TEXT,
+            cast_json TEXT DEFAULT '[]',
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS playback_reports (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            recording_id INTEGER NOT NULL,
+            offset_seconds REAL NOT NULL,
+            kind TEXT NOT NULL,
+            note TEXT DEFAULT '',
+            client TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE INDEX IF NOT EXISTS idx_playback_reports_recording ON playback_reports(recording_id);
+        CREATE TABLE IF NOT EXISTS recording_repairs (
+            recording_id INTEGER PRIMARY KEY,
+            status TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS channel_locks (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            channel_id TEXT NOT NULL,
+            name TEXT DEFAULT '',
+            days TEXT NOT NULL,
+            start_time TEXT NOT NULL,
+            duration INTEGER NOT NULL,
+            enabled INTEGER DEFAULT 1,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(channel_id) REFERENCES channels(guide_number)
+         );
+        CREATE TABLE IF NOT EXISTS program_links (
+            recording_id INTEGER PRIMARY KEY,
+            program_id TEXT NOT NULL,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE INDEX IF NOT EXISTS idx_program_links_program ON program_links(program_id);
+        CREATE TABLE IF NOT EXISTS recording_priorities (
+            recording_id INTEGER PRIMARY KEY,
+            priority INTEGER NOT NULL DEFAULT 0,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_storage (
+            recording_id INTEGER PRIMARY KEY,
+            root TEXT NOT NULL,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_files (
+            recording_id INTEGER PRIMARY KEY,
+            path TEXT NOT NULL,
+            duration_seconds REAL,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE INDEX IF NOT EXISTS idx_recording_files_path ON recording_files(path);
+        CREATE TABLE IF NOT EXISTS post_processing (
+            recording_id INTEGER NOT NULL,
+            step INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            status TEXT NOT NULL,
+            output TEXT,
+            started_at DATETIME,
+            finished_at DATETIME,
+            PRIMARY KEY(recording_id, step),
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_edl (
+            recording_id INTEGER PRIMARY KEY,
+            edl TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_commercials (
+            recording_id INTEGER PRIMARY KEY,
+            mode TEXT NOT NULL,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS keyword_commercials (
+            keyword_id INTEGER PRIMARY KEY,
+            mode TEXT NOT NULL,
+            FOREIGN KEY(keyword_id) REFERENCES keywords(id)
+         );
+        CREATE TABLE IF NOT EXISTS transcode_profiles (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT UNIQUE NOT NULL,
+            video_codec TEXT NOT NULL,
+            video_bitrate TEXT NOT NULL DEFAULT '',
+            height INTEGER NOT NULL DEFAULT 0,
+            audio_codec TEXT NOT NULL,
+            audio_bitrate TEXT NOT NULL DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+         );
+        CREATE TABLE IF NOT EXISTS transcode_jobs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            recording_id INTEGER NOT NULL,
+            profile TEXT NOT NULL,
+            status TEXT NOT NULL,
+            output TEXT,
+            error TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            started_at DATETIME,
+            finished_at DATETIME,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE INDEX IF NOT EXISTS idx_transcode_jobs_status ON transcode_jobs(status);
+        CREATE TABLE IF NOT EXISTS recording_verifications (
+            recording_id INTEGER PRIMARY KEY,
+            video_streams INTEGER NOT NULL,
+            audio_streams INTEGER NOT NULL,
+            expected_seconds REAL NOT NULL,
+            measured_seconds REAL NOT NULL,
+            decode_errors INTEGER NOT NULL,
+            errors TEXT,
+            verified_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_enrichment (
+            recording_id INTEGER PRIMARY KEY,
+            provider TEXT NOT NULL,
+            series_id TEXT NOT NULL,
+            series_name TEXT NOT NULL,
+            episode_id TEXT NOT NULL DEFAULT '',
+            synopsis TEXT NOT NULL DEFAULT '',
+            year INTEGER NOT NULL DEFAULT 0,
+            image_url TEXT NOT NULL DEFAULT '',
+            fanart_url TEXT NOT NULL DEFAULT '',
+            enriched_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_filters (
+            recording_id INTEGER PRIMARY KEY,
+            filters TEXT NOT NULL,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS keyword_filters (
+            keyword_id INTEGER PRIMARY KEY,
+            filters TEXT NOT NULL,
+            FOREIGN KEY(keyword_id) REFERENCES keywords(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_checksums (
+            recording_id INTEGER NOT NULL,
+            location TEXT NOT NULL DEFAULT '',
+            sha256 TEXT NOT NULL,
+            computed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            verified_at DATETIME,
+            verified_ok BOOLEAN,
+            PRIMARY KEY (recording_id, location),
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_archives (
+            recording_id INTEGER PRIMARY KEY,
+            location TEXT NOT NULL,
+            local_deleted BOOLEAN NOT NULL DEFAULT 0,
+            archived_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE TABLE IF NOT EXISTS recording_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            recording_id INTEGER NOT NULL,
+            from_status TEXT NOT NULL DEFAULT '',
+            to_status TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            created_at DATETIME NOT NULL,
+            FOREIGN KEY(recording_id) REFERENCES recordings(id)
+         );
+        CREATE INDEX IF NOT EXISTS idx_recording_events_recording ON recording_events(recording_id);
+        CREATE TABLE IF NOT EXISTS retention_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            recording_id INTEGER NOT NULL,
+            channel_id TEXT,
+            date TEXT,
+            start_time TEXT,
+            title TEXT,
+            file_size INTEGER DEFAULT 0,
+            reason TEXT NOT NULL,
+            deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+         );
+        CREATE TABLE IF NOT EXISTS audit_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            method TEXT NOT NULL,
+            route TEXT NOT NULL,
+            path TEXT NOT NULL,
+            target TEXT,
+            status INTEGER NOT NULL,
+            remote_ip TEXT NOT NULL,
+            forwarded_for TEXT,
+            user_agent TEXT,
+            request_id TEXT,
+            body TEXT,
+            previous TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+         );
+        CREATE TABLE IF NOT EXISTS api_keys (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            prefix TEXT NOT NULL,
+            hash TEXT NOT NULL UNIQUE,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            last_used_at DATETIME,
+            revoked_at DATETIME
+         );
+
+        CREATE TABLE IF NOT EXISTS users (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            username TEXT NOT NULL UNIQUE,
+            password_hash TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+         );
+
+        CREATE TABLE IF NOT EXISTS user_roles (
+            user_id INTEGER PRIMARY KEY,
+            role TEXT NOT NULL
+         );
+
+        CREATE TABLE IF NOT EXISTS sessions (
+            hash TEXT PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            expires_at INTEGER NOT NULL
+         );
+
+        CREATE TABLE IF NOT EXISTS watch_state (
+            user_id INTEGER NOT NULL,
+            recording_id INTEGER NOT NULL,
+            watched INTEGER NOT NULL DEFAULT 0,
+            position_seconds REAL NOT NULL DEFAULT 0,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (user_id, recording_id)
+         );
+
+        CREATE TABLE IF NOT EXISTS favorite_channels (
+            user_id INTEGER NOT NULL,
+            guide_number TEXT NOT NULL,
+            PRIMARY KEY (user_id, guide_number)
+         );
      `)
 	if err != nil {
 		log.Fatal(err)
 	}
+	a.createSearchTable()
+	if err := createSettingsTable(context.Background(), a.store); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func (a *App) loadEnabledChannels() {
@@ -566,7 +1184,7 @@ func (a *App) loadEnabledChannels() {
 
 	rows, err := a.dbQueryContext(ctx, "SELECT guide_number FROM channels WHERE enabled=1")
 	if err != nil {
-		log.Printf("Error loading enabled channels: %v", err)
+		slog.Error("Error loading enabled channels", "err", err)
 		return
 	}
 	defer rows.Close() //nolint:errcheck
@@ -575,7 +1193,7 @@ func (a *App) loadEnabledChannels() {
 	for rows.Next() {
 		var chNum string
 		if err := rows.Scan(&chNum); err != nil {
-			log.Printf("Error scanning enabled channel number: %v", err)
+			slog.Error("Error scanning enabled channel number", "err", err)
 			continue
 		}
 		newEnabledChannels[chNum] = true
@@ -587,81 +1205,149 @@ func (a *App) loadEnabledChannels() {
 }
 
 func (a *App) loadChannels() {
-	log.Println("Fetching channels")
+	slog.Info("Fetching channels")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://hdhomerun.local/lineup.json?show=found", nil)
+	chs, err := fetchLineup(ctx, a.cfg().DeviceURL)
 	if err != nil {
-		log.Printf("Error creating channels request: %v", err)
+		slog.Error("Error fetching channels", "err", err)
 		return
 	}
+	a.storeChannels(chs)
+}
+
+// fetchLineup returns the channels the tuner at deviceURL has found.
+func fetchLineup(ctx context.Context, deviceURL string) ([]types.Channel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", deviceURL+"/lineup.json?show=found", nil)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Printf("Error fetching channels: %v", err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close() //nolint: errcheck
 
 	var chs []types.Channel
 	if err := json.NewDecoder(resp.Body).Decode(&chs); err != nil {
-		log.Printf("Error decoding channels: %v", err)
+		return nil, fmt.Errorf("decoding lineup: %w", err)
+	}
+	return chs, nil
+}
+
+// refreshChannels fetches the lineup again, e.g. after a channel scan, and
+// returns the enabled channels.
+func (a *App) refreshChannels(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	chs, err := fetchLineup(ctx, a.cfg().DeviceURL)
+	if err != nil {
+		requestLogger(r).Error("Error fetching channels", "err", err)
+		http.Error(w, "Could not fetch the tuner lineup: "+err.Error(), http.StatusBadGateway)
 		return
 	}
+	a.storeChannels(chs)
+	a.getChannels(w, r)
+}
+
+// storeChannels replaces the stored lineup with chs and publishes
+// channels.changed if that changed anything.
+func (a *App) storeChannels(chs []types.Channel) {
+	before, err := a.channelSnapshot(context.Background())
+	if err != nil {
+		slog.Error("Error reading channels", "err", err)
+	}
 
 	tx, err := a.store.BeginTx(context.Background(), nil)
 	if err != nil {
-		log.Printf("Error starting transaction for channels: %v", err)
+		slog.Error("Error starting transaction for channels", "err", err)
 		return
 	}
 
 	_, err = tx.ExecContext(context.Background(), "UPDATE channels SET enabled=0")
 	if err != nil {
-		log.Printf("Error clearing channels table: %v", err)
+		slog.Error("Error clearing channels table", "err", err)
 		tx.Rollback() //nolint: errcheck
 		return
 	}
 
+	// One timestamp for the whole lineup, so the channels missing from it
+	// are those seen before the latest last_seen.
+	seen := time.Now().UTC()
 	failedCount := 0
 	for _, ch := range chs {
 		_, err := tx.ExecContext(context.Background(), "INSERT OR REPLACE INTO channels (guide_number, guide_name, url, enabled) VALUES (?, ?, ?, ?)",
 			ch.GuideNumber, ch.GuideName, ch.URL, ch.Enabled == nil || *ch.Enabled == 1)
+		if err == nil {
+			_, err = tx.ExecContext(context.Background(), `
+				INSERT OR REPLACE INTO channel_lineup (guide_number, video_codec, audio_codec, hd, signal_strength, signal_quality, last_seen)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				ch.GuideNumber, ch.VideoCodec, ch.AudioCodec, ch.HD, ch.SignalStrength, ch.SignalQuality, seen)
+		}
 		if err != nil {
-			log.Printf("Error storing channel %s: %v", ch.GuideNumber, err)
+			slog.Error("Error storing channel", "channel", ch.GuideNumber, "err", err)
 			failedCount++
 		}
 	}
 
 	if failedCount > 0 {
-		log.Printf("WARNING: %d channels failed to insert, rolling back transaction", failedCount)
+		slog.Warn("Channels failed to insert, rolling back transaction", "failed", failedCount)
 		tx.Rollback() //nolint: errcheck
 		return
 	}
 
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing channels transaction: %v", err)
+		slog.Error("Error committing channels transaction", "err", err)
 		tx.Rollback() //nolint: errcheck
 	}
 	a.loadEnabledChannels()
+
+	after, err := a.channelSnapshot(context.Background())
+	if err == nil && after != before {
+		a.events.publish("channels.changed", map[string]interface{}{"count": len(chs)})
+	}
+}
+
+// channelSnapshot renders the stored lineup as a string to compare.
+func (a *App) channelSnapshot(ctx context.Context) (string, error) {
+	rows, err := a.dbQueryContext(ctx, "SELECT guide_number, COALESCE(guide_name, ''), COALESCE(url, ''), enabled FROM channels ORDER BY guide_number")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close() //nolint: errcheck
+	var b strings.Builder
+	for rows.Next() {
+		var number, name, url string
+		var enabled bool
+		if err := rows.Scan(&number, &name, &url, &enabled); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%v\n", number, name, url, enabled)
+	}
+	return b.String(), rows.Err()
 }
 
 func (a *App) loadRecordings() {
-	log.Println("Load recordings")
+	slog.Info("Loading recordings")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	tx, err := a.store.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error starting database transaction: %v", err)
+		slog.Error("Error starting database transaction", "err", err)
 		return
 	}
 	defer tx.Rollback() //nolint: errcheck
 
 	rows, err := tx.QueryContext(ctx, `
-         SELECT id, channel_id, date, start_time, duration, status, title, file_size
-         FROM recordings
+         SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.status, r.title, r.file_size,
+                COALESCE(rs.root, ''), COALESCE(f.path, '')
+         FROM recordings r
+         LEFT JOIN recording_storage rs ON rs.recording_id = r.id
+         LEFT JOIN recording_files f ON f.recording_id = r.id
       `)
 	if err != nil {
-		log.Printf("Error loading recordings: %v", err)
+		slog.Error("Error loading recordings", "err", err)
 		return
 	}
 
@@ -670,55 +1356,61 @@ func (a *App) loadRecordings() {
 
 	for rows.Next() {
 		var r types.Recording
-		if err := rows.Scan(&r.ID, &r.ChannelID, &r.Date, &r.StartTime, &r.Duration, &r.Status, &r.Title, &r.FileSize); err != nil {
-			log.Printf("Error scanning recording: %v", err)
+		var root string
+		if err := rows.Scan(&r.ID, &r.ChannelID, &r.Date, &r.StartTime, &r.Duration, &r.Status, &r.Title, &r.FileSize, &root, &r.FileName); err != nil {
+			slog.Error("Error scanning recording", "err", err)
 			continue
 		}
 
 		dateTimeStr := fmt.Sprintf("%s %s", r.Date, r.StartTime)
 		startTime, err := time.ParseInLocation("2006-01-02 15:04", dateTimeStr, loc)
 		if err != nil {
-			log.Printf("Error parsing start time for recording %d: %v", r.ID, err)
+			slog.Error("Error parsing start time for recording", "recording_id", r.ID, "err", err)
 			continue
 		}
 
-		adjustedStartTime := startTime.Add(-preRollSeconds * time.Second)
-		endTime := adjustedStartTime.Add(time.Duration(r.Duration+postRollMinutes) * time.Minute)
+		before, after := a.padding()
+		adjustedStartTime := startTime.Add(-time.Duration(before) * time.Second)
+		endTime := adjustedStartTime.Add(time.Duration(r.Duration+after) * time.Minute)
 
 		if now.After(endTime) {
-			log.Printf("Skipping recording %d - already ended at %v", r.ID, endTime)
+			slog.Warn("Skipping recording that already ended", "recording_id", r.ID, "end_time", endTime)
 			continue
 		}
 
-		newStatus := r.CheckStatus(a.store, loc, a.config.StorageDir)
+		newStatus := r.CheckStatus(a.store, loc, a.rootStorage(root))
 		if r.Status != newStatus {
-			_, err := tx.ExecContext(ctx, "UPDATE recordings SET status = ? WHERE id = ?", newStatus, r.ID)
-			if err != nil {
-				log.Printf("Error updating recording status: %v", err)
+			// Within the open transaction, so not through setStatus.
+			if !canTransition(r.Status, newStatus) {
+				slog.Warn("Not changing recording status found at startup", "recording_id", r.ID, "from", r.Status, "to", newStatus)
+			} else if _, err := tx.ExecContext(ctx, "UPDATE recordings SET status = ? WHERE id = ?", newStatus, r.ID); err != nil {
+				slog.Error("Error updating recording status", "err", err)
+			} else if err := insertStatusEvent(ctx, tx, int64(r.ID), r.Status, newStatus, "checked at startup"); err != nil {
+				slog.Error("Error recording status change", "recording_id", r.ID, "err", err)
 			} else {
-				log.Printf("Updated recording %d status from %s to %s", r.ID, r.Status, newStatus)
+				slog.Info("Updated recording status", "recording_id", r.ID, "from", r.Status, "to", newStatus)
 				r.Status = newStatus
 			}
 		}
 
 		if now.After(adjustedStartTime) && now.Before(endTime) {
-			log.Printf("Recording %d is already in progress", r.ID)
+			slog.Info("Recording is already in progress", "recording_id", r.ID)
 		} else if now.Before(adjustedStartTime) {
 			recordingCh <- r
 		} else {
-			log.Printf("Recording %d should have started at %v", r.ID, adjustedStartTime)
+			slog.Info("Recording should have started", "recording_id", r.ID, "start_time", adjustedStartTime)
 			go a.startRecording(r)
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating recordings: %v", err)
+		slog.Error("Error iterating recordings", "err", err)
 	}
 	if err := rows.Close(); err != nil {
-		log.Printf("Error closing recordings cursor: %v", err)
+		slog.Error("Error closing recordings cursor", "err", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
+		slog.Error("Error committing transaction", "err", err)
 		tx.Rollback() //nolint: errcheck
 		return
 	}
@@ -728,76 +1420,110 @@ func (a *App) loadRecordings() {
 // Recording scheduler
 // ---------------------------------------------------------------------------
 
-var recordingTimers sync.Map // key: recording ID, value: struct{}
+var recordingTimers sync.Map // key: recording ID, value: *recordingTimer
+
+// recordingTimer identifies one timer goroutine, so a timer replaced after
+// its recording was rescheduled doesn't clear its successor's entry.
+type recordingTimer struct{}
 
 func (a *App) startRecordingScheduler() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 	loc, err := a.getLocalLocation()
 	if err != nil {
-		log.Printf("Error determining timezone: %v", err)
+		slog.Error("Error determining timezone", "err", err)
 		loc = time.UTC
 	}
 
+	// Pending recordings from the previous tick, whose parsed start times
+	// are reused while their date and start time are unchanged.
+	known := map[int]*types.Recording{}
+
 	for {
+		// New recordings and restores queue a scan at once rather than
+		// waiting for the next tick.
 		select {
 		case <-ticker.C:
-			now := time.Now().In(loc)
-			rows, err := a.store.QueryContext(context.Background(), `
-                SELECT id, channel_id, date, start_time, duration, status, title
-                FROM recordings
-      			WHERE status = 'pending'
-      			`)
-			if err != nil {
-				log.Printf("Error loading recordings: %v", err)
+		case <-recordingCh:
+		}
+		if atomic.LoadInt32(&a.restoring) == 1 {
+			continue
+		}
+		tickStart := time.Now()
+		now := time.Now().In(loc)
+		recordings, err := a.pendingRecordings(context.Background(), known)
+		if err != nil {
+			slog.Error("Error loading recordings", "err", err)
+			continue
+		}
+		known = make(map[int]*types.Recording, len(recordings))
+		for _, r := range recordings {
+			known[r.ID] = r
+		}
+
+		for _, rp := range recordings {
+			r := *rp
+			if _, exists := recordingTimers.Load(r.ID); exists {
 				continue
 			}
-			var recordings []types.Recording
-			for rows.Next() {
-				var r types.Recording
-				if err := rows.Scan(&r.ID, &r.ChannelID, &r.Date, &r.StartTime, &r.Duration, &r.Status, &r.Title); err != nil {
-					log.Printf("Error scanning recording: %v", err)
-					continue
-				}
-				recordings = append(recordings, r)
-			}
-			if err := rows.Err(); err != nil {
-				log.Printf("Error iterating recordings: %v", err)
-			}
-			rows.Close() //nolint: errcheck
 
-			for _, r := range recordings {
-				if _, exists := recordingTimers.Load(r.ID); exists {
-					continue
-				}
+			startTime, err := rp.StartAt(loc)
+			if err != nil {
+				slog.Error("Error parsing start time for recording", "recording_id", r.ID, "err", err)
+				continue
+			}
 
-				startTime, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("%s %s", r.Date, r.StartTime), loc)
-				if err != nil {
-					log.Printf("Error parsing start time for recording %d: %v", r.ID, err)
-					continue
-				}
+			before, after := a.padding()
+			actualStartTime := startTime.Add(-time.Duration(before) * time.Second)
 
-				actualStartTime := startTime.Add(-preRollSeconds * time.Second)
-
-				if now.Before(actualStartTime) {
-					go a.startRecordingTimer(r, actualStartTime)
-				} else if now.Before(startTime.Add(time.Duration(r.Duration+postRollMinutes) * time.Minute)) {
-					log.Printf("Recording %d should have started at %v, starting now", r.ID, actualStartTime)
-					go a.startRecording(r)
-				} else {
-					log.Printf("Recording %d should have started at %v but it's now %v, marking as failed",
-						r.ID, actualStartTime, now)
-					a.markFailed(r.ID)
-				}
+			if now.Before(actualStartTime) {
+				go a.startRecordingTimer(r, actualStartTime)
+			} else if now.Before(startTime.Add(time.Duration(r.Duration+after) * time.Minute)) {
+				slog.Info("Recording should have started, starting now", "recording_id", r.ID, "start_time", actualStartTime)
+				go a.startRecording(r)
+			} else {
+				slog.Error("Recording missed its start time, marking as failed", "recording_id", r.ID, "start_time", actualStartTime)
+				a.markFailed(r.ID, "missed its start time")
 			}
-		case <-recordingCh:
 		}
+		a.metrics.observeTick(time.Since(tickStart))
 	}
 }
 
+// pendingRecordings loads the pending recordings with the prepared
+// statement. A recording found in known with the same date and start time
+// is updated in place, keeping its parsed start time.
+func (a *App) pendingRecordings(ctx context.Context, known map[int]*types.Recording) ([]*types.Recording, error) {
+	stmt, err := a.dbPrepared(ctx, pendingRecordingsQuery)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+	var recordings []*types.Recording
+	for rows.Next() {
+		var r types.Recording
+		if err := rows.Scan(&r.ID, &r.ChannelID, &r.Date, &r.StartTime, &r.Duration, &r.Status, &r.Title); err != nil {
+			slog.Error("Error scanning recording", "err", err)
+			continue
+		}
+		if prev, ok := known[r.ID]; ok && prev.Date == r.Date && prev.StartTime == r.StartTime {
+			prev.ChannelID, prev.Duration, prev.Status, prev.Title = r.ChannelID, r.Duration, r.Status, r.Title
+			recordings = append(recordings, prev)
+			continue
+		}
+		recordings = append(recordings, &r)
+	}
+	return recordings, rows.Err()
+}
+
 func (a *App) startRecordingTimer(recording types.Recording, startTime time.Time) {
-	recordingTimers.Store(recording.ID, struct{}{})
-	defer recordingTimers.Delete(recording.ID)
+	token := &recordingTimer{}
+	recordingTimers.Store(recording.ID, token)
+	defer recordingTimers.CompareAndDelete(recording.ID, token)
 
 	duration := time.Until(startTime)
 
@@ -805,22 +1531,36 @@ func (a *App) startRecordingTimer(recording types.Recording, startTime time.Time
 		time.Sleep(duration)
 	}
 
+	if t, _ := recordingTimers.Load(recording.ID); t != token {
+		// Cleared by a database restore, or replaced by a timer for the
+		// rescheduled recording.
+		slog.Info("Recording timer was replaced, not starting", "recording_id", recording.ID)
+		return
+	}
+	if atomic.LoadInt32(&a.restoring) == 1 {
+		// The scheduler arms it again from the restored database.
+		slog.Info("Database restore in progress, leaving recording to the scheduler", "recording_id", recording.ID)
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	var exists bool
-	err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recordings WHERE id = ? AND status = 'pending')", recording.ID).Scan(&exists)
+	stmt, err := a.dbPrepared(ctx, recordingStillPendingQuery)
+	if err == nil {
+		err = stmt.QueryRowContext(ctx, recording.ID, recording.Date, recording.StartTime).Scan(&exists)
+	}
 	if err != nil {
-		log.Printf("Error checking if recording %d exists: %v", recording.ID, err)
+		slog.Error("Error checking if recording exists", "recording_id", recording.ID, "err", err)
 		return
 	}
 
 	if !exists {
-		log.Printf("Recording %d was deleted before start time, not starting", recording.ID)
+		slog.Info("Recording was deleted or rescheduled before start time, not starting", "recording_id", recording.ID)
 		return
 	}
 
-	log.Printf("Starting recording %d at %v (scheduled for %v)",
-		recording.ID, time.Now(), startTime.Add(preRollSeconds*time.Second))
+	before, _ := a.padding()
+	slog.Info("Starting recording", "recording_id", recording.ID, "scheduled", startTime.Add(time.Duration(before)*time.Second))
 	go a.startRecording(recording)
 }
 
@@ -829,75 +1569,119 @@ func (a *App) startRecordingTimer(recording types.Recording, startTime time.Time
 // ---------------------------------------------------------------------------
 
 func (a *App) startRecording(r types.Recording) {
+	logger := recordingLogger(r)
+	if a.isDraining() {
+		// Left pending; loadRecordings starts it late on the next run.
+		logger.Info("Shutting down, not starting recording")
+		return
+	}
+	if r.Status == statusPending {
+		if err := a.setStatus(context.Background(), r.ID, statusWaiting, "start time reached"); err != nil {
+			// Cancelled or started elsewhere in the meantime.
+			logger.Warn("Not starting recording", "err", err)
+			return
+		}
+		r.Status = statusWaiting
+	}
 	ch, err := a.getChannelInfo(r.ChannelID)
 	if err != nil {
-		log.Printf("Error finding channel %s: %v", r.ChannelID, err)
-		a.markFailed(r.ID)
+		logger.Error("Error finding channel", "err", err)
+		a.markFailed(r.ID, "channel not found")
 		return
 	}
 
 	loc, err := a.getLocalLocation()
 	if err != nil {
-		log.Printf("Error determining timezone: %v", err)
+		logger.Error("Error determining timezone", "err", err)
 	}
 
 	dateTimeStr := fmt.Sprintf("%s %s", r.Date, r.StartTime)
 	startTime, err := time.ParseInLocation("2006-01-02 15:04", dateTimeStr, loc)
 	if err != nil {
-		log.Printf("Error parsing start time: %v", err)
-		a.markFailed(r.ID)
+		logger.Error("Error parsing start time", "err", err)
+		a.markFailed(r.ID, "invalid start time")
 		return
 	}
 
-	adjustedStartTime := startTime.Add(-preRollSeconds * time.Second)
-	adjustedDuration := r.Duration + postRollMinutes
+	before, after := a.padding()
+	adjustedStartTime := startTime.Add(-time.Duration(before) * time.Second)
+	adjustedDuration := r.Duration + after
 
-	log.Printf("Original start time: %v, Adjusted start time: %v, Original duration: %d, Adjusted duration: %d",
-		startTime, adjustedStartTime, r.Duration, adjustedDuration)
+	logger.Debug("Recording window", "start_time", startTime, "adjusted_start_time", adjustedStartTime,
+		"duration", r.Duration, "adjusted_duration", adjustedDuration)
 
-	if err := a.commander.MkdirAll(a.config.StorageDir, 0755); err != nil {
-		log.Printf("Error creating output directory: %v", err)
-		a.markFailed(r.ID)
-		return
+	root, err := a.assignStorageRoot(context.Background(), r.ID)
+	if err != nil {
+		logger.Error("Error recording storage root of recording", "err", err)
+	}
+	fs := root.store
+
+	// The size estimate assumes stream copy; a quality tier exists to make
+	// the recording fit, so it is trusted instead.
+	codecArgs := a.recordingCodecArgs(fs, r.ID)
+	if codecArgs == nil {
+		if err := a.checkFreeSpace(context.Background(), fs, r, adjustedDuration); err != nil {
+			logger.Warn("Not starting recording", "err", err)
+			a.updateStatusWithRetry(r.ID, statusInsufficientSpace, err.Error()) //nolint:errcheck
+			a.events.publish(eventRecordingFailed, map[string]interface{}{"id": r.ID, "reason": err.Error()})
+			return
+		}
 	}
 
-	outputFile := filepath.Join(a.config.StorageDir, r.GetFilePath())
-	logFile := filepath.Join("/tmp", fmt.Sprintf("ffmpeg-%s-%s.log", r.Date, r.StartTime))
-	logFileHandle, err := a.commander.Create(logFile)
+	r.FileName, err = a.assignFileName(context.Background(), fs, r, ch)
+	if err != nil {
+		logger.Error("Error naming recording", "err", err)
+		a.markFailed(r.ID, "naming the file: "+err.Error())
+		return
+	}
+	outputName := r.GetFilePath()
+	outputFile, err := fs.LocalPath(outputName)
 	if err != nil {
-		log.Printf("Error creating log file: %v", err)
-		_, updateErr := a.dbExecContext(context.Background(), "UPDATE recordings SET status = 'failed' WHERE id = ?", r.ID)
+		logger.Error("Error preparing output file", "err", err)
+		a.markFailed(r.ID, "preparing the output file: "+err.Error())
+		return
+	}
+	logFile, logFileHandle, err := a.createFFmpegLog(r.ID)
+	if err != nil {
+		logger.Error("Error creating log file", "err", err)
+		updateErr := a.setStatus(context.Background(), r.ID, statusFailed, "creating the ffmpeg log: "+err.Error())
 		if updateErr != nil {
-			log.Printf("Error updating recording status: %v", updateErr)
+			logger.Error("Error updating recording status", "err", updateErr)
 		}
 		return
 	}
 	defer logFileHandle.Close() //nolint: errcheck
 
+	if s := a.preemptLiveStream(); s != nil {
+		logger.Warn("Stopped a live stream to free a tuner", "channel", s.channel, "client", s.client)
+	}
 	durationSeconds := adjustedDuration * 60
-	ffmpegArgs := buildFFmpegArgs(ch.URL, durationSeconds, outputFile)
+	ffmpegArgs := buildFFmpegArgs(ch.URL, durationSeconds, outputFile, codecArgs)
 	cmd, err := a.commander.StartCommand("ffmpeg", logFileHandle, logFileHandle, ffmpegArgs...)
 	if err != nil {
-		log.Printf("Error starting ffmpeg: %v", err)
-		a.markFailed(r.ID)
+		logger.Error("Error starting ffmpeg", "err", err)
+		a.markFailed(r.ID, "starting ffmpeg: "+err.Error())
 		return
 	}
 
-	log.Printf("Starting recording: %s", outputFile)
-	log.Printf("Channel: %s (%s)", ch.GuideName, ch.GuideNumber)
-	log.Printf("Original Date: %s, Original Time: %s, Adjusted Time: %v, Duration: %d minutes (original: %d)",
-		r.Date, r.StartTime, adjustedStartTime.Format("15:04"), adjustedDuration, r.Duration)
-	log.Printf("Storage directory: %s", a.config.StorageDir)
-	log.Printf("Log file: %s", logFile)
-	log.Printf("FFmpeg command: %s", getFFmpegCommandString(ch.URL, durationSeconds, outputFile))
+	logger.Info("Capture started", "file", outputFile, "channel_name", ch.GuideName, "date", r.Date,
+		"start_time", adjustedStartTime.Format("15:04"), "duration", adjustedDuration)
+	logger.Debug("Capture details", "storage_dir", root.dir, "log_file", logFile,
+		"ffmpeg", getFFmpegCommandString(ch.URL, durationSeconds, outputFile, codecArgs))
 
-	if err := a.updateStatusWithRetry(r.ID, "recording"); err != nil {
+	if err := a.updateStatusWithRetry(r.ID, statusRecording, "capture started"); err != nil {
 		logFileHandle.Close() //nolint: errcheck
 		return
 	}
+	a.events.publish(eventRecordingStarted, map[string]interface{}{"id": r.ID})
 
 	a.runningProcesses.Store(r.ID, cmd)
 	defer a.runningProcesses.Delete(r.ID)
+	defer stopRequests.Delete(r.ID)
+
+	progressCtx, stopProgress := context.WithCancel(context.Background())
+	defer stopProgress()
+	go a.reportProgress(progressCtx, fs, r.ID, outputName, durationSeconds)
 
 	var runErr error
 	retryCount := 0
@@ -910,18 +1694,22 @@ func (a *App) startRecording(r types.Recording) {
 			break
 		}
 
-		log.Printf("Error running ffmpeg (attempt %d/%d): %v", retryCount+1, maxRetries+1, runErr)
+		logger.Error("Error running ffmpeg", "attempt", retryCount+1, "attempts", maxRetries+1, "err", runErr)
+		a.metrics.ffmpegFailed()
 
+		if _, stopped := stopRequests.Load(r.ID); stopped {
+			break
+		}
 		if isHttpServerError(a, logFile) && retryCount < maxRetries {
 			wait := backoff[retryCount]
-			log.Printf("Detected HTTP server error, retrying in %v...", wait)
+			logger.Warn("Detected HTTP server error, retrying", "wait", wait)
 			time.Sleep(wait)
 
-			ffmpegArgs := buildFFmpegArgs(ch.URL, durationSeconds, outputFile)
+			ffmpegArgs := buildFFmpegArgs(ch.URL, durationSeconds, outputFile, codecArgs)
 			cmd, err = a.commander.StartCommand("ffmpeg", logFileHandle, logFileHandle, ffmpegArgs...)
 			if err != nil {
-				log.Printf("Error restarting ffmpeg: %v", err)
-				a.markFailed(r.ID)
+				logger.Error("Error restarting ffmpeg", "err", err)
+				a.markFailed(r.ID, "restarting ffmpeg: "+err.Error())
 				return
 			}
 			a.runningProcesses.Store(r.ID, cmd)
@@ -931,38 +1719,86 @@ func (a *App) startRecording(r types.Recording) {
 		}
 		break
 	}
+	if runErr == nil {
+		added, err := a.captureExtensions(&r, ch.URL, outputFile, logFileHandle, codecArgs)
+		durationSeconds += added * 60
+		if err != nil {
+			runErr = err
+		}
+	}
+	stopProgress()
 
+	// A capture that stopped early still keeps what it wrote; verification
+	// below flags it as partial.
 	if runErr != nil {
-		log.Printf("Error running ffmpeg after retries: %v", runErr)
-		if _, err := a.commander.Stat(outputFile); err == nil {
-			a.updateStatusWithRetry(r.ID, "completed") //nolint:errcheck
-		} else {
-			a.markFailed(r.ID)
+		logger.Error("Error running ffmpeg after retries", "err", runErr)
+		if _, err := fs.Stat(outputName); err != nil {
+			a.markFailed(r.ID, "ffmpeg failed without writing a file: "+runErr.Error())
+			return
 		}
+	}
+
+	// A capture stopped for shutdown keeps its transport stream; conversion
+	// and post-processing would outlast the grace period.
+	if _, stopped := stopRequests.Load(r.ID); stopped && a.isDraining() {
+		if err := a.updateStatusWithRetry(r.ID, statusPartial, "stopped for shutdown"); err != nil {
+			return
+		}
+		if err := a.recordOutput(context.Background(), fs, r.ID, outputName); err != nil {
+			logger.Error("Error recording final file of recording", "err", err)
+		}
+		logger.Warn("Recording stopped for shutdown", "file", outputName)
+		a.events.publish(eventRecordingPartial, map[string]interface{}{"id": r.ID})
 		return
 	}
 
-	if err := a.updateStatusWithRetry(r.ID, "completed"); err != nil {
+	reason := "capture finished"
+	if _, stopped := stopRequests.Load(r.ID); stopped {
+		reason = "stopped on request"
+	}
+	if err := a.updateStatusWithRetry(r.ID, statusCompleted, reason); err != nil {
 		return
 	}
 
-	mp4File := strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".mp4"
+	mp4Out := mp4Name(outputName)
+	mp4File, err := fs.LocalPath(mp4Out)
+	if err != nil {
+		logger.Error("Error preparing MP4 file", "err", err)
+		return
+	}
+	finalName := outputName
 	if err := convertToMp4(a.commander, outputFile, mp4File); err != nil {
-		log.Printf("Conversion warning: %v", err)
+		logger.Warn("Conversion warning", "err", err)
 	} else {
-		_ = a.commander.Remove(outputFile)
-		if info, err := a.commander.Stat(mp4File); err == nil {
-			size := info.Size()
-			_, updateErr := a.dbExecContext(context.Background(), "UPDATE recordings SET file_size = ? WHERE id = ?", size, r.ID)
-			if updateErr != nil {
-				log.Printf("Error updating recording file size: %v", updateErr)
-			}
-		} else {
-			log.Printf("Error getting final recording file size: %v", err)
-		}
+		_ = fs.Remove(outputName)
+		finalName = mp4Out
+	}
+	if err := a.recordOutput(context.Background(), fs, r.ID, finalName); err != nil {
+		logger.Error("Error recording final file of recording", "err", err)
+	}
+
+	logger.Info("Recording completed", "file", finalName)
+
+	if err := a.verifyRecording(context.Background(), fs, r.ID, finalName, float64(durationSeconds)); err != nil {
+		logger.Error("Error verifying recording", "err", err)
+	}
+
+	a.runPostProcessing(context.Background(), r.ID)
+
+	// The poster is taken from the final file, after commercials may have
+	// been cut and before archiving may delete it.
+	if err := a.createRecordingPoster(context.Background(), r.ID); err != nil {
+		logger.Error("Error generating poster of recording", "err", err)
+	}
+	if err := a.queueRecordingFilters(context.Background(), r.ID); err != nil {
+		logger.Error("Error queuing filters of recording", "err", err)
 	}
 
-	log.Printf("Recording completed successfully and converted to MP4: %s", mp4File)
+	if err := a.archiveRecording(context.Background(), r.ID); err != nil {
+		logger.Error("Error archiving recording", "err", err)
+	}
+	a.events.publish(eventRecordingCompleted, map[string]interface{}{"id": r.ID})
+	a.checkDiskSpace()
 }
 
 // getChannelInfo validates the channel exists and returns its details.
@@ -976,53 +1812,28 @@ func (a *App) getChannelInfo(channelID string) (types.Channel, error) {
 	return ch, err
 }
 
-// updateStatusWithRetry updates a recording status with exponential backoff.
-func (a *App) updateStatusWithRetry(id int, status string) error {
-	retryCount := 0
+// updateStatusWithRetry moves a recording to status through setStatus,
+// retrying database errors. A change the lifecycle refuses is returned at
+// once; the recording is marked failed when the retries run out.
+func (a *App) updateStatusWithRetry(id int, status, reason string) error {
 	maxRetries := 3
-
-	for retryCount < maxRetries {
-		txCtx, txCancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer txCancel()
-		tx, err := a.store.BeginTx(txCtx, nil)
-		if err != nil {
-			log.Printf("Error starting database transaction: %v", err)
-			retryCount++
-			if retryCount < maxRetries {
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-			a.markFailed(id) //nolint:errcheck
-			return err
-		}
-
-		_, err = tx.ExecContext(context.Background(), "UPDATE recordings SET status = ? WHERE id = ?", status, id)
-		if err != nil {
-			log.Printf("Error updating recording status to '%s': %v", status, err)
-			tx.Rollback() //nolint: errcheck
-			retryCount++
-			if retryCount < maxRetries {
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-			a.markFailed(id) //nolint:errcheck
-			return err
+	var err error
+	for retryCount := 0; retryCount < maxRetries; retryCount++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = a.setStatus(ctx, id, status, reason)
+		cancel()
+		if err == nil {
+			return nil
 		}
-
-		if err := tx.Commit(); err != nil {
-			log.Printf("Error committing transaction: %v", err)
-			tx.Rollback() //nolint: errcheck
-			retryCount++
-			if retryCount < maxRetries {
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-			a.markFailed(id) //nolint:errcheck
+		if errors.Is(err, errInvalidTransition) {
+			slog.Warn("Recording status not changed", "recording_id", id, "err", err)
 			return err
 		}
-		return nil
+		slog.Error("Error updating recording status", "status", status, "err", err)
+		time.Sleep(100 * time.Millisecond)
 	}
-	return fmt.Errorf("failed to update status after %d retries", maxRetries)
+	a.markFailed(id, "updating status to "+status+": "+err.Error())
+	return fmt.Errorf("failed to update status after %d retries: %w", maxRetries, err)
 }
 
 // ---------------------------------------------------------------------------
@@ -1030,29 +1841,50 @@ func (a *App) updateStatusWithRetry(id int, status string) error {
 // ---------------------------------------------------------------------------
 
 func (a *App) loadGuide() bool {
-	if _, err := a.commander.Stat(a.config.GuideFile); err != nil && os.IsNotExist(err) {
-		log.Println("No guide.json found, skipping")
+	if _, err := a.commander.Stat(a.cfg().GuideFile); err != nil && os.IsNotExist(err) {
+		slog.Info("No guide.json found, skipping")
 		return false
 	}
 
-	file, err := a.commander.Open(a.config.GuideFile)
+	file, err := a.commander.Open(a.cfg().GuideFile)
 	if err != nil {
-		log.Printf("Error opening guide.json: %v", err)
+		slog.Error("Error opening guide.json", "err", err)
 		return false
 	}
 	defer file.Close() //nolint: errcheck
 
 	var newGuideData types.Guide
 	if err := json.NewDecoder(file).Decode(&newGuideData); err != nil {
-		log.Printf("Error decoding guide.json: %v", err)
+		slog.Error("Error decoding guide.json", "err", err)
 		return false
 	}
 
 	a.guideDataMutex.Lock()
+	oldPrograms, initial := a.guideData.Programs, a.guideData.Generated == ""
 	a.guideData = newGuideData
 	a.guideDataMutex.Unlock()
 
-	log.Printf("Loaded guide data: %d programs", len(newGuideData.Programs))
+	changes := diffPrograms(oldPrograms, newGuideData.Programs, time.Now())
+	a.guideChanges.record(changes, initial)
+	if !initial {
+		slog.Info("Guide changes", "added", len(changes.Added), "removed", len(changes.Removed), "updated", len(changes.Updated))
+		a.events.publish("guide.updated", map[string]interface{}{
+			"generated": newGuideData.Generated,
+			"added":     len(changes.Added),
+			"removed":   len(changes.Removed),
+			"updated":   len(changes.Updated),
+		})
+	}
+
+	if err := a.indexGuide(newGuideData.Programs); err != nil {
+		slog.Error("Error indexing guide for search", "err", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	a.reconcileProgramLinks(ctx, newGuideData.Programs)
+	cancel()
+
+	slog.Info("Loaded guide data", "programs", len(newGuideData.Programs))
 	return true
 }
 
@@ -1072,21 +1904,21 @@ func (a *App) setupFileWatcher(filePath string) {
 					return
 				}
 				if event.Op&fsnotify.Write == fsnotify.Write {
-					log.Println("Modified file detected:", event.Name)
+					slog.Info("Modified file detected", "file", event.Name)
 					a.loadGuide() //nolint:errcheck
 				}
 			case err, ok := <-a.watcher.Errors:
 				if !ok {
 					return
 				}
-				log.Println("Error:", err)
+				slog.Error("Error watching guide file", "err", err)
 			}
 		}
 	}()
 
 	err = a.watcher.Add(filePath)
 	if err != nil {
-		log.Printf("Error adding watcher for %s: %v", filePath, err)
+		slog.Error("Error adding watcher", "file", filePath, "err", err)
 		return
 	}
 
@@ -1098,19 +1930,19 @@ func (a *App) setupFileWatcher(filePath string) {
 // ---------------------------------------------------------------------------
 
 func (a *App) cleanupOldRecordings() {
-	log.Println("Cleaning up old recordings")
+	slog.Info("Cleaning up old recordings")
 	loc, err := a.getLocalLocation()
 	if err != nil {
-		log.Printf("Error determining timezone: %v", err)
+		slog.Error("Error determining timezone", "err", err)
 	}
 
 	rows, err := a.dbQueryContext(context.Background(), `
          SELECT id, date, start_time, duration
          FROM recordings
-         WHERE status IN ('pending', 'recording')
+         WHERE status IN ('pending', 'waiting', 'recording')
 				`)
 	if err != nil {
-		log.Printf("Error loading recordings for cleanup: %v", err)
+		slog.Error("Error loading recordings for cleanup", "err", err)
 		return
 	}
 
@@ -1119,30 +1951,31 @@ func (a *App) cleanupOldRecordings() {
 		endTime time.Time
 	}
 	var toUpdate []recordingInfo
+	before, after := a.padding()
 
 	for rows.Next() {
 		var id int
 		var date, startTime string
 		var duration int
 		if err := rows.Scan(&id, &date, &startTime, &duration); err != nil {
-			log.Printf("Error scanning recording: %v", err)
+			slog.Error("Error scanning recording", "err", err)
 			continue
 		}
 
 		dateTimeStr := fmt.Sprintf("%s %s", date, startTime)
 		startTimeParsed, err := time.ParseInLocation("2006-01-02 15:04", dateTimeStr, loc)
 		if err != nil {
-			log.Printf("Error parsing start time for recording %d: %v", id, err)
+			slog.Error("Error parsing start time for recording", "recording_id", id, "err", err)
 			continue
 		}
 
-		adjustedStartTime := startTimeParsed.Add(-preRollSeconds * time.Second)
-		endTime := adjustedStartTime.Add(time.Duration(duration+postRollMinutes) * time.Minute)
+		adjustedStartTime := startTimeParsed.Add(-time.Duration(before) * time.Second)
+		endTime := adjustedStartTime.Add(time.Duration(duration+after) * time.Minute)
 
 		toUpdate = append(toUpdate, recordingInfo{id, endTime})
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating recordings for cleanup: %v", err)
+		slog.Error("Error iterating recordings for cleanup", "err", err)
 	}
 	rows.Close() //nolint:errcheck
 
@@ -1151,58 +1984,93 @@ func (a *App) cleanupOldRecordings() {
 
 	for _, info := range toUpdate {
 		if now.After(info.endTime) {
-			_, err := a.dbExecContext(context.Background(), "UPDATE recordings SET status = 'failed' WHERE id = ?", info.id)
+			err := a.setStatus(context.Background(), info.id, statusFailed, "not finished by its end time")
 			if err != nil {
-				log.Printf("Error updating recording %d status to failed: %v", info.id, err)
+				slog.Error("Error updating recording status to failed", "recording_id", info.id, "err", err)
 			} else {
-				log.Printf("Marked recording %d as failed (ended at %v)", info.id, info.endTime)
+				slog.Warn("Marked recording as failed", "recording_id", info.id, "end_time", info.endTime)
 				updatedCount++
 			}
 		}
 	}
 
-	log.Printf("Cleaned up %d old recordings", updatedCount)
+	slog.Info("Cleaned up old recordings", "count", updatedCount)
 }
 
 // ---------------------------------------------------------------------------
 // Data API handlers
 // ---------------------------------------------------------------------------
 
-func (a *App) serveHome(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "templates/index.html")
+// ChannelInfo is a channel as listed by GET /api/channels. Stale channels
+// were missing from the latest lineup fetched.
+type ChannelInfo struct {
+	GuideNumber    string     `json:"guideNumber"`
+	GuideName      string     `json:"guideName"`
+	VideoCodec     string     `json:"videoCodec,omitempty"`
+	AudioCodec     string     `json:"audioCodec,omitempty"`
+	HD             bool       `json:"hd"`
+	SignalStrength int        `json:"signalStrength,omitempty"`
+	SignalQuality  int        `json:"signalQuality,omitempty"`
+	LastSeen       *time.Time `json:"lastSeen,omitempty"`
+	Stale          bool       `json:"stale,omitempty"`
+	Favorite       bool       `json:"favorite,omitempty"`
 }
 
 func (a *App) getChannels(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	rows, err := a.dbQueryContext(ctx, "SELECT guide_number, guide_name FROM channels WHERE enabled=1")
+	var favorites map[string]bool
+	if u := requestUser(r); u != nil {
+		var err error
+		if favorites, err = a.favoriteChannels(ctx, u.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// ?all=true adds the channels the tuner no longer lists.
+	all := r.URL.Query().Get("all") == "true"
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT c.guide_number, c.guide_name, COALESCE(l.video_codec, ''), COALESCE(l.audio_codec, ''), COALESCE(l.hd, 0),
+		       COALESCE(l.signal_strength, 0), COALESCE(l.signal_quality, 0), l.last_seen,
+		       l.last_seen IS NULL OR l.last_seen < (SELECT MAX(last_seen) FROM channel_lineup)
+		FROM channels c
+		LEFT JOIN channel_lineup l ON l.guide_number = c.guide_number
+		WHERE c.enabled = 1 OR ? = 1
+		ORDER BY c.guide_number`, all)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close() // nolint: errcheck
 
-	type channelResponse struct {
-		GuideNumber string `json:"guideNumber"`
-		GuideName   string `json:"guideName"`
-	}
-
-	var channelList []channelResponse
+	var channelList []ChannelInfo
+	parental := a.cfg().Parental
+	hideRestricted := parental != nil && !a.parentalUnlocked(r, parental)
 
 	for rows.Next() {
-		var ch channelResponse
-		if err := rows.Scan(&ch.GuideNumber, &ch.GuideName); err != nil {
+		var ch ChannelInfo
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&ch.GuideNumber, &ch.GuideName, &ch.VideoCodec, &ch.AudioCodec, &ch.HD,
+			&ch.SignalStrength, &ch.SignalQuality, &lastSeen, &ch.Stale); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if lastSeen.Valid {
+			ch.LastSeen = &lastSeen.Time
+		}
+		if hideRestricted && channelRestricted(parental, ch.GuideNumber) {
+			continue
+		}
+		ch.Favorite = favorites[ch.GuideNumber]
 		channelList = append(channelList, ch)
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating channels: %v", err)
+		requestLogger(r).Error("Error iterating channels", "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(channelList); err != nil {
-		log.Printf("Error encoding channels response: %v", err)
+		requestLogger(r).Error("Error encoding channels response", "err", err)
 	}
 }
 
@@ -1217,17 +2085,44 @@ type GetRecordingsRec struct {
 	FileSize    int     `json:"file_size"`
 	GuideNumber string  `json:"guide_number"`
 	GuideName   string  `json:"guide_name"`
+	ProgramID   *string `json:"program_id,omitempty"`
+	Priority    int     `json:"priority"`
+	ArchivedTo  *string `json:"archived_to,omitempty"`
+	// FilePath is relative to the recording's storage root, and
+	// ActualDuration is the ffprobe-measured length in seconds.
+	FilePath       *string  `json:"file_path,omitempty"`
+	ActualDuration *float64 `json:"actual_duration,omitempty"`
+	// Watched and PositionSeconds are the signed-in user's watch state,
+	// left out while they have none.
+	Watched         *bool    `json:"watched,omitempty"`
+	PositionSeconds *float64 `json:"position_seconds,omitempty"`
+	// Orphaned is set when the recording's channel no longer exists;
+	// GuideNumber and GuideName are then empty.
+	Orphaned bool `json:"orphaned,omitempty"`
 }
 
 func (a *App) getRecordings(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	var userID int64
+	if u := requestUser(r); u != nil {
+		userID = u.ID
+	}
+	// ?orphaned=true lists only the recordings whose channel is gone.
+	orphaned := r.URL.Query().Get("orphaned") == "true"
 	rows, err := a.dbQueryContext(ctx, `
          SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.status, r.title, r.file_size,
-                c.guide_number, c.guide_name
+                COALESCE(c.guide_number, ''), COALESCE(c.guide_name, ''), l.program_id, COALESCE(p.priority, 0), ar.location,
+                f.path, f.duration_seconds, ws.watched, ws.position_seconds, c.guide_number IS NULL
          FROM recordings r
          LEFT JOIN channels c ON r.channel_id = c.guide_number
+         LEFT JOIN program_links l ON l.recording_id = r.id
+         LEFT JOIN recording_priorities p ON p.recording_id = r.id
+         LEFT JOIN recording_archives ar ON ar.recording_id = r.id
+         LEFT JOIN recording_files f ON f.recording_id = r.id
+         LEFT JOIN watch_state ws ON ws.recording_id = r.id AND ws.user_id = ?
+         WHERE ? = 0 OR c.guide_number IS NULL
 	   ORDER BY r.date, r.start_time
-      `)
+      `, userID, orphaned)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1239,19 +2134,20 @@ func (a *App) getRecordings(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var r GetRecordingsRec
 		if err := rows.Scan(&r.ID, &r.ChannelID, &r.Date, &r.StartTime, &r.Duration, &r.Status,
-			&r.Title, &r.FileSize, &r.GuideNumber, &r.GuideName); err != nil {
+			&r.Title, &r.FileSize, &r.GuideNumber, &r.GuideName, &r.ProgramID, &r.Priority, &r.ArchivedTo,
+			&r.FilePath, &r.ActualDuration, &r.Watched, &r.PositionSeconds, &r.Orphaned); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		recordings = append(recordings, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating recordings: %v", err)
+		requestLogger(r).Error("Error iterating recordings", "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(recordings); err != nil {
-		log.Printf("Error encoding recordings response: %v", err)
+		requestLogger(r).Error("Error encoding recordings response", "err", err)
 	}
 }
 
@@ -1269,6 +2165,7 @@ func (a *App) getGuide(w http.ResponseWriter, r *http.Request) {
 	a.enabledChannelsMutex.RUnlock()
 
 	now := time.Now()
+	categories := categoryFilter(r.URL.Query().Get("category"))
 
 	a.guideDataMutex.RLock()
 	programs := make([]types.Program, len(a.guideData.Programs))
@@ -1282,9 +2179,12 @@ func (a *App) getGuide(w http.ResponseWriter, r *http.Request) {
 		if !channelMap[prog.Channel] {
 			continue
 		}
+		if categories != nil && !categories[strings.ToLower(prog.Category)] {
+			continue
+		}
 		endTime, err := time.Parse(time.RFC3339, prog.End)
 		if err != nil {
-			log.Printf("Error parsing end time for program %q: %v", prog.Title, err)
+			requestLogger(r).Error("Error parsing end time for program", "title", prog.Title, "err", err)
 			continue
 		}
 		if endTime.Before(now) {
@@ -1308,7 +2208,113 @@ func (a *App) getGuide(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		log.Printf("Error encoding guide response: %v", err)
+		requestLogger(r).Error("Error encoding guide response", "err", err)
+	}
+}
+
+// ChannelNowNext is the program airing now and the one after it on a channel.
+type ChannelNowNext struct {
+	GuideNumber string         `json:"guideNumber"`
+	GuideName   string         `json:"guideName"`
+	Now         *types.Program `json:"now"`
+	Next        *types.Program `json:"next"`
+}
+
+// lessGuideNumber orders guide numbers such as "5.1" and "12.3" numerically by
+// major then minor channel, falling back to string order.
+func lessGuideNumber(a, b string) bool {
+	aMajor, aMinor, _ := strings.Cut(a, ".")
+	bMajor, bMinor, _ := strings.Cut(b, ".")
+	for _, pair := range [][2]string{{aMajor, bMajor}, {aMinor, bMinor}} {
+		x, errX := strconv.Atoi(pair[0])
+		y, errY := strconv.Atoi(pair[1])
+		if errX != nil || errY != nil {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+			continue
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// nowNext returns the current and next program for each channel in names,
+// sorted by guide number. Gaps in the guide leave Now nil.
+func nowNext(programs []types.Program, names map[string]string, now time.Time) []ChannelNowNext {
+	type timed struct {
+		prog       types.Program
+		start, end time.Time
+	}
+	byChannel := make(map[string][]timed)
+	for _, prog := range programs {
+		if _, ok := names[prog.Channel]; !ok {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, prog.Start)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, prog.End)
+		if err != nil || !end.After(now) {
+			continue
+		}
+		byChannel[prog.Channel] = append(byChannel[prog.Channel], timed{prog, start, end})
+	}
+
+	result := make([]ChannelNowNext, 0, len(names))
+	for num, name := range names {
+		entry := ChannelNowNext{GuideNumber: num, GuideName: name}
+		progs := byChannel[num]
+		sort.Slice(progs, func(i, j int) bool { return progs[i].start.Before(progs[j].start) })
+		for i := range progs {
+			p := progs[i].prog
+			if progs[i].start.After(now) {
+				if entry.Next == nil {
+					entry.Next = &p
+				}
+				break
+			}
+			entry.Now = &p
+		}
+		result = append(result, entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return lessGuideNumber(result[i].GuideNumber, result[j].GuideNumber) })
+	return result
+}
+
+func (a *App) getGuideNow(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.dbQueryContext(r.Context(), "SELECT guide_number, COALESCE(guide_name, '') FROM channels WHERE enabled=1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := make(map[string]string)
+	for rows.Next() {
+		var num, name string
+		if err := rows.Scan(&num, &name); err != nil {
+			rows.Close() //nolint: errcheck
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		names[num] = name
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(r).Error("Error iterating channels", "err", err)
+	}
+	rows.Close() //nolint: errcheck
+
+	a.guideDataMutex.RLock()
+	programs := make([]types.Program, len(a.guideData.Programs))
+	copy(programs, a.guideData.Programs)
+	a.guideDataMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(nowNext(programs, names, time.Now())); err != nil {
+		requestLogger(r).Error("Error encoding now/next response", "err", err)
 	}
 }
 
@@ -1318,7 +2324,12 @@ func (a *App) getGuide(w http.ResponseWriter, r *http.Request) {
 
 func (a *App) getKeywords(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	rows, err := a.dbQueryContext(ctx, "SELECT id, name, category, enabled, created_at FROM keywords ORDER BY created_at DESC")
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT k.id, k.name, k.category, k.enabled, k.created_at, COALESCE(kc.mode, ''), COALESCE(kf.filters, '')
+		FROM keywords k
+		LEFT JOIN keyword_commercials kc ON kc.keyword_id = k.id
+		LEFT JOIN keyword_filters kf ON kf.keyword_id = k.id
+		ORDER BY k.created_at DESC`)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1330,24 +2341,35 @@ func (a *App) getKeywords(w http.ResponseWriter, r *http.Request) {
 		var k types.Keyword
 		var category string
 		var enabled int
-		if err := rows.Scan(&k.ID, &k.Name, &category, &enabled, &k.CreatedAt); err != nil {
+		var filters string
+		if err := rows.Scan(&k.ID, &k.Name, &category, &enabled, &k.CreatedAt, &k.Commercials, &filters); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		k.Filters = splitFilters(filters)
 		k.Category = category
 		k.Enabled = enabled == 1
 		keywords = append(keywords, k)
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating keywords: %v", err)
+		requestLogger(r).Error("Error iterating keywords", "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(keywords); err != nil {
-		log.Printf("Error encoding keywords response: %v", err)
+		requestLogger(r).Error("Error encoding keywords response", "err", err)
 	}
 }
 
+// KeywordRequest is the body of POST /api/keywords.
+type KeywordRequest struct {
+	Name        string   `json:"name"`
+	Category    string   `json:"category,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"`
+	Commercials string   `json:"commercials,omitempty"`
+	Filters     []string `json:"filters,omitempty"`
+}
+
 func (a *App) createKeyword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1359,11 +2381,7 @@ func (a *App) createKeyword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Name     string `json:"name"`
-		Category string `json:"category,omitempty"`
-		Enabled  *bool  `json:"enabled,omitempty"`
-	}
+	var req KeywordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -1378,6 +2396,20 @@ func (a *App) createKeyword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Commercials != "" && !validCommercialMode(req.Commercials) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "commercials must be mark or cut"}) //nolint: errcheck
+		return
+	}
+	filters, err := normalizeFilters(req.Filters)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) //nolint: errcheck
+		return
+	}
+
 	enabled := true
 	if req.Enabled != nil {
 		enabled = *req.Enabled
@@ -1391,15 +2423,25 @@ func (a *App) createKeyword(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(map[string]string{"error": "Keyword already exists"}) //nolint: errcheck
 			return
 		}
-		log.Printf("Error creating keyword: %v", err)
+		requestLogger(r).Error("Error creating keyword", "err", err)
 		http.Error(w, "Failed to create keyword", http.StatusInternalServerError)
 		return
 	}
 
 	id, _ := result.LastInsertId()
+	if req.Commercials != "" {
+		if _, err := a.dbExecContext(r.Context(), "INSERT INTO keyword_commercials (keyword_id, mode) VALUES (?, ?)", id, req.Commercials); err != nil {
+			requestLogger(r).Error("Error saving commercial mode of keyword", "keyword_id", id, "err", err)
+		}
+	}
+	if len(filters) > 0 {
+		if _, err := a.dbExecContext(r.Context(), "INSERT INTO keyword_filters (keyword_id, filters) VALUES (?, ?)", id, strings.Join(filters, ",")); err != nil {
+			requestLogger(r).Error("Error saving filters of keyword", "keyword_id", id, "err", err)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "name": req.Name, "category": req.Category}) //nolint: errcheck
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "name": req.Name, "category": req.Category, "commercials": req.Commercials, "filters": filters}) //nolint: errcheck
 }
 
 func (a *App) deleteKeyword(w http.ResponseWriter, r *http.Request) {
@@ -1415,9 +2457,16 @@ func (a *App) deleteKeyword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The keyword's settings go first: they refer to it.
+	if _, err := a.store.ExecContext(context.Background(), "DELETE FROM keyword_commercials WHERE keyword_id = ?", id); err != nil {
+		requestLogger(r).Error("Error deleting commercial mode of keyword", "keyword_id", id, "err", err)
+	}
+	if _, err := a.store.ExecContext(context.Background(), "DELETE FROM keyword_filters WHERE keyword_id = ?", id); err != nil {
+		requestLogger(r).Error("Error deleting filters of keyword", "keyword_id", id, "err", err)
+	}
 	result, err := a.store.ExecContext(context.Background(), "DELETE FROM keywords WHERE id = ?", id)
 	if err != nil {
-		log.Printf("Error deleting keyword: %v", err)
+		requestLogger(r).Error("Error deleting keyword", "err", err)
 		http.Error(w, "Failed to delete keyword", http.StatusInternalServerError)
 		return
 	}
@@ -1436,7 +2485,7 @@ func (a *App) deleteKeyword(w http.ResponseWriter, r *http.Request) {
 // ---------------------------------------------------------------------------
 
 func convertToMp4(commander Commander, tsFile, mp4File string) error {
-	log.Printf("Converting %s to %s...", tsFile, mp4File)
+	slog.Info("Converting to MP4", "ts_file", tsFile, "mp4_file", mp4File)
 	args := []string{
 		"-i", tsFile,
 		"-c", "copy",
@@ -1446,7 +2495,7 @@ func convertToMp4(commander Commander, tsFile, mp4File string) error {
 	}
 	err := commander.RunCommand("ffmpeg", args...)
 	if err != nil {
-		log.Printf("ffmpeg conversion failed: %v, attempting slower conversion", err)
+		slog.Warn("ffmpeg conversion failed, attempting slower conversion", "err", err)
 
 		args = []string{
 			"-err_detect", "ignore_err",
@@ -1465,7 +2514,12 @@ func convertToMp4(commander Commander, tsFile, mp4File string) error {
 	return nil
 }
 
-func buildFFmpegArgs(inputURL string, durationSeconds int, outputFile string) []string {
+// buildFFmpegArgs returns the capture arguments. codecArgs replaces the default
+// stream copy when non-empty.
+func buildFFmpegArgs(inputURL string, durationSeconds int, outputFile string, codecArgs []string) []string {
+	if len(codecArgs) == 0 {
+		codecArgs = []string{"-c", "copy"}
+	}
 	args := []string{
 		"-i", inputURL,
 		"-fflags", "+genpts",
@@ -1483,15 +2537,14 @@ func buildFFmpegArgs(inputURL string, durationSeconds int, outputFile string) []
 		"-reconnect_delay_max", "600",
 
 		"-t", fmt.Sprintf("%d", durationSeconds),
-		"-c", "copy",
-		"-f", "mpegts",
-		outputFile,
 	}
+	args = append(args, codecArgs...)
+	args = append(args, "-f", "mpegts", outputFile)
 	return args
 }
 
-func getFFmpegCommandString(inputURL string, durationSeconds int, outputFile string) string {
-	args := buildFFmpegArgs(inputURL, durationSeconds, outputFile)
+func getFFmpegCommandString(inputURL string, durationSeconds int, outputFile string, codecArgs []string) string {
+	args := buildFFmpegArgs(inputURL, durationSeconds, outputFile, codecArgs)
 	cmd := "ffmpeg " + strings.Join(args, " ")
 	return cmd
 }
@@ -1511,26 +2564,26 @@ func (a *App) fetchTunerCount() int {
 	defaultCount := 4
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://hdhomerun.local/discover.json", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", a.cfg().DeviceURL+"/discover.json", nil)
 	if err != nil {
-		log.Printf("Error creating tuner count request: %v, using default %d", err, defaultCount)
+		slog.Warn("Error creating tuner count request, using default", "err", err, "default", defaultCount)
 		return defaultCount
 	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Printf("Error fetching tuner count: %v, using default %d", err, defaultCount)
+		slog.Warn("Error fetching tuner count, using default", "err", err, "default", defaultCount)
 		return defaultCount
 	}
 	defer resp.Body.Close() // nolint: errcheck
 
 	var disc DiscoveryResponse
 	if err := json.NewDecoder(resp.Body).Decode(&disc); err != nil {
-		log.Printf("Error decoding tuner count: %v, using default %d", err, defaultCount)
+		slog.Warn("Error decoding tuner count, using default", "err", err, "default", defaultCount)
 		return defaultCount
 	}
 
 	if disc.TunerCount <= 0 {
-		log.Printf("Invalid TunerCount %d received, using default %d", disc.TunerCount, defaultCount)
+		slog.Warn("Invalid TunerCount received, using default", "tuner_count", disc.TunerCount, "default", defaultCount)
 		return defaultCount
 	}
 
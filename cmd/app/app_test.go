@@ -17,6 +17,7 @@ import (
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
 	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
 	"github.com/prziborowski/hdhr-dvr/pkg/types"
 )
 
@@ -24,6 +25,8 @@ import (
 
 type MockCommander struct {
 	RunCommandFunc   func(name string, args ...string) error
+	OutputFunc       func(name string, args ...string) ([]byte, error)
+	RunWithEnvFunc   func(env []string, name string, args ...string) ([]byte, error)
 	StartCommandFunc func(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error)
 	StatFunc         func(path string) (os.FileInfo, error)
 	MkdirAllFunc     func(path string, perm os.FileMode) error
@@ -40,6 +43,20 @@ func (m *MockCommander) RunCommand(name string, args ...string) error {
 	return nil
 }
 
+func (m *MockCommander) Output(name string, args ...string) ([]byte, error) {
+	if m.OutputFunc != nil {
+		return m.OutputFunc(name, args...)
+	}
+	return nil, nil
+}
+
+func (m *MockCommander) RunWithEnv(env []string, name string, args ...string) ([]byte, error) {
+	if m.RunWithEnvFunc != nil {
+		return m.RunWithEnvFunc(env, name, args...)
+	}
+	return nil, nil
+}
+
 func (m *MockCommander) StartCommand(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error) {
 	if m.StartCommandFunc != nil {
 		return m.StartCommandFunc(name, stdout, stderr, args...)
@@ -209,7 +226,7 @@ func TestMarkFailed(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app.markFailed(123)
+	app.markFailed(123, "test")
 
 	var status string
 	err = db.QueryRow("SELECT status FROM recordings WHERE id = 123").Scan(&status)
@@ -426,3 +443,115 @@ func TestConvertToMp4(t *testing.T) {
 		t.Error("ffmpeg was never called")
 	}
 }
+
+func TestGetRecordingFileHandler(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+
+	_, err := db.Exec("INSERT INTO channels (guide_number, guide_name) VALUES (?, ?)", "101", "Test Channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '101', '2026-07-14', '12:00', 60, 'completed', 'Show')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '101', '2026-07-14', '13:00', 60, 'completed', 'Missing')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.WriteFile("2026-07-14-12:00-Show.mp4", []byte("0123456789"))
+	app.storeLegacyFileNames(context.Background())
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/file", app.getRecordingFile).Methods("GET", "HEAD")
+
+	req := httptest.NewRequest("GET", "/api/recordings/1/file", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "2345" {
+		t.Errorf("got code %d body %q, want 206 %q", rr.Code, rr.Body.String(), "2345")
+	}
+
+	req = httptest.NewRequest("GET", "/api/recordings/2/file", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got code %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestNowNext(t *testing.T) {
+	now := time.Date(2026, 7, 14, 20, 15, 0, 0, time.UTC)
+	at := func(h, m int) string {
+		return time.Date(2026, 7, 14, h, m, 0, 0, time.UTC).Format(time.RFC3339)
+	}
+	programs := []types.Program{
+		{Channel: "5.1", Title: "Later", Start: at(21, 0), End: at(22, 0)},
+		{Channel: "5.1", Title: "Current", Start: at(20, 0), End: at(20, 30)},
+		{Channel: "5.1", Title: "Next", Start: at(20, 30), End: at(21, 0)},
+		{Channel: "5.1", Title: "Over", Start: at(19, 0), End: at(20, 0)},
+		{Channel: "12.1", Title: "Tonight", Start: at(22, 0), End: at(23, 0)},
+		{Channel: "9.1", Title: "Not Received", Start: at(20, 0), End: at(21, 0)},
+	}
+	names := map[string]string{"5.1": "KPBS", "12.1": "KXYZ", "5.2": "Empty"}
+
+	got := nowNext(programs, names, now)
+	if len(got) != 3 || got[0].GuideNumber != "5.1" || got[1].GuideNumber != "5.2" || got[2].GuideNumber != "12.1" {
+		t.Fatalf("unexpected channels/order: %+v", got)
+	}
+	if got[0].Now == nil || got[0].Now.Title != "Current" || got[0].Next == nil || got[0].Next.Title != "Next" {
+		t.Errorf("5.1: unexpected now/next %+v", got[0])
+	}
+	if got[1].Now != nil || got[1].Next != nil {
+		t.Errorf("5.2: expected no programs, got %+v", got[1])
+	}
+	if got[2].Now != nil || got[2].Next == nil || got[2].Next.Title != "Tonight" {
+		t.Errorf("12.1: expected only next, got %+v", got[2])
+	}
+}
+
+func TestGetChannelsLineupDetails(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.storeChannels([]types.Channel{
+		{GuideNumber: "2.1", GuideName: "KTVU", VideoCodec: "MPEG2", AudioCodec: "AC3", HD: 1, SignalStrength: 91, SignalQuality: 100, URL: "http://tuner/auto/v2.1"},
+		{GuideNumber: "9.1", GuideName: "KQED", VideoCodec: "H264", AudioCodec: "AAC", SignalStrength: 60, SignalQuality: 80, URL: "http://tuner/auto/v9.1"},
+	})
+	time.Sleep(time.Millisecond)
+	// A rescan that no longer finds 9.1.
+	app.storeChannels([]types.Channel{
+		{GuideNumber: "2.1", GuideName: "KTVU", VideoCodec: "MPEG2", AudioCodec: "AC3", HD: 1, SignalStrength: 88, SignalQuality: 100, URL: "http://tuner/auto/v2.1"},
+	})
+
+	type channel struct {
+		GuideNumber    string     `json:"guideNumber"`
+		VideoCodec     string     `json:"videoCodec"`
+		HD             bool       `json:"hd"`
+		SignalStrength int        `json:"signalStrength"`
+		LastSeen       *time.Time `json:"lastSeen"`
+		Stale          bool       `json:"stale"`
+	}
+	get := func(url string) []channel {
+		rr := httptest.NewRecorder()
+		app.getChannels(rr, httptest.NewRequest("GET", url, nil))
+		var chs []channel
+		if err := json.NewDecoder(rr.Body).Decode(&chs); err != nil {
+			t.Fatal(err)
+		}
+		return chs
+	}
+	chs := get("/api/v1/channels")
+	if len(chs) != 1 || chs[0].VideoCodec != "MPEG2" || !chs[0].HD || chs[0].SignalStrength != 88 || chs[0].LastSeen == nil || chs[0].Stale {
+		t.Errorf("enabled channels %+v", chs)
+	}
+	chs = get("/api/v1/channels?all=true")
+	if len(chs) != 2 || chs[1].GuideNumber != "9.1" || !chs[1].Stale || chs[1].VideoCodec != "H264" || !chs[1].LastSeen.Before(*chs[0].LastSeen) {
+		t.Errorf("all channels %+v", chs)
+	}
+}
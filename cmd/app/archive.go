@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// statusArchived marks completed recordings that have been uploaded to the
+// archive destination.
+const statusArchived = "archived"
+
+// archiveLocation returns where a recording file named name is uploaded.
+func archiveLocation(cfg pkgcfg.Archive, name string) string {
+	return strings.TrimSuffix(cfg.Destination, "/") + "/" + name
+}
+
+func isS3Location(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+// archiveUploadCommand returns the command that copies localPath to location.
+func archiveUploadCommand(cfg pkgcfg.Archive, localPath, location string) (string, []string) {
+	if isS3Location(location) {
+		args := []string{"s3", "cp", "--only-show-errors", localPath, location}
+		if cfg.Endpoint != "" {
+			args = append(args, "--endpoint-url", cfg.Endpoint)
+		}
+		return "aws", args
+	}
+	return "rclone", []string{"copyto", localPath, location}
+}
+
+// archivedSize returns the size of the uploaded object at location, asking
+// S3 for its Content-Length or rclone for a listing of the file.
+func (a *App) archivedSize(cfg pkgcfg.Archive, location string) (int64, error) {
+	if isS3Location(location) {
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+		args := []string{"s3api", "head-object", "--bucket", bucket, "--key", key}
+		if cfg.Endpoint != "" {
+			args = append(args, "--endpoint-url", cfg.Endpoint)
+		}
+		out, err := a.commander.Output("aws", args...)
+		if err != nil {
+			return 0, err
+		}
+		var head struct {
+			ContentLength int64 `json:"ContentLength"`
+		}
+		if err := json.Unmarshal(out, &head); err != nil {
+			return 0, fmt.Errorf("parsing head-object output: %w", err)
+		}
+		return head.ContentLength, nil
+	}
+
+	out, err := a.commander.Output("rclone", "lsjson", location)
+	if err != nil {
+		return 0, err
+	}
+	var entries []struct {
+		Size int64 `json:"Size"`
+	}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return 0, fmt.Errorf("parsing rclone lsjson output: %w", err)
+	}
+	if len(entries) != 1 {
+		return 0, fmt.Errorf("%s not found after upload", location)
+	}
+	return entries[0].Size, nil
+}
+
+// archiveRecording uploads a completed recording's MP4 to the archive
+// destination, checks the uploaded size and, where the destination can hash
+// it, SHA-256 against the local file, removes the local copy if configured
+// to, and marks the recording archived.
+func (a *App) archiveRecording(ctx context.Context, id int) error {
+	cfg := a.cfg().Archive
+	if cfg.Destination == "" {
+		return nil
+	}
+
+	var rec types.Recording
+	err := a.dbQueryRowContext(ctx, `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.title, r.status, COALESCE(f.path, '')
+		FROM recordings r
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		WHERE r.id = ?`, id).Scan(
+		&rec.ID, &rec.ChannelID, &rec.Date, &rec.StartTime, &rec.Title, &rec.Status, &rec.FileName)
+	if err != nil {
+		return err
+	}
+	if rec.Status != "completed" {
+		return fmt.Errorf("recording %d is %s, not completed", id, rec.Status)
+	}
+
+	fs := a.recordingStorage(ctx, id)
+	name := finalFileName(rec)
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+	localPath, err := fs.LocalPath(name)
+	if err != nil {
+		return err
+	}
+
+	location := archiveLocation(cfg, name)
+	tool, args := archiveUploadCommand(cfg, localPath, location)
+	slog.Info("Archiving recording", "recording_id", id, "location", location)
+	if err := a.commander.RunCommand(tool, args...); err != nil {
+		return fmt.Errorf("uploading to %s: %w", location, err)
+	}
+	size, err := a.archivedSize(cfg, location)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", location, err)
+	}
+	if size != info.Size() {
+		return fmt.Errorf("verifying %s: uploaded %d bytes, local file has %d", location, size, info.Size())
+	}
+	remoteSum, err := a.remoteSHA256(location)
+	switch {
+	case errors.Is(err, errNoRemoteHash):
+	case err != nil:
+		return fmt.Errorf("hashing %s: %w", location, err)
+	default:
+		localSum, err := fileSHA256(fs, name)
+		if err != nil {
+			return err
+		}
+		if remoteSum != localSum {
+			return fmt.Errorf("verifying %s: SHA-256 %s differs from the local file's %s", location, remoteSum, localSum)
+		}
+		if err := a.storeChecksum(ctx, id, location, remoteSum); err != nil {
+			return err
+		}
+	}
+
+	if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_archives (recording_id, location) VALUES (?, ?)", id, location); err != nil {
+		return err
+	}
+	if err := a.setStatus(ctx, id, statusArchived, "archived to "+location); err != nil {
+		return err
+	}
+	if cfg.DeleteLocal {
+		if err := fs.Remove(name); err != nil {
+			slog.Error("Error removing local copy of archived recording", "recording_id", id, "err", err)
+		} else if _, err := a.dbExecContext(ctx, "UPDATE recording_archives SET local_deleted = 1 WHERE recording_id = ?", id); err != nil {
+			slog.Error("Error recording removal of local copy of recording", "recording_id", id, "err", err)
+		}
+	}
+	slog.Info("Archived recording", "recording_id", id, "location", location)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestArchiveUploadCommand(t *testing.T) {
+	cfg := pkgcfg.Archive{Destination: "s3://dvr-archive/tv/", Endpoint: "http://minio:9000"}
+	loc := archiveLocation(cfg, "2026-03-01-20:00-News.mp4")
+	if loc != "s3://dvr-archive/tv/2026-03-01-20:00-News.mp4" {
+		t.Errorf("location = %s", loc)
+	}
+	tool, args := archiveUploadCommand(cfg, "/data/x.mp4", loc)
+	if tool != "aws" || strings.Join(args, " ") != "s3 cp --only-show-errors /data/x.mp4 "+loc+" --endpoint-url http://minio:9000" {
+		t.Errorf("got %s %v", tool, args)
+	}
+
+	tool, args = archiveUploadCommand(pkgcfg.Archive{Destination: "b2:dvr"}, "/data/x.mp4", "b2:dvr/x.mp4")
+	if tool != "rclone" || strings.Join(args, " ") != "copyto /data/x.mp4 b2:dvr/x.mp4" {
+		t.Errorf("got %s %v", tool, args)
+	}
+}
+
+func TestArchiveRecording(t *testing.T) {
+	const name = "2026-03-01-20:00-News.mp4"
+	tests := []struct {
+		name        string
+		remoteSize  int
+		wantErr     bool
+		wantStatus  string
+		wantOnDisk  bool
+		deleteLocal bool
+	}{
+		{name: "verified", remoteSize: 5, wantStatus: statusArchived, deleteLocal: true},
+		{name: "kept local", remoteSize: 5, wantStatus: statusArchived, wantOnDisk: true},
+		{name: "size mismatch", remoteSize: 3, wantErr: true, wantStatus: "completed", wantOnDisk: true, deleteLocal: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := setupTestApp(t)
+			defer db.Close() //nolint: errcheck
+
+			dir := t.TempDir()
+			app.storage = storage.NewLocal(dir)
+			app.config.Archive = pkgcfg.Archive{Destination: "s3://dvr-archive", DeleteLocal: tt.deleteLocal}
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+				t.Fatal(err)
+			}
+
+			var uploaded []string
+			mc := app.commander.(*MockCommander)
+			mc.RunCommandFunc = func(name string, args ...string) error {
+				uploaded = append(uploaded, args[len(args)-1])
+				return nil
+			}
+			mc.OutputFunc = func(name string, args ...string) ([]byte, error) {
+				return []byte(fmt.Sprintf(`{"ContentLength": %d, "ContentType": "video/mp4"}`, tt.remoteSize)), nil
+			}
+
+			err := app.archiveRecording(context.Background(), 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("archiveRecording error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(uploaded) != 1 || uploaded[0] != "s3://dvr-archive/"+name {
+				t.Errorf("uploaded %v", uploaded)
+			}
+
+			var status string
+			db.QueryRow("SELECT status FROM recordings WHERE id = 1").Scan(&status) //nolint: errcheck
+			if status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", status, tt.wantStatus)
+			}
+			_, statErr := os.Stat(filepath.Join(dir, name))
+			if (statErr == nil) != tt.wantOnDisk {
+				t.Errorf("local file present = %v, want %v", statErr == nil, tt.wantOnDisk)
+			}
+		})
+	}
+}
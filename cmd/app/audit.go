@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// auditBodyLimit bounds the request body kept with an audit entry.
+const auditBodyLimit = 8 << 10
+
+// unauditedRoutes change only the caller's own profile, or nothing at all.
+// Players save the resume position every few seconds, which would bury the
+// real changes; DLNA players browse with POSTed SOAP requests, and GraphQL
+// clients query with POSTs.
+var unauditedRoutes = []string{
+	apiPrefix + "/recordings/{id}/watch",
+	apiPrefix + "/profile/favorites/{channel}",
+	dlnaControlRoute,
+	dlnaPrefix + "/control/ConnectionManager",
+	graphqlRoute,
+	graphqlRootRoute,
+}
+
+// auditSnapshots are the routes whose target row is saved before a PATCH,
+// PUT or DELETE changes it, so the entry shows what was there.
+var auditSnapshots = map[string]string{
+	"/api/v1/recordings/{id}": `SELECT id, channel_id, date, start_time, duration, status, title, file_size
+		FROM recordings WHERE id = ?`,
+	"/api/v1/keywords/{id}": "SELECT id, name, category, enabled FROM keywords WHERE id = ?",
+	"/api/v1/locks/{id}":    "SELECT id, channel_id, name, days, start_time, duration, enabled FROM channel_locks WHERE id = ?",
+}
+
+// AuditEntry is one API request that changed, or tried to change, state.
+type AuditEntry struct {
+	ID           int64             `json:"id"`
+	Time         string            `json:"time"`
+	Method       string            `json:"method"`
+	Route        string            `json:"route"`
+	Path         string            `json:"path"`
+	Target       map[string]string `json:"target,omitempty"`
+	Status       int               `json:"status"`
+	RemoteIP     string            `json:"remoteIp"`
+	ForwardedFor string            `json:"forwardedFor,omitempty"`
+	UserAgent    string            `json:"userAgent,omitempty"`
+	RequestID    string            `json:"requestId,omitempty"`
+	Body         json.RawMessage   `json:"body,omitempty"`
+	Previous     json.RawMessage   `json:"previous,omitempty"`
+}
+
+// isSecretKey reports whether a JSON field holds a credential.
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	if k == "pin" {
+		return true
+	}
+	for _, s := range []string{"password", "secret", "token", "apikey", "api_key"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces credentials anywhere in a decoded JSON value.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if isSecretKey(k) {
+				v[k] = "[redacted]"
+			} else {
+				v[k] = redact(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redact(e)
+		}
+	}
+	return v
+}
+
+// auditBody returns a JSON request body with credentials redacted. Bodies
+// that are not JSON, or were cut off at auditBodyLimit, are left out.
+func auditBody(contentType string, body []byte) json.RawMessage {
+	if len(body) == 0 || !strings.HasPrefix(contentType, "application/json") {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil
+	}
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// auditSnapshot returns the row a route's {id} points at as a JSON object,
+// or nil when the route has no snapshot or the row does not exist.
+func (a *App) auditSnapshot(ctx context.Context, route, id string) json.RawMessage {
+	query, ok := auditSnapshots[route]
+	if !ok || id == "" {
+		return nil
+	}
+	rows, err := a.dbQueryContext(ctx, query, id)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close() //nolint: errcheck
+	cols, err := rows.Columns()
+	if err != nil || !rows.Next() {
+		return nil
+	}
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil
+	}
+	row := make(map[string]interface{}, len(cols))
+	for i, c := range cols {
+		if b, ok := vals[i].([]byte); ok {
+			vals[i] = string(b)
+		}
+		row[c] = vals[i]
+	}
+	out, _ := json.Marshal(row)
+	return out
+}
+
+// audit is router middleware that records every request other than GET,
+// HEAD and OPTIONS in audit_log once it has been handled.
+func (a *App) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.URL.Path
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		if slices.Contains(unauditedRoutes, route) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		vars := mux.Vars(r)
+		var previous json.RawMessage
+		if r.Method != http.MethodPost {
+			previous = a.auditSnapshot(r.Context(), route, vars["id"])
+		}
+
+		var body []byte
+		if r.Body != nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, auditBodyLimit+1))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			if len(body) > auditBodyLimit {
+				body = nil
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		var target []byte
+		if len(vars) > 0 {
+			target, _ = json.Marshal(vars)
+		}
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		_, err = a.dbExecContext(context.Background(), `
+			INSERT INTO audit_log (method, route, path, target, status, remote_ip, forwarded_for, user_agent, request_id, body, previous)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Method, route, r.URL.Path, nullJSON(target), rec.status, ip, r.Header.Get("X-Forwarded-For"),
+			r.UserAgent(), w.Header().Get(requestIDHeader), nullJSON(auditBody(r.Header.Get("Content-Type"), body)), nullJSON(previous))
+		if err != nil {
+			requestLogger(r).Error("Error writing audit log", "err", err)
+		}
+	})
+}
+
+// nullJSON stores empty JSON as NULL.
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// getAudit lists audit entries, newest first. ?path= limits them to paths
+// starting with it, e.g. /api/v1/recordings/42; ?before= pages back from an
+// entry ID; ?limit= is 100 by default and at most 1000.
+func (a *App) getAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	query := `SELECT id, created_at, method, route, path, target, status, remote_ip, COALESCE(forwarded_for, ''),
+		COALESCE(user_agent, ''), COALESCE(request_id, ''), body, previous FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	if p := q.Get("path"); p != "" {
+		query += " AND substr(path, 1, ?) = ?"
+		args = append(args, len(p), p)
+	}
+	if s := q.Get("before"); s != "" {
+		before, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+		query += " AND id < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := a.dbQueryContext(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var target, body, previous sql.NullString
+		if err := rows.Scan(&e.ID, &e.Time, &e.Method, &e.Route, &e.Path, &target, &e.Status, &e.RemoteIP,
+			&e.ForwardedFor, &e.UserAgent, &e.RequestID, &body, &previous); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if target.Valid {
+			json.Unmarshal([]byte(target.String), &e.Target) //nolint: errcheck
+		}
+		if body.Valid {
+			e.Body = json.RawMessage(body.String)
+		}
+		if previous.Valid {
+			e.Previous = json.RawMessage(previous.String)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(r).Error("Error iterating audit log", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries) //nolint: errcheck
+}
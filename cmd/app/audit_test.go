@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAuditBodyRedactsCredentials(t *testing.T) {
+	got := string(auditBody("application/json", []byte(`{"name":"news","auth":{"Password":"hunter2","apiKey":"k"},"list":[{"token":"t"}]}`)))
+	if strings.Contains(got, "hunter2") || strings.Contains(got, `"k"`) || strings.Contains(got, `"t"`) || !strings.Contains(got, `"name":"news"`) {
+		t.Errorf("got %s", got)
+	}
+	if auditBody("text/plain", []byte("x")) != nil || auditBody("application/json", []byte(`{"cut`)) != nil {
+		t.Error("expected non-JSON bodies to be dropped")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if _, err := db.Exec(`INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title)
+		VALUES (7, '5.1', '2024-01-02', '20:00', 60, 'pending', 'News')`); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(withRequestID, app.audit)
+	r.HandleFunc("/api/v1/recordings/{id}", app.deleteRecording).Methods("DELETE")
+	r.HandleFunc("/api/v1/keywords", app.createKeyword).Methods("POST")
+	r.HandleFunc("/api/v1/audit", app.getAudit).Methods("GET")
+
+	req := httptest.NewRequest("DELETE", "/api/v1/recordings/7", nil)
+	req.RemoteAddr = "192.0.2.10:5555"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code >= 300 {
+		t.Fatalf("delete: %d %s", rr.Code, rr.Body)
+	}
+	deleted := rr.Code
+
+	req = httptest.NewRequest("POST", "/api/v1/keywords", strings.NewReader(`{"name":"hockey"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Reads are not audited.
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/audit", nil))
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/audit", nil))
+	var entries []AuditEntry
+	if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Method != "POST" || e.Route != "/api/v1/keywords" || !strings.Contains(string(e.Body), "hockey") {
+		t.Errorf("newest entry %+v", e)
+	}
+	e := entries[1]
+	if e.Method != "DELETE" || e.Route != "/api/v1/recordings/{id}" || e.Target["id"] != "7" || e.RemoteIP != "192.0.2.10" ||
+		e.ForwardedFor != "198.51.100.1" || len(e.RequestID) != 16 || e.Status != deleted {
+		t.Errorf("delete entry %+v", e)
+	}
+	var prev map[string]interface{}
+	if err := json.Unmarshal(e.Previous, &prev); err != nil || prev["title"] != "News" || prev["status"] != "pending" {
+		t.Errorf("previous %s: %v", e.Previous, err)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/audit?path=/api/v1/recordings/7&limit=5", nil))
+	entries = nil
+	json.NewDecoder(rr.Body).Decode(&entries) //nolint: errcheck
+	if len(entries) != 1 || entries[0].Method != "DELETE" {
+		t.Errorf("filtered: %+v", entries)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/audit?limit=0", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: %d", rr.Code)
+	}
+}
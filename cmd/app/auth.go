@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// fileRoute is the recording download route FileAllowlist applies to.
+const fileRoute = apiPrefix + "/recordings/{id}/file"
+
+// loginRoute is the one write allowed without credentials.
+const loginRoute = apiPrefix + "/login"
+
+// publicRoutes are served without credentials whatever the auth setting,
+// since they are how a user signs in and out.
+var publicRoutes = []string{loginRoute, apiPrefix + "/logout", oidcLoginRoute, oidcCallbackRoute}
+
+// The roles. Admins may do anything; viewers may browse, stream and
+// download recordings.
+const (
+	roleAdmin  = "admin"
+	roleViewer = "viewer"
+)
+
+// adminReads are the reads only admins may make, besides everything under
+// /api/v1/admin/: settings, which show the configuration, and the server
+// and audit logs.
+var adminReads = []string{apiPrefix + "/settings", apiPrefix + "/logs", apiPrefix + "/audit"}
+
+// viewerWrites are the writes viewers may make: reporting playback
+// problems with a recording they watched, and keeping their own profile.
+var viewerWrites = []string{
+	apiPrefix + "/recordings/{id}/reports", apiPrefix + "/recordings/{id}/watch",
+	apiPrefix + "/profile/favorites/{channel}",
+}
+
+// readPosts are POST routes that only read, like a GraphQL query too long
+// for a URL.
+var readPosts = []string{graphqlRoute, graphqlRootRoute}
+
+// roleAllows reports whether role may send a method request to route.
+// Anonymous callers, with role "", may read what viewers may.
+func roleAllows(role, method, route string) bool {
+	if role == roleAdmin {
+		return true
+	}
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions ||
+		method == http.MethodPost && slices.Contains(readPosts, route) {
+		return !strings.HasPrefix(route, apiPrefix+"/admin/") && !slices.Contains(adminReads, route)
+	}
+	return role == roleViewer && slices.Contains(viewerWrites, route)
+}
+
+// roleForGroups returns admin for members of one of adminGroups and viewer
+// for anyone else.
+func roleForGroups(groups, adminGroups []string) string {
+	for _, g := range groups {
+		if slices.Contains(adminGroups, g) {
+			return roleAdmin
+		}
+	}
+	return roleViewer
+}
+
+// apiKeyCtxKey stores the APIKey a request was authenticated with,
+// userCtxKey the User who made it, and roleCtxKey the caller's role.
+type (
+	apiKeyCtxKey struct{}
+	userCtxKey   struct{}
+	roleCtxKey   struct{}
+)
+
+// requestRole returns the role of the caller of r: admin with auth
+// disabled, else the one requireAuth found, or "" for anonymous callers.
+func (a *App) requestRole(r *http.Request) string {
+	if !a.cfg().Auth.Enabled {
+		return roleAdmin
+	}
+	role, _ := r.Context().Value(roleCtxKey{}).(string)
+	return role
+}
+
+// requestUser returns the signed-in user making r, or nil.
+func requestUser(r *http.Request) *User {
+	u, _ := r.Context().Value(userCtxKey{}).(*User)
+	return u
+}
+
+// proxyUser returns the user a reverse proxy named in r, or "".
+func proxyUser(r *http.Request, p *pkgcfg.AuthProxy) string {
+	if p.UserHeader != "" {
+		return strings.TrimSpace(r.Header.Get(p.UserHeader))
+	}
+	if u := strings.TrimSpace(r.Header.Get("Remote-User")); u != "" {
+		return u
+	}
+	return strings.TrimSpace(r.Header.Get("X-Forwarded-User"))
+}
+
+// proxyGroups returns the groups a reverse proxy listed in r, separated by
+// commas.
+func proxyGroups(r *http.Request, p *pkgcfg.AuthProxy) []string {
+	header := p.GroupsHeader
+	if header == "" {
+		header = "Remote-Groups"
+	}
+	var groups []string
+	for _, g := range strings.Split(r.Header.Get(header), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// requestAPIKey returns the key sent as a bearer token or in X-API-Key.
+func requestAPIKey(r *http.Request) string {
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// inNetworks reports whether the client address of r is in one of cidrs.
+func inNetworks(r *http.Request, cidrs []string) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, c := range cidrs {
+		if _, n, err := net.ParseCIDR(c); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentRoute returns the route template r matched, or "" outside the
+// router.
+func currentRoute(r *http.Request) string {
+	if cr := mux.CurrentRoute(r); cr != nil {
+		if tpl, err := cr.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return ""
+}
+
+// identify returns r with its caller in the context: the owner of an API
+// key, the user a trusted proxy names, or the user of a session cookie.
+// It returns errInvalidKey for a key that does not exist or was revoked; r
+// is returned unchanged for anonymous callers.
+func (a *App) identify(r *http.Request, auth pkgcfg.Auth) (*http.Request, error) {
+	withUser := func(u *User) *http.Request {
+		ctx := context.WithValue(r.Context(), userCtxKey{}, u)
+		ctx = context.WithValue(ctx, roleCtxKey{}, u.Role)
+		ctx = context.WithValue(ctx, loggerKey{}, requestLogger(r).With("user", u.Username))
+		return r.WithContext(ctx)
+	}
+
+	if key := requestAPIKey(r); key != "" {
+		k, err := a.lookupAPIKey(r.Context(), key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return r, errInvalidKey
+		} else if err != nil {
+			return r, err
+		}
+		ctx := context.WithValue(r.Context(), apiKeyCtxKey{}, k)
+		ctx = context.WithValue(ctx, roleCtxKey{}, roleAdmin)
+		ctx = context.WithValue(ctx, loggerKey{}, requestLogger(r).With("api_key", k.Name))
+		return r.WithContext(ctx), nil
+	}
+	if p := auth.Proxy; p != nil {
+		if username := proxyUser(r, p); username != "" {
+			if !inNetworks(r, p.TrustedProxies) {
+				requestLogger(r).Warn("Ignored user header from untrusted address", "remote_addr", r.RemoteAddr)
+			} else {
+				u, err := a.externalUser(r.Context(), username, true)
+				if err != nil {
+					return r, err
+				}
+				if len(auth.AdminGroups) > 0 {
+					u.Role = roleForGroups(proxyGroups(r, p), auth.AdminGroups)
+				}
+				return withUser(u), nil
+			}
+		}
+	}
+	if token := sessionToken(r); token != "" {
+		u, err := a.lookupSession(r.Context(), token)
+		if err == nil {
+			return withUser(u), nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return r, err
+		}
+		// An expired session is treated as none, so the UI can sign in again.
+	}
+	return r, nil
+}
+
+// errInvalidKey is returned by identify for an unknown or revoked API key.
+var errInvalidKey = errors.New("invalid API key")
+
+// requireAuth is router middleware enforcing the auth setting. It puts the
+// caller and their role in the context (see identify), and refuses what
+// the role does not allow (see roleAllows). With protectReads, anonymous
+// callers may not even read, except pages, which send them to the sign-in
+// page themselves, and files from the fileAllowlist.
+func (a *App) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.cfg()
+		auth := cfg.Auth
+		route := currentRoute(r)
+		if !auth.Enabled || slices.Contains(publicRoutes, route) || deviceClient(cfg, r, route) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r, err := a.identify(r, auth)
+		if errors.Is(err, errInvalidKey) {
+			requestLogger(r).Warn("Rejected invalid API key", "remote_addr", r.RemoteAddr)
+			writeUnauthorized(w, "invalid API key")
+			return
+		} else if err != nil {
+			requestLogger(r).Error("Error checking credentials", "err", err)
+			http.Error(w, "Error checking credentials", http.StatusInternalServerError)
+			return
+		}
+
+		role := a.requestRole(r)
+		page := slices.Contains(uiPages, route) || route == "/login"
+		allowlisted := route == fileRoute && inNetworks(r, auth.FileAllowlist)
+		if role == "" && auth.ProtectReads && !page && !allowlisted {
+			writeUnauthorized(w, "API key or sign-in required")
+			return
+		}
+		if !roleAllows(role, r.Method, route) {
+			if role == "" {
+				writeUnauthorized(w, "API key or sign-in required")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "admin role required"}) //nolint: errcheck
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeUnauthorized answers 401 with a JSON error.
+func writeUnauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="hdhr-dvr"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint: errcheck
+}
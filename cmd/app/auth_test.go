@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestRequireAuth(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	_, key, err := app.createAPIKey(context.Background(), "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(app.requireAuth)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/api/v1/recordings/{id}", ok).Methods("GET", "DELETE")
+	r.HandleFunc(fileRoute, ok).Methods("GET")
+	r.HandleFunc(loginRoute, ok).Methods("POST")
+	r.HandleFunc("/", ok).Methods("GET")
+	call := func(method, path, remote string, header ...string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remote
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if _, err := app.addUser(context.Background(), "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	app.config.Auth.SessionHours = 1
+	u, _ := app.authenticate(context.Background(), "alice", "correct horse")
+	session, _, err := app.createSession(context.Background(), u, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Off by default.
+	if code := call("DELETE", "/api/v1/recordings/1", "192.0.2.1:1"); code != http.StatusOK {
+		t.Errorf("auth disabled: %d", code)
+	}
+
+	app.config.Auth.Enabled = true
+	for _, tc := range []struct {
+		method, path string
+		header       []string
+		want         int
+	}{
+		{"GET", "/api/v1/recordings/1", nil, http.StatusOK},
+		{"DELETE", "/api/v1/recordings/1", nil, http.StatusUnauthorized},
+		{"DELETE", "/api/v1/recordings/1", []string{"Authorization", "Bearer nope"}, http.StatusUnauthorized},
+		{"DELETE", "/api/v1/recordings/1", []string{"Authorization", "Bearer " + key}, http.StatusOK},
+		{"DELETE", "/api/v1/recordings/1", []string{"X-API-Key", key}, http.StatusOK},
+		{"DELETE", "/api/v1/recordings/1", []string{"Cookie", sessionCookie + "=" + session}, http.StatusOK},
+		{"DELETE", "/api/v1/recordings/1", []string{"Cookie", sessionCookie + "=expired"}, http.StatusUnauthorized},
+		{"POST", "/api/v1/login", nil, http.StatusOK},
+	} {
+		if code := call(tc.method, tc.path, "192.0.2.1:1", tc.header...); code != tc.want {
+			t.Errorf("%s %s %v: got %d, want %d", tc.method, tc.path, tc.header, code, tc.want)
+		}
+	}
+
+	app.config.Auth.ProtectReads = true
+	app.config.Auth.FileAllowlist = []string{"192.168.1.0/24"}
+	if code := call("GET", "/api/v1/recordings/1", "192.168.1.20:1"); code != http.StatusUnauthorized {
+		t.Errorf("read with protectReads: %d", code)
+	}
+	if code := call("GET", "/api/v1/recordings/1/file", "192.168.1.20:1"); code != http.StatusOK {
+		t.Errorf("allowlisted download: %d", code)
+	}
+	if code := call("GET", "/api/v1/recordings/1/file", "192.0.2.1:1"); code != http.StatusUnauthorized {
+		t.Errorf("download from elsewhere: %d", code)
+	}
+	if code := call("GET", "/", "192.0.2.1:1"); code != http.StatusOK {
+		t.Errorf("UI page with protectReads: %d", code)
+	}
+}
+
+func TestRequireAuthProxy(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Auth = pkgcfg.Auth{Enabled: true, Proxy: &pkgcfg.AuthProxy{TrustedProxies: []string{"172.18.0.2/32"}}}
+	if _, err := app.addUser(context.Background(), "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	var user string
+	r := mux.NewRouter()
+	r.Use(app.requireAuth)
+	r.HandleFunc("/api/v1/recordings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u := requestUser(r); u != nil {
+			user = u.Username
+		}
+	}).Methods("DELETE")
+	call := func(remote, header, value string) int {
+		req := httptest.NewRequest("DELETE", "/api/v1/recordings/1", nil)
+		req.RemoteAddr = remote
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		user = ""
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call("172.18.0.2:4000", "Remote-User", "alice"); code != http.StatusOK || user != "alice" {
+		t.Errorf("Remote-User from the proxy: %d %q", code, user)
+	}
+	// bob is added on first sign-in, as a viewer.
+	if code := call("172.18.0.2:4000", "X-Forwarded-User", "bob"); code != http.StatusForbidden {
+		t.Errorf("X-Forwarded-User from the proxy: %d", code)
+	}
+	if u, err := app.externalUser(context.Background(), "bob", true); err != nil || u.Role != roleViewer {
+		t.Errorf("proxy user %+v, %v", u, err)
+	}
+
+	// With adminGroups, the proxy's groups decide the role.
+	app.config.Auth.AdminGroups = []string{"admins"}
+	if code := call("172.18.0.2:4000", "Remote-User", "alice"); code != http.StatusForbidden {
+		t.Errorf("proxy user outside adminGroups: %d", code)
+	}
+	req := httptest.NewRequest("DELETE", "/api/v1/recordings/1", nil)
+	req.RemoteAddr = "172.18.0.2:4000"
+	req.Header.Set("Remote-User", "alice")
+	req.Header.Set("Remote-Groups", "users, admins")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("proxy user in adminGroups: %d", rr.Code)
+	}
+	app.config.Auth.AdminGroups = nil
+	if code := call("192.0.2.1:4000", "Remote-User", "alice"); code != http.StatusUnauthorized {
+		t.Errorf("header from elsewhere: %d", code)
+	}
+
+	app.config.Auth.Proxy.UserHeader = "X-Auth-User"
+	if code := call("172.18.0.2:4000", "Remote-User", "alice"); code != http.StatusUnauthorized {
+		t.Errorf("other header with userHeader set: %d", code)
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	for _, tc := range []struct {
+		role, method, route string
+		want                bool
+	}{
+		{roleAdmin, "DELETE", "/api/v1/recordings/{id}", true},
+		{roleViewer, "GET", "/api/v1/recordings", true},
+		{roleViewer, "GET", fileRoute, true},
+		{roleViewer, "POST", "/api/v1/recordings/{id}/reports", true},
+		{roleViewer, "DELETE", "/api/v1/recordings/{id}", false},
+		{roleViewer, "POST", "/api/v1/guide/refresh", false},
+		{roleViewer, "GET", "/api/v1/settings", false},
+		{roleViewer, "GET", "/api/v1/admin/keys", false},
+		{"", "GET", "/api/v1/recordings", true},
+		{"", "POST", "/api/v1/recordings/{id}/reports", false},
+		{"", "GET", "/api/v1/audit", false},
+		{"", "POST", graphqlRoute, true},
+	} {
+		if got := roleAllows(tc.role, tc.method, tc.route); got != tc.want {
+			t.Errorf("%q %s %s: got %v", tc.role, tc.method, tc.route, got)
+		}
+	}
+}
+
+func TestRequireAuthRoles(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Auth = pkgcfg.Auth{Enabled: true, SessionHours: 1}
+	ctx := context.Background()
+	session := func(name, role string) string {
+		if _, err := app.addUser(ctx, name, "correct horse"); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.setRole(ctx, name, role); err != nil {
+			t.Fatal(err)
+		}
+		u, _ := app.authenticate(ctx, name, "correct horse")
+		token, _, err := app.createSession(ctx, u, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	admin, viewer := session("alice", roleAdmin), session("bob", roleViewer)
+
+	r := mux.NewRouter()
+	r.Use(app.requireAuth)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/api/v1/recordings/{id}", ok).Methods("GET", "DELETE")
+	r.HandleFunc("/api/v1/settings", ok).Methods("GET")
+	call := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, tc := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", "/api/v1/recordings/1", viewer, http.StatusOK},
+		{"DELETE", "/api/v1/recordings/1", viewer, http.StatusForbidden},
+		{"DELETE", "/api/v1/recordings/1", admin, http.StatusOK},
+		{"GET", "/api/v1/settings", viewer, http.StatusForbidden},
+		{"GET", "/api/v1/settings", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/settings", admin, http.StatusOK},
+	} {
+		if code := call(tc.method, tc.path, tc.token); code != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, code, tc.want)
+		}
+	}
+
+	// Viewers may watch over the WebSocket but not send commands.
+	if res := app.runWSCommand(ctx, []byte(`{"command": "refreshGuide"}`), roleViewer); res.OK || res.Error == "" {
+		t.Errorf("viewer command: %+v", res)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix     = "recordings-"
+	backupTimeFormat = "20060102-150405"
+)
+
+// BackupInfo describes one database backup in the backup directory.
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var (
+	// errBackupUnsupported is returned when the database is not SQLite.
+	errBackupUnsupported = errors.New("backups are taken of SQLite databases only; back up PostgreSQL with pg_dump")
+	// errBackupExists is returned for a second backup within a second.
+	errBackupExists = errors.New("a backup was taken this second already")
+)
+
+// backupDatabase writes a copy of the database to the backup directory and
+// drops the oldest backups beyond the number kept. VACUUM INTO reads a
+// single consistent snapshot, so recordings and API writes carry on while
+// it runs. The copy is written under a temporary name and renamed, so an
+// interrupted backup never looks like a complete one.
+func (a *App) backupDatabase(ctx context.Context, now time.Time) (BackupInfo, error) {
+	cfg := a.cfg()
+	b, err := a.writeBackup(ctx, now)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	if err := pruneBackups(cfg.Backup.Dir, cfg.Backup.Keep); err != nil {
+		slog.Warn("Error removing old backups", "dir", cfg.Backup.Dir, "err", err)
+	}
+	return b, nil
+}
+
+// writeBackup is backupDatabase without the pruning.
+func (a *App) writeBackup(ctx context.Context, now time.Time) (BackupInfo, error) {
+	cfg := a.cfg()
+	if cfg.DBDriver == driverPostgres {
+		return BackupInfo{}, errBackupUnsupported
+	}
+	dir := cfg.Backup.Dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return BackupInfo{}, err
+	}
+	name := backupPrefix + now.UTC().Format(backupTimeFormat) + ".db"
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return BackupInfo{}, errBackupExists
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp) //nolint: errcheck
+	if _, err := a.store.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp) //nolint: errcheck
+		return BackupInfo{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return BackupInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return BackupInfo{Name: name, Size: info.Size(), CreatedAt: now.UTC()}, nil
+}
+
+// listBackups returns the backups in dir, newest first.
+func listBackups(dir string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	backups := []BackupInfo{}
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), backupPrefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, ".db")
+		created, err := time.Parse(backupTimeFormat, stamp)
+		if !ok || err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: e.Name(), Size: info.Size(), CreatedAt: created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// pruneBackups removes all but the newest keep backups in dir.
+func pruneBackups(dir string, keep int) error {
+	backups, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i].Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBackupSchedule takes the daily backup at backup.at. It checks every
+// minute, so a reload that changes the time applies the same day.
+func (a *App) runBackupSchedule(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	var last string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			at := a.cfg().Backup.At
+			loc, _ := a.getLocalLocation()
+			local := now.In(loc)
+			if at == "" || local.Format("15:04") != at || local.Format("2006-01-02") == last {
+				continue
+			}
+			last = local.Format("2006-01-02")
+			if b, err := a.backupDatabase(ctx, now); err != nil {
+				slog.Error("Scheduled database backup failed", "err", err)
+			} else {
+				slog.Info("Database backed up", "name", b.Name, "size", b.Size)
+			}
+		}
+	}
+}
+
+// postBackup serves POST /api/admin/backup.
+func (a *App) postBackup(w http.ResponseWriter, r *http.Request) {
+	b, err := a.backupDatabase(r.Context(), time.Now())
+	if errors.Is(err, errBackupUnsupported) || errors.Is(err, errBackupExists) {
+		status := http.StatusNotImplemented
+		if errors.Is(err, errBackupExists) {
+			status = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) //nolint: errcheck
+		return
+	} else if err != nil {
+		requestLogger(r).Error("Database backup failed", "err", err)
+		http.Error(w, "Backup failed", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Database backed up", "name", b.Name, "size", b.Size)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b) //nolint: errcheck
+}
+
+// getBackups serves GET /api/admin/backups, newest first.
+func (a *App) getBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := listBackups(a.cfg().Backup.Dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backups) //nolint: errcheck
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBackupDatabase(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.config.Backup.Dir = dir
+	app.config.Backup.Keep = 2
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	for day := 0; day < 3; day++ {
+		if _, err := app.backupDatabase(context.Background(), start.AddDate(0, 0, day)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/admin/backup", app.postBackup).Methods("POST")
+	r.HandleFunc("/api/v1/admin/backups", app.getBackups).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/admin/backups", nil))
+	var backups []BackupInfo
+	json.NewDecoder(rr.Body).Decode(&backups) //nolint: errcheck
+	if len(backups) != 2 || backups[0].Name != "recordings-20260303-030000.db" || backups[1].Name != "recordings-20260302-030000.db" {
+		t.Fatalf("backups kept: %+v", backups)
+	}
+
+	// The copy is a database of its own.
+	copyDB, err := sql.Open("sqlite3", filepath.Join(dir, backups[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copyDB.Close() //nolint: errcheck
+	var title string
+	if err := copyDB.QueryRow("SELECT title FROM recordings WHERE id = 1").Scan(&title); err != nil || title != "News" {
+		t.Errorf("backup holds %q, %v", title, err)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/admin/backup", nil))
+	var b BackupInfo
+	json.NewDecoder(rr.Body).Decode(&b) //nolint: errcheck
+	if rr.Code != http.StatusCreated || b.Size == 0 {
+		t.Errorf("POST backup: %d %+v", rr.Code, b)
+	}
+
+	app.config.DBDriver = driverPostgres
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/admin/backup", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("PostgreSQL backup: %d", rr.Code)
+	}
+}
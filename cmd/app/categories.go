@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GuideCategory is one category assigned by the guide generator, with the
+// number of upcoming programs in it.
+type GuideCategory struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// categoryFilter parses a comma-separated category query parameter into a
+// lowercase set, or nil when no filter was given.
+func categoryFilter(param string) map[string]bool {
+	var set map[string]bool
+	for _, c := range strings.Split(param, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		set[c] = true
+	}
+	return set
+}
+
+// getGuideCategories lists the categories of upcoming programs on enabled
+// channels, as filters for GET /api/guide?category=.
+func (a *App) getGuideCategories(w http.ResponseWriter, r *http.Request) {
+	a.enabledChannelsMutex.RLock()
+	enabled := make(map[string]bool, len(a.enabledChannels))
+	for k, v := range a.enabledChannels {
+		enabled[k] = v
+	}
+	a.enabledChannelsMutex.RUnlock()
+
+	now := time.Now()
+	counts := make(map[string]int)
+	a.guideDataMutex.RLock()
+	for _, prog := range a.guideData.Programs {
+		if prog.Category == "" || !enabled[prog.Channel] {
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, prog.End)
+		if err != nil || end.Before(now) {
+			continue
+		}
+		counts[strings.ToLower(prog.Category)]++
+	}
+	a.guideDataMutex.RUnlock()
+
+	categories := []GuideCategory{}
+	for c, n := range counts {
+		categories = append(categories, GuideCategory{Category: c, Count: n})
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Category < categories[j].Category })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(categories); err != nil {
+		requestLogger(r).Error("Error encoding categories response", "err", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestGuideCategories(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Minute)
+	prog := func(channel, title, category string, start time.Time) types.Program {
+		return types.Program{
+			Channel:  channel,
+			Title:    title,
+			Category: category,
+			Start:    start.Format(time.RFC3339),
+			End:      start.Add(time.Hour).Format(time.RFC3339),
+		}
+	}
+	app.enabledChannels = map[string]bool{"5.1": true, "7.1": true}
+	app.guideData = types.Guide{Programs: []types.Program{
+		prog("5.1", "Movie Night", "movie", start),
+		prog("7.1", "Evening News", "news", start),
+		prog("7.1", "Late Movie", "movie", start.Add(time.Hour)),
+		prog("7.1", "Old Movie", "movie", start.Add(-4*time.Hour)),
+		prog("9.1", "Disabled Channel Movie", "movie", start),
+		prog("5.1", "Infomercial", "", start.Add(time.Hour)),
+	}}
+
+	rr := httptest.NewRecorder()
+	app.getGuideCategories(rr, httptest.NewRequest("GET", "/api/guide/categories", nil))
+	var categories []GuideCategory
+	if err := json.NewDecoder(rr.Body).Decode(&categories); err != nil {
+		t.Fatal(err)
+	}
+	want := []GuideCategory{{Category: "movie", Count: 2}, {Category: "news", Count: 1}}
+	if !reflect.DeepEqual(categories, want) {
+		t.Errorf("got %+v, want %+v", categories, want)
+	}
+
+	titles := func(query string) []string {
+		rr := httptest.NewRecorder()
+		app.getGuide(rr, httptest.NewRequest("GET", "/api/guide"+query, nil))
+		var guide types.Guide
+		if err := json.NewDecoder(rr.Body).Decode(&guide); err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, p := range guide.Programs {
+			out = append(out, p.Title)
+		}
+		return out
+	}
+	if got := titles("?category=Movie"); !reflect.DeepEqual(got, []string{"Movie Night", "Late Movie"}) {
+		t.Errorf("category=Movie: got %v", got)
+	}
+	if got := titles("?category=movie,news"); len(got) != 3 {
+		t.Errorf("category=movie,news: got %v", got)
+	}
+	if got := titles(""); len(got) != 4 {
+		t.Errorf("no filter: got %v", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// chatDefaultEvents are what the Discord and Slack providers post unless
+// configured otherwise.
+var chatDefaultEvents = []string{eventRecordingCompleted, eventRecordingFailed}
+
+// chatField is one labelled value shown under a chat message.
+type chatField struct {
+	name, value string
+}
+
+// chatFields describes the recording n is about.
+func chatFields(n Notification) []chatField {
+	rec := n.Recording
+	if rec == nil {
+		return nil
+	}
+	var fields []chatField
+	if rec.Title != "" {
+		fields = append(fields, chatField{"Title", rec.Title})
+	}
+	if rec.ChannelID != "" {
+		fields = append(fields, chatField{"Channel", strings.TrimSpace(rec.ChannelID + " " + rec.ChannelName)})
+	}
+	if rec.Date != "" {
+		fields = append(fields, chatField{"Aired", rec.Date + " " + rec.StartTime})
+	}
+	if rec.Duration > 0 {
+		fields = append(fields, chatField{"Duration", fmt.Sprintf("%d min", rec.Duration)})
+	}
+	return fields
+}
+
+// recordingLink is the file endpoint of the recording n is about, or ""
+// when there is no file or no public URL to link under.
+func recordingLink(publicURL string, n Notification) string {
+	if publicURL == "" || n.Recording == nil || n.Recording.File == "" || n.Event == eventRecordingDeleted {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/recordings/%d/file", strings.TrimRight(publicURL, "/"), n.Recording.ID)
+}
+
+// postJSON posts v to a chat webhook.
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return pushRequest(client, req)
+}
+
+// discordNotifier posts notifications as embeds to a Discord webhook.
+type discordNotifier struct {
+	url       string
+	publicURL string
+	client    *http.Client
+}
+
+func newDiscordNotifier(url, publicURL string) *discordNotifier {
+	return &discordNotifier{url: url, publicURL: publicURL, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (d *discordNotifier) name() string { return "discord" }
+
+func (d *discordNotifier) notify(ctx context.Context, n Notification) error {
+	type field struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline"`
+	}
+	embed := map[string]interface{}{
+		"title":       n.Subject,
+		"description": n.Message,
+		"timestamp":   n.Time.UTC().Format(time.RFC3339),
+		"color":       0x2ECC71,
+	}
+	if urgentEvent(n.Event) {
+		embed["color"] = 0xE74C3C
+	}
+	var fields []field
+	for _, f := range chatFields(n) {
+		fields = append(fields, field{Name: f.name, Value: f.value, Inline: true})
+	}
+	if len(fields) > 0 {
+		embed["fields"] = fields
+	}
+	if link := recordingLink(d.publicURL, n); link != "" {
+		embed["url"] = link
+	}
+	return postJSON(ctx, d.client, d.url, map[string]interface{}{
+		"username": "hdhr-dvr",
+		"embeds":   []interface{}{embed},
+	})
+}
+
+// slackNotifier posts notifications as Block Kit messages to a Slack
+// incoming webhook.
+type slackNotifier struct {
+	url       string
+	publicURL string
+	client    *http.Client
+}
+
+func newSlackNotifier(url, publicURL string) *slackNotifier {
+	return &slackNotifier{url: url, publicURL: publicURL, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (s *slackNotifier) name() string { return "slack" }
+
+// slackEscape escapes the characters Slack treats as markup.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (s *slackNotifier) notify(ctx context.Context, n Notification) error {
+	type text struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type block struct {
+		Type   string `json:"type"`
+		Text   *text  `json:"text,omitempty"`
+		Fields []text `json:"fields,omitempty"`
+	}
+	blocks := []block{{Type: "section", Text: &text{"mrkdwn", "*" + slackEscape.Replace(n.Subject) + "*\n" + slackEscape.Replace(n.Message)}}}
+	if fields := chatFields(n); len(fields) > 0 {
+		b := block{Type: "section"}
+		for _, f := range fields {
+			b.Fields = append(b.Fields, text{"mrkdwn", "*" + f.name + "*\n" + slackEscape.Replace(f.value)})
+		}
+		blocks = append(blocks, b)
+	}
+	if link := recordingLink(s.publicURL, n); link != "" {
+		blocks = append(blocks, block{Type: "section", Text: &text{"mrkdwn", "<" + link + "|Download the recording>"}})
+	}
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"text":   n.Subject + ": " + n.Message,
+		"blocks": blocks,
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func chatNotification() Notification {
+	return Notification{
+		Event:   eventRecordingCompleted,
+		Time:    time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC),
+		Subject: "Recording completed",
+		Message: "Finished recording News & Weather",
+		Recording: &NotificationRecording{
+			ID: 3, Title: "News & Weather", ChannelID: "5.1", ChannelName: "KPIX",
+			Date: "2026-03-01", StartTime: "20:00", Duration: 60, File: "/rec/news.ts",
+		},
+	}
+}
+
+// captureJSON starts a webhook server that decodes each body into a map.
+func captureJSON(t *testing.T) (*httptest.Server, *map[string]interface{}) {
+	t.Helper()
+	got := map[string]interface{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&got) //nolint: errcheck
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	srv, got := captureJSON(t)
+	entries := newNotifiers(pkgcfg.Notifications{PublicURL: "http://dvr.lan:8080/", Discord: &pkgcfg.ChatWebhook{URL: srv.URL}})
+	if len(entries) != 1 || !entries[0].wants(eventRecordingFailed) || entries[0].wants(eventDiskLow) {
+		t.Fatalf("entries %+v", entries)
+	}
+	if err := entries[0].notifier.notify(context.Background(), chatNotification()); err != nil {
+		t.Fatal(err)
+	}
+	embed := (*got)["embeds"].([]interface{})[0].(map[string]interface{})
+	if embed["title"] != "Recording completed" || embed["url"] != "http://dvr.lan:8080/api/recordings/3/file" {
+		t.Errorf("embed %v", embed)
+	}
+	var fields []string
+	for _, f := range embed["fields"].([]interface{}) {
+		f := f.(map[string]interface{})
+		fields = append(fields, f["name"].(string)+"="+f["value"].(string))
+	}
+	if strings.Join(fields, ",") != "Title=News & Weather,Channel=5.1 KPIX,Aired=2026-03-01 20:00,Duration=60 min" {
+		t.Errorf("fields %v", fields)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	srv, got := captureJSON(t)
+	s := newSlackNotifier(srv.URL, "http://dvr.lan:8080")
+	if err := s.notify(context.Background(), chatNotification()); err != nil {
+		t.Fatal(err)
+	}
+	blocks := (*got)["blocks"].([]interface{})
+	if len(blocks) != 3 {
+		t.Fatalf("blocks %v", blocks)
+	}
+	head := blocks[0].(map[string]interface{})["text"].(map[string]interface{})["text"]
+	if head != "*Recording completed*\nFinished recording News &amp; Weather" {
+		t.Errorf("heading %q", head)
+	}
+	link := blocks[2].(map[string]interface{})["text"].(map[string]interface{})["text"]
+	if link != "<http://dvr.lan:8080/api/recordings/3/file|Download the recording>" {
+		t.Errorf("link %q", link)
+	}
+
+	// Without a public URL or a file there is nothing to link to.
+	n := chatNotification()
+	n.Recording.File = ""
+	if err := newSlackNotifier(srv.URL, "http://dvr.lan:8080").notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := (*got)["blocks"].([]interface{}); len(blocks) != 2 {
+		t.Errorf("linked a recording without a file: %v", blocks)
+	}
+}
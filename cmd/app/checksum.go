@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// ChecksumCheck compares a copy of a recording with the SHA-256 stored for
+// it. Location is empty for the file in the recording's storage root and
+// the archive location for the archived copy.
+type ChecksumCheck struct {
+	Location string `json:"location,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ChecksumReport is the result of POST /api/recordings/{id}/verify. OK is
+// true when every copy still matches.
+type ChecksumReport struct {
+	RecordingID int             `json:"recordingId"`
+	OK          bool            `json:"ok"`
+	Checks      []ChecksumCheck `json:"checks"`
+}
+
+// errNoRemoteHash is returned by remoteSHA256 for destinations that cannot
+// report a SHA-256.
+var errNoRemoteHash = errors.New("destination cannot report a SHA-256")
+
+// fileSHA256 returns the hex SHA-256 of the file name on fs.
+func fileSHA256(fs storage.Storage, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint: errcheck
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteSHA256 asks rclone for the SHA-256 of an archived copy, downloading
+// it when the backend keeps no hash of its own. S3 objects report only an
+// MD5-based ETag, so they give errNoRemoteHash and are checked by size.
+func (a *App) remoteSHA256(location string) (string, error) {
+	if isS3Location(location) {
+		return "", errNoRemoteHash
+	}
+	out, err := a.commander.Output("rclone", "hashsum", "sha256", "--download", location)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("rclone reported no hash for %s", location)
+	}
+	return fields[0], nil
+}
+
+// storeChecksum saves the SHA-256 of a recording's copy at location.
+func (a *App) storeChecksum(ctx context.Context, id int, location, sum string) error {
+	_, err := a.dbExecContext(ctx, `
+        INSERT OR REPLACE INTO recording_checksums (recording_id, location, sha256, computed_at)
+        VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, id, location, sum)
+	return err
+}
+
+// verifyChecksums re-hashes each copy of a recording that has a stored
+// checksum: its file, unless archiving removed it, and its archived copy
+// where the destination can hash it.
+func (a *App) verifyChecksums(ctx context.Context, id int) (*ChecksumReport, error) {
+	rows, err := a.dbQueryContext(ctx, "SELECT location, sha256 FROM recording_checksums WHERE recording_id = ? ORDER BY location", id)
+	if err != nil {
+		return nil, err
+	}
+	var checks []ChecksumCheck
+	for rows.Next() {
+		var c ChecksumCheck
+		if err := rows.Scan(&c.Location, &c.Expected); err != nil {
+			rows.Close() //nolint: errcheck
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	err = rows.Err()
+	rows.Close() //nolint: errcheck
+	if err != nil {
+		return nil, err
+	}
+	if len(checks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	var name string
+	var localDeleted bool
+	err = a.dbQueryRowContext(ctx, `
+		SELECT COALESCE(f.path, ''), COALESCE(ar.local_deleted, 0)
+		FROM recordings r
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		LEFT JOIN recording_archives ar ON ar.recording_id = r.id
+		WHERE r.id = ?`, id).Scan(&name, &localDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ChecksumReport{RecordingID: id, OK: true, Checks: []ChecksumCheck{}}
+	for _, c := range checks {
+		switch {
+		case c.Location == "" && localDeleted:
+			continue
+		case c.Location == "":
+			c.Actual, err = fileSHA256(a.recordingStorage(ctx, id), name)
+		default:
+			c.Actual, err = a.remoteSHA256(c.Location)
+			if errors.Is(err, errNoRemoteHash) {
+				continue
+			}
+		}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		c.OK = err == nil && c.Actual == c.Expected
+		report.OK = report.OK && c.OK
+		if _, err := a.dbExecContext(ctx, "UPDATE recording_checksums SET verified_at = CURRENT_TIMESTAMP, verified_ok = ? WHERE recording_id = ? AND location = ?",
+			c.OK, id, c.Location); err != nil {
+			return nil, err
+		}
+		report.Checks = append(report.Checks, c)
+	}
+	return report, nil
+}
+
+// verifyRecordingChecksum serves POST /api/recordings/{id}/verify.
+func (a *App) verifyRecordingChecksum(w http.ResponseWriter, r *http.Request) {
+	// Hashing a long recording on a NAS can outlast the write timeout.
+	noWriteTimeout(w)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	report, err := a.verifyChecksums(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No checksum stored for recording", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !report.OK {
+		requestLogger(r).Error("Recording failed checksum verification", "recording_id", id, "checks", report.Checks)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report) //nolint: errcheck
+}
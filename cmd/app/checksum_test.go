@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestRecordingChecksums(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	const name = "2026-03-01-20:00-News.mp4"
+	dir := t.TempDir()
+	fs := storage.NewLocal(dir)
+	app.storage = fs
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("video"))
+	want := hex.EncodeToString(sum[:])
+
+	if err := app.recordOutput(context.Background(), fs, 1, name); err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	if err := db.QueryRow("SELECT sha256 FROM recording_checksums WHERE recording_id = 1 AND location = ''").Scan(&stored); err != nil || stored != want {
+		t.Fatalf("stored checksum %q, %v", stored, err)
+	}
+
+	// Archiving to an rclone destination checks the copy's hash too.
+	app.config.Archive = pkgcfg.Archive{Destination: "nas:dvr"}
+	remote := want
+	mc := app.commander.(*MockCommander)
+	mc.RunCommandFunc = func(name string, args ...string) error { return nil }
+	mc.OutputFunc = func(name string, args ...string) ([]byte, error) {
+		if args[0] == "lsjson" {
+			return []byte(`[{"Size": 5}]`), nil
+		}
+		return []byte(remote + "  " + name + "\n"), nil
+	}
+	if err := app.archiveRecording(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/recordings/{id}/verify", app.verifyRecordingChecksum).Methods("POST")
+	verify := func(id string) (int, ChecksumReport) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/recordings/"+id+"/verify", nil))
+		var report ChecksumReport
+		json.NewDecoder(rr.Body).Decode(&report) //nolint: errcheck
+		return rr.Code, report
+	}
+	if code, report := verify("1"); code != http.StatusOK || !report.OK || len(report.Checks) != 2 {
+		t.Errorf("intact recording: %d %+v", code, report)
+	}
+
+	// Bit rot in the local file, and a damaged archive copy.
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("vide0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote = "0000"
+	code, report := verify("1")
+	if code != http.StatusOK || report.OK || len(report.Checks) != 2 || report.Checks[0].OK || report.Checks[1].OK {
+		t.Errorf("damaged recording: %d %+v", code, report)
+	}
+	var ok bool
+	db.QueryRow("SELECT verified_ok FROM recording_checksums WHERE recording_id = 1 AND location = ''").Scan(&ok) //nolint: errcheck
+	if ok {
+		t.Error("failed verification not stored")
+	}
+
+	if code, _ := verify("2"); code != http.StatusNotFound {
+		t.Errorf("recording without a checksum: %d", code)
+	}
+}
+
+func TestArchiveChecksumMismatch(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	const name = "2026-03-01-20:00-News.mp4"
+	mem := storage.NewMemory()
+	app.storage = mem
+	mem.WriteFile(name, []byte("video"))
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	app.config.Archive = pkgcfg.Archive{Destination: "nas:dvr"}
+	mc := app.commander.(*MockCommander)
+	mc.RunCommandFunc = func(name string, args ...string) error { return nil }
+	mc.OutputFunc = func(name string, args ...string) ([]byte, error) {
+		if args[0] == "lsjson" {
+			return []byte(`[{"Size": 5}]`), nil
+		}
+		return []byte("deadbeef  " + name + "\n"), nil
+	}
+	if err := app.archiveRecording(context.Background(), 1); err == nil {
+		t.Error("archived a copy whose hash differs")
+	}
+	var status string
+	db.QueryRow("SELECT status FROM recordings WHERE id = 1").Scan(&status) //nolint: errcheck
+	if status != "completed" {
+		t.Errorf("status %s", status)
+	}
+}
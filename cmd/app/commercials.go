@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Commercial modes: what the comskip stage does with the breaks it finds.
+const (
+	commercialsMark = "mark"
+	commercialsCut  = "cut"
+)
+
+// cutTolerance is how far, as a fraction of the expected length, a cut
+// recording's measured duration may be off before the cut is rejected.
+const cutTolerance = 0.02
+
+func validCommercialMode(mode string) bool {
+	return mode == commercialsMark || mode == commercialsCut
+}
+
+// commercialMode returns the mode for a recording: the one set when it was
+// created (auto-record passes its keyword's) or through the API, else the
+// configured default.
+func (a *App) commercialMode(ctx context.Context, id int) string {
+	var mode string
+	err := a.dbQueryRowContext(ctx, "SELECT mode FROM recording_commercials WHERE recording_id = ?", id).Scan(&mode)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Error loading commercial mode of recording", "recording_id", id, "err", err)
+	}
+	if validCommercialMode(mode) {
+		return mode
+	}
+	if validCommercialMode(a.cfg().Comskip.Mode) {
+		return a.cfg().Comskip.Mode
+	}
+	return commercialsMark
+}
+
+// keptSegments returns the parts of the recording outside the commercial
+// breaks. The last part has End 0, meaning the end of the file.
+func keptSegments(segs []edlSegment) []edlSegment {
+	var kept []edlSegment
+	pos := 0.0
+	for _, seg := range segs {
+		if seg.Start > pos {
+			kept = append(kept, edlSegment{Start: pos, End: seg.Start})
+		}
+		pos = math.Max(pos, seg.End)
+	}
+	return append(kept, edlSegment{Start: pos})
+}
+
+// concatList returns an ffconcat script that plays the kept segments of
+// file in order.
+func concatList(file string, kept []edlSegment) string {
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	quoted := "'" + strings.ReplaceAll(file, "'", `'\''`) + "'"
+	for _, seg := range kept {
+		fmt.Fprintf(&b, "file %s\ninpoint %.3f\n", quoted, seg.Start)
+		if seg.End > 0 {
+			fmt.Fprintf(&b, "outpoint %.3f\n", seg.End)
+		}
+	}
+	return b.String()
+}
+
+// cutCommercials losslessly re-cuts the MP4 name without its commercial
+// breaks. The cut is written beside the original, which is only replaced
+// once the cut's measured duration matches what should remain. It returns
+// the number of seconds removed.
+func (a *App) cutCommercials(ctx context.Context, job *postJob, name string, segs []edlSegment) (float64, error) {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	listName, tmpName := base+".cut.txt", base+".cut.mp4"
+	defer job.fs.Remove(listName) //nolint: errcheck
+
+	input, err := job.fs.LocalPath(name)
+	if err != nil {
+		return 0, err
+	}
+	w, err := job.fs.Create(listName)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w, concatList(input, keptSegments(segs))); err != nil {
+		w.Close() //nolint: errcheck
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	list, err := job.fs.LocalPath(listName)
+	if err != nil {
+		return 0, err
+	}
+	output, err := job.fs.LocalPath(tmpName)
+	if err != nil {
+		return 0, err
+	}
+
+	args := []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-i", list,
+		"-map", "0",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-y",
+		output,
+	}
+	if err := a.commander.RunCommand("ffmpeg", args...); err != nil {
+		_ = job.fs.Remove(tmpName)
+		return 0, err
+	}
+
+	got, err := probeDuration(a.commander, output)
+	if err != nil {
+		_ = job.fs.Remove(tmpName)
+		return 0, fmt.Errorf("verifying cut: %w", err)
+	}
+	removed := 0.0
+	for _, seg := range segs {
+		removed += seg.End - seg.Start
+	}
+	if job.duration > 0 {
+		want := job.duration - removed
+		if math.Abs(got-want) > want*cutTolerance {
+			_ = job.fs.Remove(tmpName)
+			return 0, fmt.Errorf("verifying cut: %.1f seconds long, expected %.1f", got, want)
+		}
+		removed = job.duration - got
+	} else if got <= 0 {
+		_ = job.fs.Remove(tmpName)
+		return 0, fmt.Errorf("verifying cut: empty output")
+	}
+
+	if err := job.fs.Rename(tmpName, name); err != nil {
+		return 0, err
+	}
+	// The breaks no longer exist in the file, so players must not skip them.
+	if err := job.fs.Remove(edlName(name)); err != nil {
+		slog.Error("Error removing EDL of cut recording", "recording_id", job.rec.ID, "err", err)
+	}
+	if _, err := a.dbExecContext(ctx, "DELETE FROM recording_edl WHERE recording_id = ?", job.rec.ID); err != nil {
+		slog.Error("Error removing EDL of cut recording", "recording_id", job.rec.ID, "err", err)
+	}
+	if err := a.recordOutput(ctx, job.fs, job.rec.ID, name); err != nil {
+		slog.Error("Error updating file of recording after cutting commercials", "recording_id", job.rec.ID, "err", err)
+	}
+	return removed, nil
+}
+
+// CommercialsRequest is the body of PUT /api/recordings/{id}/commercials.
+type CommercialsRequest struct {
+	Mode string `json:"mode"`
+}
+
+// setRecordingCommercials sets what the comskip stage does with a
+// recording's commercials.
+func (a *App) setRecordingCommercials(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var req CommercialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validCommercialMode(req.Mode) {
+		http.Error(w, "mode must be mark or cut", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var exists bool
+	if err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recordings WHERE id = ?)", id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_commercials (recording_id, mode) VALUES (?, ?)", id, req.Mode); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
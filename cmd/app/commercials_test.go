@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestConcatList(t *testing.T) {
+	kept := keptSegments([]edlSegment{{Start: 0, End: 30}, {Start: 600, End: 780}})
+	got := concatList("/data/Bob's Show.mp4", kept)
+	want := "ffconcat version 1.0\n" +
+		"file '/data/Bob'\\''s Show.mp4'\ninpoint 30.000\noutpoint 600.000\n" +
+		"file '/data/Bob'\\''s Show.mp4'\ninpoint 780.000\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCutCommercials(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		probed   string
+		wantData string
+		wantEDL  bool
+	}{
+		{name: "verified", mode: commercialsCut, probed: "3420.5", wantData: "cut"},
+		{name: "wrong length keeps original", mode: commercialsCut, probed: "1200", wantData: "chapters", wantEDL: true},
+		{name: "mark", mode: commercialsMark, wantData: "chapters", wantEDL: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := setupTestApp(t)
+			defer db.Close() //nolint: errcheck
+
+			dir := t.TempDir()
+			app.storage = storage.NewLocal(dir)
+			app.config.Comskip = pkgcfg.Comskip{Enabled: true}
+			if err := os.WriteFile(filepath.Join(dir, "News.mp4"), []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("INSERT INTO recording_files (recording_id, path, duration_seconds) VALUES (1, 'News.mp4', 3600)"); err != nil {
+				t.Fatal(err)
+			}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/api/recordings", app.createRecording).Methods("POST")
+			r.HandleFunc("/api/recordings/{id}/commercials", app.setRecordingCommercials).Methods("PUT")
+			req := httptest.NewRequest("POST", "/api/recordings", strings.NewReader(`{"channelId":"5.1","date":"2026-03-01","startTime":"20:00","duration":60,"commercials":"cut"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("create: %d %s", rr.Code, rr.Body.String())
+			}
+			<-recordingCh
+			req = httptest.NewRequest("PUT", "/api/recordings/1/commercials", strings.NewReader(`{"mode":"`+tt.mode+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusNoContent {
+				t.Fatalf("set mode: %d %s", rr.Code, rr.Body.String())
+			}
+			db.Exec("UPDATE recordings SET status = 'completed' WHERE id = 1") //nolint: errcheck
+
+			mc := app.commander.(*MockCommander)
+			mc.RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+				return nil, os.WriteFile(filepath.Join(dir, "News.edl"), []byte("600\t780\t3\n"), 0644)
+			}
+			mc.RunCommandFunc = func(name string, args ...string) error {
+				data := "chapters"
+				if args[0] == "-f" {
+					data = "cut"
+					if list, _ := os.ReadFile(args[5]); !bytes.Contains(list, []byte("outpoint 600.000\n")) {
+						t.Errorf("concat list %q", list)
+					}
+				}
+				return os.WriteFile(args[len(args)-1], []byte(data), 0644)
+			}
+			mc.OutputFunc = func(name string, args ...string) ([]byte, error) {
+				if strings.HasSuffix(args[len(args)-1], ".cut.mp4") {
+					return []byte(tt.probed), nil
+				}
+				return []byte("3600"), nil
+			}
+
+			if !app.runPostProcessing(context.Background(), 1) {
+				t.Fatal("post-processing failed")
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "News.mp4")); string(data) != tt.wantData {
+				t.Errorf("recording holds %q, want %q", data, tt.wantData)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "News.cut.mp4")); !os.IsNotExist(err) {
+				t.Errorf("cut file left behind: %v", err)
+			}
+			_, err := os.Stat(filepath.Join(dir, "News.edl"))
+			var edlRows int
+			db.QueryRow("SELECT COUNT(*) FROM recording_edl").Scan(&edlRows) //nolint: errcheck
+			if (err == nil) != tt.wantEDL || (edlRows == 1) != tt.wantEDL {
+				t.Errorf("EDL on disk: %v, rows: %d, want EDL %v", err, edlRows, tt.wantEDL)
+			}
+		})
+	}
+}
+
+func TestCommercialModeDefault(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if got := app.commercialMode(context.Background(), 1); got != commercialsMark {
+		t.Errorf("default mode = %q", got)
+	}
+	app.config.Comskip.Mode = commercialsCut
+	if got := app.commercialMode(context.Background(), 1); got != commercialsCut {
+		t.Errorf("configured mode = %q", got)
+	}
+}
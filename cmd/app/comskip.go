@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// edlSegment is one line of an EDL file: a span in seconds and the action a
+// player should take on it (0 cut, 3 commercial break).
+type edlSegment struct {
+	Start  float64
+	End    float64
+	Action int
+}
+
+// edlName returns the EDL sidecar of a recording file, named the way Kodi
+// and other players look for it.
+func edlName(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + ".edl"
+}
+
+// parseEDL reads the segments of an EDL file, skipping lines it cannot
+// parse.
+func parseEDL(text string) []edlSegment {
+	var segs []edlSegment
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		start, err1 := strconv.ParseFloat(fields[0], 64)
+		end, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil || end <= start {
+			continue
+		}
+		seg := edlSegment{Start: start, End: end}
+		if len(fields) > 2 {
+			seg.Action, _ = strconv.Atoi(fields[2])
+		}
+		segs = append(segs, seg)
+	}
+	return segs
+}
+
+// chapterMetadata returns an ffmetadata file with a chapter for each
+// commercial break and for each part of the program around them. The last
+// part runs to duration seconds when it is known.
+func chapterMetadata(segs []edlSegment, duration float64) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	chapter := func(start, end float64, title string) {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(start*1000), int64(end*1000), title)
+	}
+	part := 0
+	pos := 0.0
+	for _, seg := range segs {
+		if seg.Start > pos {
+			part++
+			chapter(pos, seg.Start, fmt.Sprintf("Part %d", part))
+		}
+		chapter(seg.Start, seg.End, "Commercial")
+		pos = seg.End
+	}
+	if duration > pos {
+		chapter(pos, duration, fmt.Sprintf("Part %d", part+1))
+	}
+	return b.String()
+}
+
+// runComskip is the comskip post-processing stage. It runs comskip on the
+// recording, keeps the EDL it writes beside the file and in recording_edl,
+// and then either cuts the commercials out of an MP4 or remuxes it with a
+// chapter per program part and commercial break.
+func (a *App) runComskip(ctx context.Context, job *postJob) ([]byte, error) {
+	cfg := a.cfg().Comskip
+	name := finalFileName(job.rec)
+	file, err := job.fs.LocalPath(name)
+	if err != nil {
+		return nil, err
+	}
+	command := cfg.Command
+	if command == "" {
+		command = "comskip"
+	}
+	var args []string
+	if cfg.Ini != "" {
+		args = append(args, "--ini="+cfg.Ini)
+	}
+	args = append(args, "--output="+filepath.Dir(file), file)
+
+	out, err := a.commander.RunWithEnv(nil, command, args...)
+	// comskip exits with 1 when it finds no commercials.
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+
+	f, err := job.fs.Open(edlName(name))
+	if err != nil {
+		return out, fmt.Errorf("reading EDL (is output_edl=1 set in the comskip ini?): %w", err)
+	}
+	edl, err := io.ReadAll(f)
+	f.Close() //nolint: errcheck
+	if err != nil {
+		return out, err
+	}
+	if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_edl (recording_id, edl) VALUES (?, ?)", job.rec.ID, string(edl)); err != nil {
+		return out, err
+	}
+
+	segs := parseEDL(string(edl))
+	if len(segs) == 0 || path.Ext(name) != ".mp4" {
+		return out, nil
+	}
+	if a.commercialMode(ctx, job.rec.ID) == commercialsCut {
+		removed, err := a.cutCommercials(ctx, job, name, segs)
+		if err == nil {
+			slog.Info("Removed commercials from recording", "recording_id", job.rec.ID, "seconds", removed)
+			return append(out, fmt.Sprintf("\nRemoved %.0f seconds of commercials\n", removed)...), nil
+		}
+		slog.Warn("Cutting commercials from recording failed, marking them instead", "recording_id", job.rec.ID, "err", err)
+		out = append(out, fmt.Sprintf("\nCut failed, original kept: %v\n", err)...)
+	}
+	if err := a.addChapters(job, name, segs); err != nil {
+		return out, fmt.Errorf("adding chapters: %w", err)
+	}
+	if err := a.recordOutput(ctx, job.fs, job.rec.ID, name); err != nil {
+		slog.Error("Error updating file of recording after adding chapters", "recording_id", job.rec.ID, "err", err)
+	}
+	slog.Info("Marked commercial breaks in recording", "recording_id", job.rec.ID, "breaks", len(segs))
+	return out, nil
+}
+
+// addChapters remuxes the MP4 name with chapters from segs and replaces it.
+func (a *App) addChapters(job *postJob, name string, segs []edlSegment) error {
+	base := strings.TrimSuffix(name, ".mp4")
+	metaName, tmpName := base+".chapters.txt", base+".chapters.mp4"
+	defer job.fs.Remove(metaName) //nolint: errcheck
+
+	w, err := job.fs.Create(metaName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, chapterMetadata(segs, job.duration)); err != nil {
+		w.Close() //nolint: errcheck
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	input, err := job.fs.LocalPath(name)
+	if err != nil {
+		return err
+	}
+	meta, err := job.fs.LocalPath(metaName)
+	if err != nil {
+		return err
+	}
+	output, err := job.fs.LocalPath(tmpName)
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"-i", input,
+		"-i", meta,
+		"-map", "0",
+		"-map_metadata", "1",
+		"-map_chapters", "1",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-y",
+		output,
+	}
+	if err := a.commander.RunCommand("ffmpeg", args...); err != nil {
+		_ = job.fs.Remove(tmpName)
+		return err
+	}
+	return job.fs.Rename(tmpName, name)
+}
+
+// getRecordingEDL serves the commercial breaks comskip found in a recording
+// as an EDL file.
+func (a *App) getRecordingEDL(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var edl string
+	err = a.dbQueryRowContext(r.Context(), "SELECT edl FROM recording_edl WHERE recording_id = ?", id).Scan(&edl)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No EDL for recording", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%d.edl"`, id))
+	io.WriteString(w, edl) //nolint: errcheck
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestChapterMetadata(t *testing.T) {
+	segs := parseEDL("0.00\t30.50\t0\n600.00\t780.25\t3\nbad line\n900\t800\t3\n")
+	if len(segs) != 2 || segs[1].Start != 600 || segs[1].End != 780.25 || segs[1].Action != 3 {
+		t.Fatalf("parseEDL = %+v", segs)
+	}
+	got := chapterMetadata(segs, 1800)
+	for _, want := range []string{
+		"START=0\nEND=30500\ntitle=Commercial\n",
+		"START=30500\nEND=600000\ntitle=Part 1\n",
+		"START=600000\nEND=780250\ntitle=Commercial\n",
+		"START=780250\nEND=1800000\ntitle=Part 2\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metadata lacks %q:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "[CHAPTER]"); n != 4 {
+		t.Errorf("got %d chapters", n)
+	}
+	if n := strings.Count(chapterMetadata(segs, 0), "[CHAPTER]"); n != 3 {
+		t.Errorf("unknown duration: got %d chapters, want 3", n)
+	}
+}
+
+type exitCodeError int
+
+func (e exitCodeError) Error() string { return "exit status" }
+func (e exitCodeError) ExitCode() int { return int(e) }
+
+func TestRunComskip(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	app.config.Comskip = pkgcfg.Comskip{Enabled: true, Ini: "/etc/comskip.ini"}
+	if err := os.WriteFile(filepath.Join(dir, "News.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recording_files (recording_id, path, duration_seconds) VALUES (1, 'News.mp4', 3600)"); err != nil {
+		t.Fatal(err)
+	}
+
+	const edl = "600.00\t780.00\t3\n"
+	mc := app.commander.(*MockCommander)
+	var comskipArgs []string
+	mc.RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+		comskipArgs = args
+		return nil, os.WriteFile(filepath.Join(dir, "News.edl"), []byte(edl), 0644)
+	}
+	var ffmpegArgs []string
+	mc.RunCommandFunc = func(name string, args ...string) error {
+		ffmpegArgs = args
+		meta, err := os.ReadFile(args[3])
+		if err != nil || !strings.Contains(string(meta), "END=3600000") {
+			t.Errorf("chapter metadata %q (%v)", meta, err)
+		}
+		return os.WriteFile(args[len(args)-1], []byte("video with chapters"), 0644)
+	}
+
+	if !app.runPostProcessing(context.Background(), 1) {
+		t.Fatal("post-processing failed")
+	}
+	if strings.Join(comskipArgs, " ") != "--ini=/etc/comskip.ini --output="+dir+" "+filepath.Join(dir, "News.mp4") {
+		t.Errorf("comskip args %v", comskipArgs)
+	}
+	if ffmpegArgs == nil {
+		t.Fatal("ffmpeg was not run to add chapters")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "News.mp4")); string(data) != "video with chapters" {
+		t.Errorf("recording not replaced: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "News.chapters.txt")); !os.IsNotExist(err) {
+		t.Errorf("chapter metadata left behind: %v", err)
+	}
+	var size int64
+	db.QueryRow("SELECT file_size FROM recordings WHERE id = 1").Scan(&size) //nolint: errcheck
+	if size != int64(len("video with chapters")) {
+		t.Errorf("file_size = %d", size)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/edl", app.getRecordingEDL).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/edl", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != edl {
+		t.Errorf("got %d %q", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/2/edl", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("recording without EDL: got %d", rr.Code)
+	}
+}
+
+func TestRunComskipNoCommercials(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.storage = storage.NewLocal(t.TempDir())
+	app.commander.(*MockCommander).RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+		return []byte("0 commercials found"), exitCodeError(1)
+	}
+	title := "News"
+	job := &postJob{fs: app.storage}
+	job.rec.ID, job.rec.Title, job.rec.FileName = 1, &title, "News.mp4"
+	if _, err := app.runComskip(context.Background(), job); err != nil {
+		t.Errorf("exit status 1 should mean no commercials, got %v", err)
+	}
+
+	app.commander.(*MockCommander).RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+		return nil, exitCodeError(2)
+	}
+	if _, err := app.runComskip(context.Background(), job); err == nil {
+		t.Error("expected other exit statuses to fail the step")
+	}
+}
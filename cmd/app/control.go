@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// maxExtendMinutes bounds a single extension.
+const maxExtendMinutes = 240
+
+var (
+	errRecordingNotFound = errors.New("recording not found")
+	errNotCancellable    = errors.New("recording is neither pending nor recording")
+	errNotExtendable     = errors.New("only pending and running recordings can be extended")
+	errNoTunerForExtend  = errors.New("no tuner is free for the extra time")
+)
+
+// stopRequests holds the IDs of running recordings asked to stop early.
+var stopRequests sync.Map
+
+// cancelRecording cancels a pending recording, or stops a running one and
+// keeps what it has captured so far.
+func (a *App) cancelRecording(ctx context.Context, id int) error {
+	var status string
+	err := a.dbQueryRowContext(ctx, "SELECT status FROM recordings WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return errRecordingNotFound
+	} else if err != nil {
+		return err
+	}
+	switch status {
+	case statusPending, statusWaiting:
+		if err := a.setStatus(ctx, id, statusCancelled, "cancelled on request"); err != nil {
+			return err
+		}
+		recordingTimers.Delete(id)
+		slog.Info("Recording cancelled", "recording_id", id)
+		a.events.publish("recording.cancelled", map[string]interface{}{"id": id})
+		return nil
+	case statusRecording:
+		v, ok := a.runningProcesses.Load(id)
+		if !ok {
+			return errNotCancellable
+		}
+		stopRequests.Store(id, true)
+		if cmd, ok := v.(*exec.Cmd); ok && cmd.Process != nil {
+			if err := cmd.Process.Kill(); err != nil {
+				return err
+			}
+		}
+		slog.Info("Recording stopped early on request", "recording_id", id)
+		return nil
+	}
+	return errNotCancellable
+}
+
+// extendRecording adds minutes to a pending or running recording. A running
+// capture records the extra time once its scheduled end is reached.
+func (a *App) extendRecording(ctx context.Context, id, minutes int) error {
+	if minutes <= 0 || minutes > maxExtendMinutes {
+		return fmt.Errorf("minutes must be between 1 and %d", maxExtendMinutes)
+	}
+	var rec types.Recording
+	err := a.dbQueryRowContext(ctx, "SELECT date, start_time, duration, status FROM recordings WHERE id = ?", id).
+		Scan(&rec.Date, &rec.StartTime, &rec.Duration, &rec.Status)
+	if err == sql.ErrNoRows {
+		return errRecordingNotFound
+	} else if err != nil {
+		return err
+	}
+	if rec.Status != statusPending && rec.Status != statusWaiting && rec.Status != statusRecording {
+		return errNotExtendable
+	}
+
+	start, err := time.Parse("2006-01-02 15:04", rec.Date+" "+rec.StartTime)
+	if err != nil {
+		return err
+	}
+	end := start.Add(time.Duration(rec.Duration) * time.Minute)
+	ok, err := a.isTunerAvailable(ctx, RecordingRequest{
+		Date: end.Format("2006-01-02"), StartTime: end.Format("15:04"), Duration: minutes,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoTunerForExtend
+	}
+
+	if _, err := a.dbExecContext(ctx, "UPDATE recordings SET duration = duration + ? WHERE id = ?", minutes, id); err != nil {
+		return err
+	}
+	slog.Info("Recording extended", "recording_id", id, "minutes", minutes)
+	a.events.publish("recording.extended", map[string]interface{}{"id": id, "minutes": minutes, "duration": rec.Duration + minutes})
+	return nil
+}
+
+// captureExtensions records the time added to r while it was capturing,
+// appending each extra capture to outputFile. It returns the minutes added.
+func (a *App) captureExtensions(r *types.Recording, url, outputFile string, logFile io.Writer, codecArgs []string) (int, error) {
+	added := 0
+	for {
+		if _, stopped := stopRequests.Load(r.ID); stopped {
+			return added, nil
+		}
+		var duration int
+		if err := a.dbQueryRowContext(context.Background(), "SELECT duration FROM recordings WHERE id = ?", r.ID).Scan(&duration); err != nil {
+			return added, err
+		}
+		extra := duration - r.Duration
+		if extra <= 0 {
+			return added, nil
+		}
+		r.Duration = duration
+		added += extra
+		slog.Info("Recording was extended, capturing more", "recording_id", r.ID, "minutes", extra)
+
+		segment := outputFile + ".ext"
+		cmd, err := a.commander.StartCommand("ffmpeg", logFile, logFile, buildFFmpegArgs(url, extra*60, segment, codecArgs)...)
+		if err != nil {
+			return added, err
+		}
+		a.runningProcesses.Store(r.ID, cmd)
+		runErr := cmd.Run()
+		if runErr != nil {
+			a.metrics.ffmpegFailed()
+		}
+		appendErr := appendFile(outputFile, segment)
+		os.Remove(segment) //nolint: errcheck
+		if runErr != nil {
+			return added, runErr
+		}
+		if appendErr != nil {
+			return added, appendErr
+		}
+	}
+}
+
+// appendFile appends the contents of src to dst. MPEG-TS captures can be
+// joined this way.
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint: errcheck
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close() //nolint: errcheck
+		return err
+	}
+	return out.Close()
+}
+
+// controlError writes err from cancelRecording or extendRecording as a JSON
+// error with a matching status.
+func controlError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch err {
+	case errRecordingNotFound:
+		status = http.StatusNotFound
+	case errNotCancellable, errNotExtendable, errNoTunerForExtend:
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) //nolint: errcheck
+}
+
+// cancelRecordingHandler cancels a pending recording or stops a running one.
+func (a *App) cancelRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	if err := a.cancelRecording(r.Context(), id); err != nil {
+		controlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExtendRequest is the body of POST /api/recordings/{id}/extend.
+type ExtendRequest struct {
+	Minutes int `json:"minutes"`
+}
+
+// extendRecordingHandler adds {"minutes": n} to a pending or running
+// recording.
+func (a *App) extendRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var req ExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := a.extendRecording(r.Context(), id, req.Minutes); err != nil {
+		controlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
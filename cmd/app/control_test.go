@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestCancelRecording(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	for _, q := range []string{
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (2, '5.1', '2026-02-01', '20:00', 60, 'completed')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+
+	ctx := context.Background()
+	if err := app.cancelRecording(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	var status string
+	db.QueryRow("SELECT status FROM recordings WHERE id = 1").Scan(&status) //nolint: errcheck
+	if status != "cancelled" {
+		t.Errorf("status %q", status)
+	}
+	if e := <-events; e.Type != "recording.cancelled" {
+		t.Errorf("event %s", e.Type)
+	}
+	if err := app.cancelRecording(ctx, 2); err != errNotCancellable {
+		t.Errorf("cancelling a completed recording: %v", err)
+	}
+	if err := app.cancelRecording(ctx, 9); err != errRecordingNotFound {
+		t.Errorf("cancelling a missing recording: %v", err)
+	}
+}
+
+func TestExtendRecording(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	for _, q := range []string{
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'recording')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (2, '7.1', '2026-03-01', '21:15', 30, 'pending')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (3, '5.1', '2026-02-01', '20:00', 60, 'completed')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	if err := app.extendRecording(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	var duration int
+	db.QueryRow("SELECT duration FROM recordings WHERE id = 1").Scan(&duration) //nolint: errcheck
+	if duration != 70 {
+		t.Errorf("duration %d", duration)
+	}
+	// Another 10 minutes would run into recording 2 with only two tuners.
+	if err := app.extendRecording(ctx, 1, 10); err != errNoTunerForExtend {
+		t.Errorf("overlapping extension: %v", err)
+	}
+	if err := app.extendRecording(ctx, 3, 10); err != errNotExtendable {
+		t.Errorf("extending a completed recording: %v", err)
+	}
+	if err := app.extendRecording(ctx, 1, 0); err == nil {
+		t.Error("zero minutes accepted")
+	}
+}
+
+func TestCaptureExtensions(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (1, '5.1', '2026-03-01', '20:00', 70, 'recording')"); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "news.ts")
+	if err := os.WriteFile(output, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var seconds string
+	app.commander.(*MockCommander).StartCommandFunc = func(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error) {
+		for i, a := range args {
+			if a == "-t" {
+				seconds = args[i+1]
+			}
+		}
+		return exec.Command("sh", "-c", `printf second > "$0"`, args[len(args)-1]), nil
+	}
+
+	r := types.Recording{ID: 1, Duration: 60}
+	added, err := app.captureExtensions(&r, "http://tuner/auto/v5.1", output, io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 10 || seconds != "600" || r.Duration != 70 {
+		t.Errorf("added %d minutes, captured %s seconds, duration %d", added, seconds, r.Duration)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "firstsecond" {
+		t.Errorf("recording is %q", data)
+	}
+	if _, err := os.Stat(output + ".ext"); !os.IsNotExist(err) {
+		t.Errorf("segment left behind: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// corsOriginAllowed reports whether origin matches one of allowed: exactly,
+// through "*", or through a "scheme://*.domain" pattern.
+func corsOriginAllowed(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(a, "://*."); ok {
+			rest, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if found && strings.HasSuffix(rest, "."+strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list holds s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors is server middleware answering preflight requests and adding the
+// CORS headers for origins allowed by the cors setting. It reads the
+// setting on each request, so a reload applies at once.
+func (a *App) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := a.cfg().CORS
+		origin := r.Header.Get("Origin")
+		if c == nil || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !corsOriginAllowed(c.AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		setCORSOrigin(w, c, origin)
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || method == "" {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A preflight: the browser asks before sending the real request.
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !containsFold(c.AllowedMethods, method) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h != "" && !containsFold(c.AllowedHeaders, h) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAgeSeconds))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// setCORSOrigin allows origin. A wildcard is only answered as "*" when
+// credentials are not allowed, since browsers reject that combination.
+func setCORSOrigin(w http.ResponseWriter, c *pkgcfg.CORS, origin string) {
+	if containsFold(c.AllowedOrigins, "*") && !c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestCORSOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://*.lan.example"}
+	for origin, want := range map[string]bool{
+		"https://app.example.com":   true,
+		"HTTPS://APP.example.com":   true,
+		"https://dvr.lan.example":   true,
+		"http://dvr.lan.example":    false,
+		"https://lan.example":       false,
+		"https://evil.example.com":  false,
+		"https://app.example.com.x": false,
+	} {
+		if got := corsOriginAllowed(allowed, origin); got != want {
+			t.Errorf("%s: got %v", origin, got)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.CORS = &pkgcfg.CORS{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Range"},
+		ExposedHeaders:   []string{"Content-Range"},
+		AllowCredentials: true,
+		MaxAgeSeconds:    600,
+	}
+	reached := false
+	h := app.cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	request := func(method, origin, reqMethod, reqHeaders string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/recordings/1/file", nil)
+		req.Header.Set("Origin", origin)
+		if reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", reqMethod)
+			req.Header.Set("Access-Control-Request-Headers", reqHeaders)
+		}
+		rr := httptest.NewRecorder()
+		reached = false
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request("OPTIONS", "https://app.example.com", "GET", "range")
+	if rr.Code != http.StatusNoContent || reached ||
+		rr.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		rr.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		rr.Header().Get("Access-Control-Allow-Headers") != "Content-Type, Range" ||
+		rr.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("preflight: %d %v", rr.Code, rr.Header())
+	}
+	if rr := request("OPTIONS", "https://app.example.com", "DELETE", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("preflight for a method not allowed: %d", rr.Code)
+	}
+	if rr := request("OPTIONS", "https://app.example.com", "GET", "X-Custom"); rr.Code != http.StatusForbidden {
+		t.Errorf("preflight for a header not allowed: %d", rr.Code)
+	}
+
+	rr = request("GET", "https://app.example.com", "", "")
+	if !reached || rr.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		rr.Header().Get("Access-Control-Expose-Headers") != "Content-Range" {
+		t.Errorf("simple request: %v", rr.Header())
+	}
+
+	rr = request("GET", "https://evil.example.com", "", "")
+	if !reached || rr.Header().Get("Access-Control-Allow-Origin") != "" || rr.Header().Get("Vary") != "Origin" {
+		t.Errorf("other origin: %v", rr.Header())
+	}
+
+	// Any origin without credentials is answered with a wildcard.
+	app.config.CORS.AllowedOrigins = []string{"*"}
+	app.config.CORS.AllowCredentials = false
+	if rr := request("GET", "https://anywhere.example", "", ""); rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("wildcard: %v", rr.Header())
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// debugHandler serves net/http/pprof under /debug/pprof/ and expvar at
+// /debug/vars. It is only ever served on the admin address, never on the
+// main router.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// debugVars is the DVR's own entry in /debug/vars, next to expvar's
+// memstats and cmdline.
+func (a *App) debugVars() map[string]interface{} {
+	captures := 0
+	a.runningProcesses.Range(func(_, _ interface{}) bool {
+		captures++
+		return true
+	})
+	timers := 0
+	recordingTimers.Range(func(_, _ interface{}) bool {
+		timers++
+		return true
+	})
+	return map[string]interface{}{
+		"goroutines":       runtime.NumGoroutine(),
+		"activeCaptures":   captures,
+		"pendingTimers":    timers,
+		"eventSubscribers": a.events.subscriberCount(),
+		"tuners":           a.tunerCount,
+	}
+}
+
+// serveDebug publishes debugVars and serves debugHandler on addr until the
+// listener fails. It is meant to be bound to localhost or a private
+// network.
+func (a *App) serveDebug(addr string) {
+	expvar.Publish("hdhr_dvr", expvar.Func(func() interface{} { return a.debugVars() }))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           debugHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("Debug server starting", "addr", addr)
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("Debug server stopped", "addr", addr, "err", err)
+	}
+}
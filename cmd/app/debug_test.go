@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	h := debugHandler()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "goroutine") {
+		t.Errorf("pprof index: %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(rr.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Errorf("no memstats in %v", vars)
+	}
+
+	// Nothing else is served, in particular not the API.
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("API on the debug server: %d", rr.Code)
+	}
+}
+
+func TestDebugVars(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.runningProcesses.Store(1, nil)
+	_, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+
+	v := app.debugVars()
+	if v["activeCaptures"] != 1 || v["eventSubscribers"] != 1 || v["tuners"] != 2 {
+		t.Errorf("got %v", v)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultProbeSeconds = 5
+	maxProbeSeconds     = 30
+	probeFileName       = ".throughput-probe"
+)
+
+// probeWriteLimit caps how much the storage probe writes, so a fast disk
+// doesn't fill up during a long probe.
+var probeWriteLimit int64 = 1 << 30
+
+type ThroughputRequest struct {
+	ChannelID  string  `json:"channelId,omitempty"`  // defaults to the first enabled channel
+	Seconds    float64 `json:"seconds,omitempty"`    // per probe, defaults to 5
+	Recordings int     `json:"recordings,omitempty"` // defaults to the tuner count
+}
+
+type ThroughputResult struct {
+	ChannelID           string  `json:"channelId"`
+	TunerBytesPerSec    float64 `json:"tunerBytesPerSec"`
+	StorageBytesPerSec  float64 `json:"storageBytesPerSec"`
+	Recordings          int     `json:"recordings"`
+	RequiredBytesPerSec float64 `json:"requiredBytesPerSec"`
+	// MaxRecordings is how many streams at the measured tuner rate storage
+	// can absorb at once.
+	MaxRecordings int  `json:"maxRecordings"`
+	CanSustain    bool `json:"canSustain"`
+}
+
+// probeTuner streams channel url for d and returns the average rate.
+func probeTuner(ctx context.Context, url string, d time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("tuner returned %s", resp.Status)
+	}
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, err
+	}
+	elapsed := time.Since(start).Seconds()
+	if n == 0 || elapsed <= 0 {
+		return 0, fmt.Errorf("tuner sent no data")
+	}
+	return float64(n) / elapsed, nil
+}
+
+// probeStorage writes a scratch file to the recording storage for d, or
+// until probeWriteLimit bytes, and returns the average rate including the
+// final sync to disk.
+func (a *App) probeStorage(ctx context.Context, d time.Duration) (float64, error) {
+	f, err := a.storage.Create(probeFileName)
+	if err != nil {
+		return 0, err
+	}
+	defer a.storage.Remove(probeFileName) //nolint: errcheck
+
+	buf := make([]byte, 1<<20)
+	var n int64
+	start := time.Now()
+	deadline := start.Add(d)
+	for time.Now().Before(deadline) && n < probeWriteLimit && ctx.Err() == nil {
+		w, err := f.Write(buf)
+		n += int64(w)
+		if err != nil {
+			f.Close() //nolint: errcheck
+			return 0, err
+		}
+	}
+	if s, ok := f.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			f.Close() //nolint: errcheck
+			return 0, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("storage probe finished instantly")
+	}
+	return float64(n) / elapsed, nil
+}
+
+// runThroughputProbe streams from a tuner and then writes to storage, each
+// for the requested time, and compares the rates. It needs a free tuner.
+func (a *App) runThroughputProbe(w http.ResponseWriter, r *http.Request) {
+	var req ThroughputRequest
+	if r.ContentLength != 0 {
+		if r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Seconds == 0 {
+		req.Seconds = defaultProbeSeconds
+	}
+	if req.Seconds < 0 || req.Seconds > maxProbeSeconds {
+		http.Error(w, fmt.Sprintf("seconds must be between 0 and %d", maxProbeSeconds), http.StatusBadRequest)
+		return
+	}
+	if req.Recordings == 0 {
+		req.Recordings = a.tunerCount
+	}
+	if req.Recordings < 0 {
+		http.Error(w, "recordings must be positive", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var url string
+	var err error
+	if req.ChannelID == "" {
+		err = a.dbQueryRowContext(ctx, "SELECT guide_number, url FROM channels WHERE enabled = 1 ORDER BY guide_number LIMIT 1").Scan(&req.ChannelID, &url)
+	} else {
+		err = a.dbQueryRowContext(ctx, "SELECT url FROM channels WHERE guide_number = ?", req.ChannelID).Scan(&url)
+	}
+	if err != nil || url == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Channel not found"}) //nolint: errcheck
+		return
+	}
+
+	if a.tunerCount > 0 && a.tunersInUse() >= a.tunerCount {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "No free tuner for the probe"}) //nolint: errcheck
+		return
+	}
+
+	d := time.Duration(req.Seconds * float64(time.Second))
+	tunerRate, err := probeTuner(ctx, url, d)
+	if err != nil {
+		requestLogger(r).Error("Throughput probe of channel failed", "channel", req.ChannelID, "err", err)
+		http.Error(w, "Tuner probe failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	storageRate, err := a.probeStorage(ctx, d)
+	if err != nil {
+		requestLogger(r).Error("Throughput probe of storage failed", "err", err)
+		http.Error(w, "Storage probe failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := ThroughputResult{
+		ChannelID:           req.ChannelID,
+		TunerBytesPerSec:    tunerRate,
+		StorageBytesPerSec:  storageRate,
+		Recordings:          req.Recordings,
+		RequiredBytesPerSec: tunerRate * float64(req.Recordings),
+		MaxRecordings:       int(storageRate / tunerRate),
+	}
+	result.CanSustain = result.StorageBytesPerSec >= result.RequiredBytesPerSec
+	requestLogger(r).Info("Throughput probe finished", "tuner_mbps", tunerRate*8/1e6, "storage_mbps", storageRate*8/1e6, "recordings", req.Recordings, "can_sustain", result.CanSustain)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result) //nolint: errcheck
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestRunThroughputProbe(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	probeWriteLimit = 8 << 20
+	defer func() { probeWriteLimit = 1 << 30 }()
+
+	tuner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		packet := make([]byte, 188*7)
+		for r.Context().Err() == nil {
+			if _, err := w.Write(packet); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer tuner.Close()
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', ?, 1)", tuner.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	probe := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/diagnostics/throughput", bytes.NewBufferString(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rr := httptest.NewRecorder()
+		app.runThroughputProbe(rr, req)
+		return rr
+	}
+
+	if rr := probe(`{"seconds": 120}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a long probe, got %d", rr.Code)
+	}
+	if rr := probe(`{"channelId": "9.9", "seconds": 0.2}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown channel, got %d", rr.Code)
+	}
+
+	rr := probe(`{"seconds": 0.2, "recordings": 4}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var res ThroughputResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ChannelID != "5.1" || res.TunerBytesPerSec <= 0 || res.StorageBytesPerSec <= 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if res.RequiredBytesPerSec != 4*res.TunerBytesPerSec || res.CanSustain != (res.MaxRecordings >= 4) {
+		t.Errorf("inconsistent result %+v", res)
+	}
+	if _, err := mem.Stat(probeFileName); err == nil {
+		t.Error("expected the probe file to be removed")
+	}
+
+	app.runningProcesses.Store(1, nil)
+	app.runningProcesses.Store(2, nil)
+	defer app.runningProcesses.Delete(1)
+	defer app.runningProcesses.Delete(2)
+	if rr := probe(""); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 with all tuners busy, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"log/slog"
+	"net"
+	"strconv"
+)
+
+// HDHomeRun apps and DVRs find devices by broadcasting a discover request
+// to UDP port 65001. With the tuner emulation or the record engine on, the
+// DVR answers as the devices it emulates, so they show up without their
+// address being entered.
+
+// hdhrDiscoverPort is the UDP port HDHomeRun discovery uses.
+const hdhrDiscoverPort = 65001
+
+// HDHomeRun discovery packet types, tags and device types, as defined by
+// libhdhomerun.
+const (
+	hdhrTypeDiscoverReq = 0x0002
+	hdhrTypeDiscoverRpy = 0x0003
+
+	hdhrTagDeviceType = 0x01
+	hdhrTagDeviceID   = 0x02
+	hdhrTagTunerCount = 0x10
+	hdhrTagLineupURL  = 0x27
+	hdhrTagStorageURL = 0x28
+	hdhrTagBaseURL    = 0x2A
+	hdhrTagStorageID  = 0x2C
+
+	hdhrDeviceTypeTuner   = 0x00000001
+	hdhrDeviceTypeStorage = 0x00000005
+	hdhrWildcard          = 0xFFFFFFFF
+)
+
+// hdhrTag is one tag-length-value field of a discovery packet.
+type hdhrTag struct {
+	tag   byte
+	value []byte
+}
+
+// errBadPacket is returned for a datagram that is not a discovery packet.
+var errBadPacket = errors.New("malformed HDHomeRun packet")
+
+// encodeHDHRPacket frames tags as a packet of type typ: a big-endian type
+// and payload length, the payload, then its CRC-32, little-endian.
+func encodeHDHRPacket(typ uint16, tags []hdhrTag) []byte {
+	var payload []byte
+	for _, t := range tags {
+		payload = append(payload, t.tag)
+		if n := len(t.value); n < 0x80 {
+			payload = append(payload, byte(n))
+		} else {
+			payload = append(payload, byte(n&0x7F)|0x80, byte(n>>7))
+		}
+		payload = append(payload, t.value...)
+	}
+	pkt := binary.BigEndian.AppendUint16(nil, typ)
+	pkt = binary.BigEndian.AppendUint16(pkt, uint16(len(payload)))
+	pkt = append(pkt, payload...)
+	return binary.LittleEndian.AppendUint32(pkt, crc32.ChecksumIEEE(pkt))
+}
+
+// decodeHDHRPacket checks and unframes a packet.
+func decodeHDHRPacket(pkt []byte) (uint16, []hdhrTag, error) {
+	if len(pkt) < 8 {
+		return 0, nil, errBadPacket
+	}
+	n := int(binary.BigEndian.Uint16(pkt[2:4]))
+	if len(pkt) != 4+n+4 || crc32.ChecksumIEEE(pkt[:4+n]) != binary.LittleEndian.Uint32(pkt[4+n:]) {
+		return 0, nil, errBadPacket
+	}
+	var tags []hdhrTag
+	for p := pkt[4 : 4+n]; len(p) > 0; {
+		if len(p) < 2 {
+			return 0, nil, errBadPacket
+		}
+		tag, size, hdr := p[0], int(p[1]), 2
+		if size&0x80 != 0 {
+			if len(p) < 3 {
+				return 0, nil, errBadPacket
+			}
+			size, hdr = size&0x7F|int(p[2])<<7, 3
+		}
+		if len(p) < hdr+size {
+			return 0, nil, errBadPacket
+		}
+		tags = append(tags, hdhrTag{tag, p[hdr : hdr+size]})
+		p = p[hdr+size:]
+	}
+	return binary.BigEndian.Uint16(pkt[0:2]), tags, nil
+}
+
+// discoveryReplies returns the replies to a discover request: one per
+// emulated device of a type it asks for. base is the DVR's address as the
+// requester reaches it.
+func (a *App) discoveryReplies(tags []hdhrTag, base string) [][]byte {
+	wantType, wantID := uint32(hdhrWildcard), uint32(hdhrWildcard)
+	for _, t := range tags {
+		if len(t.value) != 4 {
+			continue
+		}
+		switch t.tag {
+		case hdhrTagDeviceType:
+			wantType = binary.BigEndian.Uint32(t.value)
+		case hdhrTagDeviceID:
+			wantID = binary.BigEndian.Uint32(t.value)
+		}
+	}
+	wants := func(typ uint32) bool { return wantType == hdhrWildcard || wantType == typ }
+
+	cfg := a.cfg()
+	var replies [][]byte
+	if e := cfg.Emulation; e != nil && wants(hdhrDeviceTypeTuner) {
+		id, _ := strconv.ParseUint(e.DeviceID, 16, 32)
+		if wantID == hdhrWildcard || wantID == uint32(id) {
+			url := base
+			if e.BaseURL != "" {
+				url = e.BaseURL
+			}
+			replies = append(replies, encodeHDHRPacket(hdhrTypeDiscoverRpy, []hdhrTag{
+				{hdhrTagDeviceType, binary.BigEndian.AppendUint32(nil, hdhrDeviceTypeTuner)},
+				{hdhrTagDeviceID, binary.BigEndian.AppendUint32(nil, uint32(id))},
+				{hdhrTagTunerCount, []byte{byte(a.tunerCount)}},
+				{hdhrTagBaseURL, []byte(url)},
+				{hdhrTagLineupURL, []byte(url + "/lineup.json")},
+			}))
+		}
+	}
+	if e := cfg.RecordEngine; e != nil && wants(hdhrDeviceTypeStorage) {
+		url := base + recordEnginePrefix
+		if e.BaseURL != "" {
+			url = e.BaseURL
+		}
+		replies = append(replies, encodeHDHRPacket(hdhrTypeDiscoverRpy, []hdhrTag{
+			{hdhrTagDeviceType, binary.BigEndian.AppendUint32(nil, hdhrDeviceTypeStorage)},
+			{hdhrTagDeviceID, binary.BigEndian.AppendUint32(nil, hdhrWildcard)},
+			{hdhrTagStorageID, []byte(e.StorageID)},
+			{hdhrTagBaseURL, []byte(url)},
+			{hdhrTagStorageURL, []byte(url + "/recorded_files.json")},
+		}))
+	}
+	return replies
+}
+
+// serveDiscovery answers discover requests on conn until it is closed.
+func (a *App) serveDiscovery(conn net.PacketConn) {
+	buf := make([]byte, 1460)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("HDHomeRun discovery stopped", "err", err)
+			}
+			return
+		}
+		typ, tags, err := decodeHDHRPacket(buf[:n])
+		if err != nil || typ != hdhrTypeDiscoverReq {
+			continue
+		}
+		for _, reply := range a.discoveryReplies(tags, a.discoveryBaseURL(peer)) {
+			if _, err := conn.WriteTo(reply, peer); err != nil {
+				slog.Warn("Error answering HDHomeRun discovery", "peer", peer, "err", err)
+			}
+		}
+	}
+}
+
+// discoveryBaseURL returns the DVR's address as peer would reach it: the
+// local address of the interface that routes to peer, and the server port.
+func (a *App) discoveryBaseURL(peer net.Addr) string {
+	cfg := a.cfg()
+	host := "127.0.0.1"
+	if c, err := net.Dial("udp", peer.String()); err == nil {
+		host = c.LocalAddr().(*net.UDPAddr).IP.String()
+		c.Close() //nolint: errcheck
+	}
+	scheme := "http"
+	if cfg.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port)) + cfg.BasePath
+}
+
+// listenDiscovery answers HDHomeRun discovery on UDP port 65001. A port
+// already taken, such as by SiliconDust's own record engine, is logged and
+// leaves the devices to be added by address.
+func (a *App) listenDiscovery() {
+	conn, err := net.ListenPacket("udp4", ":"+strconv.Itoa(hdhrDiscoverPort))
+	if err != nil {
+		slog.Warn("Not answering HDHomeRun discovery", "err", err)
+		return
+	}
+	slog.Info("Answering HDHomeRun discovery", "port", hdhrDiscoverPort)
+	a.serveDiscovery(conn)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestHDHRPacket(t *testing.T) {
+	long := make([]byte, 200)
+	pkt := encodeHDHRPacket(hdhrTypeDiscoverRpy, []hdhrTag{{hdhrTagBaseURL, []byte("http://dvr")}, {hdhrTagStorageID, long}})
+	typ, tags, err := decodeHDHRPacket(pkt)
+	if err != nil || typ != hdhrTypeDiscoverRpy || len(tags) != 2 || string(tags[0].value) != "http://dvr" || len(tags[1].value) != 200 {
+		t.Fatalf("decoded %x %+v, %v", typ, tags, err)
+	}
+	pkt[5] ^= 1
+	if _, _, err := decodeHDHRPacket(pkt); err == nil {
+		t.Error("accepted a packet with a bad CRC")
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Port = 8080
+	app.config.Emulation = &pkgcfg.Emulation{DeviceID: "1234ABCD"}
+	app.config.RecordEngine = &pkgcfg.RecordEngine{StorageID: "ABC"}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint: errcheck
+	go app.serveDiscovery(conn)
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() //nolint: errcheck
+	ask := func(deviceType uint32) map[uint32]map[byte]string {
+		req := encodeHDHRPacket(hdhrTypeDiscoverReq, []hdhrTag{
+			{hdhrTagDeviceType, binary.BigEndian.AppendUint32(nil, deviceType)},
+			{hdhrTagDeviceID, binary.BigEndian.AppendUint32(nil, hdhrWildcard)},
+		})
+		if _, err := client.Write(req); err != nil {
+			t.Fatal(err)
+		}
+		devices := map[uint32]map[byte]string{}
+		buf := make([]byte, 1460)
+		for {
+			client.SetReadDeadline(time.Now().Add(200 * time.Millisecond)) //nolint: errcheck
+			n, err := client.Read(buf)
+			if err != nil {
+				return devices
+			}
+			typ, tags, err := decodeHDHRPacket(buf[:n])
+			if err != nil || typ != hdhrTypeDiscoverRpy {
+				t.Fatalf("reply %x, %v", typ, err)
+			}
+			fields := map[byte]string{}
+			for _, tag := range tags {
+				fields[tag.tag] = string(tag.value)
+			}
+			devices[binary.BigEndian.Uint32([]byte(fields[hdhrTagDeviceType]))] = fields
+		}
+	}
+
+	devices := ask(hdhrWildcard)
+	tuner, storage := devices[hdhrDeviceTypeTuner], devices[hdhrDeviceTypeStorage]
+	if len(devices) != 2 || tuner[hdhrTagBaseURL] != "http://127.0.0.1:8080" || tuner[hdhrTagDeviceID] != "\x12\x34\xAB\xCD" ||
+		tuner[hdhrTagTunerCount] != "\x02" || tuner[hdhrTagLineupURL] != "http://127.0.0.1:8080/lineup.json" {
+		t.Errorf("tuner %q", tuner)
+	}
+	if storage[hdhrTagStorageID] != "ABC" || storage[hdhrTagStorageURL] != "http://127.0.0.1:8080/record/recorded_files.json" {
+		t.Errorf("storage %q", storage)
+	}
+	if devices := ask(hdhrDeviceTypeStorage); len(devices) != 1 || devices[hdhrDeviceTypeStorage] == nil {
+		t.Errorf("storage only: %q", devices)
+	}
+}
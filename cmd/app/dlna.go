@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// The DVR is a UPnP AV media server for TVs and other DLNA players: the
+// device description lists a ContentDirectory, browsed through SOAP, whose
+// root holds a container per series with its finished recordings, the same
+// grouping the record engine uses. SSDP, in ssdp.go, tells players where
+// the description is.
+
+// dlnaPrefix is where the media server is served.
+const dlnaPrefix = "/dlna"
+
+// dlnaControlRoute takes the ContentDirectory's SOAP requests.
+const dlnaControlRoute = dlnaPrefix + "/control/ContentDirectory"
+
+// dlnaRoutes are the routes of the media server.
+var dlnaRoutes = []string{
+	dlnaPrefix + "/device.xml",
+	dlnaPrefix + "/ContentDirectory.xml",
+	dlnaPrefix + "/ConnectionManager.xml",
+	dlnaControlRoute,
+	dlnaPrefix + "/control/ConnectionManager",
+	dlnaPrefix + "/media/{id}",
+}
+
+// UPnP service types of the media server.
+const (
+	upnpContentDirectory  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	upnpConnectionManager = "urn:schemas-upnp-org:service:ConnectionManager:1"
+	upnpMediaServer       = "urn:schemas-upnp-org:device:MediaServer:1"
+)
+
+// dlnaContentFeatures are the DLNA flags of every recording: byte seeking,
+// streaming transfer, not transcoded.
+const dlnaContentFeatures = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+// dlna returns the DLNA settings, answering 404 when DLNA is off.
+func (a *App) dlna(w http.ResponseWriter, r *http.Request) *pkgcfg.DLNA {
+	d := a.cfg().DLNA
+	if d == nil {
+		http.NotFound(w, r)
+	}
+	return d
+}
+
+// recordingMIMEType returns the video type of a recording file by its
+// extension, MPEG-TS for captures.
+func recordingMIMEType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); strings.HasPrefix(t, "video/") {
+		return t
+	}
+	return "video/mpeg"
+}
+
+// serveDLNADevice serves GET /dlna/device.xml, the device description.
+func (a *App) serveDLNADevice(w http.ResponseWriter, r *http.Request) {
+	d := a.dlna(w, r)
+	if d == nil {
+		return
+	}
+	base := a.deviceBaseURL(r, d.BaseURL) + dlnaPrefix
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(d.FriendlyName)) //nolint: errcheck
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0" xmlns:dlna="urn:schemas-dlna-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>%s</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>hdhr-dvr</manufacturer>
+    <modelName>hdhr-dvr</modelName>
+    <UDN>uuid:%s</UDN>
+    <dlna:X_DLNADOC>DMS-1.50</dlna:X_DLNADOC>
+    <serviceList>
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>urn:upnp-org:serviceId:ContentDirectory</serviceId>
+        <SCPDURL>%s/ContentDirectory.xml</SCPDURL>
+        <controlURL>%s/control/ContentDirectory</controlURL>
+        <eventSubURL>%s/event/ContentDirectory</eventSubURL>
+      </service>
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>urn:upnp-org:serviceId:ConnectionManager</serviceId>
+        <SCPDURL>%s/ConnectionManager.xml</SCPDURL>
+        <controlURL>%s/control/ConnectionManager</controlURL>
+        <eventSubURL>%s/event/ConnectionManager</eventSubURL>
+      </service>
+    </serviceList>
+  </device>
+</root>
+`, upnpMediaServer, name.String(), d.UUID, upnpContentDirectory, base, base, base, upnpConnectionManager, base, base, base) //nolint: errcheck
+}
+
+// contentDirectorySCPD describes the ContentDirectory actions served.
+const contentDirectorySCPD = `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action><name>Browse</name><argumentList>
+      <argument><name>ObjectID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_ObjectID</relatedStateVariable></argument>
+      <argument><name>BrowseFlag</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_BrowseFlag</relatedStateVariable></argument>
+      <argument><name>Filter</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Filter</relatedStateVariable></argument>
+      <argument><name>StartingIndex</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Index</relatedStateVariable></argument>
+      <argument><name>RequestedCount</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+      <argument><name>SortCriteria</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_SortCriteria</relatedStateVariable></argument>
+      <argument><name>Result</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Result</relatedStateVariable></argument>
+      <argument><name>NumberReturned</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+      <argument><name>TotalMatches</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+      <argument><name>UpdateID</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_UpdateID</relatedStateVariable></argument>
+    </argumentList></action>
+    <action><name>GetSearchCapabilities</name><argumentList>
+      <argument><name>SearchCaps</name><direction>out</direction><relatedStateVariable>SearchCapabilities</relatedStateVariable></argument>
+    </argumentList></action>
+    <action><name>GetSortCapabilities</name><argumentList>
+      <argument><name>SortCaps</name><direction>out</direction><relatedStateVariable>SortCapabilities</relatedStateVariable></argument>
+    </argumentList></action>
+    <action><name>GetSystemUpdateID</name><argumentList>
+      <argument><name>Id</name><direction>out</direction><relatedStateVariable>SystemUpdateID</relatedStateVariable></argument>
+    </argumentList></action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_ObjectID</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Result</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_BrowseFlag</name><dataType>string</dataType>
+      <allowedValueList><allowedValue>BrowseMetadata</allowedValue><allowedValue>BrowseDirectChildren</allowedValue></allowedValueList></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Filter</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_SortCriteria</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Index</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Count</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_UpdateID</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>SearchCapabilities</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>SortCapabilities</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SystemUpdateID</name><dataType>ui4</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>
+`
+
+// connectionManagerSCPD describes the ConnectionManager actions served.
+const connectionManagerSCPD = `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action><name>GetProtocolInfo</name><argumentList>
+      <argument><name>Source</name><direction>out</direction><relatedStateVariable>SourceProtocolInfo</relatedStateVariable></argument>
+      <argument><name>Sink</name><direction>out</direction><relatedStateVariable>SinkProtocolInfo</relatedStateVariable></argument>
+    </argumentList></action>
+    <action><name>GetCurrentConnectionIDs</name><argumentList>
+      <argument><name>ConnectionIDs</name><direction>out</direction><relatedStateVariable>CurrentConnectionIDs</relatedStateVariable></argument>
+    </argumentList></action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>SourceProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SinkProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>CurrentConnectionIDs</name><dataType>string</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>
+`
+
+// serveDLNASCPD serves the service descriptions.
+func (a *App) serveDLNASCPD(scpd string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.dlna(w, r) == nil {
+			return
+		}
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		io.WriteString(w, scpd) //nolint: errcheck
+	}
+}
+
+// soapAction is the body of a SOAP request; Browse holds the arguments
+// of Browse, the only action that takes any.
+type soapAction struct {
+	Body struct {
+		Browse struct {
+			ObjectID       string
+			BrowseFlag     string
+			StartingIndex  int
+			RequestedCount int
+		}
+	}
+}
+
+// writeSOAP answers a SOAP action with its out arguments, in order.
+func writeSOAP(w http.ResponseWriter, service, action string, args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%sResponse xmlns:u="%s">`, action, service)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, "<%s>", args[i])
+		xml.EscapeText(&b, []byte(args[i+1])) //nolint: errcheck
+		fmt.Fprintf(&b, "</%s>", args[i])
+	}
+	fmt.Fprintf(&b, "</u:%sResponse></s:Body></s:Envelope>\n", action)
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	io.WriteString(w, b.String()) //nolint: errcheck
+}
+
+// writeSOAPFault answers a SOAP request with a UPnP error.
+func writeSOAPFault(w http.ResponseWriter, code int, desc string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>
+`, code, desc) //nolint: errcheck
+}
+
+// soapActionName returns the action named by the SOAPACTION header, e.g.
+// Browse for "urn:schemas-upnp-org:service:ContentDirectory:1#Browse".
+func soapActionName(r *http.Request) string {
+	_, action, _ := strings.Cut(strings.Trim(r.Header.Get("SOAPACTION"), `"`), "#")
+	return action
+}
+
+// serveConnectionManager serves the ConnectionManager's SOAP requests.
+func (a *App) serveConnectionManager(w http.ResponseWriter, r *http.Request) {
+	if a.dlna(w, r) == nil {
+		return
+	}
+	switch action := soapActionName(r); action {
+	case "GetProtocolInfo":
+		writeSOAP(w, upnpConnectionManager, action, "Source", "http-get:*:video/mpeg:*,http-get:*:video/mp4:*", "Sink", "")
+	case "GetCurrentConnectionIDs":
+		writeSOAP(w, upnpConnectionManager, action, "ConnectionIDs", "0")
+	default:
+		writeSOAPFault(w, 401, "Invalid Action")
+	}
+}
+
+// systemUpdateID changes whenever a recording changes status or is
+// deleted, so players know to browse again.
+func (a *App) systemUpdateID(r *http.Request) string {
+	var id, n int
+	a.dbQueryRowContext(r.Context(), "SELECT COALESCE(MAX(id), 0), COUNT(*) FROM recording_events").Scan(&id, &n) //nolint: errcheck
+	return strconv.Itoa(id + n)
+}
+
+// serveContentDirectory serves the ContentDirectory's SOAP requests.
+func (a *App) serveContentDirectory(w http.ResponseWriter, r *http.Request) {
+	d := a.dlna(w, r)
+	if d == nil {
+		return
+	}
+	switch action := soapActionName(r); action {
+	case "GetSearchCapabilities":
+		writeSOAP(w, upnpContentDirectory, action, "SearchCaps", "")
+	case "GetSortCapabilities":
+		writeSOAP(w, upnpContentDirectory, action, "SortCaps", "")
+	case "GetSystemUpdateID":
+		writeSOAP(w, upnpContentDirectory, action, "Id", a.systemUpdateID(r))
+	case "Browse":
+		var req soapAction
+		if err := xml.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			writeSOAPFault(w, 402, "Invalid Args")
+			return
+		}
+		b := req.Body.Browse
+		objects, err := a.dlnaObjects(r, a.deviceBaseURL(r, d.BaseURL)+dlnaPrefix, b.ObjectID, b.BrowseFlag == "BrowseMetadata")
+		if err != nil {
+			requestLogger(r).Error("Error browsing DLNA content", "object_id", b.ObjectID, "err", err)
+			writeSOAPFault(w, 501, "Action Failed")
+			return
+		}
+		if objects == nil {
+			writeSOAPFault(w, 701, "No such object")
+			return
+		}
+		total := len(objects)
+		start := min(max(b.StartingIndex, 0), total)
+		end := total
+		if b.RequestedCount > 0 {
+			end = min(start+b.RequestedCount, total)
+		}
+		objects = objects[start:end]
+		didl := `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">` +
+			strings.Join(objects, "") + `</DIDL-Lite>`
+		writeSOAP(w, upnpContentDirectory, action, "Result", didl, "NumberReturned", strconv.Itoa(len(objects)),
+			"TotalMatches", strconv.Itoa(total), "UpdateID", a.systemUpdateID(r))
+	default:
+		writeSOAPFault(w, 401, "Invalid Action")
+	}
+}
+
+// dlnaObjects returns the DIDL-Lite objects for a Browse of id: the object
+// itself with metadata set, or else its children. The root "0" holds a
+// container "s:<series ID>" per series, and each of them its recordings,
+// "r:<recording ID>". It returns nil for an unknown object.
+func (a *App) dlnaObjects(r *http.Request, base, id string, metadata bool) ([]string, error) {
+	episodes, err := a.recordedEpisodes(r.Context(), r, base)
+	if err != nil {
+		return nil, err
+	}
+	series := map[string][]RecordedEpisode{}
+	var order []string
+	for _, e := range episodes {
+		if _, ok := series[e.SeriesID]; !ok {
+			order = append(order, e.SeriesID)
+		}
+		series[e.SeriesID] = append(series[e.SeriesID], e)
+	}
+	container := func(id, parent, title string, children int) string {
+		var t strings.Builder
+		xml.EscapeText(&t, []byte(title)) //nolint: errcheck
+		return fmt.Sprintf(`<container id="%s" parentID="%s" restricted="1" childCount="%d"><dc:title>%s</dc:title><upnp:class>object.container.storageFolder</upnp:class></container>`,
+			id, parent, children, t.String())
+	}
+	item := func(e RecordedEpisode) string {
+		title := e.Title
+		if e.EpisodeTitle != "" {
+			title += " - " + e.EpisodeTitle
+		}
+		mimeType := recordingMIMEType(e.Filename)
+		var b strings.Builder
+		fmt.Fprintf(&b, `<item id="r:%d" parentID="s:%s" restricted="1"><dc:title>`, e.id, e.SeriesID)
+		xml.EscapeText(&b, []byte(title)) //nolint: errcheck
+		b.WriteString(`</dc:title>`)
+		if e.Synopsis != "" {
+			b.WriteString(`<dc:description>`)
+			xml.EscapeText(&b, []byte(e.Synopsis)) //nolint: errcheck
+			b.WriteString(`</dc:description>`)
+		}
+		secs := e.EndTime - e.StartTime
+		fmt.Fprintf(&b, `<dc:date>%s</dc:date><upnp:class>object.item.videoItem</upnp:class><res protocolInfo="http-get:*:%s:%s" duration="%d:%02d:%02d.000">%s/media/%d</res></item>`,
+			time.Unix(e.StartTime, 0).Format("2006-01-02T15:04:05"), mimeType, dlnaContentFeatures,
+			secs/3600, secs/60%60, secs%60, base, e.id)
+		return b.String()
+	}
+
+	switch {
+	case id == "0" && metadata:
+		return []string{container("0", "-1", a.cfg().DLNA.FriendlyName, len(order))}, nil
+	case id == "0":
+		objects := []string{}
+		for _, sid := range order {
+			objects = append(objects, container("s:"+sid, "0", series[sid][0].Title, len(series[sid])))
+		}
+		return objects, nil
+	case strings.HasPrefix(id, "s:"):
+		eps, ok := series[strings.TrimPrefix(id, "s:")]
+		if !ok {
+			return nil, nil
+		}
+		if metadata {
+			return []string{container(id, "0", eps[0].Title, len(eps))}, nil
+		}
+		objects := []string{}
+		for _, e := range eps {
+			objects = append(objects, item(e))
+		}
+		return objects, nil
+	case strings.HasPrefix(id, "r:") && metadata:
+		for _, e := range episodes {
+			if "r:"+strconv.Itoa(e.id) == id {
+				return []string{item(e)}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// serveDLNAMedia serves GET /dlna/media/{id}, the recording file as the
+// API serves it, with the headers DLNA players look for.
+func (a *App) serveDLNAMedia(w http.ResponseWriter, r *http.Request) {
+	if a.dlna(w, r) == nil {
+		return
+	}
+	if r.Header.Get("getcontentFeatures.dlna.org") != "" {
+		w.Header().Set("contentFeatures.dlna.org", dlnaContentFeatures)
+	}
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	a.getRecordingFile(w, mux.SetURLVars(r, map[string]string{"id": mux.Vars(r)["id"]}))
+}
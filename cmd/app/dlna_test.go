@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestDLNA(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	mem := storage.NewMemory()
+	app.storage = mem
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'Nova')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '5.1', '2026-03-08', '20:00', 60, 'partial', 'Nova')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (3, '5.1', '2026-03-02', '18:00', 30, 'completed', 'News & Weather')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'nova-1.ts'), (2, 'nova-2.mp4'), (3, 'news.ts')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem.WriteFile("nova-1.ts", []byte("0123456789"))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/dlna/device.xml", app.serveDLNADevice).Methods("GET")
+	r.HandleFunc("/dlna/control/ContentDirectory", app.serveContentDirectory).Methods("POST")
+	r.HandleFunc("/dlna/media/{id}", app.serveDLNAMedia).Methods("GET", "HEAD")
+	call := func(method, url, action, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Host = "dvr.lan:8080"
+		if action != "" {
+			req.Header.Set("SOAPACTION", `"`+upnpContentDirectory+"#"+action+`"`)
+		}
+		req.Header.Set("getcontentFeatures.dlna.org", "1")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := call("GET", "/dlna/device.xml", "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("device.xml with DLNA off: %d", rr.Code)
+	}
+
+	app.config.DLNA = &pkgcfg.DLNA{UUID: "0a1b2c3d-0000-0000-0000-000000000000", FriendlyName: "Den DVR"}
+	dev := call("GET", "/dlna/device.xml", "", "").Body.String()
+	for _, want := range []string{"<UDN>uuid:0a1b2c3d-0000-0000-0000-000000000000</UDN>", "<friendlyName>Den DVR</friendlyName>",
+		"<controlURL>http://dvr.lan:8080/dlna/control/ContentDirectory</controlURL>"} {
+		if !strings.Contains(dev, want) {
+			t.Errorf("device.xml lacks %s:\n%s", want, dev)
+		}
+	}
+
+	browse := func(id, flag string, start, count int) string {
+		rr := call("POST", "/dlna/control/ContentDirectory", "Browse", `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:Browse xmlns:u="`+upnpContentDirectory+`">
+<ObjectID>`+id+`</ObjectID><BrowseFlag>`+flag+`</BrowseFlag><Filter>*</Filter>
+<StartingIndex>`+strconv.Itoa(start)+`</StartingIndex><RequestedCount>`+strconv.Itoa(count)+`</RequestedCount><SortCriteria></SortCriteria>
+</u:Browse></s:Body></s:Envelope>`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Browse %s %s: %d %s", id, flag, rr.Code, rr.Body)
+		}
+		return rr.Body.String()
+	}
+	root := browse("0", "BrowseDirectChildren", 0, 0)
+	nova := "s:" + seriesID("Nova")
+	if !strings.Contains(root, "&lt;container id=&#34;"+nova+"&#34;") || !strings.Contains(root, "<TotalMatches>2</TotalMatches>") ||
+		!strings.Contains(root, "News &amp;amp; Weather") {
+		t.Errorf("root:\n%s", root)
+	}
+	if page := browse("0", "BrowseDirectChildren", 1, 1); !strings.Contains(page, "<NumberReturned>1</NumberReturned>") ||
+		strings.Contains(page, nova) {
+		t.Errorf("second page of root:\n%s", page)
+	}
+	items := browse(nova, "BrowseDirectChildren", 0, 0)
+	if !strings.Contains(items, "<TotalMatches>2</TotalMatches>") || !strings.Contains(items, "http://dvr.lan:8080/dlna/media/1") ||
+		!strings.Contains(items, "http-get:*:video/mp4:") || !strings.Contains(items, "object.item.videoItem") {
+		t.Errorf("series:\n%s", items)
+	}
+	if item := browse("r:1", "BrowseMetadata", 0, 0); !strings.Contains(item, "<TotalMatches>1</TotalMatches>") {
+		t.Errorf("item metadata:\n%s", item)
+	}
+	unknown := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:Browse>
+<ObjectID>s:nope</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag></u:Browse></s:Body></s:Envelope>`
+	if rr := call("POST", "/dlna/control/ContentDirectory", "Browse", unknown); rr.Code != http.StatusInternalServerError ||
+		!strings.Contains(rr.Body.String(), "<errorCode>701</errorCode>") {
+		t.Errorf("unknown object: %d %s", rr.Code, rr.Body)
+	}
+	if rr := call("POST", "/dlna/control/ContentDirectory", "Search", ""); !strings.Contains(rr.Body.String(), "<errorCode>401</errorCode>") {
+		t.Errorf("unknown action: %s", rr.Body)
+	}
+
+	rr := call("GET", "/dlna/media/1", "", "")
+	body, _ := io.ReadAll(rr.Body)
+	if rr.Code != http.StatusOK || string(body) != "0123456789" || rr.Header().Get("transferMode.dlna.org") != "Streaming" ||
+		rr.Header().Get("contentFeatures.dlna.org") != dlnaContentFeatures {
+		t.Errorf("media %d %q %v", rr.Code, body, rr.Header())
+	}
+}
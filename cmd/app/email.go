@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// emailDefaultEvents are what an email provider sends unless configured
+// otherwise: the things worth knowing about while away from the server.
+var emailDefaultEvents = []string{eventRecordingFailed, eventDiskLow}
+
+// sendMailFunc has the signature of smtp.SendMail.
+type sendMailFunc func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// emailNotifier sends notifications as plain-text mail.
+type emailNotifier struct {
+	cfg  pkgcfg.Email
+	send sendMailFunc
+}
+
+func newEmailNotifier(cfg pkgcfg.Email) *emailNotifier {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	n := &emailNotifier{cfg: cfg, send: smtp.SendMail}
+	if cfg.TLS {
+		n.send = sendMailTLS
+	}
+	return n
+}
+
+func (e *emailNotifier) name() string { return "email" }
+
+// emailMessage renders n as an RFC 5322 message.
+func emailMessage(from string, to []string, n Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[DVR] "+n.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(n.Message + "\r\n")
+	if r := n.Recording; r != nil {
+		b.WriteString("\r\n")
+		fmt.Fprintf(&b, "Recording: %d\r\n", r.ID)
+		if r.ChannelID != "" {
+			fmt.Fprintf(&b, "Channel:   %s\r\n", strings.TrimSpace(r.ChannelID+" "+r.ChannelName))
+			fmt.Fprintf(&b, "Scheduled: %s %s\r\n", r.Date, r.StartTime)
+			fmt.Fprintf(&b, "Status:    %s\r\n", r.Status)
+		}
+	}
+	return b.Bytes()
+}
+
+func (e *emailNotifier) notify(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+	}
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	done := make(chan error, 1)
+	go func() {
+		done <- e.send(addr, auth, e.cfg.From, e.cfg.To, emailMessage(e.cfg.From, e.cfg.To, n))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendMailTLS is smtp.SendMail over a connection that starts with TLS.
+func sendMailTLS(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close() //nolint: errcheck
+		return err
+	}
+	defer c.Close() //nolint: errcheck
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestEmailNotifier(t *testing.T) {
+	entries := newNotifiers(pkgcfg.Notifications{Email: &pkgcfg.Email{
+		Host: "smtp.example.com", Username: "dvr", Password: "pw", From: "dvr@example.com", To: []string{"me@example.com", "you@example.com"},
+	}})
+	if len(entries) != 1 || !entries[0].wants(eventDiskLow) || entries[0].wants(eventRecordingCompleted) {
+		t.Fatalf("entries %+v", entries)
+	}
+
+	var addr string
+	var rcpts []string
+	var msg string
+	e := entries[0].notifier.(*emailNotifier)
+	e.send = func(a string, auth smtp.Auth, from string, to []string, m []byte) error {
+		addr, rcpts, msg = a, to, string(m)
+		if auth == nil {
+			t.Error("no SMTP auth with a username set")
+		}
+		return nil
+	}
+
+	n := Notification{
+		Event: eventRecordingFailed, Time: time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC),
+		Subject: "Recording failed", Message: "Could not record News",
+		Recording: &NotificationRecording{ID: 4, ChannelID: "5.1", ChannelName: "KPIX", Date: "2026-03-01", StartTime: "20:00", Status: "failed"},
+	}
+	if err := e.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if addr != "smtp.example.com:587" || len(rcpts) != 2 {
+		t.Errorf("sent to %s %v", addr, rcpts)
+	}
+	for _, want := range []string{
+		"To: me@example.com, you@example.com\r\n", "Subject: [DVR] Recording failed\r\n",
+		"\r\n\r\nCould not record News\r\n", "Channel:   5.1 KPIX\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
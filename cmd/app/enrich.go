@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const (
+	tmdbBaseURL      = "https://api.themoviedb.org/3"
+	tmdbImageBaseURL = "https://image.tmdb.org/t/p/original"
+	tvdbBaseURL      = "https://api4.thetvdb.com/v4"
+)
+
+// metadataProvider matches guide metadata to an entry in an online
+// database. lookup returns nil when nothing matches.
+type metadataProvider interface {
+	name() string
+	lookup(ctx context.Context, md types.RecordingMetadata) (*types.Enrichment, error)
+}
+
+// newMetadataProviders returns a provider for each configured API key.
+func newMetadataProviders(cfg pkgcfg.Metadata) []metadataProvider {
+	client := &http.Client{Timeout: 15 * time.Second}
+	var providers []metadataProvider
+	if cfg.TMDBAPIKey != "" {
+		providers = append(providers, &tmdbProvider{baseURL: tmdbBaseURL, apiKey: cfg.TMDBAPIKey, client: client})
+	}
+	if cfg.TVDBAPIKey != "" {
+		providers = append(providers, &tvdbProvider{baseURL: tvdbBaseURL, apiKey: cfg.TVDBAPIKey, client: client})
+	}
+	return providers
+}
+
+func isMovie(md types.RecordingMetadata) bool {
+	return strings.EqualFold(md.Category, "movie")
+}
+
+// getJSON sends req and decodes a successful JSON response into out.
+func getJSON(client *http.Client, req *http.Request, out interface{}) error {
+	req.Header.Set("User-Agent", "hdhr-dvr")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// yearOf returns the year of a YYYY-MM-DD date, or 0.
+func yearOf(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(date[:4])
+	return year
+}
+
+// tmdbProvider looks titles up in The Movie Database.
+type tmdbProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func (p *tmdbProvider) name() string { return "tmdb" }
+
+func (p *tmdbProvider) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api_key", p.apiKey)
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return getJSON(p.client, req, out)
+}
+
+func (p *tmdbProvider) lookup(ctx context.Context, md types.RecordingMetadata) (*types.Enrichment, error) {
+	var search struct {
+		Results []struct {
+			ID           int    `json:"id"`
+			Title        string `json:"title"`
+			Name         string `json:"name"`
+			Overview     string `json:"overview"`
+			ReleaseDate  string `json:"release_date"`
+			FirstAirDate string `json:"first_air_date"`
+			PosterPath   string `json:"poster_path"`
+			BackdropPath string `json:"backdrop_path"`
+		} `json:"results"`
+	}
+	query := url.Values{"query": {md.Title}}
+	path := "/search/tv"
+	if isMovie(md) {
+		path = "/search/movie"
+		if md.Year > 0 {
+			query.Set("year", strconv.Itoa(md.Year))
+		}
+	}
+	if err := p.get(ctx, path, query, &search); err != nil {
+		return nil, err
+	}
+	if len(search.Results) == 0 {
+		return nil, nil
+	}
+	// Prefer an exact title match over TMDB's popularity order.
+	best := search.Results[0]
+	for _, r := range search.Results {
+		if strings.EqualFold(r.Title+r.Name, md.Title) {
+			best = r
+			break
+		}
+	}
+	e := &types.Enrichment{
+		Provider:   p.name(),
+		SeriesID:   strconv.Itoa(best.ID),
+		SeriesName: best.Title + best.Name,
+		Synopsis:   best.Overview,
+		Year:       yearOf(best.ReleaseDate + best.FirstAirDate),
+	}
+	if best.PosterPath != "" {
+		e.ImageURL = tmdbImageBaseURL + best.PosterPath
+	}
+	if best.BackdropPath != "" {
+		e.FanartURL = tmdbImageBaseURL + best.BackdropPath
+	}
+	if isMovie(md) || md.Season <= 0 || md.Episode <= 0 {
+		return e, nil
+	}
+
+	var episode struct {
+		ID       int    `json:"id"`
+		Overview string `json:"overview"`
+	}
+	if err := p.get(ctx, fmt.Sprintf("/tv/%d/season/%d/episode/%d", best.ID, md.Season, md.Episode), nil, &episode); err != nil {
+		slog.Info("TMDB: no such episode", "series", e.SeriesName, "season", md.Season, "episode", md.Episode, "err", err)
+		return e, nil
+	}
+	e.EpisodeID = strconv.Itoa(episode.ID)
+	if episode.Overview != "" {
+		e.Synopsis = episode.Overview
+	}
+	return e, nil
+}
+
+// tvdbProvider looks titles up in TheTVDB. Its v4 API exchanges the API
+// key for a bearer token, which is kept until it is rejected.
+type tvdbProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+func (p *tvdbProvider) name() string { return "tvdb" }
+
+func (p *tvdbProvider) login(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" {
+		return p.token, nil
+	}
+	body, _ := json.Marshal(map[string]string{"apikey": p.apiKey})
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/login", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var resp struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := getJSON(p.client, req, &resp); err != nil {
+		return "", fmt.Errorf("logging in to TVDB: %w", err)
+	}
+	p.token = resp.Data.Token
+	return p.token, nil
+}
+
+func (p *tvdbProvider) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	token, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	err = getJSON(p.client, req, out)
+	if err != nil && strings.Contains(err.Error(), "401") {
+		p.mu.Lock()
+		p.token = ""
+		p.mu.Unlock()
+	}
+	return err
+}
+
+func (p *tvdbProvider) lookup(ctx context.Context, md types.RecordingMetadata) (*types.Enrichment, error) {
+	query := url.Values{"query": {md.Title}, "type": {"series"}}
+	if isMovie(md) {
+		query.Set("type", "movie")
+		if md.Year > 0 {
+			query.Set("year", strconv.Itoa(md.Year))
+		}
+	}
+	var search struct {
+		Data []struct {
+			TVDBID   string `json:"tvdb_id"`
+			Name     string `json:"name"`
+			Overview string `json:"overview"`
+			Year     string `json:"year"`
+			ImageURL string `json:"image_url"`
+		} `json:"data"`
+	}
+	if err := p.get(ctx, "/search", query, &search); err != nil {
+		return nil, err
+	}
+	if len(search.Data) == 0 {
+		return nil, nil
+	}
+	best := search.Data[0]
+	for _, r := range search.Data {
+		if strings.EqualFold(r.Name, md.Title) {
+			best = r
+			break
+		}
+	}
+	year, _ := strconv.Atoi(best.Year)
+	e := &types.Enrichment{
+		Provider:   p.name(),
+		SeriesID:   best.TVDBID,
+		SeriesName: best.Name,
+		Synopsis:   best.Overview,
+		Year:       year,
+		ImageURL:   best.ImageURL,
+	}
+	if isMovie(md) || md.Season <= 0 || md.Episode <= 0 {
+		return e, nil
+	}
+
+	var episodes struct {
+		Data struct {
+			Episodes []struct {
+				ID       int    `json:"id"`
+				Overview string `json:"overview"`
+			} `json:"episodes"`
+		} `json:"data"`
+	}
+	path := "/series/" + url.PathEscape(best.TVDBID) + "/episodes/default"
+	epQuery := url.Values{"season": {strconv.Itoa(md.Season)}, "episodeNumber": {strconv.Itoa(md.Episode)}}
+	if err := p.get(ctx, path, epQuery, &episodes); err != nil {
+		slog.Info("TVDB: no such episode", "series", e.SeriesName, "season", md.Season, "episode", md.Episode, "err", err)
+		return e, nil
+	}
+	if len(episodes.Data.Episodes) > 0 {
+		ep := episodes.Data.Episodes[0]
+		e.EpisodeID = strconv.Itoa(ep.ID)
+		if ep.Overview != "" {
+			e.Synopsis = ep.Overview
+		}
+	}
+	return e, nil
+}
+
+// enrichRecording matches a recording's guide metadata with the configured
+// providers, in order, and stores the first match. It returns nil if the
+// recording has no metadata or nothing matched.
+func (a *App) enrichRecording(ctx context.Context, id int) (*types.Enrichment, error) {
+	md, err := a.loadRecordingMetadata(ctx, id)
+	if err == sql.ErrNoRows || (err == nil && md.Title == "") {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, p := range a.metadataProviders {
+		e, err := p.lookup(ctx, md)
+		if err != nil {
+			slog.Error("Error looking up metadata", "title", md.Title, "provider", p.name(), "err", err)
+			lastErr = err
+			continue
+		}
+		if e == nil {
+			continue
+		}
+		_, err = a.dbExecContext(ctx, `
+			INSERT OR REPLACE INTO recording_enrichment
+				(recording_id, provider, series_id, series_name, episode_id, synopsis, year, image_url, fanart_url)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, e.Provider, e.SeriesID, e.SeriesName, e.EpisodeID, e.Synopsis, e.Year, e.ImageURL, e.FanartURL)
+		return e, err
+	}
+	return nil, lastErr
+}
+
+// loadEnrichment returns the stored match for a recording, or nil.
+func (a *App) loadEnrichment(ctx context.Context, id int) (*types.Enrichment, error) {
+	var e types.Enrichment
+	err := a.dbQueryRowContext(ctx, `
+		SELECT provider, series_id, series_name, episode_id, synopsis, year, image_url, fanart_url
+		FROM recording_enrichment WHERE recording_id = ?`, id).Scan(
+		&e.Provider, &e.SeriesID, &e.SeriesName, &e.EpisodeID, &e.Synopsis, &e.Year, &e.ImageURL, &e.FanartURL)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// enrichRecordingHandler looks a recording up again and returns the match.
+func (a *App) enrichRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	if len(a.metadataProviders) == 0 {
+		http.Error(w, "No metadata provider configured", http.StatusServiceUnavailable)
+		return
+	}
+	e, err := a.enrichRecording(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if e == nil {
+		http.Error(w, "No match found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e) //nolint: errcheck
+}
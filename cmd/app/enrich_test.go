@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func newTMDBTestServer(t *testing.T) *httptest.Server {
+	m := http.NewServeMux()
+	m.HandleFunc("/search/tv", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != "tmdb-key" || r.URL.Query().Get("query") != "The Office" {
+			t.Errorf("unexpected search %s", r.URL)
+		}
+		w.Write([]byte(`{"results":[
+			{"id":1,"name":"The Office Hours","overview":"Wrong show","first_air_date":"2019-01-01"},
+			{"id":2316,"name":"The Office","overview":"A mockumentary.","first_air_date":"2005-03-24","poster_path":"/office.jpg"}]}`)) //nolint: errcheck
+	})
+	m.HandleFunc("/tv/2316/season/2/episode/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":62345,"overview":"Michael hosts the Dundies."}`)) //nolint: errcheck
+	})
+	m.HandleFunc("/search/movie", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("year") != "1994" {
+			t.Errorf("movie search without year: %s", r.URL)
+		}
+		w.Write([]byte(`{"results":[{"id":13,"title":"Forrest Gump","overview":"Life is like a box of chocolates.","release_date":"1994-06-23"}]}`)) //nolint: errcheck
+	})
+	return httptest.NewServer(m)
+}
+
+func TestTMDBLookup(t *testing.T) {
+	srv := newTMDBTestServer(t)
+	defer srv.Close()
+	p := &tmdbProvider{baseURL: srv.URL, apiKey: "tmdb-key", client: srv.Client()}
+
+	e, err := p.lookup(context.Background(), types.RecordingMetadata{Title: "The Office", Season: 2, Episode: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.Enrichment{Provider: "tmdb", SeriesID: "2316", SeriesName: "The Office", EpisodeID: "62345",
+		Synopsis: "Michael hosts the Dundies.", Year: 2005, ImageURL: tmdbImageBaseURL + "/office.jpg"}
+	if e == nil || *e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+
+	e, err = p.lookup(context.Background(), types.RecordingMetadata{Title: "Forrest Gump", Category: "movie", Year: 1994})
+	if err != nil || e == nil || e.SeriesID != "13" || e.EpisodeID != "" || e.Year != 1994 {
+		t.Errorf("movie: %+v (%v)", e, err)
+	}
+}
+
+func TestTVDBLookup(t *testing.T) {
+	logins := 0
+	m := http.NewServeMux()
+	m.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		w.Write([]byte(`{"data":{"token":"tok"}}`)) //nolint: errcheck
+	})
+	m.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" || r.URL.Query().Get("type") != "series" {
+			t.Errorf("unexpected search %s %v", r.URL, r.Header)
+		}
+		w.Write([]byte(`{"data":[{"tvdb_id":"73244","name":"The Office","overview":"US version.","year":"2005","image_url":"https://artworks.thetvdb.com/office.jpg"}]}`)) //nolint: errcheck
+	})
+	m.HandleFunc("/series/73244/episodes/default", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("season") != "2" || r.URL.Query().Get("episodeNumber") != "1" {
+			t.Errorf("unexpected episode query %s", r.URL)
+		}
+		w.Write([]byte(`{"data":{"episodes":[{"id":330000,"overview":"The Dundies."}]}}`)) //nolint: errcheck
+	})
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	p := &tvdbProvider{baseURL: srv.URL, apiKey: "tvdb-key", client: srv.Client()}
+	for i := 0; i < 2; i++ {
+		e, err := p.lookup(context.Background(), types.RecordingMetadata{Title: "The Office", Season: 2, Episode: 1})
+		if err != nil || e == nil || e.SeriesID != "73244" || e.EpisodeID != "330000" || e.Synopsis != "The Dundies." || e.Year != 2005 {
+			t.Errorf("got %+v (%v)", e, err)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("logged in %d times, want the token reused", logins)
+	}
+}
+
+func TestEnrichRecording(t *testing.T) {
+	srv := newTMDBTestServer(t)
+	defer srv.Close()
+
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/enrich", app.enrichRecordingHandler).Methods("POST")
+	r.HandleFunc("/api/recordings/{id}/metadata", app.getRecordingMetadata).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recordings/1/enrich", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("without providers: got %d", rr.Code)
+	}
+
+	app.metadataProviders = []metadataProvider{&tmdbProvider{baseURL: srv.URL, apiKey: "tmdb-key", client: srv.Client()}}
+	if err := app.saveRecordingMetadata(ctx, 1, types.Program{Title: "The Office", Season: 2, Episode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recordings/1/enrich", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enrich: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/metadata", nil))
+	var md types.RecordingMetadata
+	if err := json.NewDecoder(rr.Body).Decode(&md); err != nil {
+		t.Fatal(err)
+	}
+	if md.Enrichment == nil || md.Enrichment.EpisodeID != "62345" || md.Enrichment.Synopsis != "Michael hosts the Dundies." {
+		t.Errorf("metadata %+v", md.Enrichment)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recordings/2/enrich", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("recording without metadata: got %d", rr.Code)
+	}
+
+	// Series naming uses the canonical name from the match.
+	app.config.Organize = organizeSeries
+	if err := app.saveRecordingMetadata(ctx, 3, types.Program{Title: "Office, The", Season: 2, Episode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recording_enrichment (recording_id, provider, series_id, series_name) VALUES (3, 'tmdb', '2316', 'The Office')"); err != nil {
+		t.Fatal(err)
+	}
+	name, err := app.assignFileName(ctx, storage.NewMemory(), types.Recording{ID: 3, ChannelID: "5.1", Date: "2026-03-01", StartTime: "20:00"}, types.Channel{})
+	if err != nil || name != "The Office/Season 02/The Office - S02E01.ts" {
+		t.Errorf("series name %q (%v)", name, err)
+	}
+}
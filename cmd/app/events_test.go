@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestStreamEvents(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	srv := httptest.NewServer(http.HandlerFunc(app.streamEvents))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	// The handler subscribes before sending headers, so the event is not lost.
+	app.events.publish("guide.updated", map[string]int{"added": 1})
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "event: guide.updated\n" {
+		t.Errorf("got %q", line)
+	}
+	line, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"added":1`) {
+		t.Errorf("got %q", line)
+	}
+}
+
+func TestStreamEventsKeepAlive(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	old := sseKeepAlive
+	sseKeepAlive = 10 * time.Millisecond
+	defer func() { sseKeepAlive = old }()
+
+	srv := httptest.NewServer(http.HandlerFunc(app.streamEvents))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != ": keep-alive\n" {
+		t.Errorf("got %q, %v", line, err)
+	}
+}
+
+func TestStoreChannelsPublishesChanges(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+	changed := func() bool {
+		for {
+			select {
+			case e := <-events:
+				if e.Type == "channels.changed" {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}
+
+	lineup := []types.Channel{{GuideNumber: "2.1", GuideName: "KTVU", URL: "http://tuner/auto/v2.1"}}
+	app.storeChannels(lineup)
+	if !changed() {
+		t.Error("no channels.changed for a new lineup")
+	}
+	app.storeChannels(lineup)
+	if changed() {
+		t.Error("channels.changed for an unchanged lineup")
+	}
+	lineup[0].GuideName = "FOX"
+	app.storeChannels(lineup)
+	if !changed() {
+		t.Error("no channels.changed after a rename")
+	}
+}
+
+func TestRecordingProgress(t *testing.T) {
+	mem := storage.NewMemory()
+	mem.WriteFile("news.ts", make([]byte, 1000))
+	p := recordingProgress(mem, 3, "news.ts", time.Now().Add(-90*time.Second), 600)
+	if p["id"] != 3 || p["bytes"] != int64(1000) || p["elapsedSeconds"] != 90 || p["percent"] != 15.0 {
+		t.Errorf("progress %v", p)
+	}
+	if p := recordingProgress(mem, 3, "news.ts", time.Now().Add(-time.Hour), 600); p["percent"] != 100.0 {
+		t.Errorf("percent past the end %v", p["percent"])
+	}
+}
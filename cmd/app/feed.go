@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// The finished recordings are also an RSS feed with each file as the
+// enclosure, so podcast apps download new recordings as they appear.
+
+// feedLimit is how many recordings the feed lists unless told otherwise.
+const feedLimit = 50
+
+// RSS is an RSS 2.0 feed with the iTunes podcast extension.
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is the feed itself.
+type RSSChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []RSSItem `xml:"item"`
+}
+
+// RSSItem is one recording of the feed.
+type RSSItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description,omitempty"`
+	PubDate     string       `xml:"pubDate"`
+	GUID        RSSGUID      `xml:"guid"`
+	Enclosure   RSSEnclosure `xml:"enclosure"`
+	Duration    string       `xml:"itunes:duration"`
+	Episode     string       `xml:"itunes:episode,omitempty"`
+	Season      string       `xml:"itunes:season,omitempty"`
+}
+
+// RSSGUID identifies an item across fetches of the feed.
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSSEnclosure is the file an item links to.
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// serveRecordingsFeed serves GET /api/v1/recordings.rss: the finished
+// recordings, newest first. ?keyword= (a keyword's ID or name) keeps those
+// the keyword would have recorded, ?category= those in a guide category,
+// ?channel= those of a channel, and ?limit= sets how many are listed.
+func (a *App) serveRecordingsFeed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := feedLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	title := "Recordings"
+	var keyword *types.Keyword
+	if v := q.Get("keyword"); v != "" {
+		var k types.Keyword
+		err := a.dbQueryRowContext(r.Context(), "SELECT name, COALESCE(category, '') FROM keywords WHERE CAST(id AS TEXT) = ? OR name = ?", v, v).
+			Scan(&k.Name, &k.Category)
+		if err != nil {
+			http.Error(w, "Keyword not found", http.StatusNotFound)
+			return
+		}
+		keyword = &k
+		title += ": " + k.Name
+	}
+	category, channel := q.Get("category"), q.Get("channel")
+	if category != "" {
+		title += ": " + category
+	}
+	if channel != "" {
+		title += ": " + channel
+	}
+
+	base := a.deviceBaseURL(r, "")
+	episodes, err := a.recordedEpisodes(r.Context(), r, base)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	feed := RSS{Version: "2.0", ITunes: "http://www.itunes.com/dtds/podcast-1.0.dtd", Channel: RSSChannel{
+		Title:       title,
+		Link:        base + "/",
+		Description: "Finished recordings of hdhr-dvr",
+		Items:       []RSSItem{},
+	}}
+	for _, e := range episodes {
+		if len(feed.Channel.Items) == limit {
+			break
+		}
+		if channel != "" && e.ChannelNumber != channel {
+			continue
+		}
+		if category != "" && !strings.EqualFold(e.category, category) {
+			continue
+		}
+		if keyword != nil && !keywordMatches(*keyword, e.Title+" "+e.EpisodeTitle, e.category) {
+			continue
+		}
+		item := RSSItem{
+			Title:       e.Title,
+			Description: e.Synopsis,
+			PubDate:     time.Unix(e.EndTime, 0).UTC().Format(time.RFC1123Z),
+			GUID:        RSSGUID{Value: "hdhr-dvr-recording-" + strconv.Itoa(e.id)},
+			Enclosure: RSSEnclosure{
+				URL:    fmt.Sprintf("%s%s/recordings/%d/file", base, apiPrefix, e.id),
+				Length: e.size,
+				Type:   recordingMIMEType(e.Filename),
+			},
+			Duration: strconv.FormatInt(e.EndTime-e.StartTime, 10),
+		}
+		if e.EpisodeTitle != "" {
+			item.Title += " - " + e.EpisodeTitle
+		}
+		var season, episode int
+		if _, err := fmt.Sscanf(e.EpisodeNumber, "S%dE%d", &season, &episode); err == nil {
+			item.Season, item.Episode = strconv.Itoa(season), strconv.Itoa(episode)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header)) //nolint: errcheck
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		requestLogger(r).Error("Error encoding recordings feed", "err", err)
+	}
+}
+
+// keywordMatches reports whether a program titled title in category is
+// one k records, matching as auto-record does: the keyword anywhere in the
+// title and subtitle, and its category, if set, the program's.
+func keywordMatches(k types.Keyword, title, category string) bool {
+	if !strings.Contains(strings.ToLower(title), strings.ToLower(k.Name)) {
+		return false
+	}
+	return k.Category == "" || strings.EqualFold(k.Category, category)
+}
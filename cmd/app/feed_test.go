@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRecordingsFeed(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('7.1', 'KGO', 'http://tuner/auto/v7.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title, file_size) VALUES (1, '5.1', '2026-03-01', '18:00', 30, 'completed', 'Evening News', 1000)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title, file_size) VALUES (2, '7.1', '2026-03-02', '18:00', 30, 'completed', 'ABC7 News', 2000)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title, file_size) VALUES (3, '5.1', '2026-03-03', '20:00', 60, 'completed', 'Nova', 3000)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (4, '5.1', '2026-03-04', '18:00', 30, 'failed', 'Evening News')",
+		"INSERT INTO recording_metadata (recording_id, title, subtitle, category, season, episode) VALUES (3, 'Nova', 'Black Holes', 'Science', 51, 3)",
+		"INSERT INTO recording_metadata (recording_id, title, category) VALUES (1, 'Evening News', 'News'), (2, 'ABC7 News', 'News')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'news-1.ts'), (2, 'news-2.ts'), (3, 'nova.mp4')",
+		"INSERT INTO keywords (id, name, category) VALUES (1, 'news', 'News')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/recordings.rss", app.serveRecordingsFeed).Methods("GET")
+	feed := func(query string) (RSS, string, int) {
+		req := httptest.NewRequest("GET", "/api/v1/recordings.rss"+query, nil)
+		req.Host = "dvr.lan:8080"
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		body := rr.Body.String()
+		var rss RSS
+		if rr.Code == http.StatusOK {
+			if err := xml.Unmarshal([]byte(body), &rss); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rss, body, rr.Code
+	}
+
+	all, body, _ := feed("")
+	items := all.Channel.Items
+	if len(items) != 3 || items[0].Title != "Nova - Black Holes" {
+		t.Fatalf("feed %+v", items)
+	}
+	// The decoder leaves the itunes: elements, so they are checked as text.
+	for _, want := range []string{"<itunes:duration>3600</itunes:duration>", "<itunes:season>51</itunes:season>", "<itunes:episode>3</itunes:episode>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed lacks %s:\n%s", want, body)
+		}
+	}
+	if e := items[0].Enclosure; e.URL != "http://dvr.lan:8080/api/v1/recordings/3/file" || e.Length != 3000 || e.Type != "video/mp4" {
+		t.Errorf("enclosure %+v", e)
+	}
+	if items[0].GUID.Value != "hdhr-dvr-recording-3" {
+		t.Errorf("item %+v", items[0])
+	}
+
+	for query, want := range map[string]int{"?keyword=1": 2, "?keyword=news": 2, "?category=science": 1, "?channel=7.1": 1, "?keyword=1&channel=5.1": 1, "?limit=1": 1} {
+		if got, _, code := feed(query); code != http.StatusOK || len(got.Channel.Items) != want {
+			t.Errorf("feed%s: %d, %d items, want %d", query, code, len(got.Channel.Items), want)
+		}
+	}
+	if _, _, code := feed("?keyword=99"); code != http.StatusNotFound {
+		t.Errorf("unknown keyword: %d", code)
+	}
+	if _, _, code := feed("?limit=0"); code != http.StatusBadRequest {
+		t.Errorf("zero limit: %d", code)
+	}
+}
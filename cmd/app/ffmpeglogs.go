@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// logTailInterval is how often a followed ffmpeg log is checked for output.
+var logTailInterval = 500 * time.Millisecond
+
+// ffmpegLogPath is where the ffmpeg output of a recording is kept.
+func (a *App) ffmpegLogPath(id int) string {
+	return filepath.Join(a.cfg().FFmpegLogDir, fmt.Sprintf("recording-%d.log", id))
+}
+
+// createFFmpegLog creates the log of a recording's capture, replacing the
+// one of an earlier attempt.
+func (a *App) createFFmpegLog(id int) (string, *os.File, error) {
+	if err := a.commander.MkdirAll(a.cfg().FFmpegLogDir, 0o755); err != nil {
+		return "", nil, err
+	}
+	name := a.ffmpegLogPath(id)
+	f, err := a.commander.Create(name)
+	return name, f, err
+}
+
+// purgeFFmpegLogs deletes logs not written to for FFmpegLogRetentionDays,
+// except those of captures still running, and returns how many it deleted.
+func (a *App) purgeFFmpegLogs(now time.Time) int {
+	cfg := a.cfg()
+	entries, err := os.ReadDir(cfg.FFmpegLogDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Error listing ffmpeg logs", "dir", cfg.FFmpegLogDir, "err", err)
+		}
+		return 0
+	}
+	cutoff := now.AddDate(0, 0, -cfg.FFmpegLogRetentionDays)
+	deleted := 0
+	for _, e := range entries {
+		var id int
+		if _, err := fmt.Sscanf(e.Name(), "recording-%d.log", &id); err != nil || e.IsDir() {
+			continue
+		}
+		if _, running := a.runningProcesses.Load(id); running {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cfg.FFmpegLogDir, e.Name())); err != nil {
+			slog.Error("Error deleting ffmpeg log", "recording_id", id, "err", err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		slog.Info("Deleted old ffmpeg logs", "count", deleted, "days", cfg.FFmpegLogRetentionDays)
+	}
+	return deleted
+}
+
+// getRecordingLog returns the ffmpeg output of a recording as text. With
+// ?follow=true it is sent as Server-Sent Events instead, one event per
+// line, and followed while the capture runs; an "end" event closes it.
+func (a *App) getRecordingLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	f, err := a.commander.Open(a.ffmpegLogPath(id))
+	if os.IsNotExist(err) {
+		http.Error(w, "No log for this recording", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close() //nolint: errcheck
+
+	if follow, _ := strconv.ParseBool(r.URL.Query().Get("follow")); !follow {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.Copy(w, f) //nolint: errcheck
+		return
+	}
+
+	noWriteTimeout(w)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// ffmpeg ends its progress lines with \r, so both end a line here.
+	var pending []byte
+	buf := make([]byte, 32<<10)
+	ticker := time.NewTicker(logTailInterval)
+	defer ticker.Stop()
+	for {
+		_, running := a.runningProcesses.Load(id)
+		n, err := f.Read(buf)
+		if err != nil && err != io.EOF {
+			requestLogger(r).Error("Error reading ffmpeg log", "recording_id", id, "err", err)
+			return
+		}
+		pending = append(pending, buf[:n]...)
+		for {
+			i := bytes.IndexAny(pending, "\r\n")
+			if i < 0 {
+				break
+			}
+			if line := strings.TrimSpace(string(pending[:i])); line != "" {
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", line); err != nil {
+					return
+				}
+			}
+			pending = pending[i+1:]
+		}
+		flusher.Flush()
+		if n > 0 {
+			continue
+		}
+		if !running {
+			if line := strings.TrimSpace(string(pending)); line != "" {
+				fmt.Fprintf(w, "data: %s\n\n", line) //nolint: errcheck
+			}
+			io.WriteString(w, "event: end\ndata: \n\n") //nolint: errcheck
+			flusher.Flush()
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPurgeFFmpegLogs(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.FFmpegLogDir = t.TempDir()
+	app.config.FFmpegLogRetentionDays = 30
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -31)
+	for name, mtime := range map[string]time.Time{
+		"recording-1.log": old, "recording-2.log": now, "recording-3.log": old, "notes.txt": old,
+	} {
+		path := filepath.Join(app.config.FFmpegLogDir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime) //nolint: errcheck
+	}
+	app.runningProcesses.Store(3, nil)
+
+	if n := app.purgeFFmpegLogs(now); n != 1 {
+		t.Errorf("deleted %d", n)
+	}
+	for name, kept := range map[string]bool{"recording-1.log": false, "recording-2.log": true, "recording-3.log": true, "notes.txt": true} {
+		if _, err := os.Stat(filepath.Join(app.config.FFmpegLogDir, name)); (err == nil) != kept {
+			t.Errorf("%s kept=%v", name, err == nil)
+		}
+	}
+}
+
+func TestGetRecordingLog(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.FFmpegLogDir = t.TempDir()
+	app.commander.(*MockCommander).OpenFunc = os.Open
+	defer func(d time.Duration) { logTailInterval = d }(logTailInterval)
+	logTailInterval = 10 * time.Millisecond
+
+	if err := os.WriteFile(app.ffmpegLogPath(5), []byte("Input #0, mpegts\nframe=1\rframe=2\r"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/log", app.getRecordingLog).Methods("GET")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/5/log", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "Input #0") {
+		t.Errorf("got %d %q", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/6/log", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("missing log: %d", rr.Code)
+	}
+
+	// Following a running capture picks up what it writes until it ends.
+	app.runningProcesses.Store(5, nil)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f, _ := os.OpenFile(app.ffmpegLogPath(5), os.O_APPEND|os.O_WRONLY, 0)
+		f.WriteString("frame=3\nExiting normally") //nolint: errcheck
+		f.Close()                                  //nolint: errcheck
+		time.Sleep(50 * time.Millisecond)
+		app.runningProcesses.Delete(5)
+	}()
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/5/log?follow=true", nil))
+	want := "data: Input #0, mpegts\n\ndata: frame=1\n\ndata: frame=2\n\ndata: frame=3\n\ndata: Exiting normally\n\nevent: end\ndata: \n\n"
+	if rr.Body.String() != want {
+		t.Errorf("got %q", rr.Body)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+var filenamePlaceholderRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// sanitizeFilenamePart makes s safe as a single path element on common
+// filesystems and SMB shares: separators and colons become dashes, other
+// reserved and control characters are dropped, runs of spaces collapse,
+// and leading or trailing spaces and dots are trimmed.
+func sanitizeFilenamePart(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			b.WriteRune('-')
+		case strings.ContainsRune(`*?"<>|`, r) || unicode.IsControl(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Trim(strings.Join(strings.Fields(b.String()), " "), " .")
+}
+
+// renderFileName expands tmpl for a recording of r on ch and returns the
+// transport stream name relative to the storage root. Each "/"-separated
+// part of the template becomes one sanitized path element; parts that end
+// up empty are dropped. Unknown placeholders are kept as written.
+func renderFileName(tmpl string, r types.Recording, ch types.Channel) string {
+	if tmpl == "" {
+		tmpl = pkgcfg.DefaultFilenameTemplate
+	}
+	title := r.ChannelID
+	if r.Title != nil && *r.Title != "" {
+		title = *r.Title
+	}
+	channel := ch.GuideName
+	if channel == "" {
+		channel = r.ChannelID
+	}
+	values := map[string]string{
+		"title":   title,
+		"date":    r.Date,
+		"time":    r.StartTime,
+		"channel": channel,
+		"number":  r.ChannelID,
+		"id":      strconv.Itoa(r.ID),
+	}
+
+	var parts []string
+	for _, part := range strings.Split(tmpl, "/") {
+		part = filenamePlaceholderRe.ReplaceAllStringFunc(part, func(m string) string {
+			if v, ok := values[m[1:len(m)-1]]; ok {
+				return sanitizeFilenamePart(v)
+			}
+			return m
+		})
+		if part = sanitizeFilenamePart(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{sanitizeFilenamePart(title)}
+	}
+	return strings.Join(parts, "/") + ".ts"
+}
+
+// organizeSeries is the Organize mode that lays recordings out as a TV
+// library.
+const organizeSeries = "series"
+
+// renderSeriesFileName returns the transport stream name of an episode in
+// the Plex/Jellyfin TV layout. Episodes without season and episode numbers
+// are named by the date they were recorded, under a season for that year.
+func renderSeriesFileName(md types.RecordingMetadata, r types.Recording) string {
+	show := sanitizeFilenamePart(md.Title)
+	episode := sanitizeFilenamePart(md.SubTitle)
+
+	var season, base string
+	if md.Season > 0 && md.Episode > 0 {
+		season = fmt.Sprintf("Season %02d", md.Season)
+		base = fmt.Sprintf("%s - S%02dE%02d", show, md.Season, md.Episode)
+	} else {
+		year, _, _ := strings.Cut(r.Date, "-")
+		season = "Season " + sanitizeFilenamePart(year)
+		base = show + " - " + sanitizeFilenamePart(r.Date)
+	}
+	if episode != "" {
+		base += " - " + episode
+	}
+	return show + "/" + season + "/" + base + ".ts"
+}
+
+// mp4Name returns the name a transport stream has after conversion.
+func mp4Name(ts string) string {
+	return strings.TrimSuffix(ts, path.Ext(ts)) + ".mp4"
+}
+
+// fileNameTaken reports whether name, or its MP4, belongs to a recording
+// other than id, either in recording_files or as a file already on fs.
+func (a *App) fileNameTaken(ctx context.Context, fs storage.Storage, id int, name string) (bool, error) {
+	// Rows owned by other recordings sort first.
+	var owner int
+	err := a.dbQueryRowContext(ctx, "SELECT recording_id FROM recording_files WHERE path IN (?, ?) ORDER BY recording_id = ? LIMIT 1",
+		name, mp4Name(name), id).Scan(&owner)
+	switch {
+	case err == nil:
+		return owner != id, nil
+	case err != sql.ErrNoRows:
+		return false, err
+	}
+	for _, n := range []string{name, mp4Name(name)} {
+		if _, err := fs.Stat(n); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// assignFileName renders the file name for a recording about to start on
+// fs, adds the recording ID when the name is already in use, and stores it
+// in recording_files.
+func (a *App) assignFileName(ctx context.Context, fs storage.Storage, r types.Recording, ch types.Channel) (string, error) {
+	name := renderFileName(a.cfg().FilenameTemplate, r, ch)
+	if a.cfg().Organize == organizeSeries {
+		md, err := a.loadRecordingMetadata(ctx, r.ID)
+		// The matched database entry has the canonical series name.
+		if e, _ := a.loadEnrichment(ctx, r.ID); e != nil && e.SeriesName != "" {
+			md.Title = e.SeriesName
+		}
+		switch {
+		case err == nil && sanitizeFilenamePart(md.Title) != "":
+			name = renderSeriesFileName(md, r)
+		case err != nil && err != sql.ErrNoRows:
+			slog.Error("Error loading metadata to name recording", "recording_id", r.ID, "err", err)
+		}
+	}
+	taken, err := a.fileNameTaken(ctx, fs, r.ID, name)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		name = fmt.Sprintf("%s (%d).ts", strings.TrimSuffix(name, ".ts"), r.ID)
+	}
+	_, err = a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_files (recording_id, path) VALUES (?, ?)", r.ID, name)
+	return name, err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestRenderFileName(t *testing.T) {
+	title := "Law & Order: SVU"
+	rec := types.Recording{ID: 7, ChannelID: "4.1", Date: "2026-03-01", StartTime: "21:00", Title: &title}
+	ch := types.Channel{GuideNumber: "4.1", GuideName: "NBC/KNTV"}
+
+	tests := []struct {
+		tmpl string
+		rec  types.Recording
+		want string
+	}{
+		{"", rec, "2026-03-01-21-00-Law & Order- SVU.ts"},
+		{"{title} - {date} {time} - {channel}", rec, "Law & Order- SVU - 2026-03-01 21-00 - NBC-KNTV.ts"},
+		{"{title}/{date} {title}", rec, "Law & Order- SVU/2026-03-01 Law & Order- SVU.ts"},
+		{"../{title}/./{id}", rec, "Law & Order- SVU/7.ts"},
+		{"{number} {unknown}", rec, "4.1 {unknown}.ts"},
+		{"{title}", types.Recording{ChannelID: "4.1"}, "4.1.ts"},
+		{`{title} <"draft"?>`, rec, "Law & Order- SVU draft.ts"},
+	}
+	for _, tt := range tests {
+		if got := renderFileName(tt.tmpl, tt.rec, ch); got != tt.want {
+			t.Errorf("renderFileName(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestAssignFileName(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	app.config.FilenameTemplate = "{title}"
+	title := "News"
+	ch := types.Channel{GuideNumber: "5.1", GuideName: "KPIX"}
+	ctx := context.Background()
+
+	name, err := app.assignFileName(ctx, mem, types.Recording{ID: 1, ChannelID: "5.1", Title: &title}, ch)
+	if err != nil || name != "News.ts" {
+		t.Fatalf("first recording named %q (%v)", name, err)
+	}
+	// Restarting the same recording keeps its name.
+	if name, _ := app.assignFileName(ctx, mem, types.Recording{ID: 1, ChannelID: "5.1", Title: &title}, ch); name != "News.ts" {
+		t.Errorf("restarted recording named %q", name)
+	}
+	name, err = app.assignFileName(ctx, mem, types.Recording{ID: 2, ChannelID: "5.1", Title: &title}, ch)
+	if err != nil || name != "News (2).ts" {
+		t.Errorf("second recording named %q (%v)", name, err)
+	}
+
+	mem.WriteFile("Weather.mp4", []byte("someone else's"))
+	weather := "Weather"
+	if name, _ := app.assignFileName(ctx, mem, types.Recording{ID: 3, ChannelID: "5.1", Title: &weather}, ch); name != "Weather (3).ts" {
+		t.Errorf("name clashing with a file on disk = %q", name)
+	}
+
+	var stored string
+	db.QueryRow("SELECT path FROM recording_files WHERE recording_id = 2").Scan(&stored) //nolint: errcheck
+	if stored != "News (2).ts" {
+		t.Errorf("stored path %q", stored)
+	}
+}
+
+func TestRenderSeriesFileName(t *testing.T) {
+	rec := types.Recording{ID: 3, ChannelID: "5.1", Date: "2026-03-01", StartTime: "20:00"}
+	tests := []struct {
+		md   types.RecordingMetadata
+		want string
+	}{
+		{types.RecordingMetadata{Title: "The Show", SubTitle: "Pilot: Part 1", Season: 1, Episode: 3},
+			"The Show/Season 01/The Show - S01E03 - Pilot- Part 1.ts"},
+		{types.RecordingMetadata{Title: "The Show", Season: 12, Episode: 110},
+			"The Show/Season 12/The Show - S12E110.ts"},
+		{types.RecordingMetadata{Title: "Evening News"},
+			"Evening News/Season 2026/Evening News - 2026-03-01.ts"},
+	}
+	for _, tt := range tests {
+		if got := renderSeriesFileName(tt.md, rec); got != tt.want {
+			t.Errorf("renderSeriesFileName(%+v) = %q, want %q", tt.md, got, tt.want)
+		}
+	}
+}
+
+func TestAssignFileNameSeries(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	app.config.Organize = organizeSeries
+	ctx := context.Background()
+	title := "The Show"
+	ch := types.Channel{GuideNumber: "5.1", GuideName: "KPIX"}
+
+	if err := app.saveRecordingMetadata(ctx, 1, types.Program{Title: "The Show", SubTitle: "Pilot", Season: 1, Episode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	name, err := app.assignFileName(ctx, mem, types.Recording{ID: 1, ChannelID: "5.1", Date: "2026-03-01", StartTime: "20:00", Title: &title}, ch)
+	if err != nil || name != "The Show/Season 01/The Show - S01E01 - Pilot.ts" {
+		t.Errorf("with metadata: %q (%v)", name, err)
+	}
+	// Without captured metadata the filename template is used.
+	name, err = app.assignFileName(ctx, mem, types.Recording{ID: 2, ChannelID: "5.1", Date: "2026-03-02", StartTime: "20:00", Title: &title}, ch)
+	if err != nil || name != "2026-03-02-20-00-The Show.ts" {
+		t.Errorf("without metadata: %q (%v)", name, err)
+	}
+}
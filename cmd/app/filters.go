@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// Built-in filters that can be applied to a finished recording in place.
+const (
+	// filterDeinterlace runs yadif on the frames flagged as interlaced, so
+	// progressive parts of a mixed broadcast are left alone.
+	filterDeinterlace = "deinterlace"
+	// filterLoudnorm normalizes the audio to the EBU R128 target of -23 LUFS.
+	filterLoudnorm = "loudnorm"
+)
+
+// recordingFilters lists the built-in filters in the order they are applied.
+var recordingFilters = []string{filterDeinterlace, filterLoudnorm}
+
+// normalizeFilters validates filters and returns them deduplicated in the
+// order they are applied.
+func normalizeFilters(filters []string) ([]string, error) {
+	want := make(map[string]bool)
+	for _, f := range filters {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f != filterDeinterlace && f != filterLoudnorm {
+			return nil, fmt.Errorf("unknown filter %q: must be %s or %s", f, filterDeinterlace, filterLoudnorm)
+		}
+		want[f] = true
+	}
+	var out []string
+	for _, f := range recordingFilters {
+		if want[f] {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// filterJobProfile is the transcode job profile that applies filters; it
+// is "deinterlace", "loudnorm" or "deinterlace+loudnorm".
+func filterJobProfile(filters []string) string {
+	return strings.Join(filters, "+")
+}
+
+// parseFilterJobProfile returns the filters of a job profile, or nil if the
+// profile is not a filter job.
+func parseFilterJobProfile(profile string) []string {
+	filters, err := normalizeFilters(strings.Split(profile, "+"))
+	if err != nil || filterJobProfile(filters) != profile {
+		return nil
+	}
+	return filters
+}
+
+// filterArgs returns the ffmpeg arguments that apply filters to input.
+// Streams that are not filtered are copied.
+func filterArgs(filters []string, input, output string) []string {
+	args := []string{"-i", input, "-map", "0:v:0", "-map", "0:a?"}
+	video := []string{"-c:v", "copy"}
+	audio := []string{"-c:a", "copy"}
+	for _, f := range filters {
+		switch f {
+		case filterDeinterlace:
+			video = []string{"-vf", "yadif=mode=send_frame:deint=interlaced", "-c:v", "libx264", "-crf", "20"}
+		case filterLoudnorm:
+			audio = []string{"-af", "loudnorm=I=-23:LRA=7:TP=-2", "-c:a", "aac", "-b:a", "192k"}
+		}
+	}
+	args = append(append(args, video...), audio...)
+	return append(args, "-movflags", "+faststart", "-y", output)
+}
+
+// filteredName is the temporary file a filter job writes before it
+// replaces the recording.
+func filteredName(name string) string {
+	return sidecarBase(name) + ".filtered.mp4"
+}
+
+// runFilterJob applies filters to the recording file and replaces it with
+// the result.
+func (a *App) runFilterJob(ctx context.Context, rec types.Recording, filters []string) (string, error) {
+	fs := a.recordingStorage(ctx, rec.ID)
+	name := finalFileName(rec)
+	input, err := fs.LocalPath(name)
+	if err != nil {
+		return "", err
+	}
+	tmpName := filteredName(name)
+	output, err := fs.LocalPath(tmpName)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"-n", transcodeNice, "ffmpeg"}, filterArgs(filters, input, output)...)
+	if out, err := a.commander.RunWithEnv(nil, "nice", args...); err != nil {
+		_ = fs.Remove(tmpName)
+		return "", fmt.Errorf("%v: %s", err, tailOutput(out))
+	}
+	if err := fs.Rename(tmpName, name); err != nil {
+		_ = fs.Remove(tmpName)
+		return "", err
+	}
+	if err := a.recordOutput(ctx, fs, rec.ID, name); err != nil {
+		slog.Error("Error recording filtered file of recording", "recording_id", rec.ID, "err", err)
+	}
+	return name, nil
+}
+
+// loadRecordingFilters returns the filters chosen for a recording.
+func (a *App) loadRecordingFilters(ctx context.Context, id int) ([]string, error) {
+	var filters string
+	err := a.dbQueryRowContext(ctx, "SELECT filters FROM recording_filters WHERE recording_id = ?", id).Scan(&filters)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return splitFilters(filters), nil
+}
+
+// splitFilters parses the comma-separated form filters are stored in.
+func splitFilters(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// queueRecordingFilters queues a job applying the filters chosen for a
+// finished recording, if any.
+func (a *App) queueRecordingFilters(ctx context.Context, id int) error {
+	filters, err := a.loadRecordingFilters(ctx, id)
+	if err != nil || len(filters) == 0 {
+		return err
+	}
+	if _, err := a.dbExecContext(ctx, "INSERT INTO transcode_jobs (recording_id, profile, status) VALUES (?, ?, ?)",
+		id, filterJobProfile(filters), jobQueued); err != nil {
+		return err
+	}
+	a.wakeTranscodeWorkers()
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestNormalizeFilters(t *testing.T) {
+	got, err := normalizeFilters([]string{"Loudnorm", "deinterlace", "loudnorm"})
+	if err != nil || filterJobProfile(got) != "deinterlace+loudnorm" {
+		t.Errorf("got %q (%v)", got, err)
+	}
+	if _, err := normalizeFilters([]string{"denoise"}); err == nil {
+		t.Error("expected an error for an unknown filter")
+	}
+
+	for profile, want := range map[string]string{
+		"deinterlace":          "deinterlace",
+		"deinterlace+loudnorm": "deinterlace+loudnorm",
+		"loudnorm+deinterlace": "",
+		"mobile":               "",
+		"":                     "",
+	} {
+		if got := filterJobProfile(parseFilterJobProfile(profile)); got != want {
+			t.Errorf("parseFilterJobProfile(%q) = %q, want %q", profile, got, want)
+		}
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	got := strings.Join(filterArgs([]string{filterLoudnorm}, "in.mp4", "out.mp4"), " ")
+	want := "-i in.mp4 -map 0:v:0 -map 0:a? -c:v copy -af loudnorm=I=-23:LRA=7:TP=-2 -c:a aac -b:a 192k -movflags +faststart -y out.mp4"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	got = strings.Join(filterArgs([]string{filterDeinterlace}, "in.mp4", "out.mp4"), " ")
+	if !strings.Contains(got, "-vf yadif=mode=send_frame:deint=interlaced -c:v libx264") || !strings.Contains(got, "-c:a copy") {
+		t.Errorf("deinterlace args %s", got)
+	}
+}
+
+func TestRecordingFilterJob(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	if err := os.WriteFile(filepath.Join(dir, "News.mp4"), []byte("interlaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'News.mp4')",
+		"INSERT INTO recording_filters (recording_id, filters) VALUES (1, 'deinterlace,loudnorm')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ran []string
+	app.commander.(*MockCommander).RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+		ran = append([]string{name}, args...)
+		return nil, os.WriteFile(args[len(args)-1], []byte("progressive"), 0644)
+	}
+
+	if err := app.queueRecordingFilters(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !app.runNextTranscode(ctx) {
+		t.Fatal("no job queued")
+	}
+	job, err := app.loadTranscodeJob(ctx, 1)
+	if err != nil || job.Profile != "deinterlace+loudnorm" || job.Status != jobCompleted || job.Output != "News.mp4" {
+		t.Fatalf("job %+v (%v)", job, err)
+	}
+	if ran[0] != "nice" || ran[len(ran)-1] != filepath.Join(dir, "News.filtered.mp4") {
+		t.Errorf("ran %q", ran)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "News.mp4")); string(data) != "progressive" {
+		t.Errorf("recording not replaced: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "News.filtered.mp4")); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+
+	// Recordings without filters queue nothing.
+	if err := app.queueRecordingFilters(ctx, 2); err != nil || app.runNextTranscode(ctx) {
+		t.Errorf("unexpected job for recording without filters (%v)", err)
+	}
+}
+
+func TestKeywordFilters(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/api/keywords", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.createKeyword(rr, req)
+		return rr.Code
+	}
+	if code := post(`{"name":"Jeopardy","filters":["loudnorm","deinterlace"]}`); code != http.StatusCreated {
+		t.Fatalf("create keyword: %d", code)
+	}
+	if code := post(`{"name":"News","filters":["sharpen"]}`); code != http.StatusBadRequest {
+		t.Errorf("unknown filter: %d", code)
+	}
+
+	rr := httptest.NewRecorder()
+	app.getKeywords(rr, httptest.NewRequest("GET", "/api/keywords", nil))
+	var keywords []types.Keyword
+	if err := json.NewDecoder(rr.Body).Decode(&keywords); err != nil {
+		t.Fatal(err)
+	}
+	if len(keywords) != 1 || strings.Join(keywords[0].Filters, ",") != "deinterlace,loudnorm" {
+		t.Errorf("keywords %+v", keywords)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultForecastHours = 24
+	maxForecastHours     = 48
+	// defaultBytesPerMinute is used to project recording sizes when no
+	// completed recordings exist yet (~6 GB/hour, typical for ATSC HD).
+	defaultBytesPerMinute = 100 * 1024 * 1024
+)
+
+// ForecastRecording is one scheduled recording as it is expected to run.
+type ForecastRecording struct {
+	ID             int      `json:"id"`
+	ChannelID      string   `json:"channelId"`
+	ChannelName    string   `json:"channelName,omitempty"`
+	Title          *string  `json:"title,omitempty"`
+	Start          string   `json:"start"`
+	End            string   `json:"end"`
+	Tuner          int      `json:"tuner"` // -1 when no tuner is free
+	ProjectedBytes int64    `json:"projectedBytes"`
+	Problems       []string `json:"problems,omitempty"`
+}
+
+// ForecastLock is one occurrence of a channel lock and the tuner it holds.
+type ForecastLock struct {
+	LockID    int    `json:"lockId"`
+	ChannelID string `json:"channelId"`
+	Name      string `json:"name,omitempty"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Tuner     int    `json:"tuner"` // -1 when every tuner is already locked
+}
+
+// TunerOccupancy is the number of tuners in use from Time until the next entry.
+type TunerOccupancy struct {
+	Time  string `json:"time"`
+	InUse int    `json:"inUse"`
+}
+
+// ForecastProblem is a predicted failure for a recording.
+type ForecastProblem struct {
+	RecordingID int    `json:"recordingId"`
+	Type        string `json:"type"`
+	Message     string `json:"message"`
+}
+
+type ForecastDisk struct {
+	FreeBytes      *int64 `json:"freeBytes,omitempty"`
+	ProjectedBytes int64  `json:"projectedBytes"`
+}
+
+type Forecast struct {
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	TunerCount int                 `json:"tunerCount"`
+	Recordings []ForecastRecording `json:"recordings"`
+	Locks      []ForecastLock      `json:"locks"`
+	Occupancy  []TunerOccupancy    `json:"occupancy"`
+	Disk       ForecastDisk        `json:"disk"`
+	Problems   []ForecastProblem   `json:"problems"`
+}
+
+func (a *App) getScheduleForecast(w http.ResponseWriter, r *http.Request) {
+	hours := defaultForecastHours
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxForecastHours {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("hours must be between 1 and %d", maxForecastHours)}) //nolint: errcheck
+			return
+		}
+		hours = n
+	}
+
+	loc, _ := a.getLocalLocation()
+	forecast, err := a.buildForecast(r.Context(), time.Now().In(loc), time.Duration(hours)*time.Hour)
+	if err != nil {
+		requestLogger(r).Error("Error building schedule forecast", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(forecast); err != nil {
+		requestLogger(r).Error("Error encoding forecast response", "err", err)
+	}
+}
+
+// buildForecast simulates the pending and in-progress recordings that overlap
+// [now, now+period): tuners are handed out in start order the same way the
+// HDHomeRun does, and disk use is projected from each channel's average
+// bytes per minute of completed recordings. Channel locks are given their
+// tuners before any recording.
+func (a *App) buildForecast(ctx context.Context, now time.Time, period time.Duration) (*Forecast, error) {
+	loc := now.Location()
+	until := now.Add(period)
+
+	type channelInfo struct {
+		name    string
+		enabled bool
+	}
+	channels := make(map[string]channelInfo)
+	rows, err := a.dbQueryContext(ctx, "SELECT guide_number, COALESCE(guide_name, ''), enabled FROM channels")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var num string
+		var ch channelInfo
+		if err := rows.Scan(&num, &ch.name, &ch.enabled); err != nil {
+			rows.Close() //nolint: errcheck
+			return nil, err
+		}
+		channels[num] = ch
+	}
+	rows.Close() //nolint: errcheck
+
+	rates, defaultRate, err := a.bytesPerMinute(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type scheduled struct {
+		ForecastRecording
+		start, end time.Time
+	}
+	var recs []*scheduled
+	before, after := a.padding()
+	rows, err = a.dbQueryContext(ctx, `
+		SELECT id, channel_id, date, start_time, duration, title
+		FROM recordings
+		WHERE status IN ('pending', 'waiting', 'recording')`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var rec scheduled
+		var date, startTime string
+		var duration int
+		if err := rows.Scan(&rec.ID, &rec.ChannelID, &date, &startTime, &duration, &rec.Title); err != nil {
+			rows.Close() //nolint: errcheck
+			return nil, err
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+startTime, loc)
+		if err != nil {
+			slog.Error("Error parsing start time for recording", "recording_id", rec.ID, "err", err)
+			continue
+		}
+		rec.start = start.Add(-time.Duration(before) * time.Second)
+		rec.end = rec.start.Add(time.Duration(duration+after) * time.Minute)
+		if !rec.end.After(now) || !rec.start.Before(until) {
+			continue
+		}
+		recs = append(recs, &rec)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating recordings", "err", err)
+	}
+	rows.Close() //nolint: errcheck
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].start.Equal(recs[j].start) {
+			return recs[i].ID < recs[j].ID
+		}
+		return recs[i].start.Before(recs[j].start)
+	})
+
+	forecast := &Forecast{
+		From:       now.Format(time.RFC3339),
+		To:         until.Format(time.RFC3339),
+		TunerCount: a.tunerCount,
+		Recordings: []ForecastRecording{},
+		Locks:      []ForecastLock{},
+		Occupancy:  []TunerOccupancy{},
+		Problems:   []ForecastProblem{},
+	}
+	addProblem := func(rec *scheduled, kind, msg string) {
+		rec.Problems = append(rec.Problems, kind)
+		forecast.Problems = append(forecast.Problems, ForecastProblem{RecordingID: rec.ID, Type: kind, Message: msg})
+	}
+
+	var free *int64
+	if n, ok := a.freeSpaceAllRoots(); ok {
+		free = &n
+	}
+	forecast.Disk.FreeBytes = free
+
+	// tunerBusy holds the intervals each tuner is occupied.
+	tunerBusy := make([][][2]time.Time, a.tunerCount)
+	claimTuner := func(start, end time.Time) int {
+		for i, busy := range tunerBusy {
+			free := true
+			for _, b := range busy {
+				if start.Before(b[1]) && b[0].Before(end) {
+					free = false
+					break
+				}
+			}
+			if free {
+				tunerBusy[i] = append(tunerBusy[i], [2]time.Time{start, end})
+				return i
+			}
+		}
+		return -1
+	}
+
+	type edge struct {
+		t    time.Time
+		diff int
+	}
+	var edges []edge
+
+	locks, err := a.lockIntervals(ctx, now, until, loc)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(locks, func(i, j int) bool { return locks[i].start.Before(locks[j].start) })
+	for _, l := range locks {
+		fl := ForecastLock{
+			LockID:    l.lock.ID,
+			ChannelID: l.lock.ChannelID,
+			Name:      l.lock.Name,
+			Start:     l.start.Format(time.RFC3339),
+			End:       l.end.Format(time.RFC3339),
+			Tuner:     claimTuner(l.start, l.end),
+		}
+		if fl.Tuner >= 0 {
+			edges = append(edges, edge{l.start, 1}, edge{l.end, -1})
+		}
+		forecast.Locks = append(forecast.Locks, fl)
+	}
+
+	for _, rec := range recs {
+		rec.Start = rec.start.Format(time.RFC3339)
+		rec.End = rec.end.Format(time.RFC3339)
+		rec.Tuner = -1
+
+		ch, ok := channels[rec.ChannelID]
+		switch {
+		case !ok:
+			addProblem(rec, "missing_channel", fmt.Sprintf("channel %s is not in the lineup", rec.ChannelID))
+		case !ch.enabled:
+			rec.ChannelName = ch.name
+			addProblem(rec, "channel_disabled", fmt.Sprintf("channel %s was not found in the last channel scan", rec.ChannelID))
+		default:
+			rec.ChannelName = ch.name
+		}
+
+		// A recording on a missing channel fails before it ever takes a tuner.
+		if ok {
+			rec.Tuner = claimTuner(rec.start, rec.end)
+			if rec.Tuner < 0 {
+				addProblem(rec, "tuner_conflict", fmt.Sprintf("all %d tuners are busy at %s", a.tunerCount, rec.Start))
+			} else {
+				edges = append(edges, edge{rec.start, 1}, edge{rec.end, -1})
+			}
+		}
+
+		if len(rec.Problems) == 0 {
+			rate, ok := rates[rec.ChannelID]
+			if !ok {
+				rate = defaultRate
+			}
+			from := rec.start
+			if from.Before(now) {
+				from = now
+			}
+			rec.ProjectedBytes = int64(rec.end.Sub(from).Minutes() * rate)
+			forecast.Disk.ProjectedBytes += rec.ProjectedBytes
+			if free != nil && forecast.Disk.ProjectedBytes > *free {
+				addProblem(rec, "insufficient_space", fmt.Sprintf("projected usage %d bytes exceeds %d bytes free", forecast.Disk.ProjectedBytes, *free))
+			}
+		}
+
+		forecast.Recordings = append(forecast.Recordings, rec.ForecastRecording)
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].t.Equal(edges[j].t) {
+			return edges[i].diff < edges[j].diff
+		}
+		return edges[i].t.Before(edges[j].t)
+	})
+	inUse := 0
+	for _, e := range edges {
+		inUse += e.diff
+		point := TunerOccupancy{Time: e.t.Format(time.RFC3339), InUse: inUse}
+		if n := len(forecast.Occupancy); n > 0 && forecast.Occupancy[n-1].Time == point.Time {
+			forecast.Occupancy[n-1] = point
+		} else {
+			forecast.Occupancy = append(forecast.Occupancy, point)
+		}
+	}
+
+	return forecast, nil
+}
+
+// bytesPerMinute returns the average recorded bytes per minute for each
+// channel along with the overall average, used for channels without history.
+func (a *App) bytesPerMinute(ctx context.Context) (map[string]float64, float64, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT channel_id, SUM(file_size), SUM(duration)
+		FROM recordings
+		WHERE status = 'completed' AND file_size > 0 AND duration > 0
+		GROUP BY channel_id`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	rates := make(map[string]float64)
+	var totalBytes, totalMinutes int64
+	for rows.Next() {
+		var channelID string
+		var size, minutes int64
+		if err := rows.Scan(&channelID, &size, &minutes); err != nil {
+			return nil, 0, err
+		}
+		rates[channelID] = float64(size) / float64(minutes)
+		totalBytes += size
+		totalMinutes += minutes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	overall := float64(defaultBytesPerMinute)
+	if totalMinutes > 0 {
+		overall = float64(totalBytes) / float64(totalMinutes)
+	}
+	return rates, overall, nil
+}
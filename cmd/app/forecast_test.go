@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestBuildForecast(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	mem.SetCapacity(10000)
+	app.storage = mem
+
+	_, err := db.Exec(`
+		INSERT INTO channels (guide_number, guide_name, enabled) VALUES ('101', 'Test Channel', 1), ('102', 'Gone', 0);
+		INSERT INTO recordings (id, channel_id, date, start_time, duration, status, file_size) VALUES
+			(1, '101', '2026-07-14', '19:00', 60, 'pending', 0),
+			(2, '101', '2026-07-14', '19:30', 60, 'pending', 0),
+			(3, '101', '2026-07-14', '19:45', 30, 'pending', 0),
+			(4, '999', '2026-07-14', '20:00', 30, 'pending', 0),
+			(5, '102', '2026-07-14', '21:00', 30, 'pending', 0),
+			(6, '101', '2026-07-16', '19:00', 30, 'pending', 0),
+			(7, '101', '2026-07-13', '19:00', 60, 'completed', 6000)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 7, 14, 18, 0, 0, 0, time.UTC)
+	f, err := app.buildForecast(context.Background(), now, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.Recordings) != 5 {
+		t.Fatalf("expected 5 recordings in window, got %+v", f.Recordings)
+	}
+
+	byID := make(map[int]ForecastRecording)
+	for _, r := range f.Recordings {
+		byID[r.ID] = r
+	}
+	if byID[1].Tuner != 0 || byID[2].Tuner != 1 || byID[3].Tuner != -1 || byID[5].Tuner != 0 {
+		t.Errorf("unexpected tuner assignment: %+v", f.Recordings)
+	}
+	// 61 minutes (pre-roll + post-roll) at the channel's 100 bytes/minute.
+	if byID[1].ProjectedBytes != 6100 {
+		t.Errorf("expected 6100 projected bytes, got %d", byID[1].ProjectedBytes)
+	}
+
+	want := map[int]string{
+		2: "insufficient_space",
+		3: "tuner_conflict",
+		4: "missing_channel",
+		5: "channel_disabled",
+	}
+	if len(f.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %+v", len(want), f.Problems)
+	}
+	for _, p := range f.Problems {
+		if want[p.RecordingID] != p.Type {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	}
+
+	if len(f.Occupancy) == 0 {
+		t.Fatal("expected occupancy timeline")
+	}
+	peak := 0
+	for _, o := range f.Occupancy {
+		if o.InUse > peak {
+			peak = o.InUse
+		}
+	}
+	if peak != 2 || f.Occupancy[len(f.Occupancy)-1].InUse != 0 {
+		t.Errorf("unexpected occupancy timeline: %+v", f.Occupancy)
+	}
+}
+
+func TestGetScheduleForecastHandler_InvalidHours(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	req := httptest.NewRequest("GET", "/api/schedule/forecast?hours=72", nil)
+	rr := httptest.NewRecorder()
+	app.getScheduleForecast(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got code %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest("GET", "/api/schedule/forecast", nil)
+	rr = httptest.NewRecorder()
+	app.getScheduleForecast(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got code %d, want %d", rr.Code, http.StatusOK)
+	}
+}
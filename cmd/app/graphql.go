@@ -0,0 +1,737 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A small GraphQL executor for the read-only schema in graphqlapi.go. It
+// takes queries only: fields with aliases and arguments, variables,
+// fragments, inline fragments and @skip/@include. There is no
+// introspection; the schema is described in the README.
+
+// gqlField is a field selected in a query.
+type gqlField struct {
+	alias, name string
+	args        map[string]interface{}
+	selection   []gqlSelection
+}
+
+// gqlSelection is a field; a spread of the named fragment; a fragment
+// whose selection applies when the object is of type on, or any type when
+// on is empty; or a selection under the @skip or @include directive.
+type gqlSelection struct {
+	field     *gqlField
+	on        string
+	fragment  string
+	selection []gqlSelection
+
+	directive string
+	args      map[string]interface{}
+}
+
+// gqlMaxDepth is how deeply selections may nest, counting the fields of
+// spread fragments where they are spread. The schema's links go no deeper
+// than a few levels; the limit keeps a query from exhausting the stack.
+const gqlMaxDepth = 16
+
+// gqlVariable is a reference to a variable, resolved when arguments are.
+type gqlVariable string
+
+// gqlDocument is a parsed query.
+type gqlDocument struct {
+	selection []gqlSelection
+	defaults  map[string]interface{}
+	fragments map[string]gqlSelection
+}
+
+// gqlError is a GraphQL error, reported in the response's errors.
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *gqlError) Error() string { return e.Message }
+
+// gqlLexer splits a query into tokens.
+type gqlLexer struct {
+	src string
+	pos int
+	tok string
+	// str holds the value of a string token, which tok holds quoted.
+	str  string
+	kind byte // 'n' name, '0' number, 's' string, 'p' punctuator, 0 at the end
+	// depth is how many selection sets enclose the current one.
+	depth int
+}
+
+// next moves to the next token, skipping whitespace, commas and comments.
+func (l *gqlLexer) next() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+		} else {
+			break
+		}
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		l.tok, l.kind = "", 0
+		return nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || l.src[l.pos] >= 'a' && l.src[l.pos] <= 'z' ||
+			l.src[l.pos] >= 'A' && l.src[l.pos] <= 'Z' || l.src[l.pos] >= '0' && l.src[l.pos] <= '9') {
+			l.pos++
+		}
+		l.kind = 'n'
+	case c == '-' || c >= '0' && c <= '9':
+		l.pos++
+		for l.pos < len(l.src) && strings.IndexByte("0123456789.eE+-", l.src[l.pos]) >= 0 {
+			l.pos++
+		}
+		l.kind = '0'
+	case c == '"':
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != '"' {
+			if l.src[l.pos] == '\\' {
+				l.pos++
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return &gqlError{Message: "unterminated string"}
+		}
+		l.pos++
+		if err := json.Unmarshal([]byte(l.src[start:l.pos]), &l.str); err != nil {
+			return &gqlError{Message: "invalid string " + l.src[start:l.pos]}
+		}
+		l.kind = 's'
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		l.kind = 'p'
+	case strings.IndexByte("{}():!$[]=@", c) >= 0:
+		l.pos++
+		l.kind = 'p'
+	default:
+		return &gqlError{Message: fmt.Sprintf("unexpected character %q", c)}
+	}
+	l.tok = l.src[start:l.pos]
+	return nil
+}
+
+// expect consumes tok, or fails.
+func (l *gqlLexer) expect(tok string) error {
+	if l.tok != tok || l.kind == 's' {
+		return l.unexpected("expected " + strconv.Quote(tok))
+	}
+	return l.next()
+}
+
+// name consumes a name.
+func (l *gqlLexer) name() (string, error) {
+	if l.kind != 'n' {
+		return "", l.unexpected("expected a name")
+	}
+	name := l.tok
+	return name, l.next()
+}
+
+func (l *gqlLexer) unexpected(want string) error {
+	if l.kind == 0 {
+		return &gqlError{Message: "syntax error: " + want + ", found the end of the query"}
+	}
+	return &gqlError{Message: fmt.Sprintf("syntax error: %s, found %q", want, l.tok)}
+}
+
+// parseGraphQL parses query, choosing the operation named operation when
+// it holds several.
+func parseGraphQL(query, operation string) (*gqlDocument, error) {
+	l := &gqlLexer{src: query}
+	if err := l.next(); err != nil {
+		return nil, err
+	}
+	doc := &gqlDocument{fragments: map[string]gqlSelection{}}
+	var found, operations int
+	for l.kind != 0 {
+		if l.tok == "{" {
+			operations++
+			sel, err := l.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			if operation == "" {
+				doc.selection, doc.defaults, found = sel, map[string]interface{}{}, found+1
+			}
+			continue
+		}
+		keyword, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "fragment":
+			name, err := l.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := l.expect("on"); err != nil {
+				return nil, err
+			}
+			on, err := l.name()
+			if err != nil {
+				return nil, err
+			}
+			sel, err := l.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.fragments[name] = gqlSelection{on: on, selection: sel}
+		case "query":
+			operations++
+			var name string
+			if l.kind == 'n' {
+				name, _ = l.name()
+			}
+			defaults, err := l.variableDefinitions()
+			if err != nil {
+				return nil, err
+			}
+			if err := l.directives(nil); err != nil {
+				return nil, err
+			}
+			sel, err := l.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			if operation == "" || operation == name {
+				doc.selection, doc.defaults, found = sel, defaults, found+1
+			}
+		case "mutation", "subscription":
+			return nil, &gqlError{Message: keyword + " operations are not supported; the schema is read-only"}
+		default:
+			return nil, &gqlError{Message: fmt.Sprintf("syntax error: unexpected %q", keyword)}
+		}
+	}
+	switch {
+	case found == 0 && operation != "":
+		return nil, &gqlError{Message: "unknown operation " + strconv.Quote(operation)}
+	case found == 0:
+		return nil, &gqlError{Message: "the query has no operation"}
+	case operation == "" && operations > 1:
+		return nil, &gqlError{Message: "operationName is required for a query with several operations"}
+	}
+	if err := doc.checkDepth(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// checkDepth rejects fragments that spread themselves, directly or through
+// other fragments, and an operation nested deeper than gqlMaxDepth once its
+// fragments are expanded.
+func (doc *gqlDocument) checkDepth() error {
+	depths := map[string]int{}
+	visiting := map[string]bool{}
+	var selectionDepth func(selection []gqlSelection) (int, error)
+	fragmentDepth := func(name string) (int, error) {
+		if d, ok := depths[name]; ok {
+			return d, nil
+		}
+		if visiting[name] {
+			return 0, &gqlError{Message: "fragment " + name + " spreads itself"}
+		}
+		visiting[name] = true
+		d, err := selectionDepth(doc.fragments[name].selection)
+		visiting[name] = false
+		depths[name] = d
+		return d, err
+	}
+	selectionDepth = func(selection []gqlSelection) (int, error) {
+		deepest := 0
+		for _, sel := range selection {
+			var d int
+			var err error
+			switch {
+			case sel.fragment != "":
+				// Unknown fragments are reported if execution reaches them.
+				if _, ok := doc.fragments[sel.fragment]; ok {
+					d, err = fragmentDepth(sel.fragment)
+				}
+			case sel.field != nil:
+				d, err = selectionDepth(sel.field.selection)
+				d++
+			default:
+				d, err = selectionDepth(sel.selection)
+			}
+			if err != nil {
+				return 0, err
+			}
+			deepest = max(deepest, d)
+		}
+		return deepest, nil
+	}
+
+	for name := range doc.fragments {
+		if _, err := fragmentDepth(name); err != nil {
+			return err
+		}
+	}
+	d, err := selectionDepth(doc.selection)
+	if err != nil {
+		return err
+	}
+	if d > gqlMaxDepth {
+		return &gqlError{Message: fmt.Sprintf("the query nests %d levels deep; at most %d are allowed", d, gqlMaxDepth)}
+	}
+	return nil
+}
+
+// variableDefinitions parses the optional ($name: Type = default, ...),
+// returning the defaults. Types are not checked.
+func (l *gqlLexer) variableDefinitions() (map[string]interface{}, error) {
+	defaults := map[string]interface{}{}
+	if l.tok != "(" {
+		return defaults, nil
+	}
+	if err := l.next(); err != nil {
+		return nil, err
+	}
+	for l.tok != ")" {
+		if err := l.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.expect(":"); err != nil {
+			return nil, err
+		}
+		for l.tok == "[" || l.tok == "]" || l.tok == "!" || l.kind == 'n' {
+			if err := l.next(); err != nil {
+				return nil, err
+			}
+		}
+		if l.tok == "=" {
+			if err := l.next(); err != nil {
+				return nil, err
+			}
+			if defaults[name], err = l.value(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return defaults, l.next()
+}
+
+// directives parses directives, keeping @skip and @include in into.
+func (l *gqlLexer) directives(into *[]gqlField) error {
+	for l.tok == "@" {
+		if err := l.next(); err != nil {
+			return err
+		}
+		name, err := l.name()
+		if err != nil {
+			return err
+		}
+		args, err := l.arguments()
+		if err != nil {
+			return err
+		}
+		if name != "skip" && name != "include" {
+			return &gqlError{Message: "unknown directive @" + name}
+		}
+		if into != nil {
+			*into = append(*into, gqlField{name: name, args: args})
+		}
+	}
+	return nil
+}
+
+// arguments parses the optional (name: value, ...).
+func (l *gqlLexer) arguments() (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if l.tok != "(" {
+		return args, nil
+	}
+	if err := l.next(); err != nil {
+		return nil, err
+	}
+	for l.tok != ")" {
+		name, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = l.value(); err != nil {
+			return nil, err
+		}
+	}
+	return args, l.next()
+}
+
+// value parses a literal or a variable.
+func (l *gqlLexer) value() (interface{}, error) {
+	tok, kind := l.tok, l.kind
+	switch {
+	case kind == 's':
+		s := l.str
+		return s, l.next()
+	case kind == '0':
+		if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+			return n, l.next()
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, &gqlError{Message: "invalid number " + tok}
+		}
+		return f, l.next()
+	case kind == 'n':
+		var v interface{} = tok
+		switch tok {
+		case "true", "false":
+			v = tok == "true"
+		case "null":
+			v = nil
+		}
+		return v, l.next()
+	case tok == "$":
+		if err := l.next(); err != nil {
+			return nil, err
+		}
+		name, err := l.name()
+		return gqlVariable(name), err
+	case tok == "[":
+		list := []interface{}{}
+		if err := l.next(); err != nil {
+			return nil, err
+		}
+		for l.tok != "]" {
+			v, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, l.next()
+	case tok == "{":
+		return nil, &gqlError{Message: "input objects are not supported"}
+	}
+	return nil, l.unexpected("expected a value")
+}
+
+// selectionSet parses { selection ... }.
+func (l *gqlLexer) selectionSet() ([]gqlSelection, error) {
+	if err := l.expect("{"); err != nil {
+		return nil, err
+	}
+	if l.depth++; l.depth > gqlMaxDepth {
+		return nil, &gqlError{Message: fmt.Sprintf("selections nest more than %d levels deep", gqlMaxDepth)}
+	}
+	defer func() { l.depth-- }()
+	var set []gqlSelection
+	for l.tok != "}" {
+		if l.kind == 0 {
+			return nil, l.unexpected(`expected "}"`)
+		}
+		var sel gqlSelection
+		var conditions []gqlField
+		if l.tok == "..." {
+			if err := l.next(); err != nil {
+				return nil, err
+			}
+			if l.kind == 'n' && l.tok != "on" {
+				sel.fragment, _ = l.name()
+			} else if l.tok == "on" {
+				if err := l.next(); err != nil {
+					return nil, err
+				}
+				on, err := l.name()
+				if err != nil {
+					return nil, err
+				}
+				sel.on = on
+			}
+			if err := l.directives(&conditions); err != nil {
+				return nil, err
+			}
+			if sel.fragment == "" {
+				var err error
+				if sel.selection, err = l.selectionSet(); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			f := &gqlField{}
+			name, err := l.name()
+			if err != nil {
+				return nil, err
+			}
+			f.name = name
+			if l.tok == ":" {
+				if err := l.next(); err != nil {
+					return nil, err
+				}
+				f.alias = name
+				if f.name, err = l.name(); err != nil {
+					return nil, err
+				}
+			}
+			if f.args, err = l.arguments(); err != nil {
+				return nil, err
+			}
+			if err := l.directives(&conditions); err != nil {
+				return nil, err
+			}
+			if l.tok == "{" {
+				if f.selection, err = l.selectionSet(); err != nil {
+					return nil, err
+				}
+			}
+			sel.field = f
+		}
+		for _, c := range conditions {
+			sel = gqlSelection{directive: c.name, args: c.args, selection: []gqlSelection{sel}}
+		}
+		set = append(set, sel)
+	}
+	return set, l.next()
+}
+
+// gqlObject is a value of an object type; fields returns the resolver of
+// a field, or nil for a field the type lacks.
+type gqlObject struct {
+	typ    string
+	fields func(name string) gqlResolver
+}
+
+// gqlResolver resolves a field from its arguments. It returns a scalar, a
+// *gqlObject, a slice of either, or nil.
+type gqlResolver func(args map[string]interface{}) (interface{}, error)
+
+// gqlResult is an object in the response, its fields in query order.
+type gqlResult []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (m gqlResult) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range m {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// gqlExecutor runs a parsed query.
+type gqlExecutor struct {
+	doc       *gqlDocument
+	variables map[string]interface{}
+}
+
+// execute resolves the selection on obj.
+func (x *gqlExecutor) execute(obj *gqlObject, selection []gqlSelection, path []interface{}) (gqlResult, error) {
+	result := gqlResult{}
+	if err := x.collect(obj, selection, path, &result, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// collect adds the fields of selection that apply to obj to result. A
+// fragment already in spread has added its fields, so it is not expanded
+// again.
+func (x *gqlExecutor) collect(obj *gqlObject, selection []gqlSelection, path []interface{}, result *gqlResult, spread map[string]bool) error {
+	for _, sel := range selection {
+		switch {
+		case sel.fragment != "":
+			frag, ok := x.doc.fragments[sel.fragment]
+			if !ok {
+				return &gqlError{Message: "unknown fragment " + sel.fragment, Path: path}
+			}
+			if frag.on == obj.typ && !spread[sel.fragment] {
+				spread[sel.fragment] = true
+				if err := x.collect(obj, frag.selection, path, result, spread); err != nil {
+					return err
+				}
+			}
+		case sel.directive != "":
+			cond, ok := x.resolveArgs(sel.args)["if"].(bool)
+			if !ok {
+				return &gqlError{Message: "@" + sel.directive + " needs a Boolean if", Path: path}
+			}
+			if cond == (sel.directive == "include") {
+				if err := x.collect(obj, sel.selection, path, result, spread); err != nil {
+					return err
+				}
+			}
+		case sel.field == nil:
+			if sel.on == "" || sel.on == obj.typ {
+				if err := x.collect(obj, sel.selection, path, result, spread); err != nil {
+					return err
+				}
+			}
+		default:
+			f := sel.field
+			key := f.name
+			if f.alias != "" {
+				key = f.alias
+			}
+			if result.has(key) {
+				continue
+			}
+			v, err := x.field(obj, f, append(path[:len(path):len(path)], key))
+			if err != nil {
+				return err
+			}
+			*result = append(*result, gqlEntry{key, v})
+		}
+	}
+	return nil
+}
+
+// has reports whether m already holds key, as when a fragment selects a
+// field the query selected too.
+func (m gqlResult) has(key string) bool {
+	for _, e := range m {
+		if e.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// field resolves f on obj, and the selection of f on what it returns.
+func (x *gqlExecutor) field(obj *gqlObject, f *gqlField, path []interface{}) (interface{}, error) {
+	if f.name == "__typename" {
+		return obj.typ, nil
+	}
+	resolve := obj.fields(f.name)
+	if resolve == nil {
+		return nil, &gqlError{Message: fmt.Sprintf("cannot query field %q on type %q", f.name, obj.typ), Path: path}
+	}
+	v, err := resolve(x.resolveArgs(f.args))
+	if err != nil {
+		var ge *gqlError
+		if !errors.As(err, &ge) {
+			ge = &gqlError{Message: err.Error()}
+		}
+		if ge.Path == nil {
+			ge.Path = path
+		}
+		return nil, ge
+	}
+	return x.complete(v, f, path)
+}
+
+// complete resolves the selection of f on v.
+func (x *gqlExecutor) complete(v interface{}, f *gqlField, path []interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *gqlObject:
+		if v == nil {
+			return nil, nil
+		}
+		if f.selection == nil {
+			return nil, &gqlError{Message: fmt.Sprintf("field %q of type %q needs a selection", f.name, v.typ), Path: path}
+		}
+		return x.execute(v, f.selection, path)
+	case []*gqlObject:
+		list := make([]interface{}, len(v))
+		for i, o := range v {
+			var err error
+			if list[i], err = x.complete(o, f, append(path[:len(path):len(path)], i)); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	if f.selection != nil {
+		return nil, &gqlError{Message: fmt.Sprintf("field %q is a scalar and takes no selection", f.name), Path: path}
+	}
+	return v, nil
+}
+
+// resolveArgs substitutes the variables in args.
+func (x *gqlExecutor) resolveArgs(args map[string]interface{}) map[string]interface{} {
+	resolved := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if name, ok := v.(gqlVariable); ok {
+			val, ok := x.variables[string(name)]
+			if !ok {
+				val, ok = x.doc.defaults[string(name)]
+			}
+			if !ok {
+				continue
+			}
+			v = val
+		}
+		resolved[k] = v
+	}
+	return resolved
+}
+
+// gqlString returns the String argument name, or "" when it is absent.
+func gqlString(args map[string]interface{}, name string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", &gqlError{Message: fmt.Sprintf("argument %q must be a String", name)}
+}
+
+// gqlInt returns the Int argument name, or def when it is absent.
+func gqlInt(args map[string]interface{}, name string, def int) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		// Variables arrive as JSON numbers.
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, &gqlError{Message: fmt.Sprintf("argument %q must be an Int", name)}
+}
+
+// gqlBool returns the Boolean argument name, or false when it is absent.
+func gqlBool(args map[string]interface{}, name string) (bool, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, &gqlError{Message: fmt.Sprintf("argument %q must be a Boolean", name)}
+}
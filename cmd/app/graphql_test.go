@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	for _, tc := range []struct{ query, op, err string }{
+		{query: `{ recordings { id } }`},
+		{query: `query Q($n: Int! = 3) { recordings(limit: $n) { ...R } } fragment R on Recording { id }`},
+		{query: `query A { a: recordings { id } } query B { channels { number } }`, op: "B"},
+		{query: `query A { recordings { id } } query B { channels { number } }`, err: "operationName is required"},
+		{query: `mutation { deleteRecording(id: 1) }`, err: "not supported"},
+		{query: `{ recordings { id }`, err: "end of the query"},
+		{query: `{ recordings(title: "unterminated) { id } }`, err: "unterminated string"},
+		{query: `{ recordings { id @defer } }`, err: "unknown directive"},
+		{query: `{ ...F } fragment F on Query { ...F }`, err: "fragment F spreads itself"},
+		{query: `{ recordings { id } } fragment A on Recording { ...B } fragment B on Recording { channel { ...A } }`, err: "spreads itself"},
+		{query: strings.Repeat("{ recordings ", 17) + "{ id }" + strings.Repeat(" }", 17), err: "levels deep"},
+		{query: `{ recordings { ...A } } fragment A on Recording { channel { recordings { ...B } } } fragment B on Recording { channel { recordings { ...C } } }
+			fragment C on Recording { channel { recordings { ...D } } } fragment D on Recording { channel { recordings { ...E } } }
+			fragment E on Recording { channel { recordings { ...F } } } fragment F on Recording { channel { recordings { ...G } } }
+			fragment G on Recording { channel { recordings { ...H } } } fragment H on Recording { channel { recordings { id } } }`, err: "18 levels deep"},
+	} {
+		_, err := parseGraphQL(tc.query, tc.op)
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: %v, want %q", tc.query, err, tc.err)
+		}
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('9.1', 'KQED', 'http://tuner/auto/v9.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('7.1', 'KGO', 'http://tuner/auto/v7.1', 0)",
+		"INSERT INTO channel_lineup (guide_number, hd, last_seen) VALUES ('5.1', 1, '2026-03-01 12:00:00')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title, file_size) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'Nova', 1000)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '5.1', '2099-03-08', '20:00', 60, 'pending', 'Nova')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (3, '9.1', '2026-03-02', '18:00', 30, 'completed', 'Frontline')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'nova-1.ts')",
+		"INSERT INTO program_links (recording_id, program_id) VALUES (2, 'p-nova')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Minute)
+	app.guideData = types.Guide{
+		Channels: []types.LineupData{{ChannelNumber: "5.1", Logo: "http://logos/kpix.png"}},
+		Programs: []types.Program{
+			{ID: "p-nova", Channel: "5.1", Title: "Nova", SubTitle: "Black Holes", Start: start.Format(time.RFC3339), End: start.Add(time.Hour).Format(time.RFC3339), Season: 51, Episode: 3},
+			{ID: "p-news", Channel: "9.1", Title: "News", Start: start.Format(time.RFC3339), End: start.Add(time.Hour).Format(time.RFC3339)},
+		},
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/graphql", app.serveGraphQL).Methods("GET", "POST")
+	post := func(query string, variables map[string]interface{}) (int, string) {
+		body, _ := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/graphql", strings.NewReader(string(body))))
+		return rr.Code, strings.TrimSpace(rr.Body.String())
+	}
+
+	// One query walks recordings to their channels and programs, and back.
+	code, body := post(`query Recent($status: String) {
+		recordings(status: $status, limit: 5) {
+			id title fileSize filePath
+			channel { number name hd logo }
+			...linked
+		}
+	}
+	fragment linked on Recording { program { title season channel { name } recordings { id status } } }`,
+		map[string]interface{}{"status": "completed"})
+	want := `{"data":{"recordings":[` +
+		`{"id":3,"title":"Frontline","fileSize":0,"filePath":null,"channel":{"number":"9.1","name":"KQED","hd":false,"logo":null},"program":null},` +
+		`{"id":1,"title":"Nova","fileSize":1000,"filePath":"nova-1.ts","channel":{"number":"5.1","name":"KPIX","hd":true,"logo":"http://logos/kpix.png"},"program":null}]}}`
+	if code != http.StatusOK || body != want {
+		t.Errorf("recordings %d\n%s\nwant\n%s", code, body, want)
+	}
+
+	_, body = post(`{ program(id: "p-nova") { title subtitle recordings { id status } } kqed: channel(number: "9.1") { programs { id } } }`, nil)
+	want = `{"data":{"program":{"title":"Nova","subtitle":"Black Holes","recordings":[{"id":2,"status":"pending"}]},"kqed":{"programs":[{"id":"p-news"}]}}}`
+	if body != want {
+		t.Errorf("program\n%s\nwant\n%s", body, want)
+	}
+
+	_, body = post(`{ channels { number } all: channels(all: true) { number __typename } }`, nil)
+	want = `{"data":{"channels":[{"number":"5.1"},{"number":"9.1"}],"all":[{"number":"5.1","__typename":"Channel"},{"number":"7.1","__typename":"Channel"},{"number":"9.1","__typename":"Channel"}]}}`
+	if body != want {
+		t.Errorf("channels\n%s\nwant\n%s", body, want)
+	}
+
+	_, body = post(`query($full: Boolean!) { recording(id: 1) { id title @include(if: $full) status @skip(if: $full) } }`, map[string]interface{}{"full": true})
+	if want := `{"data":{"recording":{"id":1,"title":"Nova"}}}`; body != want {
+		t.Errorf("directives\n%s\nwant\n%s", body, want)
+	}
+
+	_, body = post(`{ recordings { id secret } }`, nil)
+	if want := `{"data":null,"errors":[{"message":"cannot query field \"secret\" on type \"Recording\"","path":["recordings",0,"secret"]}]}`; body != want {
+		t.Errorf("unknown field\n%s\nwant\n%s", body, want)
+	}
+	if code, _ := post(`{ recordings { id }`, nil); code != http.StatusBadRequest {
+		t.Errorf("syntax error: %d", code)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/graphql?query="+url.QueryEscape(`{ recording(id: 3) { title } }`), nil))
+	if want := `{"data":{"recording":{"title":"Frontline"}}}`; strings.TrimSpace(rr.Body.String()) != want {
+		t.Errorf("GET %s", rr.Body)
+	}
+
+	// Restricted channels and their recordings disappear, even nested.
+	app.config.Parental = &pkgcfg.Parental{RestrictedChannels: []string{"9.1"}}
+	_, body = post(`{ recordings(status: "completed") { id } channel(number: "9.1") { name } }`, nil)
+	if want := `{"data":{"recordings":[{"id":1}],"channel":null}}`; body != want {
+		t.Errorf("parental\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'Nova')"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := app.newRouter()
+	post := func(query string) (int, string) {
+		body, _ := json.Marshal(graphqlRequest{Query: query})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body))))
+		return rr.Code, strings.TrimSpace(rr.Body.String())
+	}
+
+	// A fragment cycle used to recurse until the stack overflowed.
+	if code, body := post(`{ ...F } fragment F on Query { ...F }`); code != http.StatusBadRequest || !strings.Contains(body, "spreads itself") {
+		t.Errorf("fragment cycle: %d %s", code, body)
+	}
+
+	// Each fragment spreads the next twice; expanding every spread would
+	// take 2^30 steps.
+	query := `{ recordings { ...F0 } } fragment F30 on Recording { id }`
+	for i := 0; i < 30; i++ {
+		query += fmt.Sprintf(" fragment F%d on Recording { ...F%d ...F%d }", i, i+1, i+1)
+	}
+	if code, body := post(query); code != http.StatusOK || body != `{"data":{"recordings":[{"id":1}]}}` {
+		t.Errorf("repeated spreads: %d %s", code, body)
+	}
+}
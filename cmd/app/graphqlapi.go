@@ -0,0 +1,528 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// GraphQL serves recordings, channels and guide programs linked to each
+// other, so a client fetches what it shows in one request. Each request
+// loads every table it touches once, however deep the query nests.
+
+// graphqlRoute is the GraphQL endpoint, also served at graphqlRootRoute,
+// where GraphQL clients look for it by default.
+const (
+	graphqlRoute     = apiPrefix + "/graphql"
+	graphqlRootRoute = "/graphql"
+)
+
+// graphqlRequest is a GraphQL request, as the body of a POST or, for a
+// GET, the query, operationName and variables parameters.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlRecording is a recording as GraphQL resolves it.
+type gqlRecording struct {
+	id                              int
+	channel, date, startTime, title string
+	duration                        int
+	status, filePath, programID     string
+	fileSize                        int64
+}
+
+// gqlChannel is a channel as GraphQL resolves it.
+type gqlChannel struct {
+	number, name, videoCodec, audioCodec string
+	enabled, hd                          bool
+}
+
+// gqlLoader loads the data of one GraphQL request, each table once, with
+// what the caller may not see left out.
+type gqlLoader struct {
+	a        *App
+	r        *http.Request
+	loc      *time.Location
+	parental *pkgcfg.Parental
+	hide     bool
+
+	channelsOnce sync.Once
+	channels     []*gqlChannel
+	channelByNum map[string]*gqlChannel
+	logos        map[string]string
+	channelsErr  error
+
+	recordingsOnce sync.Once
+	recordings     []*gqlRecording
+	recordingsErr  error
+
+	programsOnce sync.Once
+	programs     []types.Program
+	programByID  map[string]int
+}
+
+func (l *gqlLoader) loadChannels() ([]*gqlChannel, error) {
+	l.channelsOnce.Do(func() {
+		l.channelByNum = map[string]*gqlChannel{}
+		l.logos = l.a.channelLogos()
+		rows, err := l.a.dbQueryContext(l.r.Context(), `
+			SELECT c.guide_number, COALESCE(c.guide_name, ''), COALESCE(c.enabled, 0),
+			       COALESCE(cl.video_codec, ''), COALESCE(cl.audio_codec, ''), COALESCE(cl.hd, 0)
+			FROM channels c
+			LEFT JOIN channel_lineup cl ON cl.guide_number = c.guide_number
+			ORDER BY c.guide_number`)
+		if err != nil {
+			l.channelsErr = err
+			return
+		}
+		defer rows.Close() //nolint: errcheck
+		for rows.Next() {
+			ch := &gqlChannel{}
+			if err := rows.Scan(&ch.number, &ch.name, &ch.enabled, &ch.videoCodec, &ch.audioCodec, &ch.hd); err != nil {
+				l.channelsErr = err
+				return
+			}
+			if l.hide && channelRestricted(l.parental, ch.number) {
+				continue
+			}
+			l.channels = append(l.channels, ch)
+			l.channelByNum[ch.number] = ch
+		}
+		l.channelsErr = rows.Err()
+	})
+	return l.channels, l.channelsErr
+}
+
+func (l *gqlLoader) loadRecordings() ([]*gqlRecording, error) {
+	l.recordingsOnce.Do(func() {
+		rows, err := l.a.dbQueryContext(l.r.Context(), `
+			SELECT r.id, COALESCE(r.channel_id, ''), COALESCE(r.date, ''), COALESCE(r.start_time, ''), COALESCE(r.title, ''),
+			       COALESCE(r.duration, 0), COALESCE(r.status, ''), COALESCE(r.file_size, 0), COALESCE(f.path, ''),
+			       COALESCE(pl.program_id, ''), COALESCE(m.category, '')
+			FROM recordings r
+			LEFT JOIN recording_files f ON f.recording_id = r.id
+			LEFT JOIN program_links pl ON pl.recording_id = r.id
+			LEFT JOIN recording_metadata m ON m.recording_id = r.id
+			ORDER BY r.date DESC, r.start_time DESC, r.id DESC`)
+		if err != nil {
+			l.recordingsErr = err
+			return
+		}
+		defer rows.Close() //nolint: errcheck
+		for rows.Next() {
+			rec := &gqlRecording{}
+			var category string
+			if err := rows.Scan(&rec.id, &rec.channel, &rec.date, &rec.startTime, &rec.title, &rec.duration, &rec.status,
+				&rec.fileSize, &rec.filePath, &rec.programID, &category); err != nil {
+				l.recordingsErr = err
+				return
+			}
+			if l.hide && recordingRestricted(l.parental, rec.channel, category) {
+				continue
+			}
+			l.recordings = append(l.recordings, rec)
+		}
+		l.recordingsErr = rows.Err()
+	})
+	return l.recordings, l.recordingsErr
+}
+
+func (l *gqlLoader) loadPrograms() []types.Program {
+	l.programsOnce.Do(func() {
+		l.a.guideDataMutex.RLock()
+		programs := make([]types.Program, len(l.a.guideData.Programs))
+		copy(programs, l.a.guideData.Programs)
+		l.a.guideDataMutex.RUnlock()
+		sort.SliceStable(programs, func(i, j int) bool {
+			if programs[i].Start == programs[j].Start {
+				return programs[i].Channel < programs[j].Channel
+			}
+			return programs[i].Start < programs[j].Start
+		})
+		l.programByID = map[string]int{}
+		for _, p := range programs {
+			if l.hide && recordingRestricted(l.parental, p.Channel, p.Category) {
+				continue
+			}
+			l.programs = append(l.programs, p)
+			if p.ID != "" {
+				l.programByID[p.ID] = len(l.programs) - 1
+			}
+		}
+	})
+	return l.programs
+}
+
+// channel returns the channel numbered number, or nil.
+func (l *gqlLoader) channel(number string) (*gqlObject, error) {
+	if _, err := l.loadChannels(); err != nil {
+		return nil, err
+	}
+	if ch := l.channelByNum[number]; ch != nil {
+		return l.channelObject(ch), nil
+	}
+	return nil, nil
+}
+
+// recordingList returns the recordings, newest first, of the status and
+// channel in args when given, and of the program with ID programID when it
+// is not empty.
+func (l *gqlLoader) recordingList(args map[string]interface{}, channel, programID string) ([]*gqlObject, error) {
+	status, err := gqlString(args, "status")
+	if err != nil {
+		return nil, err
+	}
+	if channel == "" {
+		if channel, err = gqlString(args, "channel"); err != nil {
+			return nil, err
+		}
+	}
+	limit, err := gqlInt(args, "limit", 0)
+	if err != nil {
+		return nil, err
+	}
+	recordings, err := l.loadRecordings()
+	if err != nil {
+		return nil, err
+	}
+	list := []*gqlObject{}
+	for _, rec := range recordings {
+		if limit > 0 && len(list) == limit {
+			break
+		}
+		if (status != "" && rec.status != status) || (channel != "" && rec.channel != channel) ||
+			(programID != "" && rec.programID != programID) {
+			continue
+		}
+		list = append(list, l.recordingObject(rec))
+	}
+	return list, nil
+}
+
+// programList returns the guide programs not over by from, by start time,
+// on channel when it is not empty, with title in their title when given.
+func (l *gqlLoader) programList(args map[string]interface{}, channel string) ([]*gqlObject, error) {
+	from := time.Now()
+	if v, err := gqlString(args, "from"); err != nil {
+		return nil, err
+	} else if v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, &gqlError{Message: `argument "from" must be an RFC 3339 time`}
+		}
+	}
+	if channel == "" {
+		var err error
+		if channel, err = gqlString(args, "channel"); err != nil {
+			return nil, err
+		}
+	}
+	title, err := gqlString(args, "title")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := gqlInt(args, "limit", 100)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.loadChannels(); err != nil {
+		return nil, err
+	}
+	list := []*gqlObject{}
+	programs := l.loadPrograms()
+	for i := range programs {
+		p := &programs[i]
+		if limit > 0 && len(list) == limit {
+			break
+		}
+		if (channel != "" && p.Channel != channel) || l.channelByNum[p.Channel] == nil ||
+			(title != "" && !strings.Contains(strings.ToLower(p.Title), strings.ToLower(title))) {
+			continue
+		}
+		if end, err := time.Parse(time.RFC3339, p.End); err != nil || !end.After(from) {
+			continue
+		}
+		list = append(list, l.programObject(p))
+	}
+	return list, nil
+}
+
+func (l *gqlLoader) query() *gqlObject {
+	return &gqlObject{typ: "Query", fields: func(name string) gqlResolver {
+		switch name {
+		case "recordings":
+			return func(args map[string]interface{}) (interface{}, error) { return l.recordingList(args, "", "") }
+		case "recording":
+			return func(args map[string]interface{}) (interface{}, error) {
+				id, err := gqlInt(args, "id", 0)
+				if err != nil {
+					return nil, err
+				}
+				recordings, err := l.loadRecordings()
+				if err != nil {
+					return nil, err
+				}
+				for _, rec := range recordings {
+					if rec.id == id {
+						return l.recordingObject(rec), nil
+					}
+				}
+				return (*gqlObject)(nil), nil
+			}
+		case "channels":
+			return func(args map[string]interface{}) (interface{}, error) {
+				all, err := gqlBool(args, "all")
+				if err != nil {
+					return nil, err
+				}
+				channels, err := l.loadChannels()
+				if err != nil {
+					return nil, err
+				}
+				list := []*gqlObject{}
+				for _, ch := range channels {
+					if ch.enabled || all {
+						list = append(list, l.channelObject(ch))
+					}
+				}
+				return list, nil
+			}
+		case "channel":
+			return func(args map[string]interface{}) (interface{}, error) {
+				number, err := gqlString(args, "number")
+				if err != nil {
+					return nil, err
+				}
+				return l.channel(number)
+			}
+		case "programs":
+			return func(args map[string]interface{}) (interface{}, error) { return l.programList(args, "") }
+		case "program":
+			return func(args map[string]interface{}) (interface{}, error) {
+				id, err := gqlString(args, "id")
+				if err != nil {
+					return nil, err
+				}
+				return l.program(id)
+			}
+		}
+		return nil
+	}}
+}
+
+// program returns the guide program with ID id, or nil.
+func (l *gqlLoader) program(id string) (*gqlObject, error) {
+	if _, err := l.loadChannels(); err != nil {
+		return nil, err
+	}
+	programs := l.loadPrograms()
+	if i, ok := l.programByID[id]; ok && l.channelByNum[programs[i].Channel] != nil {
+		return l.programObject(&programs[i]), nil
+	}
+	return nil, nil
+}
+
+// gqlValue resolves a field to v.
+func gqlValue(v interface{}) gqlResolver {
+	return func(map[string]interface{}) (interface{}, error) { return v, nil }
+}
+
+func (l *gqlLoader) recordingObject(rec *gqlRecording) *gqlObject {
+	return &gqlObject{typ: "Recording", fields: func(name string) gqlResolver {
+		switch name {
+		case "id":
+			return gqlValue(rec.id)
+		case "title":
+			return gqlValue(rec.title)
+		case "status":
+			return gqlValue(rec.status)
+		case "date":
+			return gqlValue(rec.date)
+		case "startTime":
+			return gqlValue(rec.startTime)
+		case "duration":
+			return gqlValue(rec.duration)
+		case "fileSize":
+			return gqlValue(rec.fileSize)
+		case "filePath":
+			if rec.filePath == "" {
+				return gqlValue(nil)
+			}
+			return gqlValue(rec.filePath)
+		case "start":
+			return func(map[string]interface{}) (interface{}, error) {
+				t, err := time.ParseInLocation("2006-01-02 15:04", rec.date+" "+rec.startTime, l.loc)
+				if err != nil {
+					return nil, nil
+				}
+				return t.Format(time.RFC3339), nil
+			}
+		case "programId":
+			if rec.programID == "" {
+				return gqlValue(nil)
+			}
+			return gqlValue(rec.programID)
+		case "channel":
+			return func(map[string]interface{}) (interface{}, error) { return l.channel(rec.channel) }
+		case "program":
+			return func(map[string]interface{}) (interface{}, error) {
+				if rec.programID == "" {
+					return (*gqlObject)(nil), nil
+				}
+				return l.program(rec.programID)
+			}
+		}
+		return nil
+	}}
+}
+
+func (l *gqlLoader) channelObject(ch *gqlChannel) *gqlObject {
+	return &gqlObject{typ: "Channel", fields: func(name string) gqlResolver {
+		switch name {
+		case "number":
+			return gqlValue(ch.number)
+		case "name":
+			return gqlValue(ch.name)
+		case "enabled":
+			return gqlValue(ch.enabled)
+		case "hd":
+			return gqlValue(ch.hd)
+		case "videoCodec":
+			return gqlValue(ch.videoCodec)
+		case "audioCodec":
+			return gqlValue(ch.audioCodec)
+		case "logo":
+			if logo := l.logos[ch.number]; logo != "" {
+				return gqlValue(logo)
+			}
+			return gqlValue(nil)
+		case "recordings":
+			return func(args map[string]interface{}) (interface{}, error) { return l.recordingList(args, ch.number, "") }
+		case "programs":
+			return func(args map[string]interface{}) (interface{}, error) { return l.programList(args, ch.number) }
+		}
+		return nil
+	}}
+}
+
+func (l *gqlLoader) programObject(p *types.Program) *gqlObject {
+	return &gqlObject{typ: "Program", fields: func(name string) gqlResolver {
+		optional := func(v interface{}, set bool) gqlResolver {
+			if !set {
+				v = nil
+			}
+			return gqlValue(v)
+		}
+		switch name {
+		case "id":
+			return gqlValue(p.ID)
+		case "title":
+			return gqlValue(p.Title)
+		case "subtitle":
+			return optional(p.SubTitle, p.SubTitle != "")
+		case "description":
+			return optional(p.Description, p.Description != "")
+		case "start":
+			return gqlValue(p.Start)
+		case "end":
+			return gqlValue(p.End)
+		case "duration":
+			return gqlValue(p.Duration)
+		case "category":
+			return optional(p.Category, p.Category != "")
+		case "season":
+			return optional(p.Season, p.Season > 0)
+		case "episode":
+			return optional(p.Episode, p.Episode > 0)
+		case "year":
+			return optional(p.Year, p.Year > 0)
+		case "rating":
+			return optional(p.Rating, p.Rating != "")
+		case "new":
+			return gqlValue(p.New)
+		case "channel":
+			return func(map[string]interface{}) (interface{}, error) { return l.channel(p.Channel) }
+		case "recordings":
+			return func(args map[string]interface{}) (interface{}, error) {
+				if p.ID == "" {
+					return []*gqlObject{}, nil
+				}
+				return l.recordingList(args, "", p.ID)
+			}
+		}
+		return nil
+	}}
+}
+
+// serveGraphQL serves GET and POST /api/v1/graphql.
+func (a *App) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, nil, &gqlError{Message: "invalid request body: " + err.Error()})
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, nil, &gqlError{Message: "invalid variables: " + err.Error()})
+				return
+			}
+		}
+	}
+	doc, err := parseGraphQL(req.Query, req.OperationName)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, nil, err)
+		return
+	}
+
+	loc, _ := a.getLocalLocation()
+	parental := a.cfg().Parental
+	l := &gqlLoader{a: a, r: r, loc: loc, parental: parental, hide: parental != nil && !a.parentalUnlocked(r, parental)}
+	x := &gqlExecutor{doc: doc, variables: req.Variables}
+	data, err := x.execute(l.query(), doc.selection, nil)
+	if err != nil {
+		var ge *gqlError
+		if !errors.As(err, &ge) {
+			requestLogger(r).Error("Error running GraphQL query", "err", err)
+		}
+		writeGraphQL(w, http.StatusOK, nil, err)
+		return
+	}
+	writeGraphQL(w, http.StatusOK, data, nil)
+}
+
+// graphqlResponse is the body of every GraphQL answer.
+type graphqlResponse struct {
+	Data   interface{} `json:"data"`
+	Errors []*gqlError `json:"errors,omitempty"`
+}
+
+// writeGraphQL writes a GraphQL response: data, or null and err.
+func writeGraphQL(w http.ResponseWriter, status int, data gqlResult, err error) {
+	var resp graphqlResponse
+	if err != nil {
+		var ge *gqlError
+		if !errors.As(err, &ge) {
+			ge = &gqlError{Message: err.Error()}
+		}
+		resp.Errors = []*gqlError{ge}
+	} else {
+		resp.Data = data
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp) //nolint: errcheck
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// guideChangeSet is what one guide reload changed.
+type guideChangeSet struct {
+	At      time.Time
+	Added   []types.Program
+	Removed []types.Program
+	Updated []types.Program
+}
+
+// guideChangeLog keeps the change sets of the most recent guide reloads in
+// memory. Changes from before the server started, or older than the
+// retained reloads, are unknown; start marks that horizon.
+type guideChangeLog struct {
+	mu    sync.Mutex
+	size  int
+	start time.Time
+	sets  []guideChangeSet
+}
+
+func newGuideChangeLog(size int) *guideChangeLog {
+	return &guideChangeLog{size: size}
+}
+
+func programKey(p types.Program) string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.Channel + "|" + p.Start
+}
+
+// diffPrograms compares two guides by program ID. Programs that simply aired
+// and dropped out of the guide (ended before now) are not removals.
+func diffPrograms(old, updated []types.Program, now time.Time) guideChangeSet {
+	set := guideChangeSet{At: now}
+	before := make(map[string]types.Program, len(old))
+	for _, p := range old {
+		before[programKey(p)] = p
+	}
+	for _, p := range updated {
+		key := programKey(p)
+		prev, ok := before[key]
+		switch {
+		case !ok:
+			set.Added = append(set.Added, p)
+		case !reflect.DeepEqual(prev, p):
+			set.Updated = append(set.Updated, p)
+		}
+		delete(before, key)
+	}
+	for _, p := range old {
+		if _, ok := before[programKey(p)]; !ok {
+			continue
+		}
+		if end, err := time.Parse(time.RFC3339, p.End); err == nil && !end.After(now) {
+			continue
+		}
+		set.Removed = append(set.Removed, p)
+	}
+	return set
+}
+
+// record adds a change set. The first call only marks the start of the log,
+// since the initial load has nothing to compare against.
+func (l *guideChangeLog) record(set guideChangeSet, initial bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if initial {
+		l.start = set.At
+		l.sets = nil
+		return
+	}
+	l.sets = append(l.sets, set)
+	if over := len(l.sets) - l.size; over > 0 {
+		l.start = l.sets[over-1].At
+		l.sets = append([]guideChangeSet(nil), l.sets[over:]...)
+	}
+}
+
+// since merges every change set recorded after t into the net change, with
+// At set to the newest reload. ok is false when t is before the horizon of
+// the log.
+func (l *guideChangeLog) since(t time.Time) (guideChangeSet, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	type net struct {
+		existed, exists bool
+		prog            types.Program
+	}
+	state := make(map[string]*net)
+	var order []string
+	apply := func(progs []types.Program, existed, exists bool) {
+		for _, p := range progs {
+			key := programKey(p)
+			n, ok := state[key]
+			if !ok {
+				n = &net{existed: existed}
+				state[key] = n
+				order = append(order, key)
+			}
+			n.exists, n.prog = exists, p
+		}
+	}
+
+	merged := guideChangeSet{At: l.start}
+	if len(l.sets) > 0 {
+		merged.At = l.sets[len(l.sets)-1].At
+	}
+	for _, set := range l.sets {
+		if !set.At.After(t) {
+			continue
+		}
+		apply(set.Removed, true, false)
+		apply(set.Added, false, true)
+		apply(set.Updated, true, true)
+	}
+	for _, key := range order {
+		n := state[key]
+		switch {
+		case !n.existed && n.exists:
+			merged.Added = append(merged.Added, n.prog)
+		case n.existed && !n.exists:
+			merged.Removed = append(merged.Removed, n.prog)
+		case n.existed && n.exists:
+			merged.Updated = append(merged.Updated, n.prog)
+		}
+	}
+	return merged, !t.Before(l.start)
+}
+
+// previous returns the time of the reload before the newest one, so that
+// since(previous()) is the last reload's change set.
+func (l *guideChangeLog) previous() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.sets) < 2 {
+		return l.start
+	}
+	return l.sets[len(l.sets)-2].At
+}
+
+type GuideChanges struct {
+	Since   time.Time       `json:"since"`
+	Until   time.Time       `json:"until"`
+	Reset   bool            `json:"reset"`
+	Added   []types.Program `json:"added"`
+	Removed []types.Program `json:"removed"`
+	Updated []types.Program `json:"updated"`
+}
+
+// getGuideChanges returns the programs added, removed or updated since the
+// given time, or by the last guide reload when since is omitted. reset tells
+// the client the log does not reach back that far and it should fetch the
+// whole guide instead.
+func (a *App) getGuideChanges(w http.ResponseWriter, r *http.Request) {
+	since := a.guideChanges.previous()
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid since, want RFC 3339", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	set, ok := a.guideChanges.since(since)
+	resp := GuideChanges{
+		Since:   since,
+		Until:   set.At,
+		Reset:   !ok,
+		Added:   nonNilPrograms(set.Added),
+		Removed: nonNilPrograms(set.Removed),
+		Updated: nonNilPrograms(set.Updated),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp) //nolint: errcheck
+}
+
+func nonNilPrograms(p []types.Program) []types.Program {
+	if p == nil {
+		return []types.Program{}
+	}
+	return p
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func guideProgram(id, title string, start time.Time) types.Program {
+	return types.Program{
+		ID:    id,
+		Title: title,
+		Start: start.Format(time.RFC3339),
+		End:   start.Add(time.Hour).Format(time.RFC3339),
+	}
+}
+
+func TestDiffPrograms(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	old := []types.Program{
+		guideProgram("aired", "Morning Show", now.Add(-3*time.Hour)),
+		guideProgram("same", "News", now),
+		guideProgram("changed", "Movie", now.Add(time.Hour)),
+		guideProgram("dropped", "Special", now.Add(2*time.Hour)),
+	}
+	updated := []types.Program{
+		guideProgram("same", "News", now),
+		guideProgram("changed", "Movie (Edited)", now.Add(time.Hour)),
+		guideProgram("new", "Replacement", now.Add(2*time.Hour)),
+	}
+
+	set := diffPrograms(old, updated, now)
+	if len(set.Added) != 1 || set.Added[0].ID != "new" {
+		t.Errorf("added = %+v", set.Added)
+	}
+	if len(set.Updated) != 1 || set.Updated[0].Title != "Movie (Edited)" {
+		t.Errorf("updated = %+v", set.Updated)
+	}
+	if len(set.Removed) != 1 || set.Removed[0].ID != "dropped" {
+		t.Errorf("removed = %+v, want only the program that had not aired", set.Removed)
+	}
+}
+
+func TestGuideChangeLogSince(t *testing.T) {
+	l := newGuideChangeLog(2)
+	t0 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	p := func(id, title string) types.Program { return types.Program{ID: id, Title: title} }
+
+	l.record(guideChangeSet{At: t0}, true)
+	l.record(guideChangeSet{At: t0.Add(time.Hour), Added: []types.Program{p("a", "A"), p("b", "B")}, Removed: []types.Program{p("x", "X")}}, false)
+	l.record(guideChangeSet{At: t0.Add(2 * time.Hour), Removed: []types.Program{p("a", "A")}, Updated: []types.Program{p("b", "B2")}}, false)
+
+	set, ok := l.since(t0)
+	if !ok {
+		t.Fatal("expected the log to cover its start")
+	}
+	if len(set.Added) != 1 || set.Added[0].Title != "B2" || len(set.Removed) != 1 || set.Removed[0].ID != "x" || len(set.Updated) != 0 {
+		t.Errorf("net change = %+v", set)
+	}
+	if !set.At.Equal(t0.Add(2 * time.Hour)) {
+		t.Errorf("At = %s, want the newest reload", set.At)
+	}
+
+	if set, _ := l.since(l.previous()); len(set.Removed) != 1 || set.Removed[0].ID != "a" || len(set.Updated) != 1 {
+		t.Errorf("last reload = %+v", set)
+	}
+
+	// A third reload pushes the first out of the log.
+	l.record(guideChangeSet{At: t0.Add(3 * time.Hour)}, false)
+	if _, ok := l.since(t0); ok {
+		t.Error("expected since before the horizon to need a reset")
+	}
+}
+
+func TestLoadGuideChanges(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.config.GuideFile = filepath.Join(t.TempDir(), "guide.json")
+	mock := app.commander.(*MockCommander)
+	mock.StatFunc = os.Stat
+	mock.OpenFunc = os.Open
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Hour)
+	writeGuide := func(programs ...types.Program) {
+		data, _ := json.Marshal(types.Guide{Programs: programs, Generated: time.Now().Format(time.RFC3339)})
+		if err := os.WriteFile(app.config.GuideFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+
+	writeGuide(guideProgram("1", "News", start))
+	app.loadGuide()
+	writeGuide(guideProgram("1", "News", start), guideProgram("2", "Late Movie", start.Add(time.Hour)))
+	app.loadGuide()
+
+	select {
+	case e := <-events:
+		if e.Type != "guide.updated" {
+			t.Errorf("got %s event", e.Type)
+		}
+	default:
+		t.Fatal("expected a guide.updated event after the second load only")
+	}
+	if len(events) != 0 {
+		t.Error("the initial load should not publish changes")
+	}
+
+	rr := httptest.NewRecorder()
+	app.getGuideChanges(rr, httptest.NewRequest("GET", "/api/guide/changes", nil))
+	var resp GuideChanges
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reset || len(resp.Added) != 1 || resp.Added[0].ID != "2" || len(resp.Removed) != 0 {
+		t.Errorf("unexpected changes %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	app.getGuideChanges(rr, httptest.NewRequest("GET", "/api/guide/changes?since=2020-01-01T00:00:00Z", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Reset {
+		t.Error("expected reset for a time before the server started")
+	}
+
+	rr = httptest.NewRecorder()
+	app.getGuideChanges(rr, httptest.NewRequest("GET", "/api/guide/changes?since=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
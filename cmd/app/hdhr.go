@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// The DVR can answer as an HDHomeRun tuner itself, so that Plex, Emby or
+// Channels DVR watch live TV through it rather than taking tuners behind
+// its back. Their streams are proxied from the real tuner and counted with
+// the captures; a recording that finds every tuner busy stops the oldest
+// live stream.
+
+// emulationRoutes are the routes of the emulated tuner, served at the
+// root like a real one's, and of the IPTV playlist and guide pointing at its
+// streams.
+var emulationRoutes = []string{"/discover.json", "/lineup.json", "/lineup_status.json", "/auto/v{channel}", "/playlist.m3u", "/xmltv.xml"}
+
+// EmulatedDevice is the emulated tuner's discover.json.
+type EmulatedDevice struct {
+	FriendlyName    string
+	ModelNumber     string
+	FirmwareName    string
+	FirmwareVersion string
+	DeviceID        string
+	BaseURL         string
+	LineupURL       string
+	TunerCount      int
+}
+
+// EmulatedChannel is one lineup.json entry.
+type EmulatedChannel struct {
+	GuideNumber string
+	GuideName   string
+	VideoCodec  string `json:",omitempty"`
+	AudioCodec  string `json:",omitempty"`
+	HD          int    `json:",omitempty"`
+	URL         string
+}
+
+// liveStream is a live stream proxied to an emulation client.
+type liveStream struct {
+	channel string
+	client  string
+	started time.Time
+	stop    context.CancelFunc
+}
+
+// flushWriter flushes each write, so live video reaches the client as the
+// tuner sends it.
+type flushWriter struct{ w http.ResponseWriter }
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = http.NewResponseController(f.w).Flush()
+	}
+	return n, err
+}
+
+// tunersInUse counts the captures running and the live streams proxied.
+func (a *App) tunersInUse() int {
+	a.liveMu.Lock()
+	defer a.liveMu.Unlock()
+	return a.tunersInUseLocked()
+}
+
+// tunersInUseLocked is tunersInUse for callers holding liveMu.
+func (a *App) tunersInUseLocked() int {
+	n := len(a.liveStreams)
+	a.runningProcesses.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// acquireLiveTuner takes a tuner for a live stream of channel, if one is
+// free. The stream ends when the returned context is done, which happens
+// when ctx is or a recording needs the tuner back.
+func (a *App) acquireLiveTuner(ctx context.Context, channel, client string) (context.Context, *liveStream, bool) {
+	a.liveMu.Lock()
+	defer a.liveMu.Unlock()
+	if a.tunerCount > 0 && a.tunersInUseLocked() >= a.tunerCount {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &liveStream{channel: channel, client: client, started: time.Now(), stop: cancel}
+	a.liveStreams = append(a.liveStreams, s)
+	return ctx, s, true
+}
+
+// releaseLiveTuner gives back the tuner of a live stream that ended.
+func (a *App) releaseLiveTuner(s *liveStream) {
+	s.stop()
+	a.liveMu.Lock()
+	defer a.liveMu.Unlock()
+	a.liveStreams = slices.DeleteFunc(a.liveStreams, func(l *liveStream) bool { return l == s })
+}
+
+// preemptLiveStream stops the oldest live stream when every tuner is in
+// use, for a capture about to start. It returns the stream stopped, or nil.
+func (a *App) preemptLiveStream() *liveStream {
+	a.liveMu.Lock()
+	defer a.liveMu.Unlock()
+	if len(a.liveStreams) == 0 || a.tunerCount <= 0 || a.tunersInUseLocked() < a.tunerCount {
+		return nil
+	}
+	s := a.liveStreams[0]
+	a.liveStreams = a.liveStreams[1:]
+	s.stop()
+	return s
+}
+
+// deviceClient reports whether r is from an allowlisted client of the
+// emulated tuner, the record engine or the DLNA server. Such clients cannot
+// send credentials, so they are let through without.
+func deviceClient(cfg *pkgcfg.Config, r *http.Request, route string) bool {
+	if e := cfg.Emulation; e != nil && slices.Contains(emulationRoutes, route) && inNetworks(r, e.Allowlist) {
+		return true
+	}
+	if e := cfg.RecordEngine; e != nil && slices.Contains(recordEngineRoutes, route) && inNetworks(r, e.Allowlist) {
+		return true
+	}
+	d := cfg.DLNA
+	return d != nil && slices.Contains(dlnaRoutes, route) && inNetworks(r, d.Allowlist)
+}
+
+// emulation returns the emulation settings, answering 404 when emulation
+// is off.
+func (a *App) emulation(w http.ResponseWriter, r *http.Request) *pkgcfg.Emulation {
+	e := a.cfg().Emulation
+	if e == nil {
+		http.NotFound(w, r)
+	}
+	return e
+}
+
+// deviceBaseURL returns configured, the DVR's address as set for an
+// emulated device, or else the address r came in on.
+func (a *App) deviceBaseURL(r *http.Request, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + a.cfg().BasePath
+}
+
+// serveDiscover serves GET /discover.json.
+func (a *App) serveDiscover(w http.ResponseWriter, r *http.Request) {
+	e := a.emulation(w, r)
+	if e == nil {
+		return
+	}
+	base := a.deviceBaseURL(r, e.BaseURL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EmulatedDevice{ //nolint: errcheck
+		FriendlyName:    e.FriendlyName,
+		ModelNumber:     "HDTC-2US",
+		FirmwareName:    "hdhomeruntc_atsc",
+		FirmwareVersion: "20200101",
+		DeviceID:        e.DeviceID,
+		BaseURL:         base,
+		LineupURL:       base + "/lineup.json",
+		TunerCount:      a.tunerCount,
+	})
+}
+
+// serveLineupStatus serves GET /lineup_status.json. Channel scans are run
+// from the DVR's own API, so clients are told none is possible.
+func (a *App) serveLineupStatus(w http.ResponseWriter, r *http.Request) {
+	if a.emulation(w, r) == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{ //nolint: errcheck
+		"ScanInProgress": 0,
+		"ScanPossible":   0,
+		"Source":         "Antenna",
+		"SourceList":     []string{"Antenna"},
+	})
+}
+
+// lineupChannels returns the enabled channels, leaving out restricted ones
+// unless r unlocks them, each with the URL to stream it through the DVR.
+func (a *App) lineupChannels(r *http.Request, base string) ([]EmulatedChannel, error) {
+	rows, err := a.dbQueryContext(r.Context(), `
+		SELECT c.guide_number, c.guide_name, COALESCE(l.video_codec, ''), COALESCE(l.audio_codec, ''), COALESCE(l.hd, 0)
+		FROM channels c
+		LEFT JOIN channel_lineup l ON l.guide_number = c.guide_number
+		WHERE c.enabled = 1
+		ORDER BY c.guide_number`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	parental := a.cfg().Parental
+	hideRestricted := parental != nil && !a.parentalUnlocked(r, parental)
+	lineup := []EmulatedChannel{}
+	for rows.Next() {
+		var ch EmulatedChannel
+		var hd bool
+		if err := rows.Scan(&ch.GuideNumber, &ch.GuideName, &ch.VideoCodec, &ch.AudioCodec, &hd); err != nil {
+			return nil, err
+		}
+		if hideRestricted && channelRestricted(parental, ch.GuideNumber) {
+			continue
+		}
+		if hd {
+			ch.HD = 1
+		}
+		ch.URL = base + "/auto/v" + ch.GuideNumber
+		lineup = append(lineup, ch)
+	}
+	return lineup, rows.Err()
+}
+
+// serveLineup serves GET /lineup.json: the enabled channels, each streamed
+// through the DVR. Restricted channels are left out unless unlocked.
+func (a *App) serveLineup(w http.ResponseWriter, r *http.Request) {
+	e := a.emulation(w, r)
+	if e == nil {
+		return
+	}
+	lineup, err := a.lineupChannels(r, a.deviceBaseURL(r, e.BaseURL))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lineup) //nolint: errcheck
+}
+
+// serveLiveStream serves GET /auto/v{channel}, proxying the channel's
+// stream from the real tuner for as long as the client reads it, or until
+// a recording needs the tuner. With every tuner busy it answers 503 with
+// the error a real tuner gives.
+func (a *App) serveLiveStream(w http.ResponseWriter, r *http.Request) {
+	if a.emulation(w, r) == nil {
+		return
+	}
+	number := mux.Vars(r)["channel"]
+	logger := requestLogger(r).With("channel", number)
+
+	var url string
+	err := a.dbQueryRowContext(r.Context(), "SELECT url FROM channels WHERE guide_number = ? AND enabled = 1", number).Scan(&url)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Unknown channel", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p := a.cfg().Parental; channelRestricted(p, number) && !a.parentalUnlocked(r, p) {
+		http.Error(w, "Unknown channel", http.StatusNotFound)
+		return
+	}
+
+	ctx, stream, ok := a.acquireLiveTuner(r.Context(), number, r.RemoteAddr)
+	if !ok {
+		logger.Info("Refused live stream, all tuners in use")
+		w.Header().Set("X-HDHomeRun-Error", "805 All Tuners In Use")
+		http.Error(w, "All tuners in use", http.StatusServiceUnavailable)
+		return
+	}
+	defer a.releaseLiveTuner(stream)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Warn("Error opening live stream", "err", err)
+		http.Error(w, "Tuner unavailable", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("Tuner refused live stream", "status", resp.StatusCode, "tuner_error", resp.Header.Get("X-HDHomeRun-Error"))
+		if msg := resp.Header.Get("X-HDHomeRun-Error"); msg != "" {
+			w.Header().Set("X-HDHomeRun-Error", msg)
+		}
+		http.Error(w, "Tuner refused the stream: "+resp.Status, resp.StatusCode)
+		return
+	}
+
+	noWriteTimeout(w)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "video/mpeg"
+	}
+	w.Header().Set("Content-Type", contentType)
+	logger.Info("Live stream started")
+	n, err := io.Copy(flushWriter{w}, resp.Body)
+	preempted := ctx.Err() != nil && r.Context().Err() == nil
+	logger.Info("Live stream ended", "bytes", n, "seconds", int(time.Since(stream.started).Seconds()), "preempted", preempted, "err", err)
+}
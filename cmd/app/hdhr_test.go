@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// emulationRouter routes the emulated tuner's endpoints as main does.
+func emulationRouter(app *App) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/discover.json", app.serveDiscover).Methods("GET")
+	r.HandleFunc("/lineup.json", app.serveLineup).Methods("GET")
+	r.HandleFunc("/lineup_status.json", app.serveLineupStatus).Methods("GET")
+	r.HandleFunc("/auto/v{channel}", app.serveLiveStream).Methods("GET")
+	return r
+}
+
+func TestEmulatedTuner(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	router := emulationRouter(app)
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('7.1', 'KGO', 'http://tuner/auto/v7.1', 0)",
+		"INSERT INTO channel_lineup (guide_number, video_codec, audio_codec, hd, last_seen) VALUES ('5.1', 'MPEG2', 'AC3', 1, '2026-03-01 12:00:00')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Host = "dvr.lan:8080"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := get("/discover.json"); rr.Code != http.StatusNotFound {
+		t.Errorf("discover.json with emulation off: %d", rr.Code)
+	}
+
+	app.config.Emulation = &pkgcfg.Emulation{DeviceID: "1234ABCD", FriendlyName: "hdhr-dvr"}
+	var dev EmulatedDevice
+	if err := json.NewDecoder(get("/discover.json").Body).Decode(&dev); err != nil {
+		t.Fatal(err)
+	}
+	if dev.DeviceID != "1234ABCD" || dev.BaseURL != "http://dvr.lan:8080" || dev.LineupURL != "http://dvr.lan:8080/lineup.json" || dev.TunerCount != 2 {
+		t.Errorf("discover.json %+v", dev)
+	}
+
+	var lineup []EmulatedChannel
+	if err := json.NewDecoder(get("/lineup.json").Body).Decode(&lineup); err != nil {
+		t.Fatal(err)
+	}
+	if len(lineup) != 1 || lineup[0].URL != "http://dvr.lan:8080/auto/v5.1" || lineup[0].HD != 1 || lineup[0].VideoCodec != "MPEG2" {
+		t.Errorf("lineup.json %+v", lineup)
+	}
+
+	app.config.Emulation.BaseURL = "https://dvr.example.com"
+	if err := json.NewDecoder(get("/discover.json").Body).Decode(&dev); err != nil || dev.LineupURL != "https://dvr.example.com/lineup.json" {
+		t.Errorf("discover.json with a base URL %+v, %v", dev, err)
+	}
+	if rr := get("/auto/v7.1"); rr.Code != http.StatusNotFound {
+		t.Errorf("disabled channel streamed: %d", rr.Code)
+	}
+
+	// With reads protected, clients on the allowlist still need no key.
+	app.config.Auth = pkgcfg.Auth{Enabled: true, ProtectReads: true}
+	app.config.Emulation.Allowlist = []string{"192.168.1.0/24"}
+	router.Use(app.requireAuth)
+	for remote, want := range map[string]int{"192.168.1.20:1": http.StatusOK, "192.0.2.1:1": http.StatusUnauthorized} {
+		req := httptest.NewRequest("GET", "/lineup.json", nil)
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("lineup.json from %s: %d, want %d", remote, rr.Code, want)
+		}
+	}
+}
+
+func TestLiveStreamTunerPool(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	// One connection, so the server's requests share the in-memory database.
+	db.SetMaxOpenConns(1)
+	app.tunerCount = 1
+	app.config.Emulation = &pkgcfg.Emulation{DeviceID: "1234ABCD", FriendlyName: "hdhr-dvr"}
+
+	// The tuner streams until the DVR hangs up.
+	tuner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mpeg")
+		w.Write([]byte("G")) //nolint: errcheck
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer tuner.Close()
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', ?, 1)", tuner.URL+"/auto/v5.1"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(emulationRouter(app))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/auto/v5.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || resp.StatusCode != http.StatusOK || string(buf) != "G" {
+		t.Fatalf("live stream %d %q, %v", resp.StatusCode, buf, err)
+	}
+	if n := app.tunersInUse(); n != 1 {
+		t.Errorf("%d tuners in use while streaming", n)
+	}
+
+	busy, err := http.Get(srv.URL + "/auto/v5.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy.Body.Close() //nolint: errcheck
+	if busy.StatusCode != http.StatusServiceUnavailable || busy.Header.Get("X-HDHomeRun-Error") != "805 All Tuners In Use" {
+		t.Errorf("second stream %d %q", busy.StatusCode, busy.Header.Get("X-HDHomeRun-Error"))
+	}
+
+	// A recording takes the tuner back.
+	if s := app.preemptLiveStream(); s == nil || s.channel != "5.1" {
+		t.Fatalf("preempted %+v", s)
+	}
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body) //nolint: errcheck
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("live stream kept running after being preempted")
+	}
+	if n := app.tunersInUse(); n != 0 {
+		t.Errorf("%d tuners in use after preemption", n)
+	}
+	if s := app.preemptLiveStream(); s != nil {
+		t.Errorf("preempted %+v with nothing streaming", s)
+	}
+
+	app.runningProcesses.Store(1, struct{}{})
+	defer app.runningProcesses.Delete(1)
+	if _, _, ok := app.acquireLiveTuner(t.Context(), "5.1", "test"); ok {
+		t.Error("live stream took the tuner a capture holds")
+	}
+}
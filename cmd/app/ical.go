@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The schedule is also an iCalendar feed, so a calendar app subscribed to
+// it shows when the tuners are busy and with what.
+
+// icalTime is the UTC date-time format of iCalendar.
+const icalTime = "20060102T150405Z"
+
+// icalEscape escapes text for an iCalendar property value.
+var icalEscape = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalLine writes a content line, folded to 75 octets as RFC 5545 asks
+// without splitting a UTF-8 character.
+func icalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation counts towards its length.
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// serveScheduleICS serves GET /schedule.ics and its alias under /api/v1:
+// the recordings not yet over as events, from the start to the end of the
+// capture, padding included.
+func (a *App) serveScheduleICS(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.dbQueryContext(r.Context(), `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.status, COALESCE(r.title, ''),
+		       COALESCE(c.guide_name, ''), COALESCE(m.title, ''), COALESCE(m.subtitle, ''), COALESCE(m.description, ''),
+		       COALESCE(m.category, '')
+		FROM recordings r
+		LEFT JOIN channels c ON c.guide_number = r.channel_id
+		LEFT JOIN recording_metadata m ON m.recording_id = r.id
+		WHERE r.status IN ('pending', 'waiting', 'recording')
+		ORDER BY r.date, r.start_time`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+
+	loc, _ := a.getLocalLocation()
+	before, after := a.padding()
+	parental := a.cfg().Parental
+	hideRestricted := parental != nil && !a.parentalUnlocked(r, parental)
+	now := time.Now()
+	var b strings.Builder
+	icalLine(&b, "BEGIN:VCALENDAR")
+	icalLine(&b, "VERSION:2.0")
+	icalLine(&b, "PRODID:-//hdhr-dvr//Recording schedule//EN")
+	icalLine(&b, "CALSCALE:GREGORIAN")
+	icalLine(&b, "X-WR-CALNAME:DVR recordings")
+	for rows.Next() {
+		var id, duration int
+		var channel, date, startTime, status, title, channelName, showTitle, subtitle, description, category string
+		if err := rows.Scan(&id, &channel, &date, &startTime, &duration, &status, &title,
+			&channelName, &showTitle, &subtitle, &description, &category); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hideRestricted && recordingRestricted(parental, channel, category) {
+			continue
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+startTime, loc)
+		if err != nil {
+			continue
+		}
+		end := start.Add(time.Duration(duration)*time.Minute + time.Duration(after)*time.Minute)
+		start = start.Add(-time.Duration(before) * time.Second)
+		if end.Before(now) {
+			continue
+		}
+		if showTitle != "" {
+			title = showTitle
+		}
+		if subtitle != "" {
+			title += " - " + subtitle
+		}
+		icalLine(&b, "BEGIN:VEVENT")
+		icalLine(&b, fmt.Sprintf("UID:recording-%d@hdhr-dvr", id))
+		icalLine(&b, "DTSTAMP:"+now.UTC().Format(icalTime))
+		icalLine(&b, "DTSTART:"+start.UTC().Format(icalTime))
+		icalLine(&b, "DTEND:"+end.UTC().Format(icalTime))
+		icalLine(&b, "SUMMARY:"+icalEscape.Replace(title))
+		icalLine(&b, "LOCATION:"+icalEscape.Replace(strings.TrimSpace(channel+" "+channelName)))
+		if description != "" {
+			icalLine(&b, "DESCRIPTION:"+icalEscape.Replace(description))
+		}
+		if category != "" {
+			icalLine(&b, "CATEGORIES:"+icalEscape.Replace(category))
+		}
+		icalLine(&b, "STATUS:CONFIRMED")
+		icalLine(&b, "TRANSP:TRANSPARENT")
+		icalLine(&b, "END:VEVENT")
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	icalLine(&b, "END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(b.String())) //nolint: errcheck
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestScheduleICS(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Padding = &pkgcfg.Padding{BeforeSeconds: 60, AfterMinutes: 2}
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	long := strings.Repeat("A long description, with commas; and semicolons. ", 4)
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('9.1', 'KQED', 'http://tuner/auto/v9.1', 1)",
+		fmt.Sprintf("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '%s', '20:00', 60, 'pending', 'Nova')", tomorrow),
+		fmt.Sprintf("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '9.1', '%s', '21:00', 30, 'pending', 'Frontline')", tomorrow),
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (3, '5.1', '2026-03-01', '18:00', 30, 'completed', 'News')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (4, '5.1', '2020-03-01', '18:00', 30, 'pending', 'Stale')",
+		fmt.Sprintf("INSERT INTO recording_metadata (recording_id, title, subtitle, description) VALUES (1, 'NOVA', 'Black Holes', '%s')", long),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := app.newRouter()
+	get := func() string {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/schedule.ics", nil))
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Errorf("Content-Type %q", ct)
+		}
+		return rr.Body.String()
+	}
+
+	ics := get()
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 2 {
+		t.Fatalf("%d events:\n%s", n, ics)
+	}
+	day := strings.ReplaceAll(tomorrow, "-", "")
+	for _, want := range []string{
+		"UID:recording-1@hdhr-dvr\r\n",
+		"DTSTART:" + day + "T195900Z\r\n",
+		"DTEND:" + day + "T210200Z\r\n",
+		"SUMMARY:NOVA - Black Holes\r\n",
+		"LOCATION:5.1 KPIX\r\n",
+		"SUMMARY:Frontline\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, ics)
+		}
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:A long description\, with commas\; and semicolons.`) {
+		t.Errorf("description not escaped:\n%s", unfolded)
+	}
+
+	app.config.Parental = &pkgcfg.Parental{RestrictedChannels: []string{"9.1"}}
+	if ics := get(); strings.Contains(ics, "Frontline") {
+		t.Errorf("restricted recording listed:\n%s", ics)
+	}
+}
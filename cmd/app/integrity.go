@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Channels are never deleted: a rescan only disables the ones the tuner no
+// longer finds, and the foreign key from recordings restricts deleting a
+// channel that has any. Recordings made before foreign keys were enforced
+// may still name a channel that is gone; they are reported as orphaned.
+
+// orphanedRecordings returns the IDs and statuses of the recordings whose
+// channel is not in the channels table.
+func (a *App) orphanedRecordings(ctx context.Context) (map[int]string, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT r.id, r.status FROM recordings r
+		LEFT JOIN channels c ON c.guide_number = r.channel_id
+		WHERE c.guide_number IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+	orphans := map[int]string{}
+	for rows.Next() {
+		var id int
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		orphans[id] = status
+	}
+	return orphans, rows.Err()
+}
+
+// checkChannelIntegrity runs at startup. It fails the orphaned recordings
+// that have yet to record, as they have no stream to capture, and logs the
+// rest. On SQLite it also logs any other rows PRAGMA foreign_key_check
+// finds, left from before foreign keys were enforced.
+func (a *App) checkChannelIntegrity(ctx context.Context) {
+	orphans, err := a.orphanedRecordings(ctx)
+	if err != nil {
+		slog.Error("Error checking recordings for missing channels", "err", err)
+		return
+	}
+	for id, status := range orphans {
+		if status == statusPending || status == statusWaiting {
+			a.markFailed(id, "channel no longer exists")
+		}
+	}
+	if len(orphans) > 0 {
+		slog.Warn("Recordings refer to channels that no longer exist", "count", len(orphans))
+	}
+
+	if a.cfg().DBDriver == driverPostgres {
+		return
+	}
+	rows, err := a.dbQueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		slog.Error("Error checking foreign keys", "err", err)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+	violations := map[string]int{}
+	for rows.Next() {
+		var table, parent string
+		var rowid, fkid interface{}
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			slog.Error("Error reading foreign key check", "err", err)
+			return
+		}
+		violations[table+" -> "+parent]++
+	}
+	for ref, n := range violations {
+		slog.Warn("Rows refer to missing parents", "reference", ref, "count", n)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestOrphanedRecordings(t *testing.T) {
+	// The in-memory test database does not enforce foreign keys, like
+	// databases written before they were.
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('2.1', 'KTVU', 'http://tuner/auto/v2.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '2.1', '2026-03-01', '20:00', 60, 'completed', 'News')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '9.9', '2099-03-01', '20:00', 60, 'pending', 'Gone')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (3, '9.9', '2026-02-01', '20:00', 60, 'completed', 'Old')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.checkChannelIntegrity(context.Background())
+
+	statuses := map[int]string{}
+	rows, err := db.Query("SELECT id, status FROM recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id int
+		var status string
+		rows.Scan(&id, &status) //nolint: errcheck
+		statuses[id] = status
+	}
+	rows.Close() //nolint: errcheck
+	if statuses[1] != statusCompleted || statuses[2] != statusFailed || statuses[3] != statusCompleted {
+		t.Errorf("statuses %v", statuses)
+	}
+	if events, _ := app.recordingHistory(context.Background(), 2); len(events) != 1 || events[0].Reason != "channel no longer exists" {
+		t.Errorf("history %+v", events)
+	}
+
+	get := func(url string) []GetRecordingsRec {
+		rr := httptest.NewRecorder()
+		app.getRecordings(rr, httptest.NewRequest("GET", url, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", url, rr.Code, rr.Body)
+		}
+		var recs []GetRecordingsRec
+		json.NewDecoder(rr.Body).Decode(&recs) //nolint: errcheck
+		return recs
+	}
+	recs := get("/api/v1/recordings")
+	if len(recs) != 3 || recs[0].ID != 3 || !recs[0].Orphaned || recs[0].GuideName != "" || recs[1].Orphaned {
+		t.Errorf("recordings %+v", recs)
+	}
+	if recs := get("/api/v1/recordings?orphaned=true"); len(recs) != 2 || !recs[0].Orphaned || !recs[1].Orphaned {
+		t.Errorf("orphaned recordings %+v", recs)
+	}
+}
+
+func TestChannelDeleteRestricted(t *testing.T) {
+	db, err := openDB(filepath.Join(t.TempDir(), "recordings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() //nolint: errcheck
+	app := NewApp(&pkgcfg.Config{Timezone: "UTC"}, NewSQLStore(db), &MockCommander{})
+	app.createTables()
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('2.1', 'KTVU', 'http://tuner/auto/v2.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (channel_id, date, start_time, duration, status) VALUES ('9.9', '2026-03-01', '20:00', 60, 'pending')"); err == nil {
+		t.Error("recorded a channel that does not exist")
+	}
+	if _, err := db.Exec("INSERT INTO recordings (channel_id, date, start_time, duration, status) VALUES ('2.1', '2026-03-01', '20:00', 60, 'pending')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM channels WHERE guide_number = '2.1'"); err == nil {
+		t.Error("deleted a channel with recordings")
+	}
+}
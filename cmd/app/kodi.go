@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// kodiNotificationMillis is how long Kodi shows a notification.
+const kodiNotificationMillis = 10000
+
+// kodiNotifier shows notifications on a Kodi instance and rescans its video
+// library when a recording completes.
+type kodiNotifier struct {
+	cfg    pkgcfg.Kodi
+	url    string
+	client *http.Client
+}
+
+func newKodiNotifier(cfg pkgcfg.Kodi) *kodiNotifier {
+	return &kodiNotifier{
+		cfg:    cfg,
+		url:    strings.TrimRight(cfg.URL, "/") + "/jsonrpc",
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (k *kodiNotifier) name() string { return "kodi" }
+
+// call makes one JSON-RPC request and returns the error Kodi reports.
+func (k *kodiNotifier) call(ctx context.Context, method string, params interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", k.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if k.cfg.Username != "" {
+		req.SetBasicAuth(k.cfg.Username, k.cfg.Password)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("kodi %s: %s", method, resp.Status)
+	}
+	var r struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("kodi %s: %w", method, err)
+	}
+	if r.Error != nil {
+		return fmt.Errorf("kodi %s: %s (%d)", method, r.Error.Message, r.Error.Code)
+	}
+	return nil
+}
+
+func (k *kodiNotifier) notify(ctx context.Context, n Notification) error {
+	message := n.Message
+	if n.Recording != nil && n.Recording.Title != "" {
+		message = n.Recording.Title
+	}
+	err := k.call(ctx, "GUI.ShowNotification", map[string]interface{}{
+		"title":       n.Subject,
+		"message":     message,
+		"displaytime": kodiNotificationMillis,
+	})
+	if err != nil {
+		return err
+	}
+	if n.Event != eventRecordingCompleted {
+		return nil
+	}
+	scan := map[string]interface{}{}
+	if k.cfg.Path != "" {
+		scan["directory"] = k.cfg.Path
+	}
+	return k.call(ctx, "VideoLibrary.Scan", scan)
+}
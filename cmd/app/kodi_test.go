@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestKodiNotifier(t *testing.T) {
+	type rpc struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	var calls []rpc
+	var user, pass string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/jsonrpc" {
+			http.NotFound(w, r)
+			return
+		}
+		user, pass, _ = r.BasicAuth()
+		var c rpc
+		json.NewDecoder(r.Body).Decode(&c) //nolint: errcheck
+		calls = append(calls, c)
+		if c.Method == "VideoLibrary.Scan" && c.Params["directory"] == "smb://nas/missing/" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"Invalid params."}}`)) //nolint: errcheck
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"OK"}`)) //nolint: errcheck
+	}))
+	defer srv.Close()
+
+	entries := newNotifiers(pkgcfg.Notifications{Kodi: &pkgcfg.Kodi{URL: srv.URL + "/", Username: "kodi", Password: "pw", Path: "smb://nas/recordings/"}})
+	if len(entries) != 1 || !entries[0].wants(eventRecordingCompleted) || entries[0].wants(eventRecordingFailed) {
+		t.Fatalf("entries %+v", entries)
+	}
+	n := Notification{Event: eventRecordingCompleted, Subject: "Recording completed", Message: "Finished recording Nova (5.1)", Recording: &NotificationRecording{ID: 1, Title: "Nova"}}
+	if err := entries[0].notifier.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0].Method != "GUI.ShowNotification" || calls[1].Method != "VideoLibrary.Scan" {
+		t.Fatalf("calls %+v", calls)
+	}
+	if calls[0].Params["title"] != "Recording completed" || calls[0].Params["message"] != "Nova" {
+		t.Errorf("notification %v", calls[0].Params)
+	}
+	if calls[1].Params["directory"] != "smb://nas/recordings/" || user != "kodi" || pass != "pw" {
+		t.Errorf("scan %v as %s:%s", calls[1].Params, user, pass)
+	}
+
+	// Other events only show a notification.
+	calls = nil
+	n.Event = eventRecordingFailed
+	if err := entries[0].notifier.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("calls %+v", calls)
+	}
+
+	k := newKodiNotifier(pkgcfg.Kodi{URL: srv.URL, Path: "smb://nas/missing/"})
+	n.Event = eventRecordingCompleted
+	if err := k.notify(context.Background(), n); err == nil {
+		t.Error("JSON-RPC error not reported")
+	}
+}
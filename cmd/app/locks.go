@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ChannelLock reserves a tuner on a channel at the same time on the given
+// days of the week, e.g. for live viewing. Locks never record anything; they
+// only count against the tuners available to recordings.
+type ChannelLock struct {
+	ID        int      `json:"id"`
+	ChannelID string   `json:"channelId"`
+	Name      string   `json:"name,omitempty"`
+	Days      []string `json:"days"`      // "mon" .. "sun"
+	StartTime string   `json:"startTime"` // HH:MM
+	Duration  int      `json:"duration"`  // minutes
+	Enabled   bool     `json:"enabled"`
+}
+
+var lockWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// lockDayAliases expand to several days when a lock is created.
+var lockDayAliases = map[string][]string{
+	"daily":    lockWeekdays,
+	"weekdays": {"mon", "tue", "wed", "thu", "fri"},
+	"weekends": {"sat", "sun"},
+}
+
+// parseLockDays normalizes day names and aliases into weekday order.
+func parseLockDays(days []string) ([]string, bool) {
+	want := make(map[string]bool)
+	for _, d := range days {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if expanded, ok := lockDayAliases[d]; ok {
+			for _, e := range expanded {
+				want[e] = true
+			}
+			continue
+		}
+		if len(d) > 3 {
+			d = d[:3]
+		}
+		found := false
+		for _, w := range lockWeekdays {
+			if w == d {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+		want[d] = true
+	}
+
+	var out []string
+	for _, w := range lockWeekdays {
+		if want[w] {
+			out = append(out, w)
+		}
+	}
+	return out, len(out) > 0
+}
+
+// lockInterval is one occurrence of a lock.
+type lockInterval struct {
+	lock       ChannelLock
+	start, end time.Time
+}
+
+func (a *App) loadChannelLocks(ctx context.Context) ([]ChannelLock, error) {
+	rows, err := a.dbQueryContext(ctx, "SELECT id, channel_id, name, days, start_time, duration, enabled FROM channel_locks ORDER BY start_time, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	locks := []ChannelLock{}
+	for rows.Next() {
+		var l ChannelLock
+		var days string
+		if err := rows.Scan(&l.ID, &l.ChannelID, &l.Name, &days, &l.StartTime, &l.Duration, &l.Enabled); err != nil {
+			return nil, err
+		}
+		l.Days = strings.Split(days, ",")
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
+
+// lockIntervals expands the enabled locks into occurrences overlapping
+// [from, to), with lock times taken as wall-clock times in loc.
+func (a *App) lockIntervals(ctx context.Context, from, to time.Time, loc *time.Location) ([]lockInterval, error) {
+	locks, err := a.loadChannelLocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []lockInterval
+	for _, l := range locks {
+		if !l.Enabled {
+			continue
+		}
+		clock, err := time.Parse("15:04", l.StartTime)
+		if err != nil {
+			slog.Warn("Skipping channel lock with invalid start time", "lock_id", l.ID, "start_time", l.StartTime)
+			continue
+		}
+		days := make(map[string]bool, len(l.Days))
+		for _, d := range l.Days {
+			days[d] = true
+		}
+
+		// Start a day early so an occurrence running past midnight is included.
+		f := from.In(loc)
+		for d := time.Date(f.Year(), f.Month(), f.Day()-1, 0, 0, 0, 0, loc); d.Before(to); d = d.AddDate(0, 0, 1) {
+			if !days[lockWeekdays[d.Weekday()]] {
+				continue
+			}
+			start := time.Date(d.Year(), d.Month(), d.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+			end := start.Add(time.Duration(l.Duration) * time.Minute)
+			if start.Before(to) && end.After(from) {
+				out = append(out, lockInterval{lock: l, start: start, end: end})
+			}
+		}
+	}
+	return out, nil
+}
+
+func (a *App) getChannelLocks(w http.ResponseWriter, r *http.Request) {
+	locks, err := a.loadChannelLocks(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(locks); err != nil {
+		requestLogger(r).Error("Error encoding channel locks response", "err", err)
+	}
+}
+
+// ChannelLockRequest is the body of POST /api/locks.
+type ChannelLockRequest struct {
+	ChannelID string   `json:"channelId"`
+	Name      string   `json:"name"`
+	Days      []string `json:"days"`
+	StartTime string   `json:"startTime"`
+	Duration  int      `json:"duration"`
+	Enabled   *bool    `json:"enabled,omitempty"`
+}
+
+func (a *App) createChannelLock(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var req ChannelLockRequest
+	badRequest := func(msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint: errcheck
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest("Invalid request body")
+		return
+	}
+	if _, err := time.Parse("15:04", req.StartTime); err != nil {
+		badRequest("startTime must be HH:MM")
+		return
+	}
+	if req.Duration <= 0 {
+		badRequest("Duration must be positive")
+		return
+	}
+	days, ok := parseLockDays(req.Days)
+	if !ok {
+		badRequest("days must list weekdays (mon..sun) or weekdays, weekends, daily")
+		return
+	}
+
+	ctx := r.Context()
+	var channelExists bool
+	if err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM channels WHERE guide_number = ?)", req.ChannelID).Scan(&channelExists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !channelExists {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Channel not found"}) //nolint: errcheck
+		return
+	}
+
+	lock := ChannelLock{
+		ChannelID: req.ChannelID,
+		Name:      req.Name,
+		Days:      days,
+		StartTime: req.StartTime,
+		Duration:  req.Duration,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	}
+	result, err := a.store.ExecContext(ctx,
+		"INSERT INTO channel_locks (channel_id, name, days, start_time, duration, enabled) VALUES (?, ?, ?, ?, ?, ?)",
+		lock.ChannelID, lock.Name, strings.Join(lock.Days, ","), lock.StartTime, lock.Duration, lock.Enabled)
+	if err != nil {
+		requestLogger(r).Error("Error creating channel lock", "err", err)
+		http.Error(w, "Failed to create channel lock", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+	lock.ID = int(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(lock) //nolint: errcheck
+}
+
+func (a *App) deleteChannelLock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid lock ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := a.store.ExecContext(r.Context(), "DELETE FROM channel_locks WHERE id = ?", id)
+	if err != nil {
+		requestLogger(r).Error("Error deleting channel lock", "err", err)
+		http.Error(w, "Failed to delete channel lock", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Channel lock not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseLockDays(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+		ok   bool
+	}{
+		{[]string{"weekdays"}, []string{"mon", "tue", "wed", "thu", "fri"}, true},
+		{[]string{"Saturday", "sun", "sat"}, []string{"sun", "sat"}, true},
+		{[]string{"daily"}, lockWeekdays, true},
+		{[]string{"someday"}, nil, false},
+		{nil, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLockDays(tt.in)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLockDays(%v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestChannelLockHandlers(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, enabled) VALUES ('101', 'Test Channel', 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/locks", app.getChannelLocks).Methods("GET")
+	r.HandleFunc("/api/locks", app.createChannelLock).Methods("POST")
+	r.HandleFunc("/api/locks/{id}", app.deleteChannelLock).Methods("DELETE")
+
+	post := func(body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/api/locks", bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	bad := []map[string]interface{}{
+		{"channelId": "101", "days": []string{"weekdays"}, "startTime": "5pm", "duration": 60},
+		{"channelId": "101", "days": []string{"weekdays"}, "startTime": "17:00", "duration": 0},
+		{"channelId": "101", "days": []string{"someday"}, "startTime": "17:00", "duration": 60},
+	}
+	for _, body := range bad {
+		if rr := post(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: got code %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+	if rr := post(map[string]interface{}{"channelId": "999", "days": []string{"mon"}, "startTime": "17:00", "duration": 60}); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown channel: got code %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	rr := post(map[string]interface{}{"channelId": "101", "name": "Kids", "days": []string{"weekdays"}, "startTime": "17:00", "duration": 60})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got code %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var created ChannelLock
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/locks", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var locks []ChannelLock
+	if err := json.NewDecoder(rr.Body).Decode(&locks); err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || !reflect.DeepEqual(locks[0], created) || len(locks[0].Days) != 5 || !locks[0].Enabled {
+		t.Errorf("unexpected locks %+v, created %+v", locks, created)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req = httptest.NewRequest("DELETE", "/api/locks/1", nil)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("delete: got code %d, want %d", rr.Code, want)
+		}
+	}
+}
+
+func TestLockIntervals(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	_, err := db.Exec(`
+		INSERT INTO channel_locks (channel_id, days, start_time, duration, enabled) VALUES
+			('101', 'mon,tue,wed,thu,fri', '17:00', 60, 1),
+			('102', 'sat', '23:30', 60, 1),
+			('103', 'mon,tue,wed,thu,fri,sat,sun', '08:00', 60, 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Friday 2026-07-17 00:00 through Sunday 2026-07-19 12:00.
+	from := time.Date(2026, 7, 17, 0, 0, 0, 0, time.UTC)
+	intervals, err := app.lockIntervals(context.Background(), from, from.Add(60*time.Hour), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, l := range intervals {
+		got = append(got, l.lock.ChannelID+"@"+l.start.Format("2006-01-02T15:04")+"-"+l.end.Format("15:04"))
+	}
+	want := []string{"101@2026-07-17T17:00-18:00", "102@2026-07-18T23:30-00:30"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestChannelLocksTakeTuners(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	// Tuesday 17:00-18:00 is locked, leaving one of the two tuners.
+	_, err := db.Exec(`
+		INSERT INTO channels (guide_number, guide_name, enabled) VALUES ('101', 'Test Channel', 1);
+		INSERT INTO channel_locks (channel_id, name, days, start_time, duration) VALUES ('101', 'Kids', 'tue', '17:00', 60);
+		INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES
+			(1, '101', '2026-07-14', '17:00', 30, 'pending'),
+			(2, '101', '2026-07-14', '17:15', 30, 'pending')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 7, 14, 12, 0, 0, 0, time.UTC)
+	f, err := app.buildForecast(context.Background(), now, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Locks) != 1 || f.Locks[0].Tuner != 0 || f.Locks[0].Name != "Kids" {
+		t.Fatalf("unexpected locks %+v", f.Locks)
+	}
+	if f.Recordings[0].Tuner != 1 || f.Recordings[1].Tuner != -1 {
+		t.Errorf("unexpected tuner assignment %+v", f.Recordings)
+	}
+	if len(f.Problems) != 1 || f.Problems[0].RecordingID != 2 || f.Problems[0].Type != "tuner_conflict" {
+		t.Errorf("unexpected problems %+v", f.Problems)
+	}
+
+	available, err := app.isTunerAvailable(context.Background(), RecordingRequest{Date: "2026-07-14", StartTime: "17:30", Duration: 30})
+	if err != nil || available {
+		t.Errorf("expected no tuner during the lock, got %v (err: %v)", available, err)
+	}
+	available, err = app.isTunerAvailable(context.Background(), RecordingRequest{Date: "2026-07-15", StartTime: "17:30", Duration: 30})
+	if err != nil || !available {
+		t.Errorf("expected a tuner on Wednesday, got %v (err: %v)", available, err)
+	}
+}
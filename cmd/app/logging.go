@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// logLevel is the minimum level logged. It is a LevelVar so it can be
+// changed while the server runs.
+var logLevel = new(slog.LevelVar)
+
+// requestIDHeader carries a request's ID in both directions, so a proxy's
+// ID is reused and clients can quote the one they were given.
+const requestIDHeader = "X-Request-ID"
+
+// parseLogLevel accepts debug, info, warn and error, in any case. Empty
+// means info.
+func parseLogLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return l, nil
+}
+
+// newLogHandler returns a handler writing to w as "text" (key=value, the
+// default) or "json", filtered by logLevel.
+func newLogHandler(w io.Writer, format string) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// setupLogging makes slog, and the standard log package through it, write
+// to w with the configured level and format.
+func setupLogging(w io.Writer, level, format string) error {
+	l, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	h, err := newLogHandler(w, format)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(l)
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// recordingLogger tags a recording's log lines so one capture can be
+// followed from start to finish, e.g. with grep recording_id=42.
+func recordingLogger(r types.Recording) *slog.Logger {
+	return slog.With("recording_id", r.ID, "channel", r.ChannelID)
+}
+
+type loggerKey struct{}
+
+// newRequestID returns 16 random hex digits.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b) //nolint: errcheck
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether an incoming ID is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID is router middleware that gives each request an ID, returns
+// it in X-Request-ID and puts a logger carrying it in the request context.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		logger := slog.Default().With("request_id", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger)))
+	})
+}
+
+// requestLogger returns the logger withRequestID stored for r, or the
+// default logger outside the router.
+func requestLogger(r *http.Request) *slog.Logger {
+	if l, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// levelRevert is the pending timer of a temporary log level change.
+var (
+	levelRevertMu sync.Mutex
+	levelRevert   *time.Timer
+)
+
+// setLogLevel changes the log level until the next change or restart. A
+// positive revertAfter restores the previous level once it has passed.
+func setLogLevel(l slog.Level, revertAfter time.Duration) {
+	levelRevertMu.Lock()
+	defer levelRevertMu.Unlock()
+	if levelRevert != nil {
+		levelRevert.Stop()
+		levelRevert = nil
+	}
+	prev := logLevel.Level()
+	logLevel.Set(l)
+	slog.Warn("Log level changed", "from", prev, "to", l, "for", revertAfter)
+	if revertAfter > 0 {
+		levelRevert = time.AfterFunc(revertAfter, func() {
+			logLevel.Set(prev)
+			slog.Warn("Log level reverted", "to", prev)
+		})
+	}
+}
+
+// getLogLevel returns the current log level.
+func (a *App) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"level": strings.ToLower(logLevel.Level().String())}) //nolint: errcheck
+}
+
+// LogLevelRequest is the body of PUT /api/admin/loglevel.
+type LogLevelRequest struct {
+	Level string `json:"level"`
+	For   string `json:"for"`
+}
+
+// putLogLevel sets the log level from {"level": "debug"}, optionally with
+// "for": "30m" to go back to the previous level afterwards.
+func (a *App) putLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Level == "" {
+		http.Error(w, "level is required", http.StatusBadRequest)
+		return
+	}
+	l, err := parseLogLevel(req.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var revertAfter time.Duration
+	if req.For != "" {
+		revertAfter, err = time.ParseDuration(req.For)
+		if err != nil || revertAfter <= 0 {
+			http.Error(w, "for must be a positive duration such as 30m", http.StatusBadRequest)
+			return
+		}
+	}
+	setLogLevel(l, revertAfter)
+	a.getLogLevel(w, r)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	old, oldLevel := slog.Default(), logLevel.Level()
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "debug", format); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		slog.SetDefault(old)
+		logLevel.Set(oldLevel)
+	})
+	return &buf
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := parseLogLevel(in); err != nil || got != want {
+			t.Errorf("%q: got %v, %v", in, got, err)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("accepted an unknown level")
+	}
+	if _, err := newLogHandler(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("accepted an unknown format")
+	}
+}
+
+func TestRecordingLogger(t *testing.T) {
+	buf := captureLogs(t, "json")
+	recordingLogger(types.Recording{ID: 42, ChannelID: "5.1"}).Info("Capture started")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, buf)
+	}
+	if line["msg"] != "Capture started" || line["recording_id"] != float64(42) || line["channel"] != "5.1" || line["level"] != "INFO" {
+		t.Errorf("got %v", line)
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	buf := captureLogs(t, "text")
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLogger(r).Error("Error encoding response")
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings", nil))
+	id := rr.Header().Get(requestIDHeader)
+	if len(id) != 16 {
+		t.Fatalf("generated ID %q", id)
+	}
+	if !strings.Contains(buf.String(), "level=ERROR msg=\"Error encoding response\" request_id="+id) {
+		t.Errorf("log lacks the request ID:\n%s", buf)
+	}
+
+	// A proxy's ID is kept; one that is unsafe to log is replaced.
+	req := httptest.NewRequest("GET", "/api/recordings", nil)
+	req.Header.Set(requestIDHeader, "proxy-123")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got != "proxy-123" {
+		t.Errorf("got %q", got)
+	}
+	req.Header.Set(requestIDHeader, "bad\nid")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got == "bad\nid" || len(got) != 16 {
+		t.Errorf("got %q", got)
+	}
+
+	// Outside the middleware the default logger is used.
+	if requestLogger(httptest.NewRequest("GET", "/", nil)) != slog.Default() {
+		t.Error("expected the default logger")
+	}
+}
+
+func TestPutLogLevel(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	buf := captureLogs(t, "text")
+	logLevel.Set(slog.LevelInfo)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/admin/loglevel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.putLogLevel(rr, req)
+		return rr
+	}
+
+	if rr := put(`{"level":"debug"}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"level":"debug"`) {
+		t.Fatalf("got %d %s", rr.Code, rr.Body)
+	}
+	slog.Debug("Probe")
+	if !strings.Contains(buf.String(), "msg=Probe") {
+		t.Error("debug line not logged after switching to debug")
+	}
+
+	for _, body := range []string{`{}`, `{"level":"verbose"}`, `{"level":"info","for":"soon"}`, `{"level":"info","for":"-1m"}`} {
+		if rr := put(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", body, rr.Code)
+		}
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Error("a rejected request changed the level")
+	}
+
+	// A temporary level goes back to the one before it.
+	if rr := put(`{"level":"error","for":"20ms"}`); rr.Code != http.StatusOK {
+		t.Fatalf("got %d", rr.Code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for logLevel.Level() != slog.LevelDebug && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("level %v, want it reverted to debug", logLevel.Level())
+	}
+}
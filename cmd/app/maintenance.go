@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maintenanceInterval is how long after a run the next is due.
+	maintenanceInterval = 24 * time.Hour
+	// maintenanceIdleWindow is how far ahead of the next recording
+	// maintenance stops starting, so a long VACUUM cannot hold the database
+	// lock when a recording needs to write its status.
+	maintenanceIdleWindow = time.Hour
+)
+
+// MaintenanceStatus reports the last database maintenance run in
+// GET /api/stats. FreedBytes is how much the database file shrank.
+type MaintenanceStatus struct {
+	LastRun    time.Time `json:"lastRun"`
+	Duration   float64   `json:"durationSeconds"`
+	Steps      []string  `json:"steps"`
+	FreedBytes int64     `json:"freedBytes"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// maintenanceIdle reports whether the DVR is idle enough for maintenance:
+// nothing recording, no restore or shutdown under way, and no recording due
+// to start within maintenanceIdleWindow of now.
+func (a *App) maintenanceIdle(ctx context.Context, now time.Time) (bool, error) {
+	if atomic.LoadInt32(&a.restoring) == 1 || a.isDraining() {
+		return false, nil
+	}
+	busy := false
+	a.runningProcesses.Range(func(_, _ interface{}) bool {
+		busy = true
+		return false
+	})
+	if busy {
+		return false, nil
+	}
+	loc, _ := a.getLocalLocation()
+	before, _ := a.padding()
+	pending, err := a.pendingRecordings(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range pending {
+		start, err := r.StartAt(loc)
+		if err != nil {
+			continue
+		}
+		if start.Add(-time.Duration(before) * time.Second).Before(now.Add(maintenanceIdleWindow)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// maintainDatabase runs the maintenance steps. On SQLite it refreshes the
+// planner statistics and returns free pages to the filesystem; a database
+// created without incremental auto-vacuum is converted first, which takes a
+// full VACUUM once. PostgreSQL vacuums itself, so only ANALYZE is run.
+func (a *App) maintainDatabase(ctx context.Context, now time.Time) (st MaintenanceStatus) {
+	st = MaintenanceStatus{LastRun: now.UTC(), Steps: []string{}}
+	start := time.Now()
+	defer func() { st.Duration = time.Since(start).Seconds() }()
+
+	if a.cfg().DBDriver == driverPostgres {
+		if _, err := a.store.ExecContext(ctx, "ANALYZE"); err != nil {
+			st.Error = err.Error()
+			return st
+		}
+		st.Steps = append(st.Steps, "ANALYZE")
+		return st
+	}
+
+	// PRAGMA auto_vacuum only takes effect with a VACUUM on the same
+	// connection.
+	conn, err := a.sqlDB.Conn(ctx)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	defer conn.Close() //nolint: errcheck
+	sizeBefore, _ := databaseSize(ctx, conn)
+
+	var autoVacuum int
+	if err := conn.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	steps := []string{"ANALYZE", "PRAGMA incremental_vacuum", "PRAGMA optimize"}
+	if autoVacuum != 2 {
+		steps = append([]string{"PRAGMA auto_vacuum = INCREMENTAL", "VACUUM"}, steps...)
+	}
+	for _, step := range steps {
+		if _, err := conn.ExecContext(ctx, step); err != nil {
+			st.Error = step + ": " + err.Error()
+			break
+		}
+		st.Steps = append(st.Steps, step)
+	}
+	if sizeAfter, err := databaseSize(ctx, conn); err == nil && sizeBefore > sizeAfter {
+		st.FreedBytes = sizeBefore - sizeAfter
+	}
+	return st
+}
+
+// databaseSize is the size of the SQLite database in bytes, from its page
+// count.
+func databaseSize(ctx context.Context, conn *sql.Conn) (int64, error) {
+	var pages, size int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := conn.QueryRowContext(ctx, "PRAGMA page_size").Scan(&size); err != nil {
+		return 0, err
+	}
+	return pages * size, nil
+}
+
+// lastMaintenance returns the status of the last maintenance run, or nil
+// before the first.
+func (a *App) lastMaintenance() *MaintenanceStatus {
+	a.maintenanceMu.Lock()
+	defer a.maintenanceMu.Unlock()
+	return a.maintenance
+}
+
+// runMaintenanceSchedule runs maintainDatabase once maintenanceInterval has
+// passed since the last run and the DVR is idle, checking every ten
+// minutes. The first run is a day after startup.
+func (a *App) runMaintenanceSchedule(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	next := time.Now().Add(maintenanceInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if now.Before(next) {
+				continue
+			}
+			if idle, err := a.maintenanceIdle(ctx, now); err != nil {
+				slog.Error("Error checking for recordings before database maintenance", "err", err)
+				continue
+			} else if !idle {
+				continue
+			}
+			st := a.maintainDatabase(ctx, now)
+			a.maintenanceMu.Lock()
+			a.maintenance = &st
+			a.maintenanceMu.Unlock()
+			next = now.Add(maintenanceInterval)
+			if st.Error != "" {
+				slog.Error("Database maintenance failed", "err", st.Error)
+			} else {
+				slog.Info("Database maintenance done", "steps", len(st.Steps), "freed_bytes", st.FreedBytes, "seconds", st.Duration)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestMaintainDatabase(t *testing.T) {
+	db, err := openDB(filepath.Join(t.TempDir(), "recordings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() //nolint: errcheck
+	app := NewApp(&pkgcfg.Config{Timezone: "UTC"}, NewSQLStore(db), &MockCommander{})
+	app.sqlDB = db
+	app.createTables()
+	ctx := context.Background()
+
+	// Enough rows to leave free pages behind once deleted.
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if _, err := db.Exec("INSERT INTO recordings (channel_id, date, start_time, duration, status, title) VALUES ('5.1', '2026-03-01', '20:00', 60, 'completed', ?)", strings.Repeat("x", 500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM recordings"); err != nil {
+		t.Fatal(err)
+	}
+
+	st := app.maintainDatabase(ctx, time.Now())
+	if st.Error != "" || len(st.Steps) != 5 || st.Steps[1] != "VACUUM" || st.FreedBytes <= 0 {
+		t.Fatalf("first run %+v", st)
+	}
+	var autoVacuum int
+	if err := db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil || autoVacuum != 2 {
+		t.Errorf("auto_vacuum %d, %v", autoVacuum, err)
+	}
+	// Converted once; later runs vacuum incrementally.
+	if st := app.maintainDatabase(ctx, time.Now()); st.Error != "" || len(st.Steps) != 3 {
+		t.Errorf("second run %+v", st)
+	}
+
+	app.maintenance = &st
+	rr := httptest.NewRecorder()
+	app.getStats(rr, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	var stats Stats
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil || stats.Maintenance == nil || len(stats.Maintenance.Steps) != 5 {
+		t.Errorf("stats maintenance %+v, %v", stats.Maintenance, err)
+	}
+}
+
+func TestMaintenanceIdle(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+
+	if idle, err := app.maintenanceIdle(ctx, now); err != nil || !idle {
+		t.Errorf("nothing scheduled: %v, %v", idle, err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	if idle, _ := app.maintenanceIdle(ctx, now); !idle {
+		t.Error("recording two hours away blocked maintenance")
+	}
+	if idle, _ := app.maintenanceIdle(ctx, now.Add(90*time.Minute)); idle {
+		t.Error("maintenance allowed half an hour before a recording")
+	}
+	app.runningProcesses.Store(2, struct{}{})
+	defer app.runningProcesses.Delete(2)
+	if idle, _ := app.maintenanceIdle(ctx, now); idle {
+		t.Error("maintenance allowed while recording")
+	}
+}
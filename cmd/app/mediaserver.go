@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// mediaRefreshDelay gathers the events of a burst, such as a retention run
+// deleting several recordings, into one library refresh.
+const mediaRefreshDelay = 5 * time.Second
+
+// mediaServerRequest builds the library refresh request for s.
+func mediaServerRequest(ctx context.Context, s pkgcfg.MediaServer) (*http.Request, error) {
+	base := strings.TrimRight(s.URL, "/")
+	switch strings.ToLower(s.Type) {
+	case "jellyfin", "emby":
+		req, err := http.NewRequestWithContext(ctx, "POST", base+"/Library/Refresh", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Emby-Token", s.Token)
+		return req, nil
+	case "plex":
+		section := s.LibraryID
+		if section == "" {
+			section = "all"
+		}
+		u := base + "/library/sections/" + url.PathEscape(section) + "/refresh?" + url.Values{"X-Plex-Token": {s.Token}}.Encode()
+		return http.NewRequestWithContext(ctx, "GET", u, nil)
+	default:
+		return nil, fmt.Errorf("unknown media server type %q", s.Type)
+	}
+}
+
+// refreshMediaServer asks one server to rescan its library.
+func refreshMediaServer(ctx context.Context, s pkgcfg.MediaServer) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := mediaServerRequest(ctx, s)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()        //nolint: errcheck
+	io.Copy(io.Discard, resp.Body) //nolint: errcheck
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s library refresh: %s", s.Type, resp.Status)
+	}
+	return nil
+}
+
+// refreshMediaServers refreshes every configured server, logging failures.
+func (a *App) refreshMediaServers(ctx context.Context) {
+	for _, s := range a.cfg().MediaServers {
+		if err := refreshMediaServer(ctx, s); err != nil {
+			slog.Error("Error refreshing media server", "type", s.Type, "url", s.URL, "err", err)
+			continue
+		}
+		slog.Info("Refreshed media server library", "type", s.Type, "url", s.URL)
+	}
+}
+
+// watchMediaServers refreshes the media servers delay after a recording
+// completes or is deleted, until ctx is done.
+func (a *App) watchMediaServers(ctx context.Context, delay time.Duration) {
+	events, unsubscribe := a.events.subscribe()
+	defer unsubscribe()
+
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case e := <-events:
+			if e.Type == eventRecordingCompleted || e.Type == eventRecordingDeleted {
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			a.refreshMediaServers(ctx)
+		}
+	}
+}
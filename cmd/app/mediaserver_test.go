@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestWatchMediaServers(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.String()+" "+r.Header.Get("X-Emby-Token"))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.MediaServers = []pkgcfg.MediaServer{
+		{Type: "jellyfin", URL: srv.URL + "/", Token: "jf-key"},
+		{Type: "plex", URL: srv.URL, Token: "plex token", LibraryID: "3"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		app.watchMediaServers(ctx, 20*time.Millisecond)
+		close(done)
+	}()
+	// Let the watcher subscribe before publishing.
+	time.Sleep(10 * time.Millisecond)
+	app.events.publish("guide.updated", nil)
+	app.events.publish("recording.completed", map[string]interface{}{"id": 1})
+	app.events.publish("recording.deleted", map[string]interface{}{"id": 2})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(calls)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"POST /Library/Refresh jf-key", "GET /library/sections/3/refresh?X-Plex-Token=plex+token "}
+	if len(calls) != len(want) {
+		t.Fatalf("calls %q, want one refresh per server", calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestRefreshMediaServerErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	if err := refreshMediaServer(context.Background(), pkgcfg.MediaServer{Type: "emby", URL: srv.URL}); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+	if err := refreshMediaServer(context.Background(), pkgcfg.MediaServer{Type: "kodi", URL: srv.URL}); err == nil {
+		t.Error("expected an error for an unknown server type")
+	}
+}
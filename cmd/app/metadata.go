@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// findGuideProgram returns the guide program on channel starting at the given
+// local date and HH:MM time.
+func (a *App) findGuideProgram(channel, date, startTime string) (types.Program, bool) {
+	loc, _ := a.getLocalLocation()
+	want := date + " " + startTime
+
+	a.guideDataMutex.RLock()
+	defer a.guideDataMutex.RUnlock()
+	for _, prog := range a.guideData.Programs {
+		if prog.Channel != channel {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, prog.Start)
+		if err != nil {
+			continue
+		}
+		if start.In(loc).Format("2006-01-02 15:04") == want {
+			return prog, true
+		}
+	}
+	return types.Program{}, false
+}
+
+func (a *App) saveRecordingMetadata(ctx context.Context, recordingID int, prog types.Program) error {
+	cast := prog.Cast
+	if cast == nil {
+		cast = []string{}
+	}
+	castJSON, err := json.Marshal(cast)
+	if err != nil {
+		return err
+	}
+	_, err = a.dbExecContext(ctx, `
+        INSERT OR REPLACE INTO recording_metadata
+            (recording_id, title, subtitle, description, category, season, episode, original_air_date, year, rating, cast_json)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		recordingID, prog.Title, prog.SubTitle, prog.Description, prog.Category,
+		prog.Season, prog.Episode, prog.OriginalAirDate, prog.Year, prog.Rating, string(castJSON))
+	return err
+}
+
+// loadRecordingMetadata returns sql.ErrNoRows when nothing was captured.
+func (a *App) loadRecordingMetadata(ctx context.Context, recordingID int) (types.RecordingMetadata, error) {
+	md := types.RecordingMetadata{RecordingID: recordingID}
+	var castJSON string
+	err := a.dbQueryRowContext(ctx, `
+        SELECT COALESCE(title, ''), COALESCE(subtitle, ''), COALESCE(description, ''), COALESCE(category, ''),
+               season, episode, COALESCE(original_air_date, ''), year, COALESCE(rating, ''), cast_json
+        FROM recording_metadata
+        WHERE recording_id = ?`, recordingID).Scan(
+		&md.Title, &md.SubTitle, &md.Description, &md.Category,
+		&md.Season, &md.Episode, &md.OriginalAirDate, &md.Year, &md.Rating, &castJSON)
+	if err != nil {
+		return md, err
+	}
+	if err := json.Unmarshal([]byte(castJSON), &md.Cast); err != nil {
+		slog.Error("Error decoding cast for recording", "recording_id", recordingID, "err", err)
+	}
+	return md, nil
+}
+
+func (a *App) getRecordingMetadata(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+
+	md, err := a.loadRecordingMetadata(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No metadata for recording", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if md.Enrichment, err = a.loadEnrichment(r.Context(), id); err != nil {
+		requestLogger(r).Error("Error loading enrichment of recording", "recording_id", id, "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(md); err != nil {
+		requestLogger(r).Error("Error encoding metadata response", "err", err)
+	}
+}
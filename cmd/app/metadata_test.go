@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestRecordingMetadataCapturedFromGuide(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	_, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KING', 'http://test', 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.guideData.Programs = []types.Program{{
+		Channel:         "5.1",
+		Title:           "Nova",
+		SubTitle:        "Black Holes",
+		Description:     "Into the void.",
+		Start:           "2026-07-14T20:00:00Z",
+		End:             "2026-07-14T21:00:00Z",
+		Duration:        60,
+		Season:          51,
+		Episode:         3,
+		OriginalAirDate: "2026-07-14",
+		Rating:          "TV-G",
+		Cast:            []string{"Narrator"},
+	}}
+
+	create := func(startTime string) int {
+		body, _ := json.Marshal(RecordingRequest{ChannelID: "5.1", Date: "2026-07-14", StartTime: startTime, Duration: 60})
+		req := httptest.NewRequest("POST", "/api/recordings", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.createRecording(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got code %d, want %d", rr.Code, http.StatusCreated)
+		}
+		var rec types.Recording
+		if err := json.NewDecoder(rr.Body).Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		return rec.ID
+	}
+	matched := create("20:00")
+	unmatched := create("22:00")
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/metadata", app.getRecordingMetadata).Methods("GET")
+	get := func(id int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/recordings/%d/metadata", id), nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(matched)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got code %d, want %d", rr.Code, http.StatusOK)
+	}
+	var md types.RecordingMetadata
+	if err := json.NewDecoder(rr.Body).Decode(&md); err != nil {
+		t.Fatal(err)
+	}
+	if md.Title != "Nova" || md.Description != "Into the void." || md.Season != 51 || md.Episode != 3 ||
+		md.Rating != "TV-G" || len(md.Cast) != 1 || md.Cast[0] != "Narrator" {
+		t.Errorf("unexpected metadata: %+v", md)
+	}
+
+	if rr := get(unmatched); rr.Code != http.StatusNotFound {
+		t.Errorf("got code %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// durationBuckets are the histogram bucket bounds, in seconds, for HTTP
+// requests and scheduler ticks.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts observations into durationBuckets.
+type histogram struct {
+	counts []uint64 // per bucket, plus +Inf at the end
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(durationBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// httpSeries identifies the requests one HTTP histogram counts.
+type httpSeries struct {
+	method, route, code string
+}
+
+// metrics holds the counters and histograms updated as the DVR runs.
+// Everything else /metrics reports is read when it is scraped.
+type metrics struct {
+	mu             sync.Mutex
+	ffmpegFailures uint64
+	recordedBytes  int64
+	schedulerTicks *histogram
+	http           map[httpSeries]*histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{schedulerTicks: newHistogram(), http: make(map[httpSeries]*histogram)}
+}
+
+func (m *metrics) ffmpegFailed() {
+	m.mu.Lock()
+	m.ffmpegFailures++
+	m.mu.Unlock()
+}
+
+func (m *metrics) recorded(bytes int64) {
+	m.mu.Lock()
+	m.recordedBytes += bytes
+	m.mu.Unlock()
+}
+
+func (m *metrics) observeTick(d time.Duration) {
+	m.mu.Lock()
+	m.schedulerTicks.observe(d.Seconds())
+	m.mu.Unlock()
+}
+
+func (m *metrics) observeHTTP(s httpSeries, d time.Duration) {
+	m.mu.Lock()
+	h, ok := m.http[s]
+	if !ok {
+		h = newHistogram()
+		m.http[s] = h
+	}
+	h.observe(d.Seconds())
+	m.mu.Unlock()
+}
+
+// statusRecorder remembers the status a handler wrote and how many body
+// bytes. It passes on flushing for /api/events and hijacking for /ws.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response cannot be hijacked")
+	}
+	s.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// instrument is router middleware that times each request by its route
+// template, so /api/recordings/{id} is one series however many IDs are
+// requested.
+func (a *App) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		a.metrics.observeHTTP(httpSeries{r.Method, route, strconv.Itoa(rec.status)}, time.Since(start))
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promWriter writes the Prometheus text exposition format.
+type promWriter struct {
+	w *bufio.Writer
+}
+
+func (p promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (p promWriter) sample(name, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(p.w, "%s%s %s\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (p promWriter) histogram(name, labels string, h *histogram) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cum uint64
+	for i, le := range durationBuckets {
+		cum += h.counts[i]
+		p.sample(name+"_bucket", labels+sep+`le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(cum))
+	}
+	p.sample(name+"_bucket", labels+sep+`le="+Inf"`, float64(h.count))
+	p.sample(name+"_sum", labels, h.sum)
+	p.sample(name+"_count", labels, float64(h.count))
+}
+
+// serveMetrics reports the recorder's state for Prometheus.
+func (a *App) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush() //nolint: errcheck
+	p := promWriter{bw}
+	a.writeStateMetrics(r.Context(), p)
+
+	m := a.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.header("hdhr_dvr_ffmpeg_failures_total", "counter", "ffmpeg capture runs that exited with an error, including retried ones.")
+	p.sample("hdhr_dvr_ffmpeg_failures_total", "", float64(m.ffmpegFailures))
+	p.header("hdhr_dvr_recorded_bytes_total", "counter", "Size of the recording files finished since the DVR started.")
+	p.sample("hdhr_dvr_recorded_bytes_total", "", float64(m.recordedBytes))
+	p.header("hdhr_dvr_scheduler_tick_seconds", "histogram", "Time the scheduler takes to check pending recordings.")
+	p.histogram("hdhr_dvr_scheduler_tick_seconds", "", m.schedulerTicks)
+
+	series := make([]httpSeries, 0, len(m.http))
+	for s := range m.http {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		x, y := series[i], series[j]
+		if x.route != y.route {
+			return x.route < y.route
+		}
+		if x.method != y.method {
+			return x.method < y.method
+		}
+		return x.code < y.code
+	})
+	p.header("hdhr_dvr_http_request_duration_seconds", "histogram", "HTTP request durations by route.")
+	for _, s := range series {
+		labels := fmt.Sprintf(`method="%s",route="%s",code="%s"`, s.method, labelEscaper.Replace(s.route), s.code)
+		p.histogram("hdhr_dvr_http_request_duration_seconds", labels, m.http[s])
+	}
+}
+
+// writeStateMetrics writes the gauges read from the database, tuners,
+// storage and guide.
+func (a *App) writeStateMetrics(ctx context.Context, p promWriter) {
+	p.header("hdhr_dvr_recordings", "gauge", "Recordings by status.")
+	rows, err := a.dbQueryContext(ctx, "SELECT status, COUNT(*) FROM recordings GROUP BY status ORDER BY status")
+	if err != nil {
+		slog.Error("Error counting recordings for metrics", "err", err)
+	} else {
+		for rows.Next() {
+			var status string
+			var n int
+			if err := rows.Scan(&status, &n); err == nil {
+				p.sample("hdhr_dvr_recordings", `status="`+labelEscaper.Replace(status)+`"`, float64(n))
+			}
+		}
+		rows.Close() //nolint: errcheck
+	}
+
+	active := 0
+	a.runningProcesses.Range(func(_, _ interface{}) bool {
+		active++
+		return true
+	})
+	p.header("hdhr_dvr_active_captures", "gauge", "ffmpeg captures running now.")
+	p.sample("hdhr_dvr_active_captures", "", float64(active))
+	a.liveMu.Lock()
+	live := len(a.liveStreams)
+	a.liveMu.Unlock()
+	p.header("hdhr_dvr_live_streams", "gauge", "Live streams proxied to emulation clients now.")
+	p.sample("hdhr_dvr_live_streams", "", float64(live))
+	p.header("hdhr_dvr_tuners", "gauge", "Tuners on the HDHomeRun.")
+	p.sample("hdhr_dvr_tuners", "", float64(a.tunerCount))
+
+	if sr, ok := a.storage.(storage.SpaceReporter); ok {
+		if free, err := sr.FreeSpace(); err == nil {
+			p.header("hdhr_dvr_storage_free_bytes", "gauge", "Free space on the storage directory.")
+			p.sample("hdhr_dvr_storage_free_bytes", "", float64(free))
+		}
+		if total, err := sr.TotalSpace(); err == nil {
+			p.header("hdhr_dvr_storage_total_bytes", "gauge", "Size of the filesystem holding the storage directory.")
+			p.sample("hdhr_dvr_storage_total_bytes", "", float64(total))
+		}
+	}
+
+	a.guideDataMutex.RLock()
+	generated := a.guideData.Generated
+	a.guideDataMutex.RUnlock()
+	if t, err := time.Parse(time.RFC3339, generated); err == nil {
+		p.header("hdhr_dvr_guide_age_seconds", "gauge", "Time since the loaded guide was generated.")
+		p.sample("hdhr_dvr_guide_age_seconds", "", time.Since(t).Seconds())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestServeMetrics(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	for _, q := range []string{
+		"INSERT INTO recordings (channel_id, date, start_time, duration, status) VALUES ('5.1', '2026-03-01', '20:00', 60, 'failed')",
+		"INSERT INTO recordings (channel_id, date, start_time, duration, status) VALUES ('5.1', '2026-03-02', '20:00', 60, 'completed')",
+		"INSERT INTO recordings (channel_id, date, start_time, duration, status) VALUES ('5.1', '2026-03-03', '20:00', 60, 'completed')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.guideData.Generated = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	app.metrics.ffmpegFailed()
+	app.metrics.recorded(1500)
+	app.metrics.observeTick(30 * time.Millisecond)
+
+	r := mux.NewRouter()
+	r.Use(app.instrument)
+	r.HandleFunc("/api/recordings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+	}).Methods("GET")
+	r.HandleFunc("/metrics", app.serveMetrics).Methods("GET")
+	for _, path := range []string{"/api/recordings/1", "/api/recordings/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE hdhr_dvr_recordings gauge\n",
+		`hdhr_dvr_recordings{status="completed"} 2` + "\n",
+		`hdhr_dvr_recordings{status="failed"} 1` + "\n",
+		"hdhr_dvr_active_captures 0\n",
+		"hdhr_dvr_tuners 2\n",
+		"hdhr_dvr_ffmpeg_failures_total 1\n",
+		"hdhr_dvr_recorded_bytes_total 1500\n",
+		`hdhr_dvr_scheduler_tick_seconds_bucket{le="0.025"} 0` + "\n",
+		`hdhr_dvr_scheduler_tick_seconds_bucket{le="0.05"} 1` + "\n",
+		"hdhr_dvr_scheduler_tick_seconds_count 1\n",
+		`hdhr_dvr_http_request_duration_seconds_count{method="GET",route="/api/recordings/{id}",code="404"} 2` + "\n",
+		`hdhr_dvr_http_request_duration_seconds_bucket{method="GET",route="/api/recordings/{id}",code="404",le="+Inf"} 2` + "\n",
+		"hdhr_dvr_guide_age_seconds 3600",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// serverHandler wraps the router in the middleware that applies to every
+// request, routed or not: request IDs, the access log and panic recovery.
+// Route-aware middleware is added to the router with Use instead.
+func serverHandler(router http.Handler) http.Handler {
+	return withRequestID(accessLog(recoverPanic(router)))
+}
+
+// accessLog logs each request once it has been answered. Successful reads
+// are logged at debug level, since the UI polls; writes and errors at info.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && rec.status < 400 {
+			level = slog.LevelDebug
+		}
+		requestLogger(r).Log(r.Context(), level, "Request", "method", r.Method, "path", r.URL.Path,
+			"status", rec.status, "bytes", rec.bytes, "duration", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
+
+// recoverPanic turns a panicking handler into a 500 and logs the panic with
+// its stack, instead of net/http dropping the connection. A panic with
+// http.ErrAbortHandler still aborts the response as intended.
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			requestLogger(r).Error("Panic in handler", "method", r.Method, "path", r.URL.Path,
+				"panic", p, "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				http.Error(rec, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// withBasePath serves next under basePath, such as "/dvr", for a reverse
+// proxy that forwards the prefix. Requests a proxy has already stripped it
+// from are served as they are, and the bare prefix redirects to the UI.
+func withBasePath(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	strip := http.StripPrefix(basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// noWriteTimeout lifts the server's write timeout from a response that
+// lasts as long as the client wants, such as a recording download or an
+// event stream.
+func noWriteTimeout(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{}) //nolint: errcheck
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	buf := captureLogs(t, "text")
+	h := serverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recordings", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got %d", rr.Code)
+	}
+	logs := buf.String()
+	if !strings.Contains(logs, `msg="Panic in handler"`) || !strings.Contains(logs, "middleware_test.go") {
+		t.Errorf("panic not logged with its stack:\n%s", logs)
+	}
+	// The access log still sees the request, with the ID it was given.
+	if !strings.Contains(logs, "msg=Request request_id="+rr.Header().Get(requestIDHeader)+" method=POST path=/api/recordings status=500") {
+		t.Errorf("no access log line:\n%s", logs)
+	}
+
+	abort := recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v", p)
+		}
+	}()
+	abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestAccessLogLevels(t *testing.T) {
+	buf := captureLogs(t, "text")
+	h := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok")) //nolint: errcheck
+	}))
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/api/recordings", nil),
+		httptest.NewRequest("GET", "/missing", nil),
+		httptest.NewRequest("DELETE", "/api/recordings/1", nil),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	logs := buf.String()
+	for _, want := range []string{
+		"level=DEBUG msg=Request method=GET path=/api/recordings status=200 bytes=2",
+		"level=INFO msg=Request method=GET path=/missing status=404",
+		"level=INFO msg=Request method=DELETE path=/api/recordings/1 status=200",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("missing %q in:\n%s", want, logs)
+		}
+	}
+}
+
+func TestNoWriteTimeout(t *testing.T) {
+	slow := func(lift bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if lift {
+				noWriteTimeout(w)
+			}
+			time.Sleep(150 * time.Millisecond)
+			w.Write([]byte("done")) //nolint: errcheck
+		}
+	}
+	for _, lift := range []bool{false, true} {
+		srv := httptest.NewUnstartedServer(serverHandler(slow(lift)))
+		srv.Config.WriteTimeout = 50 * time.Millisecond
+		srv.Start()
+		resp, err := http.Get(srv.URL)
+		var body []byte
+		if err == nil {
+			body, _ = io.ReadAll(resp.Body)
+			resp.Body.Close() //nolint: errcheck
+		}
+		srv.Close()
+		if got := string(body) == "done"; got != lift {
+			t.Errorf("lifted=%v: body %q, err %v", lift, body, err)
+		}
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mux.Vars(r)["id"]) //nolint: errcheck
+	})
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "home") //nolint: errcheck
+	})
+	h := withBasePath("/dvr", r)
+
+	for path, want := range map[string]string{
+		"/dvr/api/recordings/7": "7",
+		"/api/recordings/7":     "7", // the proxy stripped the prefix
+		"/dvr/":                 "home",
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Errorf("%s: got %d %q", path, rr.Code, rr.Body)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/dvr", nil))
+	if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "/dvr/" {
+		t.Errorf("bare prefix: got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
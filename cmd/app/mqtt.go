@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"regexp"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/mqtt"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// mqttMaxBackoff caps the wait between attempts to reach the broker.
+const mqttMaxBackoff = 5 * time.Minute
+
+// mqttPublisher is the part of an MQTT connection the bridge uses.
+type mqttPublisher interface {
+	Publish(topic string, payload []byte, retain bool) error
+}
+
+// mqttBridge is the MQTT configuration with its defaults filled in.
+type mqttBridge struct {
+	cfg       pkgcfg.MQTT
+	node      string
+	prefix    string
+	discovery string
+	interval  time.Duration
+}
+
+var mqttNodeUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+func newMQTTBridge(cfg pkgcfg.MQTT) *mqttBridge {
+	b := &mqttBridge{cfg: cfg, prefix: cfg.TopicPrefix, discovery: cfg.DiscoveryPrefix}
+	if b.cfg.ClientID == "" {
+		b.cfg.ClientID = "hdhr-dvr"
+	}
+	if b.prefix == "" {
+		b.prefix = "hdhr-dvr"
+	}
+	if b.discovery == "" {
+		b.discovery = "homeassistant"
+	}
+	if cfg.Discovery != nil && !*cfg.Discovery {
+		b.discovery = ""
+	}
+	b.interval = time.Duration(cfg.Interval) * time.Second
+	if b.interval <= 0 {
+		b.interval = time.Minute
+	}
+	b.node = mqttNodeUnsafe.ReplaceAllString(b.cfg.ClientID, "_")
+	return b
+}
+
+func (b *mqttBridge) stateTopic() string        { return b.prefix + "/state" }
+func (b *mqttBridge) availabilityTopic() string { return b.prefix + "/status" }
+func (b *mqttBridge) eventTopic() string        { return b.prefix + "/event" }
+
+// MQTTState is the recorder state published, retained, to the state topic.
+// Recording and DiskLow are "ON" or "OFF" for Home Assistant binary
+// sensors; the disk figures are omitted when no storage root reports its
+// capacity.
+type MQTTState struct {
+	TunersInUse      int      `json:"tunersInUse"`
+	Tuners           int      `json:"tuners"`
+	ActiveRecordings int      `json:"activeRecordings"`
+	Recording        string   `json:"recording"`
+	Titles           []string `json:"titles"`
+	FailedRecordings int      `json:"failedRecordings"`
+	LastFailure      string   `json:"lastFailure"`
+	FreeGB           *float64 `json:"freeGB,omitempty"`
+	TotalGB          *float64 `json:"totalGB,omitempty"`
+	UsedPercent      *float64 `json:"usedPercent,omitempty"`
+	DiskLow          string   `json:"diskLow"`
+}
+
+func onOff(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// round1 rounds to one decimal place.
+func round1(f float64) *float64 {
+	f = math.Round(f*10) / 10
+	return &f
+}
+
+// mqttState gathers the current recorder state.
+func (a *App) mqttState(ctx context.Context) MQTTState {
+	s := MQTTState{Tuners: a.tunerCount, TunersInUse: a.tunersInUse(), Titles: []string{}}
+
+	rows, err := a.dbQueryContext(ctx, "SELECT COALESCE(title, '') FROM recordings WHERE status = 'recording' ORDER BY date, start_time")
+	if err != nil {
+		slog.Error("Error loading active recordings for MQTT", "err", err)
+	} else {
+		for rows.Next() {
+			var title string
+			if err := rows.Scan(&title); err == nil {
+				s.Titles = append(s.Titles, title)
+			}
+		}
+		rows.Close() //nolint: errcheck
+	}
+	s.ActiveRecordings = len(s.Titles)
+	s.Recording = onOff(s.ActiveRecordings > 0)
+
+	if err := a.dbQueryRowContext(ctx, "SELECT COUNT(*) FROM recordings WHERE status = 'failed'").Scan(&s.FailedRecordings); err != nil {
+		slog.Error("Error counting failed recordings for MQTT", "err", err)
+	}
+	_ = a.dbQueryRowContext(ctx, `
+		SELECT COALESCE(title, '') FROM recordings WHERE status = 'failed'
+		ORDER BY date DESC, start_time DESC LIMIT 1`).Scan(&s.LastFailure)
+
+	var free, total int64
+	var reported bool
+	for _, root := range a.storageRoots() {
+		sr, ok := root.store.(storage.SpaceReporter)
+		if !ok {
+			continue
+		}
+		f, ferr := sr.FreeSpace()
+		t, terr := sr.TotalSpace()
+		if ferr != nil || terr != nil {
+			continue
+		}
+		free, total, reported = free+f, total+t, true
+	}
+	if reported {
+		s.FreeGB = round1(float64(free) / (1 << 30))
+		s.TotalGB = round1(float64(total) / (1 << 30))
+		if total > 0 {
+			s.UsedPercent = round1(float64(total-free) * 100 / float64(total))
+		}
+	}
+
+	low := false
+	a.diskLowMu.Lock()
+	for _, l := range a.diskLow {
+		low = low || l
+	}
+	a.diskLowMu.Unlock()
+	s.DiskLow = onOff(low)
+	return s
+}
+
+// mqttEntity is one Home Assistant entity read from the state topic.
+type mqttEntity struct {
+	component   string
+	id          string
+	name        string
+	field       string
+	unit        string
+	deviceClass string
+	stateClass  string
+	icon        string
+}
+
+var mqttEntities = []mqttEntity{
+	{component: "sensor", id: "tuners_in_use", name: "Tuners in use", field: "tunersInUse", stateClass: "measurement", icon: "mdi:antenna"},
+	{component: "sensor", id: "active_recordings", name: "Active recordings", field: "activeRecordings", stateClass: "measurement", icon: "mdi:record-rec"},
+	{component: "sensor", id: "failed_recordings", name: "Failed recordings", field: "failedRecordings", stateClass: "total", icon: "mdi:alert-circle-outline"},
+	{component: "sensor", id: "last_failure", name: "Last failed recording", field: "lastFailure", icon: "mdi:alert-circle-outline"},
+	{component: "sensor", id: "disk_free", name: "Disk free", field: "freeGB", unit: "GB", deviceClass: "data_size", stateClass: "measurement"},
+	{component: "sensor", id: "disk_used", name: "Disk used", field: "usedPercent", unit: "%", stateClass: "measurement", icon: "mdi:harddisk"},
+	{component: "binary_sensor", id: "recording", name: "Recording", field: "recording", deviceClass: "running"},
+	{component: "binary_sensor", id: "disk_low", name: "Disk space low", field: "diskLow", deviceClass: "problem"},
+}
+
+// haDevice groups the entities under one device in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// haDiscovery is a Home Assistant MQTT discovery payload.
+type haDiscovery struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	ValueTemplate     string   `json:"value_template"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Unit              string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Icon              string   `json:"icon,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// discoveryMessages returns the retained discovery payloads by topic.
+func (b *mqttBridge) discoveryMessages() map[string][]byte {
+	msgs := make(map[string][]byte)
+	for _, e := range mqttEntities {
+		d := haDiscovery{
+			Name:              e.name,
+			UniqueID:          b.node + "_" + e.id,
+			StateTopic:        b.stateTopic(),
+			ValueTemplate:     "{{ value_json." + e.field + " }}",
+			AvailabilityTopic: b.availabilityTopic(),
+			Unit:              e.unit,
+			DeviceClass:       e.deviceClass,
+			StateClass:        e.stateClass,
+			Icon:              e.icon,
+			Device: haDevice{
+				Identifiers:  []string{b.node},
+				Name:         "HDHomeRun DVR",
+				Manufacturer: "hdhr-dvr",
+				Model:        "DVR",
+			},
+		}
+		if e.component == "binary_sensor" {
+			d.PayloadOn, d.PayloadOff = "ON", "OFF"
+		}
+		body, _ := json.Marshal(d)
+		msgs[b.discovery+"/"+e.component+"/"+b.node+"/"+e.id+"/config"] = body
+	}
+	return msgs
+}
+
+// publishMQTTState publishes the current state, retained.
+func (a *App) publishMQTTState(ctx context.Context, b *mqttBridge, pub mqttPublisher) error {
+	body, err := json.Marshal(a.mqttState(ctx))
+	if err != nil {
+		return err
+	}
+	return pub.Publish(b.stateTopic(), body, true)
+}
+
+// serveMQTT announces the recorder on a new connection and then keeps its
+// state current: after every notification event, which is also published
+// to the event topic for automations, and every interval. It returns when ctx is done or lost is closed.
+func (a *App) serveMQTT(ctx context.Context, b *mqttBridge, pub mqttPublisher, lost <-chan struct{}) error {
+	events, unsubscribe := a.events.subscribe()
+	defer unsubscribe()
+
+	if err := pub.Publish(b.availabilityTopic(), []byte("online"), true); err != nil {
+		return err
+	}
+	if b.discovery != "" {
+		for topic, body := range b.discoveryMessages() {
+			if err := pub.Publish(topic, body, true); err != nil {
+				return err
+			}
+		}
+	}
+	if err := a.publishMQTTState(ctx, b, pub); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-lost:
+			return nil
+		case <-ticker.C:
+		case e := <-events:
+			if !isNotificationEvent(e.Type) {
+				continue
+			}
+			body, err := json.Marshal(a.buildNotification(ctx, e))
+			if err == nil {
+				err = pub.Publish(b.eventTopic(), body, false)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := a.publishMQTTState(ctx, b, pub); err != nil {
+			return err
+		}
+	}
+}
+
+// runMQTT keeps a connection to the broker until ctx is done, reconnecting
+// with backoff when it drops. The broker marks the recorder offline through
+// the will if the connection is lost.
+func (a *App) runMQTT(ctx context.Context, cfg pkgcfg.MQTT) {
+	b := newMQTTBridge(cfg)
+	opts := mqtt.Options{
+		ClientID:    b.cfg.ClientID,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		WillTopic:   b.availabilityTopic(),
+		WillPayload: []byte("offline"),
+		WillRetain:  true,
+	}
+	backoff := time.Second
+	for {
+		c, err := mqtt.Dial(ctx, cfg.Broker, opts)
+		if err != nil {
+			slog.Error("Error connecting to MQTT broker", "broker", cfg.Broker, "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, mqttMaxBackoff)
+			continue
+		}
+		backoff = time.Second
+		slog.Info("Connected to MQTT broker", "broker", cfg.Broker)
+		if err := a.serveMQTT(ctx, b, c, c.Done()); err != nil {
+			slog.Error("Error publishing to MQTT broker", "err", err)
+		}
+		if ctx.Err() != nil {
+			c.Publish(b.availabilityTopic(), []byte("offline"), true) //nolint: errcheck
+			c.Close()                                                 //nolint: errcheck
+			return
+		}
+		c.Close() //nolint: errcheck
+		slog.Warn("Lost connection to MQTT broker, reconnecting", "broker", cfg.Broker)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// fakePublisher passes what is published to a channel.
+type fakePublisher chan mqttMessage
+
+func (f fakePublisher) Publish(topic string, payload []byte, retain bool) error {
+	f <- mqttMessage{topic, payload, retain}
+	return nil
+}
+
+func TestMQTTDiscovery(t *testing.T) {
+	b := newMQTTBridge(pkgcfg.MQTT{Broker: "tcp://broker", ClientID: "dvr.den"})
+	msgs := b.discoveryMessages()
+	if len(msgs) != len(mqttEntities) {
+		t.Fatalf("%d discovery messages", len(msgs))
+	}
+	var d haDiscovery
+	if err := json.Unmarshal(msgs["homeassistant/sensor/dvr_den/disk_free/config"], &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.StateTopic != "hdhr-dvr/state" || d.ValueTemplate != "{{ value_json.freeGB }}" || d.UniqueID != "dvr_den_disk_free" ||
+		d.AvailabilityTopic != "hdhr-dvr/status" || d.Unit != "GB" || d.Device.Identifiers[0] != "dvr_den" {
+		t.Errorf("disk_free config %+v", d)
+	}
+	if err := json.Unmarshal(msgs["homeassistant/binary_sensor/dvr_den/recording/config"], &d); err != nil || d.PayloadOn != "ON" {
+		t.Errorf("recording config %+v %v", d, err)
+	}
+
+	off := false
+	if b := newMQTTBridge(pkgcfg.MQTT{Discovery: &off}); b.discovery != "" {
+		t.Errorf("discovery prefix %q with discovery off", b.discovery)
+	}
+}
+
+func TestServeMQTT(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.tunerCount = 2
+	mem := storage.NewMemory()
+	mem.SetCapacity(4 << 30)
+	app.storage = mem
+	app.config.StorageDir = "/recordings"
+	for _, q := range []string{
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'failed', 'News')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '5.1', '2026-03-02', '20:00', 60, 'recording', 'Quiz')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pub := make(fakePublisher, 100)
+	b := newMQTTBridge(pkgcfg.MQTT{TopicPrefix: "dvr"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.serveMQTT(ctx, b, pub, nil) }()
+
+	next := func() mqttMessage {
+		t.Helper()
+		select {
+		case m := <-pub:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("nothing published")
+		}
+		return mqttMessage{}
+	}
+	if m := next(); m.topic != "dvr/status" || string(m.payload) != "online" || !m.retain {
+		t.Errorf("first message %s %s", m.topic, m.payload)
+	}
+	for range mqttEntities {
+		next()
+	}
+	m := next()
+	var s MQTTState
+	if err := json.Unmarshal(m.payload, &s); err != nil || m.topic != "dvr/state" || !m.retain {
+		t.Fatalf("state %s %s %v", m.topic, m.payload, err)
+	}
+	if s.Tuners != 2 || s.ActiveRecordings != 1 || s.Recording != "ON" || s.Titles[0] != "Quiz" ||
+		s.FailedRecordings != 1 || s.LastFailure != "News" || *s.TotalGB != 4 || *s.UsedPercent != 0 || s.DiskLow != "OFF" {
+		t.Errorf("state %s", m.payload)
+	}
+
+	app.events.publish(eventRecordingFailed, map[string]interface{}{"id": 2})
+	if m := next(); m.topic != "dvr/event" || m.retain {
+		t.Errorf("event published as %s retained=%v", m.topic, m.retain)
+	}
+	if m := next(); m.topic != "dvr/state" {
+		t.Errorf("state not republished after event: %s", m.topic)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
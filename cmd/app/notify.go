@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// Events that are sent to notification providers. Providers can limit
+// themselves to some of them; other events on the bus are not sent.
+const (
+	eventRecordingStarted   = "recording.started"
+	eventRecordingCompleted = "recording.completed"
+	eventRecordingFailed    = "recording.failed"
+	eventRecordingPartial   = "recording.partial"
+	eventRecordingDeleted   = "recording.deleted"
+	eventDiskLow            = "disk.low"
+	eventQualityReduced     = "recording.quality_reduced"
+	eventGuideRefreshFailed = "guide.refresh_failed"
+	// eventTest is sent by POST /api/notifications/test to every provider.
+	eventTest = "test"
+)
+
+var notificationEvents = []string{
+	eventRecordingStarted, eventRecordingCompleted, eventRecordingFailed, eventRecordingPartial,
+	eventRecordingDeleted, eventDiskLow, eventQualityReduced, eventGuideRefreshFailed,
+}
+
+// NotificationRecording describes the recording an event is about.
+type NotificationRecording struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title,omitempty"`
+	ChannelID   string `json:"channelId,omitempty"`
+	ChannelName string `json:"channelName,omitempty"`
+	Date        string `json:"date,omitempty"`
+	StartTime   string `json:"startTime,omitempty"`
+	Duration    int    `json:"duration,omitempty"`
+	Status      string `json:"status,omitempty"`
+	File        string `json:"file,omitempty"`
+}
+
+// Notification is what providers send. Subject and Message are a ready
+// made human-readable summary; Data is the event's own payload.
+type Notification struct {
+	Event     string                 `json:"event"`
+	Time      time.Time              `json:"time"`
+	Subject   string                 `json:"subject"`
+	Message   string                 `json:"message"`
+	Recording *NotificationRecording `json:"recording,omitempty"`
+	Data      interface{}            `json:"data,omitempty"`
+}
+
+// notifier delivers notifications to one destination.
+type notifier interface {
+	name() string
+	notify(ctx context.Context, n Notification) error
+}
+
+// notifierEntry is a configured provider and the events it is sent; no
+// events means all of them.
+type notifierEntry struct {
+	notifier notifier
+	events   []string
+}
+
+func (e notifierEntry) wants(event string) bool {
+	if event == eventTest || len(e.events) == 0 {
+		return true
+	}
+	for _, ev := range e.events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// newNotifiers returns an entry for each configured provider.
+func newNotifiers(cfg pkgcfg.Notifications) []notifierEntry {
+	var entries []notifierEntry
+	for _, wh := range cfg.Webhooks {
+		if wh.URL == "" {
+			continue
+		}
+		entries = append(entries, notifierEntry{notifier: newWebhookNotifier(wh), events: wh.Events})
+	}
+	if e := cfg.Email; e != nil && e.Host != "" && len(e.To) > 0 {
+		events := e.Events
+		if len(events) == 0 {
+			events = emailDefaultEvents
+		}
+		entries = append(entries, notifierEntry{notifier: newEmailNotifier(*e), events: events})
+	}
+	if n := cfg.Ntfy; n != nil && n.Topic != "" {
+		events := n.Events
+		if len(events) == 0 {
+			events = pushDefaultEvents
+		}
+		entries = append(entries, notifierEntry{notifier: newNtfyNotifier(*n), events: events})
+	}
+	if p := cfg.Pushover; p != nil && p.Token != "" && p.User != "" {
+		events := p.Events
+		if len(events) == 0 {
+			events = pushDefaultEvents
+		}
+		entries = append(entries, notifierEntry{notifier: newPushoverNotifier(*p), events: events})
+	}
+	if d := cfg.Discord; d != nil && d.URL != "" {
+		events := d.Events
+		if len(events) == 0 {
+			events = chatDefaultEvents
+		}
+		entries = append(entries, notifierEntry{notifier: newDiscordNotifier(d.URL, cfg.PublicURL), events: events})
+	}
+	if sl := cfg.Slack; sl != nil && sl.URL != "" {
+		events := sl.Events
+		if len(events) == 0 {
+			events = chatDefaultEvents
+		}
+		entries = append(entries, notifierEntry{notifier: newSlackNotifier(sl.URL, cfg.PublicURL), events: events})
+	}
+	if k := cfg.Kodi; k != nil && k.URL != "" {
+		events := k.Events
+		if len(events) == 0 {
+			events = []string{eventRecordingCompleted}
+		}
+		entries = append(entries, notifierEntry{notifier: newKodiNotifier(*k), events: events})
+	}
+	return entries
+}
+
+// isNotificationEvent reports whether typ is sent to providers.
+func isNotificationEvent(typ string) bool {
+	for _, ev := range notificationEvents {
+		if ev == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// eventField returns a field of an event's map payload.
+func eventField(data interface{}, key string) (interface{}, bool) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	v, ok := m[key]
+	return v, ok
+}
+
+// loadNotificationRecording loads the recording an event refers to. A
+// deleted recording only has its ID and whatever the event carried.
+func (a *App) loadNotificationRecording(ctx context.Context, id int, data interface{}) *NotificationRecording {
+	rec := &NotificationRecording{ID: id}
+	var title sql.NullString
+	err := a.dbQueryRowContext(ctx, `
+		SELECT r.title, r.channel_id, COALESCE(c.guide_name, ''), r.date, r.start_time, r.duration, r.status, COALESCE(f.path, '')
+		FROM recordings r
+		LEFT JOIN channels c ON c.guide_number = r.channel_id
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		WHERE r.id = ?`, id).Scan(&title, &rec.ChannelID, &rec.ChannelName, &rec.Date, &rec.StartTime, &rec.Duration, &rec.Status, &rec.File)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Error loading recording for notification", "recording_id", id, "err", err)
+	}
+	rec.Title = title.String
+	if t, ok := eventField(data, "title"); ok && rec.Title == "" {
+		rec.Title, _ = t.(string)
+	}
+	return rec
+}
+
+// buildNotification turns a bus event into a notification.
+func (a *App) buildNotification(ctx context.Context, e Event) Notification {
+	n := Notification{Event: e.Type, Time: e.Time, Data: e.Data}
+	if id, ok := eventField(e.Data, "id"); ok {
+		if id, ok := id.(int); ok {
+			n.Recording = a.loadNotificationRecording(ctx, id, e.Data)
+		}
+	}
+
+	what := ""
+	if n.Recording != nil {
+		what = n.Recording.Title
+		if what == "" {
+			what = fmt.Sprintf("recording %d", n.Recording.ID)
+		}
+		if n.Recording.ChannelID != "" {
+			what += fmt.Sprintf(" (%s %s %s)", strings.TrimSpace(n.Recording.ChannelID+" "+n.Recording.ChannelName),
+				n.Recording.Date, n.Recording.StartTime)
+		}
+	}
+	reason := ""
+	if r, ok := eventField(e.Data, "reason"); ok {
+		reason = fmt.Sprint(r)
+	}
+
+	switch e.Type {
+	case eventRecordingStarted:
+		n.Subject, n.Message = "Recording started", "Started recording "+what
+	case eventRecordingCompleted:
+		n.Subject, n.Message = "Recording completed", "Finished recording "+what
+	case eventRecordingFailed:
+		n.Subject, n.Message = "Recording failed", "Could not record "+what
+	case eventRecordingPartial:
+		n.Subject, n.Message = "Recording incomplete", "Recording stopped early: "+what
+	case eventRecordingDeleted:
+		n.Subject, n.Message = "Recording deleted", "Deleted "+what
+	case eventDiskLow:
+		root, _ := eventField(e.Data, "root")
+		free, _ := eventField(e.Data, "freeBytes")
+		freeBytes, _ := free.(int64)
+		n.Subject = "Disk space low"
+		n.Message = fmt.Sprintf("%v has %.1f GB free", root, float64(freeBytes)/(1<<30))
+	case eventQualityReduced:
+		tier, _ := eventField(e.Data, "tier")
+		n.Subject = "Recording quality reduced"
+		n.Message = fmt.Sprintf("Low on space, recording %s with quality tier %v instead of stream copy", what, tier)
+	case eventGuideRefreshFailed:
+		n.Subject, n.Message = "Guide refresh failed", "The guide could not be refreshed"
+	case eventTest:
+		n.Subject, n.Message = "Test notification", "Notifications from hdhr-dvr are working"
+	default:
+		n.Subject, n.Message = e.Type, e.Type
+	}
+	if reason != "" {
+		n.Message += ": " + reason
+	}
+	return n
+}
+
+// notify sends n to every provider that wants it, each in its own
+// goroutine so a slow provider does not hold up the others. It returns
+// once all have finished or failed, with each provider's error keyed by
+// its name, followed by its position among the providers when several
+// share a name.
+func (a *App) notify(ctx context.Context, n Notification) map[string]error {
+	entries := a.currentNotifiers()
+	names := make(map[string]int)
+	for _, entry := range entries {
+		names[entry.notifier.name()]++
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	for i, entry := range entries {
+		if !entry.wants(n.Event) {
+			continue
+		}
+		key := entry.notifier.name()
+		if names[key] > 1 {
+			key = fmt.Sprintf("%s #%d", key, i+1)
+		}
+		wg.Add(1)
+		go func(p notifier, key string) {
+			defer wg.Done()
+			err := p.notify(ctx, n)
+			if err != nil {
+				slog.Error("Error sending notification", "event", n.Event, "provider", key, "err", err)
+			}
+			mu.Lock()
+			errs[key] = err
+			mu.Unlock()
+		}(entry.notifier, key)
+	}
+	wg.Wait()
+	return errs
+}
+
+// watchNotifications sends the notification events on the bus to the
+// providers until ctx is done.
+func (a *App) watchNotifications(ctx context.Context) {
+	events, unsubscribe := a.events.subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if !isNotificationEvent(e.Type) {
+				continue
+			}
+			go a.notify(ctx, a.buildNotification(ctx, e))
+		}
+	}
+}
+
+// checkDiskSpace publishes disk.low for each storage root whose free space
+// has dropped below the configured threshold. A root is reported again
+// only after it has recovered.
+func (a *App) checkDiskSpace() {
+	threshold := int64(a.cfg().Notifications.DiskLowGB * (1 << 30))
+	if threshold <= 0 {
+		return
+	}
+	a.diskLowMu.Lock()
+	defer a.diskLowMu.Unlock()
+	if a.diskLow == nil {
+		a.diskLow = make(map[string]bool)
+	}
+	for _, root := range a.storageRoots() {
+		sr, ok := root.store.(storage.SpaceReporter)
+		if !ok {
+			continue
+		}
+		free, err := sr.FreeSpace()
+		if err != nil {
+			slog.Error("Error checking free space", "dir", root.dir, "err", err)
+			continue
+		}
+		low := free < threshold
+		if low && !a.diskLow[root.dir] {
+			slog.Warn("Free space is low", "dir", root.dir, "free_mb", free/(1024*1024))
+			a.events.publish(eventDiskLow, map[string]interface{}{"root": root.dir, "freeBytes": free})
+		}
+		a.diskLow[root.dir] = low
+	}
+}
+
+// testNotifications sends a test notification to every provider and
+// reports the outcome of each.
+func (a *App) testNotifications(w http.ResponseWriter, r *http.Request) {
+	if len(a.currentNotifiers()) == 0 {
+		http.Error(w, "No notification provider configured", http.StatusServiceUnavailable)
+		return
+	}
+	n := a.buildNotification(r.Context(), Event{Type: eventTest, Time: time.Now()})
+	results := make(map[string]string)
+	for name, err := range a.notify(r.Context(), n) {
+		results[name] = "ok"
+		if err != nil {
+			results[name] = err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results) //nolint: errcheck
+}
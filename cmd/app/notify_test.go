@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// fakeNotifier records the notifications it is sent.
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+	err  error
+}
+
+func (f *fakeNotifier) name() string { return "fake" }
+
+func (f *fakeNotifier) notify(ctx context.Context, n Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, n)
+	return f.err
+}
+
+func (f *fakeNotifier) received() []Notification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Notification(nil), f.sent...)
+}
+
+func TestBuildNotification(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	for _, q := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'failed', 'News')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := app.buildNotification(context.Background(), Event{Type: eventRecordingFailed, Data: map[string]interface{}{"id": 1, "reason": "tuner busy"}})
+	if n.Subject != "Recording failed" || n.Message != "Could not record News (5.1 KPIX 2026-03-01 20:00): tuner busy" {
+		t.Errorf("got %q / %q", n.Subject, n.Message)
+	}
+	if n.Recording == nil || n.Recording.Status != "failed" || n.Recording.ChannelName != "KPIX" {
+		t.Errorf("recording %+v", n.Recording)
+	}
+
+	// A deleted recording is described by what the event carried.
+	n = app.buildNotification(context.Background(), Event{Type: eventRecordingDeleted, Data: map[string]interface{}{"id": 7, "title": "Weather"}})
+	if n.Message != "Deleted Weather" {
+		t.Errorf("deleted: %q", n.Message)
+	}
+}
+
+func TestWatchNotifications(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	all := &fakeNotifier{}
+	failures := &fakeNotifier{}
+	app.notifiers = []notifierEntry{{notifier: all}, {notifier: failures, events: []string{eventRecordingFailed}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.watchNotifications(ctx)
+	time.Sleep(10 * time.Millisecond)
+
+	app.events.publish("guide.updated", nil)
+	app.events.publish(eventRecordingCompleted, map[string]interface{}{"id": 1})
+	app.markFailed(2, "test")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(all.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := all.received(); len(got) != 2 {
+		t.Errorf("unfiltered provider got %d notifications, want 2", len(got))
+	}
+	if got := failures.received(); len(got) != 1 || got[0].Event != eventRecordingFailed || got[0].Recording.ID != 2 {
+		t.Errorf("failure-only provider got %+v", got)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	mem.SetCapacity(2 << 20)
+	app.storage = mem
+	app.config.StorageDir = "/recordings"
+	app.config.Notifications.DiskLowGB = 1.0 / 1024 // 1 MB
+
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+	count := func() int {
+		n := 0
+		for {
+			select {
+			case e := <-events:
+				if e.Type == eventDiskLow {
+					n++
+				}
+			default:
+				return n
+			}
+		}
+	}
+
+	app.checkDiskSpace()
+	if n := count(); n != 0 {
+		t.Errorf("%d disk.low events with 2 MB free", n)
+	}
+	mem.WriteFile("big.ts", make([]byte, 1<<20+1))
+	app.checkDiskSpace()
+	app.checkDiskSpace()
+	if n := count(); n != 1 {
+		t.Errorf("%d disk.low events while low, want 1", n)
+	}
+	mem.Remove("big.ts") //nolint: errcheck
+	app.checkDiskSpace()
+	mem.WriteFile("big.ts", make([]byte, 1<<20+1))
+	app.checkDiskSpace()
+	if n := count(); n != 1 {
+		t.Errorf("%d disk.low events after recovering, want 1", n)
+	}
+}
+
+func TestTestNotifications(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	rr := httptest.NewRecorder()
+	app.testNotifications(rr, httptest.NewRequest("POST", "/api/notifications/test", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("without providers: %d", rr.Code)
+	}
+
+	f := &fakeNotifier{err: errors.New("unreachable")}
+	app.notifiers = []notifierEntry{{notifier: f, events: []string{eventRecordingFailed}}}
+	rr = httptest.NewRecorder()
+	app.testNotifications(rr, httptest.NewRequest("POST", "/api/notifications/test", nil))
+	var results map[string]string
+	json.NewDecoder(rr.Body).Decode(&results) //nolint: errcheck
+	if results["fake"] != "unreachable" || len(f.received()) != 1 {
+		t.Errorf("results %v", results)
+	}
+
+	// Providers with the same name each get their own result.
+	ok := &fakeNotifier{}
+	app.notifiers = append(app.notifiers, notifierEntry{notifier: ok})
+	rr = httptest.NewRecorder()
+	app.testNotifications(rr, httptest.NewRequest("POST", "/api/notifications/test", nil))
+	results = nil
+	json.NewDecoder(rr.Body).Decode(&results) //nolint: errcheck
+	if len(results) != 2 || results["fake #1"] != "unreachable" || results["fake #2"] != "ok" {
+		t.Errorf("results %v", results)
+	}
+}
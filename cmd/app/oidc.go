@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// The OIDC routes, which must be reachable before signing in.
+const (
+	oidcLoginRoute    = apiPrefix + "/oidc/login"
+	oidcCallbackRoute = apiPrefix + "/oidc/callback"
+)
+
+// oidcCookie holds the state, nonce and PKCE verifier of a sign-in in
+// progress.
+const oidcCookie = "dvr_oidc"
+
+// oidcClient talks to the provider.
+var oidcClient = &http.Client{Timeout: 15 * time.Second}
+
+// oidcProvider is a provider's discovery document and signing keys.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	configured string // the issuer it was discovered from
+	keys       map[string]crypto.PublicKey
+	keysAt     time.Time
+}
+
+// oidcGet fetches a provider document into out.
+func oidcGet(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return getJSON(oidcClient, req, out)
+}
+
+// oidcDiscover returns the provider for issuer, fetching its discovery
+// document the first time and again after the issuer changes on reload.
+func (a *App) oidcDiscover(ctx context.Context, issuer string) (*oidcProvider, error) {
+	a.oidcMu.Lock()
+	defer a.oidcMu.Unlock()
+	if p := a.oidcProvider; p != nil && p.configured == issuer {
+		return p, nil
+	}
+	p := &oidcProvider{configured: issuer}
+	if err := oidcGet(ctx, strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", p); err != nil {
+		return nil, err
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("provider reports issuer %q, not %q", p.Issuer, issuer)
+	}
+	a.oidcProvider = p
+	return p, nil
+}
+
+// oidcKey returns the provider's signing key kid. The key set is fetched
+// again for an unknown kid, since providers rotate keys, but at most once a
+// minute.
+func (a *App) oidcKey(ctx context.Context, p *oidcProvider, kid string) (crypto.PublicKey, error) {
+	a.oidcMu.Lock()
+	defer a.oidcMu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.keysAt) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := oidcGet(ctx, p.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys, p.keysAt = map[string]crypto.PublicKey{}, time.Now()
+	dec := base64.RawURLEncoding
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, err1 := dec.DecodeString(k.N)
+			e, err2 := dec.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, err1 := dec.DecodeString(k.X)
+			y, err2 := dec.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			p.keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verifyJWT checks the RS256 or ES256 signature of a compact JWT with the
+// key keyFor returns for its kid, and returns its claims.
+func verifyJWT(raw string, keyFor func(kid string) (crypto.PublicKey, error)) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	dec := base64.RawURLEncoding
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	h, err := dec.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(h, &header) != nil {
+		return nil, errors.New("malformed token header")
+	}
+	sig, err := dec.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	key, err := keyFor(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 ||
+			!ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, errors.New("invalid token signature")
+		}
+	default:
+		return nil, errors.New("unsupported signing key")
+	}
+
+	payload, err := dec.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	return claims, nil
+}
+
+// checkIDToken checks the standard ID token claims: issuer, audience,
+// expiry and the nonce sent with the sign-in.
+func checkIDToken(claims map[string]any, issuer, clientID, nonce string, now time.Time) error {
+	if claims["iss"] != issuer {
+		return fmt.Errorf("token issued by %v", claims["iss"])
+	}
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud != clientID {
+			return fmt.Errorf("token is for %q", aud)
+		}
+	case []any:
+		if !slices.Contains(aud, any(clientID)) {
+			return errors.New("token is for another client")
+		}
+	default:
+		return errors.New("token has no audience")
+	}
+	exp, _ := claims["exp"].(float64)
+	if now.After(time.Unix(int64(exp), 0).Add(time.Minute)) {
+		return errors.New("token expired")
+	}
+	if claims["nonce"] != nonce {
+		return errors.New("token nonce does not match")
+	}
+	return nil
+}
+
+// claimStrings returns a claim holding a string or a list of strings.
+func claimStrings(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// oidcRedirectURL returns the callback URL for r.
+func (a *App) oidcRedirectURL(r *http.Request, o *pkgcfg.OIDC) string {
+	if o.RedirectURL != "" {
+		return o.RedirectURL
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + a.cfg().BasePath + oidcCallbackRoute
+}
+
+// randomString returns n random bytes, base64url-encoded.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oidcLogin starts a sign-in by sending the browser to the provider.
+func (a *App) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	o := a.cfg().Auth.OIDC
+	if o == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	p, err := a.oidcDiscover(r.Context(), o.Issuer)
+	if err != nil {
+		requestLogger(r).Error("Error discovering OIDC provider", "issuer", o.Issuer, "err", err)
+		http.Error(w, "Single sign-on provider unavailable", http.StatusBadGateway)
+		return
+	}
+	var vals [3]string // state, nonce, PKCE verifier
+	for i := range vals {
+		if vals[i], err = randomString(32); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	challenge := sha256.Sum256([]byte(vals[2]))
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    strings.Join(vals[:], "."),
+		Path:     a.cfg().BasePath + "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {a.oidcRedirectURL(r, o)},
+		"scope":                 {strings.Join(o.Scopes, " ")},
+		"state":                 {vals[0]},
+		"nonce":                 {vals[1]},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, p.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// oidcCallback completes a sign-in: it exchanges the code for an ID token,
+// checks it, and starts a session for the user it names.
+func (a *App) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	o := a.cfg().Auth.OIDC
+	if o == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	c, err := r.Cookie(oidcCookie)
+	vals := []string{}
+	if err == nil {
+		vals = strings.Split(c.Value, ".")
+	}
+	if len(vals) != 3 || r.URL.Query().Get("state") != vals[0] {
+		http.Error(w, "Sign-in expired or was started elsewhere; try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: a.cfg().BasePath + "/", MaxAge: -1})
+	if e := r.URL.Query().Get("error"); e != "" {
+		requestLogger(r).Warn("OIDC sign-in refused by provider", "error", e, "description", r.URL.Query().Get("error_description"))
+		http.Error(w, "Sign-in refused: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	p, err := a.oidcDiscover(r.Context(), o.Issuer)
+	if err != nil {
+		requestLogger(r).Error("Error discovering OIDC provider", "issuer", o.Issuer, "err", err)
+		http.Error(w, "Single sign-on provider unavailable", http.StatusBadGateway)
+		return
+	}
+	claims, err := a.oidcExchange(r, o, p, r.URL.Query().Get("code"), vals[2])
+	if err == nil {
+		err = checkIDToken(claims, p.Issuer, o.ClientID, vals[1], time.Now())
+	}
+	if err != nil {
+		requestLogger(r).Warn("OIDC sign-in failed", "err", err)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	username, _ := claims[o.UsernameClaim].(string)
+	if username == "" {
+		requestLogger(r).Warn("OIDC token has no username", "claim", o.UsernameClaim)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	groups := claimStrings(claims, o.GroupsClaim)
+	if len(o.AllowedGroups) > 0 && !slices.ContainsFunc(groups, func(g string) bool { return slices.Contains(o.AllowedGroups, g) }) {
+		requestLogger(r).Warn("OIDC user not in an allowed group", "username", username, "groups", groups)
+		http.Error(w, "Not allowed to use this DVR", http.StatusForbidden)
+		return
+	}
+	u, err := a.externalUser(r.Context(), username, false)
+	if err != nil {
+		requestLogger(r).Warn("OIDC sign-in refused", "username", username, "err", err)
+		http.Error(w, "Sign-in failed", http.StatusForbidden)
+		return
+	}
+	if adminGroups := a.cfg().Auth.AdminGroups; len(adminGroups) > 0 {
+		u.Role = roleForGroups(groups, adminGroups)
+		if err := a.setRole(r.Context(), u.Username, u.Role); err != nil {
+			requestLogger(r).Error("Error setting role", "username", u.Username, "err", err)
+			http.Error(w, "Error signing in", http.StatusInternalServerError)
+			return
+		}
+	}
+	token, expires, err := a.createSession(r.Context(), u, time.Now())
+	if err != nil {
+		requestLogger(r).Error("Error creating session", "err", err)
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Signed in with OIDC", "username", u.Username, "role", u.Role)
+	a.setSessionCookie(w, r, token, expires)
+	http.Redirect(w, r, a.cfg().BasePath+"/", http.StatusSeeOther)
+}
+
+// oidcExchange redeems an authorization code at the token endpoint and
+// returns the verified claims of the ID token.
+func (a *App) oidcExchange(r *http.Request, o *pkgcfg.OIDC, p *oidcProvider, code, verifier string) (map[string]any, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {a.oidcRedirectURL(r, o)},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(r.Context(), "POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, err
+	}
+	return verifyJWT(tok.IDToken, func(kid string) (crypto.PublicKey, error) {
+		return a.oidcKey(r.Context(), p, kid)
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// fakeProvider is an OIDC provider issuing ID tokens with the claims in
+// claims, plus the nonce of the sign-in.
+type fakeProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+	nonce  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+	m := http.NewServeMux()
+	m.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{ //nolint: errcheck
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	m.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{ //nolint: errcheck
+			"kid": "k1", "kty": "RSA", "use": "sig",
+			"n": enc.EncodeToString(key.N.Bytes()),
+			"e": enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	m.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "dvr" || secret != "s3cret" || r.FormValue("code") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t)}) //nolint: errcheck
+	})
+	p.Server = httptest.NewServer(m)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// sign returns an ID token for claims.
+func (p *fakeProvider) sign(t *testing.T) string {
+	claims := map[string]any{"iss": p.URL, "aud": "dvr", "exp": time.Now().Add(time.Hour).Unix(), "nonce": p.nonce}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	p := newFakeProvider(t)
+	app.config.Auth = pkgcfg.Auth{Enabled: true, SessionHours: 1, OIDC: &pkgcfg.OIDC{
+		Issuer: p.URL, ClientID: "dvr", ClientSecret: "s3cret", Scopes: []string{"openid", "profile"},
+		UsernameClaim: "preferred_username", GroupsClaim: "groups", AllowedGroups: []string{"dvr-users"},
+	}}
+
+	signIn := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.oidcLogin(rr, httptest.NewRequest("GET", "http://dvr.lan/api/v1/oidc/login", nil))
+		loc, err := url.Parse(rr.Header().Get("Location"))
+		if err != nil || rr.Code != http.StatusFound || !strings.HasPrefix(loc.String(), p.URL+"/authorize?") {
+			t.Fatalf("login redirect: %d %q", rr.Code, loc)
+		}
+		q := loc.Query()
+		if q.Get("redirect_uri") != "http://dvr.lan/api/v1/oidc/callback" || q.Get("code_challenge_method") != "S256" {
+			t.Errorf("authorization request %v", q)
+		}
+		p.nonce = q.Get("nonce")
+
+		req := httptest.NewRequest("GET", "http://dvr.lan/api/v1/oidc/callback?code=abc&state="+q.Get("state"), nil)
+		for _, c := range rr.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		rr = httptest.NewRecorder()
+		app.oidcCallback(rr, req)
+		return rr
+	}
+
+	p.claims = map[string]any{"preferred_username": "alice", "groups": []string{"dvr-users"}}
+	rr := signIn()
+	var session string
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == sessionCookie {
+			session = c.Value
+		}
+	}
+	if rr.Code != http.StatusSeeOther || session == "" {
+		t.Fatalf("callback: %d %s", rr.Code, rr.Body)
+	}
+	// Users added on sign-in are viewers.
+	if u, err := app.lookupSession(context.Background(), session); err != nil || u.Username != "alice" || u.Role != roleViewer {
+		t.Errorf("session user %+v, %v", u, err)
+	}
+
+	// With adminGroups, the role follows the groups at each sign-in.
+	app.config.Auth.AdminGroups = []string{"dvr-users"}
+	if rr := signIn(); rr.Code != http.StatusSeeOther {
+		t.Fatalf("callback: %d", rr.Code)
+	}
+	if users, _ := app.listUsers(context.Background()); len(users) != 1 || users[0].Role != roleAdmin {
+		t.Errorf("users %+v", users)
+	}
+	app.config.Auth.AdminGroups = nil
+
+	// An account from before roles keeps being an admin.
+	if _, err := db.Exec("INSERT INTO users (username, password_hash) VALUES ('carol', '')"); err != nil {
+		t.Fatal(err)
+	}
+	p.claims = map[string]any{"preferred_username": "carol", "groups": []string{"dvr-users"}}
+	if rr := signIn(); rr.Code != http.StatusSeeOther {
+		t.Fatalf("callback: %d", rr.Code)
+	}
+	if u, err := app.externalUser(context.Background(), "carol", false); err != nil || u.Role != roleAdmin {
+		t.Errorf("user from before roles %+v, %v", u, err)
+	}
+
+	p.claims = map[string]any{"preferred_username": "mallory", "groups": []string{"guests"}}
+	if rr := signIn(); rr.Code != http.StatusForbidden {
+		t.Errorf("user outside allowedGroups: %d", rr.Code)
+	}
+
+	// An identity named like a local user does not get their account.
+	if _, err := app.addUser(context.Background(), "bob", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	p.claims = map[string]any{"preferred_username": "bob", "groups": "dvr-users"}
+	if rr := signIn(); rr.Code != http.StatusForbidden {
+		t.Errorf("local user name: %d", rr.Code)
+	}
+
+	// A callback without the sign-in's state cookie is refused.
+	rr = httptest.NewRecorder()
+	app.oidcCallback(rr, httptest.NewRequest("GET", "/api/v1/oidc/callback?code=abc&state=x", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("callback without state: %d", rr.Code)
+	}
+
+	// Tokens are only accepted with the provider's signature.
+	parts := strings.Split(p.sign(t), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"preferred_username": "root"}`))
+	keyFor := func(kid string) (crypto.PublicKey, error) { return &p.key.PublicKey, nil }
+	if _, err := verifyJWT(strings.Join(parts, "."), keyFor); err == nil {
+		t.Error("tampered token accepted")
+	}
+}
+
+func TestCheckIDToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid := func() map[string]any {
+		return map[string]any{"iss": "https://idp", "aud": []any{"other", "dvr"}, "exp": float64(now.Unix() + 60), "nonce": "n"}
+	}
+	if err := checkIDToken(valid(), "https://idp", "dvr", "n", now); err != nil {
+		t.Errorf("valid token: %v", err)
+	}
+	for name, change := range map[string]func(map[string]any){
+		"issuer":   func(c map[string]any) { c["iss"] = "https://evil" },
+		"audience": func(c map[string]any) { c["aud"] = "other" },
+		"expired":  func(c map[string]any) { c["exp"] = float64(now.Unix() - 120) },
+		"nonce":    func(c map[string]any) { c["nonce"] = "m" },
+	} {
+		c := valid()
+		change(c)
+		if err := checkIDToken(c, "https://idp", "dvr", "n", now); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
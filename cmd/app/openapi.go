@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// openapiRoute serves an OpenAPI 3 description of the API.
+const openapiRoute = apiPrefix + "/openapi.json"
+
+// apiOperation documents one method of an API route: what the handler
+// reads and writes and how it reports errors. Bodies are given as a zero
+// value of their Go type and described by reflection, so the document
+// follows the types the handlers decode and encode.
+type apiOperation struct {
+	summary  string
+	query    []string    // query parameters
+	request  interface{} // JSON request body
+	response interface{} // JSON response body
+	content  string      // media type of a response that is not JSON
+	status   int         // success status, http.StatusOK when zero
+	text     []int       // statuses answered with a plain-text error
+	json     []int       // statuses answered with {"error": "..."}
+}
+
+// apiOperations is keyed by method and route template. HEAD is documented
+// by the GET entry of the same route.
+var apiOperations = map[string]apiOperation{
+	"GET /api/v1/channels": {summary: "List enabled channels; all=true adds disabled and stale ones", query: []string{"all"},
+		response: []ChannelInfo{}, text: []int{500}},
+	"POST /api/v1/channels/refresh": {summary: "Fetch the lineup from the tuner and list the channels",
+		response: []ChannelInfo{}, text: []int{500, 502}},
+	"GET /api/v1/recordings": {summary: "List recordings; orphaned=true lists files without a recording", query: []string{"orphaned"},
+		response: []GetRecordingsRec{}, text: []int{500}},
+	"POST /api/v1/recordings": {summary: "Schedule a recording",
+		request: RecordingRequest{}, response: types.Recording{}, status: http.StatusCreated, text: []int{400, 500}, json: []int{400, 404, 409, 500}},
+	"GET /api/v1/recordings.rss": {summary: "Finished recordings as an RSS podcast feed", query: []string{"keyword", "category", "channel", "limit"},
+		content: "application/rss+xml", text: []int{400, 404, 500}},
+	"GET /api/v1/schedule.ics": {summary: "Upcoming recordings as an iCalendar feed",
+		content: "text/calendar", text: []int{500}},
+	"GET /api/v1/graphql": {summary: "Run a read-only GraphQL query", query: []string{"query", "operationName", "variables"},
+		response: graphqlResponse{}},
+	"POST /api/v1/graphql": {summary: "Run a read-only GraphQL query",
+		request: graphqlRequest{}, response: graphqlResponse{}},
+	"GET /api/v1/openapi.json": {summary: "This document",
+		response: map[string]interface{}{}},
+	"DELETE /api/v1/recordings/{id}": {summary: "Delete a recording and its files",
+		status: http.StatusNoContent, text: []int{400, 500}},
+	"PATCH /api/v1/recordings/{id}": {summary: "Rename a pending recording",
+		request: RecordingUpdate{}, status: http.StatusNoContent, text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/file": {summary: "Download the recording, with range requests",
+		content: "video/mp2t", text: []int{400, 403, 404, 500}},
+	"GET /api/v1/recordings/{id}/metadata": {summary: "Guide metadata stored with the recording",
+		response: types.RecordingMetadata{}, text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/poster": {summary: "Poster image of the recording",
+		content: "image/jpeg", text: []int{400, 404, 500}},
+	"POST /api/v1/recordings/{id}/enrich": {summary: "Look the recording up in the metadata provider",
+		response: types.Enrichment{}, text: []int{400, 404, 502, 503}},
+	"GET /api/v1/recordings/{id}/log": {summary: "ffmpeg log of the recording; follow=true streams it", query: []string{"follow"},
+		content: "text/plain", text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/history": {summary: "Status changes of the recording",
+		response: []RecordingEvent{}, text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/reports": {summary: "Playback problem reports",
+		response: PlaybackReportSummary{}, text: []int{400, 404, 500}},
+	"POST /api/v1/recordings/{id}/reports": {summary: "Report a playback problem",
+		request: PlaybackReportRequest{}, response: PlaybackReportSummary{}, status: http.StatusCreated, text: []int{400, 404, 409, 500}, json: []int{400}},
+	"PUT /api/v1/recordings/{id}/watch": {summary: "Set the caller's watch state",
+		request: WatchStateRequest{}, status: http.StatusNoContent, text: []int{400, 404, 500}, json: []int{400}},
+	"DELETE /api/v1/recordings/{id}/watch": {summary: "Clear the caller's watch state",
+		status: http.StatusNoContent, text: []int{400, 500}},
+	"POST /api/v1/recordings/{id}/cancel": {summary: "Cancel a pending recording or stop a running one",
+		status: http.StatusNoContent, text: []int{400}, json: []int{400, 404, 409}},
+	"POST /api/v1/recordings/{id}/extend": {summary: "Extend a pending or running recording",
+		request: ExtendRequest{}, status: http.StatusNoContent, text: []int{400}, json: []int{400, 404, 409}},
+	"PUT /api/v1/recordings/{id}/priority": {summary: "Set the retention priority",
+		request: PriorityRequest{}, status: http.StatusNoContent, text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/verification": {summary: "Result of the last verification",
+		response: Verification{}, text: []int{400, 404, 500}},
+	"POST /api/v1/recordings/{id}/verify": {summary: "Check the recording's files against their checksums",
+		response: ChecksumReport{}, text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/post-processing": {summary: "Post-processing steps run on the recording",
+		response: []PostProcessingStep{}, text: []int{400, 404, 500}},
+	"GET /api/v1/recordings/{id}/edl": {summary: "Commercial breaks as an EDL file",
+		content: "text/plain", text: []int{400, 404, 500}},
+	"PUT /api/v1/recordings/{id}/commercials": {summary: "Set how commercials are handled",
+		request: CommercialsRequest{}, status: http.StatusNoContent, text: []int{400, 404, 500}},
+	"POST /api/v1/recordings/{id}/transcode": {summary: "Queue a transcode job",
+		request: TranscodeJobRequest{}, response: TranscodeJob{}, status: http.StatusAccepted, text: []int{400, 500}, json: []int{404, 409}},
+	"GET /api/v1/transcode/profiles": {summary: "List transcode profiles",
+		response: []TranscodeProfile{}, text: []int{500}},
+	"POST /api/v1/transcode/profiles": {summary: "Create a transcode profile",
+		request: TranscodeProfile{}, response: TranscodeProfile{}, status: http.StatusCreated, text: []int{400, 500}, json: []int{400, 409}},
+	"DELETE /api/v1/transcode/profiles/{id}": {summary: "Delete a transcode profile",
+		status: http.StatusNoContent, text: []int{400, 404, 500}},
+	"GET /api/v1/jobs": {summary: "List transcode jobs", query: []string{"recording", "status"},
+		response: []TranscodeJob{}, text: []int{400, 500}},
+	"GET /api/v1/jobs/{id}": {summary: "Get a transcode job",
+		response: TranscodeJob{}, text: []int{400, 404, 500}},
+	"GET /api/v1/retention": {summary: "Retention policy and the most recent deletions",
+		response: map[string]interface{}{}, text: []int{500}},
+	"GET /api/v1/audit": {summary: "Audit log of changes, newest first", query: []string{"before", "limit", "path"},
+		response: []AuditEntry{}, text: []int{400, 500}},
+	"GET /api/v1/stats": {summary: "Recording statistics", query: []string{"from", "to"},
+		response: Stats{}, text: []int{400, 500}},
+	"GET /api/v1/storage": {summary: "Disk usage of the storage directories", query: []string{"top"},
+		response: StorageStats{}, text: []int{400, 500}},
+	"POST /api/v1/storage/reconcile": {summary: "Match recordings and files on disk",
+		response: ReconcileReport{}, text: []int{500}},
+	"POST /api/v1/storage/import": {summary: "Import a file on disk as a completed recording",
+		request: ImportRequest{}, response: map[string]int64{}, status: http.StatusCreated, text: []int{400, 500}, json: []int{400, 404, 409}},
+	"GET /api/v1/locks": {summary: "List channel locks",
+		response: []ChannelLock{}, text: []int{500}},
+	"POST /api/v1/locks": {summary: "Reserve a tuner for a channel on a weekly schedule",
+		request: ChannelLockRequest{}, response: ChannelLock{}, status: http.StatusCreated, text: []int{400, 500}, json: []int{400, 404}},
+	"DELETE /api/v1/locks/{id}": {summary: "Delete a channel lock",
+		status: http.StatusNoContent, text: []int{400, 404, 500}},
+	"GET /api/v1/schedule/forecast": {summary: "Tuner use over the coming hours", query: []string{"hours"},
+		response: Forecast{}, text: []int{500}, json: []int{400}},
+	"GET /api/v1/guide": {summary: "The program guide", query: []string{"category"},
+		response: types.Guide{}},
+	"GET /api/v1/guide/search": {summary: "Search guide programs", query: []string{"q", "limit"},
+		response: []types.Program{}, text: []int{400, 500}, json: []int{400}},
+	"GET /api/v1/guide/categories": {summary: "Guide categories with program counts",
+		response: []GuideCategory{}},
+	"GET /api/v1/guide/now": {summary: "What is on now and next on each channel",
+		response: []ChannelNowNext{}, text: []int{500}},
+	"POST /api/v1/guide/refresh": {summary: "Start a guide refresh",
+		status: http.StatusAccepted, json: []int{409}},
+	"GET /api/v1/guide/changes": {summary: "Programs added, removed or updated in the guide", query: []string{"since"},
+		response: GuideChanges{}, text: []int{400}},
+	"GET /api/v1/events": {summary: "Server-sent events",
+		content: "text/event-stream", text: []int{500}},
+	"POST /api/v1/notifications/test": {summary: "Send a test notification to every notifier",
+		response: map[string]string{}, text: []int{503}},
+	"GET /api/v1/logs": {summary: "Recent server log lines", query: []string{"lines", "since"},
+		response: map[string]interface{}{}, text: []int{400, 404}},
+	"GET /api/v1/admin/loglevel": {summary: "Current log level",
+		response: map[string]string{}},
+	"PUT /api/v1/admin/loglevel": {summary: "Set the log level",
+		request: LogLevelRequest{}, response: map[string]string{}, text: []int{400}},
+	"POST /api/v1/admin/reload": {summary: "Reload the config file",
+		response: ReloadResult{}, json: []int{400}},
+	"POST /api/v1/admin/backup": {summary: "Back up the database",
+		response: BackupInfo{}, status: http.StatusCreated, text: []int{500}, json: []int{409, 501}},
+	"GET /api/v1/admin/backups": {summary: "List database backups",
+		response: []BackupInfo{}, text: []int{500}},
+	"POST /api/v1/admin/restore": {summary: "Restore a database backup",
+		request: RestoreRequest{}, response: RestoreResult{}, text: []int{400}, json: []int{404, 409, 422, 500, 501}},
+	"POST /api/v1/login": {summary: "Sign in and receive a session cookie",
+		request: LoginRequest{}, response: User{}, text: []int{400, 500}, json: []int{401}},
+	"POST /api/v1/logout": {summary: "End the session",
+		status: http.StatusNoContent},
+	"GET /api/v1/session": {summary: "Who the caller is signed in as",
+		response: map[string]interface{}{}},
+	"GET /api/v1/profile/watch": {summary: "The caller's watch states",
+		response: []WatchState{}, text: []int{500}},
+	"GET /api/v1/profile/favorites": {summary: "The caller's favorite channels",
+		response: []string{}, text: []int{500}},
+	"PUT /api/v1/profile/favorites/{channel}": {summary: "Add a favorite channel",
+		status: http.StatusNoContent, text: []int{404, 500}},
+	"DELETE /api/v1/profile/favorites/{channel}": {summary: "Remove a favorite channel",
+		status: http.StatusNoContent, text: []int{500}},
+	"GET /api/v1/oidc/login": {summary: "Redirect to the OpenID Connect provider",
+		status: http.StatusFound, text: []int{404, 500, 502}},
+	"GET /api/v1/oidc/callback": {summary: "Finish an OpenID Connect sign-in", query: []string{"code", "state", "error", "error_description"},
+		status: http.StatusSeeOther, text: []int{400, 401, 403, 404, 500, 502}},
+	"GET /api/v1/admin/keys": {summary: "List API keys",
+		response: []APIKey{}, text: []int{500}},
+	"POST /api/v1/admin/keys": {summary: "Create an API key; the key is only returned here",
+		request: APIKeyRequest{}, response: createdAPIKey{}, status: http.StatusCreated, text: []int{400, 500}},
+	"DELETE /api/v1/admin/keys/{id}": {summary: "Revoke an API key",
+		status: http.StatusNoContent, text: []int{400, 404, 500}},
+	"GET /api/v1/settings": {summary: "Settings that can be changed at runtime",
+		response: Settings{}, text: []int{500}},
+	"PUT /api/v1/settings": {summary: "Change settings; null restores the config file's value",
+		request: map[string]interface{}{}, response: Settings{}, json: []int{400, 500}},
+	"POST /api/v1/diagnostics/throughput": {summary: "Measure a channel's stream throughput",
+		request: ThroughputRequest{}, response: ThroughputResult{}, text: []int{400, 500, 502}, json: []int{404, 409}},
+	"GET /api/v1/keywords": {summary: "List auto-record keywords",
+		response: []types.Keyword{}, text: []int{500}},
+	"POST /api/v1/keywords": {summary: "Add an auto-record keyword",
+		request: KeywordRequest{}, response: map[string]interface{}{}, status: http.StatusCreated, text: []int{400, 500}, json: []int{400, 409}},
+	"DELETE /api/v1/keywords/{id}": {summary: "Delete an auto-record keyword",
+		status: http.StatusNoContent, text: []int{400, 404, 500}},
+}
+
+// openapiParam matches a path variable in a route template, with an
+// optional pattern: {id} or {id:[0-9]+}.
+var openapiParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// serveOpenAPI serves the OpenAPI document for the API routes of r. It is
+// built on each request from the routes, apiOperations and the config, so
+// it lists the security schemes and middleware errors actually in effect.
+func (a *App) serveOpenAPI(r *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		doc, err := a.openapi(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc) //nolint: errcheck
+	}
+}
+
+// openapi builds the document.
+func (a *App) openapi(r *mux.Router) (map[string]interface{}, error) {
+	cfg := a.cfg()
+	schemas := openapiSchemas{"Error": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}}
+	paths := map[string]map[string]interface{}{}
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(tpl, apiPrefix+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		name := handlerName(route.GetHandler())
+		for i, method := range methods {
+			doc := method
+			if method == "HEAD" {
+				doc = "GET"
+			}
+			op := apiOperations[doc+" "+tpl]
+			o := map[string]interface{}{
+				"operationId": name,
+				"summary":     op.summary,
+				"tags":        []string{strings.SplitN(strings.TrimPrefix(tpl, apiPrefix+"/"), "/", 2)[0]},
+			}
+			if i > 0 {
+				o["operationId"] = name + strings.ToUpper(method[:1]) + strings.ToLower(method[1:])
+			}
+			if params := openapiParams(tpl, op.query); len(params) > 0 {
+				o["parameters"] = params
+			}
+			if op.request != nil {
+				o["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(op.request))}},
+				}
+			}
+			o["responses"] = a.openapiResponses(cfg.Auth.Enabled && !slices.Contains(publicRoutes, tpl), cfg.RateLimit != nil, method, op, schemas)
+			if cfg.Auth.Enabled && slices.Contains(publicRoutes, tpl) {
+				o["security"] = []interface{}{}
+			}
+			if paths[tpl] == nil {
+				paths[tpl] = map[string]interface{}{}
+			}
+			paths[tpl][strings.ToLower(method)] = o
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	server := "/"
+	if cfg.BasePath != "" {
+		server = cfg.BasePath
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "hdhr-dvr",
+			"version": apiVersion,
+			"description": "Errors are answered either as plain text or as JSON {\"error\": \"...\"}; " +
+				"each response lists which. Paths without /v1 are served as aliases.",
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": server}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+	if cfg.Auth.Enabled {
+		doc["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API key"},
+			"apiKey":  map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+		}
+		doc["security"] = []interface{}{
+			map[string][]string{"bearer": {}},
+			map[string][]string{"apiKey": {}},
+			map[string][]string{"session": {}},
+		}
+	}
+	return doc, nil
+}
+
+// openapiResponses describes the success and error responses of op,
+// including the ones the middleware answers before the handler runs.
+func (a *App) openapiResponses(auth, rateLimited bool, method string, op apiOperation, schemas openapiSchemas) map[string]interface{} {
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case method == "HEAD" || status == http.StatusNoContent || status == http.StatusFound || status == http.StatusSeeOther:
+	case op.response != nil:
+		ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(op.response))}}
+	case op.content != "":
+		ok["content"] = map[string]interface{}{op.content: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	}
+	responses := map[string]interface{}{strconv.Itoa(status): ok}
+
+	text, jsonErrs := slices.Clone(op.text), slices.Clone(op.json)
+	// withAPIVersion rejects a mismatched API-Version header, and
+	// rejectWhileDraining answers during shutdown.
+	jsonErrs = append(jsonErrs, http.StatusBadRequest)
+	text = append(text, http.StatusServiceUnavailable)
+	if auth {
+		jsonErrs = append(jsonErrs, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	if rateLimited {
+		jsonErrs = append(jsonErrs, http.StatusTooManyRequests)
+	}
+	errs := map[int]map[string]interface{}{}
+	for _, s := range text {
+		if errs[s] == nil {
+			errs[s] = map[string]interface{}{}
+		}
+		errs[s]["text/plain"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+	for _, s := range jsonErrs {
+		if errs[s] == nil {
+			errs[s] = map[string]interface{}{}
+		}
+		errs[s]["application/json"] = map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}}
+	}
+	for s, content := range errs {
+		responses[strconv.Itoa(s)] = map[string]interface{}{"description": http.StatusText(s), "content": content}
+	}
+	return responses
+}
+
+// openapiParams lists the path variables of tpl and the query parameters.
+func openapiParams(tpl string, query []string) []interface{} {
+	var params []interface{}
+	for _, m := range openapiParam.FindAllStringSubmatch(tpl, -1) {
+		typ := "string"
+		if m[1] == "id" {
+			typ = "integer"
+		}
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": typ},
+		})
+	}
+	for _, q := range query {
+		params = append(params, map[string]interface{}{
+			"name": q, "in": "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	return params
+}
+
+// handlerName is the name of the App method serving h, used as the
+// operationId.
+func handlerName(h http.Handler) string {
+	v := reflect.ValueOf(h)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+	name := strings.TrimSuffix(runtime.FuncForPC(v.Pointer()).Name(), "-fm")
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// openapiSchemas collects the named struct types met while describing
+// bodies, keyed by type name, for components/schemas.
+type openapiSchemas map[string]interface{}
+
+// schema describes t the way encoding/json marshals it.
+func (s openapiSchemas) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		sch := s.schema(t.Elem())
+		if _, ref := sch["$ref"]; !ref {
+			sch["nullable"] = true
+		}
+		return sch
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = map[string]interface{}{} // placeholder for recursive types
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// object describes the fields of struct t, with embedded structs
+// flattened as encoding/json does.
+func (s openapiSchemas) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range s.object(ft)["properties"].(map[string]interface{}) {
+				props[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		sch := s.schema(f.Type)
+		if slices.Contains(strings.Split(opts, ","), "string") {
+			sch = map[string]interface{}{"type": "string"}
+		}
+		props[name] = sch
+	}
+	return map[string]interface{}{"type": "object", "properties": props}
+}
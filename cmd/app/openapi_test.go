@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	seen := map[string]bool{}
+	app.newRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error { //nolint: errcheck
+		tpl, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		if !strings.HasPrefix(tpl, apiPrefix+"/") {
+			return nil
+		}
+		for _, m := range methods {
+			if m == "HEAD" {
+				continue
+			}
+			seen[m+" "+tpl] = true
+			if apiOperations[m+" "+tpl].summary == "" {
+				t.Errorf("%s %s is not in apiOperations", m, tpl)
+			}
+		}
+		return nil
+	})
+	for key := range apiOperations {
+		if !seen[key] {
+			t.Errorf("apiOperations has %s, which no route serves", key)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/recordings", app.createRecording).Methods("POST")
+	r.HandleFunc("/api/v1/recordings/{id}/file", app.getRecordingFile).Methods("GET", "HEAD")
+	r.HandleFunc("/api/v1/login", app.login).Methods("POST")
+	r.HandleFunc("/metrics", app.serveMetrics).Methods("GET")
+	r.HandleFunc(openapiRoute, app.serveOpenAPI(r)).Methods("GET")
+	get := func() map[string]interface{} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", openapiRoute, nil))
+		var doc map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("%v: %s", err, rr.Body)
+		}
+		return doc
+	}
+	at := func(v interface{}, path ...string) interface{} {
+		for _, p := range path {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = m[p]
+		}
+		return v
+	}
+
+	doc := get()
+	if doc["openapi"] != "3.0.3" || at(doc, "paths", "/metrics") != nil {
+		t.Errorf("document %v", doc)
+	}
+	post := at(doc, "paths", "/api/v1/recordings", "post")
+	if id := at(post, "operationId"); id != "createRecording" {
+		t.Errorf("operationId %v", id)
+	}
+	if ref := at(post, "requestBody", "content", "application/json", "schema", "$ref"); ref != "#/components/schemas/RecordingRequest" {
+		t.Errorf("request body %v", ref)
+	}
+	if ref := at(post, "responses", "201", "content", "application/json", "schema", "$ref"); ref != "#/components/schemas/Recording" {
+		t.Errorf("201 %v", ref)
+	}
+	// Scheduling errors come as JSON, database errors as text or JSON.
+	if c := at(post, "responses", "404", "content"); at(c, "application/json") == nil || at(c, "text/plain") != nil {
+		t.Errorf("404 %v", c)
+	}
+	if c := at(post, "responses", "500", "content"); at(c, "application/json") == nil || at(c, "text/plain") == nil {
+		t.Errorf("500 %v", c)
+	}
+	if at(post, "responses", "401") != nil || doc["security"] != nil {
+		t.Errorf("auth documented while disabled")
+	}
+	if typ := at(doc, "components", "schemas", "RecordingRequest", "properties", "title", "nullable"); typ != true {
+		t.Errorf("title nullable %v", typ)
+	}
+	if at(doc, "components", "schemas", "Recording", "properties") == nil {
+		t.Errorf("Recording schema missing")
+	}
+
+	file := at(doc, "paths", "/api/v1/recordings/{id}/file")
+	if at(file, "head", "operationId") != "getRecordingFileHead" || at(file, "get", "responses", "200", "content", "video/mp2t") == nil {
+		t.Errorf("file %v", file)
+	}
+	params, _ := at(file, "get", "parameters").([]interface{})
+	if len(params) != 1 || at(params[0], "name") != "id" || at(params[0], "in") != "path" {
+		t.Errorf("parameters %v", params)
+	}
+
+	app.config.Auth.Enabled = true
+	doc = get()
+	if doc["security"] == nil || at(doc, "components", "securitySchemes", "session", "name") != sessionCookie {
+		t.Errorf("security %v", at(doc, "components", "securitySchemes"))
+	}
+	if at(doc, "paths", "/api/v1/recordings", "post", "responses", "401") == nil {
+		t.Errorf("401 not documented")
+	}
+	login := at(doc, "paths", "/api/v1/login", "post")
+	if s, ok := at(login, "security").([]interface{}); !ok || len(s) != 0 || at(login, "responses", "403") != nil {
+		t.Errorf("login %v", login)
+	}
+}
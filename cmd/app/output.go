@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// finalFileName returns the name of a finished recording's file: the stored
+// name, or for recordings made before names were stored, the MP4 derived
+// from its fields.
+func finalFileName(rec types.Recording) string {
+	if rec.FileName != "" {
+		return rec.FileName
+	}
+	return mp4Name(rec.GetFilePath())
+}
+
+// probeDuration asks ffprobe for the container duration of file in seconds.
+func probeDuration(commander Commander, file string) (float64, error) {
+	out, err := commander.Output("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		file)
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing ffprobe duration %q: %w", strings.TrimSpace(string(out)), err)
+	}
+	return secs, nil
+}
+
+// recordOutput stores the final file of a recording: its name on fs, its
+// size, its SHA-256 and, when ffprobe can read it, its measured duration.
+func (a *App) recordOutput(ctx context.Context, fs storage.Storage, id int, name string) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	var duration *float64
+	if local, err := fs.LocalPath(name); err == nil {
+		if secs, err := probeDuration(a.commander, local); err == nil {
+			duration = &secs
+		} else {
+			slog.Error("Error measuring duration of recording", "recording_id", id, "err", err)
+		}
+	}
+
+	if _, err := a.dbExecContext(ctx, "UPDATE recordings SET file_size = ? WHERE id = ?", info.Size(), id); err != nil {
+		return err
+	}
+	a.metrics.recorded(info.Size())
+	if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_files (recording_id, path, duration_seconds) VALUES (?, ?, ?)",
+		id, name, duration); err != nil {
+		return err
+	}
+	// Every step that replaces the file comes through here, so the checksum
+	// always describes the current one.
+	sum, err := fileSHA256(fs, name)
+	if err != nil {
+		slog.Error("Error computing checksum of recording", "recording_id", id, "err", err)
+		return nil
+	}
+	return a.storeChecksum(ctx, id, "", sum)
+}
+
+// storeLegacyFileNames stores the names of finished recordings made before
+// names were stored, since downloads are only served from recording_files.
+// A name is taken only when its file exists and it has no directory: the
+// old names were "{date}-{time}-{title}", so a slash came from the title.
+func (a *App) storeLegacyFileNames(ctx context.Context) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.title, COALESCE(rs.root, '')
+		FROM recordings r
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		LEFT JOIN recording_storage rs ON rs.recording_id = r.id
+		WHERE f.recording_id IS NULL AND r.status IN ('completed', ?, ?)`, statusPartial, statusArchived)
+	if err != nil {
+		slog.Error("Error loading recordings without a stored file name", "err", err)
+		return
+	}
+	type legacy struct {
+		rec  types.Recording
+		root string
+	}
+	var recs []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.rec.ID, &l.rec.ChannelID, &l.rec.Date, &l.rec.StartTime, &l.rec.Title, &l.root); err != nil {
+			slog.Error("Error scanning recording", "err", err)
+			continue
+		}
+		recs = append(recs, l)
+	}
+	rows.Close() //nolint: errcheck
+
+	for _, l := range recs {
+		name := finalFileName(l.rec)
+		if strings.Contains(name, "/") || !storage.ValidName(name) {
+			slog.Warn("Not storing unsafe legacy file name", "recording_id", l.rec.ID, "name", name)
+			continue
+		}
+		if _, err := a.rootStorage(l.root).Stat(name); err != nil {
+			continue
+		}
+		if _, err := a.dbExecContext(ctx, "INSERT OR IGNORE INTO recording_files (recording_id, path) VALUES (?, ?)", l.rec.ID, name); err != nil {
+			slog.Error("Error storing legacy file name", "recording_id", l.rec.ID, "err", err)
+		}
+	}
+}
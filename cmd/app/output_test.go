@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestRecordOutput(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	fs := storage.NewLocal(dir)
+	app.storage = fs
+	const name = "News - 2026-03-01 20-00 - KPIX.mp4"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	var probed string
+	app.commander.(*MockCommander).OutputFunc = func(name string, args ...string) ([]byte, error) {
+		probed = args[len(args)-1]
+		return []byte("3598.25\n"), nil
+	}
+
+	if err := app.recordOutput(context.Background(), fs, 1, name); err != nil {
+		t.Fatal(err)
+	}
+	if probed != filepath.Join(dir, name) {
+		t.Errorf("ffprobe ran on %q", probed)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings", app.getRecordings).Methods("GET")
+	r.HandleFunc("/api/recordings/{id}/file", app.getRecordingFile).Methods("GET")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings", nil))
+	var recs []GetRecordingsRec
+	if err := json.NewDecoder(rr.Body).Decode(&recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].FilePath == nil || *recs[0].FilePath != name ||
+		recs[0].ActualDuration == nil || *recs[0].ActualDuration != 3598.25 || recs[0].FileSize != 5 {
+		t.Fatalf("unexpected recordings response %+v", recs)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/file", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "video" {
+		t.Errorf("got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStoreLegacyFileNames(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES
+		(1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News'),
+		(2, '5.1', '2026-03-01', '21:00', 60, 'completed', '../../etc/passwd'),
+		(3, '5.1', '2026-03-01', '22:00', 60, 'completed', 'Gone')`); err != nil {
+		t.Fatal(err)
+	}
+	mem.WriteFile("2026-03-01-20:00-News.mp4", []byte("video"))
+	mem.WriteFile("2026-03-01-21:00-../../etc/passwd.mp4", []byte("video"))
+
+	app.storeLegacyFileNames(context.Background())
+	rows, err := db.Query("SELECT recording_id, path FROM recording_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close() //nolint: errcheck
+	stored := map[int]string{}
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			t.Fatal(err)
+		}
+		stored[id] = path
+	}
+	if len(stored) != 1 || stored[1] != "2026-03-01-20:00-News.mp4" {
+		t.Errorf("stored %v", stored)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc(fileRoute, app.getRecordingFile).Methods("GET")
+	for id, want := range map[string]int{"1": http.StatusOK, "2": http.StatusNotFound, "3": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/recordings/"+id+"/file", nil))
+		if rr.Code != want {
+			t.Errorf("recording %s: got %d, want %d", id, rr.Code, want)
+		}
+	}
+
+	// A stored name leading out of the root is refused too.
+	if _, err := db.Exec("INSERT INTO recording_files (recording_id, path) VALUES (3, '../Gone.mp4')"); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/recordings/3/file", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("name outside the root: %d", rr.Code)
+	}
+}
+
+func TestProbeDurationError(t *testing.T) {
+	mc := &MockCommander{OutputFunc: func(name string, args ...string) ([]byte, error) {
+		return []byte("N/A\n"), nil
+	}}
+	if _, err := probeDuration(mc, "/tmp/x.mp4"); err == nil {
+		t.Error("expected an error for unparseable ffprobe output")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// pinHeader carries the parental control PIN. Players that cannot send
+// headers may use the pin query parameter instead.
+const pinHeader = "X-DVR-PIN"
+
+// parentalUnlocked reports whether r may see restricted channels and
+// recordings: it comes from a signed-in admin or carries the PIN. With
+// auth disabled everyone counts as an admin elsewhere, but here only the
+// PIN unlocks, or the restrictions would never apply.
+func (a *App) parentalUnlocked(r *http.Request, p *pkgcfg.Parental) bool {
+	if a.cfg().Auth.Enabled && a.requestRole(r) == roleAdmin {
+		return true
+	}
+	pin := r.Header.Get(pinHeader)
+	if pin == "" {
+		pin = r.URL.Query().Get("pin")
+	}
+	return p.PIN != "" && subtle.ConstantTimeCompare([]byte(pin), []byte(p.PIN)) == 1
+}
+
+// channelRestricted reports whether the channel guideNumber is restricted.
+func channelRestricted(p *pkgcfg.Parental, guideNumber string) bool {
+	return p != nil && slices.Contains(p.RestrictedChannels, guideNumber)
+}
+
+// recordingRestricted reports whether a recording of the channel
+// guideNumber, in the guide category category, is restricted.
+func recordingRestricted(p *pkgcfg.Parental, guideNumber, category string) bool {
+	if p == nil {
+		return false
+	}
+	if channelRestricted(p, guideNumber) {
+		return true
+	}
+	return category != "" && slices.ContainsFunc(p.RestrictedCategories, func(c string) bool {
+		return strings.EqualFold(c, category)
+	})
+}
+
+// recordingCategory returns the guide category saved with a recording, or
+// "" when none was.
+func (a *App) recordingCategory(ctx context.Context, id int) string {
+	var category string
+	a.dbQueryRowContext(ctx, "SELECT COALESCE(category, '') FROM recording_metadata WHERE recording_id = ?", id).Scan(&category) //nolint: errcheck
+	return category
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestParentalControls(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1), ('9.1', 'Late', 'http://tuner/auto/v9.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News'), (2, '9.1', '2026-03-01', '23:00', 60, 'completed', 'Late Show'), (3, '5.1', '2026-03-02', '21:00', 120, 'completed', 'Thriller')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'news.mp4'), (2, 'late.mp4'), (3, 'thriller.mp4')",
+		"INSERT INTO recording_metadata (recording_id, title, category) VALUES (3, 'Thriller', 'Movie')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"news.mp4", "late.mp4", "thriller.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.config.Parental = &pkgcfg.Parental{RestrictedChannels: []string{"9.1"}, RestrictedCategories: []string{"movie"}, PIN: "4321"}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/channels", app.getChannels).Methods("GET")
+	r.HandleFunc(fileRoute, app.getRecordingFile).Methods("GET")
+	call := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	channels := func(header ...string) int {
+		var list []map[string]string
+		json.NewDecoder(call("/api/v1/channels", header...).Body).Decode(&list) //nolint: errcheck
+		return len(list)
+	}
+
+	if n := channels(); n != 1 {
+		t.Errorf("%d channels listed without the PIN", n)
+	}
+	if n := channels(pinHeader, "4321"); n != 2 {
+		t.Errorf("%d channels listed with the PIN", n)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		header []string
+		want   int
+	}{
+		{"/api/v1/recordings/1/file", nil, http.StatusOK},
+		{"/api/v1/recordings/2/file", nil, http.StatusForbidden},
+		{"/api/v1/recordings/3/file", nil, http.StatusForbidden},
+		{"/api/v1/recordings/3/file", []string{pinHeader, "0000"}, http.StatusForbidden},
+		{"/api/v1/recordings/3/file", []string{pinHeader, "4321"}, http.StatusOK},
+		{"/api/v1/recordings/2/file?pin=4321", nil, http.StatusOK},
+	} {
+		if rr := call(tc.path, tc.header...); rr.Code != tc.want {
+			t.Errorf("GET %s %v: got %d, want %d", tc.path, tc.header, rr.Code, tc.want)
+		}
+	}
+
+	// Signed-in admins need no PIN; viewers do.
+	app.config.Auth.Enabled = true
+	req := httptest.NewRequest("GET", "/api/v1/recordings/2/file", nil)
+	for role, want := range map[string]bool{roleAdmin: true, roleViewer: false} {
+		ctx := context.WithValue(req.Context(), roleCtxKey{}, role)
+		if got := app.parentalUnlocked(req.WithContext(ctx), app.config.Parental); got != want {
+			t.Errorf("%s: unlocked %v", role, got)
+		}
+	}
+}
+
+func TestParentalPINRedacted(t *testing.T) {
+	if got := redact(map[string]interface{}{"pin": "4321", "restrictedChannels": []interface{}{"9.1"}}); got.(map[string]interface{})["pin"] != "[redacted]" {
+		t.Errorf("pin not redacted: %v", got)
+	}
+}
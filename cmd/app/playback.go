@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const (
+	// repairReportThreshold is the number of playback problem reports on a
+	// recording that queues a repair pass.
+	repairReportThreshold = 3
+	// reportBucketSeconds groups nearby report offsets into hotspots.
+	reportBucketSeconds = 30
+)
+
+var playbackProblemKinds = map[string]bool{
+	"stutter":       true,
+	"missing_audio": true,
+	"artifacts":     true,
+	"av_desync":     true,
+	"other":         true,
+}
+
+type PlaybackReport struct {
+	ID            int     `json:"id"`
+	RecordingID   int     `json:"recordingId"`
+	OffsetSeconds float64 `json:"offsetSeconds"`
+	Kind          string  `json:"kind"`
+	Note          string  `json:"note,omitempty"`
+	Client        string  `json:"client,omitempty"`
+	// CapturedAt is the wall-clock time the problem segment was recorded, for
+	// lining reports up with tuner and capture logs.
+	CapturedAt string `json:"capturedAt,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+type PlaybackHotspot struct {
+	OffsetSeconds int `json:"offsetSeconds"`
+	Count         int `json:"count"`
+}
+
+type PlaybackReportSummary struct {
+	RecordingID  int               `json:"recordingId"`
+	Total        int               `json:"total"`
+	ByKind       map[string]int    `json:"byKind"`
+	Hotspots     []PlaybackHotspot `json:"hotspots"`
+	RepairStatus string            `json:"repairStatus,omitempty"`
+	Reports      []PlaybackReport  `json:"reports"`
+}
+
+// PlaybackReportRequest is the body of POST /api/recordings/{id}/reports.
+type PlaybackReportRequest struct {
+	OffsetSeconds *float64 `json:"offsetSeconds"`
+	Kind          string   `json:"kind"`
+	Note          string   `json:"note"`
+	Client        string   `json:"client"`
+}
+
+func (a *App) createPlaybackReport(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+
+	var req PlaybackReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.OffsetSeconds == nil || *req.OffsetSeconds < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "offsetSeconds must be zero or positive"}) //nolint: errcheck
+		return
+	}
+	if !playbackProblemKinds[req.Kind] {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("unknown kind %q", req.Kind)}) //nolint: errcheck
+		return
+	}
+
+	ctx := r.Context()
+	var status string
+	err = a.dbQueryRowContext(ctx, "SELECT status FROM recordings WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if status != "completed" {
+		http.Error(w, "Recording not completed", http.StatusConflict)
+		return
+	}
+
+	_, err = a.dbExecContext(ctx, `
+        INSERT INTO playback_reports (recording_id, offset_seconds, kind, note, client)
+        VALUES (?, ?, ?, ?, ?)`, id, *req.OffsetSeconds, req.Kind, req.Note, req.Client)
+	if err != nil {
+		requestLogger(r).Error("Error storing playback report", "err", err)
+		http.Error(w, "Failed to store report", http.StatusInternalServerError)
+		return
+	}
+
+	summary, err := a.playbackReportSummary(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if summary.Total >= repairReportThreshold && summary.RepairStatus == "" {
+		queued, err := a.queueRepair(ctx, id)
+		if err != nil {
+			requestLogger(r).Error("Error queueing repair for recording", "recording_id", id, "err", err)
+		} else if queued {
+			summary.RepairStatus = "queued"
+			go a.repairRecording(id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(summary) //nolint: errcheck
+}
+
+func (a *App) getPlaybackReports(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+
+	summary, err := a.playbackReportSummary(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		requestLogger(r).Error("Error encoding playback reports", "err", err)
+	}
+}
+
+// playbackReportSummary aggregates all reports for a recording. It returns
+// sql.ErrNoRows if the recording does not exist.
+func (a *App) playbackReportSummary(ctx context.Context, id int) (*PlaybackReportSummary, error) {
+	var rec types.Recording
+	err := a.dbQueryRowContext(ctx, "SELECT id, date, start_time FROM recordings WHERE id = ?", id).Scan(&rec.ID, &rec.Date, &rec.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	loc, _ := a.getLocalLocation()
+	captureStart, startErr := time.ParseInLocation("2006-01-02 15:04", rec.Date+" "+rec.StartTime, loc)
+	before, _ := a.padding()
+	captureStart = captureStart.Add(-time.Duration(before) * time.Second)
+
+	summary := &PlaybackReportSummary{
+		RecordingID: id,
+		ByKind:      make(map[string]int),
+		Hotspots:    []PlaybackHotspot{},
+		Reports:     []PlaybackReport{},
+	}
+
+	rows, err := a.dbQueryContext(ctx, `
+        SELECT id, offset_seconds, kind, note, client, created_at
+        FROM playback_reports
+        WHERE recording_id = ?
+        ORDER BY offset_seconds, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	buckets := make(map[int]int)
+	for rows.Next() {
+		rep := PlaybackReport{RecordingID: id}
+		var created time.Time
+		if err := rows.Scan(&rep.ID, &rep.OffsetSeconds, &rep.Kind, &rep.Note, &rep.Client, &created); err != nil {
+			return nil, err
+		}
+		rep.CreatedAt = created.Format(time.RFC3339)
+		if startErr == nil {
+			rep.CapturedAt = captureStart.Add(time.Duration(rep.OffsetSeconds * float64(time.Second))).Format(time.RFC3339)
+		}
+		summary.Reports = append(summary.Reports, rep)
+		summary.ByKind[rep.Kind]++
+		buckets[int(rep.OffsetSeconds)/reportBucketSeconds*reportBucketSeconds]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	summary.Total = len(summary.Reports)
+
+	for offset, count := range buckets {
+		summary.Hotspots = append(summary.Hotspots, PlaybackHotspot{OffsetSeconds: offset, Count: count})
+	}
+	sort.Slice(summary.Hotspots, func(i, j int) bool {
+		if summary.Hotspots[i].Count == summary.Hotspots[j].Count {
+			return summary.Hotspots[i].OffsetSeconds < summary.Hotspots[j].OffsetSeconds
+		}
+		return summary.Hotspots[i].Count > summary.Hotspots[j].Count
+	})
+
+	err = a.dbQueryRowContext(ctx, "SELECT status FROM recording_repairs WHERE recording_id = ?", id).Scan(&summary.RepairStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// queueRepair records that a repair is due, returning false if one was
+// already queued so each recording is repaired at most once.
+func (a *App) queueRepair(ctx context.Context, id int) (bool, error) {
+	result, err := a.dbExecContext(ctx, "INSERT OR IGNORE INTO recording_repairs (recording_id, status) VALUES (?, 'queued')", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// repairRecording re-muxes a completed recording with ffmpeg's error-tolerant
+// flags, regenerating timestamps and dropping corrupt packets, which fixes
+// most stutter and A/V sync problems caused by reception glitches.
+func (a *App) repairRecording(id int) {
+	setStatus := func(status string) {
+		_, err := a.dbExecContext(context.Background(), "UPDATE recording_repairs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE recording_id = ?", status, id)
+		if err != nil {
+			slog.Error("Error updating repair status for recording", "recording_id", id, "err", err)
+		}
+	}
+
+	var rec types.Recording
+	err := a.dbQueryRowContext(context.Background(), `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.title, COALESCE(f.path, '')
+		FROM recordings r
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		WHERE r.id = ?`, id).Scan(
+		&rec.ID, &rec.ChannelID, &rec.Date, &rec.StartTime, &rec.Title, &rec.FileName)
+	if err != nil {
+		slog.Error("Error loading recording for repair", "recording_id", id, "err", err)
+		setStatus("failed")
+		return
+	}
+
+	fs := a.recordingStorage(context.Background(), id)
+	name := mp4Name(rec.GetFilePath())
+	tmpName := strings.TrimSuffix(name, ".mp4") + ".repair.mp4"
+
+	input, err := fs.LocalPath(name)
+	if err != nil {
+		slog.Error("Error preparing repair of recording", "recording_id", id, "err", err)
+		setStatus("failed")
+		return
+	}
+	output, err := fs.LocalPath(tmpName)
+	if err != nil {
+		slog.Error("Error preparing repair of recording", "recording_id", id, "err", err)
+		setStatus("failed")
+		return
+	}
+
+	setStatus("running")
+	slog.Info("Repairing recording after playback reports", "recording_id", id, "name", name)
+	args := []string{
+		"-err_detect", "ignore_err",
+		"-fflags", "+genpts+discardcorrupt",
+		"-i", input,
+		"-map", "0",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-y",
+		output,
+	}
+	if err := a.commander.RunCommand("ffmpeg", args...); err != nil {
+		slog.Error("Repair of recording failed", "recording_id", id, "err", err)
+		_ = fs.Remove(tmpName)
+		setStatus("failed")
+		return
+	}
+	if err := fs.Rename(tmpName, name); err != nil {
+		slog.Error("Error replacing recording with repaired file", "recording_id", id, "err", err)
+		setStatus("failed")
+		return
+	}
+	if info, err := fs.Stat(name); err == nil {
+		if _, err := a.dbExecContext(context.Background(), "UPDATE recordings SET file_size = ? WHERE id = ?", info.Size(), id); err != nil {
+			slog.Error("Error updating recording file size", "err", err)
+		}
+	}
+	setStatus("completed")
+	slog.Info("Repaired recording", "recording_id", id)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestPlaybackReports(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	_, err := db.Exec(`
+		INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES
+			(1, '101', '2026-07-14', '12:00', 60, 'completed', 'Show'),
+			(2, '101', '2026-07-14', '14:00', 60, 'pending', 'Later')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/reports", app.getPlaybackReports).Methods("GET")
+	r.HandleFunc("/api/recordings/{id}/reports", app.createPlaybackReport).Methods("POST")
+
+	post := func(id string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/api/recordings/"+id+"/reports", bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("1", map[string]interface{}{"offsetSeconds": 10, "kind": "bogus"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown kind: got code %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := post("1", map[string]interface{}{"kind": "stutter"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("missing offset: got code %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := post("2", map[string]interface{}{"offsetSeconds": 10, "kind": "stutter"}); rr.Code != http.StatusConflict {
+		t.Errorf("pending recording: got code %d, want %d", rr.Code, http.StatusConflict)
+	}
+	if rr := post("99", map[string]interface{}{"offsetSeconds": 10, "kind": "stutter"}); rr.Code != http.StatusNotFound {
+		t.Errorf("missing recording: got code %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	// Stop the repair job from running in the background; it is covered below.
+	if _, err := db.Exec("INSERT INTO recording_repairs (recording_id, status) VALUES (1, 'completed')"); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []map[string]interface{}{
+		{"offsetSeconds": 65, "kind": "stutter"},
+		{"offsetSeconds": 80.5, "kind": "stutter", "client": "kodi"},
+		{"offsetSeconds": 1200, "kind": "missing_audio"},
+	} {
+		if rr := post("1", body); rr.Code != http.StatusCreated {
+			t.Fatalf("got code %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/recordings/1/reports", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var summary PlaybackReportSummary
+	if err := json.NewDecoder(rr.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 3 || summary.ByKind["stutter"] != 2 || summary.ByKind["missing_audio"] != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if len(summary.Hotspots) != 2 || summary.Hotspots[0].OffsetSeconds != 60 || summary.Hotspots[0].Count != 2 {
+		t.Errorf("unexpected hotspots: %+v", summary.Hotspots)
+	}
+	// Capture starts 30s before the scheduled 12:00 start.
+	if summary.Reports[0].CapturedAt != "2026-07-14T12:00:35Z" {
+		t.Errorf("unexpected capture time %q", summary.Reports[0].CapturedAt)
+	}
+}
+
+func TestQueueRepairOnce(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	for i, want := range []bool{true, false} {
+		queued, err := app.queueRepair(context.Background(), 1)
+		if err != nil || queued != want {
+			t.Errorf("call %d: got %v (err: %v), want %v", i, queued, err, want)
+		}
+	}
+}
+
+func TestRepairRecording(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	if err := os.WriteFile(dir+"/2026-07-14-12:00-Show.mp4", []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var args []string
+	app.commander = &MockCommander{
+		RunCommandFunc: func(name string, a ...string) error {
+			args = a
+			return os.WriteFile(a[len(a)-1], []byte("repaired!"), 0644)
+		},
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '101', '2026-07-14', '12:00', 60, 'completed', 'Show');
+		INSERT INTO recording_repairs (recording_id, status) VALUES (1, 'queued')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.repairRecording(1)
+
+	if len(args) == 0 || args[len(args)-1] != dir+"/2026-07-14-12:00-Show.repair.mp4" {
+		t.Fatalf("unexpected ffmpeg args %v", args)
+	}
+	data, err := os.ReadFile(dir + "/2026-07-14-12:00-Show.mp4")
+	if err != nil || string(data) != "repaired!" {
+		t.Errorf("expected repaired file, got %q (err: %v)", data, err)
+	}
+
+	var status string
+	var size int
+	if err := db.QueryRow("SELECT r.status, c.file_size FROM recording_repairs r JOIN recordings c ON c.id = r.recording_id").Scan(&status, &size); err != nil {
+		t.Fatal(err)
+	}
+	if status != "completed" || size != 9 {
+		t.Errorf("got status %q size %d, want completed 9", status, size)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// IPTV apps such as TiviMate or IPTVnator take a channel list as an M3U
+// playlist and the guide as XMLTV. Both are served alongside the emulated
+// tuner, whose streams the playlist points at; the playlist's tvg-id of a
+// channel is its id in the XMLTV guide, the guide number.
+
+// serveM3U serves GET /playlist.m3u.
+func (a *App) serveM3U(w http.ResponseWriter, r *http.Request) {
+	e := a.emulation(w, r)
+	if e == nil {
+		return
+	}
+	base := a.deviceBaseURL(r, e.BaseURL)
+	channels, err := a.lineupChannels(r, base)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logos := a.channelLogos()
+
+	// Attribute values are quoted, so quotes in names are dropped.
+	attr := strings.NewReplacer(`"`, "", "\n", " ").Replace
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U url-tvg=\"%s/xmltv.xml\"\n", base)
+	for _, ch := range channels {
+		fmt.Fprintf(&b, "#EXTINF:-1 tvg-id=\"%s\" tvg-chno=\"%s\" tvg-name=\"%s\"", attr(ch.GuideNumber), attr(ch.GuideNumber), attr(ch.GuideName))
+		if logo := logos[ch.GuideNumber]; logo != "" {
+			fmt.Fprintf(&b, " tvg-logo=\"%s\"", attr(logo))
+		}
+		fmt.Fprintf(&b, ",%s %s\n%s\n", ch.GuideNumber, strings.ReplaceAll(ch.GuideName, "\n", " "), ch.URL)
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl")
+	w.Write([]byte(b.String())) //nolint: errcheck
+}
+
+// channelLogos returns the guide's logo URL of each channel.
+func (a *App) channelLogos() map[string]string {
+	a.guideDataMutex.RLock()
+	defer a.guideDataMutex.RUnlock()
+	logos := make(map[string]string, len(a.guideData.Channels))
+	for _, ch := range a.guideData.Channels {
+		logos[ch.ChannelNumber] = ch.Logo
+	}
+	return logos
+}
+
+// xmltvTime is the time format of XMLTV.
+const xmltvTime = "20060102150405 -0700"
+
+// XMLTV is an XMLTV guide.
+type XMLTV struct {
+	XMLName    xml.Name         `xml:"tv"`
+	Generator  string           `xml:"generator-info-name,attr"`
+	Channels   []XMLTVChannel   `xml:"channel"`
+	Programmes []XMLTVProgramme `xml:"programme"`
+}
+
+// XMLTVChannel is a channel of an XMLTV guide.
+type XMLTVChannel struct {
+	ID           string     `xml:"id,attr"`
+	DisplayNames []string   `xml:"display-name"`
+	Icon         *XMLTVIcon `xml:"icon,omitempty"`
+}
+
+// XMLTVIcon is the logo of a channel or programme.
+type XMLTVIcon struct {
+	Src string `xml:"src,attr"`
+}
+
+// XMLTVEpisodeNum is an episode number in the given system.
+type XMLTVEpisodeNum struct {
+	System string `xml:"system,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// XMLTVProgramme is an airing of an XMLTV guide.
+type XMLTVProgramme struct {
+	Start       string            `xml:"start,attr"`
+	Stop        string            `xml:"stop,attr"`
+	Channel     string            `xml:"channel,attr"`
+	Title       string            `xml:"title"`
+	SubTitle    string            `xml:"sub-title,omitempty"`
+	Desc        string            `xml:"desc,omitempty"`
+	Date        string            `xml:"date,omitempty"`
+	Category    string            `xml:"category,omitempty"`
+	EpisodeNums []XMLTVEpisodeNum `xml:"episode-num"`
+	New         *struct{}         `xml:"new,omitempty"`
+}
+
+// serveXMLTV serves GET /xmltv.xml: the guide for the playlist's channels,
+// from the programs not yet over.
+func (a *App) serveXMLTV(w http.ResponseWriter, r *http.Request) {
+	e := a.emulation(w, r)
+	if e == nil {
+		return
+	}
+	channels, err := a.lineupChannels(r, a.deviceBaseURL(r, e.BaseURL))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logos := a.channelLogos()
+	tv := XMLTV{Generator: "hdhr-dvr", Channels: []XMLTVChannel{}, Programmes: []XMLTVProgramme{}}
+	listed := map[string]bool{}
+	for _, ch := range channels {
+		c := XMLTVChannel{ID: ch.GuideNumber, DisplayNames: []string{ch.GuideName, ch.GuideNumber}}
+		if logo := logos[ch.GuideNumber]; logo != "" {
+			c.Icon = &XMLTVIcon{Src: logo}
+		}
+		tv.Channels = append(tv.Channels, c)
+		listed[ch.GuideNumber] = true
+	}
+
+	a.guideDataMutex.RLock()
+	programs := make([]types.Program, len(a.guideData.Programs))
+	copy(programs, a.guideData.Programs)
+	a.guideDataMutex.RUnlock()
+	sort.SliceStable(programs, func(i, j int) bool {
+		if programs[i].Channel == programs[j].Channel {
+			return programs[i].Start < programs[j].Start
+		}
+		return programs[i].Channel < programs[j].Channel
+	})
+
+	now := time.Now()
+	for _, p := range programs {
+		if !listed[p.Channel] {
+			continue
+		}
+		start, err1 := time.Parse(time.RFC3339, p.Start)
+		end, err2 := time.Parse(time.RFC3339, p.End)
+		if err1 != nil || err2 != nil || end.Before(now) {
+			continue
+		}
+		prog := XMLTVProgramme{
+			Start:    start.Format(xmltvTime),
+			Stop:     end.Format(xmltvTime),
+			Channel:  p.Channel,
+			Title:    p.Title,
+			SubTitle: p.SubTitle,
+			Desc:     p.Description,
+			Category: p.Category,
+		}
+		if p.Year > 0 {
+			prog.Date = fmt.Sprint(p.Year)
+		}
+		// xmltv_ns numbers count from zero.
+		if p.Season > 0 && p.Episode > 0 {
+			prog.EpisodeNums = append(prog.EpisodeNums,
+				XMLTVEpisodeNum{"xmltv_ns", fmt.Sprintf("%d.%d.", p.Season-1, p.Episode-1)},
+				XMLTVEpisodeNum{"onscreen", fmt.Sprintf("S%02dE%02d", p.Season, p.Episode)})
+		}
+		if p.New {
+			prog.New = &struct{}{}
+		}
+		tv.Programmes = append(tv.Programmes, prog)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header)) //nolint: errcheck
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(tv); err != nil {
+		requestLogger(r).Error("Error encoding XMLTV guide", "err", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestPlaylistAndXMLTV(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	router := emulationRouter(app)
+	router.HandleFunc("/playlist.m3u", app.serveM3U).Methods("GET")
+	router.HandleFunc("/xmltv.xml", app.serveXMLTV).Methods("GET")
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX \"5\"', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('7.1', 'KGO', 'http://tuner/auto/v7.1', 1)",
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('9.1', 'KQED', 'http://tuner/auto/v9.1', 0)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Hour)
+	at := func(h int) string { return now.Add(time.Duration(h) * time.Hour).Format(time.RFC3339) }
+	app.guideData = types.Guide{
+		Channels: []types.LineupData{{ChannelNumber: "5.1", Logo: "http://logos/kpix.png"}},
+		Programs: []types.Program{
+			{Channel: "5.1", Title: "Nova", SubTitle: "Black Holes", Start: at(1), End: at(2), Season: 51, Episode: 3, New: true},
+			{Channel: "5.1", Title: "Over", Start: at(-3), End: at(-2)},
+			{Channel: "7.1", Title: "News", Start: at(0), End: at(1)},
+			{Channel: "9.1", Title: "Disabled", Start: at(0), End: at(1)},
+		},
+	}
+
+	get := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Host = "dvr.lan:8080"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := get("/playlist.m3u"); rr.Code != http.StatusNotFound {
+		t.Errorf("playlist with emulation off: %d", rr.Code)
+	}
+	app.config.Emulation = &pkgcfg.Emulation{DeviceID: "1234ABCD"}
+
+	m3u := get("/playlist.m3u").Body.String()
+	want := `#EXTM3U url-tvg="http://dvr.lan:8080/xmltv.xml"
+#EXTINF:-1 tvg-id="5.1" tvg-chno="5.1" tvg-name="KPIX 5" tvg-logo="http://logos/kpix.png",5.1 KPIX "5"
+http://dvr.lan:8080/auto/v5.1
+#EXTINF:-1 tvg-id="7.1" tvg-chno="7.1" tvg-name="KGO",7.1 KGO
+http://dvr.lan:8080/auto/v7.1
+`
+	if m3u != want {
+		t.Errorf("playlist\n%s\nwant\n%s", m3u, want)
+	}
+
+	var tv XMLTV
+	if err := xml.NewDecoder(get("/xmltv.xml").Body).Decode(&tv); err != nil {
+		t.Fatal(err)
+	}
+	if len(tv.Channels) != 2 || tv.Channels[0].ID != "5.1" || tv.Channels[0].Icon == nil || tv.Channels[1].Icon != nil {
+		t.Errorf("channels %+v", tv.Channels)
+	}
+	if len(tv.Programmes) != 2 {
+		t.Fatalf("programmes %+v", tv.Programmes)
+	}
+	nova := tv.Programmes[0]
+	if nova.Title != "Nova" || nova.Start != now.Add(time.Hour).Format(xmltvTime) || nova.New == nil ||
+		len(nova.EpisodeNums) != 2 || nova.EpisodeNums[0].Value != "50.2." {
+		t.Errorf("programme %+v", nova)
+	}
+
+	// Restricted channels leave both, so the guide matches the playlist.
+	app.config.Parental = &pkgcfg.Parental{RestrictedChannels: []string{"5.1"}}
+	if m3u := get("/playlist.m3u").Body.String(); strings.Contains(m3u, "5.1") {
+		t.Errorf("restricted channel in playlist:\n%s", m3u)
+	}
+	if body := get("/xmltv.xml").Body.String(); strings.Contains(body, "Nova") {
+		t.Errorf("restricted channel in guide:\n%s", body)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+const (
+	// posterOffset is how far into a recording the poster frame is taken,
+	// past the end of the previous program and the opening titles. Short
+	// recordings use a third of their length instead.
+	posterOffset = 180.0
+	// posterFilter drops frames that are mostly black, lets the thumbnail
+	// filter pick the most representative of the next 100 and scales it.
+	posterFilter = "blackframe=amount=0:threshold=32," +
+		"metadata=mode=select:key=lavfi.blackframe.pblack:value=90:function=less," +
+		"thumbnail=100,scale=480:-2"
+)
+
+// posterName returns the name of the poster frame kept next to the
+// recording file name.
+func posterName(name string) string {
+	return sidecarBase(name) + ".poster.jpg"
+}
+
+// posterSeek returns where to start looking for a poster frame in a
+// recording of duration seconds, or 0 if the duration is unknown.
+func posterSeek(duration float64) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	if duration/3 < posterOffset {
+		return duration / 3
+	}
+	return posterOffset
+}
+
+// generatePoster grabs a frame from the recording file name on fs and
+// stores it as its poster.
+func (a *App) generatePoster(fs storage.Storage, name string, duration float64) error {
+	in, err := fs.LocalPath(name)
+	if err != nil {
+		return err
+	}
+	out, err := fs.LocalPath(posterName(name))
+	if err != nil {
+		return err
+	}
+	output, err := a.commander.RunWithEnv(nil, "ffmpeg", "-v", "error", "-y",
+		"-ss", strconv.FormatFloat(posterSeek(duration), 'f', 0, 64),
+		"-i", in,
+		"-vf", posterFilter,
+		"-frames:v", "1",
+		out)
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	if _, err := fs.Stat(posterName(name)); err != nil {
+		return fmt.Errorf("ffmpeg wrote no poster: %w", err)
+	}
+	return nil
+}
+
+// createRecordingPoster generates the poster of a finished recording.
+func (a *App) createRecordingPoster(ctx context.Context, id int) error {
+	job, err := a.loadPostJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.generatePoster(job.fs, finalFileName(job.rec), job.duration)
+}
+
+// getRecordingPoster serves a recording's poster frame, generating it for
+// recordings that finished before posters were made.
+func (a *App) getRecordingPoster(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	job, err := a.loadPostJob(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := posterName(finalFileName(job.rec))
+	file, err := job.fs.Open(name)
+	if os.IsNotExist(err) && (job.rec.Status == "completed" || job.rec.Status == statusPartial) {
+		if err := a.generatePoster(job.fs, finalFileName(job.rec), job.duration); err != nil {
+			requestLogger(r).Error("Error generating poster of recording", "recording_id", id, "err", err)
+			http.Error(w, "No poster for recording", http.StatusNotFound)
+			return
+		}
+		file, err = job.fs.Open(name)
+	}
+	if os.IsNotExist(err) {
+		http.Error(w, "No poster for recording", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close() //nolint: errcheck
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestPosterSeek(t *testing.T) {
+	for _, tt := range []struct{ duration, want float64 }{{0, 0}, {60, 20}, {3600, 180}} {
+		if got := posterSeek(tt.duration); got != tt.want {
+			t.Errorf("posterSeek(%v) = %v, want %v", tt.duration, got, tt.want)
+		}
+	}
+}
+
+func TestGetRecordingPoster(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	for _, q := range []string{
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '5.1', '2026-03-02', '20:00', 60, 'scheduled', 'News')",
+		"INSERT INTO recording_files (recording_id, path, duration_seconds) VALUES (1, 'News.mp4', 3600)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var runs [][]string
+	app.commander.(*MockCommander).RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+		runs = append(runs, args)
+		return nil, os.WriteFile(args[len(args)-1], []byte("jpeg"), 0644)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/poster", app.getRecordingPoster).Methods("GET")
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/poster", nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != "jpeg" || rr.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("got %d %q %q", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+		}
+	}
+	if len(runs) != 1 {
+		t.Fatalf("ffmpeg ran %d times, want the poster generated once", len(runs))
+	}
+	args := runs[0]
+	if args[3] != "-ss" || args[4] != "180" || args[6] != filepath.Join(dir, "News.mp4") || args[len(args)-1] != filepath.Join(dir, "News.poster.jpg") {
+		t.Errorf("ffmpeg args %q", args)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/2/poster", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unfinished recording: got %d", rr.Code)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const (
+	driverSQLite   = "sqlite3"
+	driverPostgres = "postgres"
+)
+
+// postgresNow stands in for CURRENT_TIMESTAMP: the UTC text SQLite
+// writes, which is what DATETIME columns hold and what the code parses.
+const postgresNow = `(to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'))`
+
+var (
+	createTableRE = regexp.MustCompile(`(?i)CREATE TABLE IF NOT EXISTS (\w+)\s*\(`)
+	insertRE      = regexp.MustCompile(`(?is)^\s*INSERT\s+(?:OR\s+(REPLACE|IGNORE)\s+)?INTO\s+(\w+)\s*(?:\(([^)]*)\))?`)
+	postgresTypes = strings.NewReplacer(
+		" INTEGER PRIMARY KEY AUTOINCREMENT", " BIGSERIAL PRIMARY KEY",
+		" INTEGER", " BIGINT",
+		" BOOLEAN", " BIGINT",
+		" REAL", " DOUBLE PRECISION",
+		" DATETIME", " TEXT",
+	)
+)
+
+// postgresStore runs the SQLite dialect the app is written in against
+// PostgreSQL. Each statement is rewritten on its way through: placeholders
+// are numbered, INSERT OR REPLACE and INSERT OR IGNORE become ON CONFLICT
+// clauses, and inserts into tables with an AUTOINCREMENT id return it, as
+// lib/pq has no LastInsertId. Booleans are stored as integers, as they are
+// in SQLite, so queries comparing them with 1 keep working.
+type postgresStore struct {
+	db     *sql.DB
+	schema *postgresSchema
+}
+
+func newPostgresStore(db *sql.DB) *postgresStore {
+	return &postgresStore{db: db, schema: &postgresSchema{keys: map[string][]string{}, serial: map[string]string{}}}
+}
+
+// postgresSchema holds what the rewriting needs to know about each table,
+// learnt from the CREATE TABLE statements run through the store: its
+// primary key, the conflict target of INSERT OR REPLACE, and its
+// AUTOINCREMENT column, if any.
+type postgresSchema struct {
+	mu     sync.RWMutex
+	keys   map[string][]string
+	serial map[string]string
+}
+
+// postgresConn is what *sql.DB and *sql.Tx have in common.
+type postgresConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// learn records the tables created by the statements in ddl.
+func (s *postgresSchema) learn(ddl string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, loc := range createTableRE.FindAllStringSubmatchIndex(ddl, -1) {
+		table := ddl[loc[2]:loc[3]]
+		body, depth := ddl[loc[1]:], 1
+		for i, c := range body {
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth--; depth == 0 {
+					body = body[:i]
+					break
+				}
+			}
+		}
+		for _, def := range splitTopLevel(body) {
+			fields := strings.Fields(def)
+			upper := strings.ToUpper(def)
+			switch {
+			case len(fields) == 0:
+			case strings.HasPrefix(upper, "PRIMARY KEY"):
+				cols := def[strings.Index(def, "(")+1 : strings.LastIndex(def, ")")]
+				s.keys[table] = splitTopLevel(cols)
+			case strings.Contains(upper, "PRIMARY KEY"):
+				s.keys[table] = []string{fields[0]}
+				if strings.Contains(upper, "AUTOINCREMENT") {
+					s.serial[table] = fields[0]
+				}
+			}
+		}
+	}
+}
+
+// splitTopLevel splits s at the commas outside parentheses and trims each
+// part.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// rebindPostgres numbers the ? placeholders of query, leaving question
+// marks in string literals alone.
+func rebindPostgres(query string) string {
+	var b strings.Builder
+	n, quoted := 0, false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// rewrite translates query to PostgreSQL. returning names the column an
+// INSERT should return for LastInsertId.
+func (s *postgresSchema) rewrite(query string) (q, returning string, err error) {
+	if createTableRE.MatchString(query) {
+		s.learn(query)
+		query = postgresTypes.Replace(query)
+	}
+	query = strings.ReplaceAll(rebindPostgres(query), "CURRENT_TIMESTAMP", postgresNow)
+
+	m := insertRE.FindStringSubmatchIndex(query)
+	if m == nil {
+		return query, "", nil
+	}
+	table := query[m[4]:m[5]]
+	s.mu.RLock()
+	keys, returning := s.keys[table], s.serial[table]
+	s.mu.RUnlock()
+
+	q = strings.TrimRight(query, "; \t\n")
+	if m[2] >= 0 {
+		// Drop "OR REPLACE" or "OR IGNORE".
+		q = q[:m[0]] + "INSERT INTO " + q[m[4]:]
+		switch strings.ToUpper(query[m[2]:m[3]]) {
+		case "IGNORE":
+			q += " ON CONFLICT DO NOTHING"
+		case "REPLACE":
+			if len(keys) == 0 || m[6] < 0 {
+				return "", "", fmt.Errorf("INSERT OR REPLACE INTO %s: no primary key or column list to replace by", table)
+			}
+			var set []string
+			for _, col := range splitTopLevel(query[m[6]:m[7]]) {
+				if !slices.Contains(keys, col) {
+					set = append(set, col+" = EXCLUDED."+col)
+				}
+			}
+			q += " ON CONFLICT (" + strings.Join(keys, ", ") + ")"
+			if len(set) == 0 {
+				q += " DO NOTHING"
+			} else {
+				q += " DO UPDATE SET " + strings.Join(set, ", ")
+			}
+		}
+	}
+	return q, returning, nil
+}
+
+// postgresArgs stores booleans as 0 and 1, like SQLite.
+func postgresArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if b, ok := arg.(bool); ok {
+			arg = int64(0)
+			if b {
+				arg = int64(1)
+			}
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// postgresResult is the sql.Result of an INSERT that returned its id.
+type postgresResult struct {
+	id, rows int64
+}
+
+func (r postgresResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r postgresResult) RowsAffected() (int64, error) { return r.rows, nil }
+
+func (s *postgresSchema) exec(ctx context.Context, c postgresConn, query string, args []interface{}) (sql.Result, error) {
+	q, returning, err := s.rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	if returning == "" {
+		return c.ExecContext(ctx, q, postgresArgs(args)...)
+	}
+	var id int64
+	err = c.QueryRowContext(ctx, q+" RETURNING "+returning, postgresArgs(args)...).Scan(&id)
+	if err == sql.ErrNoRows {
+		// ON CONFLICT DO NOTHING skipped the row.
+		return postgresResult{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return postgresResult{id: id, rows: 1}, nil
+}
+
+func (s *postgresSchema) query(ctx context.Context, c postgresConn, query string, args []interface{}) (*sql.Rows, error) {
+	q, _, err := s.rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	return c.QueryContext(ctx, q, postgresArgs(args)...)
+}
+
+func (s *postgresSchema) queryRow(ctx context.Context, c postgresConn, query string, args []interface{}) *sql.Row {
+	// A statement that cannot be rewritten is sent as it is, for the
+	// server to report the error through the row.
+	q, _, err := s.rewrite(query)
+	if err != nil {
+		q = query
+	}
+	return c.QueryRowContext(ctx, q, postgresArgs(args)...)
+}
+
+func (p *postgresStore) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.schema.exec(ctx, p.db, query, args)
+}
+
+func (p *postgresStore) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.schema.query(ctx, p.db, query, args)
+}
+
+func (p *postgresStore) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.schema.queryRow(ctx, p.db, query, args)
+}
+
+// PrepareContext prepares the rewritten query. Arguments to the statement
+// are passed to lib/pq as they are, so booleans must be given as 0 or 1.
+func (p *postgresStore) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	q, _, err := p.schema.rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	return p.db.PrepareContext(ctx, q)
+}
+
+func (p *postgresStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (types.Tx, error) {
+	tx, err := p.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresTx{tx: tx, schema: p.schema}, nil
+}
+
+type postgresTx struct {
+	tx     *sql.Tx
+	schema *postgresSchema
+}
+
+func (t *postgresTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.schema.exec(ctx, t.tx, query, args)
+}
+
+func (t *postgresTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.schema.query(ctx, t.tx, query, args)
+}
+
+func (t *postgresTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.schema.queryRow(ctx, t.tx, query, args)
+}
+
+func (t *postgresTx) Commit() error   { return t.tx.Commit() }
+func (t *postgresTx) Rollback() error { return t.tx.Rollback() }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestPostgresRewrite(t *testing.T) {
+	s := newPostgresStore(nil).schema
+	ddl := `
+        CREATE TABLE IF NOT EXISTS recordings (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            channel_id TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY(channel_id) REFERENCES channels(guide_number)
+         );
+        CREATE TABLE IF NOT EXISTS recording_checksums (
+            recording_id INTEGER NOT NULL,
+            location TEXT NOT NULL DEFAULT '',
+            sha256 TEXT NOT NULL,
+            verified_ok BOOLEAN,
+            offset_seconds REAL,
+            PRIMARY KEY (recording_id, location)
+         );`
+	q, _, err := s.rewrite(ddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"id BIGSERIAL PRIMARY KEY", "created_at TEXT DEFAULT " + postgresNow, "recording_id BIGINT NOT NULL", "verified_ok BIGINT", "offset_seconds DOUBLE PRECISION"} {
+		if !strings.Contains(q, want) {
+			t.Errorf("DDL lacks %q:\n%s", want, q)
+		}
+	}
+
+	for _, tc := range []struct {
+		query, want, returning string
+	}{
+		{"SELECT id FROM recordings WHERE channel_id = ? AND status = '?' AND id > ?",
+			"SELECT id FROM recordings WHERE channel_id = $1 AND status = '?' AND id > $2", ""},
+		{"INSERT INTO recordings (channel_id) VALUES (?)",
+			"INSERT INTO recordings (channel_id) VALUES ($1)", "id"},
+		{`
+        INSERT OR REPLACE INTO recording_checksums (recording_id, location, sha256, computed_at)
+        VALUES (?, ?, ?, CURRENT_TIMESTAMP)`,
+			`INSERT INTO recording_checksums (recording_id, location, sha256, computed_at)
+        VALUES ($1, $2, $3, ` + postgresNow + `) ON CONFLICT (recording_id, location) DO UPDATE SET sha256 = EXCLUDED.sha256, computed_at = EXCLUDED.computed_at`, ""},
+		{"INSERT OR IGNORE INTO recording_checksums (recording_id, location, sha256) VALUES (?, ?, ?);",
+			"INSERT INTO recording_checksums (recording_id, location, sha256) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", ""},
+	} {
+		q, returning, err := s.rewrite(tc.query)
+		if err != nil || q != tc.want || returning != tc.returning {
+			t.Errorf("rewrite(%q)\n = %q, %q, %v\nwant %q, %q", tc.query, q, returning, err, tc.want, tc.returning)
+		}
+	}
+	if _, _, err := s.rewrite("INSERT OR REPLACE INTO unknown (a) VALUES (?)"); err == nil {
+		t.Error("replaced into a table without a known key")
+	}
+
+	if args := postgresArgs([]interface{}{true, false, "x"}); args[0] != int64(1) || args[1] != int64(0) || args[2] != "x" {
+		t.Errorf("args %v", args)
+	}
+	if got := postgresTSQuery(searchMatchExpr("Star Trek")); got != "star:* & trek:*" {
+		t.Errorf("tsquery %q", got)
+	}
+}
+
+// TestPostgresStore runs against the PostgreSQL database named by
+// DVR_TEST_POSTGRES_DSN, which it fills with the schema; it is skipped
+// without one.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("DVR_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("DVR_TEST_POSTGRES_DSN not set")
+	}
+	cfg := &pkgcfg.Config{DBDriver: driverPostgres, DBDSN: dsn, Timezone: "UTC"}
+	db, store, err := openDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() //nolint: errcheck
+	app := NewApp(cfg, store, &MockCommander{})
+	app.createTables()
+	ctx := context.Background()
+
+	if _, err := store.ExecContext(ctx, "INSERT OR REPLACE INTO channels (guide_number, guide_name, url, enabled) VALUES (?, ?, ?, ?)", "5.1", "KPIX", "http://tuner/auto/v5.1", true); err != nil {
+		t.Fatal(err)
+	}
+	res, err := store.ExecContext(ctx, "INSERT INTO recordings (channel_id, date, start_time, duration, status, title) VALUES (?, ?, ?, ?, ?, ?)", "5.1", "2026-03-01", "20:00", 60, "completed", "News")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil || id == 0 {
+		t.Fatalf("LastInsertId %d, %v", id, err)
+	}
+	defer app.purgeRecording(ctx, int(id)) //nolint: errcheck
+	if err := app.storeChecksum(ctx, int(id), "", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.storeChecksum(ctx, int(id), "", "def"); err != nil {
+		t.Fatal(err)
+	}
+	var sum, computed string
+	var enabled bool
+	err = store.QueryRowContext(ctx, `
+		SELECT c.sha256, c.computed_at, ch.enabled FROM recording_checksums c
+		JOIN recordings r ON r.id = c.recording_id JOIN channels ch ON ch.guide_number = r.channel_id
+		WHERE c.recording_id = ?`, id).Scan(&sum, &computed, &enabled)
+	if err != nil || sum != "def" || len(computed) != len("2006-01-02 15:04:05") || !enabled {
+		t.Errorf("got %q %q %v, %v", sum, computed, enabled, err)
+	}
+	if err := store.QueryRowContext(ctx, "SELECT 1 FROM recordings WHERE id = ?", -1).Scan(new(int)); err != sql.ErrNoRows {
+		t.Errorf("missing row: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// Post-processing step statuses.
+const (
+	stepRunning   = "running"
+	stepSucceeded = "succeeded"
+	stepFailed    = "failed"
+	stepSkipped   = "skipped"
+)
+
+// maxStepOutput is how much of the end of a step's output is kept.
+const maxStepOutput = 4096
+
+// postJob is the finished recording a post-processing pipeline works on.
+// duration is the measured length in seconds, or 0 if unknown.
+type postJob struct {
+	rec      types.Recording
+	channel  types.Channel
+	fs       storage.Storage
+	duration float64
+}
+
+// postStep is one stage of the pipeline. run returns the output to keep
+// with the step.
+type postStep struct {
+	name string
+	run  func(ctx context.Context, job *postJob) ([]byte, error)
+}
+
+// PostProcessingStep is the stored outcome of one step for a recording.
+type PostProcessingStep struct {
+	Step       int    `json:"step"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Output     string `json:"output,omitempty"`
+	StartedAt  string `json:"startedAt,omitempty"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+}
+
+// hookEnv describes job to a user command.
+func hookEnv(job *postJob, file string) []string {
+	title := ""
+	if job.rec.Title != nil {
+		title = *job.rec.Title
+	}
+	return []string{
+		"DVR_RECORDING_ID=" + strconv.Itoa(job.rec.ID),
+		"DVR_FILE=" + file,
+		"DVR_TITLE=" + title,
+		"DVR_CHANNEL=" + job.rec.ChannelID,
+		"DVR_CHANNEL_NAME=" + job.channel.GuideName,
+		"DVR_DATE=" + job.rec.Date,
+		"DVR_START_TIME=" + job.rec.StartTime,
+		"DVR_STATUS=" + job.rec.Status,
+	}
+}
+
+// postProcessSteps returns the pipeline for finished recordings: the
+// built-in stages that are enabled, then the configured hooks in order.
+func (a *App) postProcessSteps() []postStep {
+	var steps []postStep
+	if a.cfg().Comskip.Enabled {
+		steps = append(steps, postStep{name: "comskip", run: a.runComskip})
+	}
+	if a.cfg().Sidecars.NFO || a.cfg().Sidecars.Artwork {
+		steps = append(steps, postStep{name: "sidecars", run: a.writeSidecars})
+	}
+	for i, hook := range a.cfg().PostProcess {
+		if len(hook.Command) == 0 {
+			continue
+		}
+		name := hook.Name
+		if name == "" {
+			name = fmt.Sprintf("hook %d", i+1)
+		}
+		command := hook.Command
+		steps = append(steps, postStep{name: name, run: func(ctx context.Context, job *postJob) ([]byte, error) {
+			file, err := job.fs.LocalPath(finalFileName(job.rec))
+			if err != nil {
+				return nil, err
+			}
+			return a.commander.RunWithEnv(hookEnv(job, file), command[0], command[1:]...)
+		}})
+	}
+	return steps
+}
+
+// loadPostJob loads a recording with its final file, channel and storage.
+func (a *App) loadPostJob(ctx context.Context, id int) (*postJob, error) {
+	job := &postJob{}
+	err := a.dbQueryRowContext(ctx, `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.title, r.status, COALESCE(f.path, ''), COALESCE(f.duration_seconds, 0),
+			COALESCE(c.guide_name, '')
+		FROM recordings r
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		LEFT JOIN channels c ON c.guide_number = r.channel_id
+		WHERE r.id = ?`, id).Scan(
+		&job.rec.ID, &job.rec.ChannelID, &job.rec.Date, &job.rec.StartTime, &job.rec.Duration, &job.rec.Title,
+		&job.rec.Status, &job.rec.FileName, &job.duration, &job.channel.GuideName)
+	if err != nil {
+		return nil, err
+	}
+	job.channel.GuideNumber = job.rec.ChannelID
+	job.fs = a.recordingStorage(ctx, id)
+	return job, nil
+}
+
+// tailOutput keeps the last maxStepOutput bytes of out.
+func tailOutput(out []byte) string {
+	if len(out) > maxStepOutput {
+		out = out[len(out)-maxStepOutput:]
+	}
+	return string(out)
+}
+
+// runPostProcessing runs the pipeline on a finished recording, recording
+// each step in post_processing. A failed step skips the rest. It reports
+// whether every step succeeded.
+func (a *App) runPostProcessing(ctx context.Context, id int) bool {
+	steps := a.postProcessSteps()
+	if len(steps) == 0 {
+		return true
+	}
+	job, err := a.loadPostJob(ctx, id)
+	if err != nil {
+		slog.Error("Error loading recording for post-processing", "recording_id", id, "err", err)
+		return false
+	}
+	if _, err := a.dbExecContext(ctx, "DELETE FROM post_processing WHERE recording_id = ?", id); err != nil {
+		slog.Error("Error clearing post-processing of recording", "recording_id", id, "err", err)
+	}
+
+	ok := true
+	for i, step := range steps {
+		if !ok {
+			a.dbExecContext(ctx, "INSERT INTO post_processing (recording_id, step, name, status) VALUES (?, ?, ?, ?)", //nolint: errcheck
+				id, i+1, step.name, stepSkipped)
+			continue
+		}
+		if _, err := a.dbExecContext(ctx, "INSERT INTO post_processing (recording_id, step, name, status, started_at) VALUES (?, ?, ?, ?, ?)",
+			id, i+1, step.name, stepRunning, time.Now().UTC()); err != nil {
+			slog.Error("Error recording post-processing of recording", "recording_id", id, "err", err)
+		}
+		out, err := step.run(ctx, job)
+		status := stepSucceeded
+		if err != nil {
+			status = stepFailed
+			ok = false
+			slog.Error("Post-processing step failed for recording", "recording_id", id, "step", step.name, "err", err)
+			if len(out) == 0 {
+				out = []byte(err.Error())
+			}
+		}
+		if _, err := a.dbExecContext(ctx, "UPDATE post_processing SET status = ?, output = ?, finished_at = ? WHERE recording_id = ? AND step = ?",
+			status, tailOutput(out), time.Now().UTC(), id, i+1); err != nil {
+			slog.Error("Error recording post-processing of recording", "recording_id", id, "err", err)
+		}
+	}
+	return ok
+}
+
+// loadPostProcessing returns the steps run on a recording, or sql.ErrNoRows
+// if the recording does not exist.
+func (a *App) loadPostProcessing(ctx context.Context, id int) ([]PostProcessingStep, error) {
+	var exists bool
+	if err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recordings WHERE id = ?)", id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT step, name, status, COALESCE(output, ''), started_at, finished_at
+		FROM post_processing WHERE recording_id = ? ORDER BY step`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	steps := []PostProcessingStep{}
+	for rows.Next() {
+		var s PostProcessingStep
+		var started, finished sql.NullTime
+		if err := rows.Scan(&s.Step, &s.Name, &s.Status, &s.Output, &started, &finished); err != nil {
+			return nil, err
+		}
+		if started.Valid {
+			s.StartedAt = started.Time.Format(time.RFC3339)
+		}
+		if finished.Valid {
+			s.FinishedAt = finished.Time.Format(time.RFC3339)
+		}
+		steps = append(steps, s)
+	}
+	return steps, rows.Err()
+}
+
+func (a *App) getPostProcessing(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	steps, err := a.loadPostProcessing(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(steps) //nolint: errcheck
+}
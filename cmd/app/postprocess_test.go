@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestRunPostProcessing(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	const name = "News.mp4"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recording_files (recording_id, path) VALUES (1, ?)", name); err != nil {
+		t.Fatal(err)
+	}
+	app.config.PostProcess = []pkgcfg.PostProcessHook{
+		{Name: "notify", Command: []string{"/bin/notify", "--quiet"}},
+		{Command: []string{"/bin/fail"}},
+		{Name: "never", Command: []string{"/bin/never"}},
+	}
+
+	var ran []string
+	var env []string
+	app.commander.(*MockCommander).RunWithEnvFunc = func(e []string, cmd string, args ...string) ([]byte, error) {
+		ran = append(ran, cmd)
+		if cmd == "/bin/fail" {
+			return []byte("boom"), fmt.Errorf("exit status 1")
+		}
+		env = e
+		return []byte("ok"), nil
+	}
+
+	if app.runPostProcessing(context.Background(), 1) {
+		t.Error("expected the pipeline to report a failure")
+	}
+	if strings.Join(ran, " ") != "/bin/notify /bin/fail" {
+		t.Errorf("ran %v", ran)
+	}
+	for _, want := range []string{"DVR_FILE=" + filepath.Join(dir, name), "DVR_TITLE=News", "DVR_CHANNEL=5.1", "DVR_CHANNEL_NAME=KPIX", "DVR_STATUS=completed"} {
+		if !strings.Contains(strings.Join(env, "\n"), want) {
+			t.Errorf("environment %v lacks %s", env, want)
+		}
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/post-processing", app.getPostProcessing).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/post-processing", nil))
+	var steps []PostProcessingStep
+	if err := json.NewDecoder(rr.Body).Decode(&steps); err != nil {
+		t.Fatal(err)
+	}
+	want := []PostProcessingStep{
+		{Step: 1, Name: "notify", Status: stepSucceeded, Output: "ok"},
+		{Step: 2, Name: "hook 2", Status: stepFailed, Output: "boom"},
+		{Step: 3, Name: "never", Status: stepSkipped},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("got %+v", steps)
+	}
+	for i, s := range steps {
+		if s.Step != want[i].Step || s.Name != want[i].Name || s.Status != want[i].Status || s.Output != want[i].Output {
+			t.Errorf("step %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+	if steps[0].FinishedAt == "" || steps[2].StartedAt != "" {
+		t.Errorf("unexpected times %+v", steps)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/9/post-processing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown recording: got %d", rr.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const (
+	// statusInsufficientSpace marks recordings that were not started because
+	// the estimated file would not fit in storage.
+	statusInsufficientSpace = "insufficient_space"
+
+	// preflightMargin is applied to the size estimate, since bitrates vary
+	// between programs on the same channel.
+	preflightMargin = 1.2
+)
+
+// estimateRecordingBytes projects the size of minutes of recording on the
+// channel from the channel's past recordings, or from all recordings when
+// the channel has none.
+func (a *App) estimateRecordingBytes(ctx context.Context, channelID string, minutes int) (int64, error) {
+	rates, overall, err := a.bytesPerMinute(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rate, ok := rates[channelID]
+	if !ok {
+		rate = overall
+	}
+	return int64(rate * float64(minutes) * preflightMargin), nil
+}
+
+// checkFreeSpace returns an error when fs has less free space than a
+// recording of minutes on r's channel is estimated to need. Backends that
+// cannot report free space always pass.
+func (a *App) checkFreeSpace(ctx context.Context, fs storage.Storage, r types.Recording, minutes int) error {
+	sr, ok := fs.(storage.SpaceReporter)
+	if !ok {
+		return nil
+	}
+	free, err := sr.FreeSpace()
+	if err != nil {
+		slog.Warn("Error checking free space before recording, starting anyway", "recording_id", r.ID, "err", err)
+		return nil
+	}
+	need, err := a.estimateRecordingBytes(ctx, r.ChannelID, minutes)
+	if err != nil {
+		slog.Warn("Error estimating size of recording, starting anyway", "recording_id", r.ID, "err", err)
+		return nil
+	}
+	if free < need {
+		return fmt.Errorf("insufficient disk space: recording %d needs about %d MB, %d MB free",
+			r.ID, need/(1024*1024), free/(1024*1024))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	const mb = 1024 * 1024
+	// 5.1 has recorded 10 MB per minute and 9.1 5 MB per minute; 7.1 has no
+	// history and uses the 8 MB per minute average over both.
+	if _, err := db.Exec(`INSERT INTO recordings (channel_id, date, start_time, duration, status, file_size) VALUES
+		('5.1', '2026-03-01', '20:00', 60, 'completed', ?),
+		('9.1', '2026-03-02', '20:00', 40, 'completed', ?)`, 600*mb, 200*mb); err != nil {
+		t.Fatal(err)
+	}
+
+	mem.SetCapacity(700 * mb)
+	ctx := context.Background()
+	if err := app.checkFreeSpace(ctx, mem, types.Recording{ID: 1, ChannelID: "5.1"}, 58); err != nil {
+		t.Errorf("58 minutes at 10 MB/min with a 20%% margin should fit in 700 MB: %v", err)
+	}
+	if err := app.checkFreeSpace(ctx, mem, types.Recording{ID: 2, ChannelID: "5.1"}, 59); err == nil {
+		t.Error("expected 59 minutes not to fit")
+	}
+	if err := app.checkFreeSpace(ctx, mem, types.Recording{ID: 3, ChannelID: "7.1"}, 59); err != nil {
+		t.Errorf("unknown channels should use the overall rate: %v", err)
+	}
+}
+
+func TestStartRecordingInsufficientSpace(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	mem.SetCapacity(1024 * 1024)
+	app.storage = mem
+	started := false
+	app.commander.(*MockCommander).StartCommandFunc = func(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error) {
+		started = true
+		return &exec.Cmd{}, nil
+	}
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending')"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+
+	app.startRecording(types.Recording{ID: 1, ChannelID: "5.1", Date: "2026-03-01", StartTime: "20:00", Duration: 60, Status: "pending"})
+
+	var status string
+	if err := db.QueryRow("SELECT status FROM recordings WHERE id = 1").Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != statusInsufficientSpace {
+		t.Errorf("status = %q, want %q", status, statusInsufficientSpace)
+	}
+	if started {
+		t.Error("ffmpeg should not have been started")
+	}
+	select {
+	case e := <-events:
+		if e.Type != "recording.failed" {
+			t.Errorf("got %s event", e.Type)
+		}
+	default:
+		t.Error("expected a recording.failed event")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// WatchState is one user's progress through a recording. Recordings
+// without one are unwatched, from the start.
+type WatchState struct {
+	RecordingID     int     `json:"recordingId"`
+	Watched         bool    `json:"watched"`
+	PositionSeconds float64 `json:"positionSeconds"`
+	UpdatedAt       string  `json:"updatedAt"`
+}
+
+// profileUser returns the signed-in user of r, answering 401 when there is
+// none: profiles belong to users, not to API keys or anonymous callers.
+func profileUser(w http.ResponseWriter, r *http.Request) *User {
+	u := requestUser(r)
+	if u == nil {
+		writeUnauthorized(w, "sign in to keep a profile")
+	}
+	return u
+}
+
+// watchStates returns userID's watch state for each recording they have
+// one for.
+func (a *App) watchStates(ctx context.Context, userID int64) (map[int]WatchState, error) {
+	rows, err := a.dbQueryContext(ctx,
+		"SELECT recording_id, watched, position_seconds, updated_at FROM watch_state WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	states := make(map[int]WatchState)
+	for rows.Next() {
+		var s WatchState
+		if err := rows.Scan(&s.RecordingID, &s.Watched, &s.PositionSeconds, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		states[s.RecordingID] = s
+	}
+	return states, rows.Err()
+}
+
+// favoriteChannels returns the guide numbers of userID's favorite channels.
+func (a *App) favoriteChannels(ctx context.Context, userID int64) (map[string]bool, error) {
+	rows, err := a.dbQueryContext(ctx, "SELECT guide_number FROM favorite_channels WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	favorites := make(map[string]bool)
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		favorites[n] = true
+	}
+	return favorites, rows.Err()
+}
+
+// getWatchStates serves GET /api/profile/watch: the caller's watch state
+// of every recording they have started or marked.
+func (a *App) getWatchStates(w http.ResponseWriter, r *http.Request) {
+	u := profileUser(w, r)
+	if u == nil {
+		return
+	}
+	states, err := a.watchStates(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := []WatchState{}
+	for _, s := range states {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RecordingID < list[j].RecordingID })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list) //nolint: errcheck
+}
+
+// WatchStateRequest is the body of PUT /api/recordings/{id}/watch.
+type WatchStateRequest struct {
+	Watched         *bool    `json:"watched"`
+	PositionSeconds *float64 `json:"positionSeconds"`
+}
+
+// putWatchState serves PUT /api/recordings/{id}/watch, setting the caller's
+// watched flag, resume position or both. Marking a recording watched
+// resets the position, so it plays from the start next time.
+func (a *App) putWatchState(w http.ResponseWriter, r *http.Request) {
+	u := profileUser(w, r)
+	if u == nil {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var req WatchStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.PositionSeconds != nil && *req.PositionSeconds < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "positionSeconds must be zero or positive"}) //nolint: errcheck
+		return
+	}
+
+	ctx := r.Context()
+	var exists int
+	if err := a.dbQueryRowContext(ctx, "SELECT 1 FROM recordings WHERE id = ?", id).Scan(&exists); err == sql.ErrNoRows {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	states, err := a.watchStates(ctx, u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s := states[id]
+	if req.PositionSeconds != nil {
+		s.PositionSeconds = *req.PositionSeconds
+	}
+	if req.Watched != nil {
+		s.Watched = *req.Watched
+		if s.Watched {
+			s.PositionSeconds = 0
+		}
+	}
+	if _, err := a.dbExecContext(ctx, `
+        INSERT OR REPLACE INTO watch_state (user_id, recording_id, watched, position_seconds, updated_at)
+        VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`, u.ID, id, s.Watched, s.PositionSeconds); err != nil {
+		requestLogger(r).Error("Error storing watch state", "recording_id", id, "err", err)
+		http.Error(w, "Failed to store watch state", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteWatchState serves DELETE /api/recordings/{id}/watch, making the
+// recording unwatched again for the caller.
+func (a *App) deleteWatchState(w http.ResponseWriter, r *http.Request) {
+	u := profileUser(w, r)
+	if u == nil {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := a.dbExecContext(r.Context(), "DELETE FROM watch_state WHERE user_id = ? AND recording_id = ?", u.ID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFavoriteChannels serves GET /api/profile/favorites, the guide numbers
+// of the caller's favorite channels.
+func (a *App) getFavoriteChannels(w http.ResponseWriter, r *http.Request) {
+	u := profileUser(w, r)
+	if u == nil {
+		return
+	}
+	favorites, err := a.favoriteChannels(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := []string{}
+	for n := range favorites {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list) //nolint: errcheck
+}
+
+// putFavoriteChannel serves PUT /api/profile/favorites/{channel}.
+func (a *App) putFavoriteChannel(w http.ResponseWriter, r *http.Request) {
+	u := profileUser(w, r)
+	if u == nil {
+		return
+	}
+	ctx := r.Context()
+	channel := mux.Vars(r)["channel"]
+	var exists int
+	if err := a.dbQueryRowContext(ctx, "SELECT 1 FROM channels WHERE guide_number = ?", channel).Scan(&exists); err == sql.ErrNoRows {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := a.dbExecContext(ctx, "INSERT OR IGNORE INTO favorite_channels (user_id, guide_number) VALUES (?, ?)", u.ID, channel); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteFavoriteChannel serves DELETE /api/profile/favorites/{channel}.
+func (a *App) deleteFavoriteChannel(w http.ResponseWriter, r *http.Request) {
+	u := profileUser(w, r)
+	if u == nil {
+		return
+	}
+	if _, err := a.dbExecContext(r.Context(), "DELETE FROM favorite_channels WHERE user_id = ? AND guide_number = ?", u.ID, mux.Vars(r)["channel"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestProfiles(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1), ('7.1', 'KGO', 'http://tuner/auto/v7.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News'), (2, '7.1', '2026-03-01', '21:00', 60, 'completed', 'Movie')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var alice, bob User
+	var err error
+	if alice, err = app.addUser(ctx, "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if bob, err = app.addUser(ctx, "bob", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/channels", app.getChannels).Methods("GET")
+	r.HandleFunc("/api/v1/recordings", app.getRecordings).Methods("GET")
+	r.HandleFunc("/api/v1/recordings/{id}/watch", app.putWatchState).Methods("PUT")
+	r.HandleFunc("/api/v1/recordings/{id}/watch", app.deleteWatchState).Methods("DELETE")
+	r.HandleFunc("/api/v1/profile/watch", app.getWatchStates).Methods("GET")
+	r.HandleFunc("/api/v1/profile/favorites", app.getFavoriteChannels).Methods("GET")
+	r.HandleFunc("/api/v1/profile/favorites/{channel}", app.putFavoriteChannel).Methods("PUT")
+	call := func(u *User, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if u != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userCtxKey{}, u))
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := call(nil, "PUT", "/api/v1/recordings/1/watch", `{"watched": true}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous watch state: %d", rr.Code)
+	}
+	for _, tc := range []struct {
+		u    *User
+		path string
+		body string
+		want int
+	}{
+		{&alice, "/api/v1/recordings/1/watch", `{"positionSeconds": 754.5}`, http.StatusNoContent},
+		{&alice, "/api/v1/recordings/2/watch", `{"positionSeconds": 60}`, http.StatusNoContent},
+		{&alice, "/api/v1/recordings/2/watch", `{"watched": true}`, http.StatusNoContent},
+		{&bob, "/api/v1/recordings/1/watch", `{"watched": true}`, http.StatusNoContent},
+		{&bob, "/api/v1/recordings/1/watch", `{"positionSeconds": -1}`, http.StatusBadRequest},
+		{&bob, "/api/v1/recordings/9/watch", `{"watched": true}`, http.StatusNotFound},
+		{&alice, "/api/v1/profile/favorites/7.1", "", http.StatusNoContent},
+		{&alice, "/api/v1/profile/favorites/99.1", "", http.StatusNotFound},
+	} {
+		if rr := call(tc.u, "PUT", tc.path, tc.body); rr.Code != tc.want {
+			t.Errorf("%s PUT %s %s: got %d, want %d", tc.u.Username, tc.path, tc.body, rr.Code, tc.want)
+		}
+	}
+
+	var states []WatchState
+	json.NewDecoder(call(&alice, "GET", "/api/v1/profile/watch", "").Body).Decode(&states) //nolint: errcheck
+	if len(states) != 2 || states[0].Watched || states[0].PositionSeconds != 754.5 || !states[1].Watched || states[1].PositionSeconds != 0 {
+		t.Errorf("alice's watch state %+v", states)
+	}
+
+	// The recordings are shared; the watch state in the list is the caller's.
+	recordings := func(u *User) []GetRecordingsRec {
+		var recs []GetRecordingsRec
+		json.NewDecoder(call(u, "GET", "/api/v1/recordings", "").Body).Decode(&recs) //nolint: errcheck
+		return recs
+	}
+	if recs := recordings(&bob); len(recs) != 2 || recs[0].Watched == nil || !*recs[0].Watched || recs[1].Watched != nil {
+		t.Errorf("bob's recordings %+v", recs)
+	}
+	if recs := recordings(nil); len(recs) != 2 || recs[0].Watched != nil {
+		t.Errorf("anonymous recordings %+v", recs)
+	}
+
+	var channels []struct {
+		GuideNumber string `json:"guideNumber"`
+		Favorite    bool   `json:"favorite"`
+	}
+	json.NewDecoder(call(&alice, "GET", "/api/v1/channels", "").Body).Decode(&channels) //nolint: errcheck
+	if len(channels) != 2 || channels[0].Favorite || !channels[1].Favorite {
+		t.Errorf("alice's channels %+v", channels)
+	}
+	var favorites []string
+	json.NewDecoder(call(&bob, "GET", "/api/v1/profile/favorites", "").Body).Decode(&favorites) //nolint: errcheck
+	if len(favorites) != 0 {
+		t.Errorf("bob's favorites %v", favorites)
+	}
+
+	if rr := call(&bob, "DELETE", "/api/v1/recordings/1/watch", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("clear watch state: %d", rr.Code)
+	}
+	if recs := recordings(&bob); recs[0].Watched != nil {
+		t.Errorf("watch state survived DELETE: %+v", recs[0])
+	}
+
+	// Removing a user removes their profile.
+	if err := app.removeUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if states, _ := app.watchStates(ctx, alice.ID); len(states) != 0 {
+		t.Errorf("watch state of a removed user: %v", states)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// maxProgramShift is how far a linked program may move between guide
+// generations and still be recognized as the same airing.
+const maxProgramShift = 12 * time.Hour
+
+// linkProgram records which guide program a recording was scheduled for.
+func (a *App) linkProgram(ctx context.Context, recordingID int, programID string) error {
+	_, err := a.dbExecContext(ctx,
+		"INSERT OR REPLACE INTO program_links (recording_id, program_id) VALUES (?, ?)",
+		recordingID, programID)
+	return err
+}
+
+// reconcileProgramLinks follows pending recordings whose program is missing
+// from a newly loaded guide. An airing on the same station with the same
+// title hash within maxProgramShift is taken to be the program at its new
+// time: the link is updated and the recording moved to the new start.
+func (a *App) reconcileProgramLinks(ctx context.Context, programs []types.Program) {
+	byID := make(map[string]bool, len(programs))
+	type airing struct {
+		prog  types.Program
+		start time.Time
+	}
+	candidates := make(map[string][]airing)
+	for _, p := range programs {
+		if p.ID == "" {
+			continue
+		}
+		byID[p.ID] = true
+		if station, start, hash, ok := types.ParseProgramID(p.ID); ok {
+			candidates[station+"|"+hash] = append(candidates[station+"|"+hash], airing{p, start})
+		}
+	}
+
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT l.recording_id, l.program_id
+		FROM program_links l
+		JOIN recordings r ON r.id = l.recording_id
+		WHERE r.status = 'pending'`)
+	if err != nil {
+		slog.Error("Error loading program links", "err", err)
+		return
+	}
+	type link struct {
+		recordingID int
+		programID   string
+	}
+	var stale []link
+	for rows.Next() {
+		var l link
+		if err := rows.Scan(&l.recordingID, &l.programID); err != nil {
+			slog.Error("Error scanning program link", "err", err)
+			continue
+		}
+		if !byID[l.programID] {
+			stale = append(stale, l)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating program links", "err", err)
+	}
+	rows.Close() //nolint: errcheck
+
+	loc, _ := a.getLocalLocation()
+	for _, l := range stale {
+		station, oldStart, hash, ok := types.ParseProgramID(l.programID)
+		if !ok {
+			continue
+		}
+		var best *airing
+		for i, c := range candidates[station+"|"+hash] {
+			shift := c.start.Sub(oldStart).Abs()
+			if shift > maxProgramShift {
+				continue
+			}
+			if best == nil || shift < best.start.Sub(oldStart).Abs() {
+				best = &candidates[station+"|"+hash][i]
+			}
+		}
+		if best == nil {
+			slog.Info("Program for recording is no longer in the guide", "program_id", l.programID, "recording_id", l.recordingID)
+			continue
+		}
+
+		start := best.start.In(loc)
+		_, err := a.dbExecContext(ctx,
+			"UPDATE recordings SET channel_id = ?, date = ?, start_time = ? WHERE id = ? AND status = 'pending'",
+			best.prog.Channel, start.Format("2006-01-02"), start.Format("15:04"), l.recordingID)
+		if err != nil {
+			slog.Error("Error moving recording", "recording_id", l.recordingID, "err", err)
+			continue
+		}
+		if err := a.linkProgram(ctx, l.recordingID, best.prog.ID); err != nil {
+			slog.Error("Error updating program link for recording", "recording_id", l.recordingID, "err", err)
+		}
+		// The scheduler starts a new timer for the new time on its next tick.
+		recordingTimers.Delete(l.recordingID)
+		slog.Info("Program moved, rescheduled recording", "recording_id", l.recordingID, "title", best.prog.Title,
+			"from", oldStart.In(loc).Format("2006-01-02 15:04"), "to", start.Format("2006-01-02 15:04"))
+	}
+}
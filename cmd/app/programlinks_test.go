@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestCreateRecordingLinksProgram(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, enabled) VALUES ('5.1', 'KPIX', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	id := types.ProgramID("19571", start, "Evening News")
+	app.guideData = types.Guide{Programs: []types.Program{{
+		ID:      id,
+		Channel: "5.1",
+		Title:   "Evening News",
+		Start:   start.Format(time.RFC3339),
+		End:     start.Add(30 * time.Minute).Format(time.RFC3339),
+	}}}
+
+	body, _ := json.Marshal(RecordingRequest{ChannelID: "5.1", Date: "2026-03-01", StartTime: "20:00", Duration: 30})
+	req := httptest.NewRequest("POST", "/api/recordings", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	app.createRecording(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	<-recordingCh
+
+	rr = httptest.NewRecorder()
+	app.getRecordings(rr, httptest.NewRequest("GET", "/api/recordings", nil))
+	var recs []GetRecordingsRec
+	if err := json.NewDecoder(rr.Body).Decode(&recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].ProgramID == nil || *recs[0].ProgramID != id {
+		t.Fatalf("expected recording linked to %s, got %+v", id, recs)
+	}
+}
+
+func TestReconcileProgramLinks(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+
+	oldStart := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	newStart := oldStart.Add(30 * time.Minute)
+	if _, err := db.Exec(`INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES
+		(1, '5.1', '2026-03-01', '20:00', 60, 'pending'),
+		(2, '5.1', '2026-03-01', '22:00', 60, 'pending')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.linkProgram(ctx, 1, types.ProgramID("19571", oldStart, "Game Night")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.linkProgram(ctx, 2, types.ProgramID("19571", oldStart.Add(2*time.Hour), "Cancelled Show")); err != nil {
+		t.Fatal(err)
+	}
+	recordingTimers.Store(1, &recordingTimer{})
+
+	moved := types.ProgramID("19571", newStart, "Game Night")
+	app.reconcileProgramLinks(ctx, []types.Program{
+		{ID: types.ProgramID("19571", oldStart.Add(-24*time.Hour), "Game Night"), Channel: "5.1", Title: "Game Night"},
+		{ID: moved, Channel: "5.1", Title: "Game Night"},
+	})
+
+	var date, startTime, programID string
+	if err := db.QueryRow("SELECT r.date, r.start_time, l.program_id FROM recordings r JOIN program_links l ON l.recording_id = r.id WHERE r.id = 1").
+		Scan(&date, &startTime, &programID); err != nil {
+		t.Fatal(err)
+	}
+	if date != "2026-03-01" || startTime != "20:30" || programID != moved {
+		t.Errorf("recording 1 = %s %s %s, want 2026-03-01 20:30 %s", date, startTime, programID, moved)
+	}
+	if _, ok := recordingTimers.Load(1); ok {
+		t.Error("expected the old timer to be dropped")
+	}
+
+	if err := db.QueryRow("SELECT start_time FROM recordings WHERE id = 2").Scan(&startTime); err != nil {
+		t.Fatal(err)
+	}
+	if startTime != "22:00" {
+		t.Errorf("unmatched recording moved to %s", startTime)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// progressInterval is how often a running recording publishes
+// recording.progress.
+var progressInterval = 30 * time.Second
+
+// recordingProgress is the recording.progress payload.
+func recordingProgress(fs storage.Storage, id int, name string, started time.Time, durationSeconds int) map[string]interface{} {
+	elapsed := time.Since(started).Seconds()
+	var size int64
+	if fi, err := fs.Stat(name); err == nil {
+		size = fi.Size()
+	}
+	percent := 0.0
+	if durationSeconds > 0 {
+		percent = min(100, elapsed*100/float64(durationSeconds))
+	}
+	return map[string]interface{}{
+		"id":              id,
+		"bytes":           size,
+		"elapsedSeconds":  int(elapsed),
+		"durationSeconds": durationSeconds,
+		"percent":         float64(int(percent*10)) / 10,
+	}
+}
+
+// reportProgress publishes recording.progress for a running capture every
+// progressInterval until ctx is done.
+func (a *App) reportProgress(ctx context.Context, fs storage.Storage, id int, name string, durationSeconds int) {
+	started := time.Now()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.events.publish("recording.progress", recordingProgress(fs, id, name, started, durationSeconds))
+		}
+	}
+}
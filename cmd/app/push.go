@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// pushDefaultEvents are what the phone push providers send unless
+// configured otherwise.
+var pushDefaultEvents = []string{eventRecordingFailed, eventRecordingCompleted, eventDiskLow}
+
+// pushoverAPI is where Pushover messages are posted; tests point it at a
+// local server.
+var pushoverAPI = "https://api.pushover.net/1/messages.json"
+
+// urgentEvent reports whether event is a problem worth interrupting for,
+// which push providers send at a raised priority.
+func urgentEvent(event string) bool {
+	switch event {
+	case eventRecordingFailed, eventRecordingPartial, eventDiskLow, eventGuideRefreshFailed:
+		return true
+	}
+	return false
+}
+
+// pushRequest sends req and turns an error status into an error.
+func pushRequest(client *http.Client, req *http.Request) error {
+	req.Header.Set("User-Agent", "hdhr-dvr")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// ntfyNotifier publishes notifications to an ntfy topic.
+type ntfyNotifier struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newNtfyNotifier(cfg pkgcfg.Ntfy) *ntfyNotifier {
+	server := cfg.Server
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	return &ntfyNotifier{
+		url:    strings.TrimRight(server, "/") + "/" + url.PathEscape(cfg.Topic),
+		token:  cfg.Token,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (n *ntfyNotifier) name() string { return "ntfy" }
+
+func (n *ntfyNotifier) notify(ctx context.Context, note Notification) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, strings.NewReader(note.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", note.Subject)
+	req.Header.Set("Tags", strings.ReplaceAll(note.Event, ".", "_"))
+	if urgentEvent(note.Event) {
+		req.Header.Set("Priority", "high")
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return pushRequest(n.client, req)
+}
+
+// pushoverNotifier sends notifications through the Pushover API.
+type pushoverNotifier struct {
+	cfg    pkgcfg.Pushover
+	client *http.Client
+}
+
+func newPushoverNotifier(cfg pkgcfg.Pushover) *pushoverNotifier {
+	return &pushoverNotifier{cfg: cfg, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (p *pushoverNotifier) name() string { return "pushover" }
+
+func (p *pushoverNotifier) notify(ctx context.Context, n Notification) error {
+	form := url.Values{
+		"token":     {p.cfg.Token},
+		"user":      {p.cfg.User},
+		"title":     {n.Subject},
+		"message":   {n.Message},
+		"timestamp": {strconv.FormatInt(n.Time.Unix(), 10)},
+	}
+	if p.cfg.Device != "" {
+		form.Set("device", p.cfg.Device)
+	}
+	if urgentEvent(n.Event) {
+		form.Set("priority", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", pushoverAPI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return pushRequest(p.client, req)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestNtfyNotifier(t *testing.T) {
+	var path, title, priority, auth, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		path, title, priority, auth, body = r.URL.Path, r.Header.Get("Title"), r.Header.Get("Priority"), r.Header.Get("Authorization"), string(b)
+	}))
+	defer srv.Close()
+
+	entries := newNotifiers(pkgcfg.Notifications{Ntfy: &pkgcfg.Ntfy{Server: srv.URL + "/", Topic: "dvr", Token: "tk"}})
+	if len(entries) != 1 || !entries[0].wants(eventRecordingCompleted) || entries[0].wants(eventRecordingStarted) {
+		t.Fatalf("entries %+v", entries)
+	}
+	n := Notification{Event: eventRecordingFailed, Subject: "Recording failed", Message: "Could not record News"}
+	if err := entries[0].notifier.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/dvr" || title != "Recording failed" || priority != "high" || auth != "Bearer tk" || body != "Could not record News" {
+		t.Errorf("got %s %q %q %q %q", path, title, priority, auth, body)
+	}
+
+	n.Event = eventRecordingCompleted
+	if err := entries[0].notifier.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if priority != "" {
+		t.Errorf("completion sent with priority %q", priority)
+	}
+}
+
+func TestPushoverNotifier(t *testing.T) {
+	var form url.Values
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm() //nolint: errcheck
+		form = r.PostForm
+		w.WriteHeader(status)
+		w.Write([]byte(`{"status":0,"errors":["user key is invalid"]}`)) //nolint: errcheck
+	}))
+	defer srv.Close()
+	old := pushoverAPI
+	pushoverAPI = srv.URL
+	defer func() { pushoverAPI = old }()
+
+	p := newPushoverNotifier(pkgcfg.Pushover{Token: "app", User: "usr", Events: []string{eventDiskLow}})
+	n := Notification{Event: eventDiskLow, Time: time.Unix(1700000000, 0), Subject: "Disk space low", Message: "/rec has 1.0 GB free"}
+	if err := p.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"token": "app", "user": "usr", "title": "Disk space low", "priority": "1", "timestamp": "1700000000"} {
+		if form.Get(k) != want {
+			t.Errorf("%s = %q, want %q", k, form.Get(k), want)
+		}
+	}
+
+	status = http.StatusBadRequest
+	if err := p.notify(context.Background(), n); err == nil {
+		t.Error("rejected message reported as sent")
+	}
+}
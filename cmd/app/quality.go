@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log/slog"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// selectQualityTier returns the tier for freeBytes of free space: of the
+// tiers whose threshold is above it, the one with the lowest threshold, so
+// the profile gets smaller as the disk fills. It returns nil while there is
+// enough space to stream copy.
+func selectQualityTier(tiers []pkgcfg.QualityTier, freeBytes int64) *pkgcfg.QualityTier {
+	var best *pkgcfg.QualityTier
+	for i := range tiers {
+		t := &tiers[i]
+		if len(t.FFmpegArgs) == 0 || freeBytes >= t.BelowFreeMB*1024*1024 {
+			continue
+		}
+		if best == nil || t.BelowFreeMB < best.BelowFreeMB {
+			best = t
+		}
+	}
+	return best
+}
+
+// recordingCodecArgs returns the ffmpeg codec arguments for a recording
+// starting now on fs: nil to stream copy, or the arguments of the quality
+// tier selected by the current free space. Applying a tier publishes
+// recording.quality_reduced.
+func (a *App) recordingCodecArgs(fs storage.Storage, recordingID int) []string {
+	if len(a.cfg().QualityTiers) == 0 {
+		return nil
+	}
+	sr, ok := fs.(storage.SpaceReporter)
+	if !ok {
+		return nil
+	}
+	free, err := sr.FreeSpace()
+	if err != nil {
+		slog.Error("Error checking free space for quality tiers", "err", err)
+		return nil
+	}
+
+	tier := selectQualityTier(a.cfg().QualityTiers, free)
+	if tier == nil {
+		return nil
+	}
+	slog.Warn("Low on space, recording uses a quality tier instead of stream copy", "recording_id", recordingID,
+		"tier", tier.Name, "free_mb", free/(1024*1024), "below_free_mb", tier.BelowFreeMB)
+	a.events.publish(eventQualityReduced, map[string]interface{}{"id": recordingID, "tier": tier.Name, "freeBytes": free})
+	return tier.FFmpegArgs
+}
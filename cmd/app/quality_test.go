@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestSelectQualityTier(t *testing.T) {
+	tiers := []pkgcfg.QualityTier{
+		{Name: "small", BelowFreeMB: 20000, FFmpegArgs: []string{"-c:v", "libx264", "-crf", "26"}},
+		{Name: "tiny", BelowFreeMB: 5000, FFmpegArgs: []string{"-c:v", "libx264", "-crf", "32"}},
+		{Name: "empty", BelowFreeMB: 1000},
+	}
+	const mb = 1024 * 1024
+	tests := []struct {
+		free int64
+		want string
+	}{
+		{50000 * mb, ""},
+		{20000 * mb, ""},
+		{19999 * mb, "small"},
+		{4000 * mb, "tiny"},
+		{500 * mb, "tiny"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if tier := selectQualityTier(tiers, tt.free); tier != nil {
+			got = tier.Name
+		}
+		if got != tt.want {
+			t.Errorf("selectQualityTier(%d MB) = %q, want %q", tt.free/mb, got, tt.want)
+		}
+	}
+}
+
+func TestRecordingCodecArgs(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	mem.SetCapacity(100 * 1024 * 1024)
+	app.storage = mem
+
+	if args := app.recordingCodecArgs(app.storage, 1); args != nil {
+		t.Errorf("expected stream copy without tiers, got %v", args)
+	}
+
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+	app.config.QualityTiers = []pkgcfg.QualityTier{{Name: "small", BelowFreeMB: 200, FFmpegArgs: []string{"-c:v", "libx264"}}}
+	args := app.recordingCodecArgs(app.storage, 1)
+	if !reflect.DeepEqual(args, []string{"-c:v", "libx264"}) {
+		t.Errorf("got %v, want the tier's arguments", args)
+	}
+	select {
+	case e := <-events:
+		if tier, _ := eventField(e.Data, "tier"); e.Type != eventQualityReduced || tier != "small" || !isNotificationEvent(e.Type) {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Errorf("no %s event", eventQualityReduced)
+	}
+
+	ffmpegArgs := buildFFmpegArgs("http://tuner/auto/v5.1", 60, "out.ts", args)
+	tail := ffmpegArgs[len(ffmpegArgs)-5:]
+	if !reflect.DeepEqual(tail, []string{"-c:v", "libx264", "-f", "mpegts", "out.ts"}) {
+		t.Errorf("unexpected ffmpeg args %v", ffmpegArgs)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket is one client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per key. Buckets that have refilled are
+// dropped now and then, since a new one starts out full anyway.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from key's bucket, which refills at rate per second
+// up to burst. When it is empty, allow returns false and how long until a
+// token is back.
+func (l *rateLimiter) allow(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last).Seconds()*rate >= float64(burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientIP returns the address r is counted against: the peer, or for a
+// peer in trustedProxies the last address it added to X-Forwarded-For.
+func clientIP(r *http.Request, trustedProxies []string) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(trustedProxies) == 0 || !inNetworks(r, trustedProxies) {
+		return host
+	}
+	fwd := r.Header.Get("X-Forwarded-For")
+	if i := strings.LastIndex(fwd, ","); i >= 0 {
+		fwd = fwd[i+1:]
+	}
+	if ip := net.ParseIP(strings.TrimSpace(fwd)); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// rateLimit is router middleware answering API requests beyond the
+// client's rate with 429. Downloads have their own, smaller bucket so
+// players seeking through a file don't use up the UI's requests, and
+// scanners can't keep the disk busy while a recording is being written.
+func (a *App) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rl := a.cfg().RateLimit
+		route := currentRoute(r)
+		if rl == nil || !strings.HasPrefix(route, apiPrefix+"/") || inNetworks(r, rl.Exempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, rate, burst := "api ", rl.RequestsPerSecond, rl.Burst
+		if route == fileRoute {
+			key, rate, burst = "file ", rl.FileRequestsPerSecond, rl.FileBurst
+		}
+		ip := clientIP(r, rl.TrustedProxies)
+		if ok, wait := a.limiter.allow(key+ip, rate, burst, time.Now()); !ok {
+			requestLogger(r).Debug("Rate limited request", "client", ip, "route", route)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "too many requests"}) //nolint: errcheck
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
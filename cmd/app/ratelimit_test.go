@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := newRateLimiter()
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a", 1, 3, now); !ok {
+			t.Fatalf("request %d refused within the burst", i)
+		}
+	}
+	ok, wait := l.allow("a", 1, 3, now)
+	if ok || wait != time.Second {
+		t.Errorf("empty bucket: %v, wait %v", ok, wait)
+	}
+	if ok, _ := l.allow("b", 1, 3, now); !ok {
+		t.Error("another key shares the bucket")
+	}
+	if ok, _ := l.allow("a", 1, 3, now.Add(time.Second)); !ok {
+		t.Error("bucket did not refill")
+	}
+
+	// Refilled buckets are swept.
+	l.allow("c", 1, 3, now.Add(time.Hour))
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after the sweep", len(l.buckets))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	r := mux.NewRouter()
+	r.Use(app.rateLimit)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/api/v1/recordings", ok).Methods("GET")
+	r.HandleFunc(fileRoute, ok).Methods("GET")
+	r.HandleFunc("/", ok).Methods("GET")
+	call := func(path, remote, forwarded string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Off by default.
+	for i := 0; i < 5; i++ {
+		if rr := call(fileRoute, "192.0.2.1:1", ""); rr.Code != http.StatusOK {
+			t.Fatalf("rate limit disabled: %d", rr.Code)
+		}
+	}
+
+	app.config.RateLimit = &pkgcfg.RateLimit{
+		RequestsPerSecond: 1, Burst: 3, FileRequestsPerSecond: 0.1, FileBurst: 1,
+		Exempt: []string{"192.0.2.50/32"}, TrustedProxies: []string{"172.18.0.2/32"},
+	}
+	if rr := call("/api/v1/recordings/5/file", "192.0.2.1:1", ""); rr.Code != http.StatusOK {
+		t.Fatalf("first download: %d", rr.Code)
+	}
+	rr := call("/api/v1/recordings/6/file", "192.0.2.1:1", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "10" {
+		t.Errorf("second download: %d, Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	// Downloads don't use up the rest of the API, nor pages at all.
+	for i := 0; i < 3; i++ {
+		if rr := call("/api/v1/recordings", "192.0.2.1:1", ""); rr.Code != http.StatusOK {
+			t.Fatalf("API request %d: %d", i, rr.Code)
+		}
+	}
+	if rr := call("/api/v1/recordings", "192.0.2.1:1", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("API request beyond the burst: %d", rr.Code)
+	}
+	if rr := call("/", "192.0.2.1:1", ""); rr.Code != http.StatusOK {
+		t.Errorf("page: %d", rr.Code)
+	}
+	if rr := call(fileRoute, "192.0.2.50:1", ""); rr.Code != http.StatusOK {
+		t.Errorf("exempt client: %d", rr.Code)
+	}
+
+	// Behind a trusted proxy each forwarded client has its own bucket; the
+	// header is ignored from anyone else.
+	if rr := call(fileRoute, "172.18.0.2:1", "192.0.2.1, 198.51.100.7"); rr.Code != http.StatusOK {
+		t.Errorf("forwarded client: %d", rr.Code)
+	}
+	if rr := call(fileRoute, "172.18.0.2:1", "198.51.100.8"); rr.Code != http.StatusOK {
+		t.Errorf("second forwarded client: %d", rr.Code)
+	}
+	if rr := call(fileRoute, "192.0.2.1:1", "198.51.100.9"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("forwarded header from an untrusted client: %d", rr.Code)
+	}
+}
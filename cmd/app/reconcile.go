@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// statusMissing marks completed recordings whose file is no longer on disk.
+const statusMissing = "missing"
+
+// recordingFileRe matches names in the default "{date}-{time}-{title}"
+// form, before or after MP4 conversion, with the time written either as
+// HH:MM (recordings made before filename templates) or HH-MM.
+var recordingFileRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(\d{2})[:-](\d{2})-(.+)\.(ts|mp4)$`)
+
+// OrphanFile is a media file in a storage root that no recording refers to.
+// Date, StartTime and Title are parsed from the name when it has the form
+// the DVR writes, which is required to import it.
+type OrphanFile struct {
+	Root      string `json:"root"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Date      string `json:"date,omitempty"`
+	StartTime string `json:"startTime,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// ReconcileReport is the result of comparing the recordings table with the
+// files in the storage roots.
+type ReconcileReport struct {
+	Missing  []int        `json:"missing"`
+	Restored []int        `json:"restored"`
+	Orphans  []OrphanFile `json:"orphans"`
+}
+
+// isMediaFile reports whether name is a recording file rather than a
+// temporary one such as a repair, chapter remux or commercial cut in
+// progress or the throughput probe.
+func isMediaFile(name string) bool {
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".") || strings.HasSuffix(base, ".repair.mp4") || strings.HasSuffix(base, ".chapters.mp4") ||
+		strings.HasSuffix(base, ".cut.mp4") || strings.HasSuffix(base, ".filtered.mp4") {
+		return false
+	}
+	ext := path.Ext(base)
+	return ext == ".ts" || ext == ".mp4"
+}
+
+// recordingFileNames returns the transport stream and MP4 names of rec.
+func recordingFileNames(rec types.Recording) (string, string) {
+	ts := rec.GetFilePath()
+	return ts, mp4Name(ts)
+}
+
+// reconcileStorage marks completed recordings whose files are gone as
+// missing, puts missing recordings whose files are back to completed, and
+// lists media files that belong to no recording.
+func (a *App) reconcileStorage(ctx context.Context) (*ReconcileReport, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.title, r.status, COALESCE(rs.root, ''), COALESCE(f.path, '')
+		FROM recordings r
+		LEFT JOIN recording_storage rs ON rs.recording_id = r.id
+		LEFT JOIN recording_files f ON f.recording_id = r.id`)
+	if err != nil {
+		return nil, err
+	}
+	type recordingFiles struct {
+		rec  types.Recording
+		root string
+	}
+	var recs []recordingFiles
+	for rows.Next() {
+		var rf recordingFiles
+		if err := rows.Scan(&rf.rec.ID, &rf.rec.ChannelID, &rf.rec.Date, &rf.rec.StartTime, &rf.rec.Title, &rf.rec.Status, &rf.root, &rf.rec.FileName); err != nil {
+			rows.Close() //nolint: errcheck
+			return nil, err
+		}
+		if rf.root == "" {
+			rf.root = a.cfg().StorageDir
+		}
+		recs = append(recs, rf)
+	}
+	err = rows.Err()
+	rows.Close() //nolint: errcheck
+	if err != nil {
+		return nil, err
+	}
+
+	// known holds every file a recording may own, keyed by root and name.
+	known := make(map[[2]string]bool)
+	roots := make(map[int]string, len(recs))
+	report := &ReconcileReport{Missing: []int{}, Restored: []int{}, Orphans: []OrphanFile{}}
+	for _, rf := range recs {
+		ts, mp4 := recordingFileNames(rf.rec)
+		known[[2]string{rf.root, ts}] = true
+		known[[2]string{rf.root, mp4}] = true
+		roots[rf.rec.ID] = rf.root
+	}
+	outputs, err := a.transcodeOutputs(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, out := range outputs {
+		if root, ok := roots[out.recordingID]; ok {
+			known[[2]string{root, out.name}] = true
+		}
+	}
+
+	for _, rf := range recs {
+		if rf.rec.Status != "completed" && rf.rec.Status != statusMissing {
+			continue
+		}
+		ts, mp4 := recordingFileNames(rf.rec)
+		fs := a.rootStorage(rf.root)
+		_, tsErr := fs.Stat(ts)
+		_, mp4Err := fs.Stat(mp4)
+		present := tsErr == nil || mp4Err == nil
+
+		var status, reason string
+		switch {
+		case !present && rf.rec.Status == statusCompleted:
+			status, reason = statusMissing, "file not found in storage"
+			report.Missing = append(report.Missing, rf.rec.ID)
+		case present && rf.rec.Status == statusMissing:
+			status, reason = statusCompleted, "file found in storage again"
+			report.Restored = append(report.Restored, rf.rec.ID)
+		default:
+			continue
+		}
+		if err := a.setStatus(ctx, rf.rec.ID, status, reason); err != nil {
+			return nil, err
+		}
+		slog.Info("Reconcile: recording status changed", "recording_id", rf.rec.ID, "status", status)
+	}
+
+	for _, root := range a.storageRoots() {
+		names, err := root.store.List()
+		if err != nil {
+			slog.Error("Reconcile: error listing storage root", "dir", root.dir, "err", err)
+			continue
+		}
+		for _, name := range names {
+			if !isMediaFile(name) || known[[2]string{root.dir, name}] {
+				continue
+			}
+			orphan := OrphanFile{Root: root.dir, Name: name}
+			if info, err := root.store.Stat(name); err == nil {
+				orphan.Size = info.Size()
+			}
+			if m := recordingFileRe.FindStringSubmatch(name); m != nil {
+				orphan.Date, orphan.StartTime, orphan.Title = m[1], m[2]+":"+m[3], m[4]
+			}
+			report.Orphans = append(report.Orphans, orphan)
+		}
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		if report.Orphans[i].Root != report.Orphans[j].Root {
+			return report.Orphans[i].Root < report.Orphans[j].Root
+		}
+		return report.Orphans[i].Name < report.Orphans[j].Name
+	})
+	return report, nil
+}
+
+// runReconcile is the periodic job: it only logs what it found.
+func (a *App) runReconcile(ctx context.Context) {
+	report, err := a.reconcileStorage(ctx)
+	if err != nil {
+		slog.Error("Error reconciling storage", "err", err)
+		return
+	}
+	if n := len(report.Orphans); n > 0 {
+		slog.Info("Reconcile: media files have no recording; import them with POST /api/storage/import", "count", n)
+	}
+}
+
+// reconcileStorageHandler runs reconciliation now and returns the report.
+func (a *App) reconcileStorageHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := a.reconcileStorage(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report) //nolint: errcheck
+}
+
+// ImportRequest adopts an orphan file as a completed recording. Date,
+// StartTime and Title default to the values parsed from a file name in the
+// default form; Duration is in minutes.
+type ImportRequest struct {
+	Root      string  `json:"root,omitempty"`
+	Name      string  `json:"name"`
+	ChannelID string  `json:"channelId"`
+	Date      string  `json:"date,omitempty"`
+	StartTime string  `json:"startTime,omitempty"`
+	Title     *string `json:"title,omitempty"`
+	Duration  int     `json:"duration"`
+}
+
+// importRecording creates a completed recording for an orphan file.
+func (a *App) importRecording(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeError := func(code int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint: errcheck
+	}
+
+	if !storage.ValidName(req.Name) {
+		writeError(http.StatusBadRequest, "name must be a path inside the storage directory")
+		return
+	}
+	if !isMediaFile(req.Name) {
+		writeError(http.StatusBadRequest, "name must be a .ts or .mp4 file")
+		return
+	}
+	if m := recordingFileRe.FindStringSubmatch(path.Base(req.Name)); m != nil {
+		if req.Date == "" {
+			req.Date = m[1]
+		}
+		if req.StartTime == "" {
+			req.StartTime = m[2] + ":" + m[3]
+		}
+		if req.Title == nil {
+			req.Title = &m[4]
+		}
+	}
+	if _, err := time.Parse("2006-01-02 15:04", req.Date+" "+req.StartTime); err != nil {
+		writeError(http.StatusBadRequest, "date and startTime are required when the name does not contain them")
+		return
+	}
+	if req.Duration < 0 {
+		writeError(http.StatusBadRequest, "duration must not be negative")
+		return
+	}
+	if req.Root == "" {
+		req.Root = a.cfg().StorageDir
+	}
+	var root *storageRoot
+	for _, sr := range a.storageRoots() {
+		if sr.dir == req.Root {
+			root = &sr
+			break
+		}
+	}
+	if root == nil {
+		writeError(http.StatusBadRequest, "root is not a configured storage directory")
+		return
+	}
+	info, err := root.store.Stat(req.Name)
+	if err != nil {
+		writeError(http.StatusNotFound, "File not found")
+		return
+	}
+
+	ctx := r.Context()
+	var exists bool
+	if err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM channels WHERE guide_number = ?)", req.ChannelID).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		writeError(http.StatusNotFound, "Channel not found")
+		return
+	}
+	if err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recordings WHERE channel_id = ? AND date = ? AND start_time = ?)",
+		req.ChannelID, req.Date, req.StartTime).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		writeError(http.StatusConflict, "Recording already exists for this channel and time")
+		return
+	}
+
+	tx, err := a.store.BeginTx(ctx, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback() //nolint: errcheck
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO recordings (channel_id, date, start_time, title, duration, status, file_size)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?)`,
+		req.ChannelID, req.Date, req.StartTime, req.Title, req.Duration, info.Size())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertStatusEvent(ctx, tx, id, "", statusCompleted, "imported"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO recording_storage (recording_id, root) VALUES (?, ?)", id, root.dir); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ts := strings.TrimSuffix(req.Name, path.Ext(req.Name)) + ".ts"
+	if _, err := tx.ExecContext(ctx, "INSERT INTO recording_files (recording_id, path) VALUES (?, ?)", id, ts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Imported file as recording", "recording_id", id, "name", req.Name, "dir", root.dir)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int64{"id": id}) //nolint: errcheck
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestReconcileStorage(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	if _, err := db.Exec(`INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES
+		(1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'Present'),
+		(2, '5.1', '2026-03-02', '20:00', 60, 'completed', 'Gone'),
+		(3, '5.1', '2026-03-03', '20:00', 60, 'missing', 'Back'),
+		(4, '5.1', '2026-03-04', '20:00', 60, 'recording', 'Live')`); err != nil {
+		t.Fatal(err)
+	}
+	mem.WriteFile("2026-03-01-20:00-Present.mp4", []byte("a"))
+	mem.WriteFile("2026-03-03-20:00-Back.mp4", []byte("b"))
+	mem.WriteFile("2026-03-04-20:00-Live.ts", []byte("c"))
+	mem.WriteFile("2026-02-01-21:30-Copied In.mp4", []byte("orphan"))
+	mem.WriteFile("notes.txt", []byte("not media"))
+	mem.WriteFile("2026-03-01-20:00-Present.repair.mp4", []byte("tmp"))
+
+	report, err := app.reconcileStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != 2 {
+		t.Errorf("missing = %v, want [2]", report.Missing)
+	}
+	if len(report.Restored) != 1 || report.Restored[0] != 3 {
+		t.Errorf("restored = %v, want [3]", report.Restored)
+	}
+	if len(report.Orphans) != 1 {
+		t.Fatalf("orphans = %+v, want one", report.Orphans)
+	}
+	o := report.Orphans[0]
+	if o.Name != "2026-02-01-21:30-Copied In.mp4" || o.Date != "2026-02-01" || o.StartTime != "21:30" || o.Title != "Copied In" || o.Size != 6 {
+		t.Errorf("unexpected orphan %+v", o)
+	}
+
+	statuses := map[int]string{}
+	rows, err := db.Query("SELECT id, status FROM recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id int
+		var status string
+		rows.Scan(&id, &status) //nolint: errcheck
+		statuses[id] = status
+	}
+	rows.Close() //nolint: errcheck
+	if statuses[2] != statusMissing || statuses[3] != "completed" || statuses[4] != "recording" {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+}
+
+func TestImportRecording(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	mem.WriteFile("2026-02-01-21:30-Copied In.mp4", []byte("orphan"))
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/storage/import", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.importRecording(rr, req)
+		return rr
+	}
+
+	if rr := post(`{"name": "random.mp4", "channelId": "5.1"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("unparseable name: got %d", rr.Code)
+	}
+	if rr := post(`{"name": "../2026-02-01-21:30-Elsewhere.ts", "channelId": "5.1"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("name outside the root: got %d", rr.Code)
+	}
+	if rr := post(`{"name": "2026-02-01-21:30-Copied In.mp4", "channelId": "9.9"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown channel: got %d", rr.Code)
+	}
+	if rr := post(`{"name": "2026-02-01-21:30-Copied In.mp4", "channelId": "5.1", "duration": 30}`); rr.Code != http.StatusCreated {
+		t.Fatalf("import: got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"name": "2026-02-01-21:30-Copied In.mp4", "channelId": "5.1", "duration": 30}`); rr.Code != http.StatusConflict {
+		t.Errorf("second import: got %d", rr.Code)
+	}
+
+	report, err := app.reconcileStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 0 || len(report.Missing) != 0 {
+		t.Errorf("imported file still reported: %+v", report)
+	}
+	var status string
+	var size int64
+	db.QueryRow("SELECT status, file_size FROM recordings WHERE title = 'Copied In'").Scan(&status, &size) //nolint: errcheck
+	if status != "completed" || size != 6 {
+		t.Errorf("imported recording has status %q, size %d", status, size)
+	}
+}
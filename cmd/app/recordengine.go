@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// The record engine speaks the HTTP API of SiliconDust's HDHomeRun RECORD
+// under /record, so the HDHomeRun apps list this DVR's finished recordings
+// as their own: recorded_files.json lists the series, and each series'
+// episodes, with URLs to play and delete them.
+
+// recordEnginePrefix is where the record engine is served.
+const recordEnginePrefix = "/record"
+
+// recordEngineRoutes are the routes of the record engine.
+var recordEngineRoutes = []string{
+	recordEnginePrefix + "/discover.json",
+	recordEnginePrefix + "/recorded_files.json",
+	recordEnginePrefix + "/recorded/play",
+	recordEnginePrefix + "/recorded/image",
+	recordEnginePrefix + "/recorded/cmd",
+}
+
+// RecordEngineDevice is the record engine's discover.json.
+type RecordEngineDevice struct {
+	FriendlyName string
+	Version      string
+	BaseURL      string
+	StorageID    string
+	StorageURL   string
+	TotalSpace   int64 `json:",omitempty"`
+	FreeSpace    int64 `json:",omitempty"`
+}
+
+// RecordedSeries is one series in recorded_files.json. Recordings are
+// grouped into series by title.
+type RecordedSeries struct {
+	SeriesID    string
+	Title       string
+	Category    string
+	ImageURL    string
+	StartTime   int64
+	EpisodesURL string
+	UpdateID    int
+}
+
+// RecordedEpisode is one recording in a series' recorded_files.json.
+// Times are Unix seconds; RecordStartTime and RecordEndTime include the
+// padding.
+type RecordedEpisode struct {
+	SeriesID        string
+	Title           string
+	EpisodeTitle    string `json:",omitempty"`
+	EpisodeNumber   string `json:",omitempty"`
+	Synopsis        string `json:",omitempty"`
+	Category        string
+	ChannelName     string
+	ChannelNumber   string
+	ProgramID       string `json:",omitempty"`
+	OriginalAirdate int64  `json:",omitempty"`
+	StartTime       int64
+	EndTime         int64
+	RecordStartTime int64
+	RecordEndTime   int64
+	RecordSuccess   int
+	Filename        string
+	ImageURL        string
+	PlayURL         string
+	CmdURL          string
+
+	id       int
+	category string
+	size     int64
+}
+
+// recordEngine returns the record engine settings, answering 404 when the
+// record engine is off.
+func (a *App) recordEngine(w http.ResponseWriter, r *http.Request) *pkgcfg.RecordEngine {
+	e := a.cfg().RecordEngine
+	if e == nil {
+		http.NotFound(w, r)
+	}
+	return e
+}
+
+// recordEngineBaseURL returns the record engine's address as r reached it.
+func (a *App) recordEngineBaseURL(r *http.Request, e *pkgcfg.RecordEngine) string {
+	if e.BaseURL != "" {
+		return e.BaseURL
+	}
+	return a.deviceBaseURL(r, "") + recordEnginePrefix
+}
+
+// seriesID returns the series ID the record engine gives title.
+func seriesID(title string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(title))) //nolint: errcheck
+	return fmt.Sprintf("D%08X", h.Sum32())
+}
+
+// recordEngineCategory maps a guide category onto the record engine's
+// series, movie, sport and news.
+func recordEngineCategory(category string) string {
+	c := strings.ToLower(category)
+	for _, k := range []string{"movie", "sport", "news"} {
+		if strings.Contains(c, k) {
+			return k
+		}
+	}
+	return "series"
+}
+
+// recordedEpisodes returns the finished recordings the record engine
+// lists, newest first, leaving out restricted ones unless r unlocks them.
+func (a *App) recordedEpisodes(ctx context.Context, r *http.Request, base string) ([]RecordedEpisode, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.status, COALESCE(r.title, ''),
+		       COALESCE(c.guide_name, ''), COALESCE(m.title, ''), COALESCE(m.subtitle, ''), COALESCE(m.description, ''),
+		       COALESCE(m.category, ''), COALESCE(m.season, 0), COALESCE(m.episode, 0), COALESCE(m.original_air_date, ''),
+		       COALESCE(l.program_id, ''), f.path, COALESCE(r.file_size, 0)
+		FROM recordings r
+		JOIN recording_files f ON f.recording_id = r.id
+		LEFT JOIN channels c ON c.guide_number = r.channel_id
+		LEFT JOIN recording_metadata m ON m.recording_id = r.id
+		LEFT JOIN program_links l ON l.recording_id = r.id
+		WHERE r.status IN ('completed', 'partial', 'archived')
+		ORDER BY r.date DESC, r.start_time DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	loc, _ := a.getLocalLocation()
+	before, after := a.padding()
+	parental := a.cfg().Parental
+	hideRestricted := parental != nil && !a.parentalUnlocked(r, parental)
+	episodes := []RecordedEpisode{}
+	for rows.Next() {
+		var e RecordedEpisode
+		var date, startTime, status, title, showTitle, airDate, file string
+		var duration, season, episode int
+		if err := rows.Scan(&e.id, &e.ChannelNumber, &date, &startTime, &duration, &status, &title,
+			&e.ChannelName, &showTitle, &e.EpisodeTitle, &e.Synopsis, &e.category, &season, &episode, &airDate,
+			&e.ProgramID, &file, &e.size); err != nil {
+			return nil, err
+		}
+		if hideRestricted && recordingRestricted(parental, e.ChannelNumber, e.category) {
+			continue
+		}
+		e.Title = showTitle
+		if e.Title == "" {
+			e.Title = title
+		}
+		if e.Title == "" {
+			e.Title = e.ChannelName
+		}
+		e.SeriesID = seriesID(e.Title)
+		e.Category = recordEngineCategory(e.category)
+		if season > 0 && episode > 0 {
+			e.EpisodeNumber = fmt.Sprintf("S%02dE%02d", season, episode)
+		}
+		if t, err := time.ParseInLocation("2006-01-02", airDate, loc); err == nil {
+			e.OriginalAirdate = t.Unix()
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+startTime, loc)
+		if err != nil {
+			continue
+		}
+		end := start.Add(time.Duration(duration) * time.Minute)
+		e.StartTime, e.EndTime = start.Unix(), end.Unix()
+		e.RecordStartTime = start.Add(-time.Duration(before) * time.Second).Unix()
+		e.RecordEndTime = end.Add(time.Duration(after) * time.Minute).Unix()
+		if status != statusPartial {
+			e.RecordSuccess = 1
+		}
+		e.Filename = path.Base(file)
+		id := strconv.Itoa(e.id)
+		e.ImageURL = base + "/recorded/image?id=" + id
+		e.PlayURL = base + "/recorded/play?id=" + id
+		e.CmdURL = base + "/recorded/cmd?id=" + id
+		episodes = append(episodes, e)
+	}
+	return episodes, rows.Err()
+}
+
+// serveRecordEngineDiscover serves GET /record/discover.json.
+func (a *App) serveRecordEngineDiscover(w http.ResponseWriter, r *http.Request) {
+	e := a.recordEngine(w, r)
+	if e == nil {
+		return
+	}
+	base := a.recordEngineBaseURL(r, e)
+	dev := RecordEngineDevice{
+		FriendlyName: e.FriendlyName,
+		Version:      "20200225",
+		BaseURL:      base,
+		StorageID:    e.StorageID,
+		StorageURL:   base + "/recorded_files.json",
+	}
+	if sr, ok := a.storage.(storage.SpaceReporter); ok {
+		dev.TotalSpace, _ = sr.TotalSpace()
+		dev.FreeSpace, _ = sr.FreeSpace()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dev) //nolint: errcheck
+}
+
+// serveRecordedFiles serves GET /record/recorded_files.json: the series,
+// newest first, or with ?SeriesID= that series' episodes.
+func (a *App) serveRecordedFiles(w http.ResponseWriter, r *http.Request) {
+	e := a.recordEngine(w, r)
+	if e == nil {
+		return
+	}
+	base := a.recordEngineBaseURL(r, e)
+	episodes, err := a.recordedEpisodes(r.Context(), r, base)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if id := r.URL.Query().Get("SeriesID"); id != "" {
+		episodes = slices.DeleteFunc(episodes, func(e RecordedEpisode) bool { return e.SeriesID != id })
+		json.NewEncoder(w).Encode(episodes) //nolint: errcheck
+		return
+	}
+	// Episodes come newest first, so each series takes its image and
+	// start time from its latest episode.
+	series := []RecordedSeries{}
+	index := map[string]int{}
+	for _, ep := range episodes {
+		i, ok := index[ep.SeriesID]
+		if !ok {
+			index[ep.SeriesID] = len(series)
+			series = append(series, RecordedSeries{
+				SeriesID:    ep.SeriesID,
+				Title:       ep.Title,
+				Category:    ep.Category,
+				ImageURL:    ep.ImageURL,
+				StartTime:   ep.StartTime,
+				EpisodesURL: base + "/recorded_files.json?SeriesID=" + ep.SeriesID,
+			})
+			i = len(series) - 1
+		}
+		series[i].UpdateID = max(series[i].UpdateID, ep.id)
+	}
+	json.NewEncoder(w).Encode(series) //nolint: errcheck
+}
+
+// withRecordingID passes the id query parameter of r on as the {id} route
+// variable, for handlers shared with the API.
+func withRecordingID(r *http.Request) *http.Request {
+	return mux.SetURLVars(r, map[string]string{"id": r.URL.Query().Get("id")})
+}
+
+// serveRecordedPlay serves GET /record/recorded/play?id=, the recording
+// file as the API serves it.
+func (a *App) serveRecordedPlay(w http.ResponseWriter, r *http.Request) {
+	if a.recordEngine(w, r) == nil {
+		return
+	}
+	a.getRecordingFile(w, withRecordingID(r))
+}
+
+// serveRecordedImage serves GET /record/recorded/image?id=, the
+// recording's poster.
+func (a *App) serveRecordedImage(w http.ResponseWriter, r *http.Request) {
+	if a.recordEngine(w, r) == nil {
+		return
+	}
+	a.getRecordingPoster(w, withRecordingID(r))
+}
+
+// serveRecordedCmd serves POST /record/recorded/cmd?id=&cmd=delete, which
+// deletes a finished recording with its files, as retention does. The
+// apps' other commands are refused.
+func (a *App) serveRecordedCmd(w http.ResponseWriter, r *http.Request) {
+	if a.recordEngine(w, r) == nil {
+		return
+	}
+	ctx := r.Context()
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	if cmd := r.URL.Query().Get("cmd"); cmd != "delete" {
+		http.Error(w, "Unsupported command "+strconv.Quote(cmd), http.StatusBadRequest)
+		return
+	}
+	rec := types.Recording{ID: id}
+	err = a.dbQueryRowContext(ctx, `
+		SELECT r.status, COALESCE(f.path, '') FROM recordings r
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		WHERE r.id = ?`, id).Scan(&rec.Status, &rec.FileName)
+	if err != nil || (rec.Status != statusCompleted && rec.Status != statusPartial && rec.Status != statusArchived) {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	if rec.FileName != "" {
+		if err := a.removeRecordingFiles(ctx, rec); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := a.purgeRecording(ctx, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Recording deleted from an HDHomeRun app", "recording_id", id)
+	a.events.publish(eventRecordingDeleted, map[string]interface{}{"id": id})
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestRecordEngine(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	mem := storage.NewMemory()
+	app.storage = mem
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'Nova')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '5.1', '2026-03-08', '20:00', 60, 'partial', 'Nova')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (3, '5.1', '2026-03-02', '18:00', 30, 'completed', 'News')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (4, '5.1', '2099-03-02', '18:00', 30, 'pending', 'Later')",
+		"INSERT INTO recording_metadata (recording_id, title, subtitle, category, season, episode, original_air_date) VALUES (2, 'NOVA', 'Black Holes', 'Science', 51, 3, '2026-02-01')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'nova-1.ts'), (2, 'nova-2.ts'), (3, 'news.ts')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem.WriteFile("nova-1.ts", []byte("0123456789"))
+	mem.WriteFile("news.ts", []byte("news"))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/record/discover.json", app.serveRecordEngineDiscover).Methods("GET")
+	r.HandleFunc("/record/recorded_files.json", app.serveRecordedFiles).Methods("GET")
+	r.HandleFunc("/record/recorded/play", app.serveRecordedPlay).Methods("GET", "HEAD")
+	r.HandleFunc("/record/recorded/cmd", app.serveRecordedCmd).Methods("POST")
+	call := func(method, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Host = "dvr.lan:8080"
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := call("GET", "/record/recorded_files.json"); rr.Code != http.StatusNotFound {
+		t.Errorf("recorded_files.json with the record engine off: %d", rr.Code)
+	}
+
+	app.config.RecordEngine = &pkgcfg.RecordEngine{StorageID: "ABC", FriendlyName: "hdhr-dvr"}
+	var dev RecordEngineDevice
+	if err := json.NewDecoder(call("GET", "/record/discover.json").Body).Decode(&dev); err != nil {
+		t.Fatal(err)
+	}
+	if dev.BaseURL != "http://dvr.lan:8080/record" || dev.StorageURL != "http://dvr.lan:8080/record/recorded_files.json" || dev.StorageID != "ABC" {
+		t.Errorf("discover.json %+v", dev)
+	}
+
+	// Metadata titles group case-insensitively with recording titles.
+	var series []RecordedSeries
+	if err := json.NewDecoder(call("GET", "/record/recorded_files.json").Body).Decode(&series); err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 || series[0].Title != "NOVA" || series[0].UpdateID != 2 || series[1].Title != "News" ||
+		series[0].EpisodesURL != "http://dvr.lan:8080/record/recorded_files.json?SeriesID="+seriesID("Nova") {
+		t.Fatalf("series %+v", series)
+	}
+
+	var episodes []RecordedEpisode
+	if err := json.NewDecoder(call("GET", "/record/recorded_files.json?SeriesID="+series[0].SeriesID).Body).Decode(&episodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(episodes) != 2 {
+		t.Fatalf("episodes %+v", episodes)
+	}
+	if e := episodes[0]; e.EpisodeNumber != "S51E03" || e.EpisodeTitle != "Black Holes" || e.RecordSuccess != 0 ||
+		e.EndTime-e.StartTime != 3600 || e.RecordStartTime != e.StartTime-30 || e.OriginalAirdate == 0 {
+		t.Errorf("partial episode %+v", e)
+	}
+	if e := episodes[1]; e.RecordSuccess != 1 || e.Filename != "nova-1.ts" || e.PlayURL != "http://dvr.lan:8080/record/recorded/play?id=1" {
+		t.Errorf("completed episode %+v", e)
+	}
+
+	if rr := call("GET", "/record/recorded/play?id=1"); rr.Code != http.StatusOK || rr.Body.String() != "0123456789" {
+		t.Errorf("play %d %q", rr.Code, rr.Body)
+	}
+	if rr := call("POST", "/record/recorded/cmd?id=1&cmd=set&Resume=60"); rr.Code != http.StatusBadRequest {
+		t.Errorf("unsupported command: %d", rr.Code)
+	}
+	if rr := call("POST", "/record/recorded/cmd?id=4&cmd=delete"); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted a scheduled recording: %d", rr.Code)
+	}
+	if rr := call("POST", "/record/recorded/cmd?id=3&cmd=delete&rerecord=0"); rr.Code != http.StatusOK {
+		t.Fatalf("delete %d %s", rr.Code, rr.Body)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM recordings WHERE id = 3").Scan(&n) //nolint: errcheck
+	if n != 0 {
+		t.Error("recording not deleted")
+	}
+	if f, err := mem.Open("news.ts"); err == nil {
+		f.Close() //nolint: errcheck
+		t.Error("file of deleted recording left behind")
+	}
+	if err := json.NewDecoder(call("GET", "/record/recorded_files.json").Body).Decode(&series); err != nil || len(series) != 1 {
+		t.Errorf("series after delete %+v, %v", series, err)
+	}
+
+	// Allowlisted apps delete without a key.
+	app.config.Auth = pkgcfg.Auth{Enabled: true}
+	app.config.RecordEngine.Allowlist = []string{"192.168.1.0/24"}
+	r.Use(app.requireAuth)
+	for i, tc := range []struct {
+		remote string
+		want   int
+	}{{"192.0.2.1:1", http.StatusUnauthorized}, {"192.168.1.20:1", http.StatusOK}} {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/record/recorded/cmd?id=%d&cmd=delete", 1+i), nil)
+		req.RemoteAddr = tc.remote
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("delete from %s: %d, want %d", tc.remote, rr.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// restartOnlySettings are the config fields read once at startup. A reload
+// that changes them keeps the running values and reports them.
+var restartOnlySettings = map[string]bool{
+	"listenAddr": true, "port": true, "tls": true, "basePath": true, "dbPath": true, "dbDriver": true, "dbDSN": true,
+	"storageDir": true, "storageDirs": true, "guideFile": true, "timezone": true, "ffmpegPath": true, "ffprobePath": true, "logFormat": true, "debugAddr": true,
+	"readTimeoutSeconds": true, "writeTimeoutSeconds": true, "idleTimeoutSeconds": true,
+	"mqtt": true, "telegram": true, "transcode": true, "metadata": true,
+}
+
+// ReloadResult lists the settings a reload changed and those that only
+// take effect after a restart.
+type ReloadResult struct {
+	Changed         []string `json:"changed"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+// cfg returns the configuration in force. It is replaced as a whole on
+// reload, so callers needing several fields should hold on to one result.
+func (a *App) cfg() *pkgcfg.Config {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config
+}
+
+// currentNotifiers returns the notification providers in force.
+func (a *App) currentNotifiers() []notifierEntry {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.notifiers
+}
+
+// configField returns the name of a Config field as written in config.json.
+func configField(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// applyConfig makes next the configuration in force, except for the
+// restart-only settings, which keep their running values.
+func (a *App) applyConfig(next *pkgcfg.Config) ReloadResult {
+	res := ReloadResult{Changed: []string{}, RestartRequired: []string{}}
+	prev := a.cfg()
+	pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < pv.NumField(); i++ {
+		if reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		name := configField(pv.Type().Field(i))
+		if restartOnlySettings[name] {
+			nv.Field(i).Set(pv.Field(i))
+			res.RestartRequired = append(res.RestartRequired, name)
+			continue
+		}
+		res.Changed = append(res.Changed, name)
+	}
+
+	notifiers := append(newNotifiers(next.Notifications), a.fixedNotifiers...)
+	a.configMu.Lock()
+	a.config = next
+	a.notifiers = notifiers
+	a.configMu.Unlock()
+
+	if next.LogLevel != prev.LogLevel {
+		if l, err := parseLogLevel(next.LogLevel); err == nil {
+			setLogLevel(l, 0)
+		} else {
+			slog.Error("Invalid log level in reloaded config, keeping the current one", "err", err)
+		}
+	}
+	return res
+}
+
+// reloadConfig reads the config file again and applies it with the
+// settings saved through the API. A config that fails to load leaves the
+// running one in place.
+func (a *App) reloadConfig() (ReloadResult, error) {
+	next, err := pkgcfg.LoadConfig()
+	if err == nil {
+		err = applyStoredSettings(context.Background(), a.store, next)
+	}
+	if err != nil {
+		slog.Error("Error reloading config, keeping the current one", "err", err)
+		return ReloadResult{}, err
+	}
+	res := a.applyConfig(next)
+	slog.Info("Config reloaded", "changed", res.Changed)
+	if len(res.RestartRequired) > 0 {
+		slog.Warn("Some changed settings take effect only after a restart", "settings", res.RestartRequired)
+	}
+	return res, nil
+}
+
+// reloadConfigHandler reloads the config file like SIGHUP and reports
+// what changed.
+func (a *App) reloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := a.reloadConfig()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) //nolint: errcheck
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res) //nolint: errcheck
+}
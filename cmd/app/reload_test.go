@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestApplyConfig(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.fixedNotifiers = []notifierEntry{{notifier: &ntfyNotifier{}}}
+
+	next := *app.cfg()
+	next.Port = 9090
+	next.StorageDir = "/elsewhere"
+	next.Retention = pkgcfg.Retention{MaxAgeDays: 30}
+	next.Notifications.Ntfy = &pkgcfg.Ntfy{Topic: "dvr"}
+
+	res := app.applyConfig(&next)
+	if !reflect.DeepEqual(res.Changed, []string{"notifications", "retention"}) ||
+		!reflect.DeepEqual(res.RestartRequired, []string{"storageDir", "port"}) {
+		t.Errorf("got %+v", res)
+	}
+	cfg := app.cfg()
+	if cfg.Retention.MaxAgeDays != 30 || cfg.StorageDir != "/tmp/dvr_test" || cfg.Port != 0 {
+		t.Errorf("config in force %+v", cfg)
+	}
+	// The ntfy provider from the file plus the one started outside it.
+	if n := len(app.currentNotifiers()); n != 2 {
+		t.Errorf("%d notifiers", n)
+	}
+}
+
+func TestReloadConfigHandler(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("DVR_CONFIG", path)
+	if err := os.WriteFile(path, []byte(`{"storageDir": "/tmp/dvr_test", "timezone": "UTC", "retention": {"maxTotalGB": 100}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	app.reloadConfigHandler(rr, httptest.NewRequest("POST", "/api/admin/reload", nil))
+	var res ReloadResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if app.cfg().Retention.MaxTotalGB != 100 {
+		t.Errorf("retention not reloaded: %+v", res)
+	}
+
+	// A broken file leaves the running config alone.
+	if err := os.WriteFile(path, []byte(`{"storageDir": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	app.reloadConfigHandler(rr, httptest.NewRequest("POST", "/api/admin/reload", nil))
+	if rr.Code != http.StatusBadRequest || app.cfg().Retention.MaxTotalGB != 100 {
+		t.Errorf("got %d, retention %v", rr.Code, app.cfg().Retention)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// RestoreResult is the response of POST /api/admin/restore.
+type RestoreResult struct {
+	Restored string `json:"restored"`
+	// SafetyBackup is the backup of the database as it was before the
+	// restore, for undoing it.
+	SafetyBackup string           `json:"safetyBackup"`
+	Reconcile    *ReconcileReport `json:"reconcile,omitempty"`
+}
+
+var (
+	errBackupNotFound    = errors.New("no such backup")
+	errInvalidBackup     = errors.New("invalid backup")
+	errRestoreBusy       = errors.New("a restore is already running")
+	errRecordingsRunning = errors.New("recordings are in progress; restore once they finish")
+)
+
+// validateBackup checks that path is an intact SQLite database holding the
+// DVR's tables before it is restored.
+func validateBackup(path string) error {
+	db, err := sql.Open(driverSQLite, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint: errcheck
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("%w: not a readable SQLite database: %v", errInvalidBackup, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check failed: %s", errInvalidBackup, result)
+	}
+	for _, table := range []string{"channels", "recordings", "keywords"} {
+		if _, err := db.Exec("SELECT 1 FROM " + table + " LIMIT 1"); err != nil {
+			return fmt.Errorf("%w: not a DVR database: %v", errInvalidBackup, err)
+		}
+	}
+	return nil
+}
+
+// copyDatabase replaces the contents of the database db is open on with
+// those of the SQLite file src, through SQLite's online backup API. Other
+// connections wait on the database lock while the pages are copied and
+// then see the restored data; none need reopening.
+func copyDatabase(ctx context.Context, db *sql.DB, src string) error {
+	srcDB, err := sql.Open(driverSQLite, "file:"+src+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close() //nolint: errcheck
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close() //nolint: errcheck
+	destConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close() //nolint: errcheck
+
+	return destConn.Raw(func(dest interface{}) error {
+		return srcConn.Raw(func(src interface{}) error {
+			d, ok1 := dest.(*sqlite3.SQLiteConn)
+			s, ok2 := src.(*sqlite3.SQLiteConn)
+			if !ok1 || !ok2 {
+				return errors.New("restore needs SQLite connections")
+			}
+			b, err := d.Backup("main", s, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish() //nolint: errcheck
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// restoreBackup swaps the backup name from the backup directory in for the
+// database. The scheduler is paused throughout and recordings in progress
+// refuse the restore, as their rows would be replaced under them. The
+// database is backed up first, so a restore can itself be undone, and the
+// restored recordings are reconciled against the files on disk after.
+func (a *App) restoreBackup(ctx context.Context, name string, now time.Time) (*RestoreResult, error) {
+	if a.cfg().DBDriver == driverPostgres {
+		return nil, errBackupUnsupported
+	}
+	dir := a.cfg().Backup.Dir
+	backups, err := listBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, b := range backups {
+		found = found || b.Name == name
+	}
+	if !found {
+		return nil, errBackupNotFound
+	}
+	path := filepath.Join(dir, name)
+	if err := validateBackup(path); err != nil {
+		return nil, err
+	}
+
+	if !atomic.CompareAndSwapInt32(&a.restoring, 0, 1) {
+		return nil, errRestoreBusy
+	}
+	restored := false
+	defer func() {
+		atomic.StoreInt32(&a.restoring, 0)
+		if restored {
+			// Have the scheduler arm the restored recordings now.
+			select {
+			case recordingCh <- types.Recording{}:
+			default:
+			}
+		}
+	}()
+	running := false
+	a.runningProcesses.Range(func(_, _ interface{}) bool {
+		running = true
+		return false
+	})
+	if running {
+		return nil, errRecordingsRunning
+	}
+
+	// Not pruned: that could remove the backup being restored.
+	safety, err := a.writeBackup(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("backing up the current database: %w", err)
+	}
+	if err := copyDatabase(ctx, a.sqlDB, path); err != nil {
+		return nil, err
+	}
+	restored = true
+	// Timers armed for the replaced database would keep the scheduler from
+	// arming restored recordings with the same IDs.
+	recordingTimers.Range(func(id, _ interface{}) bool {
+		recordingTimers.Delete(id)
+		return true
+	})
+	slog.Info("Database restored", "backup", name, "safety_backup", safety.Name)
+
+	// The backup may predate tables added since.
+	a.createTables()
+	a.loadEnabledChannels()
+	a.storeLegacyFileNames(ctx)
+	report, err := a.reconcileStorage(ctx)
+	if err != nil {
+		slog.Error("Error reconciling storage after restore", "err", err)
+	}
+	return &RestoreResult{Restored: name, SafetyBackup: safety.Name, Reconcile: report}, nil
+}
+
+// RestoreRequest is the body of POST /api/admin/restore.
+type RestoreRequest struct {
+	Name string `json:"name"`
+}
+
+// postRestore serves POST /api/admin/restore with {"name": "..."}, the
+// name of a backup listed by GET /api/admin/backups.
+func (a *App) postRestore(w http.ResponseWriter, r *http.Request) {
+	noWriteTimeout(w)
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	res, err := a.restoreBackup(r.Context(), req.Name, time.Now())
+	status := http.StatusOK
+	switch {
+	case err == nil:
+	case errors.Is(err, errBackupNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errBackupUnsupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, errRestoreBusy), errors.Is(err, errRecordingsRunning), errors.Is(err, errBackupExists):
+		status = http.StatusConflict
+	case errors.Is(err, errInvalidBackup):
+		status = http.StatusUnprocessableEntity
+	default:
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err != nil {
+		requestLogger(r).Error("Database restore failed", "backup", req.Name, "err", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) //nolint: errcheck
+		return
+	}
+	json.NewEncoder(w).Encode(res) //nolint: errcheck
+}
+
+// runRestoreCommand handles "app restore FILE": it validates FILE and
+// copies it over the database before the server starts.
+func runRestoreCommand(db *sql.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: app restore BACKUP_FILE")
+	}
+	if err := validateBackup(args[0]); err != nil {
+		return err
+	}
+	if err := copyDatabase(context.Background(), db, args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Restored %s\n", args[0]) //nolint: errcheck
+	return nil
+}
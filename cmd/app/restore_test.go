@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestRestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDB(filepath.Join(dir, "recordings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() //nolint: errcheck
+	cfg := &pkgcfg.Config{StorageDir: dir, Timezone: "UTC", Backup: pkgcfg.Backup{Dir: filepath.Join(dir, "backups"), Keep: 7}}
+	app := NewApp(cfg, types.NewStoreAdapter(db), &MockCommander{})
+	app.sqlDB = db
+	app.createTables()
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending', 'Before')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backup, err := app.backupDatabase(ctx, time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE recordings SET title = 'After' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Backup.Dir, "recordings-20260102-030000.db"), []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/admin/restore", app.postRestore).Methods("POST")
+	restore := func(name string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/admin/restore", strings.NewReader(`{"name": "`+name+`"}`)))
+		return rr
+	}
+	for name, want := range map[string]int{
+		"recordings-20260102-030000.db": http.StatusUnprocessableEntity,
+		"../recordings.db":              http.StatusNotFound,
+		"recordings-20990101-000000.db": http.StatusNotFound,
+	} {
+		if rr := restore(name); rr.Code != want {
+			t.Errorf("restore %s: got %d, want %d", name, rr.Code, want)
+		}
+	}
+
+	app.runningProcesses.Store(9, nil)
+	if rr := restore(backup.Name); rr.Code != http.StatusConflict {
+		t.Errorf("restore during a recording: %d", rr.Code)
+	}
+	app.runningProcesses.Delete(9)
+
+	// A timer armed for the replaced database's recording 1.
+	recordingTimers.Store(1, &recordingTimer{})
+	defer recordingTimers.Delete(1)
+	rr := restore(backup.Name)
+	var res RestoreResult
+	json.NewDecoder(rr.Body).Decode(&res) //nolint: errcheck
+	if rr.Code != http.StatusOK || res.Restored != backup.Name || res.SafetyBackup == "" {
+		t.Fatalf("restore: %d %+v", rr.Code, res)
+	}
+	var title string
+	if err := db.QueryRow("SELECT title FROM recordings WHERE id = 1").Scan(&title); err != nil || title != "Before" {
+		t.Errorf("after restore: %q, %v", title, err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Backup.Dir, res.SafetyBackup)); err != nil {
+		t.Errorf("safety backup: %v", err)
+	}
+	if _, ok := recordingTimers.Load(1); ok {
+		t.Errorf("timer of the replaced database still armed")
+	}
+	select {
+	case <-recordingCh:
+	default:
+		t.Errorf("scheduler not woken after restore")
+	}
+}
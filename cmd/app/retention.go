@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// retentionCandidate is a completed recording the reaper may delete.
+type retentionCandidate struct {
+	rec      types.Recording
+	fileSize int64
+	priority int
+	start    time.Time
+}
+
+type retentionVictim struct {
+	retentionCandidate
+	reason string
+}
+
+// RetentionDeletion is an entry in the retention log.
+type RetentionDeletion struct {
+	RecordingID int     `json:"recordingId"`
+	ChannelID   string  `json:"channelId"`
+	Date        string  `json:"date"`
+	StartTime   string  `json:"startTime"`
+	Title       *string `json:"title,omitempty"`
+	FileSize    int64   `json:"fileSize"`
+	Reason      string  `json:"reason"`
+	DeletedAt   string  `json:"deletedAt"`
+}
+
+// selectRetentionVictims picks the recordings that policy says to delete.
+// Recordings older than MaxAgeDays go first, unless their priority is
+// positive; then, while the total size is over MaxTotalGB, recordings are
+// taken lowest priority first and oldest first within a priority.
+func selectRetentionVictims(cands []retentionCandidate, policy pkgcfg.Retention, now time.Time) []retentionVictim {
+	sorted := append([]retentionCandidate(nil), cands...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].priority != sorted[j].priority {
+			return sorted[i].priority < sorted[j].priority
+		}
+		return sorted[i].start.Before(sorted[j].start)
+	})
+
+	var victims []retentionVictim
+	var total int64
+	kept := sorted[:0:0]
+	cutoff := now.AddDate(0, 0, -policy.MaxAgeDays)
+	for _, c := range sorted {
+		if policy.MaxAgeDays > 0 && c.priority <= 0 && c.start.Before(cutoff) {
+			victims = append(victims, retentionVictim{c, fmt.Sprintf("older than %d days", policy.MaxAgeDays)})
+			continue
+		}
+		total += c.fileSize
+		kept = append(kept, c)
+	}
+
+	if policy.MaxTotalGB > 0 {
+		limit := int64(policy.MaxTotalGB * (1 << 30))
+		for _, c := range kept {
+			if total <= limit {
+				break
+			}
+			victims = append(victims, retentionVictim{c, fmt.Sprintf("over the %.1f GB quota", policy.MaxTotalGB)})
+			total -= c.fileSize
+		}
+	}
+	return victims
+}
+
+func (a *App) loadRetentionCandidates(ctx context.Context) ([]retentionCandidate, error) {
+	loc, err := a.getLocalLocation()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT r.id, r.channel_id, r.date, r.start_time, r.duration, r.title, r.file_size, COALESCE(p.priority, 0),
+		       COALESCE(f.path, ''), r.status
+		FROM recordings r
+		LEFT JOIN recording_priorities p ON p.recording_id = r.id
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		WHERE r.status IN ('completed', 'partial')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	var cands []retentionCandidate
+	for rows.Next() {
+		var c retentionCandidate
+		if err := rows.Scan(&c.rec.ID, &c.rec.ChannelID, &c.rec.Date, &c.rec.StartTime, &c.rec.Duration,
+			&c.rec.Title, &c.fileSize, &c.priority, &c.rec.FileName, &c.rec.Status); err != nil {
+			return nil, err
+		}
+		c.start, err = time.ParseInLocation("2006-01-02 15:04", c.rec.Date+" "+c.rec.StartTime, loc)
+		if err != nil {
+			slog.Error("Error parsing start time for recording, skipping retention", "recording_id", c.rec.ID, "err", err)
+			continue
+		}
+		cands = append(cands, c)
+	}
+	return cands, rows.Err()
+}
+
+// removeRecordingFiles deletes a recording's transport stream, converted
+// MP4 and the files derived from them, whichever exist, from the root it
+// was recorded to.
+func (a *App) removeRecordingFiles(ctx context.Context, rec types.Recording) error {
+	fs := a.recordingStorage(ctx, rec.ID)
+	ts := rec.GetFilePath()
+	names := append([]string{ts, mp4Name(ts), edlName(ts), posterName(ts)}, sidecarNames(mp4Name(ts))...)
+	outputs, err := a.transcodeOutputs(ctx, rec.ID)
+	if err != nil {
+		return err
+	}
+	for _, out := range outputs {
+		names = append(names, out.name)
+	}
+	for _, name := range names {
+		if err := fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// purgeRecording deletes a recording and the rows that refer to it.
+func (a *App) purgeRecording(ctx context.Context, id int) error {
+	tx, err := a.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+	for _, table := range []string{"recording_metadata", "playback_reports", "recording_repairs", "program_links", "recording_priorities", "recording_storage", "recording_archives", "recording_files", "post_processing", "recording_edl", "recording_commercials", "transcode_jobs", "recording_verifications", "recording_enrichment", "recording_filters", "watch_state", "recording_checksums", "recording_events"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE recording_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recordings WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyRetention deletes the completed recordings the retention policy no
+// longer has room for and records each deletion in retention_log.
+func (a *App) applyRetention(ctx context.Context, now time.Time) int {
+	policy := a.cfg().Retention
+	if policy.MaxTotalGB <= 0 && policy.MaxAgeDays <= 0 {
+		return 0
+	}
+
+	cands, err := a.loadRetentionCandidates(ctx)
+	if err != nil {
+		slog.Error("Error loading recordings for retention", "err", err)
+		return 0
+	}
+
+	deleted := 0
+	for _, v := range selectRetentionVictims(cands, policy, now) {
+		if err := a.removeRecordingFiles(ctx, v.rec); err != nil {
+			slog.Error("Retention: error deleting files of recording", "recording_id", v.rec.ID, "err", err)
+			continue
+		}
+		if err := a.purgeRecording(ctx, v.rec.ID); err != nil {
+			slog.Error("Retention: error deleting recording", "recording_id", v.rec.ID, "err", err)
+			continue
+		}
+		_, err := a.dbExecContext(ctx, `
+			INSERT INTO retention_log (recording_id, channel_id, date, start_time, title, file_size, reason)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			v.rec.ID, v.rec.ChannelID, v.rec.Date, v.rec.StartTime, v.rec.Title, v.fileSize, v.reason)
+		if err != nil {
+			slog.Error("Retention: error logging deletion of recording", "recording_id", v.rec.ID, "err", err)
+		}
+		slog.Info("Retention: deleted recording", "recording_id", v.rec.ID, "date", v.rec.Date, "start_time", v.rec.StartTime,
+			"bytes", v.fileSize, "reason", v.reason)
+		a.events.publish(eventRecordingDeleted, map[string]interface{}{"id": v.rec.ID, "reason": v.reason})
+		deleted++
+	}
+	return deleted
+}
+
+// getRetention returns the policy and the most recent deletions.
+func (a *App) getRetention(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.dbQueryContext(r.Context(), `
+		SELECT recording_id, channel_id, date, start_time, title, file_size, reason, deleted_at
+		FROM retention_log
+		ORDER BY id DESC
+		LIMIT 100`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+
+	deleted := []RetentionDeletion{}
+	for rows.Next() {
+		var d RetentionDeletion
+		if err := rows.Scan(&d.RecordingID, &d.ChannelID, &d.Date, &d.StartTime, &d.Title, &d.FileSize, &d.Reason, &d.DeletedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		deleted = append(deleted, d)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(r).Error("Error iterating retention log", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{ //nolint: errcheck
+		"policy":  a.cfg().Retention,
+		"deleted": deleted,
+	})
+}
+
+// PriorityRequest is the body of PUT /api/recordings/{id}/priority.
+type PriorityRequest struct {
+	Priority *int `json:"priority"`
+}
+
+// setRecordingPriority sets the retention priority of a recording. Higher
+// priorities are deleted last when over quota, and positive priorities are
+// exempt from the age limit.
+func (a *App) setRecordingPriority(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var req PriorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Priority == nil {
+		http.Error(w, "priority is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var exists bool
+	if err := a.dbQueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recordings WHERE id = ?)", id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	if _, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_priorities (recording_id, priority) VALUES (?, ?)", id, *req.Priority); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestSelectRetentionVictims(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	const gb = 1 << 30
+	cand := func(id int, daysAgo int, size int64, priority int) retentionCandidate {
+		return retentionCandidate{
+			rec:      types.Recording{ID: id},
+			fileSize: size,
+			priority: priority,
+			start:    now.AddDate(0, 0, -daysAgo),
+		}
+	}
+	cands := []retentionCandidate{
+		cand(1, 40, 2*gb, 0),
+		cand(2, 40, 2*gb, 1),
+		cand(3, 10, 3*gb, 0),
+		cand(4, 5, 3*gb, 0),
+		cand(5, 1, 3*gb, 2),
+	}
+
+	ids := func(victims []retentionVictim) []int {
+		var out []int
+		for _, v := range victims {
+			out = append(out, v.rec.ID)
+		}
+		return out
+	}
+
+	if got := ids(selectRetentionVictims(cands, pkgcfg.Retention{MaxAgeDays: 30}, now)); len(got) != 1 || got[0] != 1 {
+		t.Errorf("age only: got %v, want [1]", got)
+	}
+	// 13 GB total; the quota removes the lowest priority, oldest first.
+	if got := ids(selectRetentionVictims(cands, pkgcfg.Retention{MaxTotalGB: 8}, now)); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("quota only: got %v, want [1 3]", got)
+	}
+	// Age removes 1 (2 GB), leaving 11 GB; the quota then needs 3 and 4.
+	if got := ids(selectRetentionVictims(cands, pkgcfg.Retention{MaxAgeDays: 30, MaxTotalGB: 5}, now)); len(got) != 3 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("both: got %v, want [1 3 4]", got)
+	}
+	if got := selectRetentionVictims(cands, pkgcfg.Retention{}, now); len(got) != 0 {
+		t.Errorf("no policy: got %v", ids(got))
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	app.storage = mem
+	app.config.Retention = pkgcfg.Retention{MaxAgeDays: 30}
+
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	if _, err := db.Exec(`INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title, file_size) VALUES
+		(1, '5.1', '2026-01-02', '20:00', 60, 'completed', 'Old Show', 1000),
+		(2, '5.1', '2026-01-03', '20:00', 60, 'completed', 'Keeper', 1000),
+		(3, '5.1', '2026-03-30', '20:00', 60, 'completed', 'New Show', 1000),
+		(4, '5.1', '2026-01-01', '20:00', 60, 'failed', 'Failed Show', 0)`); err != nil {
+		t.Fatal(err)
+	}
+	const oldFile = "2026-01-02-20:00-Old Show.mp4"
+	mem.WriteFile(oldFile, []byte("video"))
+	if err := app.linkProgram(context.Background(), 1, "19571-1-abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/priority", app.setRecordingPriority).Methods("PUT")
+	r.HandleFunc("/api/retention", app.getRetention).Methods("GET")
+	req := httptest.NewRequest("PUT", "/api/recordings/2/priority", bytes.NewBufferString(`{"priority": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("set priority: expected 204, got %d", rr.Code)
+	}
+
+	if n := app.applyRetention(context.Background(), now); n != 1 {
+		t.Fatalf("deleted %d recordings, want 1", n)
+	}
+	if _, err := mem.Stat(oldFile); err == nil {
+		t.Error("expected the recording file to be deleted")
+	}
+	var remaining, links int
+	db.QueryRow("SELECT COUNT(*) FROM recordings").Scan(&remaining) //nolint: errcheck
+	db.QueryRow("SELECT COUNT(*) FROM program_links").Scan(&links)  //nolint: errcheck
+	if remaining != 3 || links != 0 {
+		t.Errorf("got %d recordings and %d program links after retention", remaining, links)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/retention", nil))
+	var resp struct {
+		Deleted []RetentionDeletion `json:"deleted"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Deleted) != 1 || resp.Deleted[0].RecordingID != 1 || resp.Deleted[0].FileSize != 1000 {
+		t.Errorf("unexpected retention log %+v", resp.Deleted)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// createSearchTable creates the full-text index over guide programs. FTS5 is
+// only compiled into go-sqlite3 with the sqlite_fts5 build tag, so fall back to
+// FTS4, which is always available; queries below use syntax common to both.
+// PostgreSQL keeps the programs in a plain table and matches them with
+// to_tsvector instead.
+func (a *App) createSearchTable() {
+	if a.cfg().DBDriver == driverPostgres {
+		_, err := a.store.ExecContext(context.Background(), `
+        CREATE TABLE IF NOT EXISTS guide_search (
+            title TEXT, subtitle TEXT, description TEXT,
+            channel TEXT, start TEXT, "end" TEXT, duration TEXT, category TEXT
+         )`)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	_, err := a.store.ExecContext(context.Background(), `
+        CREATE VIRTUAL TABLE IF NOT EXISTS guide_search USING fts5(
+            title, subtitle, description,
+            channel UNINDEXED, start UNINDEXED, end UNINDEXED, duration UNINDEXED, category UNINDEXED
+         )`)
+	if err == nil {
+		return
+	}
+	slog.Warn("FTS5 unavailable, using FTS4 for guide search", "err", err)
+
+	_, err = a.store.ExecContext(context.Background(), `
+        CREATE VIRTUAL TABLE IF NOT EXISTS guide_search USING fts4(
+            title, subtitle, description, channel, start, end, duration, category,
+            notindexed=channel, notindexed=start, notindexed=end, notindexed=duration, notindexed=category
+         )`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// indexGuide replaces the search index contents with programs.
+func (a *App) indexGuide(programs []types.Program) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := a.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM guide_search"); err != nil {
+		return err
+	}
+	for _, p := range programs {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO guide_search (title, subtitle, description, channel, start, "end", duration, category)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.Title, p.SubTitle, p.Description, p.Channel, p.Start, p.End, p.Duration, p.Category)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// searchMatchExpr turns free text into a MATCH expression that requires every
+// word as a prefix. Punctuation splits words the same way the FTS tokenizer
+// does, and words are lowercased so user input can never be parsed as FTS
+// operators or column filters.
+func searchMatchExpr(q string) string {
+	q = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, q)
+
+	var terms []string
+	for _, word := range strings.Fields(q) {
+		terms = append(terms, word+"*")
+	}
+	return strings.Join(terms, " ")
+}
+
+// postgresTSQuery turns a match expression from searchMatchExpr into the
+// to_tsquery syntax for the same prefix search.
+func postgresTSQuery(match string) string {
+	terms := strings.Fields(match)
+	for i, t := range terms {
+		terms[i] = strings.TrimSuffix(t, "*") + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+func (a *App) searchGuide(w http.ResponseWriter, r *http.Request) {
+	match := searchMatchExpr(r.URL.Query().Get("q"))
+	if match == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "q is required"}) //nolint: errcheck
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if n > maxSearchLimit {
+			n = maxSearchLimit
+		}
+		limit = n
+	}
+
+	results, err := a.searchPrograms(r.Context(), match, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		requestLogger(r).Error("Error encoding search response", "err", err)
+	}
+}
+
+// searchPrograms returns up to limit programs matching the full-text match
+// expression that are on enabled channels and have not ended.
+func (a *App) searchPrograms(ctx context.Context, match string, limit int) ([]types.Program, error) {
+	a.enabledChannelsMutex.RLock()
+	channelMap := make(map[string]bool)
+	for k, v := range a.enabledChannels {
+		channelMap[k] = v
+	}
+	a.enabledChannelsMutex.RUnlock()
+
+	where := "guide_search MATCH ?"
+	if a.cfg().DBDriver == driverPostgres {
+		where = "to_tsvector('simple', title || ' ' || subtitle || ' ' || description) @@ to_tsquery('simple', ?)"
+		match = postgresTSQuery(match)
+	}
+	rows, err := a.dbQueryContext(ctx, `
+        SELECT title, subtitle, description, channel, start, "end", duration, category
+        FROM guide_search
+        WHERE `+where+`
+        ORDER BY start`, match)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	now := time.Now()
+	results := []types.Program{}
+	for rows.Next() && len(results) < limit {
+		var p types.Program
+		if err := rows.Scan(&p.Title, &p.SubTitle, &p.Description, &p.Channel, &p.Start, &p.End, &p.Duration, &p.Category); err != nil {
+			return nil, err
+		}
+		if !channelMap[p.Channel] {
+			continue
+		}
+		if end, err := time.Parse(time.RFC3339, p.End); err != nil || end.Before(now) {
+			continue
+		}
+		results = append(results, p)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating search results", "err", err)
+	}
+	return results, nil
+}
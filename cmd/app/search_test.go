@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestSearchMatchExpr(t *testing.T) {
+	tests := map[string]string{
+		"Nova":                   "nova*",
+		"  star TREK ":           "star* trek*",
+		`title:"x" OR NEAR(a b)`: "title* x* or* near* a* b*",
+		"!!! ---":                "",
+		"Grey's Anatomy":         "grey* s* anatomy*",
+	}
+	for in, want := range tests {
+		if got := searchMatchExpr(in); got != want {
+			t.Errorf("searchMatchExpr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearchGuideHandler(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.enabledChannels = map[string]bool{"5.1": true}
+
+	future := time.Now().Add(2 * time.Hour)
+	past := time.Now().Add(-2 * time.Hour)
+	prog := func(channel, title, desc string, start time.Time) types.Program {
+		return types.Program{
+			Channel:     channel,
+			Title:       title,
+			Description: desc,
+			Start:       start.Format(time.RFC3339),
+			End:         start.Add(time.Hour).Format(time.RFC3339),
+			Duration:    60,
+		}
+	}
+	err := app.indexGuide([]types.Program{
+		prog("5.1", "Nova", "Exploring black holes.", future),
+		prog("5.1", "Nature", "Penguins of the Antarctic.", future.Add(time.Hour)),
+		prog("5.1", "Nova", "Already aired.", past),
+		prog("9.1", "Nova", "Channel not received.", future),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(q string) []types.Program {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/guide/search?q="+q, nil)
+		rr := httptest.NewRecorder()
+		app.searchGuide(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("search %q: got code %d, want %d", q, rr.Code, http.StatusOK)
+		}
+		var res []types.Program
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := search("nov"); len(res) != 1 || res[0].Title != "Nova" || res[0].Duration != 60 {
+		t.Errorf("prefix title search: unexpected result %+v", res)
+	}
+	if res := search("penguins"); len(res) != 1 || res[0].Title != "Nature" {
+		t.Errorf("description search: unexpected result %+v", res)
+	}
+	if res := search("nova+penguins"); len(res) != 0 {
+		t.Errorf("expected all words to be required, got %+v", res)
+	}
+
+	req := httptest.NewRequest("GET", "/api/guide/search?q=", nil)
+	rr := httptest.NewRecorder()
+	app.searchGuide(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("empty query: got code %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sort"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// editableSettings are the config fields PUT /api/settings may change.
+// Values saved there override config.json and the DVR_* variables, at
+// startup and on every reload.
+var editableSettings = map[string]bool{
+	"storageDir": true, "storageDirs": true, "storagePlacement": true, "filenameTemplate": true,
+	"organize": true, "padding": true, "retention": true, "ffmpegLogRetentionDays": true,
+	"notifications": true, "mediaServers": true, "parental": true,
+}
+
+// Settings is the body of GET and PUT /api/settings. Settings holds the
+// editable values in force, with credentials redacted; Stored names those
+// saved through the API. RestartRequired names stored values that are not
+// in force yet; Changed, on PUT only, those that just took effect.
+type Settings struct {
+	Settings        map[string]json.RawMessage `json:"settings"`
+	Stored          []string                   `json:"stored"`
+	Changed         []string                   `json:"changed,omitempty"`
+	RestartRequired []string                   `json:"restartRequired"`
+}
+
+// createSettingsTable creates the table of saved settings. It takes a
+// store rather than an App because the settings are read before the App
+// is built.
+func createSettingsTable(ctx context.Context, store types.Store) error {
+	_, err := store.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS settings (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+         )`)
+	return err
+}
+
+// configFieldByName returns the field of c written as name in config.json.
+func configFieldByName(c *pkgcfg.Config, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if configField(v.Type().Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setSetting replaces one editable setting of c with a JSON value. A
+// storage directory set alone replaces the list as DVR_STORAGE_DIR does,
+// and a list set alone makes its first entry the primary directory.
+func setSetting(c *pkgcfg.Config, key string, value json.RawMessage) error {
+	f, ok := configFieldByName(c, key)
+	if !ok || !editableSettings[key] {
+		return fmt.Errorf("%s cannot be changed through the settings API", key)
+	}
+	p := reflect.New(f.Type())
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p.Interface()); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	f.Set(p.Elem())
+	switch key {
+	case "storageDir":
+		c.StorageDirs = []string{c.StorageDir}
+	case "storageDirs":
+		if len(c.StorageDirs) > 0 {
+			c.StorageDir = c.StorageDirs[0]
+		}
+	}
+	return nil
+}
+
+// validateSetting rejects a value of key in c the recorder cannot work
+// with.
+func validateSetting(c *pkgcfg.Config, key string) error {
+	switch key {
+	case "storageDir", "storageDirs":
+		if c.StorageDir == "" || len(c.StorageDirs) == 0 {
+			return errors.New("storageDir cannot be empty")
+		}
+		for _, dir := range c.StorageDirs {
+			if dir == "" {
+				return errors.New("storageDirs cannot contain an empty path")
+			}
+		}
+	case "storagePlacement":
+		if c.StoragePlacement != "most-free" && c.StoragePlacement != "round-robin" {
+			return fmt.Errorf("unknown storagePlacement %q", c.StoragePlacement)
+		}
+	case "filenameTemplate":
+		if c.FilenameTemplate == "" {
+			return errors.New("filenameTemplate cannot be empty")
+		}
+	case "organize":
+		if c.Organize != "" && c.Organize != "series" {
+			return fmt.Errorf("unknown organize %q", c.Organize)
+		}
+	case "padding":
+		if p := c.Padding; p != nil && (p.BeforeSeconds < 0 || p.AfterMinutes < 0) {
+			return errors.New("padding cannot be negative")
+		}
+	case "retention":
+		if c.Retention.MaxTotalGB < 0 || c.Retention.MaxAgeDays < 0 {
+			return errors.New("retention limits cannot be negative")
+		}
+	case "ffmpegLogRetentionDays":
+		if c.FFmpegLogRetentionDays <= 0 {
+			return errors.New("ffmpegLogRetentionDays must be positive")
+		}
+	}
+	return nil
+}
+
+// storedSettings returns the settings saved through the API.
+func storedSettings(ctx context.Context, store types.Store) (map[string]json.RawMessage, error) {
+	rows, err := store.QueryContext(ctx, "SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	stored := map[string]json.RawMessage{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		stored[key] = json.RawMessage(value)
+	}
+	return stored, rows.Err()
+}
+
+// applyStoredSettings overlays the settings saved through the API on c.
+func applyStoredSettings(ctx context.Context, store types.Store, c *pkgcfg.Config) error {
+	if err := createSettingsTable(ctx, store); err != nil {
+		return err
+	}
+	stored, err := storedSettings(ctx, store)
+	if err != nil {
+		return err
+	}
+	// storageDirs goes last so that it wins over storageDir when both are
+	// saved.
+	for key, value := range stored {
+		if key == "storageDirs" {
+			continue
+		}
+		if err := setSetting(c, key, value); err != nil {
+			slog.Warn("Ignoring saved setting", "key", key, "err", err)
+		}
+	}
+	if value, ok := stored["storageDirs"]; ok {
+		if err := setSetting(c, "storageDirs", value); err != nil {
+			slog.Warn("Ignoring saved setting", "key", "storageDirs", "err", err)
+		}
+	}
+	return nil
+}
+
+// unredact puts back the credentials of old wherever next still holds the
+// "[redacted]" placeholder GET returned, so a client can send settings back
+// unchanged.
+func unredact(next, old interface{}) interface{} {
+	switch n := next.(type) {
+	case map[string]interface{}:
+		o, _ := old.(map[string]interface{})
+		for k, v := range n {
+			if v == "[redacted]" && isSecretKey(k) {
+				n[k] = o[k]
+			} else {
+				n[k] = unredact(v, o[k])
+			}
+		}
+	case []interface{}:
+		o, _ := old.([]interface{})
+		for i, v := range n {
+			if i < len(o) {
+				n[i] = unredact(v, o[i])
+			}
+		}
+	}
+	return next
+}
+
+// settingValue returns a setting of c as a client sees it, decoded from
+// its JSON.
+func settingValue(c *pkgcfg.Config, key string) interface{} {
+	f, _ := configFieldByName(c, key)
+	b, _ := json.Marshal(f.Interface())
+	var v interface{}
+	json.Unmarshal(b, &v) //nolint: errcheck
+	return v
+}
+
+// settings describes the editable settings in force and those saved.
+func (a *App) settings(ctx context.Context) (Settings, error) {
+	stored, err := storedSettings(ctx, a.store)
+	if err != nil {
+		return Settings{}, err
+	}
+	c := a.cfg()
+	s := Settings{Settings: map[string]json.RawMessage{}, Stored: []string{}, RestartRequired: []string{}}
+	for key := range editableSettings {
+		b, _ := json.Marshal(redact(settingValue(c, key)))
+		s.Settings[key] = b
+	}
+	for key, value := range stored {
+		s.Stored = append(s.Stored, key)
+		want := *c
+		if err := setSetting(&want, key, value); err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(settingValue(&want, key), settingValue(c, key)) {
+			s.RestartRequired = append(s.RestartRequired, key)
+		}
+	}
+	sort.Strings(s.Stored)
+	sort.Strings(s.RestartRequired)
+	return s, nil
+}
+
+// getSettings returns the editable settings.
+func (a *App) getSettings(w http.ResponseWriter, r *http.Request) {
+	s, err := a.settings(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s) //nolint: errcheck
+}
+
+// putSettings saves the settings in the body, a JSON object keyed like
+// config.json, and applies them. A null value deletes the saved setting,
+// so config.json and the DVR_* variables apply again. Storage paths are saved but only used
+// after a restart.
+func (a *App) putSettings(w http.ResponseWriter, r *http.Request) {
+	writeErr := func(status int, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) //nolint: errcheck
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErr(http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if len(body) == 0 {
+		writeErr(http.StatusBadRequest, errors.New("no settings given"))
+		return
+	}
+
+	prev := a.cfg()
+	next := *prev
+	var file *pkgcfg.Config
+	save := map[string]json.RawMessage{}
+	var remove []string
+	for key, value := range body {
+		if !editableSettings[key] {
+			writeErr(http.StatusBadRequest, fmt.Errorf("%s cannot be changed through the settings API", key))
+			return
+		}
+		if string(value) == "null" {
+			if file == nil {
+				var err error
+				if file, err = pkgcfg.LoadConfig(); err != nil {
+					writeErr(http.StatusInternalServerError, fmt.Errorf("reading config file: %w", err))
+					return
+				}
+			}
+			dst, _ := configFieldByName(&next, key)
+			src, _ := configFieldByName(file, key)
+			dst.Set(src)
+			if key == "storageDir" || key == "storageDirs" {
+				next.StorageDir, next.StorageDirs = file.StorageDir, file.StorageDirs
+			}
+			remove = append(remove, key)
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			writeErr(http.StatusBadRequest, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		value, _ = json.Marshal(unredact(v, settingValue(prev, key)))
+		save[key] = value
+		if err := setSetting(&next, key, value); err != nil {
+			writeErr(http.StatusBadRequest, err)
+			return
+		}
+	}
+	for key := range save {
+		if err := validateSetting(&next, key); err != nil {
+			writeErr(http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	tx, err := a.store.BeginTx(ctx, nil)
+	if err != nil {
+		writeErr(http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback() //nolint: errcheck
+	for key, value := range save {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO settings (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`, key, string(value))
+		if err != nil {
+			writeErr(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	for _, key := range remove {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM settings WHERE key = ?", key); err != nil {
+			writeErr(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		writeErr(http.StatusInternalServerError, err)
+		return
+	}
+
+	res := a.applyConfig(&next)
+	requestLogger(r).Info("Settings updated", "changed", res.Changed, "restart_required", res.RestartRequired)
+
+	s, err := a.settings(ctx)
+	if err != nil {
+		writeErr(http.StatusInternalServerError, err)
+		return
+	}
+	s.Changed = res.Changed
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s) //nolint: errcheck
+}
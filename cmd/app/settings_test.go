@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func putSettingsRequest(t *testing.T, app *App, body string) (*httptest.ResponseRecorder, Settings) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	app.putSettings(rr, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(body)))
+	var s Settings
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr, s
+}
+
+func TestPutSettings(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	rr, s := putSettingsRequest(t, app, `{
+		"padding": {"beforeSeconds": 60, "afterMinutes": 5},
+		"retention": {"maxAgeDays": 14},
+		"notifications": {"ntfy": {"topic": "dvr", "token": "tk_secret"}},
+		"storageDir": "/mnt/new"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rr.Code, rr.Body)
+	}
+	if !reflect.DeepEqual(s.Changed, []string{"notifications", "padding", "retention"}) ||
+		!reflect.DeepEqual(s.RestartRequired, []string{"storageDir"}) ||
+		!reflect.DeepEqual(s.Stored, []string{"notifications", "padding", "retention", "storageDir"}) {
+		t.Errorf("got %+v", s)
+	}
+	if before, after := app.padding(); before != 60 || after != 5 {
+		t.Errorf("padding %d/%d", before, after)
+	}
+	cfg := app.cfg()
+	if cfg.Retention.MaxAgeDays != 14 || cfg.StorageDir != "/tmp/dvr_test" || len(app.currentNotifiers()) != 1 {
+		t.Errorf("config in force %+v", cfg)
+	}
+	if strings.Contains(string(s.Settings["notifications"]), "tk_secret") {
+		t.Errorf("token not redacted: %s", s.Settings["notifications"])
+	}
+
+	// Sending the redacted value back keeps the token.
+	rr, _ = putSettingsRequest(t, app, `{"notifications": {"ntfy": {"topic": "dvr2", "token": "[redacted]"}}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rr.Code, rr.Body)
+	}
+	if n := app.cfg().Notifications.Ntfy; n.Topic != "dvr2" || n.Token != "tk_secret" {
+		t.Errorf("ntfy %+v", n)
+	}
+
+	// The saved settings apply on top of a freshly loaded config.
+	next := &pkgcfg.Config{StorageDir: "/tmp/dvr_test", StorageDirs: []string{"/tmp/dvr_test", "/mnt/b"}}
+	if err := applyStoredSettings(context.Background(), app.store, next); err != nil {
+		t.Fatal(err)
+	}
+	if next.StorageDir != "/mnt/new" || !reflect.DeepEqual(next.StorageDirs, []string{"/mnt/new"}) ||
+		next.Retention.MaxAgeDays != 14 || next.Notifications.Ntfy.Token != "tk_secret" {
+		t.Errorf("overlaid config %+v", next)
+	}
+}
+
+func TestPutSettingsRejects(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	for _, body := range []string{
+		`{"port": 9090}`,
+		`{"padding": {"beforeSeconds": -1}}`,
+		`{"retention": {"maxAgeDays": "a week"}}`,
+		`{"retention": {"maxDays": 7}}`,
+		`{"storagePlacement": "random"}`,
+		`{}`,
+	} {
+		if rr, _ := putSettingsRequest(t, app, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", body, rr.Code)
+		}
+	}
+	stored, err := storedSettings(context.Background(), app.store)
+	if err != nil || len(stored) != 0 {
+		t.Errorf("stored %v, %v", stored, err)
+	}
+}
+
+func TestPutSettingsNullReverts(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("DVR_CONFIG", path)
+	if err := os.WriteFile(path, []byte(`{"storageDir": "/tmp/dvr_test", "retention": {"maxTotalGB": 100}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr, _ := putSettingsRequest(t, app, `{"retention": {"maxAgeDays": 14}}`); rr.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rr.Code, rr.Body)
+	}
+	rr, s := putSettingsRequest(t, app, `{"retention": null}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rr.Code, rr.Body)
+	}
+	if r := app.cfg().Retention; r.MaxTotalGB != 100 || r.MaxAgeDays != 0 || len(s.Stored) != 0 {
+		t.Errorf("retention %+v, stored %v", r, s.Stored)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// stopTimeout is how long stopped captures get to record their status once
+// the grace period is over; ffmpeg is killed halfway through it.
+var stopTimeout = 10 * time.Second
+
+// isDraining reports whether shutdown has begun. No recording starts and no
+// API write is accepted from then on.
+func (a *App) isDraining() bool {
+	return atomic.LoadInt32(&a.draining) == 1
+}
+
+// rejectWhileDraining is router middleware answering every request other
+// than GET and HEAD with 503 once shutdown has begun, so nothing is
+// scheduled that would not be recorded.
+func (a *App) rejectWhileDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.isDraining() && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runningCaptures returns the IDs of the recordings being captured.
+func (a *App) runningCaptures() []int {
+	var ids []int
+	a.runningProcesses.Range(func(key, _ interface{}) bool {
+		ids = append(ids, key.(int))
+		return true
+	})
+	return ids
+}
+
+// waitForCaptures polls until no capture is running or ctx is done, and
+// reports whether they all finished.
+func (a *App) waitForCaptures(ctx context.Context) bool {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for len(a.runningCaptures()) > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// signalCaptures sends sig to each running ffmpeg.
+func (a *App) signalCaptures(sig os.Signal) {
+	a.runningProcesses.Range(func(key, value interface{}) bool {
+		if cmd, ok := value.(*exec.Cmd); ok && cmd != nil && cmd.Process != nil {
+			if err := cmd.Process.Signal(sig); err != nil {
+				slog.Debug("Error signalling ffmpeg", "recording_id", key, "signal", sig, "err", err)
+			}
+		}
+		return true
+	})
+}
+
+// drain lets running recordings finish for up to grace, then stops the rest
+// the way an early cancel does, so each keeps what it captured. Recordings
+// whose capture still hasn't returned after stopTimeout are marked partial
+// here.
+func (a *App) drain(grace time.Duration) {
+	atomic.StoreInt32(&a.draining, 1)
+
+	if ids := a.runningCaptures(); len(ids) > 0 {
+		slog.Info("Waiting for recordings in progress", "count", len(ids), "grace", grace)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	done := a.waitForCaptures(ctx)
+	cancel()
+	if done {
+		return
+	}
+
+	ids := a.runningCaptures()
+	slog.Warn("Grace period over, stopping recordings", "count", len(ids))
+	for _, id := range ids {
+		stopRequests.Store(id, true)
+	}
+	a.signalCaptures(os.Interrupt)
+	ctx, cancel = context.WithTimeout(context.Background(), stopTimeout/2)
+	done = a.waitForCaptures(ctx)
+	cancel()
+	if done {
+		return
+	}
+	a.signalCaptures(os.Kill)
+	ctx, cancel = context.WithTimeout(context.Background(), stopTimeout/2)
+	done = a.waitForCaptures(ctx)
+	cancel()
+	if done {
+		return
+	}
+
+	for _, id := range a.runningCaptures() {
+		if err := a.setStatus(context.Background(), id, statusPartial, "did not stop for shutdown in time"); err != nil {
+			slog.Error("Error marking stopped recording partial", "recording_id", id, "err", err)
+			continue
+		}
+		slog.Warn("Recording did not stop in time, marked partial", "recording_id", id)
+	}
+}
+
+// shutdown drains recordings and then closes the HTTP server. The server
+// keeps answering reads while recordings drain.
+func (a *App) shutdown(server *http.Server, grace time.Duration) {
+	a.drain(grace)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Server shutdown error", "err", err)
+	}
+}
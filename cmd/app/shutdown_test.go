@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestRejectWhileDraining(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	h := app.rejectWhileDraining(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recordings", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("before shutdown: %d", rr.Code)
+	}
+
+	app.drain(time.Second)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recordings", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("write while draining: %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("read while draining: %d", rr.Code)
+	}
+}
+
+func TestDrainWaitsForCaptures(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	app.runningProcesses.Store(1, &exec.Cmd{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		app.runningProcesses.Delete(1)
+	}()
+	start := time.Now()
+	app.drain(10 * time.Second)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("drain took %v after the capture finished", d)
+	}
+	if _, stopped := stopRequests.Load(1); stopped {
+		t.Error("a capture that finished in time was stopped")
+	}
+}
+
+func TestDrainStopsCapturesAfterGrace(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	defer func(d time.Duration) { stopTimeout = d }(stopTimeout)
+	stopTimeout = 200 * time.Millisecond
+
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (9, '5.1', '2024-01-02', '20:00', 60, 'recording')"); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	app.runningProcesses.Store(9, cmd)
+	defer stopRequests.Delete(9)
+
+	app.drain(50 * time.Millisecond)
+
+	select {
+	case <-exited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ffmpeg was not stopped")
+	}
+	if _, stopped := stopRequests.Load(9); !stopped {
+		t.Error("stop was not requested")
+	}
+	// Nothing finished the capture, so drain recorded the status itself.
+	var status string
+	if err := db.QueryRow("SELECT status FROM recordings WHERE id = 9").Scan(&status); err != nil || status != statusPartial {
+		t.Errorf("status %q, %v", status, err)
+	}
+}
+
+func TestStartRecordingWhileDraining(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (3, '5.1', '2024-01-02', '20:00', 60, 'pending')"); err != nil {
+		t.Fatal(err)
+	}
+	app.drain(time.Second)
+	app.startRecording(types.Recording{ID: 3, ChannelID: "5.1", Date: "2024-01-02", StartTime: "20:00", Duration: 60})
+
+	var status string
+	if err := db.QueryRow("SELECT status FROM recordings WHERE id = 3").Scan(&status); err != nil || status != "pending" {
+		t.Errorf("status %q, %v", status, err)
+	}
+}
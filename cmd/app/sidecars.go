@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// artworkTimeout bounds each image download.
+const artworkTimeout = 30 * time.Second
+
+// nfoActor and nfoUniqueID are the shared elements of Kodi NFO files.
+type nfoActor struct {
+	Name string `xml:"name"`
+}
+
+type nfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr,omitempty"`
+	ID      string `xml:",chardata"`
+}
+
+// nfoEpisode is a Kodi <episodedetails> document. Programs without season
+// and episode numbers, such as news, are written as episodes aired on the
+// day they were recorded.
+type nfoEpisode struct {
+	XMLName   xml.Name      `xml:"episodedetails"`
+	Title     string        `xml:"title"`
+	ShowTitle string        `xml:"showtitle"`
+	Season    int           `xml:"season,omitempty"`
+	Episode   int           `xml:"episode,omitempty"`
+	Plot      string        `xml:"plot,omitempty"`
+	Aired     string        `xml:"aired,omitempty"`
+	Year      int           `xml:"year,omitempty"`
+	MPAA      string        `xml:"mpaa,omitempty"`
+	Genre     string        `xml:"genre,omitempty"`
+	Studio    string        `xml:"studio,omitempty"`
+	UniqueIDs []nfoUniqueID `xml:"uniqueid"`
+	Actors    []nfoActor    `xml:"actor"`
+}
+
+// nfoMovie is a Kodi <movie> document.
+type nfoMovie struct {
+	XMLName   xml.Name      `xml:"movie"`
+	Title     string        `xml:"title"`
+	Plot      string        `xml:"plot,omitempty"`
+	Year      int           `xml:"year,omitempty"`
+	MPAA      string        `xml:"mpaa,omitempty"`
+	Genre     string        `xml:"genre,omitempty"`
+	Studio    string        `xml:"studio,omitempty"`
+	UniqueIDs []nfoUniqueID `xml:"uniqueid"`
+	Actors    []nfoActor    `xml:"actor"`
+}
+
+// sidecarBase returns name without its extension; sidecars share it.
+func sidecarBase(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// sidecarNames lists every file the sidecar stage may write for the
+// recording file name, so they can be removed with it.
+func sidecarNames(name string) []string {
+	base := sidecarBase(name)
+	return []string{base + ".nfo", base + "-poster.jpg", base + "-thumb.jpg", base + "-fanart.jpg"}
+}
+
+// buildNFO renders the NFO document for a recording from its guide
+// metadata and, when there is one, its TMDB or TVDB match.
+func buildNFO(md types.RecordingMetadata, e *types.Enrichment, rec types.Recording, channel string) ([]byte, error) {
+	var ids []nfoUniqueID
+	plot := md.Description
+	show := md.Title
+	year := md.Year
+	if e != nil {
+		id := e.EpisodeID
+		if id == "" || isMovie(md) {
+			id = e.SeriesID
+		}
+		ids = append(ids, nfoUniqueID{Type: e.Provider, Default: true, ID: id})
+		if e.Synopsis != "" {
+			plot = e.Synopsis
+		}
+		if e.SeriesName != "" {
+			show = e.SeriesName
+		}
+		if year == 0 {
+			year = e.Year
+		}
+	}
+	var actors []nfoActor
+	for _, name := range md.Cast {
+		actors = append(actors, nfoActor{Name: name})
+	}
+
+	var doc interface{}
+	if isMovie(md) {
+		doc = nfoMovie{Title: show, Plot: plot, Year: year, MPAA: md.Rating, Genre: md.Category,
+			Studio: channel, UniqueIDs: ids, Actors: actors}
+	} else {
+		ep := nfoEpisode{Title: md.SubTitle, ShowTitle: show, Season: md.Season, Episode: md.Episode, Plot: plot,
+			Aired: md.OriginalAirDate, Year: year, MPAA: md.Rating, Genre: md.Category, Studio: channel,
+			UniqueIDs: ids, Actors: actors}
+		if ep.Title == "" {
+			ep.Title = show
+		}
+		if md.Season <= 0 || md.Episode <= 0 {
+			ep.Aired = rec.Date
+		}
+		doc = ep
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// writeSidecar stores data as name on fs.
+func writeSidecar(fs storage.Storage, name string, data []byte) error {
+	w, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close() //nolint: errcheck
+		return err
+	}
+	return w.Close()
+}
+
+// downloadArtwork fetches url into name on fs. A partial file is removed.
+func downloadArtwork(ctx context.Context, fs storage.Storage, url, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, artworkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "hdhr-dvr")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	w, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fs.Remove(name) //nolint: errcheck
+	}
+	return err
+}
+
+// writeSidecars is the post-processing stage that writes the NFO and
+// artwork next to a finished recording. Artwork that cannot be downloaded
+// is noted in the output without failing the stage, since the recording
+// and its NFO are still usable.
+func (a *App) writeSidecars(ctx context.Context, job *postJob) ([]byte, error) {
+	name := finalFileName(job.rec)
+	md, err := a.loadRecordingMetadata(ctx, job.rec.ID)
+	if err == sql.ErrNoRows {
+		md = types.RecordingMetadata{RecordingID: job.rec.ID, Title: job.rec.ChannelID}
+		if job.rec.Title != nil && *job.rec.Title != "" {
+			md.Title = *job.rec.Title
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	e, err := a.loadEnrichment(ctx, job.rec.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var out strings.Builder
+	base := sidecarBase(name)
+	if a.cfg().Sidecars.NFO {
+		nfo, err := buildNFO(md, e, job.rec, job.channel.GuideName)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeSidecar(job.fs, base+".nfo", nfo); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "wrote %s.nfo\n", base)
+	}
+	if a.cfg().Sidecars.Artwork && e != nil {
+		// Kodi and Jellyfin look for a movie's poster, but an episode's thumb.
+		image := base + "-thumb.jpg"
+		if isMovie(md) {
+			image = base + "-poster.jpg"
+		}
+		for _, art := range []struct{ url, name string }{{e.ImageURL, image}, {e.FanartURL, base + "-fanart.jpg"}} {
+			if art.url == "" {
+				continue
+			}
+			if err := downloadArtwork(ctx, job.fs, art.url, art.name); err != nil {
+				fmt.Fprintf(&out, "skipped %s: %v\n", art.name, err)
+				continue
+			}
+			fmt.Fprintf(&out, "wrote %s\n", art.name)
+		}
+	}
+	if out.Len() == 0 {
+		out.WriteString("nothing to write for recording " + strconv.Itoa(job.rec.ID) + "\n")
+	}
+	return []byte(out.String()), nil
+}
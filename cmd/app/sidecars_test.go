@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestBuildNFO(t *testing.T) {
+	rec := types.Recording{ID: 1, ChannelID: "5.1", Date: "2026-03-01"}
+	md := types.RecordingMetadata{Title: "Office, The", SubTitle: "The Dundies", Season: 2, Episode: 1,
+		Description: "Guide text.", OriginalAirDate: "2005-09-20", Rating: "TV-14", Cast: []string{"Steve Carell"}}
+	e := &types.Enrichment{Provider: "tmdb", SeriesID: "2316", SeriesName: "The Office", EpisodeID: "62345", Synopsis: "Michael hosts the Dundies."}
+
+	out, err := buildNFO(md, e, rec, "KPIX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<episodedetails>", "<title>The Dundies</title>", "<showtitle>The Office</showtitle>",
+		"<season>2</season>", "<episode>1</episode>", "<plot>Michael hosts the Dundies.</plot>",
+		"<aired>2005-09-20</aired>", "<studio>KPIX</studio>", `<uniqueid type="tmdb" default="true">62345</uniqueid>`,
+		"<actor>\n    <name>Steve Carell</name>",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("episode NFO missing %q:\n%s", want, out)
+		}
+	}
+
+	out, _ = buildNFO(types.RecordingMetadata{Title: "Forrest Gump", Category: "Movie", Year: 1994},
+		&types.Enrichment{Provider: "tvdb", SeriesID: "13"}, rec, "")
+	if !strings.Contains(string(out), "<movie>") || !strings.Contains(string(out), `<uniqueid type="tvdb" default="true">13</uniqueid>`) {
+		t.Errorf("movie NFO:\n%s", out)
+	}
+
+	out, _ = buildNFO(types.RecordingMetadata{Title: "News"}, nil, rec, "")
+	if !strings.Contains(string(out), "<title>News</title>") || !strings.Contains(string(out), "<aired>2026-03-01</aired>") {
+		t.Errorf("NFO without episode numbers:\n%s", out)
+	}
+}
+
+func TestWriteSidecars(t *testing.T) {
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("jpeg " + r.URL.Path)) //nolint: errcheck
+	}))
+	defer images.Close()
+
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+	mem := storage.NewMemory()
+	app.config.Sidecars.NFO = true
+	app.config.Sidecars.Artwork = true
+
+	if err := app.saveRecordingMetadata(ctx, 1, types.Program{Title: "The Office", Season: 2, Episode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recording_enrichment (recording_id, provider, series_id, series_name, image_url, fanart_url) VALUES (1, 'tmdb', '2316', 'The Office', ?, ?)",
+		images.URL+"/poster.jpg", images.URL+"/missing.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	job := &postJob{rec: types.Recording{ID: 1, ChannelID: "5.1", FileName: "The Office/Season 02/The Office - S02E01.mp4"}, fs: mem}
+	out, err := app.writeSidecars(ctx, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "skipped The Office/Season 02/The Office - S02E01-fanart.jpg") {
+		t.Errorf("missing fanart not reported: %s", out)
+	}
+	if _, err := mem.Stat("The Office/Season 02/The Office - S02E01.nfo"); err != nil {
+		t.Error("no NFO written")
+	}
+	f, err := mem.Open("The Office/Season 02/The Office - S02E01-thumb.jpg")
+	if err != nil {
+		t.Fatal("no episode thumb written")
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "jpeg /poster.jpg" {
+		t.Errorf("thumb contains %q", data)
+	}
+	if _, err := mem.Stat("The Office/Season 02/The Office - S02E01-fanart.jpg"); err == nil {
+		t.Error("failed download left a fanart file")
+	}
+
+	steps := app.postProcessSteps()
+	if len(steps) != 1 || steps[0].name != "sidecars" {
+		t.Errorf("pipeline %+v", steps)
+	}
+}
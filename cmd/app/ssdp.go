@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DLNA players find media servers with SSDP: they multicast an M-SEARCH to
+// 239.255.255.250:1900 and servers answer with where their description is.
+// Servers also multicast NOTIFY announcements, so players already running
+// see them come and go.
+
+// ssdpAddr is the SSDP multicast group and port.
+const ssdpAddr = "239.255.255.250:1900"
+
+// ssdpMaxAge is how long, in seconds, players keep an announcement.
+// Announcements are repeated at half of it.
+const ssdpMaxAge = 1800
+
+// ssdpServer is the SERVER header of the DVR's SSDP messages.
+const ssdpServer = "Linux/1.0 UPnP/1.0 hdhr-dvr/1.0"
+
+// ssdpTargets returns the search targets the media server answers to.
+func ssdpTargets(uuid string) []string {
+	return []string{"upnp:rootdevice", "uuid:" + uuid, upnpMediaServer, upnpContentDirectory, upnpConnectionManager}
+}
+
+// ssdpUSN returns the unique service name of target.
+func ssdpUSN(target, uuid string) string {
+	if target == "uuid:"+uuid {
+		return target
+	}
+	return "uuid:" + uuid + "::" + target
+}
+
+// ssdpSearchTarget returns the ST of msg if it is an M-SEARCH.
+func ssdpSearchTarget(msg []byte) (string, bool) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(msg)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+		return "", false
+	}
+	st := req.Header.Get("ST")
+	return st, st != ""
+}
+
+// ssdpMatches returns the targets to answer a search for st with.
+func ssdpMatches(st, uuid string) []string {
+	if st == "ssdp:all" {
+		return ssdpTargets(uuid)
+	}
+	for _, t := range ssdpTargets(uuid) {
+		if t == st {
+			return []string{t}
+		}
+	}
+	return nil
+}
+
+// ssdpResponse answers an M-SEARCH for target.
+func ssdpResponse(target, uuid, location string) []byte {
+	return fmt.Appendf(nil, "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=%d\r\nDATE: %s\r\nEXT:\r\nLOCATION: %s\r\nSERVER: %s\r\nST: %s\r\nUSN: %s\r\n\r\n",
+		ssdpMaxAge, time.Now().UTC().Format(http.TimeFormat), location, ssdpServer, target, ssdpUSN(target, uuid))
+}
+
+// ssdpNotify announces target with nts, ssdp:alive or ssdp:byebye.
+func ssdpNotify(target, nts, uuid, location string) []byte {
+	return fmt.Appendf(nil, "NOTIFY * HTTP/1.1\r\nHOST: %s\r\nCACHE-CONTROL: max-age=%d\r\nLOCATION: %s\r\nNT: %s\r\nNTS: %s\r\nSERVER: %s\r\nUSN: %s\r\n\r\n",
+		ssdpAddr, ssdpMaxAge, location, target, nts, ssdpServer, ssdpUSN(target, uuid))
+}
+
+// ssdpLocation returns the device description's URL as peer reaches it.
+func (a *App) ssdpLocation(peer net.Addr) string {
+	if base := a.cfg().DLNA.BaseURL; base != "" {
+		return base + dlnaPrefix + "/device.xml"
+	}
+	return a.discoveryBaseURL(peer) + dlnaPrefix + "/device.xml"
+}
+
+// serveSSDP answers M-SEARCH requests on conn until it is closed.
+func (a *App) serveSSDP(conn net.PacketConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("SSDP stopped", "err", err)
+			}
+			return
+		}
+		d := a.cfg().DLNA
+		st, ok := ssdpSearchTarget(buf[:n])
+		if d == nil || !ok {
+			continue
+		}
+		for _, target := range ssdpMatches(st, d.UUID) {
+			if _, err := conn.WriteTo(ssdpResponse(target, d.UUID, a.ssdpLocation(peer)), peer); err != nil {
+				slog.Warn("Error answering SSDP search", "peer", peer, "err", err)
+			}
+		}
+	}
+}
+
+// announceSSDP multicasts ssdp:alive for every target from conn, then
+// again every half max-age until ctx is done, when it says ssdp:byebye.
+func (a *App) announceSSDP(ctx context.Context, conn net.PacketConn, group *net.UDPAddr) {
+	send := func(nts string) {
+		d := a.cfg().DLNA
+		if d == nil {
+			return
+		}
+		location := a.ssdpLocation(group)
+		for _, target := range ssdpTargets(d.UUID) {
+			if _, err := conn.WriteTo(ssdpNotify(target, nts, d.UUID, location), group); err != nil {
+				slog.Warn("Error sending SSDP announcement", "nts", nts, "err", err)
+				return
+			}
+		}
+	}
+	ticker := time.NewTicker(ssdpMaxAge / 2 * time.Second)
+	defer ticker.Stop()
+	for {
+		send("ssdp:alive")
+		select {
+		case <-ctx.Done():
+			send("ssdp:byebye")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listenSSDP joins the SSDP group to answer searches and announces the
+// media server until ctx is done. A group that cannot be joined is logged,
+// and players then need the description's address entered.
+func (a *App) listenSSDP(ctx context.Context) {
+	group, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		slog.Warn("Not announcing over SSDP", "err", err)
+		return
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		slog.Warn("Not announcing over SSDP", "err", err)
+		return
+	}
+	context.AfterFunc(ctx, func() { conn.Close() }) //nolint: errcheck
+	slog.Info("Announcing DLNA media server over SSDP", "group", ssdpAddr)
+	go a.announceSSDP(ctx, conn, group)
+	a.serveSSDP(conn)
+}
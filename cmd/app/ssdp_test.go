@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestSSDP(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Port = 8080
+	uuid := "0a1b2c3d-0000-0000-0000-000000000000"
+	app.config.DLNA = &pkgcfg.DLNA{UUID: uuid}
+
+	if st, ok := ssdpSearchTarget([]byte("NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNT: upnp:rootdevice\r\n\r\n")); ok {
+		t.Errorf("NOTIFY taken for a search for %q", st)
+	}
+	if n := len(ssdpMatches("urn:schemas-upnp-org:device:MediaRenderer:1", uuid)); n != 0 {
+		t.Errorf("%d answers to a search for renderers", n)
+	}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint: errcheck
+	go app.serveSSDP(conn)
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() //nolint: errcheck
+	search := func(st string) []*http.Response {
+		msg := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: " + st + "\r\n\r\n"
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		var replies []*http.Response
+		buf := make([]byte, 2048)
+		for {
+			client.SetReadDeadline(time.Now().Add(200 * time.Millisecond)) //nolint: errcheck
+			n, err := client.Read(buf)
+			if err != nil {
+				return replies
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replies = append(replies, resp)
+		}
+	}
+
+	replies := search(upnpContentDirectory)
+	if len(replies) != 1 {
+		t.Fatalf("%d replies to a ContentDirectory search", len(replies))
+	}
+	h := replies[0].Header
+	if h.Get("LOCATION") != "http://127.0.0.1:8080/dlna/device.xml" || h.Get("ST") != upnpContentDirectory ||
+		h.Get("USN") != "uuid:"+uuid+"::"+upnpContentDirectory || h.Get("CACHE-CONTROL") != "max-age=1800" {
+		t.Errorf("reply %v", h)
+	}
+	if n := len(search("ssdp:all")); n != 5 {
+		t.Errorf("%d replies to ssdp:all, want 5", n)
+	}
+	if r := search("uuid:" + uuid); len(r) != 1 || r[0].Header.Get("USN") != "uuid:"+uuid {
+		t.Errorf("replies to a UUID search %v", r)
+	}
+
+	app.config.DLNA.BaseURL = "https://dvr.example.com"
+	if r := search("upnp:rootdevice"); len(r) != 1 || r[0].Header.Get("LOCATION") != "https://dvr.example.com/dlna/device.xml" {
+		t.Errorf("replies with a base URL %v", r)
+	}
+}
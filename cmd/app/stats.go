@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// StatsCounts are outcome counts over recordings that have finished.
+// Completed includes archived recordings; Failed includes those that never
+// started for lack of space. SuccessRate is Completed over all three, or 0
+// when nothing has finished.
+type StatsCounts struct {
+	Recordings  int     `json:"recordings"`
+	Completed   int     `json:"completed"`
+	Partial     int     `json:"partial"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+	Hours       float64 `json:"hours"`
+	Bytes       int64   `json:"bytes"`
+}
+
+// ChannelStats aggregates one channel. AvgBitrate is in bits per second over
+// the recordings whose size and length are both known.
+type ChannelStats struct {
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName,omitempty"`
+	StatsCounts
+	AvgBitrate int64 `json:"avgBitrate"`
+	seconds    float64
+	sizedBytes int64
+}
+
+// DayStats aggregates the recordings of one date.
+type DayStats struct {
+	Date string `json:"date"`
+	StatsCounts
+}
+
+// Stats is the body of GET /api/stats. Hours[h] counts the recordings that
+// were on air at some point during hour h of the day, local time.
+// Maintenance is the last database maintenance run, absent before the
+// first.
+type Stats struct {
+	From        string             `json:"from,omitempty"`
+	To          string             `json:"to,omitempty"`
+	Totals      StatsCounts        `json:"totals"`
+	Channels    []ChannelStats     `json:"channels"`
+	Days        []DayStats         `json:"days"`
+	Hours       [24]int            `json:"hours"`
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty"`
+}
+
+// statsRecording is a recording as computeStats sees it. Seconds is the
+// measured length when the recording was verified, else the scheduled one.
+type statsRecording struct {
+	channelID, channelName string
+	date, startTime        string
+	duration               int
+	status                 string
+	fileSize               int64
+	seconds                float64
+}
+
+// add counts one recording's outcome.
+func (c *StatsCounts) add(r statsRecording) {
+	c.Recordings++
+	switch r.status {
+	case "completed", statusArchived:
+		c.Completed++
+	case statusPartial:
+		c.Partial++
+	case "failed", statusInsufficientSpace:
+		c.Failed++
+	default:
+		return
+	}
+	if r.status != "failed" && r.status != statusInsufficientSpace {
+		c.Hours += r.seconds / 3600
+		c.Bytes += r.fileSize
+	}
+}
+
+func (c *StatsCounts) finish() {
+	if done := c.Completed + c.Partial + c.Failed; done > 0 {
+		c.SuccessRate = float64(c.Completed) / float64(done)
+	}
+}
+
+// computeStats aggregates recs. Cancelled recordings are left out; pending
+// and running ones only count towards Recordings and Hours of day.
+func computeStats(recs []statsRecording) Stats {
+	st := Stats{Channels: []ChannelStats{}, Days: []DayStats{}}
+	channels := map[string]*ChannelStats{}
+	days := map[string]*DayStats{}
+	for _, r := range recs {
+		if r.status == "cancelled" {
+			continue
+		}
+		st.Totals.add(r)
+
+		ch := channels[r.channelID]
+		if ch == nil {
+			ch = &ChannelStats{ChannelID: r.channelID, ChannelName: r.channelName}
+			channels[r.channelID] = ch
+		}
+		ch.add(r)
+		if r.fileSize > 0 && r.seconds > 0 {
+			ch.sizedBytes += r.fileSize
+			ch.seconds += r.seconds
+		}
+
+		d := days[r.date]
+		if d == nil {
+			d = &DayStats{Date: r.date}
+			days[r.date] = d
+		}
+		d.add(r)
+
+		if start, err := time.Parse("15:04", r.startTime); err == nil {
+			first := start.Hour()
+			last := first + (start.Minute()+r.duration-1)/60
+			if r.duration <= 0 {
+				last = first
+			}
+			for h := first; h <= last && h < first+24; h++ {
+				st.Hours[h%24]++
+			}
+		}
+	}
+
+	st.Totals.finish()
+	for _, ch := range channels {
+		ch.finish()
+		if ch.seconds > 0 {
+			ch.AvgBitrate = int64(float64(ch.sizedBytes*8) / ch.seconds)
+		}
+		st.Channels = append(st.Channels, *ch)
+	}
+	sort.Slice(st.Channels, func(i, j int) bool {
+		if st.Channels[i].Recordings != st.Channels[j].Recordings {
+			return st.Channels[i].Recordings > st.Channels[j].Recordings
+		}
+		return st.Channels[i].ChannelID < st.Channels[j].ChannelID
+	})
+	for _, d := range days {
+		d.finish()
+		st.Days = append(st.Days, *d)
+	}
+	sort.Slice(st.Days, func(i, j int) bool { return st.Days[i].Date < st.Days[j].Date })
+	return st
+}
+
+// loadStatsRecordings returns the recordings dated from..to inclusive;
+// either bound may be empty.
+func (a *App) loadStatsRecordings(ctx context.Context, from, to string) ([]statsRecording, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT r.channel_id, COALESCE(c.guide_name, ''), r.date, r.start_time, r.duration, r.status, r.file_size,
+		       COALESCE(v.measured_seconds, r.duration * 60)
+		FROM recordings r
+		LEFT JOIN channels c ON c.guide_number = r.channel_id
+		LEFT JOIN recording_verifications v ON v.recording_id = r.id
+		WHERE (? = '' OR r.date >= ?) AND (? = '' OR r.date <= ?)`, from, from, to, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	var recs []statsRecording
+	for rows.Next() {
+		var r statsRecording
+		if err := rows.Scan(&r.channelID, &r.channelName, &r.date, &r.startTime, &r.duration, &r.status, &r.fileSize, &r.seconds); err != nil {
+			return nil, err
+		}
+		recs = append(recs, r)
+	}
+	return recs, rows.Err()
+}
+
+// getStats reports recording outcomes, hours and bitrate per channel and
+// per day, and the busiest hours of the day. ?from= and ?to= (YYYY-MM-DD)
+// limit it to recordings dated within them.
+func (a *App) getStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			http.Error(w, "from and to must be dates (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	recs, err := a.loadStatsRecordings(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	st := computeStats(recs)
+	st.From, st.To = from, to
+	st.Maintenance = a.lastMaintenance()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st) //nolint: errcheck
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	st := computeStats([]statsRecording{
+		{channelID: "5.1", date: "2024-01-02", startTime: "20:00", duration: 60, status: "completed", fileSize: 900_000_000, seconds: 3600},
+		{channelID: "5.1", date: "2024-01-02", startTime: "23:30", duration: 60, status: statusPartial, fileSize: 450_000_000, seconds: 1800},
+		{channelID: "5.1", date: "2024-01-03", startTime: "20:00", duration: 30, status: "failed"},
+		{channelID: "7.1", date: "2024-01-03", startTime: "08:15", duration: 30, status: statusArchived, fileSize: 100, seconds: 0},
+		{channelID: "7.1", date: "2024-01-03", startTime: "09:00", duration: 30, status: "cancelled"},
+	})
+
+	if tot := st.Totals; tot.Recordings != 4 || tot.Completed != 2 || tot.Partial != 1 || tot.Failed != 1 || tot.SuccessRate != 0.5 || tot.Hours != 1.5 {
+		t.Errorf("totals %+v", tot)
+	}
+	if len(st.Channels) != 2 || st.Channels[0].ChannelID != "5.1" {
+		t.Fatalf("channels %+v", st.Channels)
+	}
+	// 1.35 GB over 5400 s.
+	if ch := st.Channels[0]; ch.AvgBitrate != 2_000_000 || ch.Recordings != 3 {
+		t.Errorf("5.1: %+v", ch)
+	}
+	// Without a known length there is no bitrate.
+	if ch := st.Channels[1]; ch.AvgBitrate != 0 || ch.SuccessRate != 1 {
+		t.Errorf("7.1: %+v", ch)
+	}
+	if len(st.Days) != 2 || st.Days[0].Date != "2024-01-02" || st.Days[1].Failed != 1 {
+		t.Errorf("days %+v", st.Days)
+	}
+	// 23:30 for an hour runs into midnight.
+	if st.Hours[20] != 2 || st.Hours[23] != 1 || st.Hours[0] != 1 || st.Hours[8] != 1 || st.Hours[9] != 0 {
+		t.Errorf("hours %v", st.Hours)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if _, err := db.Exec(`INSERT INTO recordings (id, channel_id, date, start_time, duration, status, file_size) VALUES
+		(1, '5.1', '2024-01-02', '20:00', 60, 'completed', 1000),
+		(2, '5.1', '2024-02-02', '20:00', 60, 'failed', 0)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO recording_verifications (recording_id, video_streams, audio_streams, expected_seconds, measured_seconds, decode_errors)
+		VALUES (1, 1, 1, 3600, 1800, 0)`); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.getStats(rr, httptest.NewRequest("GET", "/api/stats?from=2024-01-01&to=2024-01-31", nil))
+	var st Stats
+	if err := json.NewDecoder(rr.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Totals.Recordings != 1 || st.Totals.Hours != 0.5 || st.From != "2024-01-01" {
+		t.Errorf("got %+v", st)
+	}
+
+	rr = httptest.NewRecorder()
+	app.getStats(rr, httptest.NewRequest("GET", "/api/stats?from=January", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("bad date: %d", rr.Code)
+	}
+}
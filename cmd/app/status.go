@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// Recording statuses. A recording is scheduled (stored as "pending", the
+// value clients already filter on), waiting while its capture is prepared,
+// recording, and then completed, partial, failed or cancelled. Finished
+// recordings may later be archived or go missing from disk; statusPartial,
+// statusArchived, statusMissing and statusInsufficientSpace are declared
+// with the features that set them.
+const (
+	statusPending   = "pending"
+	statusWaiting   = "waiting"
+	statusRecording = "recording"
+	statusCompleted = "completed"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+)
+
+// statusTransitions lists the statuses each status may move to. Failed,
+// cancelled and insufficient_space are final.
+var statusTransitions = map[string][]string{
+	statusPending:           {statusWaiting, statusRecording, statusCancelled, statusFailed, statusInsufficientSpace},
+	statusWaiting:           {statusPending, statusRecording, statusCancelled, statusFailed, statusInsufficientSpace},
+	statusRecording:         {statusCompleted, statusPartial, statusFailed, statusCancelled},
+	statusCompleted:         {statusPartial, statusArchived, statusMissing},
+	statusPartial:           {statusArchived, statusMissing},
+	statusArchived:          {statusMissing},
+	statusMissing:           {statusCompleted},
+	statusFailed:            {},
+	statusCancelled:         {},
+	statusInsufficientSpace: {},
+}
+
+// errInvalidTransition is returned for a status change the lifecycle does
+// not allow.
+var errInvalidTransition = errors.New("invalid status transition")
+
+// canTransition reports whether a recording may move from one status to
+// another. A status from before the lifecycle existed may move anywhere,
+// so old rows are not stuck.
+func canTransition(from, to string) bool {
+	if _, ok := statusTransitions[to]; !ok {
+		return false
+	}
+	next, ok := statusTransitions[from]
+	return !ok || slices.Contains(next, to)
+}
+
+// RecordingEvent is one status change of a recording. From is empty for
+// the event that created it.
+type RecordingEvent struct {
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// insertStatusEvent adds a status change of recording id to its history.
+func insertStatusEvent(ctx context.Context, tx types.Tx, id int64, from, to, reason string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO recording_events (recording_id, from_status, to_status, reason, created_at) VALUES (?, ?, ?, ?, ?)",
+		id, from, to, reason, time.Now().UTC())
+	return err
+}
+
+// setStatus moves recording id to status to and records the change, with
+// reason, in its history. Setting the status a recording already has does
+// nothing; a change the lifecycle does not allow fails with
+// errInvalidTransition and leaves the recording as it was.
+func (a *App) setStatus(ctx context.Context, id int, to, reason string) error {
+	tx, err := a.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	var from string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM recordings WHERE id = ?", id).Scan(&from); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if !canTransition(from, to) {
+		return fmt.Errorf("%w from %s to %s", errInvalidTransition, from, to)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE recordings SET status = ? WHERE id = ?", to, id); err != nil {
+		return err
+	}
+	if err := insertStatusEvent(ctx, tx, int64(id), from, to, reason); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Debug("Recording status changed", "recording_id", id, "from", from, "to", to, "reason", reason)
+	return nil
+}
+
+// recordingHistory returns the status changes of recording id, oldest
+// first.
+func (a *App) recordingHistory(ctx context.Context, id int) ([]RecordingEvent, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT from_status, to_status, reason, created_at FROM recording_events
+		WHERE recording_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+	events := []RecordingEvent{}
+	for rows.Next() {
+		var e RecordingEvent
+		if err := rows.Scan(&e.From, &e.To, &e.Reason, &e.At); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// getRecordingHistory serves GET /api/recordings/{id}/history.
+func (a *App) getRecordingHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := a.dbQueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM recordings WHERE id = ?)", id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	events, err := a.recordingHistory(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events) //nolint: errcheck
+}
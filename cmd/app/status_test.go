@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCanTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{
+		{statusPending, statusWaiting, true},
+		{statusWaiting, statusRecording, true},
+		{statusRecording, statusCompleted, true},
+		{statusCompleted, statusArchived, true},
+		{statusMissing, statusCompleted, true},
+		{statusCancelled, statusRecording, false},
+		{statusCompleted, statusPending, false},
+		{statusFailed, statusCompleted, false},
+		{statusPending, "bogus", false},
+		{"scheduled-by-hand", statusFailed, true},
+	} {
+		if got := canTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("canTransition(%s, %s) = %v", tc.from, tc.to, got)
+		}
+	}
+}
+
+func TestRecordingHistory(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	ctx := context.Background()
+
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct{ to, reason string }{
+		{statusWaiting, "start time reached"},
+		{statusRecording, "capture started"},
+		{statusRecording, "again"},
+		{statusCompleted, "capture finished"},
+	} {
+		if err := app.setStatus(ctx, 1, step.to, step.reason); err != nil {
+			t.Fatalf("to %s: %v", step.to, err)
+		}
+	}
+	if err := app.setStatus(ctx, 1, statusWaiting, "late"); !errors.Is(err, errInvalidTransition) {
+		t.Errorf("completed to waiting: %v", err)
+	}
+	var status string
+	db.QueryRow("SELECT status FROM recordings WHERE id = 1").Scan(&status) //nolint: errcheck
+	if status != statusCompleted {
+		t.Errorf("status %s after a refused change", status)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/recordings/{id}/history", app.getRecordingHistory).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/recordings/1/history", nil))
+	var events []RecordingEvent
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("history %d, %v", rr.Code, err)
+	}
+	// Setting the same status again leaves no event.
+	if len(events) != 3 || events[0].From != statusPending || events[0].To != statusWaiting ||
+		events[2].To != statusCompleted || events[2].Reason != "capture finished" || events[2].At.IsZero() {
+		t.Errorf("events %+v", events)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/recordings/2/history", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown recording: %d", rr.Code)
+	}
+}
+
+func TestCancelWaitingRecording(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'waiting', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.cancelRecording(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	// The capture being prepared must not start once cancelled.
+	if err := app.updateStatusWithRetry(1, statusRecording, "capture started"); !errors.Is(err, errInvalidTransition) {
+		t.Errorf("cancelled recording started: %v", err)
+	}
+	events, err := app.recordingHistory(context.Background(), 1)
+	if err != nil || len(events) != 1 || events[0].To != statusCancelled || events[0].Reason != "cancelled on request" {
+		t.Errorf("history %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync/atomic"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+const placementRoundRobin = "round-robin"
+
+// storageRoot is one directory recordings may be written to.
+type storageRoot struct {
+	dir   string
+	store storage.Storage
+}
+
+// extraStorageRoots returns the configured roots other than StorageDir,
+// which is always the primary root backed by App.storage.
+func extraStorageRoots(cfg *pkgcfg.Config) []storageRoot {
+	var roots []storageRoot
+	seen := map[string]bool{cfg.StorageDir: true}
+	for _, dir := range cfg.StorageDirs {
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		roots = append(roots, storageRoot{dir: dir, store: storage.NewLocal(dir)})
+	}
+	return roots
+}
+
+// storageRoots returns the primary root followed by the extra ones.
+func (a *App) storageRoots() []storageRoot {
+	return append([]storageRoot{{dir: a.cfg().StorageDir, store: a.storage}}, a.extraRoots...)
+}
+
+// pickStorageRoot chooses the root for a new recording according to
+// StoragePlacement. With "most-free", roots that cannot report free space
+// are only used when none can.
+func (a *App) pickStorageRoot() storageRoot {
+	roots := a.storageRoots()
+	if len(roots) == 1 {
+		return roots[0]
+	}
+	if a.cfg().StoragePlacement == placementRoundRobin {
+		n := atomic.AddUint32(&a.nextRoot, 1) - 1
+		return roots[int(n%uint32(len(roots)))]
+	}
+
+	best, bestFree := roots[0], int64(-1)
+	for _, root := range roots {
+		sr, ok := root.store.(storage.SpaceReporter)
+		if !ok {
+			continue
+		}
+		free, err := sr.FreeSpace()
+		if err != nil {
+			slog.Error("Error checking free space", "dir", root.dir, "err", err)
+			continue
+		}
+		if free > bestFree {
+			best, bestFree = root, free
+		}
+	}
+	return best
+}
+
+// assignStorageRoot picks a root for a recording and remembers it, so the
+// file can be found again after a restart.
+func (a *App) assignStorageRoot(ctx context.Context, recordingID int) (storageRoot, error) {
+	root := a.pickStorageRoot()
+	_, err := a.dbExecContext(ctx, "INSERT OR REPLACE INTO recording_storage (recording_id, root) VALUES (?, ?)", recordingID, root.dir)
+	return root, err
+}
+
+// recordingStorage returns the storage holding a recording's files.
+func (a *App) recordingStorage(ctx context.Context, recordingID int) storage.Storage {
+	var dir string
+	err := a.dbQueryRowContext(ctx, "SELECT root FROM recording_storage WHERE recording_id = ?", recordingID).Scan(&dir)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Error looking up storage root of recording", "recording_id", recordingID, "err", err)
+	}
+	return a.rootStorage(dir)
+}
+
+// rootStorage returns the storage for a root recorded in recording_storage.
+// Recordings made before a root was assigned (dir is empty) live on the
+// primary root, which also stands in for roots no longer configured.
+func (a *App) rootStorage(dir string) storage.Storage {
+	if dir == "" {
+		return a.storage
+	}
+	for _, root := range a.storageRoots() {
+		if root.dir == dir {
+			return root.store
+		}
+	}
+	slog.Warn("Storage root is no longer configured, using the default", "dir", dir, "default", a.cfg().StorageDir)
+	return a.storage
+}
+
+// freeSpaceAllRoots sums the free space of the roots that can report it.
+// ok is false when none can.
+func (a *App) freeSpaceAllRoots() (free int64, ok bool) {
+	for _, root := range a.storageRoots() {
+		sr, isReporter := root.store.(storage.SpaceReporter)
+		if !isReporter {
+			continue
+		}
+		n, err := sr.FreeSpace()
+		if err != nil {
+			slog.Error("Error checking free space", "dir", root.dir, "err", err)
+			continue
+		}
+		free += n
+		ok = true
+	}
+	return free, ok
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestExtraStorageRoots(t *testing.T) {
+	cfg := &pkgcfg.Config{StorageDir: "/mnt/a", StorageDirs: []string{"/mnt/a", "/mnt/b", "", "/mnt/b", "/mnt/c"}}
+	roots := extraStorageRoots(cfg)
+	if len(roots) != 2 || roots[0].dir != "/mnt/b" || roots[1].dir != "/mnt/c" {
+		t.Errorf("unexpected extra roots %+v", roots)
+	}
+}
+
+func TestPickStorageRoot(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	primary, second := storage.NewMemory(), storage.NewMemory()
+	primary.SetCapacity(100)
+	second.SetCapacity(200)
+	app.storage = primary
+	app.extraRoots = []storageRoot{{dir: "/mnt/b", store: second}}
+
+	if got := app.pickStorageRoot(); got.dir != "/mnt/b" {
+		t.Errorf("most-free picked %s, want /mnt/b", got.dir)
+	}
+	second.WriteFile("big.ts", make([]byte, 150))
+	if got := app.pickStorageRoot(); got.dir != app.config.StorageDir {
+		t.Errorf("most-free picked %s after filling /mnt/b", got.dir)
+	}
+
+	app.config.StoragePlacement = placementRoundRobin
+	var dirs []string
+	for i := 0; i < 3; i++ {
+		dirs = append(dirs, app.pickStorageRoot().dir)
+	}
+	if dirs[0] == dirs[1] || dirs[0] != dirs[2] {
+		t.Errorf("round-robin picked %v", dirs)
+	}
+}
+
+func TestRecordingStorageServesAssignedRoot(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	primary, second := storage.NewMemory(), storage.NewMemory()
+	primary.SetCapacity(100)
+	app.storage = primary
+	app.extraRoots = []storageRoot{{dir: "/mnt/b", store: second}}
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if got := app.recordingStorage(ctx, 1); got != primary {
+		t.Error("recordings without a root should use the primary root")
+	}
+	root, err := app.assignStorageRoot(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.dir != "/mnt/b" {
+		t.Fatalf("assigned %s, want /mnt/b", root.dir)
+	}
+	second.WriteFile("2026-03-01-20:00-News.mp4", []byte("video"))
+	title := "News"
+	app.storeLegacyFileNames(ctx)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/file", app.getRecordingFile).Methods("GET")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/file", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "video" {
+		t.Errorf("got %d %q, want the file from /mnt/b", rr.Code, rr.Body.String())
+	}
+
+	if err := app.removeRecordingFiles(ctx, types.Recording{ID: 1, Date: "2026-03-01", StartTime: "20:00", Title: &title}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Stat("2026-03-01-20:00-News.mp4"); err == nil {
+		t.Error("expected the file on /mnt/b to be deleted")
+	}
+}
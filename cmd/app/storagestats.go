@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+type StorageRecording struct {
+	ID        int     `json:"id"`
+	ChannelID string  `json:"channelId"`
+	Date      string  `json:"date"`
+	StartTime string  `json:"startTime"`
+	Title     *string `json:"title,omitempty"`
+	FileSize  int64   `json:"fileSize"`
+}
+
+// StorageRootStats is the capacity of one storage root.
+type StorageRootStats struct {
+	Dir        string `json:"dir"`
+	TotalBytes *int64 `json:"totalBytes,omitempty"`
+	FreeBytes  *int64 `json:"freeBytes,omitempty"`
+}
+
+// StorageStats describes the recording storage. TotalBytes and FreeBytes
+// sum the roots that can report capacity, and are omitted when none can.
+type StorageStats struct {
+	StorageDir      string             `json:"storageDir"`
+	TotalBytes      *int64             `json:"totalBytes,omitempty"`
+	FreeBytes       *int64             `json:"freeBytes,omitempty"`
+	Roots           []StorageRootStats `json:"roots"`
+	RecordingsBytes int64              `json:"recordingsBytes"`
+	Counts          map[string]int     `json:"counts"`
+	Largest         []StorageRecording `json:"largest"`
+}
+
+// getStorageStats reports capacity, space used by recordings, recording
+// counts by status and the largest recordings (?top=N, default 10).
+func (a *App) getStorageStats(w http.ResponseWriter, r *http.Request) {
+	top := 10
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 1000 {
+			http.Error(w, "Invalid top", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	stats := StorageStats{
+		StorageDir: a.cfg().StorageDir,
+		Counts:     make(map[string]int),
+		Largest:    []StorageRecording{},
+	}
+	for _, root := range a.storageRoots() {
+		rs := StorageRootStats{Dir: root.dir}
+		if sr, ok := root.store.(storage.SpaceReporter); ok {
+			if total, err := sr.TotalSpace(); err == nil {
+				rs.TotalBytes = &total
+				stats.TotalBytes = addBytes(stats.TotalBytes, total)
+			} else {
+				requestLogger(r).Error("Error reading capacity", "dir", root.dir, "err", err)
+			}
+			if free, err := sr.FreeSpace(); err == nil {
+				rs.FreeBytes = &free
+				stats.FreeBytes = addBytes(stats.FreeBytes, free)
+			} else {
+				requestLogger(r).Error("Error reading free space", "dir", root.dir, "err", err)
+			}
+		}
+		stats.Roots = append(stats.Roots, rs)
+	}
+
+	ctx := r.Context()
+	rows, err := a.dbQueryContext(ctx, "SELECT status, COUNT(*), COALESCE(SUM(file_size), 0) FROM recordings GROUP BY status")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		var size int64
+		if err := rows.Scan(&status, &count, &size); err != nil {
+			rows.Close() //nolint: errcheck
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats.Counts[status] = count
+		stats.RecordingsBytes += size
+	}
+	rows.Close() //nolint: errcheck
+
+	rows, err = a.dbQueryContext(ctx, `
+		SELECT id, channel_id, date, start_time, title, file_size
+		FROM recordings
+		WHERE file_size > 0
+		ORDER BY file_size DESC
+		LIMIT ?`, top)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+	for rows.Next() {
+		var rec StorageRecording
+		if err := rows.Scan(&rec.ID, &rec.ChannelID, &rec.Date, &rec.StartTime, &rec.Title, &rec.FileSize); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats.Largest = append(stats.Largest, rec)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(r).Error("Error iterating recordings", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats) //nolint: errcheck
+}
+
+// addBytes adds n to an optional byte count.
+func addBytes(sum *int64, n int64) *int64 {
+	if sum != nil {
+		n += *sum
+	}
+	return &n
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestGetStorageStats(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	mem := storage.NewMemory()
+	mem.SetCapacity(10000)
+	mem.WriteFile("a.mp4", make([]byte, 4000))
+	app.storage = mem
+
+	if _, err := db.Exec(`INSERT INTO recordings (channel_id, date, start_time, duration, status, title, file_size) VALUES
+		('5.1', '2026-03-01', '20:00', 60, 'completed', 'Big', 3000),
+		('5.1', '2026-03-02', '20:00', 60, 'completed', 'Small', 1000),
+		('5.1', '2026-03-03', '20:00', 60, 'failed', 'Partial', 500),
+		('5.1', '2026-04-01', '20:00', 60, 'pending', 'Later', 0)`); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.getStorageStats(rr, httptest.NewRequest("GET", "/api/storage?top=2", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var stats StorageStats
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalBytes == nil || *stats.TotalBytes != 10000 || stats.FreeBytes == nil || *stats.FreeBytes != 6000 {
+		t.Errorf("unexpected capacity %v / %v", stats.TotalBytes, stats.FreeBytes)
+	}
+	if stats.RecordingsBytes != 4500 {
+		t.Errorf("recordingsBytes = %d, want 4500", stats.RecordingsBytes)
+	}
+	if stats.Counts["completed"] != 2 || stats.Counts["failed"] != 1 || stats.Counts["pending"] != 1 {
+		t.Errorf("unexpected counts %v", stats.Counts)
+	}
+	if len(stats.Largest) != 2 || *stats.Largest[0].Title != "Big" || *stats.Largest[1].Title != "Small" {
+		t.Errorf("unexpected largest %+v", stats.Largest)
+	}
+
+	rr = httptest.NewRecorder()
+	app.getStorageStats(rr, httptest.NewRequest("GET", "/api/storage?top=-1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
@@ -6,12 +6,19 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
 	"github.com/prziborowski/hdhr-dvr/pkg/types"
 )
 
 type Commander interface {
 	RunCommand(name string, args ...string) error
+	// Output runs a command and returns its standard output.
+	Output(name string, args ...string) ([]byte, error)
+	// RunWithEnv runs a command with env added to the environment and
+	// returns its combined standard output and error.
+	RunWithEnv(env []string, name string, args ...string) ([]byte, error)
 	StartCommand(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error)
 	Stat(path string) (os.FileInfo, error)
 	MkdirAll(path string, perm os.FileMode) error
@@ -21,15 +28,45 @@ type Commander interface {
 	ReadFile(path string) ([]byte, error)
 }
 
-type RealCommander struct{}
+// RealCommander runs programs and touches files for real. Paths maps a
+// program name such as "ffmpeg" to the executable to run for it.
+type RealCommander struct {
+	Paths map[string]string
+}
+
+// command builds an exec.Cmd with name, and the program nice is asked to
+// run, replaced from Paths.
+func (c *RealCommander) command(name string, args ...string) *exec.Cmd {
+	if name == "nice" && len(args) > 2 && args[0] == "-n" {
+		args = append([]string{args[0], args[1], c.path(args[2])}, args[3:]...)
+	}
+	return exec.Command(c.path(name), args...)
+}
+
+func (c *RealCommander) path(name string) string {
+	if p := c.Paths[name]; p != "" {
+		return p
+	}
+	return name
+}
 
 func (c *RealCommander) RunCommand(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
+	cmd := c.command(name, args...)
 	return cmd.Run()
 }
 
+func (c *RealCommander) Output(name string, args ...string) ([]byte, error) {
+	return c.command(name, args...).Output()
+}
+
+func (c *RealCommander) RunWithEnv(env []string, name string, args ...string) ([]byte, error) {
+	cmd := c.command(name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
 func (c *RealCommander) StartCommand(name string, stdout, stderr io.Writer, args ...string) (*exec.Cmd, error) {
-	cmd := exec.Command(name, args...)
+	cmd := c.command(name, args...)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	return cmd, nil
@@ -79,6 +116,55 @@ func (s *SQLStore) QueryRowContext(ctx context.Context, query string, args ...in
 	return s.db.QueryRowContext(ctx, query, args...)
 }
 
+func (s *SQLStore) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.db.PrepareContext(ctx, query)
+}
+
 func (s *SQLStore) BeginTx(ctx context.Context, opts *sql.TxOptions) (types.Tx, error) {
 	return s.db.BeginTx(ctx, opts)
 }
+
+// sqliteParams are the connection settings every connection to the
+// database is opened with. WAL lets the scheduler read while the API
+// writes, the busy timeout makes a writer wait for the lock instead of
+// failing with "database is locked", and immediate transactions take the
+// write lock at BEGIN, where waiting for it cannot deadlock.
+const sqliteParams = "_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on&_txlock=immediate"
+
+// openDatabase opens the database cfg selects and the store to reach it
+// through.
+func openDatabase(cfg *pkgcfg.Config) (*sql.DB, types.Store, error) {
+	if cfg.DBDriver != driverPostgres {
+		db, err := openDB(cfg.DBPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, types.NewStoreAdapter(db), nil
+	}
+	db, err := sql.Open(driverPostgres, cfg.DBDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	return db, newPostgresStore(db), nil
+}
+
+// openDB opens the SQLite database at path with sqliteParams.
+func openDB(path string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open(driverSQLite, path+sep+sqliteParams)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer however many connections there are; a few
+	// let readers run alongside it. Idle connections are kept so the
+	// settings above are not reapplied on every query.
+	db.SetMaxOpenConns(4)
+	db.SetMaxIdleConns(4)
+	db.SetConnMaxLifetime(0)
+	return db, nil
+}
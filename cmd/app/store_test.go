@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestRealCommanderPaths(t *testing.T) {
+	c := &RealCommander{Paths: map[string]string{"ffmpeg": "/opt/ffmpeg/bin/ffmpeg"}}
+
+	if got := strings.Join(c.command("ffmpeg", "-i", "in.ts").Args, " "); got != "/opt/ffmpeg/bin/ffmpeg -i in.ts" {
+		t.Errorf("got %q", got)
+	}
+	if got := strings.Join(c.command("nice", "-n", "10", "ffmpeg", "-i", "in.ts").Args, " "); !strings.HasSuffix(got, "-n 10 /opt/ffmpeg/bin/ffmpeg -i in.ts") {
+		t.Errorf("through nice: %q", got)
+	}
+	if got := c.command("ffprobe").Args[0]; got != "ffprobe" {
+		t.Errorf("unmapped program: %q", got)
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	db, err := openDB(filepath.Join(t.TempDir(), "recordings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() //nolint: errcheck
+
+	for pragma, want := range map[string]string{"journal_mode": "wal", "busy_timeout": "5000", "foreign_keys": "1"} {
+		var got string
+		if err := db.QueryRow("PRAGMA " + pragma).Scan(&got); err != nil || got != want {
+			t.Errorf("%s = %q, %v; want %q", pragma, got, err, want)
+		}
+	}
+
+	// Deleting a recording with side rows must get past the foreign keys.
+	app := NewApp(&pkgcfg.Config{Timezone: "UTC"}, NewSQLStore(db), &MockCommander{})
+	app.createTables()
+	for _, stmt := range []string{
+		"INSERT INTO channels (guide_number, guide_name, url, enabled) VALUES ('5.1', 'KPIX', 'http://tuner/auto/v5.1', 1)",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')",
+		"INSERT INTO recording_files (recording_id, path) VALUES (1, 'news.mp4')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM recordings WHERE id = 1"); err == nil {
+		t.Error("foreign keys not enforced")
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/recordings/{id}", app.deleteRecording).Methods("DELETE")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/recordings/1", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("delete: %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestPendingRecordings(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	for _, stmt := range []string{
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-02', '20:00', 60, 'pending', 'News')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (2, '5.1', '2026-03-01', '21:00', 30, 'pending', 'Late')",
+		"INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (3, '5.1', '2026-03-01', '19:00', 30, 'completed', 'Done')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var plan string
+	rows, err := db.Query("EXPLAIN QUERY PLAN " + pendingRecordingsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		rows.Scan(&id, &parent, &notused, &detail) //nolint: errcheck
+		plan += detail + "\n"
+	}
+	rows.Close() //nolint: errcheck
+	if !strings.Contains(plan, "idx_recordings_status_start") {
+		t.Errorf("pending query does not use the index:\n%s", plan)
+	}
+
+	ctx := context.Background()
+	first, err := app.pendingRecordings(ctx, nil)
+	if err != nil || len(first) != 2 || first[0].ID != 2 || first[1].ID != 1 {
+		t.Fatalf("pending %v, %v", first, err)
+	}
+	known := map[int]*types.Recording{1: first[1], 2: first[0]}
+
+	// A changed duration keeps the cached recording; a new start replaces it.
+	if _, err := db.Exec("UPDATE recordings SET duration = 90 WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE recordings SET start_time = '22:00' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := app.pendingRecordings(ctx, known)
+	if err != nil || len(second) != 2 {
+		t.Fatalf("pending %v, %v", second, err)
+	}
+	if second[1] != known[1] || second[1].Duration != 90 {
+		t.Errorf("unchanged recording not reused: %+v", second[1])
+	}
+	if second[0] == known[2] || second[0].StartTime != "22:00" {
+		t.Errorf("rescheduled recording reused: %+v", second[0])
+	}
+	if s1, _ := app.dbPrepared(ctx, pendingRecordingsQuery); s1 == nil || len(app.stmts) != 1 {
+		t.Errorf("statement prepared %d times", len(app.stmts))
+	}
+}
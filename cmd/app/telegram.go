@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// telegramAPI is the Bot API root; tests point it at a local server.
+var telegramAPI = "https://api.telegram.org"
+
+// telegramDefaultEvents are the alerts sent to the bot's chats unless
+// configured otherwise.
+var telegramDefaultEvents = []string{eventRecordingFailed, eventDiskLow}
+
+const (
+	// telegramPollSeconds is how long a getUpdates long poll waits.
+	telegramPollSeconds = 30
+	// telegramListLimit bounds the recordings and programs listed at once.
+	telegramListLimit = 10
+)
+
+const telegramHelp = `Commands:
+/upcoming - the next scheduled recordings
+/search <words> - find programs in the guide to record
+/cancel <id> - cancel or stop a recording`
+
+// telegramBot answers chat commands and sends alerts to its chats.
+type telegramBot struct {
+	app    *App
+	token  string
+	chats  []int64
+	events []string
+	client *http.Client
+}
+
+func newTelegramBot(app *App, cfg pkgcfg.Telegram) *telegramBot {
+	events := cfg.Events
+	if len(events) == 0 {
+		events = telegramDefaultEvents
+	}
+	return &telegramBot{
+		app:    app,
+		token:  cfg.Token,
+		chats:  cfg.ChatIDs,
+		events: events,
+		client: &http.Client{Timeout: (telegramPollSeconds + 15) * time.Second},
+	}
+}
+
+// entry is the bot as a notification provider.
+func (b *telegramBot) entry() notifierEntry {
+	return notifierEntry{notifier: b, events: b.events}
+}
+
+func (b *telegramBot) name() string { return "telegram" }
+
+type telegramChat struct {
+	ID int64 `json:"id"`
+}
+
+type telegramMessage struct {
+	Chat telegramChat `json:"chat"`
+	Text string       `json:"text"`
+}
+
+type telegramCallback struct {
+	ID      string           `json:"id"`
+	Data    string           `json:"data"`
+	Message *telegramMessage `json:"message"`
+}
+
+type telegramUpdate struct {
+	UpdateID      int               `json:"update_id"`
+	Message       *telegramMessage  `json:"message"`
+	CallbackQuery *telegramCallback `json:"callback_query"`
+}
+
+type telegramButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// call invokes a Bot API method and decodes its result into out.
+func (b *telegramBot) call(ctx context.Context, method string, params, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", telegramAPI+"/bot"+b.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The URL holds the token; keep it out of logs.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	var r struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("telegram %s: %s", method, resp.Status)
+	}
+	if !r.OK {
+		return fmt.Errorf("telegram %s: %s", method, r.Description)
+	}
+	if out != nil {
+		return json.Unmarshal(r.Result, out)
+	}
+	return nil
+}
+
+// send posts text to a chat, with one row per button.
+func (b *telegramBot) send(ctx context.Context, chat int64, text string, buttons []telegramButton) error {
+	params := map[string]interface{}{"chat_id": chat, "text": text}
+	if len(buttons) > 0 {
+		rows := make([][]telegramButton, len(buttons))
+		for i, btn := range buttons {
+			rows[i] = []telegramButton{btn}
+		}
+		params["reply_markup"] = map[string]interface{}{"inline_keyboard": rows}
+	}
+	return b.call(ctx, "sendMessage", params, nil)
+}
+
+func (b *telegramBot) notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, chat := range b.chats {
+		if err := b.send(ctx, chat, n.Subject+"\n"+n.Message, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *telegramBot) allowed(chat int64) bool {
+	for _, c := range b.chats {
+		if c == chat {
+			return true
+		}
+	}
+	return false
+}
+
+// run polls for updates until ctx is done.
+func (b *telegramBot) run(ctx context.Context) {
+	offset := 0
+	for ctx.Err() == nil {
+		var updates []telegramUpdate
+		err := b.call(ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         telegramPollSeconds,
+			"allowed_updates": []string{"message", "callback_query"},
+		}, &updates)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Error polling Telegram", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			b.handleUpdate(ctx, u)
+		}
+	}
+}
+
+// handleUpdate answers one message or button press.
+func (b *telegramBot) handleUpdate(ctx context.Context, u telegramUpdate) {
+	var chat int64
+	switch {
+	case u.Message != nil:
+		chat = u.Message.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
+		chat = u.CallbackQuery.Message.Chat.ID
+	default:
+		return
+	}
+	if !b.allowed(chat) {
+		slog.Warn("Ignoring Telegram message from a chat not in telegram.chatIds", "chat", chat)
+		if u.Message != nil {
+			b.send(ctx, chat, fmt.Sprintf("This chat (ID %d) is not allowed to use this DVR.", chat), nil) //nolint: errcheck
+		}
+		return
+	}
+
+	var text string
+	var buttons []telegramButton
+	if u.CallbackQuery != nil {
+		text = b.handleButton(ctx, u.CallbackQuery.Data)
+		b.call(ctx, "answerCallbackQuery", map[string]interface{}{"callback_query_id": u.CallbackQuery.ID}, nil) //nolint: errcheck
+	} else {
+		text, buttons = b.handleCommand(ctx, u.Message.Text)
+	}
+	if err := b.send(ctx, chat, text, buttons); err != nil {
+		slog.Error("Error answering Telegram chat", "chat", chat, "err", err)
+	}
+}
+
+// handleCommand answers a text message.
+func (b *telegramBot) handleCommand(ctx context.Context, text string) (string, []telegramButton) {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(text), " ")
+	// Commands in groups may be addressed as /upcoming@botname.
+	cmd, _, _ = strings.Cut(cmd, "@")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "/upcoming":
+		return b.upcoming(ctx)
+	case "/search":
+		return b.search(ctx, arg)
+	case "/cancel":
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return "Usage: /cancel <recording id>", nil
+		}
+		return b.cancel(ctx, id), nil
+	}
+	return telegramHelp, nil
+}
+
+// handleButton carries out an inline button: "cancel:<id>" or
+// "rec:<channel>|<unix start>".
+func (b *telegramBot) handleButton(ctx context.Context, data string) string {
+	action, arg, _ := strings.Cut(data, ":")
+	switch action {
+	case "cancel":
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return "Unknown recording"
+		}
+		return b.cancel(ctx, id)
+	case "rec":
+		channel, start, _ := strings.Cut(arg, "|")
+		unix, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			return "Unknown program"
+		}
+		return b.record(ctx, channel, time.Unix(unix, 0))
+	}
+	return "Unknown action"
+}
+
+func (b *telegramBot) upcoming(ctx context.Context) (string, []telegramButton) {
+	rows, err := b.app.dbQueryContext(ctx, `
+		SELECT id, channel_id, date, start_time, duration, COALESCE(title, '')
+		FROM recordings WHERE status = 'pending'
+		ORDER BY date, start_time LIMIT ?`, telegramListLimit)
+	if err != nil {
+		return "Could not load recordings: " + err.Error(), nil
+	}
+	defer rows.Close() //nolint: errcheck
+	var lines []string
+	var buttons []telegramButton
+	for rows.Next() {
+		var r types.Recording
+		var title string
+		if err := rows.Scan(&r.ID, &r.ChannelID, &r.Date, &r.StartTime, &r.Duration, &title); err != nil {
+			return "Could not load recordings: " + err.Error(), nil
+		}
+		if title == "" {
+			title = "Recording " + strconv.Itoa(r.ID)
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s %s on %s (%d min) %s", r.ID, r.Date, r.StartTime, r.ChannelID, r.Duration, title))
+		buttons = append(buttons, telegramButton{Text: "Cancel #" + strconv.Itoa(r.ID), CallbackData: "cancel:" + strconv.Itoa(r.ID)})
+	}
+	if len(lines) == 0 {
+		return "Nothing is scheduled.", nil
+	}
+	return "Upcoming recordings:\n" + strings.Join(lines, "\n"), buttons
+}
+
+func (b *telegramBot) search(ctx context.Context, q string) (string, []telegramButton) {
+	match := searchMatchExpr(q)
+	if match == "" {
+		return "Usage: /search <words>", nil
+	}
+	progs, err := b.app.searchPrograms(ctx, match, telegramListLimit)
+	if err != nil {
+		return "Search failed: " + err.Error(), nil
+	}
+	if len(progs) == 0 {
+		return "No upcoming programs match.", nil
+	}
+	loc, _ := b.app.getLocalLocation()
+	var lines []string
+	var buttons []telegramButton
+	for i, p := range progs {
+		start, err := time.Parse(time.RFC3339, p.Start)
+		if err != nil {
+			continue
+		}
+		title := programTitle(p)
+		lines = append(lines, fmt.Sprintf("%d. %s %s on %s", i+1, start.In(loc).Format("Mon Jan 2 15:04"), title, p.Channel))
+		buttons = append(buttons, telegramButton{
+			Text:         fmt.Sprintf("Record %d. %s", i+1, p.Title),
+			CallbackData: fmt.Sprintf("rec:%s|%d", p.Channel, start.Unix()),
+		})
+	}
+	return strings.Join(lines, "\n"), buttons
+}
+
+// programTitle is the title a recording of p gets, as in the web UI.
+func programTitle(p types.Program) string {
+	if p.SubTitle != "" {
+		return p.Title + " - " + p.SubTitle
+	}
+	return p.Title
+}
+
+func (b *telegramBot) record(ctx context.Context, channel string, start time.Time) string {
+	loc, _ := b.app.getLocalLocation()
+	date, startTime := start.In(loc).Format("2006-01-02"), start.In(loc).Format("15:04")
+	p, ok := b.app.findGuideProgram(channel, date, startTime)
+	if !ok {
+		return "That program is no longer in the guide."
+	}
+	title := programTitle(p)
+	req := RecordingRequest{ChannelID: channel, Date: date, StartTime: startTime, Duration: p.Duration, Title: &title}
+	if p.ID != "" {
+		req.ProgramID = &p.ID
+	}
+	rec, err := b.app.scheduleRecording(ctx, req)
+	if err != nil {
+		return "Could not schedule " + title + ": " + err.Error()
+	}
+	return fmt.Sprintf("Scheduled #%d %s, %s %s on %s.", rec.ID, title, date, startTime, channel)
+}
+
+func (b *telegramBot) cancel(ctx context.Context, id int) string {
+	if err := b.app.cancelRecording(ctx, id); err != nil {
+		return fmt.Sprintf("Could not cancel #%d: %v", id, err)
+	}
+	return fmt.Sprintf("Cancelled #%d.", id)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// telegramMessages records the sendMessage calls made to a fake Bot API.
+type telegramMessages struct {
+	sent []map[string]interface{}
+}
+
+func (m *telegramMessages) last(t *testing.T) (int64, string, []string) {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("no message sent")
+	}
+	msg := m.sent[len(m.sent)-1]
+	var data []string
+	if markup, ok := msg["reply_markup"].(map[string]interface{}); ok {
+		for _, row := range markup["inline_keyboard"].([]interface{}) {
+			btn := row.([]interface{})[0].(map[string]interface{})
+			data = append(data, btn["callback_data"].(string))
+		}
+	}
+	return int64(msg["chat_id"].(float64)), msg["text"].(string), data
+}
+
+func setupTelegram(t *testing.T, app *App) (*telegramBot, *telegramMessages) {
+	t.Helper()
+	msgs := &telegramMessages{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			var params map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&params) //nolint: errcheck
+			msgs.sent = append(msgs.sent, params)
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`)) //nolint: errcheck
+	}))
+	t.Cleanup(srv.Close)
+	old := telegramAPI
+	telegramAPI = srv.URL
+	t.Cleanup(func() { telegramAPI = old })
+	return newTelegramBot(app, pkgcfg.Telegram{Token: "123:abc", ChatIDs: []int64{42}}), msgs
+}
+
+func telegramText(chat int64, text string) telegramUpdate {
+	return telegramUpdate{Message: &telegramMessage{Chat: telegramChat{ID: chat}, Text: text}}
+}
+
+func telegramPress(chat int64, data string) telegramUpdate {
+	return telegramUpdate{CallbackQuery: &telegramCallback{ID: "q", Data: data, Message: &telegramMessage{Chat: telegramChat{ID: chat}}}}
+}
+
+func TestTelegramUpcomingAndCancel(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	bot, msgs := setupTelegram(t, app)
+	ctx := context.Background()
+
+	bot.handleUpdate(ctx, telegramText(42, "/upcoming"))
+	if _, text, _ := msgs.last(t); text != "Nothing is scheduled." {
+		t.Errorf("got %q", text)
+	}
+
+	res, err := db.Exec("INSERT INTO recordings (channel_id, date, start_time, duration, status, title) VALUES ('5.1', '2030-01-02', '20:00', 60, 'pending', 'Nova')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+
+	bot.handleUpdate(ctx, telegramText(42, "/upcoming@dvr_bot"))
+	chat, text, buttons := msgs.last(t)
+	if chat != 42 || !strings.Contains(text, "2030-01-02 20:00 on 5.1 (60 min) Nova") {
+		t.Errorf("got %d %q", chat, text)
+	}
+	if len(buttons) != 1 || buttons[0] != "cancel:1" {
+		t.Fatalf("buttons %v", buttons)
+	}
+
+	bot.handleUpdate(ctx, telegramPress(42, buttons[0]))
+	if _, text, _ := msgs.last(t); text != "Cancelled #1." {
+		t.Errorf("got %q", text)
+	}
+	var status string
+	if err := db.QueryRow("SELECT status FROM recordings WHERE id = ?", id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "cancelled" {
+		t.Errorf("status %s", status)
+	}
+
+	bot.handleUpdate(ctx, telegramText(42, "/cancel 1"))
+	if _, text, _ := msgs.last(t); !strings.Contains(text, "Could not cancel #1") {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestTelegramSearchAndRecord(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	bot, msgs := setupTelegram(t, app)
+	ctx := context.Background()
+
+	if _, err := db.Exec("INSERT INTO channels (guide_number, guide_name) VALUES ('5.1', 'PBS')"); err != nil {
+		t.Fatal(err)
+	}
+	app.enabledChannels = map[string]bool{"5.1": true}
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+	prog := types.Program{
+		ID:       "EP1",
+		Channel:  "5.1",
+		Title:    "Nova",
+		SubTitle: "Black Holes",
+		Start:    start.Format(time.RFC3339),
+		End:      start.Add(time.Hour).Format(time.RFC3339),
+		Duration: 60,
+	}
+	if err := app.indexGuide([]types.Program{prog}); err != nil {
+		t.Fatal(err)
+	}
+	app.guideData.Programs = []types.Program{prog}
+
+	bot.handleUpdate(ctx, telegramText(42, "/search"))
+	if _, text, _ := msgs.last(t); !strings.HasPrefix(text, "Usage") {
+		t.Errorf("got %q", text)
+	}
+
+	bot.handleUpdate(ctx, telegramText(42, "/search nova"))
+	_, text, buttons := msgs.last(t)
+	if !strings.Contains(text, "Nova - Black Holes on 5.1") || len(buttons) != 1 {
+		t.Fatalf("got %q %v", text, buttons)
+	}
+
+	bot.handleUpdate(ctx, telegramPress(42, buttons[0]))
+	<-recordingCh
+	if _, text, _ := msgs.last(t); !strings.HasPrefix(text, "Scheduled #1 Nova - Black Holes") {
+		t.Errorf("got %q", text)
+	}
+	var title string
+	var duration int
+	if err := db.QueryRow("SELECT title, duration FROM recordings WHERE id = 1").Scan(&title, &duration); err != nil {
+		t.Fatal(err)
+	}
+	if title != "Nova - Black Holes" || duration != 60 {
+		t.Errorf("recorded %q for %d minutes", title, duration)
+	}
+
+	bot.handleUpdate(ctx, telegramPress(42, buttons[0]))
+	if _, text, _ := msgs.last(t); !strings.Contains(text, "already exists") {
+		t.Errorf("second press: got %q", text)
+	}
+}
+
+func TestTelegramRejectsUnknownChats(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	bot, msgs := setupTelegram(t, app)
+
+	bot.handleUpdate(context.Background(), telegramText(7, "/upcoming"))
+	if chat, text, _ := msgs.last(t); chat != 7 || !strings.Contains(text, "ID 7") {
+		t.Errorf("got %d %q", chat, text)
+	}
+	bot.handleUpdate(context.Background(), telegramPress(7, "cancel:1"))
+	if len(msgs.sent) != 1 {
+		t.Errorf("button press from an unknown chat answered: %v", msgs.sent)
+	}
+}
+
+func TestTelegramNotify(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	bot, msgs := setupTelegram(t, app)
+
+	e := bot.entry()
+	if !e.wants(eventRecordingFailed) || e.wants(eventRecordingCompleted) {
+		t.Errorf("default events %v", bot.events)
+	}
+	n := Notification{Event: eventRecordingFailed, Subject: "Recording failed", Message: "Could not record News"}
+	if err := bot.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if chat, text, _ := msgs.last(t); chat != 42 || text != "Recording failed\nCould not record News" {
+		t.Errorf("got %d %q", chat, text)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// selfSignedValidity is how long a generated certificate is valid.
+	selfSignedValidity = 365 * 24 * time.Hour
+	// selfSignedRenewBefore is how close to expiry a generated certificate
+	// is replaced at startup.
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// certValidUntil returns when the certificate in certFile expires, or an
+// error when it and keyFile are not a usable pair.
+func certValidUntil(certFile, keyFile string) (time.Time, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// selfSignedNames returns the host names and addresses a generated
+// certificate is issued for: localhost, this host's name, and the address
+// of each network interface.
+func selfSignedNames() ([]string, []net.IP) {
+	dns := []string{"localhost"}
+	if host, err := os.Hostname(); err == nil && host != "" && host != "localhost" {
+		dns = append(dns, host)
+		if !strings.Contains(host, ".") {
+			dns = append(dns, host+".local")
+		}
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	return dns, ips
+}
+
+// ensureSelfSignedCert writes a self-signed certificate and its key to
+// certFile and keyFile unless they already hold a pair valid for at least
+// selfSignedRenewBefore after now.
+func ensureSelfSignedCert(certFile, keyFile string, now time.Time) error {
+	if notAfter, err := certValidUntil(certFile, keyFile); err == nil && notAfter.After(now.Add(selfSignedRenewBefore)) {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	dns, ips := selfSignedNames()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "hdhr-dvr", Organization: []string{"hdhr-dvr"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dns,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		name  string
+		block *pem.Block
+		perm  os.FileMode
+	}{
+		{keyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}, 0o600},
+		{certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}, 0o644},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.name), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.name, pem.EncodeToMemory(f.block), f.perm); err != nil {
+			return err
+		}
+	}
+	sum := sha256.Sum256(der)
+	slog.Info("Generated self-signed TLS certificate", "cert", certFile, "names", dns,
+		"expires", template.NotAfter.Format("2006-01-02"), "sha256", fmt.Sprintf("%X", sum))
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls", "cert.pem"), filepath.Join(dir, "tls", "key.pem")
+	now := time.Now()
+
+	if err := ensureSelfSignedCert(certFile, keyFile, now); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode %v, %v", info.Mode(), err)
+	}
+
+	// A valid certificate is kept; one about to expire is replaced.
+	first, _ := os.ReadFile(certFile)
+	if err := ensureSelfSignedCert(certFile, keyFile, now.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(certFile); !bytes.Equal(first, again) {
+		t.Error("valid certificate was replaced")
+	}
+	if err := ensureSelfSignedCert(certFile, keyFile, now.Add(selfSignedValidity-selfSignedRenewBefore/2)); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(certFile); bytes.Equal(first, again) {
+		t.Error("expiring certificate was kept")
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// Transcode job statuses.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+)
+
+// transcodeNice is the niceness transcodes run at, so that live captures
+// keep the CPU they need.
+const transcodeNice = "10"
+
+// TranscodeProfile describes a transcode target. VideoBitrate and
+// AudioBitrate use ffmpeg notation ("2M", "128k"); empty leaves the
+// encoder's default. Height scales the video, keeping its aspect ratio;
+// 0 keeps the source resolution.
+type TranscodeProfile struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	VideoCodec   string `json:"videoCodec"`
+	VideoBitrate string `json:"videoBitrate,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	AudioCodec   string `json:"audioCodec"`
+	AudioBitrate string `json:"audioBitrate,omitempty"`
+}
+
+// TranscodeJob is a queued, running or finished transcode of a recording.
+// Output is the produced file, relative to the recording's storage root.
+type TranscodeJob struct {
+	ID          int    `json:"id"`
+	RecordingID int    `json:"recordingId"`
+	Profile     string `json:"profile"`
+	Status      string `json:"status"`
+	Output      string `json:"output,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	StartedAt   string `json:"startedAt,omitempty"`
+	FinishedAt  string `json:"finishedAt,omitempty"`
+}
+
+// transcodeArgs returns the ffmpeg arguments that transcode input to output
+// with p.
+func transcodeArgs(p TranscodeProfile, input, output string) []string {
+	args := []string{"-i", input, "-map", "0:v:0", "-map", "0:a?", "-c:v", p.VideoCodec}
+	if p.VideoBitrate != "" {
+		args = append(args, "-b:v", p.VideoBitrate)
+	}
+	if p.Height > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", p.Height))
+	}
+	args = append(args, "-c:a", p.AudioCodec)
+	if p.AudioBitrate != "" {
+		args = append(args, "-b:a", p.AudioBitrate)
+	}
+	return append(args, "-movflags", "+faststart", "-y", output)
+}
+
+// transcodeOutputName returns the name of the file profile produces from the
+// recording file name.
+func transcodeOutputName(name, profile string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + sanitizeFilenamePart(profile) + ".mp4"
+}
+
+// wakeTranscodeWorkers tells an idle worker there may be a job to claim.
+func (a *App) wakeTranscodeWorkers() {
+	select {
+	case a.transcodeWake <- struct{}{}:
+	default:
+	}
+}
+
+// startTranscodeWorkers requeues jobs interrupted by a restart and starts
+// the configured number of workers.
+func (a *App) startTranscodeWorkers(ctx context.Context) {
+	if _, err := a.dbExecContext(ctx, "UPDATE transcode_jobs SET status = ?, started_at = NULL WHERE status = ?", jobQueued, jobRunning); err != nil {
+		slog.Error("Error requeuing interrupted transcode jobs", "err", err)
+	}
+	workers := a.cfg().Transcode.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				for a.runNextTranscode(ctx) {
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-a.transcodeWake:
+				case <-time.After(time.Minute):
+				}
+			}
+		}()
+	}
+	a.wakeTranscodeWorkers()
+}
+
+// runNextTranscode claims the oldest queued job and runs it. It reports
+// whether there may be more work.
+func (a *App) runNextTranscode(ctx context.Context) bool {
+	var id int
+	err := a.dbQueryRowContext(ctx, "SELECT id FROM transcode_jobs WHERE status = ? ORDER BY id LIMIT 1", jobQueued).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		slog.Error("Error looking for transcode jobs", "err", err)
+		return false
+	}
+	res, err := a.dbExecContext(ctx, "UPDATE transcode_jobs SET status = ?, started_at = ? WHERE id = ? AND status = ?",
+		jobRunning, time.Now().UTC(), id, jobQueued)
+	if err != nil {
+		slog.Error("Error claiming transcode job", "job_id", id, "err", err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Another worker claimed it first.
+		return true
+	}
+	// Let another idle worker look for the next job while this one runs.
+	a.wakeTranscodeWorkers()
+
+	output, err := a.runTranscode(ctx, id)
+	status, errMsg := jobCompleted, ""
+	if err != nil {
+		status, errMsg = jobFailed, err.Error()
+		slog.Error("Transcode job failed", "job_id", id, "err", err)
+	} else {
+		slog.Info("Transcode job finished", "job_id", id, "output", output)
+	}
+	if _, err := a.dbExecContext(ctx, "UPDATE transcode_jobs SET status = ?, output = ?, error = ?, finished_at = ? WHERE id = ?",
+		status, output, errMsg, time.Now().UTC(), id); err != nil {
+		slog.Error("Error updating transcode job", "job_id", id, "err", err)
+	}
+	return true
+}
+
+// runTranscode transcodes the recording of job id with its profile and
+// returns the name of the new file.
+func (a *App) runTranscode(ctx context.Context, id int) (string, error) {
+	var rec types.Recording
+	var profileName string
+	err := a.dbQueryRowContext(ctx, `
+		SELECT j.profile, r.id, r.channel_id, r.date, r.start_time, r.title, COALESCE(f.path, '')
+		FROM transcode_jobs j
+		JOIN recordings r ON r.id = j.recording_id
+		LEFT JOIN recording_files f ON f.recording_id = r.id
+		WHERE j.id = ?`, id).Scan(&profileName, &rec.ID, &rec.ChannelID, &rec.Date, &rec.StartTime, &rec.Title, &rec.FileName)
+	if err != nil {
+		return "", fmt.Errorf("loading job: %w", err)
+	}
+	if filters := parseFilterJobProfile(profileName); filters != nil {
+		return a.runFilterJob(ctx, rec, filters)
+	}
+	profile, err := a.loadTranscodeProfile(ctx, profileName)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("profile %q no longer exists", profileName)
+	} else if err != nil {
+		return "", err
+	}
+
+	fs := a.recordingStorage(ctx, rec.ID)
+	name := finalFileName(rec)
+	input, err := fs.LocalPath(name)
+	if err != nil {
+		return "", err
+	}
+	outName := transcodeOutputName(name, profile.Name)
+	output, err := fs.LocalPath(outName)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"-n", transcodeNice, "ffmpeg"}, transcodeArgs(profile, input, output)...)
+	if out, err := a.commander.RunWithEnv(nil, "nice", args...); err != nil {
+		_ = fs.Remove(outName)
+		return "", fmt.Errorf("%v: %s", err, tailOutput(out))
+	}
+	return outName, nil
+}
+
+// transcodeOutput is a file written by a completed transcode job.
+type transcodeOutput struct {
+	recordingID int
+	name        string
+}
+
+// transcodeOutputs returns the files transcode jobs wrote for recording id,
+// or for every recording if id is 0.
+func (a *App) transcodeOutputs(ctx context.Context, id int) ([]transcodeOutput, error) {
+	rows, err := a.dbQueryContext(ctx, `
+		SELECT recording_id, output FROM transcode_jobs
+		WHERE status = ? AND output != '' AND (? = 0 OR recording_id = ?)`, jobCompleted, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+	var outputs []transcodeOutput
+	for rows.Next() {
+		var out transcodeOutput
+		if err := rows.Scan(&out.recordingID, &out.name); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, rows.Err()
+}
+
+func (a *App) loadTranscodeProfile(ctx context.Context, name string) (TranscodeProfile, error) {
+	var p TranscodeProfile
+	err := a.dbQueryRowContext(ctx, `
+		SELECT id, name, video_codec, video_bitrate, height, audio_codec, audio_bitrate
+		FROM transcode_profiles WHERE name = ?`, name).Scan(
+		&p.ID, &p.Name, &p.VideoCodec, &p.VideoBitrate, &p.Height, &p.AudioCodec, &p.AudioBitrate)
+	return p, err
+}
+
+func (a *App) getTranscodeProfiles(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.dbQueryContext(r.Context(), `
+		SELECT id, name, video_codec, video_bitrate, height, audio_codec, audio_bitrate
+		FROM transcode_profiles ORDER BY name`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+
+	profiles := []TranscodeProfile{}
+	for rows.Next() {
+		var p TranscodeProfile
+		if err := rows.Scan(&p.ID, &p.Name, &p.VideoCodec, &p.VideoBitrate, &p.Height, &p.AudioCodec, &p.AudioBitrate); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		profiles = append(profiles, p)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles) //nolint: errcheck
+}
+
+func (a *App) createTranscodeProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	var p TranscodeProfile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeError := func(code int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint: errcheck
+	}
+	if sanitizeFilenamePart(p.Name) == "" {
+		writeError(http.StatusBadRequest, "name is required")
+		return
+	}
+	if parseFilterJobProfile(p.Name) != nil {
+		writeError(http.StatusConflict, "name is reserved for a built-in filter")
+		return
+	}
+	if p.Height < 0 {
+		writeError(http.StatusBadRequest, "height must not be negative")
+		return
+	}
+	if p.VideoCodec == "" {
+		p.VideoCodec = "libx264"
+	}
+	if p.AudioCodec == "" {
+		p.AudioCodec = "aac"
+	}
+
+	res, err := a.dbExecContext(r.Context(), `
+		INSERT INTO transcode_profiles (name, video_codec, video_bitrate, height, audio_codec, audio_bitrate)
+		VALUES (?, ?, ?, ?, ?, ?)`, p.Name, p.VideoCodec, p.VideoBitrate, p.Height, p.AudioCodec, p.AudioBitrate)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			writeError(http.StatusConflict, "Profile already exists")
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	p.ID = int(id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p) //nolint: errcheck
+}
+
+func (a *App) deleteTranscodeProfile(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+	res, err := a.dbExecContext(r.Context(), "DELETE FROM transcode_profiles WHERE id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TranscodeJobRequest is the body of POST /api/recordings/{id}/transcode.
+type TranscodeJobRequest struct {
+	Profile string `json:"profile"`
+}
+
+// createTranscodeJob queues a transcode of a completed recording.
+func (a *App) createTranscodeJob(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	var req TranscodeJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Profile == "" {
+		http.Error(w, "profile is required", http.StatusBadRequest)
+		return
+	}
+	writeError := func(code int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint: errcheck
+	}
+
+	ctx := r.Context()
+	var status string
+	err = a.dbQueryRowContext(ctx, "SELECT status FROM recordings WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		writeError(http.StatusNotFound, "Recording not found")
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if status != "completed" && status != statusPartial {
+		writeError(http.StatusConflict, "Only completed recordings can be transcoded")
+		return
+	}
+	// Built-in filters need no stored profile.
+	if parseFilterJobProfile(req.Profile) == nil {
+		if _, err := a.loadTranscodeProfile(ctx, req.Profile); err == sql.ErrNoRows {
+			writeError(http.StatusNotFound, "Profile not found")
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res, err := a.dbExecContext(ctx, "INSERT INTO transcode_jobs (recording_id, profile, status) VALUES (?, ?, ?)", id, req.Profile, jobQueued)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobID, _ := res.LastInsertId()
+	a.wakeTranscodeWorkers()
+
+	job, err := a.loadTranscodeJob(ctx, int(jobID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job) //nolint: errcheck
+}
+
+const transcodeJobColumns = `id, recording_id, profile, status, COALESCE(output, ''), COALESCE(error, ''), created_at, started_at, finished_at`
+
+func scanTranscodeJob(scan func(dest ...interface{}) error) (TranscodeJob, error) {
+	var j TranscodeJob
+	var created time.Time
+	var started, finished sql.NullTime
+	if err := scan(&j.ID, &j.RecordingID, &j.Profile, &j.Status, &j.Output, &j.Error, &created, &started, &finished); err != nil {
+		return j, err
+	}
+	j.CreatedAt = created.Format(time.RFC3339)
+	if started.Valid {
+		j.StartedAt = started.Time.Format(time.RFC3339)
+	}
+	if finished.Valid {
+		j.FinishedAt = finished.Time.Format(time.RFC3339)
+	}
+	return j, nil
+}
+
+func (a *App) loadTranscodeJob(ctx context.Context, id int) (TranscodeJob, error) {
+	return scanTranscodeJob(a.dbQueryRowContext(ctx, "SELECT "+transcodeJobColumns+" FROM transcode_jobs WHERE id = ?", id).Scan)
+}
+
+// getTranscodeJobs lists jobs, newest first, optionally filtered by status
+// and recording.
+func (a *App) getTranscodeJobs(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT " + transcodeJobColumns + " FROM transcode_jobs WHERE 1 = 1"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if rec := r.URL.Query().Get("recording"); rec != "" {
+		id, err := strconv.Atoi(rec)
+		if err != nil {
+			http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+			return
+		}
+		query += " AND recording_id = ?"
+		args = append(args, id)
+	}
+	rows, err := a.dbQueryContext(r.Context(), query+" ORDER BY id DESC", args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close() //nolint: errcheck
+
+	jobs := []TranscodeJob{}
+	for rows.Next() {
+		j, err := scanTranscodeJob(rows.Scan)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jobs = append(jobs, j)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs) //nolint: errcheck
+}
+
+func (a *App) getTranscodeJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, err := a.loadTranscodeJob(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job) //nolint: errcheck
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestTranscodeArgs(t *testing.T) {
+	p := TranscodeProfile{Name: "mobile", VideoCodec: "libx264", VideoBitrate: "1M", Height: 480, AudioCodec: "aac", AudioBitrate: "96k"}
+	got := strings.Join(transcodeArgs(p, "in.mp4", "out.mp4"), " ")
+	want := "-i in.mp4 -map 0:v:0 -map 0:a? -c:v libx264 -b:v 1M -vf scale=-2:480 -c:a aac -b:a 96k -movflags +faststart -y out.mp4"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if name := transcodeOutputName("Show/Season 01/Ep.mp4", "Mobile: 480p"); name != "Show/Season 01/Ep.Mobile- 480p.mp4" {
+		t.Errorf("output name %q", name)
+	}
+}
+
+func TestTranscodeJobs(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	dir := t.TempDir()
+	app.storage = storage.NewLocal(dir)
+	if err := os.WriteFile(filepath.Join(dir, "News.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News'), (2, '5.1', '2026-03-02', '20:00', 60, 'pending', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO recording_files (recording_id, path) VALUES (1, 'News.mp4')"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/recordings/{id}/transcode", app.createTranscodeJob).Methods("POST")
+	r.HandleFunc("/api/transcode/profiles", app.getTranscodeProfiles).Methods("GET")
+	r.HandleFunc("/api/transcode/profiles", app.createTranscodeProfile).Methods("POST")
+	r.HandleFunc("/api/jobs", app.getTranscodeJobs).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", app.getTranscodeJob).Methods("GET")
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("POST", "/api/transcode/profiles", `{"name":"mobile","videoBitrate":"1M","height":480}`); rr.Code != http.StatusCreated {
+		t.Fatalf("create profile: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("POST", "/api/transcode/profiles", `{"name":"mobile"}`); rr.Code != http.StatusConflict {
+		t.Errorf("duplicate profile: %d", rr.Code)
+	}
+	var profiles []TranscodeProfile
+	json.NewDecoder(do("GET", "/api/transcode/profiles", "").Body).Decode(&profiles) //nolint: errcheck
+	if len(profiles) != 1 || profiles[0].VideoCodec != "libx264" || profiles[0].AudioCodec != "aac" {
+		t.Errorf("profiles %+v", profiles)
+	}
+
+	for _, tt := range []struct {
+		url, body string
+		code      int
+	}{
+		{"/api/recordings/2/transcode", `{"profile":"mobile"}`, http.StatusConflict},
+		{"/api/recordings/9/transcode", `{"profile":"mobile"}`, http.StatusNotFound},
+		{"/api/recordings/1/transcode", `{"profile":"tablet"}`, http.StatusNotFound},
+		{"/api/recordings/1/transcode", `{}`, http.StatusBadRequest},
+	} {
+		if rr := do("POST", tt.url, tt.body); rr.Code != tt.code {
+			t.Errorf("POST %s %s: got %d, want %d", tt.url, tt.body, rr.Code, tt.code)
+		}
+	}
+
+	rr := do("POST", "/api/recordings/1/transcode", `{"profile":"mobile"}`)
+	var job TranscodeJob
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted || job.Status != jobQueued {
+		t.Fatalf("enqueue: %d %+v (%v)", rr.Code, job, err)
+	}
+	do("POST", "/api/recordings/1/transcode", `{"profile":"mobile"}`)
+
+	var ran []string
+	app.commander.(*MockCommander).RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+		ran = append(ran, name+" "+strings.Join(args, " "))
+		if len(ran) == 2 {
+			return []byte("Conversion failed!"), fmt.Errorf("exit status 1")
+		}
+		return nil, nil
+	}
+	for app.runNextTranscode(context.Background()) {
+	}
+	if len(ran) != 2 || !strings.HasPrefix(ran[0], "nice -n 10 ffmpeg -i "+filepath.Join(dir, "News.mp4")) ||
+		!strings.HasSuffix(ran[0], filepath.Join(dir, "News.mobile.mp4")) {
+		t.Errorf("ran %q", ran)
+	}
+
+	var jobs []TranscodeJob
+	json.NewDecoder(do("GET", "/api/jobs?recording=1", "").Body).Decode(&jobs) //nolint: errcheck
+	if len(jobs) != 2 || jobs[0].Status != jobFailed || !strings.Contains(jobs[0].Error, "Conversion failed!") ||
+		jobs[1].Status != jobCompleted || jobs[1].Output != "News.mobile.mp4" || jobs[1].FinishedAt == "" {
+		t.Errorf("jobs %+v", jobs)
+	}
+	if rr := do("GET", fmt.Sprintf("/api/jobs/%d", job.ID), ""); rr.Code != http.StatusOK {
+		t.Errorf("get job: %d", rr.Code)
+	}
+	if rr := do("GET", "/api/jobs/99", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown job: %d", rr.Code)
+	}
+
+	outputs, err := app.transcodeOutputs(context.Background(), 1)
+	if err != nil || len(outputs) != 1 || outputs[0].name != "News.mobile.mp4" {
+		t.Errorf("outputs %+v (%v)", outputs, err)
+	}
+}
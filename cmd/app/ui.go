@@ -0,0 +1,56 @@
+package main
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/prziborowski/hdhr-dvr/templates"
+)
+
+// uiPages are the UI's routes, each serving index.html, which shows the
+// matching tab.
+var uiPages = []string{"/", "/schedule", "/recordings", "/guide", "/keywords"}
+
+// uiFS returns the web UI: the uiDir directory when set, else the copy
+// built into the binary.
+func (a *App) uiFS() fs.FS {
+	if dir := a.cfg().UIDir; dir != "" {
+		return os.DirFS(dir)
+	}
+	return templates.FS
+}
+
+// serveHome renders the UI with the base path its links are resolved
+// against. With auth enabled, visitors who have not signed in are sent to
+// the sign-in page.
+func (a *App) serveHome(w http.ResponseWriter, r *http.Request) {
+	if a.cfg().Auth.Enabled && requestUser(r) == nil {
+		http.Redirect(w, r, a.cfg().BasePath+"/login", http.StatusSeeOther)
+		return
+	}
+	a.servePage(w, r, "index.html")
+}
+
+// serveLogin renders the sign-in page.
+func (a *App) serveLogin(w http.ResponseWriter, r *http.Request) {
+	a.servePage(w, r, "login.html")
+}
+
+// servePage renders the named page of the UI.
+func (a *App) servePage(w http.ResponseWriter, r *http.Request, name string) {
+	tmpl, err := template.ParseFS(a.uiFS(), name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		BasePath string
+		SSO      bool // OIDC sign-in is configured
+	}{a.cfg().BasePath, a.cfg().Auth.OIDC != nil}
+	if err := tmpl.Execute(w, data); err != nil {
+		requestLogger(r).Error("Error rendering page", "page", name, "err", err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeHome(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.BasePath = "/dvr"
+
+	// The built-in copy, whatever the working directory.
+	rr := httptest.NewRecorder()
+	app.serveHome(rr, httptest.NewRequest("GET", "/", nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, `<base href="/dvr/">`) || !strings.Contains(body, `const basePath = "/dvr";`) {
+		t.Errorf("got %d:\n%.500s", rr.Code, body)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("dev copy {{.BasePath}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app.config.UIDir = dir
+	rr = httptest.NewRecorder()
+	app.serveHome(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "dev copy /dvr" {
+		t.Errorf("uiDir: got %q", rr.Body)
+	}
+}
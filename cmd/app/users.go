@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// sessionCookie names the cookie holding a session token.
+const sessionCookie = "dvr_session"
+
+// minPasswordLength is the shortest password accepted.
+const minPasswordLength = 8
+
+// passwordIterations is the PBKDF2 work factor for new password hashes;
+// tests lower it. Stored hashes record their own count.
+var passwordIterations = 600000
+
+// User is a web UI account. Role is admin or viewer; users without a
+// row in user_roles, who were added before roles, are admins.
+type User struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// userQuery selects the columns scanUser reads.
+const userQuery = `
+	SELECT u.id, u.username, COALESCE(r.role, 'admin'), u.created_at, u.password_hash
+	FROM users u LEFT JOIN user_roles r ON r.user_id = u.id`
+
+// scanUser reads a row of userQuery, returning the password hash too.
+func scanUser(row interface{ Scan(...any) error }) (*User, string, error) {
+	var u User
+	var hash string
+	if err := row.Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &hash); err != nil {
+		return nil, "", err
+	}
+	return &u, hash, nil
+}
+
+// hashPassword returns a salted PBKDF2-SHA256 hash of password as
+// "pbkdf2-sha256$iterations$salt$hash".
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches a hash from hashPassword.
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	want, err2 := enc.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// addUser creates a user with password.
+func (a *App) addUser(ctx context.Context, username, password string) (User, error) {
+	if strings.TrimSpace(username) == "" {
+		return User{}, errors.New("username is required")
+	}
+	if len(password) < minPasswordLength {
+		return User{}, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	res, err := a.dbExecContext(ctx, "INSERT INTO users (username, password_hash) VALUES (?, ?)", strings.TrimSpace(username), hash)
+	if err != nil {
+		return User{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+	u, _, err := scanUser(a.dbQueryRowContext(ctx, userQuery+" WHERE u.id = ?", id))
+	if err != nil {
+		return User{}, err
+	}
+	return *u, nil
+}
+
+// setRole gives a user a role. It returns sql.ErrNoRows for an unknown
+// user.
+func (a *App) setRole(ctx context.Context, username, role string) error {
+	if role != roleAdmin && role != roleViewer {
+		return fmt.Errorf("unknown role %q; use %s or %s", role, roleAdmin, roleViewer)
+	}
+	res, err := a.dbExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role) SELECT id, ? FROM users WHERE username = ?
+		ON CONFLICT(user_id) DO UPDATE SET role = excluded.role`, role, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// setPassword changes a user's password and ends their sessions. It
+// returns sql.ErrNoRows for an unknown user.
+func (a *App) setPassword(ctx context.Context, username, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	res, err := a.dbExecContext(ctx, "UPDATE users SET password_hash = ? WHERE username = ?", hash, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = a.dbExecContext(ctx, "DELETE FROM sessions WHERE user_id = (SELECT id FROM users WHERE username = ?)", username)
+	return err
+}
+
+// removeUser deletes a user and their sessions. It returns sql.ErrNoRows
+// for an unknown user.
+func (a *App) removeUser(ctx context.Context, username string) error {
+	for _, table := range []string{"sessions", "user_roles", "watch_state", "favorite_channels"} {
+		if _, err := a.dbExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = (SELECT id FROM users WHERE username = ?)", username); err != nil {
+			return err
+		}
+	}
+	res, err := a.dbExecContext(ctx, "DELETE FROM users WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// listUsers returns every user, oldest first.
+func (a *App) listUsers(ctx context.Context) ([]User, error) {
+	rows, err := a.dbQueryContext(ctx, userQuery+" ORDER BY u.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint: errcheck
+
+	users := []User{}
+	for rows.Next() {
+		u, _, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// authenticate returns the user whose name and password match, or
+// sql.ErrNoRows. An unknown name costs as much as a wrong password, so
+// timing does not reveal which names exist.
+func (a *App) authenticate(ctx context.Context, username, password string) (*User, error) {
+	u, hash, err := scanUser(a.dbQueryRowContext(ctx, userQuery+" WHERE u.username = ?", username))
+	if errors.Is(err, sql.ErrNoRows) {
+		checkPassword(dummyPasswordHash(), password)
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		return nil, err
+	}
+	if !checkPassword(hash, password) {
+		return nil, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+// externalUser returns the user named username, who signed in through an
+// identity provider, adding them on first sign-in. Such users have no
+// password. Unless linkLocal is set, a user who has one is refused, so that
+// a provider cannot sign in as a local account.
+func (a *App) externalUser(ctx context.Context, username string, linkLocal bool) (*User, error) {
+	u, hash, err := scanUser(a.dbQueryRowContext(ctx, userQuery+" WHERE u.username = ?", username))
+	if errors.Is(err, sql.ErrNoRows) {
+		// New users are viewers until made admins, by auth.adminGroups or
+		// bin/app users role; only accounts from before roles default to
+		// admin.
+		tx, err := a.store.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback() //nolint: errcheck
+		res, err := tx.ExecContext(ctx, "INSERT INTO users (username, password_hash) VALUES (?, '')", username)
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_roles (user_id, role) VALUES (?, ?)", id, roleViewer); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		u, _, err = scanUser(a.dbQueryRowContext(ctx, userQuery+" WHERE u.id = ?", id))
+		return u, err
+	} else if err != nil {
+		return nil, err
+	}
+	if hash != "" && !linkLocal {
+		return nil, fmt.Errorf("%q is a local user with a password", username)
+	}
+	return u, nil
+}
+
+// dummyPasswordHash is checked against for unknown users.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	h, _ := hashPassword("")
+	return h
+})
+
+// createSession starts a session for u lasting the configured
+// sessionHours and returns its token. Only a hash of the token is stored.
+func (a *App) createSession(ctx context.Context, u *User, now time.Time) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	expires := now.Add(time.Duration(a.cfg().Auth.SessionHours) * time.Hour)
+	if _, err := a.dbExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= ?", now.Unix()); err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := a.dbExecContext(ctx, "INSERT INTO sessions (hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashAPIKey(token), u.ID, expires.Unix()); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// lookupSession returns the user of an unexpired session, or sql.ErrNoRows.
+func (a *App) lookupSession(ctx context.Context, token string) (*User, error) {
+	u, _, err := scanUser(a.dbQueryRowContext(ctx, userQuery+`
+		JOIN sessions s ON s.user_id = u.id WHERE s.hash = ? AND s.expires_at > ?`,
+		hashAPIKey(token), time.Now().Unix()))
+	return u, err
+}
+
+// sessionToken returns the session token r carries, or "".
+func sessionToken(r *http.Request) string {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// secureRequest reports whether the client connected over HTTPS, directly
+// or through a proxy, so cookies set in reply should be Secure.
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// setSessionCookie sets or, with an empty token, clears the session cookie.
+func (a *App) setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	c := &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     a.cfg().BasePath + "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// LoginRequest is the body of POST /api/login.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// login checks {"username": ..., "password": ...} and starts a session,
+// returned as a cookie.
+func (a *App) login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	u, err := a.authenticate(r.Context(), req.Username, req.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		requestLogger(r).Warn("Failed sign-in", "username", req.Username, "remote_addr", r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid username or password"}) //nolint: errcheck
+		return
+	} else if err != nil {
+		requestLogger(r).Error("Error signing in", "err", err)
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	token, expires, err := a.createSession(r.Context(), u, time.Now())
+	if err != nil {
+		requestLogger(r).Error("Error creating session", "err", err)
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Signed in", "username", u.Username)
+	a.setSessionCookie(w, r, token, expires)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u) //nolint: errcheck
+}
+
+// logout ends the session r carries.
+func (a *App) logout(w http.ResponseWriter, r *http.Request) {
+	if token := sessionToken(r); token != "" {
+		if _, err := a.dbExecContext(r.Context(), "DELETE FROM sessions WHERE hash = ?", hashAPIKey(token)); err != nil {
+			requestLogger(r).Error("Error ending session", "err", err)
+		}
+	}
+	a.setSessionCookie(w, r, "", time.Time{})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getSession reports whether auth is enabled, who is signed in and the
+// caller's role, so the UI can hide what the role does not allow.
+func (a *App) getSession(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		AuthEnabled bool   `json:"authEnabled"`
+		Username    string `json:"username,omitempty"`
+		Role        string `json:"role,omitempty"`
+	}{AuthEnabled: a.cfg().Auth.Enabled, Role: a.requestRole(r)}
+	if u := requestUser(r); u != nil {
+		resp.Username = u.Username
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp) //nolint: errcheck
+}
+
+// runUsersCommand manages web UI users from the command line: "users
+// list", "users add NAME [ROLE]", "users passwd NAME", "users role NAME
+// ROLE" and "users remove NAME". Passwords are read as the first line of
+// in; new users are admins unless ROLE says otherwise.
+func runUsersCommand(a *App, args []string, in io.Reader, out io.Writer) error {
+	ctx := context.Background()
+	readPassword := func() (string, error) {
+		fmt.Fprint(out, "Password: ") //nolint: errcheck
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		users, err := a.listUsers(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME\tROLE\tCREATED") //nolint: errcheck
+		for _, u := range users {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", u.ID, u.Username, u.Role, u.CreatedAt) //nolint: errcheck
+		}
+		return tw.Flush()
+	case (len(args) == 2 || len(args) == 3) && args[0] == "add":
+		role := roleAdmin
+		if len(args) == 3 {
+			role = args[2]
+		}
+		if role != roleAdmin && role != roleViewer {
+			return fmt.Errorf("unknown role %q; use %s or %s", role, roleAdmin, roleViewer)
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		u, err := a.addUser(ctx, args[1], password)
+		if err != nil {
+			return err
+		}
+		if err := a.setRole(ctx, u.Username, role); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\nAdded %s %s\n", role, u.Username) //nolint: errcheck
+		return nil
+	case len(args) == 3 && args[0] == "role":
+		if err := a.setRole(ctx, args[1], args[2]); errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user %q", args[1])
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s is now %s\n", args[1], args[2]) //nolint: errcheck
+		return nil
+	case len(args) == 2 && args[0] == "passwd":
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := a.setPassword(ctx, args[1], password); errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user %q", args[1])
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\nChanged the password of %s\n", args[1]) //nolint: errcheck
+		return nil
+	case len(args) == 2 && args[0] == "remove":
+		if err := a.removeUser(ctx, args[1]); errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user %q", args[1])
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Removed user %s\n", args[1]) //nolint: errcheck
+		return nil
+	}
+	return errors.New("usage: app users list | add NAME [admin|viewer] | passwd NAME | role NAME admin|viewer | remove NAME")
+}
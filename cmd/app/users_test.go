@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	// Full-strength hashing would make every test creating a user slow.
+	passwordIterations = 1000
+}
+
+func TestPasswordHash(t *testing.T) {
+	h, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(h, "pbkdf2-sha256$1000$") || strings.Contains(h, "correct horse") {
+		t.Errorf("hash %q", h)
+	}
+	if !checkPassword(h, "correct horse") || checkPassword(h, "correct horsE") || checkPassword("garbage", "") {
+		t.Error("checkPassword gave the wrong answer")
+	}
+	if h2, _ := hashPassword("correct horse"); h2 == h {
+		t.Error("hashes are not salted")
+	}
+}
+
+func TestUsersAndSessions(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Auth.SessionHours = 1
+	ctx := context.Background()
+
+	if _, err := app.addUser(ctx, "alice", "short"); err == nil {
+		t.Error("accepted a short password")
+	}
+	if _, err := app.addUser(ctx, "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.addUser(ctx, "alice", "another password"); err == nil {
+		t.Error("added the same username twice")
+	}
+	if _, err := app.authenticate(ctx, "alice", "wrong password"); err == nil {
+		t.Error("wrong password accepted")
+	}
+	if _, err := app.authenticate(ctx, "bob", "correct horse"); err == nil {
+		t.Error("unknown user accepted")
+	}
+	u, err := app.authenticate(ctx, "alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := app.createSession(ctx, u, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := app.lookupSession(ctx, token); err != nil || got.Username != "alice" {
+		t.Errorf("lookupSession: %+v, %v", got, err)
+	}
+	old, _, _ := app.createSession(ctx, u, time.Now().Add(-2*time.Hour))
+	if _, err := app.lookupSession(ctx, old); err == nil {
+		t.Error("expired session accepted")
+	}
+
+	// A new password signs out everywhere.
+	if err := app.setPassword(ctx, "alice", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.lookupSession(ctx, token); err == nil {
+		t.Error("session survived a password change")
+	}
+	if err := app.removeUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.removeUser(ctx, "alice"); err == nil {
+		t.Error("removed a user twice")
+	}
+}
+
+func TestLoginHandlers(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	app.config.Auth.Enabled = true
+	app.config.Auth.SessionHours = 1
+	app.config.BasePath = "/dvr"
+	if _, err := app.addUser(context.Background(), "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.login(rr, httptest.NewRequest("POST", "/api/v1/login", strings.NewReader(`{"username": "alice", "password": "nope"}`)))
+	if rr.Code != http.StatusUnauthorized || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("bad password: %d %v", rr.Code, rr.Result().Cookies())
+	}
+
+	req := httptest.NewRequest("POST", "/api/v1/login", strings.NewReader(`{"username": "alice", "password": "correct horse"}`))
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rr = httptest.NewRecorder()
+	app.login(rr, req)
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("login: %d %v", rr.Code, cookies)
+	}
+	c := cookies[0]
+	if c.Name != sessionCookie || !c.HttpOnly || !c.Secure || c.Path != "/dvr/" || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie %+v", c)
+	}
+
+	// The UI sends visitors without a session to the sign-in page.
+	rr = httptest.NewRecorder()
+	app.serveHome(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/dvr/login" {
+		t.Errorf("anonymous home: %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	rr = httptest.NewRecorder()
+	app.serveLogin(rr, httptest.NewRequest("GET", "/login", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "api/v1/login") {
+		t.Errorf("login page: %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/logout", nil)
+	req.AddCookie(c)
+	rr = httptest.NewRecorder()
+	app.logout(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("logout: %d", rr.Code)
+	}
+	if _, err := app.lookupSession(context.Background(), c.Value); err == nil {
+		t.Error("session survived logout")
+	}
+}
+
+func TestUsersCommand(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+
+	var out bytes.Buffer
+	if err := runUsersCommand(app, []string{"add", "alice"}, strings.NewReader("correct horse\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.authenticate(context.Background(), "alice", "correct horse"); err != nil {
+		t.Errorf("added user cannot sign in: %v", err)
+	}
+	if err := runUsersCommand(app, []string{"add", "bob", "viewer"}, strings.NewReader("battery staple\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runUsersCommand(app, []string{"role", "alice", "owner"}, nil, &out); err == nil {
+		t.Error("accepted an unknown role")
+	}
+	out.Reset()
+	if err := runUsersCommand(app, []string{"list"}, nil, &out); err != nil ||
+		!strings.Contains(out.String(), "alice     admin") || !strings.Contains(out.String(), "bob       viewer") {
+		t.Errorf("list: %q, %v", out.String(), err)
+	}
+	if err := runUsersCommand(app, []string{"passwd", "carol"}, strings.NewReader("battery staple\n"), &out); err == nil {
+		t.Error("changed the password of an unknown user")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+// statusPartial marks recordings whose file is much shorter than the
+// capture was meant to be.
+const statusPartial = "partial"
+
+// partialThreshold is the fraction of the expected length below which a
+// recording is partial.
+const partialThreshold = 0.9
+
+// maxVerifyErrors is how many decode error lines are kept.
+const maxVerifyErrors = 20
+
+// Verification is the result of checking a finished recording's file.
+type Verification struct {
+	RecordingID     int     `json:"recordingId"`
+	VideoStreams    int     `json:"videoStreams"`
+	AudioStreams    int     `json:"audioStreams"`
+	ExpectedSeconds float64 `json:"expectedSeconds"`
+	MeasuredSeconds float64 `json:"measuredSeconds"`
+	DecodeErrors    int     `json:"decodeErrors"`
+	Errors          string  `json:"errors,omitempty"`
+	Partial         bool    `json:"partial"`
+	VerifiedAt      string  `json:"verifiedAt,omitempty"`
+}
+
+// probeStreams asks ffprobe for the container duration and the type of
+// each stream of file.
+func probeStreams(commander Commander, file string) (duration float64, video, audio int, err error) {
+	out, err := commander.Output("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration:stream=codec_type",
+		"-of", "json",
+		file)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return 0, 0, 0, fmt.Errorf("parsing ffprobe output: %w", err)
+	}
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "video":
+			video++
+		case "audio":
+			audio++
+		}
+	}
+	duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	return duration, video, audio, nil
+}
+
+// decodeErrors decodes the key frames and audio of file and returns the
+// error lines ffmpeg reports.
+func decodeErrors(commander Commander, file string) []string {
+	out, err := commander.RunWithEnv(nil, "ffmpeg", "-v", "error", "-skip_frame", "nokey", "-i", file, "-f", "null", "-")
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err != nil && len(lines) == 0 {
+		lines = append(lines, err.Error())
+	}
+	return lines
+}
+
+// verifyRecording checks the streams, length and decodability of a finished
+// recording's file name on fs, stores the result and marks the recording
+// partial if it is shorter than partialThreshold of expectedSeconds.
+func (a *App) verifyRecording(ctx context.Context, fs storage.Storage, id int, name string, expectedSeconds float64) error {
+	file, err := fs.LocalPath(name)
+	if err != nil {
+		return err
+	}
+	v := Verification{RecordingID: id, ExpectedSeconds: expectedSeconds}
+	v.MeasuredSeconds, v.VideoStreams, v.AudioStreams, err = probeStreams(a.commander, file)
+	if err != nil {
+		return err
+	}
+	errs := decodeErrors(a.commander, file)
+	v.DecodeErrors = len(errs)
+	if len(errs) > maxVerifyErrors {
+		errs = errs[:maxVerifyErrors]
+	}
+	v.Errors = strings.Join(errs, "\n")
+	v.Partial = expectedSeconds > 0 && v.MeasuredSeconds < expectedSeconds*partialThreshold
+
+	if _, err := a.dbExecContext(ctx, `
+		INSERT OR REPLACE INTO recording_verifications
+			(recording_id, video_streams, audio_streams, expected_seconds, measured_seconds, decode_errors, errors)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, v.VideoStreams, v.AudioStreams, v.ExpectedSeconds, v.MeasuredSeconds, v.DecodeErrors, v.Errors); err != nil {
+		return err
+	}
+	if v.VideoStreams == 0 || v.DecodeErrors > 0 {
+		slog.Info("Recording verified", "recording_id", id, "video_streams", v.VideoStreams, "audio_streams", v.AudioStreams, "decode_errors", v.DecodeErrors)
+	}
+	if !v.Partial {
+		return nil
+	}
+	slog.Warn("Recording is partial", "recording_id", id, "measured_seconds", v.MeasuredSeconds, "expected_seconds", expectedSeconds)
+	reason := fmt.Sprintf("%.0f of %.0f seconds recorded", v.MeasuredSeconds, v.ExpectedSeconds)
+	if err := a.setStatus(ctx, id, statusPartial, reason); err != nil {
+		return err
+	}
+	a.events.publish(eventRecordingPartial, map[string]interface{}{
+		"id":              id,
+		"expectedSeconds": v.ExpectedSeconds,
+		"measuredSeconds": v.MeasuredSeconds,
+	})
+	return nil
+}
+
+func (a *App) getRecordingVerification(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+	v := Verification{RecordingID: id}
+	var verified time.Time
+	err = a.dbQueryRowContext(r.Context(), `
+		SELECT video_streams, audio_streams, expected_seconds, measured_seconds, decode_errors, COALESCE(errors, ''), verified_at
+		FROM recording_verifications WHERE recording_id = ?`, id).Scan(
+		&v.VideoStreams, &v.AudioStreams, &v.ExpectedSeconds, &v.MeasuredSeconds, &v.DecodeErrors, &v.Errors, &verified)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recording not verified", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	v.Partial = v.ExpectedSeconds > 0 && v.MeasuredSeconds < v.ExpectedSeconds*partialThreshold
+	v.VerifiedAt = verified.Format(time.RFC3339)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint: errcheck
+}
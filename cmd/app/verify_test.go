@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
+)
+
+func TestVerifyRecording(t *testing.T) {
+	tests := []struct {
+		name        string
+		duration    string
+		decodeOut   string
+		decodeErr   error
+		wantStatus  string
+		wantErrors  int
+		wantPartial bool
+	}{
+		{name: "complete", duration: "3595.2", wantStatus: "completed"},
+		{name: "short", duration: "1800.0", wantStatus: statusPartial, wantPartial: true},
+		{name: "decode errors", duration: "3600", decodeOut: "[h264 @ 0x1] error while decoding MB 3 4\n[h264 @ 0x1] concealing 12 errors\n",
+			wantStatus: "completed", wantErrors: 2},
+		{name: "decoder failed", duration: "3600", decodeErr: fmt.Errorf("exit status 1"), wantStatus: "completed", wantErrors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := setupTestApp(t)
+			defer db.Close() //nolint: errcheck
+
+			dir := t.TempDir()
+			fs := storage.NewLocal(dir)
+			if err := os.WriteFile(filepath.Join(dir, "News.mp4"), []byte("video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status, title) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'completed', 'News')"); err != nil {
+				t.Fatal(err)
+			}
+			mc := app.commander.(*MockCommander)
+			mc.OutputFunc = func(name string, args ...string) ([]byte, error) {
+				return []byte(`{"streams":[{"codec_type":"video"},{"codec_type":"audio"},{"codec_type":"audio"}],"format":{"duration":"` + tt.duration + `"}}`), nil
+			}
+			mc.RunWithEnvFunc = func(env []string, name string, args ...string) ([]byte, error) {
+				return []byte(tt.decodeOut), tt.decodeErr
+			}
+			events, cancel := app.events.subscribe()
+			defer cancel()
+
+			if err := app.verifyRecording(context.Background(), fs, 1, "News.mp4", 3600); err != nil {
+				t.Fatal(err)
+			}
+			var status string
+			db.QueryRow("SELECT status FROM recordings WHERE id = 1").Scan(&status) //nolint: errcheck
+			if status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", status, tt.wantStatus)
+			}
+			select {
+			case ev := <-events:
+				if !tt.wantPartial || ev.Type != "recording.partial" {
+					t.Errorf("unexpected event %+v", ev)
+				}
+			default:
+				if tt.wantPartial {
+					t.Error("no recording.partial event")
+				}
+			}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/api/recordings/{id}/verification", app.getRecordingVerification).Methods("GET")
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recordings/1/verification", nil))
+			var v Verification
+			if err := json.NewDecoder(rr.Body).Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			if v.VideoStreams != 1 || v.AudioStreams != 2 || v.DecodeErrors != tt.wantErrors || v.Partial != tt.wantPartial || v.ExpectedSeconds != 3600 {
+				t.Errorf("verification %+v", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// webhookBackoff is how long to wait before each retry of a failed
+// delivery.
+var webhookBackoff = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// webhookNotifier POSTs notifications as JSON.
+type webhookNotifier struct {
+	url     string
+	secret  string
+	client  *http.Client
+	backoff []time.Duration
+}
+
+func newWebhookNotifier(cfg pkgcfg.Webhook) *webhookNotifier {
+	return &webhookNotifier{
+		url:     cfg.URL,
+		secret:  cfg.Secret,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		backoff: webhookBackoff,
+	}
+}
+
+func (w *webhookNotifier) name() string {
+	if u, err := url.Parse(w.url); err == nil && u.Host != "" {
+		return "webhook " + u.Host
+	}
+	return "webhook"
+}
+
+// signWebhook returns the X-DVR-Signature of body: "sha256=" and the hex
+// HMAC-SHA256 of the body keyed with secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable is a delivery failure worth trying again.
+type retryable struct{ error }
+
+// post makes one delivery attempt. Connection errors, 429 and 5xx are
+// retryable; other error statuses mean the receiver rejected the payload.
+func (w *webhookNotifier) post(ctx context.Context, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hdhr-dvr")
+	req.Header.Set("X-DVR-Event", event)
+	if w.secret != "" {
+		req.Header.Set("X-DVR-Signature", signWebhook(w.secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return retryable{err}
+	}
+	defer resp.Body.Close()                              //nolint: errcheck
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) //nolint: errcheck
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return retryable{fmt.Errorf("POST %s: %s", w.url, resp.Status)}
+	default:
+		return fmt.Errorf("POST %s: %s", w.url, resp.Status)
+	}
+}
+
+// notify delivers n, retrying with backoff while failures are retryable.
+func (w *webhookNotifier) notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err := w.post(ctx, n.Event, body)
+		if _, ok := err.(retryable); !ok || attempt >= len(w.backoff) {
+			if r, ok := err.(retryable); ok {
+				return fmt.Errorf("giving up after %d attempts: %w", attempt+1, r.error)
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(w.backoff[attempt]):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var attempts int32
+	var got Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !hmac.Equal([]byte(r.Header.Get("X-DVR-Signature")), []byte(signWebhook("s3cret", body))) {
+			t.Errorf("bad signature %q", r.Header.Get("X-DVR-Signature"))
+		}
+		if r.Header.Get("X-DVR-Event") != eventRecordingCompleted {
+			t.Errorf("event header %q", r.Header.Get("X-DVR-Event"))
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.Unmarshal(body, &got) //nolint: errcheck
+	}))
+	defer srv.Close()
+
+	entries := newNotifiers(pkgcfg.Notifications{Webhooks: []pkgcfg.Webhook{
+		{URL: srv.URL, Secret: "s3cret", Events: []string{eventRecordingCompleted}},
+		{URL: ""},
+	}})
+	if len(entries) != 1 || entries[0].wants(eventRecordingStarted) {
+		t.Fatalf("entries %+v", entries)
+	}
+	wh := entries[0].notifier.(*webhookNotifier)
+	wh.backoff = []time.Duration{time.Millisecond}
+
+	n := Notification{Event: eventRecordingCompleted, Subject: "Recording completed", Recording: &NotificationRecording{ID: 3}}
+	if err := wh.notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || got.Subject != "Recording completed" || got.Recording == nil || got.Recording.ID != 3 {
+		t.Errorf("after %d attempts got %+v", attempts, got)
+	}
+}
+
+func TestWebhookNotifierGivesUp(t *testing.T) {
+	var attempts int32
+	status := int32(http.StatusBadGateway)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	wh := newWebhookNotifier(pkgcfg.Webhook{URL: srv.URL})
+	wh.backoff = []time.Duration{time.Millisecond, time.Millisecond}
+	if err := wh.notify(context.Background(), Notification{Event: eventTest}); err == nil || attempts != 3 {
+		t.Errorf("after %d attempts: %v", attempts, err)
+	}
+
+	// A rejected payload is not retried.
+	atomic.StoreInt32(&attempts, 0)
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	if err := wh.notify(context.Background(), Notification{Event: eventTest}); err == nil || attempts != 1 {
+		t.Errorf("after %d attempts: %v", attempts, err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/websocket"
+)
+
+// wsPingInterval is how often /ws pings an otherwise quiet client.
+var wsPingInterval = 30 * time.Second
+
+// wsCommand is a command sent by a /ws client. ID is any JSON value and is
+// echoed in the reply so the client can match them up.
+type wsCommand struct {
+	ID          json.RawMessage `json:"id,omitempty"`
+	Command     string          `json:"command"`
+	RecordingID int             `json:"recordingId,omitempty"`
+	Minutes     int             `json:"minutes,omitempty"`
+}
+
+// wsResult answers a wsCommand.
+type wsResult struct {
+	Type  string          `json:"type"`
+	ID    json.RawMessage `json:"id,omitempty"`
+	OK    bool            `json:"ok"`
+	Error string          `json:"error,omitempty"`
+}
+
+// runWSCommand carries out one command message. Only admins may send
+// commands, since each changes the schedule.
+func (a *App) runWSCommand(ctx context.Context, msg []byte, role string) wsResult {
+	var cmd wsCommand
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		return wsResult{Type: "result", Error: "invalid command: " + err.Error()}
+	}
+	res := wsResult{Type: "result", ID: cmd.ID}
+	if role != roleAdmin {
+		res.Error = "admin role required"
+		return res
+	}
+	var err error
+	switch cmd.Command {
+	case "cancel":
+		err = a.cancelRecording(ctx, cmd.RecordingID)
+	case "extend":
+		err = a.extendRecording(ctx, cmd.RecordingID, cmd.Minutes)
+	case "refreshGuide":
+		if !a.startGuideRefresh() {
+			err = fmt.Errorf("guide refresh already running")
+		}
+	default:
+		err = fmt.Errorf("unknown command %q", cmd.Command)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.OK = true
+	}
+	return res
+}
+
+// serveWebSocket sends the event bus to a WebSocket client, as
+// /api/events does, and runs the commands it sends back.
+func (a *App) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	role := a.requestRole(r)
+	events, unsubscribe := a.events.subscribe()
+	defer unsubscribe()
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close() //nolint: errcheck
+
+	// The request context ends with the hijacked connection's handler, so
+	// the reader ends the session instead.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteJSON(a.runWSCommand(ctx, msg, role)); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if err := conn.WriteJSON(e); err != nil {
+				requestLogger(r).Error("Error sending event over WebSocket", "type", e.Type, "err", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
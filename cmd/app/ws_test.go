@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prziborowski/hdhr-dvr/pkg/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	app, db := setupTestApp(t)
+	defer db.Close() //nolint: errcheck
+	if _, err := db.Exec("INSERT INTO recordings (id, channel_id, date, start_time, duration, status) VALUES (1, '5.1', '2026-03-01', '20:00', 60, 'pending')"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/ws", app.serveWebSocket).Methods("GET")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint: errcheck
+
+	read := func() map[string]interface{} {
+		t.Helper()
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	// The handler subscribed before the upgrade, so this is not lost.
+	app.events.publish("guide.updated", map[string]int{"added": 2})
+	if m := read(); m["type"] != "guide.updated" {
+		t.Errorf("first message %v", m)
+	}
+
+	conn.WriteText([]byte(`{"id": "a", "command": "extend", "recordingId": 1, "minutes": 15}`)) //nolint: errcheck
+	// The extension's own event and the command result may come in either order.
+	var result map[string]interface{}
+	for i := 0; i < 2; i++ {
+		if m := read(); m["type"] == "result" {
+			result = m
+		} else if m["type"] != "recording.extended" {
+			t.Errorf("unexpected message %v", m)
+		}
+	}
+	if result["id"] != "a" || result["ok"] != true {
+		t.Errorf("result %v", result)
+	}
+
+	conn.WriteText([]byte(`{"id": 2, "command": "reboot"}`)) //nolint: errcheck
+	if m := read(); m["ok"] != false || m["id"] != 2.0 || !strings.Contains(m["error"].(string), "unknown command") {
+		t.Errorf("unknown command result %v", m)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +21,11 @@ type RecordingRequest struct {
 	StartTime string  `json:"startTime"`
 	Duration  int     `json:"duration"`
 	Title     *string `json:"title,omitempty"`
+	ProgramID string  `json:"programId,omitempty"`
+	// Commercials is the matched keyword's comskip mode, if it has one.
+	Commercials string `json:"commercials,omitempty"`
+	// Filters are the matched keyword's built-in filters.
+	Filters []string `json:"filters,omitempty"`
 }
 
 // APIResponseRecording matches the JSON structure returned by /api/recordings
@@ -87,6 +94,7 @@ func main() {
 
 	now := time.Now().In(loc)
 	scheduledCount := 0
+	simulcasts := simulcastChannels(guideData.Programs, config.SimulcastPreference)
 
 	// Check each program against keywords
 	for _, program := range guideData.Programs {
@@ -110,13 +118,23 @@ func main() {
 		log.Printf("Found keyword match: '%s' in program '%s' (category: %s)",
 			matchedKeyword, program.Title, program.Category)
 
+		// Only the preferred channel of a simulcast is considered; the others
+		// are skipped so the program is never scheduled twice.
+		channels := simulcasts[simulcastKey(program)]
+		if len(channels) > 1 && channels[0] != program.Channel {
+			log.Printf("Skipping '%s' on channel %s: simulcast on preferred channel %s",
+				program.Title, program.Channel, channels[0])
+			continue
+		}
+
 		title := program.Title
 		if program.SubTitle != "" {
 			title = fmt.Sprintf("%s - %s", title, program.SubTitle)
 		}
 
-		// Check if we already have a pending recording for this channel and time
-		if rec := findPendingRecording(pendingRecordings, program, loc); rec != nil {
+		// Check if we already have a pending recording for this channel and time,
+		// or for any channel simulcasting it
+		if rec := findPendingSimulcast(pendingRecordings, program, channels, loc); rec != nil {
 			log.Printf("Found existing recording for channel %s at %s", program.Channel, program.Start)
 
 			existingTitle := ""
@@ -149,13 +167,17 @@ func main() {
 		timeStr := startTime.Format("15:04")
 
 		// Schedule the recording via API
+		keyword := findKeyword(keywords, matchedKeyword)
 		apiURL := apiBaseURL + "/api/recordings"
 		err = scheduleRecording(apiURL, RecordingRequest{
-			ChannelID: program.Channel,
-			Date:      dateStr,
-			StartTime: timeStr,
-			Duration:  duration,
-			Title:     &title,
+			ChannelID:   program.Channel,
+			Date:        dateStr,
+			StartTime:   timeStr,
+			Duration:    duration,
+			Title:       &title,
+			ProgramID:   program.ID,
+			Commercials: keyword.Commercials,
+			Filters:     keyword.Filters,
 		})
 
 		if err != nil {
@@ -301,6 +323,16 @@ func findMatchingKeyword(program types.Program, keywords []types.Keyword) string
 	return ""
 }
 
+// findKeyword returns the keyword named name, or the zero Keyword.
+func findKeyword(keywords []types.Keyword, name string) types.Keyword {
+	for _, keyword := range keywords {
+		if keyword.Name == name {
+			return keyword
+		}
+	}
+	return types.Keyword{}
+}
+
 func calculateDuration(program types.Program) int {
 	duration := program.Duration
 
@@ -388,6 +420,98 @@ func findPendingRecording(pendingRecordings []types.Recording, program types.Pro
 	return nil
 }
 
+// simulcastKey identifies one airing of a program regardless of channel.
+func simulcastKey(program types.Program) string {
+	start := program.Start
+	if t, err := parseProgramStartTime(program, time.UTC); err == nil {
+		start = t.Format(time.RFC3339)
+	}
+	return strings.ToLower(program.Title) + "\x00" + strings.ToLower(program.SubTitle) + "\x00" + start
+}
+
+// simulcastChannels maps each simulcastKey to the channels airing it, best
+// first: channels in preference order, then the rest by lowest subchannel
+// (the main, usually HD, feed is x.1) and guide number.
+func simulcastChannels(programs []types.Program, preference []string) map[string][]string {
+	rank := make(map[string]int, len(preference))
+	for i, ch := range preference {
+		if _, ok := rank[ch]; !ok {
+			rank[ch] = i
+		}
+	}
+	rankOf := func(ch string) int {
+		if r, ok := rank[ch]; ok {
+			return r
+		}
+		return len(preference)
+	}
+
+	groups := make(map[string][]string)
+	for _, p := range programs {
+		key := simulcastKey(p)
+		dup := false
+		for _, ch := range groups[key] {
+			if ch == p.Channel {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			groups[key] = append(groups[key], p.Channel)
+		}
+	}
+
+	for _, channels := range groups {
+		if len(channels) < 2 {
+			continue
+		}
+		sort.Slice(channels, func(i, j int) bool {
+			a, b := channels[i], channels[j]
+			if ra, rb := rankOf(a), rankOf(b); ra != rb {
+				return ra < rb
+			}
+			if ma, mb := subchannel(a), subchannel(b); ma != mb {
+				return ma < mb
+			}
+			return a < b
+		})
+	}
+	return groups
+}
+
+// subchannel returns the minor part of a guide number such as "5.2", or 0 for
+// a channel without one.
+func subchannel(guideNumber string) int {
+	_, minor, ok := strings.Cut(guideNumber, ".")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(minor)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// findPendingSimulcast looks for a pending recording of program on its own
+// channel or any other channel in channels.
+func findPendingSimulcast(pendingRecordings []types.Recording, program types.Program, channels []string, loc *time.Location) *types.Recording {
+	if rec := findPendingRecording(pendingRecordings, program, loc); rec != nil {
+		return rec
+	}
+	for _, ch := range channels {
+		if ch == program.Channel {
+			continue
+		}
+		sibling := program
+		sibling.Channel = ch
+		if rec := findPendingRecording(pendingRecordings, sibling, loc); rec != nil {
+			return rec
+		}
+	}
+	return nil
+}
+
 func updateRecordingTitle(apiURL string, id int, title string) error {
 	reqBody := map[string]string{"title": title}
 	body, err := json.Marshal(reqBody)
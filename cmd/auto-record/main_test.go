@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestSimulcastChannels(t *testing.T) {
+	programs := []types.Program{
+		{Channel: "5.4", Title: "Evening News", Start: "2026-02-01T18:00:00-08:00"},
+		{Channel: "5.1", Title: "Evening News", Start: "2026-02-02T02:00:00Z"},
+		{Channel: "9.1", Title: "Nova", SubTitle: "Ice", Start: "2026-02-01T20:00:00Z"},
+		{Channel: "9.2", Title: "NOVA", SubTitle: "ice", Start: "2026-02-01T20:00:00Z"},
+		{Channel: "9.2", Title: "Nova", SubTitle: "Ice", Start: "2026-02-01T20:00:00Z"},
+		{Channel: "9.1", Title: "Nova", SubTitle: "Fire", Start: "2026-02-01T21:00:00Z"},
+	}
+
+	got := simulcastChannels(programs, nil)
+	if ch := got[simulcastKey(programs[0])]; !reflect.DeepEqual(ch, []string{"5.1", "5.4"}) {
+		t.Errorf("news: got %v, want main subchannel first", ch)
+	}
+	if ch := got[simulcastKey(programs[2])]; !reflect.DeepEqual(ch, []string{"9.1", "9.2"}) {
+		t.Errorf("nova: got %v, want one entry per channel", ch)
+	}
+	if ch := got[simulcastKey(programs[5])]; !reflect.DeepEqual(ch, []string{"9.1"}) {
+		t.Errorf("single airing: got %v", ch)
+	}
+
+	got = simulcastChannels(programs, []string{"9.2", "5.4"})
+	if ch := got[simulcastKey(programs[0])]; ch[0] != "5.4" {
+		t.Errorf("preference: got %v, want 5.4 first", ch)
+	}
+	if ch := got[simulcastKey(programs[2])]; ch[0] != "9.2" {
+		t.Errorf("preference: got %v, want 9.2 first", ch)
+	}
+}
+
+func TestFindPendingSimulcast(t *testing.T) {
+	pending := []types.Recording{{ID: 3, ChannelID: "5.4", Date: "2026-02-01", StartTime: "18:00"}}
+	program := types.Program{Channel: "5.1", Title: "Evening News", Start: "2026-02-02T02:00:00Z"}
+
+	if rec := findPendingSimulcast(pending, program, []string{"5.1"}, time.UTC); rec != nil {
+		t.Errorf("expected no match without the simulcast, got %+v", rec)
+	}
+	loc := time.FixedZone("PST", -8*3600)
+	if rec := findPendingSimulcast(pending, program, []string{"5.1", "5.4"}, loc); rec == nil || rec.ID != 3 {
+		t.Errorf("expected the recording on 5.4, got %+v", rec)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/client"
+)
+
+const usage = `Usage: dvrctl [-server URL] [-key KEY] <command> [arguments]
+
+Commands:
+  channels [list] [-all]                     List enabled channels; -all adds disabled and stale ones
+  rec list [-status S]                       List recordings, optionally by status
+  rec add [-date D] [-title T] CH HH:MM DUR  Schedule a recording, e.g. "rec add 5.1 20:00 60m"
+  rec rm ID...                               Delete recordings
+  guide search [-n N] QUERY                  Search the guide
+  guide refresh                              Regenerate the guide on the server
+  rules list                                 List auto-record rules
+  rules add [-category C] [-commercials M] TITLE
+                                             Record every program whose title contains TITLE
+  download [-o FILE] ID                      Download a recording, resuming a partial FILE
+  logs [-n N] [-f]                           Show recent server log lines; -f follows
+  config [save]                              Show the server and key in use, or save them
+
+"recordings", "record" and "cancel" remain as the old names of rec list,
+rec add and rec rm.
+
+The server is -server, else $DVR_SERVER, else the saved config, else
+http://localhost:8080. The API key, needed when the server has auth
+enabled, is -key, else $DVR_API_KEY, else the saved config. The config is
+saved to $DVRCTL_CONFIG, or dvrctl/config.json in the user config
+directory.
+`
+
+// errUsage is returned for malformed command lines; main prints usage for it.
+var errUsage = errors.New("invalid usage")
+
+// settings is what "config save" stores.
+type settings struct {
+	Server string `json:"server,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// ctl runs commands against one server.
+type ctl struct {
+	api *client.Client
+	out io.Writer
+	now time.Time
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, time.Now()); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		}
+		fmt.Fprintf(os.Stderr, "dvrctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// configPath is where "config save" writes and every command reads.
+func configPath() (string, error) {
+	if p := os.Getenv("DVRCTL_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dvrctl", "config.json"), nil
+}
+
+// loadSettings reads the saved config; a missing file is an empty one.
+func loadSettings(p string) (settings, error) {
+	var s settings
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%s: %w", p, err)
+	}
+	return s, nil
+}
+
+func run(args []string, out io.Writer, now time.Time) error {
+	fs := flag.NewFlagSet("dvrctl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	server := fs.String("server", "", "DVR server base URL")
+	apiKey := fs.String("key", "", "API key")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+
+	cfgPath, err := configPath()
+	if err != nil {
+		return err
+	}
+	saved, err := loadSettings(cfgPath)
+	if err != nil {
+		return err
+	}
+	pick := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	use := settings{
+		Server: pick(*server, os.Getenv("DVR_SERVER"), saved.Server, "http://localhost:8080"),
+		Key:    pick(*apiKey, os.Getenv("DVR_API_KEY"), saved.Key),
+	}
+
+	c := &ctl{api: client.New(use.Server, use.Key), out: out, now: now}
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	sub := ""
+	if len(rest) > 0 {
+		sub = rest[0]
+	}
+	switch {
+	case cmd == "channels" && sub == "list":
+		return c.channels(rest[1:])
+	case cmd == "channels":
+		return c.channels(rest)
+	case cmd == "rec" && sub == "list", cmd == "recordings":
+		return c.recordings(tail(cmd == "rec", rest))
+	case cmd == "rec" && sub == "add", cmd == "record":
+		return c.record(tail(cmd == "rec", rest))
+	case cmd == "rec" && sub == "rm", cmd == "cancel":
+		return c.remove(tail(cmd == "rec", rest))
+	case cmd == "guide" && sub == "search":
+		return c.search(rest[1:])
+	case cmd == "guide" && sub == "refresh" && len(rest) == 1:
+		return c.guideRefresh()
+	case cmd == "rules" && sub == "list" && len(rest) == 1:
+		return c.rules()
+	case cmd == "rules" && sub == "add":
+		return c.addRule(rest[1:])
+	case cmd == "download":
+		return c.download(rest)
+	case cmd == "logs":
+		return c.logs(rest)
+	case cmd == "config" && len(rest) == 0:
+		key := "not set"
+		if use.Key != "" {
+			key = "set"
+		}
+		fmt.Fprintf(out, "Server: %s\nAPI key: %s\nConfig file: %s\n", use.Server, key, cfgPath) //nolint: errcheck
+		return nil
+	case cmd == "config" && sub == "save" && len(rest) == 1:
+		return saveSettings(cfgPath, use, out)
+	case cmd == "rec", cmd == "guide", cmd == "rules", cmd == "config":
+		return fmt.Errorf("%w: unknown %s command %q", errUsage, cmd, sub)
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+}
+
+// tail drops the subcommand from args of the two-word form of a command.
+func tail(sub bool, args []string) []string {
+	if sub {
+		return args[1:]
+	}
+	return args
+}
+
+// saveSettings writes s to p, readable only by the user since it holds
+// the API key.
+func saveSettings(p string, s settings, out io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Saved server %s to %s\n", s.Server, p) //nolint: errcheck
+	return nil
+}
+
+func (c *ctl) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 30*time.Second)
+}
+
+func (c *ctl) channels(args []string) error {
+	fs := flag.NewFlagSet("channels", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	all := fs.Bool("all", false, "include disabled and stale channels")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	ctx, cancel := c.ctx()
+	defer cancel()
+	channels, err := c.api.ListChannels(ctx, *all)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANNEL\tNAME") //nolint: errcheck
+	for _, ch := range channels {
+		fmt.Fprintf(tw, "%s\t%s\n", ch.GuideNumber, ch.GuideName) //nolint: errcheck
+	}
+	return tw.Flush()
+}
+
+func (c *ctl) recordings(args []string) error {
+	fs := flag.NewFlagSet("recordings", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	status := fs.String("status", "", "only show recordings with this status")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	ctx, cancel := c.ctx()
+	defer cancel()
+	recs, err := c.api.ListRecordings(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tTIME\tMIN\tCHANNEL\tSTATUS\tTITLE") //nolint: errcheck
+	for _, r := range recs {
+		if *status != "" && r.Status != *status {
+			continue
+		}
+		title := ""
+		if r.Title != nil {
+			title = *r.Title
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", r.ID, r.Date, r.StartTime, r.Duration, r.ChannelID, r.Status, title) //nolint: errcheck
+	}
+	return tw.Flush()
+}
+
+// parseMinutes accepts a Go duration ("60m", "1h30m") or a bare number of
+// minutes.
+func parseMinutes(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("duration must be positive")
+		}
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	if d < time.Minute {
+		return 0, fmt.Errorf("duration must be at least one minute")
+	}
+	return int(d.Round(time.Minute) / time.Minute), nil
+}
+
+// resolveDate picks today for a start time still ahead of now, otherwise
+// tomorrow.
+func resolveDate(startTime string, now time.Time) (string, error) {
+	t, err := time.ParseInLocation("15:04", startTime, now.Location())
+	if err != nil {
+		return "", fmt.Errorf("invalid start time %q, want HH:MM", startTime)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !start.After(now) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start.Format("2006-01-02"), nil
+}
+
+func (c *ctl) record(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	date := fs.String("date", "", "date (YYYY-MM-DD); defaults to the next occurrence of the start time")
+	title := fs.String("title", "", "recording title")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 3 {
+		return errUsage
+	}
+	channel, startTime := fs.Arg(0), fs.Arg(1)
+
+	if _, err := time.Parse("15:04", startTime); err != nil {
+		return fmt.Errorf("invalid start time %q, want HH:MM", startTime)
+	}
+	minutes, err := parseMinutes(fs.Arg(2))
+	if err != nil {
+		return err
+	}
+	if *date == "" {
+		if *date, err = resolveDate(startTime, c.now); err != nil {
+			return err
+		}
+	} else if _, err := time.Parse("2006-01-02", *date); err != nil {
+		return fmt.Errorf("invalid date %q, want YYYY-MM-DD", *date)
+	}
+
+	req := client.RecordingRequest{ChannelID: channel, Date: *date, StartTime: startTime, Duration: minutes}
+	if *title != "" {
+		req.Title = title
+	}
+	ctx, cancel := c.ctx()
+	defer cancel()
+	created, err := c.api.CreateRecording(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Scheduled recording %d: channel %s on %s at %s for %d minutes\n", created.ID, channel, *date, startTime, minutes) //nolint: errcheck
+	return nil
+}
+
+func (c *ctl) remove(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	var ids []int
+	for _, a := range args {
+		id, err := strconv.Atoi(a)
+		if err != nil {
+			return fmt.Errorf("invalid recording ID %q", a)
+		}
+		ids = append(ids, id)
+	}
+	ctx, cancel := c.ctx()
+	defer cancel()
+	for _, id := range ids {
+		if err := c.api.DeleteRecording(ctx, id); err != nil {
+			return fmt.Errorf("recording %d: %w", id, err)
+		}
+		fmt.Fprintf(c.out, "Cancelled recording %d\n", id) //nolint: errcheck
+	}
+	return nil
+}
+
+func (c *ctl) search(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	n := fs.Int("n", 0, "maximum number of results")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 || *n < 0 {
+		return errUsage
+	}
+
+	ctx, cancel := c.ctx()
+	defer cancel()
+	programs, err := c.api.SearchGuide(ctx, strings.Join(fs.Args(), " "), *n)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tTIME\tMIN\tCHANNEL\tTITLE") //nolint: errcheck
+	for _, p := range programs {
+		date, clock := p.Start, ""
+		if t, err := time.Parse(time.RFC3339, p.Start); err == nil {
+			t = t.In(c.now.Location())
+			date, clock = t.Format("2006-01-02"), t.Format("15:04")
+		}
+		title := p.Title
+		if p.SubTitle != "" {
+			title += " - " + p.SubTitle
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", date, clock, p.Duration, p.Channel, title) //nolint: errcheck
+	}
+	return tw.Flush()
+}
+
+func (c *ctl) guideRefresh() error {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	if err := c.api.RefreshGuide(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "Guide refresh started; the server reloads the guide when it finishes") //nolint: errcheck
+	return nil
+}
+
+func (c *ctl) rules() error {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	keywords, err := c.api.ListKeywords(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tCATEGORY\tENABLED") //nolint: errcheck
+	for _, k := range keywords {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%t\n", k.ID, k.Name, k.Category, k.Enabled) //nolint: errcheck
+	}
+	return tw.Flush()
+}
+
+func (c *ctl) addRule(args []string) error {
+	fs := flag.NewFlagSet("rules add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	category := fs.String("category", "", "only programs in this guide category")
+	commercials := fs.String("commercials", "", "mark or cut commercials in its recordings")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+
+	ctx, cancel := c.ctx()
+	defer cancel()
+	k, err := c.api.CreateKeyword(ctx, client.KeywordRequest{Name: strings.Join(fs.Args(), " "), Category: *category, Commercials: *commercials})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Added rule %d: record %q\n", k.ID, k.Name) //nolint: errcheck
+	return nil
+}
+
+func (c *ctl) download(args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	output := fs.String("o", "", "output file; defaults to the recording's file name")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid recording ID %q", fs.Arg(0))
+	}
+
+	// Downloads take as long as they take; only the lookup is bounded.
+	if *output == "" {
+		ctx, cancel := c.ctx()
+		recs, err := c.api.ListRecordings(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		*output = fmt.Sprintf("%d.ts", id)
+		for _, r := range recs {
+			if r.ID == id && r.FilePath != nil {
+				*output = path.Base(*r.FilePath)
+			}
+		}
+	}
+
+	f, err := os.OpenFile(*output, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	n, err := c.api.DownloadRecording(context.Background(), id, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading recording %d to %s (run again to resume): %w", id, *output, err)
+	}
+	fmt.Fprintf(c.out, "Downloaded recording %d to %s (%d bytes)\n", id, *output, n) //nolint: errcheck
+	return nil
+}
+
+func (c *ctl) logs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	n := fs.Int("n", 50, "number of lines to show")
+	follow := fs.Bool("f", false, "keep polling for new lines")
+	interval := fs.Duration("interval", 2*time.Second, "poll interval with -f")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *n <= 0 {
+		return errUsage
+	}
+
+	var since int64
+	lines := *n
+	for {
+		ctx, cancel := c.ctx()
+		resp, err := c.api.Logs(ctx, since, lines)
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, l := range resp.Lines {
+			fmt.Fprintln(c.out, l.Text) //nolint: errcheck
+		}
+		if !*follow {
+			return nil
+		}
+		if resp.Last > since {
+			since = resp.Last
+		}
+		lines = 1000
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMinutes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"60m", 60, false},
+		{"1h30m", 90, false},
+		{"45", 45, false},
+		{"0", 0, true},
+		{"30s", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMinutes(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMinutes(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveDate(t *testing.T) {
+	now := time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC)
+	for in, want := range map[string]string{
+		"20:00": "2026-03-10",
+		"18:30": "2026-03-11",
+		"07:00": "2026-03-11",
+	} {
+		got, err := resolveDate(in, now)
+		if err != nil || got != want {
+			t.Errorf("resolveDate(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	t.Setenv("DVRCTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	var recordBody map[string]interface{}
+	var deleted, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/channels":
+			w.Write([]byte(`[{"guideNumber": "5.1", "guideName": "KING"}]`)) //nolint: errcheck
+		case r.Method == "GET" && r.URL.Path == "/api/v1/recordings":
+			w.Write([]byte(`[
+				{"id": 1, "channel_id": "5.1", "date": "2026-03-10", "start_time": "20:00", "duration": 60, "status": "pending", "title": "News"},
+				{"id": 2, "channel_id": "9.1", "date": "2026-03-09", "start_time": "19:00", "duration": 30, "status": "completed"}
+			]`)) //nolint: errcheck
+		case r.Method == "POST" && r.URL.Path == "/api/v1/recordings":
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&recordBody) //nolint: errcheck
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ID": 7}`)) //nolint: errcheck
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/v1/recordings/"):
+			deleted = strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
+			auth = r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "GET" && r.URL.Path == "/api/v1/logs":
+			w.Write([]byte(`{"lines": [{"seq": 4, "text": "hello"}], "last": 4}`)) //nolint: errcheck
+		case r.Method == "POST" && r.URL.Path == "/api/v1/guide/refresh":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error": "Guide refresh already running"}`)) //nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC)
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(append([]string{"-server", srv.URL, "-key", "dvr_test"}, args...), &out, now)
+		return out.String(), err
+	}
+
+	if out, err := run("channels"); err != nil || !strings.Contains(out, "5.1") || !strings.Contains(out, "KING") {
+		t.Errorf("channels: got %q (err: %v)", out, err)
+	}
+
+	out, err := run("recordings", "-status", "pending")
+	if err != nil || !strings.Contains(out, "News") || strings.Contains(out, "9.1") {
+		t.Errorf("recordings: got %q (err: %v)", out, err)
+	}
+
+	out, err = run("record", "-title", "Late Show", "5.1", "20:00", "1h30m")
+	if err != nil || !strings.Contains(out, "recording 7") {
+		t.Fatalf("record: got %q (err: %v)", out, err)
+	}
+	if recordBody["channelId"] != "5.1" || recordBody["date"] != "2026-03-10" || recordBody["startTime"] != "20:00" ||
+		recordBody["duration"] != float64(90) || recordBody["title"] != "Late Show" {
+		t.Errorf("unexpected record request %v", recordBody)
+	}
+
+	if _, err := run("cancel", "7"); err != nil || deleted != "7" || auth != "Bearer dvr_test" {
+		t.Errorf("cancel: deleted %q with %q (err: %v)", deleted, auth, err)
+	}
+
+	if out, err := run("logs", "-n", "10"); err != nil || out != "hello\n" {
+		t.Errorf("logs: got %q (err: %v)", out, err)
+	}
+
+	if _, err := run("guide", "refresh"); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("guide refresh: expected conflict error, got %v", err)
+	}
+
+	for _, args := range [][]string{{}, {"bogus"}, {"record", "5.1"}, {"guide"}} {
+		if _, err := run(args...); !errors.Is(err, errUsage) {
+			t.Errorf("%v: expected usage error, got %v", args, err)
+		}
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "dvrctl", "config.json")
+	t.Setenv("DVRCTL_CONFIG", cfgPath)
+	t.Setenv("DVR_SERVER", "")
+	t.Setenv("DVR_API_KEY", "")
+	content := []byte(strings.Repeat("ts", 500))
+	var deleted []string
+	var rule map[string]interface{}
+	var search, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/channels":
+			if r.URL.Query().Get("all") == "true" {
+				w.Write([]byte(`[{"guideNumber": "5.1", "guideName": "KING"}, {"guideNumber": "7.1", "guideName": "KOMO", "stale": true}]`)) //nolint: errcheck
+				return
+			}
+			w.Write([]byte(`[{"guideNumber": "5.1", "guideName": "KING"}]`)) //nolint: errcheck
+		case r.Method == "GET" && r.URL.Path == "/api/v1/recordings":
+			w.Write([]byte(`[{"id": 3, "channel_id": "5.1", "status": "completed", "file_path": "News/News 2026-03-09.mp4"}]`)) //nolint: errcheck
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/v1/recordings/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/"))
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "GET" && r.URL.Path == "/api/v1/guide/search":
+			search = r.URL.RawQuery
+			w.Write([]byte(`[{"channel": "5.1", "title": "Nova", "subtitle": "Black Holes", "start": "2026-03-11T20:00:00Z", "duration": 60}]`)) //nolint: errcheck
+		case r.Method == "POST" && r.URL.Path == "/api/v1/keywords":
+			json.NewDecoder(r.Body).Decode(&rule) //nolint: errcheck
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 4, "name": "Nova"}`)) //nolint: errcheck
+		case r.Method == "GET" && r.URL.Path == "/api/v1/keywords":
+			w.Write([]byte(`[{"id": 4, "name": "Nova", "category": "Science", "enabled": true}]`)) //nolint: errcheck
+		case r.Method == "GET" && r.URL.Path == "/api/v1/recordings/3/file":
+			http.ServeContent(w, r, "news.mp4", time.Time{}, bytes.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC)
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(args, &out, now)
+		return out.String(), err
+	}
+
+	// Saving the server and key lets later commands leave them out.
+	if _, err := run("-server", srv.URL, "-key", "dvr_saved", "config", "save"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(cfgPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("config file %v, %v", info, err)
+	}
+	if out, err := run("config"); err != nil || !strings.Contains(out, srv.URL) || !strings.Contains(out, "API key: set") {
+		t.Errorf("config: got %q (err: %v)", out, err)
+	}
+
+	if out, err := run("channels", "list", "-all"); err != nil || !strings.Contains(out, "KOMO") || auth != "Bearer dvr_saved" {
+		t.Errorf("channels list -all: got %q with %q (err: %v)", out, auth, err)
+	}
+	if out, err := run("rec", "list", "-status", "completed"); err != nil || !strings.Contains(out, "completed") {
+		t.Errorf("rec list: got %q (err: %v)", out, err)
+	}
+	if out, err := run("rec", "rm", "3", "4"); err != nil || strings.Join(deleted, ",") != "3,4" || strings.Count(out, "Cancelled") != 2 {
+		t.Errorf("rec rm: deleted %v, got %q (err: %v)", deleted, out, err)
+	}
+
+	out, err := run("guide", "search", "-n", "5", "black", "holes")
+	if err != nil || search != "limit=5&q=black+holes" || !strings.Contains(out, "2026-03-11  20:00") || !strings.Contains(out, "Nova - Black Holes") {
+		t.Errorf("guide search: sent %q, got %q (err: %v)", search, out, err)
+	}
+
+	if out, err := run("rules", "add", "-category", "Science", "Nova"); err != nil || !strings.Contains(out, "rule 4") || rule["name"] != "Nova" || rule["category"] != "Science" {
+		t.Errorf("rules add: sent %v, got %q (err: %v)", rule, out, err)
+	}
+	if out, err := run("rules", "list"); err != nil || !strings.Contains(out, "Science") {
+		t.Errorf("rules list: got %q (err: %v)", out, err)
+	}
+
+	// download names the file after the recording's, and picks up where an
+	// interrupted download left off.
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile("News 2026-03-09.mp4", content[:300], 0o644) //nolint: errcheck
+	if out, err := run("download", "3"); err != nil || !strings.Contains(out, "(1000 bytes)") {
+		t.Errorf("download: got %q (err: %v)", out, err)
+	}
+	if got, _ := os.ReadFile("News 2026-03-09.mp4"); !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes", len(got))
+	}
+	if _, err := run("download", "-o", "other.ts", "9"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("download of a missing recording: %v", err)
+	}
+
+	for _, args := range [][]string{{"rec"}, {"rec", "play"}, {"rec", "rm"}, {"guide", "search"}, {"rules", "add"}, {"download"}, {"config", "load"}} {
+		if _, err := run(args...); !errors.Is(err, errUsage) {
+			t.Errorf("%v: expected usage error, got %v", args, err)
+		}
+	}
+}
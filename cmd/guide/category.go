@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// defaultCategoryRules is the built-in mapping from provider attributes to
+// DVR categories, applied after any rules from config.json.
+var defaultCategoryRules = []pkgcfg.CategoryRule{
+	{Field: "type", Match: "Movie", Category: "movie"},
+	{Field: "type", Match: "Feature Film", Category: "movie"},
+	{Field: "type", Match: "Sports", Category: "sports"},
+	{Field: "type", Match: "News", Category: "news"},
+	{Field: "type", Match: "Paid Programming", Category: "paid"},
+	{Field: "genre", Match: "Documentary", Category: "documentary"},
+	{Field: "genre", Match: "Reality", Category: "reality"},
+	{Field: "genre", Match: "Talk", Category: "talk"},
+	{Field: "genre", Match: "Children", Category: "kids"},
+	{Field: "genre", Match: "Animated", Category: "kids"},
+	{Field: "genre", Match: "News", Category: "news"},
+	{Field: "genre", Match: "Newsmagazine", Category: "news"},
+	{Field: "genre", Match: "Sports event", Category: "sports"},
+	{Field: "genre", Match: "Sports talk", Category: "sports"},
+	{Field: "genre", Match: "Sports non-event", Category: "sports"},
+	{Field: "genre", Match: "Game show", Category: "gameshow"},
+	{Field: "genre", Match: "Soap", Category: "soap"},
+	{Field: "genre", Match: "Cooking", Category: "lifestyle"},
+	{Field: "genre", Match: "Home improvement", Category: "lifestyle"},
+	{Field: "genre", Match: "Drama", Category: "drama"},
+	{Field: "genre", Match: "Comedy", Category: "comedy"},
+	{Field: "genre", Match: "Sitcom", Category: "comedy"},
+}
+
+// programAttributes are the provider-specific values a program is
+// categorized by.
+type programAttributes struct {
+	Types  []string
+	Genres []string
+	Flags  []string
+}
+
+// categoryMapper assigns a single DVR category to a program using the first
+// matching rule.
+type categoryMapper struct {
+	rules []pkgcfg.CategoryRule
+}
+
+func newCategoryMapper(custom []pkgcfg.CategoryRule) *categoryMapper {
+	rules := make([]pkgcfg.CategoryRule, 0, len(custom)+len(defaultCategoryRules))
+	rules = append(rules, custom...)
+	rules = append(rules, defaultCategoryRules...)
+	return &categoryMapper{rules: rules}
+}
+
+func (m *categoryMapper) Category(attrs programAttributes) string {
+	for _, rule := range m.rules {
+		var values []string
+		switch rule.Field {
+		case "type":
+			values = attrs.Types
+		case "genre":
+			values = attrs.Genres
+		case "flag":
+			values = attrs.Flags
+		}
+		for _, v := range values {
+			if strings.EqualFold(strings.TrimSpace(v), rule.Match) {
+				return rule.Category
+			}
+		}
+	}
+	return ""
+}
+
+// splitGenres splits a provider's comma-separated genre list.
+func splitGenres(genres string) []string {
+	var out []string
+	for _, g := range strings.Split(genres, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			out = append(out, g)
+		}
+	}
+	return out
+}
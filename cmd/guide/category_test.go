@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestCategoryMapper_Defaults(t *testing.T) {
+	m := newCategoryMapper(nil)
+
+	tests := []struct {
+		name  string
+		attrs programAttributes
+		want  string
+	}{
+		{"movie type", programAttributes{Types: []string{"Movie"}, Genres: []string{"Documentary"}}, "movie"},
+		{"sd feature film", programAttributes{Types: []string{"Show", "Feature Film"}}, "movie"},
+		{"documentary genre", programAttributes{Types: []string{"Series"}, Genres: []string{"Documentary"}}, "documentary"},
+		{"reality genre", programAttributes{Genres: []string{"reality"}}, "reality"},
+		{"talk genre", programAttributes{Genres: []string{" Talk "}}, "talk"},
+		{"sports event", programAttributes{Genres: []string{"Sports event"}}, "sports"},
+		{"unknown", programAttributes{Types: []string{"Series"}, Genres: []string{"Western"}}, ""},
+	}
+	for _, tt := range tests {
+		if got := m.Category(tt.attrs); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryMapper_CustomRulesFirst(t *testing.T) {
+	m := newCategoryMapper([]pkgcfg.CategoryRule{
+		{Field: "genre", Match: "Documentary", Category: "docs"},
+		{Field: "flag", Match: "live", Category: "live"},
+	})
+
+	if got := m.Category(programAttributes{Genres: []string{"Documentary"}}); got != "docs" {
+		t.Errorf("custom genre rule: got %q, want docs", got)
+	}
+	if got := m.Category(programAttributes{Types: []string{"Sports"}, Flags: []string{"Live"}}); got != "live" {
+		t.Errorf("custom flag rule: got %q, want live", got)
+	}
+	if got := m.Category(programAttributes{Types: []string{"Sports"}}); got != "sports" {
+		t.Errorf("fallback to defaults: got %q, want sports", got)
+	}
+}
+
+func TestSplitGenres(t *testing.T) {
+	got := splitGenres("Reality, Talk,,Comedy ")
+	want := []string{"Reality", "Talk", "Comedy"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
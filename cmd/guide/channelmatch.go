@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+type matchKind int
+
+const (
+	matchNone matchKind = iota
+	matchFuzzy
+	matchExact
+	matchOverride
+)
+
+// channelMatcher resolves provider lineup entries to the tuner's
+// GuideNumbers. Exact number equality is tried first, then a normalized
+// number, then the station call sign against the tuner's GuideName. Fuzzy
+// matches are only used when they identify a single tuner channel. A nil or
+// empty matcher accepts every provider channel number unchanged.
+type channelMatcher struct {
+	exact    map[string]bool
+	byNumber map[string][]string
+	byCall   map[string][]string
+}
+
+func newChannelMatcher(local []types.Channel) *channelMatcher {
+	m := &channelMatcher{
+		exact:    make(map[string]bool),
+		byNumber: make(map[string][]string),
+		byCall:   make(map[string][]string),
+	}
+	for _, ch := range local {
+		if m.exact[ch.GuideNumber] {
+			continue
+		}
+		m.exact[ch.GuideNumber] = true
+		n := normalizeChannelNumber(ch.GuideNumber)
+		m.byNumber[n] = append(m.byNumber[n], ch.GuideNumber)
+		if c := normalizeCallSign(ch.GuideName); c != "" {
+			m.byCall[c] = append(m.byCall[c], ch.GuideNumber)
+		}
+	}
+	return m
+}
+
+func (m *channelMatcher) empty() bool {
+	return m == nil || len(m.exact) == 0
+}
+
+// has reports whether the tuner has guideNumber.
+func (m *channelMatcher) has(guideNumber string) bool {
+	return m.empty() || m.exact[guideNumber]
+}
+
+// match returns the tuner GuideNumber for a provider lineup entry.
+func (m *channelMatcher) match(ch types.LineupData) (string, matchKind) {
+	if m.has(ch.ChannelNumber) {
+		return ch.ChannelNumber, matchExact
+	}
+	if nums := m.byNumber[normalizeChannelNumber(ch.ChannelNumber)]; len(nums) == 1 {
+		return nums[0], matchFuzzy
+	}
+	if c := normalizeCallSign(ch.StationCallSign); c != "" {
+		if nums := m.byCall[c]; len(nums) == 1 {
+			return nums[0], matchFuzzy
+		}
+	}
+	return "", matchNone
+}
+
+// normalizeChannelNumber reduces a channel number to "major.minor" without
+// leading zeros, so "5-1", "005.01" and "5.1" compare equal. Trailing zeros
+// are kept: 5.10 is a different subchannel from 5.1.
+func normalizeChannelNumber(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '-' || r == '_' || r == ' ' })
+	if len(parts) == 0 {
+		return ""
+	}
+	major := strings.TrimLeft(parts[0], "0")
+	if len(parts) == 1 {
+		return major
+	}
+	minor := strings.TrimLeft(parts[1], "0")
+	if minor == "" {
+		return major
+	}
+	return major + "." + minor
+}
+
+// callSignSuffixes are service designators that tuners and guide providers
+// append inconsistently ("KING-DT", "KONG-HD", "KCTS-TV").
+var callSignSuffixes = []string{"HD", "DT", "TV", "LD", "LP", "CD", "CA"}
+
+// normalizeCallSign reduces a station name to its bare call sign: upper case
+// letters with trailing digits and service suffixes removed.
+func normalizeCallSign(s string) string {
+	s = strings.ToUpper(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s))
+	for {
+		trimmed := strings.TrimRightFunc(s, unicode.IsDigit)
+		for _, suffix := range callSignSuffixes {
+			if len(trimmed) > len(suffix)+2 && strings.HasSuffix(trimmed, suffix) {
+				trimmed = strings.TrimSuffix(trimmed, suffix)
+				break
+			}
+		}
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func TestNormalizeChannelNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"5.1":    "5.1",
+		"5.10":   "5.10",
+		"5.010":  "5.10",
+		"005.01": "5.1",
+		"5-1":    "5.1",
+		"9":      "9",
+		"9.0":    "9",
+		"12.3":   "12.3",
+	} {
+		if got := normalizeChannelNumber(in); got != want {
+			t.Errorf("normalizeChannelNumber(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeCallSign(t *testing.T) {
+	for in, want := range map[string]string{
+		"KING-HD":  "KING",
+		"kctsdt2":  "KCTS",
+		"KOMO-TV":  "KOMO",
+		"KGTV":     "KGTV",
+		"KZJO-LD3": "KZJO",
+		"":         "",
+	} {
+		if got := normalizeCallSign(in); got != want {
+			t.Errorf("normalizeCallSign(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestChannelMatcher(t *testing.T) {
+	m := newChannelMatcher([]types.Channel{
+		{GuideNumber: "5.10", GuideName: "KING-HD"},
+		{GuideNumber: "9.1", GuideName: "KCTS-DT"},
+		{GuideNumber: "22.1", GuideName: "KZJO"},
+		{GuideNumber: "22.10", GuideName: "KZJO-2"},
+	})
+
+	tests := []struct {
+		ch       types.LineupData
+		want     string
+		wantKind matchKind
+	}{
+		{types.LineupData{ChannelNumber: "9.1"}, "9.1", matchExact},
+		{types.LineupData{ChannelNumber: "5.1", StationCallSign: "KING"}, "5.10", matchFuzzy},
+		{types.LineupData{ChannelNumber: "44.1", StationCallSign: "KCTS"}, "9.1", matchFuzzy},
+		{types.LineupData{ChannelNumber: "022.1", StationCallSign: "KZJO"}, "22.1", matchFuzzy},
+		{types.LineupData{ChannelNumber: "22.010"}, "22.10", matchFuzzy},
+		// 9.10 is another subchannel, not a padded 9.1.
+		{types.LineupData{ChannelNumber: "9.10"}, "", matchNone},
+		// KZJO and KZJO-2 share a call sign.
+		{types.LineupData{ChannelNumber: "22.3", StationCallSign: "KZJO"}, "", matchNone},
+		{types.LineupData{ChannelNumber: "13.1", StationCallSign: "KCPQ"}, "", matchNone},
+	}
+	for _, tt := range tests {
+		got, kind := m.match(tt.ch)
+		if got != tt.want || kind != tt.wantKind {
+			t.Errorf("match(%+v) = %q, %d; want %q, %d", tt.ch, got, kind, tt.want, tt.wantKind)
+		}
+	}
+
+	var empty *channelMatcher
+	if got, kind := empty.match(types.LineupData{ChannelNumber: "7.1"}); got != "7.1" || kind != matchExact {
+		t.Errorf("nil matcher: got %q, %d", got, kind)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+// scheduleTrigger is a parsed GuideScheduleEntry. Exactly one of at (minutes
+// after midnight) and every is in use.
+type scheduleTrigger struct {
+	at          int           // minutes after midnight
+	every       time.Duration // interval, counted from midnight
+	refetchDays int           // days fetched again even if already processed
+}
+
+// parseGuideSchedule validates the guideSchedule entries and returns their triggers.
+func parseGuideSchedule(entries []pkgcfg.GuideScheduleEntry) ([]scheduleTrigger, error) {
+	var triggers []scheduleTrigger
+	for _, e := range entries {
+		t := scheduleTrigger{refetchDays: e.RefetchDays}
+		switch {
+		case e.At != "" && e.Every != "":
+			return nil, fmt.Errorf("guideSchedule entry sets both at %q and every %q", e.At, e.Every)
+		case e.At != "":
+			clock, err := time.Parse("15:04", e.At)
+			if err != nil {
+				return nil, fmt.Errorf("guideSchedule at %q: want HH:MM", e.At)
+			}
+			t.at = clock.Hour()*60 + clock.Minute()
+		case e.Every != "":
+			d, err := time.ParseDuration(e.Every)
+			if err != nil || d < time.Minute || d > 24*time.Hour {
+				return nil, fmt.Errorf("guideSchedule every %q: want a duration between 1m and 24h", e.Every)
+			}
+			t.every = d
+		default:
+			return nil, fmt.Errorf("guideSchedule entry needs at or every")
+		}
+		triggers = append(triggers, t)
+	}
+	if len(triggers) == 0 {
+		return nil, fmt.Errorf("guideSchedule is empty")
+	}
+	return triggers, nil
+}
+
+// next returns the first time after now the trigger fires.
+func (t scheduleTrigger) next(now time.Time) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := midnight.AddDate(0, 0, 1)
+	if t.every == 0 {
+		at := midnight.Add(time.Duration(t.at) * time.Minute)
+		if !at.After(now) {
+			at = tomorrow.Add(time.Duration(t.at) * time.Minute)
+		}
+		return at
+	}
+	n := now.Sub(midnight)/t.every + 1
+	at := midnight.Add(n * t.every)
+	if at.After(tomorrow) {
+		at = tomorrow
+	}
+	return at
+}
+
+// nextTrigger returns the earliest time after now any trigger fires, and the
+// largest refetchDays among the triggers firing then.
+func nextTrigger(triggers []scheduleTrigger, now time.Time) (time.Time, int) {
+	var next time.Time
+	refetch := 0
+	for _, t := range triggers {
+		at := t.next(now)
+		switch {
+		case next.IsZero() || at.Before(next):
+			next, refetch = at, t.refetchDays
+		case at.Equal(next) && t.refetchDays > refetch:
+			refetch = t.refetchDays
+		}
+	}
+	return next, refetch
+}
+
+// runDaemon generates the guide once at startup and then on every trigger of
+// config.GuideSchedule until ctx is cancelled. Failed runs are logged and
+// retried at the next trigger. A value on reload reads the config file
+// again; if it fails to load, the current config is kept.
+func runDaemon(ctx context.Context, config *pkgcfg.Config, loc *time.Location, reload <-chan os.Signal) error {
+	triggers, err := parseGuideSchedule(config.GuideSchedule)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Guide daemon started with %d schedule entries", len(triggers))
+	if err := generateGuide(config, loc, 0); err != nil {
+		log.Printf("Error generating guide: %v", err)
+	}
+
+	for {
+		next, refetch := nextTrigger(triggers, time.Now().In(loc))
+		log.Printf("Next guide refresh at %s (refetching %d days)", next.Format(time.RFC3339), refetch)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("Guide daemon stopping")
+			return nil
+		case <-reload:
+			timer.Stop()
+			if c, t, l, err := reloadDaemonConfig(); err != nil {
+				log.Printf("Error reloading config, keeping the current one: %v", err)
+			} else {
+				config, triggers, loc = c, t, l
+				log.Printf("Config reloaded with %d schedule entries", len(triggers))
+			}
+			continue
+		case <-timer.C:
+		}
+
+		if err := generateGuide(config, loc, refetch); err != nil {
+			log.Printf("Error generating guide: %v", err)
+		}
+	}
+}
+
+// reloadDaemonConfig loads the config file and checks its schedule and
+// timezone.
+func reloadDaemonConfig() (*pkgcfg.Config, []scheduleTrigger, *time.Location, error) {
+	config, err := pkgcfg.LoadConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	triggers, err := parseGuideSchedule(config.GuideSchedule)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return config, triggers, loc, nil
+}
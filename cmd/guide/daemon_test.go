@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+)
+
+func TestParseGuideSchedule(t *testing.T) {
+	bad := [][]pkgcfg.GuideScheduleEntry{
+		nil,
+		{{}},
+		{{At: "4am"}},
+		{{Every: "30s"}},
+		{{Every: "48h"}},
+		{{At: "04:00", Every: "6h"}},
+	}
+	for _, entries := range bad {
+		if _, err := parseGuideSchedule(entries); err == nil {
+			t.Errorf("%+v: expected error", entries)
+		}
+	}
+}
+
+func TestNextTrigger(t *testing.T) {
+	triggers, err := parseGuideSchedule([]pkgcfg.GuideScheduleEntry{
+		{At: "04:00"},
+		{Every: "6h", RefetchDays: 1},
+		{At: "18:00", RefetchDays: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc := time.FixedZone("PST", -8*3600)
+	tests := []struct {
+		now     time.Time
+		want    time.Time
+		refetch int
+	}{
+		{time.Date(2026, 3, 1, 1, 0, 0, 0, loc), time.Date(2026, 3, 1, 4, 0, 0, 0, loc), 0},
+		{time.Date(2026, 3, 1, 4, 0, 0, 0, loc), time.Date(2026, 3, 1, 6, 0, 0, 0, loc), 1},
+		{time.Date(2026, 3, 1, 13, 30, 0, 0, loc), time.Date(2026, 3, 1, 18, 0, 0, 0, loc), 2},
+		{time.Date(2026, 3, 1, 19, 0, 0, 0, loc), time.Date(2026, 3, 2, 0, 0, 0, 0, loc), 1},
+	}
+	for _, tt := range tests {
+		got, refetch := nextTrigger(triggers, tt.now)
+		if !got.Equal(tt.want) || refetch != tt.refetch {
+			t.Errorf("nextTrigger(%s) = %s, %d; want %s, %d", tt.now, got, refetch, tt.want, tt.refetch)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// batchedSource is implemented by guide sources whose listings requests are
+// sized by channel count. buildGuide splits each day into requests of at
+// most ListingBatchSize channels; other sources get every channel at once.
+type batchedSource interface {
+	ListingBatchSize() int
+}
+
+// listingJob is one FetchListings call: a slice of the lineup for one day.
+type listingJob struct {
+	day        int
+	channels   []types.LineupData
+	start, end time.Time
+}
+
+type listingResult struct {
+	programs []types.Program
+	err      error
+}
+
+// listingJobs splits lineup into batches for each of the given days, which
+// index into windows.
+func listingJobs(src GuideSource, lineup []types.LineupData, windows [][2]time.Time, days []int) []listingJob {
+	size := len(lineup)
+	if b, ok := src.(batchedSource); ok && b.ListingBatchSize() > 0 {
+		size = b.ListingBatchSize()
+	}
+	size = max(size, 1)
+
+	var jobs []listingJob
+	for _, day := range days {
+		for i := 0; i == 0 || i < len(lineup); i += size {
+			end := min(i+size, len(lineup))
+			jobs = append(jobs, listingJob{day: day, channels: lineup[i:end], start: windows[day][0], end: windows[day][1]})
+		}
+	}
+	return jobs
+}
+
+// fetchListings runs jobs on at most parallelism workers. results[i] belongs
+// to jobs[i] regardless of the order in which requests complete, and with a
+// single worker the jobs run in order.
+func fetchListings(src GuideSource, jobs []listingJob, parallelism int) []listingResult {
+	results := make([]listingResult, len(jobs))
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(parallelism, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				j := jobs[i]
+				programs, err := src.FetchListings(j.channels, j.start, j.end)
+				results[i] = listingResult{programs: programs, err: err}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// slowBatchedSource answers in small channel batches, finishing later
+// requests first, and records how many requests overlapped.
+type slowBatchedSource struct {
+	channels []types.LineupData
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	calls    int
+}
+
+func (s *slowBatchedSource) Name() string          { return "slow" }
+func (s *slowBatchedSource) ListingBatchSize() int { return 2 }
+
+func (s *slowBatchedSource) FetchChannels() ([]types.LineupData, error) {
+	return s.channels, nil
+}
+
+func (s *slowBatchedSource) FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error) {
+	s.mu.Lock()
+	s.calls++
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	delay := time.Duration(20-s.calls) * time.Millisecond
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+
+	var programs []types.Program
+	for _, ch := range channels {
+		programs = append(programs, types.Program{
+			Channel: ch.ChannelNumber,
+			Title:   "Show on " + ch.ChannelNumber,
+			Start:   start.Format(time.RFC3339),
+			End:     start.Add(time.Hour).Format(time.RFC3339),
+		})
+	}
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return programs, nil
+}
+
+func TestListingJobs(t *testing.T) {
+	lineup := []types.LineupData{{ChannelNumber: "1"}, {ChannelNumber: "2"}, {ChannelNumber: "3"}}
+	windows := dayWindows(time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC), 3)
+
+	jobs := listingJobs(&slowBatchedSource{}, lineup, windows, []int{0, 2})
+	if len(jobs) != 4 {
+		t.Fatalf("expected 2 batches for each of 2 days, got %d jobs", len(jobs))
+	}
+	if jobs[1].day != 0 || len(jobs[1].channels) != 1 || jobs[2].day != 2 || !jobs[2].start.Equal(windows[2][0]) {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+
+	if jobs := listingJobs(&fakeSource{}, lineup, windows, []int{1}); len(jobs) != 1 || len(jobs[0].channels) != 3 {
+		t.Errorf("unbatched source should get the whole lineup in one job, got %+v", jobs)
+	}
+}
+
+func TestBuildGuide_Parallel(t *testing.T) {
+	var lineup []types.LineupData
+	var local []types.Channel
+	for i := 1; i <= 5; i++ {
+		num := fmt.Sprintf("%d.1", i)
+		lineup = append(lineup, types.LineupData{StationID: fmt.Sprint(i), ChannelNumber: num})
+		local = append(local, types.Channel{GuideNumber: num})
+	}
+	src := &slowBatchedSource{channels: lineup}
+	now := time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC)
+
+	state := &guideState{ProcessedDays: map[string]string{}}
+	guide, err := buildGuide(src, newChannelMatcher(local), nil, now, 3, 4, state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if src.calls != 9 {
+		t.Errorf("expected 3 batches for each of 3 days, got %d requests", src.calls)
+	}
+	if src.peak < 2 || src.peak > 4 {
+		t.Errorf("expected 2-4 requests in flight, peak was %d", src.peak)
+	}
+	if len(guide.Programs) != 15 {
+		t.Fatalf("expected one program per channel per day, got %d", len(guide.Programs))
+	}
+	for _, p := range guide.Programs {
+		if p.Title != "Show on "+p.Channel {
+			t.Errorf("program %q filed under channel %s", p.Title, p.Channel)
+		}
+	}
+	if len(state.ProcessedDays) != 3 {
+		t.Errorf("expected all days processed, got %v", state.ProcessedDays)
+	}
+}
@@ -1,254 +1,229 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
 	"sort"
+	"syscall"
 	"time"
 
+	"github.com/prziborowski/hdhr-dvr/pkg/client"
 	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
 	"github.com/prziborowski/hdhr-dvr/pkg/types"
 )
 
-const titanTVBaseURL = "https://titantv.com/api"
-
-func fetchTitanTVChannels(userId, lineupId string) ([]types.TitanTVChannel, error) {
-	url := fmt.Sprintf("%s/channel/%s/%s", titanTVBaseURL, userId, lineupId)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/149.0.0.0 Safari/537.36")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close() //nolint:errcheck
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned non-OK status: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var response types.TitanTVLineupResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, err
-	}
-
-	return response.Channels, nil
+// GuideSource is an EPG provider. Implementations only translate the
+// provider's API into LineupData and Program values; day batching,
+// de-duplication and pruning to the tuner's channels are handled by buildGuide.
+type GuideSource interface {
+	Name() string
+	// FetchChannels returns the provider's full lineup. ChannelNumber must be
+	// in the HDHomeRun GuideNumber form ("5.1").
+	FetchChannels() ([]types.LineupData, error)
+	// FetchListings returns programs on the given channels starting within
+	// [start, end). It may return partial results along with an error.
+	FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error)
 }
 
-func fetchTitanTVScheduleBlock(userId, lineupId string, startTime time.Time) (*types.TitanTVScheduleResponse, error) {
-	dateStr := startTime.Format("200601021504")
-	url := fmt.Sprintf("%s/schedule/%s/%s/%s/360", titanTVBaseURL, userId, lineupId, dateStr)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+func newGuideSource(config *pkgcfg.Config, loc *time.Location) (GuideSource, error) {
+	client := newPoliteClient(60*time.Second, config.GuideRetries, time.Duration(config.GuideRequestDelay)*time.Second)
+	categories := newCategoryMapper(config.CategoryRules)
+	switch config.GuideSource {
+	case "schedulesdirect":
+		return newSchedulesDirectSource(schedulesDirectBaseURL, config, loc, client, categories)
+	case "titantv":
+		lineups := config.LineUpIDs
+		if len(lineups) == 0 {
+			lineups = []string{config.LineUpID}
+		}
+		var sources []GuideSource
+		for _, id := range lineups {
+			sources = append(sources, newTitanTVSource(titanTVBaseURL, config.UserID, id, loc, client, categories))
+		}
+		return newMultiSource(sources), nil
+	default:
+		return nil, fmt.Errorf("unknown guideSource %q", config.GuideSource)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/149.0.0.0 Safari/537.36")
+}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+// fetchLocalChannels lists the tuner's channels from the DVR server
+// sharing this config, authenticating with $DVR_API_KEY when set.
+func fetchLocalChannels(config *pkgcfg.Config) ([]types.Channel, error) {
+	c := client.New(fmt.Sprintf("http://localhost:%d%s", config.Port, config.BasePath), os.Getenv("DVR_API_KEY"))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	listed, err := c.ListChannels(ctx, false)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close() //nolint:errcheck
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned non-OK status: %d", resp.StatusCode)
-	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	channels := make([]types.Channel, 0, len(listed))
+	for _, ch := range listed {
+		channels = append(channels, types.Channel{GuideNumber: ch.GuideNumber, GuideName: ch.GuideName})
 	}
+	return channels, nil
+}
 
-	var response types.TitanTVScheduleResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, err
+// dayWindows splits the guide period into per-day fetch windows. The first
+// window starts at the current hour rather than midnight.
+func dayWindows(now time.Time, days int) [][2]time.Time {
+	var windows [][2]time.Time
+	start := now.Truncate(time.Hour)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := 0; i < days; i++ {
+		end := midnight.AddDate(0, 0, i+1)
+		windows = append(windows, [2]time.Time{start, end})
+		start = end
 	}
-
-	return &response, nil
+	return windows
 }
 
-func fetchLocalChannels() ([]types.Channel, error) {
-	resp, err := http.Get("http://localhost:8080/api/channels")
+// buildGuide fetches the lineup and then the listings from src one day (and
+// for batched sources, one channel batch) per request, running up to
+// parallelism requests at once. It keeps only channels the tuner has according to local and dropping
+// duplicate airings of the same channel and start time. Days already marked
+// in state are taken from previous instead of being fetched; a day is only
+// marked once all of its requests succeed.
+//
+// overrides maps a provider station ID or call sign to the tuner GuideNumber
+// it should be filed under, for stations whose provider channel number does
+// not match what the tuner receives.
+func buildGuide(src GuideSource, local *channelMatcher, overrides map[string]string, now time.Time, days, parallelism int, state *guideState, previous []types.Program) (types.Guide, error) {
+	channels, err := src.FetchChannels()
 	if err != nil {
-		return nil, err
+		return types.Guide{}, fmt.Errorf("fetching %s channels: %w", src.Name(), err)
 	}
-	defer resp.Body.Close() // nolint: errcheck
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned non-OK status: %d", resp.StatusCode)
-	}
-
-	var channels []types.Channel
-	if err := json.NewDecoder(resp.Body).Decode(&channels); err != nil {
-		return nil, err
+	log.Printf("Found %d %s channels", len(channels), src.Name())
+
+	guideNumber := func(ch types.LineupData) (string, matchKind) {
+		for _, key := range []string{ch.StationID, ch.StationCallSign} {
+			if n, ok := overrides[key]; ok {
+				if !local.has(n) {
+					log.Printf("Warning: override for station %s (%s) targets %s, which the tuner does not have", ch.StationID, ch.StationCallSign, n)
+					return "", matchNone
+				}
+				return n, matchOverride
+			}
+		}
+		return local.match(ch)
 	}
 
-	return channels, nil
-}
-
-func main() {
-	// Load configuration
-	config, err := pkgcfg.LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	// Stations claim GuideNumbers by how they matched, overrides first and
+	// fuzzy matches last, so a weaker match never displaces a stronger one.
+	// Listings are still fetched by provider channel number and translated
+	// with toLocal.
+	chosen := make([]bool, len(channels))
+	seenChannels := make(map[string]bool)
+	toLocal := make(map[string]string)
+	for _, kind := range []matchKind{matchOverride, matchExact, matchFuzzy} {
+		for i, ch := range channels {
+			num, k := guideNumber(ch)
+			if k != kind || seenChannels[num] {
+				continue
+			}
+			if _, dup := toLocal[ch.ChannelNumber]; dup {
+				log.Printf("Warning: skipping station %s (%s): provider channel %s is already mapped", ch.StationID, ch.StationCallSign, ch.ChannelNumber)
+				continue
+			}
+			if kind == matchFuzzy {
+				log.Printf("Matched %s channel %s (%s) to tuner channel %s", src.Name(), ch.ChannelNumber, ch.StationCallSign, num)
+			}
+			seenChannels[num] = true
+			toLocal[ch.ChannelNumber] = num
+			chosen[i] = true
+		}
 	}
 
-	loc, err := time.LoadLocation(config.Timezone)
-	if err != nil {
-		log.Fatalf("Invalid timezone %s: %v", config.Timezone, err)
+	var lineup, guideChannels []types.LineupData
+	for i, ch := range channels {
+		if !chosen[i] {
+			continue
+		}
+		lineup = append(lineup, ch)
+		local := ch
+		local.ChannelNumber = toLocal[ch.ChannelNumber]
+		guideChannels = append(guideChannels, local)
 	}
 
-	log.Printf("Fetching guide data from TitanTV for UserID: %s and LineupID: %s", config.UserID, config.LineUpID)
-
-	// 1. Fetch Local Channels for filtering
-	localChannels, err := fetchLocalChannels()
-	if err != nil {
-		log.Printf("Error fetching local channels from API: %v. Exiting because local channel list is required for filtering.", err)
-		log.Fatalf("Cannot generate guide without local channel list")
-	}
-	localChannelMap := make(map[string]bool)
-	for _, ch := range localChannels {
-		localChannelMap[ch.GuideNumber] = true
+	windows := dayWindows(now, days)
+	reuse := make([]bool, len(windows))
+	var fetchDays []int
+	for i, w := range windows {
+		day := w[0].Format("2006-01-02")
+		if state.processed(day) {
+			log.Printf("Day %d/%d (%s) already processed, reusing previous listings", i+1, days, day)
+			reuse[i] = true
+		} else {
+			fetchDays = append(fetchDays, i)
+		}
 	}
 
-	// 2. Fetch TitanTV Channels
-	titanChannels, err := fetchTitanTVChannels(config.UserID, config.LineUpID)
-	if err != nil {
-		log.Fatalf("Error fetching TitanTV channels: %v", err)
+	jobs := listingJobs(src, lineup, windows, fetchDays)
+	if len(jobs) > 0 {
+		log.Printf("Fetching %s listings for %d days in %d requests, %d at a time", src.Name(), len(fetchDays), len(jobs), parallelism)
 	}
-	log.Printf("Found %d titanTV channels", len(titanChannels))
-
-	// Map channelIndex -> TitanTVChannel for easy lookup and prepare output LineupData
-	channelMap := make(map[int]types.TitanTVChannel)
-	var filteredLineup []types.LineupData
-
-	for _, ch := range titanChannels {
-		channelMap[ch.ChannelIndex] = ch
-
-		channelNum := fmt.Sprintf("%d", ch.MajorChannel)
-		if ch.MinorChannel != 0 {
-			channelNum += fmt.Sprintf(".%d", ch.MinorChannel)
+	fetched := make([][]types.Program, len(windows))
+	failed := make(map[int]error)
+	for i, res := range fetchListings(src, jobs, parallelism) {
+		day := jobs[i].day
+		if res.err != nil && failed[day] == nil {
+			failed[day] = res.err
 		}
-
-		// Only include in lineup if it's a local channel
-		if len(localChannelMap) > 0 && !localChannelMap[channelNum] {
-			continue
+		for k := range res.programs {
+			res.programs[k].Channel = toLocal[res.programs[k].Channel]
+		}
+		fetched[day] = append(fetched[day], res.programs...)
+	}
+	for _, i := range fetchDays {
+		day := windows[i][0].Format("2006-01-02")
+		if err := failed[i]; err != nil {
+			log.Printf("Error fetching listings for %s, will retry on next run: %v", day, err)
+		} else {
+			state.markProcessed(day, time.Now())
 		}
-
-		filteredLineup = append(filteredLineup, types.LineupData{
-			StationID:       fmt.Sprintf("%d", ch.ChannelID),
-			ChannelNumber:   channelNum,
-			StationCallSign: ch.CallSign,
-			Logo:            ch.Logo,
-		})
 	}
 
-	// 3. Fetch Schedule in blocks (matching titantv_grabber.py logic)
 	var allPrograms []types.Program
 	seenPrograms := make(map[string]bool)
-	startTime := time.Now().In(loc).Truncate(time.Hour)
-
-	log.Printf("Fetching schedule starting from %s", startTime.Format(time.RFC3339))
-
-	for i := 0; i < 28; i++ { // 7 days * 4 blocks of 6 hours per day = 28 blocks
-		blockStartTime := startTime.Add(time.Duration(i*6) * time.Hour)
-		log.Printf("Fetching block %d/28 (starting %s)...", i+1, blockStartTime.Format("2006-01-02 15:04"))
-
-		schedResp, err := fetchTitanTVScheduleBlock(config.UserID, config.LineUpID, blockStartTime)
-		if err != nil {
-			log.Printf("Error fetching schedule block %d: %v", i+1, err)
-			continue
+	for i, w := range windows {
+		programs := fetched[i]
+		if reuse[i] {
+			programs = programsInWindow(previous, w[0], w[1])
 		}
 
-		for _, chSched := range schedResp.Channels {
-			chInfo, ok := channelMap[chSched.ChannelIndex]
-			if !ok {
-				log.Printf("Warning: No channel info found for index %d", chSched.ChannelIndex)
+		for _, prog := range programs {
+			if !seenChannels[prog.Channel] {
 				continue
 			}
 
-			channelNum := fmt.Sprintf("%d", chInfo.MajorChannel)
-			if chInfo.MinorChannel != 0 {
-				channelNum += fmt.Sprintf(".%d", chInfo.MinorChannel)
-			}
-
-			// Filter out programs that are not in the local channel list
-			if len(localChannelMap) > 0 && !localChannelMap[channelNum] {
+			// De-duplication key: channel + start time
+			progKey := fmt.Sprintf("%s|%s", prog.Channel, prog.Start)
+			if seenPrograms[progKey] {
 				continue
 			}
-
-			for _, day := range chSched.Days {
-				for _, evt := range day.Events {
-					// Parse TitanTV ISO 8601 time: "2026-01-29T10:00:00"
-					start, err := time.ParseInLocation("2006-01-02T15:04:05", evt.StartTime, loc)
-					if err != nil {
-						start, err = time.ParseInLocation("2006-01-02T15:04", evt.StartTime, loc)
-						if err != nil {
-							log.Printf("Error parsing start time %s: %v", evt.StartTime, err)
-							continue
-						}
-					}
-
-					end, err := time.ParseInLocation("2006-01-02T15:04:05", evt.EndTime, loc)
-					if err != nil {
-						end, err = time.ParseInLocation("2006-01-02T15:04", evt.EndTime, loc)
-						if err != nil {
-							log.Printf("Error parsing end time %s: %v", evt.EndTime, err)
-							continue
-						}
-					}
-
-					// De-duplication key: channel + start time
-					progKey := fmt.Sprintf("%s|%s", channelNum, evt.StartTime)
-					if seenPrograms[progKey] {
-						continue
-					}
-					seenPrograms[progKey] = true
-
-					// Map to types.Program
-					prog := types.Program{
-						Channel:  channelNum,
-						Title:    evt.Title,
-						SubTitle: evt.SubTitle,
-						Start:    start.In(loc).Format("2006-01-02T15:04:05-07:00"),
-						End:      end.In(loc).Format("2006-01-02T15:04:05-07:00"),
-						Duration: int(end.Sub(start).Minutes()),
-					}
-
-					switch evt.ProgramType {
-					case "Movie":
-						prog.Category = "movie"
-					case "Sports":
-						prog.Category = "sports"
-					case "News":
-						prog.Category = "news"
-					}
-
-					if evt.IsNew {
-						prog.New = true
-					}
-
-					allPrograms = append(allPrograms, prog)
-				}
-			}
+			seenPrograms[progKey] = true
+			allPrograms = append(allPrograms, prog)
 		}
+	}
 
-		time.Sleep(5 * time.Second)
+	// Program IDs are derived from the provider station rather than the
+	// channel number, so remapping a channel does not change them.
+	stations := make(map[string]string, len(guideChannels))
+	for _, ch := range guideChannels {
+		stations[ch.ChannelNumber] = ch.StationID
+	}
+	for i, prog := range allPrograms {
+		start, err := time.Parse(time.RFC3339, prog.Start)
+		if err != nil {
+			log.Printf("Error parsing start time %s for %q, leaving it without an ID: %v", prog.Start, prog.Title, err)
+			continue
+		}
+		allPrograms[i].ID = types.ProgramID(stations[prog.Channel], start, prog.Title)
 	}
 
 	sort.SliceStable(allPrograms, func(i, j int) bool {
@@ -258,19 +233,98 @@ func main() {
 		return allPrograms[i].Start < allPrograms[j].Start
 	})
 
-	output := types.Guide{
-		Channels:  filteredLineup,
+	return types.Guide{
+		Channels:  guideChannels,
 		Programs:  allPrograms,
 		Generated: time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// generateGuide runs one guide update and writes the guide and state files.
+// Today, and the first refetchDays days, are fetched again even if already
+// processed.
+func generateGuide(config *pkgcfg.Config, loc *time.Location, refetchDays int) error {
+	// 1. Fetch Local Channels for filtering
+	localChannels, err := fetchLocalChannels(config)
+	if err != nil {
+		return fmt.Errorf("fetching local channels from API (required for filtering): %w", err)
+	}
+	local := newChannelMatcher(localChannels)
+
+	// 2. Load state from previous runs
+	state, err := loadGuideState(config.StateFile)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", config.StateFile, err)
+	}
+	previous, err := loadPreviousPrograms(config.GuideFile, state)
+	if err != nil {
+		log.Printf("Error loading previous guide %s, refetching all days: %v", config.GuideFile, err)
+		state.ProcessedDays = make(map[string]string)
+	}
+	now := time.Now().In(loc)
+	if n := state.prune(now.Format("2006-01-02")); n > 0 {
+		log.Printf("Pruned %d past days from %s", n, config.StateFile)
+	}
+	// The rest of today is always fetched again, since broadcasters revise
+	// same-day schedules after the morning run.
+	for _, w := range dayWindows(now, max(refetchDays, 1)) {
+		delete(state.ProcessedDays, w[0].Format("2006-01-02"))
+	}
+
+	// 3. Fetch lineup and programs from the configured guide source
+	src, err := newGuideSource(config, loc)
+	if err != nil {
+		return fmt.Errorf("configuring guide source: %w", err)
+	}
+
+	output, err := buildGuide(src, local, config.ChannelOverrides, now, config.Days, config.GuideParallelism, state, previous)
+	if err != nil {
+		return fmt.Errorf("fetching guide: %w", err)
 	}
 
 	outputData, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
-		log.Fatalf("Error encoding JSON: %v", err)
+		return fmt.Errorf("encoding JSON: %w", err)
 	}
 	if err := os.WriteFile(config.GuideFile, outputData, 0644); err != nil {
-		log.Fatalf("Error writing output file: %v", err)
+		return fmt.Errorf("writing output file: %w", err)
+	}
+
+	if err := state.save(config.StateFile); err != nil {
+		log.Printf("Error writing %s: %v", config.StateFile, err)
 	}
 
-	log.Printf("Successfully generated %s with %d programs", config.GuideFile, len(allPrograms))
+	log.Printf("Successfully generated %s with %d programs", config.GuideFile, len(output.Programs))
+	return nil
+}
+
+func main() {
+	daemon := flag.Bool("daemon", false, "keep running and refresh the guide on the guideSchedule from config.json")
+	flag.Parse()
+
+	// Load configuration
+	config, err := pkgcfg.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		log.Fatalf("Invalid timezone %s: %v", config.Timezone, err)
+	}
+
+	if *daemon {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		if err := runDaemon(ctx, config, loc, reload); err != nil {
+			log.Fatalf("Guide daemon: %v", err)
+		}
+		return
+	}
+
+	if err := generateGuide(config, loc, 0); err != nil {
+		log.Fatalf("Error generating guide: %v", err)
+	}
 }
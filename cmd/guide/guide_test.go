@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// fakeSource returns one program per channel at the start of each window,
+// plus a duplicate of the first airing.
+type fakeSource struct {
+	channels []types.LineupData
+	windows  [][2]time.Time
+	failDay  int
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) FetchChannels() ([]types.LineupData, error) {
+	return f.channels, nil
+}
+
+func (f *fakeSource) FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error) {
+	f.windows = append(f.windows, [2]time.Time{start, end})
+	if len(f.windows) == f.failDay {
+		return nil, fmt.Errorf("boom")
+	}
+	var programs []types.Program
+	for _, ch := range channels {
+		prog := types.Program{
+			Channel: ch.ChannelNumber,
+			Title:   "Show",
+			Start:   start.Format(time.RFC3339),
+			End:     start.Add(30 * time.Minute).Format(time.RFC3339),
+		}
+		programs = append(programs, prog, prog)
+	}
+	// A program on a channel the tuner does not receive.
+	programs = append(programs, types.Program{Channel: "99.9", Start: start.Format(time.RFC3339)})
+	return programs, nil
+}
+
+func TestBuildGuide(t *testing.T) {
+	src := &fakeSource{
+		channels: []types.LineupData{
+			{StationID: "1", ChannelNumber: "5.1"},
+			{StationID: "2", ChannelNumber: "7.1"},
+			{StationID: "3", ChannelNumber: "5.1"},
+		},
+		failDay: 2,
+	}
+	now := time.Date(2026, 1, 10, 14, 25, 0, 0, time.UTC)
+
+	state := &guideState{ProcessedDays: map[string]string{}}
+	guide, err := buildGuide(src, newChannelMatcher([]types.Channel{{GuideNumber: "5.1"}}), nil, now, 3, 1, state, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(guide.Channels) != 1 || guide.Channels[0].StationID != "1" {
+		t.Fatalf("expected only the first 5.1 station, got %+v", guide.Channels)
+	}
+	if len(src.windows) != 3 {
+		t.Fatalf("expected 3 day windows, got %d", len(src.windows))
+	}
+	// Day 2 failed; days 1 and 3 each contribute one de-duplicated program.
+	if len(guide.Programs) != 2 {
+		t.Fatalf("expected 2 programs, got %d: %+v", len(guide.Programs), guide.Programs)
+	}
+	if guide.Programs[0].Start > guide.Programs[1].Start {
+		t.Error("expected programs sorted by start time")
+	}
+	start, _ := time.Parse(time.RFC3339, guide.Programs[0].Start)
+	if want := types.ProgramID("1", start, "Show"); guide.Programs[0].ID != want {
+		t.Errorf("got program ID %q, want %q", guide.Programs[0].ID, want)
+	}
+	if !state.processed("2026-01-10") || state.processed("2026-01-11") || !state.processed("2026-01-12") {
+		t.Errorf("expected only successful days to be marked processed, got %v", state.ProcessedDays)
+	}
+}
+
+func TestBuildGuide_ReusesProcessedDays(t *testing.T) {
+	src := &fakeSource{channels: []types.LineupData{{StationID: "1", ChannelNumber: "5.1"}}}
+	now := time.Date(2026, 1, 10, 14, 25, 0, 0, time.UTC)
+	state := &guideState{ProcessedDays: map[string]string{"2026-01-10": "2026-01-10T04:00:00Z"}}
+	previous := []types.Program{
+		{Channel: "5.1", Title: "Kept", Start: "2026-01-10T20:00:00Z"},
+		{Channel: "5.1", Title: "Already aired", Start: "2026-01-10T08:00:00Z"},
+	}
+
+	guide, err := buildGuide(src, nil, nil, now, 2, 1, state, previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(src.windows) != 1 {
+		t.Fatalf("expected only the unprocessed day to be fetched, got %d fetches", len(src.windows))
+	}
+	if len(guide.Programs) != 2 || guide.Programs[0].Title != "Kept" {
+		t.Errorf("unexpected programs: %+v", guide.Programs)
+	}
+}
+
+func TestBuildGuide_ChannelOverrides(t *testing.T) {
+	src := &fakeSource{
+		channels: []types.LineupData{
+			{StationID: "1", ChannelNumber: "7.1", StationCallSign: "KOMO"},
+			{StationID: "2", ChannelNumber: "5.1", StationCallSign: "KING"},
+			{StationID: "3", ChannelNumber: "9.1", StationCallSign: "KCTS"},
+		},
+	}
+	now := time.Date(2026, 1, 10, 14, 25, 0, 0, time.UTC)
+	state := &guideState{ProcessedDays: map[string]string{}}
+	overrides := map[string]string{"KING": "7.1", "3": "11.1"}
+
+	guide, err := buildGuide(src, newChannelMatcher([]types.Channel{{GuideNumber: "7.1"}, {GuideNumber: "9.1"}}), overrides, now, 1, 1, state, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// KING is filed under 7.1 and displaces the provider's own 7.1; KCTS is
+	// overridden to a channel the tuner does not have.
+	if len(guide.Channels) != 1 || guide.Channels[0].StationID != "2" || guide.Channels[0].ChannelNumber != "7.1" {
+		t.Fatalf("unexpected channels: %+v", guide.Channels)
+	}
+	if len(guide.Programs) != 1 || guide.Programs[0].Channel != "7.1" {
+		t.Errorf("unexpected programs: %+v", guide.Programs)
+	}
+}
+
+func TestBuildGuide_FuzzyChannelMatch(t *testing.T) {
+	src := &fakeSource{
+		channels: []types.LineupData{
+			{StationID: "1", ChannelNumber: "5.1", StationCallSign: "KING"},
+			{StationID: "2", ChannelNumber: "5.10", StationCallSign: "KONG"},
+		},
+	}
+	now := time.Date(2026, 1, 10, 14, 25, 0, 0, time.UTC)
+	state := &guideState{ProcessedDays: map[string]string{}}
+	local := newChannelMatcher([]types.Channel{{GuideNumber: "5.10", GuideName: "KING-HD"}})
+
+	guide, err := buildGuide(src, local, nil, now, 1, 1, state, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The exact 5.10 match wins over KING's normalized number.
+	if len(guide.Channels) != 1 || guide.Channels[0].StationID != "2" {
+		t.Fatalf("unexpected channels: %+v", guide.Channels)
+	}
+	if len(guide.Programs) != 1 || guide.Programs[0].Channel != "5.10" {
+		t.Errorf("unexpected programs: %+v", guide.Programs)
+	}
+}
+
+func TestGuideStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := loadGuideState(path)
+	if err != nil {
+		t.Fatalf("missing state file should not be an error: %v", err)
+	}
+	state.markProcessed("2026-01-10", time.Date(2026, 1, 10, 4, 0, 0, 0, time.UTC))
+	if err := state.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadGuideState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.processed("2026-01-10") || loaded.processed("2026-01-11") {
+		t.Errorf("unexpected state after reload: %v", loaded.ProcessedDays)
+	}
+}
+
+func TestGuideStatePrune(t *testing.T) {
+	state := &guideState{ProcessedDays: map[string]string{
+		"2025-12-31": "2025-12-31T04:00:00Z",
+		"2026-01-09": "2026-01-09T04:00:00Z",
+		"2026-01-10": "2026-01-10T04:00:00Z",
+		"2026-01-11": "2026-01-10T04:00:00Z",
+	}}
+	if n := state.prune("2026-01-10"); n != 2 {
+		t.Errorf("pruned %d days, want 2", n)
+	}
+	if len(state.ProcessedDays) != 2 || !state.processed("2026-01-10") || !state.processed("2026-01-11") {
+		t.Errorf("unexpected state after pruning: %v", state.ProcessedDays)
+	}
+}
+
+func TestLoadPreviousPrograms_MissingGuide(t *testing.T) {
+	state := &guideState{ProcessedDays: map[string]string{"2026-01-10": "2026-01-10T04:00:00Z"}}
+	programs, err := loadPreviousPrograms(filepath.Join(t.TempDir(), "guide.json"), state)
+	if err != nil || programs != nil {
+		t.Fatalf("loadPreviousPrograms = %v, %v", programs, err)
+	}
+	if state.processed("2026-01-10") {
+		t.Errorf("days stay processed without a guide to reuse them from: %v", state.ProcessedDays)
+	}
+}
+
+func TestDayWindows(t *testing.T) {
+	now := time.Date(2026, 1, 10, 14, 25, 0, 0, time.UTC)
+	windows := dayWindows(now, 2)
+	if len(windows) != 2 {
+		t.Fatalf("expected 2 windows, got %d", len(windows))
+	}
+	if !windows[0][0].Equal(time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("first window should start at the current hour, got %v", windows[0][0])
+	}
+	if !windows[0][1].Equal(windows[1][0]) {
+		t.Error("windows should be contiguous")
+	}
+	if !windows[1][1].Equal(time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("last window should end at midnight, got %v", windows[1][1])
+	}
+}
+
+func TestFetchLocalChannels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dvr/api/v1/channels" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"guideNumber": "5.1", "guideName": "KPIX", "hd": true, "signalStrength": 90}]`)) //nolint: errcheck
+	}))
+	defer srv.Close()
+	port, _ := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+
+	channels, err := fetchLocalChannels(&pkgcfg.Config{Port: port, BasePath: "/dvr"})
+	if err != nil || len(channels) != 1 || channels[0].GuideNumber != "5.1" || channels[0].GuideName != "KPIX" {
+		t.Errorf("fetchLocalChannels = %+v, %v", channels, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// politeClient wraps http.Client with a minimum interval between requests and
+// exponential backoff on transient failures (network errors, 429 and 5xx).
+type politeClient struct {
+	client      *http.Client
+	maxRetries  int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	minInterval time.Duration
+	// sleep is overridden in tests.
+	sleep func(time.Duration)
+
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+func newPoliteClient(timeout time.Duration, maxRetries int, minInterval time.Duration) *politeClient {
+	return &politeClient{
+		client:      &http.Client{Timeout: timeout},
+		maxRetries:  maxRetries,
+		baseDelay:   2 * time.Second,
+		maxDelay:    2 * time.Minute,
+		minInterval: minInterval,
+		sleep:       time.Sleep,
+	}
+}
+
+// wait blocks until minInterval has passed since the previous request.
+func (c *politeClient) wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastRequest.IsZero() {
+		if d := c.minInterval - time.Since(c.lastRequest); d > 0 {
+			c.sleep(d)
+		}
+	}
+	c.lastRequest = time.Now()
+}
+
+func (c *politeClient) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	d := c.baseDelay << attempt
+	if d > c.maxDelay || d <= 0 {
+		d = c.maxDelay
+	}
+	return d
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// Do sends the request built by newReq, retrying transient failures. newReq is
+// called for every attempt so request bodies can be rebuilt. The returned
+// response always has a 200 status; any other final status is an error.
+func (c *politeClient) Do(newReq func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		c.wait()
+		resp, err := c.client.Do(req)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		if err != nil {
+			lastErr = err
+		} else {
+			io.Copy(io.Discard, resp.Body) //nolint: errcheck
+			resp.Body.Close()              //nolint: errcheck
+			lastErr = fmt.Errorf("server returned non-OK status: %d", resp.StatusCode)
+			if !retryableStatus(resp.StatusCode) {
+				return nil, lastErr
+			}
+		}
+
+		if attempt < c.maxRetries {
+			wait := c.backoff(attempt, resp)
+			log.Printf("Request to %s failed (attempt %d/%d): %v; retrying in %v", req.URL, attempt+1, c.maxRetries+1, lastErr, wait)
+			c.sleep(wait)
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a politeClient that never sleeps.
+func newTestClient() *politeClient {
+	c := newPoliteClient(5*time.Second, 3, 0)
+	c.sleep = func(time.Duration) {}
+	return c
+}
+
+func TestPoliteClient_RetriesServerErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok")) //nolint: errcheck
+	}))
+	defer srv.Close()
+
+	c := newTestClient()
+	var waits []time.Duration
+	c.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	resp, err := c.Do(func() (*http.Request, error) { return http.NewRequest("GET", srv.URL, nil) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close() //nolint: errcheck
+
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if len(waits) != 2 || waits[0] != 2*time.Second || waits[1] != 4*time.Second {
+		t.Errorf("expected exponential backoff of 2s then 4s, got %v", waits)
+	}
+}
+
+func TestPoliteClient_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient().Do(func() (*http.Request, error) { return http.NewRequest("GET", srv.URL, nil) })
+	if err == nil {
+		t.Fatal("expected error for 404")
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestPoliteClient_GivesUpAfterMaxRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := newTestClient()
+	var waits []time.Duration
+	c.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	if _, err := c.Do(func() (*http.Request, error) { return http.NewRequest("GET", srv.URL, nil) }); err == nil {
+		t.Fatal("expected error after retries are exhausted")
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 attempts, got %d", calls)
+	}
+	if len(waits) == 0 || waits[0] != 7*time.Second {
+		t.Errorf("expected Retry-After to be honoured, got %v", waits)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// multiSource merges several lineups of a provider whose source instances
+// only know one lineup each (TitanTV). Channels are routed back to the
+// source that listed them by their Source tag; a station listed by more than
+// one lineup under the same call sign and channel number is kept once.
+type multiSource struct {
+	sources []GuideSource
+	owner   map[string]GuideSource // Source tag -> source
+}
+
+func newMultiSource(sources []GuideSource) GuideSource {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	return &multiSource{sources: sources}
+}
+
+func (m *multiSource) Name() string {
+	return m.sources[0].Name()
+}
+
+func (m *multiSource) FetchChannels() ([]types.LineupData, error) {
+	m.owner = make(map[string]GuideSource)
+	var merged []types.LineupData
+	seen := make(map[string]string)
+	for _, src := range m.sources {
+		channels, err := src.FetchChannels()
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range channels {
+			m.owner[ch.Source] = src
+			key := strings.ToUpper(ch.StationCallSign) + "|" + ch.ChannelNumber
+			if first, dup := seen[key]; dup {
+				log.Printf("Station %s on %s is in both %s and %s, keeping %s", ch.StationCallSign, ch.ChannelNumber, first, ch.Source, first)
+				continue
+			}
+			seen[key] = ch.Source
+			merged = append(merged, ch)
+		}
+	}
+	return merged, nil
+}
+
+// FetchListings asks each lineup's source for its own channels. Results from
+// the lineups that succeed are returned along with the first error.
+func (m *multiSource) FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error) {
+	bySource := make(map[GuideSource][]types.LineupData)
+	for _, ch := range channels {
+		src, ok := m.owner[ch.Source]
+		if !ok {
+			return nil, fmt.Errorf("channel %s has unknown source %q", ch.ChannelNumber, ch.Source)
+		}
+		bySource[src] = append(bySource[src], ch)
+	}
+
+	var programs []types.Program
+	var firstErr error
+	for _, src := range m.sources {
+		chans, ok := bySource[src]
+		if !ok {
+			continue
+		}
+		progs, err := src.FetchListings(chans, start, end)
+		programs = append(programs, progs...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return programs, firstErr
+}
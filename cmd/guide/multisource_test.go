@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// lineupSource is a single-lineup source that tags its channels and records
+// which channels it was asked for.
+type lineupSource struct {
+	tag      string
+	channels []types.LineupData
+	asked    []string
+}
+
+func (s *lineupSource) Name() string { return "fake" }
+
+func (s *lineupSource) FetchChannels() ([]types.LineupData, error) {
+	var out []types.LineupData
+	for _, ch := range s.channels {
+		ch.Source = s.tag
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+func (s *lineupSource) FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error) {
+	var programs []types.Program
+	for _, ch := range channels {
+		s.asked = append(s.asked, ch.ChannelNumber)
+		programs = append(programs, types.Program{Channel: ch.ChannelNumber, Title: s.tag, Start: start.Format(time.RFC3339)})
+	}
+	return programs, nil
+}
+
+func TestMultiSource(t *testing.T) {
+	antenna := &lineupSource{tag: "fake/antenna", channels: []types.LineupData{
+		{StationID: "1", ChannelNumber: "5.1", StationCallSign: "KING"},
+		{StationID: "2", ChannelNumber: "9.1", StationCallSign: "KCTS"},
+	}}
+	cable := &lineupSource{tag: "fake/cable", channels: []types.LineupData{
+		{StationID: "11", ChannelNumber: "5.1", StationCallSign: "king"},
+		{StationID: "12", ChannelNumber: "705", StationCallSign: "KONG"},
+	}}
+	src := newMultiSource([]GuideSource{antenna, cable})
+
+	now := time.Date(2026, 1, 10, 14, 25, 0, 0, time.UTC)
+	state := &guideState{ProcessedDays: map[string]string{}}
+	guide, err := buildGuide(src, nil, nil, now, 1, 1, state, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sources := make(map[string]string)
+	for _, ch := range guide.Channels {
+		sources[ch.ChannelNumber] = ch.Source
+	}
+	if len(guide.Channels) != 3 || sources["5.1"] != "fake/antenna" || sources["705"] != "fake/cable" {
+		t.Fatalf("unexpected channels: %+v", guide.Channels)
+	}
+	if len(antenna.asked) != 2 || len(cable.asked) != 1 || cable.asked[0] != "705" {
+		t.Errorf("listings routed wrongly: antenna %v, cable %v", antenna.asked, cable.asked)
+	}
+	if len(guide.Programs) != 3 {
+		t.Errorf("unexpected programs: %+v", guide.Programs)
+	}
+
+	if single := newMultiSource([]GuideSource{antenna}); single != GuideSource(antenna) {
+		t.Error("expected a single lineup to be used directly")
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const schedulesDirectBaseURL = "https://json.schedulesdirect.org/20141201"
+
+// sdProgramBatch is the maximum number of program IDs accepted by a single
+// /programs request.
+const sdProgramBatch = 5000
+
+// sdStationBatch is how many stations' schedules buildGuide asks for in one
+// FetchListings call.
+const sdStationBatch = 20
+
+type schedulesDirectClient struct {
+	baseURL string
+	token   string
+	client  *politeClient
+}
+
+func newSchedulesDirectClient(baseURL string, client *politeClient) *schedulesDirectClient {
+	return &schedulesDirectClient{
+		baseURL: baseURL,
+		client:  client,
+	}
+}
+
+func (c *schedulesDirectClient) do(method, path string, in, out interface{}) error {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.client.Do(func() (*http.Request, error) {
+		var body io.Reader
+		if data != nil {
+			body = bytes.NewReader(data)
+		}
+		req, err := http.NewRequest(method, c.baseURL+path, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "hdhr-dvr")
+		if data != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("token", c.token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// login exchanges the configured credentials for a session token. The API
+// expects the SHA-1 hex digest of the password rather than the password itself.
+func (c *schedulesDirectClient) login(username, password string) error {
+	sum := sha1.Sum([]byte(password))
+	creds := map[string]string{
+		"username": username,
+		"password": hex.EncodeToString(sum[:]),
+	}
+
+	var resp types.SDTokenResponse
+	if err := c.do("POST", "/token", creds, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 || resp.Token == "" {
+		return fmt.Errorf("schedules direct login failed: %s (code %d)", resp.Message, resp.Code)
+	}
+	c.token = resp.Token
+	return nil
+}
+
+func (c *schedulesDirectClient) fetchLineup(lineup string) (*types.SDLineupResponse, error) {
+	var resp types.SDLineupResponse
+	if err := c.do("GET", "/lineups/"+lineup, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *schedulesDirectClient) fetchSchedules(stationIDs []string, dates []string) ([]types.SDScheduleResponse, error) {
+	reqs := make([]types.SDScheduleRequest, 0, len(stationIDs))
+	for _, id := range stationIDs {
+		reqs = append(reqs, types.SDScheduleRequest{StationID: id, Date: dates})
+	}
+
+	var resp []types.SDScheduleResponse
+	if err := c.do("POST", "/schedules", reqs, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *schedulesDirectClient) fetchPrograms(programIDs []string) (map[string]types.SDProgram, error) {
+	programs := make(map[string]types.SDProgram)
+	for start := 0; start < len(programIDs); start += sdProgramBatch {
+		end := start + sdProgramBatch
+		if end > len(programIDs) {
+			end = len(programIDs)
+		}
+
+		var resp []types.SDProgram
+		if err := c.do("POST", "/programs", programIDs[start:end], &resp); err != nil {
+			return nil, err
+		}
+		for _, p := range resp {
+			programs[p.ProgramID] = p
+		}
+	}
+	return programs, nil
+}
+
+// sdChannelNumber returns the lineup channel in the same "major.minor" form
+// the HDHomeRun reports as GuideNumber.
+func sdChannelNumber(m types.SDLineupMap) string {
+	if m.AtscMajor != 0 {
+		if m.AtscMinor != 0 {
+			return fmt.Sprintf("%d.%d", m.AtscMajor, m.AtscMinor)
+		}
+		return fmt.Sprintf("%d", m.AtscMajor)
+	}
+	return strings.TrimLeft(m.Channel, "0")
+}
+
+// sdEpisode returns the season and episode numbers, preferring Gracenote's
+// numbering over other providers.
+func sdEpisode(p types.SDProgram) (int, int) {
+	var season, episode int
+	for _, m := range p.Metadata {
+		for provider, md := range m {
+			if provider == "Gracenote" {
+				return md.Season, md.Episode
+			}
+			if season == 0 && episode == 0 {
+				season, episode = md.Season, md.Episode
+			}
+		}
+	}
+	return season, episode
+}
+
+// sdRating returns the US parental rating, or the first rating listed.
+func sdRating(p types.SDProgram) string {
+	for _, r := range p.ContentRating {
+		if r.Body == "USA Parental Rating" {
+			return r.Code
+		}
+	}
+	if len(p.ContentRating) > 0 {
+		return p.ContentRating[0].Code
+	}
+	return ""
+}
+
+func sdCast(p types.SDProgram) []string {
+	var cast []string
+	for _, c := range p.Cast {
+		if c.Name != "" {
+			cast = append(cast, c.Name)
+		}
+	}
+	return cast
+}
+
+func sdAttributes(sched types.SDScheduleProgram, p types.SDProgram) programAttributes {
+	attrs := programAttributes{
+		Types:  []string{p.EntityType, p.ShowType},
+		Genres: p.Genres,
+	}
+	if sched.New {
+		attrs.Flags = append(attrs.Flags, "new")
+	}
+	if sched.LiveTapeDelay != "" {
+		attrs.Flags = append(attrs.Flags, sched.LiveTapeDelay)
+	}
+	return attrs
+}
+
+// schedulesDirectSource implements GuideSource against the Schedules Direct
+// JSON API.
+type schedulesDirectSource struct {
+	client     *schedulesDirectClient
+	username   string
+	password   string
+	lineups    []string
+	loc        *time.Location
+	categories *categoryMapper
+
+	// details caches program metadata across FetchListings calls since the
+	// same program ID typically airs on several days. FetchListings may run
+	// concurrently, so it is guarded by mu.
+	mu      sync.Mutex
+	details map[string]types.SDProgram
+}
+
+func newSchedulesDirectSource(baseURL string, config *pkgcfg.Config, loc *time.Location, client *politeClient, categories *categoryMapper) (*schedulesDirectSource, error) {
+	lineups := config.SDLineups
+	if len(lineups) == 0 && config.SDLineup != "" {
+		lineups = []string{config.SDLineup}
+	}
+	if config.SDUsername == "" || config.SDPassword == "" || len(lineups) == 0 {
+		return nil, fmt.Errorf("sdUsername, sdPassword and sdLineup are required for the schedulesdirect guide source")
+	}
+	return &schedulesDirectSource{
+		client:     newSchedulesDirectClient(baseURL, client),
+		username:   config.SDUsername,
+		password:   config.SDPassword,
+		lineups:    lineups,
+		loc:        loc,
+		categories: categories,
+		details:    make(map[string]types.SDProgram),
+	}, nil
+}
+
+func (s *schedulesDirectSource) Name() string {
+	return "schedulesdirect"
+}
+
+func (s *schedulesDirectSource) ListingBatchSize() int {
+	return sdStationBatch
+}
+
+func (s *schedulesDirectSource) FetchChannels() ([]types.LineupData, error) {
+	if s.client.token == "" {
+		if err := s.client.login(s.username, s.password); err != nil {
+			return nil, err
+		}
+	}
+
+	// Station IDs are global, so a station carried by several lineups is
+	// kept once, under the first lineup that lists it.
+	var lineup []types.LineupData
+	seen := make(map[string]bool)
+	for _, id := range s.lineups {
+		lineupResp, err := s.client.fetchLineup(id)
+		if err != nil {
+			return nil, fmt.Errorf("fetching lineup %s: %w", id, err)
+		}
+		log.Printf("Found %d Schedules Direct stations in lineup %s", len(lineupResp.Stations), id)
+
+		stations := make(map[string]types.SDStation)
+		for _, st := range lineupResp.Stations {
+			stations[st.StationID] = st
+		}
+
+		for _, m := range lineupResp.Map {
+			if seen[m.StationID] {
+				continue
+			}
+			seen[m.StationID] = true
+
+			st := stations[m.StationID]
+			lineup = append(lineup, types.LineupData{
+				StationID:       m.StationID,
+				ChannelNumber:   sdChannelNumber(m),
+				StationCallSign: st.Callsign,
+				Logo:            st.Logo.URL,
+				Source:          "schedulesdirect/" + id,
+			})
+		}
+	}
+	return lineup, nil
+}
+
+func (s *schedulesDirectSource) FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error) {
+	if s.client.token == "" {
+		return nil, fmt.Errorf("FetchChannels must be called before FetchListings")
+	}
+
+	channelByStation := make(map[string]string)
+	var stationIDs []string
+	for _, ch := range channels {
+		channelByStation[ch.StationID] = ch.ChannelNumber
+		stationIDs = append(stationIDs, ch.StationID)
+	}
+
+	// Schedules are keyed by UTC date, so cover every UTC date the window touches.
+	var dates []string
+	for d := start.UTC().Truncate(24 * time.Hour); d.Before(end); d = d.Add(24 * time.Hour) {
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+
+	schedules, err := s.client.fetchSchedules(stationIDs, dates)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schedules: %w", err)
+	}
+
+	var missing []string
+	queued := make(map[string]bool)
+	s.mu.Lock()
+	for _, sched := range schedules {
+		for _, p := range sched.Programs {
+			if _, ok := s.details[p.ProgramID]; !ok && !queued[p.ProgramID] {
+				queued[p.ProgramID] = true
+				missing = append(missing, p.ProgramID)
+			}
+		}
+	}
+	s.mu.Unlock()
+	if len(missing) > 0 {
+		fetched, err := s.client.fetchPrograms(missing)
+		if err != nil {
+			return nil, fmt.Errorf("fetching program details: %w", err)
+		}
+		s.mu.Lock()
+		for id, p := range fetched {
+			s.details[id] = p
+		}
+		s.mu.Unlock()
+	}
+
+	var programs []types.Program
+	for _, sched := range schedules {
+		channelNum, ok := channelByStation[sched.StationID]
+		if !ok {
+			continue
+		}
+		for _, p := range sched.Programs {
+			progStart, err := time.Parse(time.RFC3339, p.AirDateTime)
+			if err != nil {
+				log.Printf("Error parsing air time %s: %v", p.AirDateTime, err)
+				continue
+			}
+			if progStart.Before(start) || !progStart.Before(end) {
+				continue
+			}
+			progEnd := progStart.Add(time.Duration(p.Duration) * time.Second)
+
+			s.mu.Lock()
+			detail := s.details[p.ProgramID]
+			s.mu.Unlock()
+			prog := types.Program{
+				Channel:     channelNum,
+				SubTitle:    detail.EpisodeTitle150,
+				Description: detail.Description(),
+				Start:       progStart.In(s.loc).Format("2006-01-02T15:04:05-07:00"),
+				End:         progEnd.In(s.loc).Format("2006-01-02T15:04:05-07:00"),
+				Duration:    p.Duration / 60,
+				Category:    s.categories.Category(sdAttributes(p, detail)),
+				New:         p.New,
+
+				OriginalAirDate: detail.OriginalAirDate,
+				Rating:          sdRating(detail),
+				Cast:            sdCast(detail),
+			}
+			if len(detail.Titles) > 0 {
+				prog.Title = detail.Titles[0].Title120
+			}
+			prog.Season, prog.Episode = sdEpisode(detail)
+			if year, err := strconv.Atoi(detail.Movie.Year); err == nil {
+				prog.Year = year
+			}
+
+			programs = append(programs, prog)
+		}
+	}
+
+	return programs, nil
+}
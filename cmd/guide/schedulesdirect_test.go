@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+func newSchedulesDirectTestServer(t *testing.T, airTime string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		var creds map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			t.Fatal(err)
+		}
+		// sha1("secret")
+		if creds["password"] != "e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4" {
+			json.NewEncoder(w).Encode(types.SDTokenResponse{Code: 4003, Message: "bad password"}) //nolint: errcheck
+			return
+		}
+		json.NewEncoder(w).Encode(types.SDTokenResponse{Token: "tok"}) //nolint: errcheck
+	})
+	mux.HandleFunc("/lineups/USA-OTA-98052", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("token") != "tok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{
+			"map": [
+				{"stationID": "100", "atscMajor": 5, "atscMinor": 1},
+				{"stationID": "200", "atscMajor": 9, "atscMinor": 1}
+			],
+			"stations": [
+				{"stationID": "100", "callsign": "KING", "logo": {"URL": "http://logo/king.png"}},
+				{"stationID": "200", "callsign": "KCTS"}
+			]
+		}`)) //nolint: errcheck
+	})
+	mux.HandleFunc("/lineups/USA-WA12345-X", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"map": [
+				{"stationID": "100", "channel": "705"},
+				{"stationID": "300", "channel": "0706"}
+			],
+			"stations": [
+				{"stationID": "100", "callsign": "KING"},
+				{"stationID": "300", "callsign": "KONG"}
+			]
+		}`)) //nolint: errcheck
+	})
+	mux.HandleFunc("/schedules", func(w http.ResponseWriter, r *http.Request) {
+		var reqs []types.SDScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			t.Fatal(err)
+		}
+		if len(reqs) != 1 || reqs[0].StationID != "100" {
+			t.Errorf("expected schedule request for station 100 only, got %+v", reqs)
+		}
+		json.NewEncoder(w).Encode([]types.SDScheduleResponse{{ //nolint: errcheck
+			StationID: "100",
+			Programs: []types.SDScheduleProgram{
+				{ProgramID: "MV001", AirDateTime: airTime, Duration: 7200, New: true},
+				{ProgramID: "MV001", AirDateTime: airTime, Duration: 7200},
+			},
+		}})
+	})
+	mux.HandleFunc("/programs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{
+			"programID": "MV001",
+			"titles": [{"title120": "Big Movie"}],
+			"entityType": "Movie",
+			"descriptions": {"description1000": [{"descriptionLanguage": "en", "description": "A big one."}]},
+			"metadata": [{"Gracenote": {"season": 0, "episode": 0}}],
+			"originalAirDate": "1999-05-01",
+			"contentRating": [{"body": "Motion Picture Association of America", "code": "PG"}],
+			"cast": [{"name": "Lead Actor", "role": "Actor"}, {"name": "Second Actor", "role": "Actor"}],
+			"movie": {"year": "1999"}
+		}]`)) //nolint: errcheck
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSchedulesDirectSource(t *testing.T) {
+	now := time.Now().UTC()
+	airTime := now.Add(time.Hour).Truncate(time.Hour).Format(time.RFC3339)
+	srv := newSchedulesDirectTestServer(t, airTime)
+	defer srv.Close()
+
+	cfg := &pkgcfg.Config{SDUsername: "user", SDPassword: "secret", SDLineup: "USA-OTA-98052"}
+	src, err := newSchedulesDirectSource(srv.URL, cfg, time.UTC, newTestClient(), newCategoryMapper(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guide, err := buildGuide(src, newChannelMatcher([]types.Channel{{GuideNumber: "5.1"}}), nil, now, 2, 1, &guideState{ProcessedDays: map[string]string{}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lineup := guide.Channels
+	if len(lineup) != 1 || lineup[0].ChannelNumber != "5.1" || lineup[0].StationCallSign != "KING" || lineup[0].Logo != "http://logo/king.png" {
+		t.Fatalf("unexpected lineup: %+v", lineup)
+	}
+	if len(guide.Programs) != 1 {
+		t.Fatalf("expected duplicate airing to be dropped, got %d programs", len(guide.Programs))
+	}
+	p := guide.Programs[0]
+	if p.Title != "Big Movie" || p.Category != "movie" || p.Duration != 120 || !p.New || p.Channel != "5.1" {
+		t.Errorf("unexpected program: %+v", p)
+	}
+	if p.Description != "A big one." || p.Year != 1999 || p.OriginalAirDate != "1999-05-01" || p.Rating != "PG" || len(p.Cast) != 2 {
+		t.Errorf("unexpected extended metadata: %+v", p)
+	}
+}
+
+func TestSchedulesDirectSource_MultipleLineups(t *testing.T) {
+	srv := newSchedulesDirectTestServer(t, time.Now().UTC().Format(time.RFC3339))
+	defer srv.Close()
+
+	cfg := &pkgcfg.Config{SDUsername: "user", SDPassword: "secret", SDLineups: []string{"USA-OTA-98052", "USA-WA12345-X"}}
+	src, err := newSchedulesDirectSource(srv.URL, cfg, time.UTC, newTestClient(), newCategoryMapper(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels, err := src.FetchChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]types.LineupData)
+	for _, ch := range channels {
+		got[ch.StationID] = ch
+	}
+	// KING is in both lineups and is kept from the first.
+	if len(channels) != 3 || got["100"].ChannelNumber != "5.1" || got["100"].Source != "schedulesdirect/USA-OTA-98052" {
+		t.Fatalf("unexpected channels: %+v", channels)
+	}
+	if got["300"].ChannelNumber != "706" || got["300"].Source != "schedulesdirect/USA-WA12345-X" {
+		t.Errorf("unexpected cable channel: %+v", got["300"])
+	}
+}
+
+func TestSchedulesDirectSource_BadCredentials(t *testing.T) {
+	srv := newSchedulesDirectTestServer(t, time.Now().UTC().Format(time.RFC3339))
+	defer srv.Close()
+
+	cfg := &pkgcfg.Config{SDUsername: "user", SDPassword: "wrong", SDLineup: "USA-OTA-98052"}
+	src, err := newSchedulesDirectSource(srv.URL, cfg, time.UTC, newTestClient(), newCategoryMapper(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.FetchChannels(); err == nil {
+		t.Fatal("expected login error")
+	}
+}
+
+func TestNewSchedulesDirectSource_MissingCredentials(t *testing.T) {
+	if _, err := newSchedulesDirectSource("http://unused", &pkgcfg.Config{SDUsername: "user"}, time.UTC, newTestClient(), newCategoryMapper(nil)); err == nil {
+		t.Fatal("expected error for missing password and lineup")
+	}
+}
+
+func TestSDEpisode(t *testing.T) {
+	p := types.SDProgram{Metadata: []map[string]types.SDEpisodeMetadata{
+		{"TheTVDB": {Season: 9, Episode: 9}},
+		{"Gracenote": {Season: 3, Episode: 12}},
+	}}
+	if season, episode := sdEpisode(p); season != 3 || episode != 12 {
+		t.Errorf("sdEpisode = %d, %d, want 3, 12", season, episode)
+	}
+	if season, episode := sdEpisode(types.SDProgram{}); season != 0 || episode != 0 {
+		t.Errorf("sdEpisode of empty program = %d, %d, want 0, 0", season, episode)
+	}
+}
+
+func TestSDChannelNumber(t *testing.T) {
+	tests := []struct {
+		in   types.SDLineupMap
+		want string
+	}{
+		{types.SDLineupMap{AtscMajor: 5, AtscMinor: 1}, "5.1"},
+		{types.SDLineupMap{AtscMajor: 44}, "44"},
+		{types.SDLineupMap{Channel: "0702"}, "702"},
+	}
+	for _, tt := range tests {
+		if got := sdChannelNumber(tt.in); got != tt.want {
+			t.Errorf("sdChannelNumber(%+v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
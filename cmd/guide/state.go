@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+// guideState records which guide days have been fetched completely, so later
+// runs can reuse those listings from the previous guide file instead of
+// fetching them again.
+type guideState struct {
+	// ProcessedDays maps a day (YYYY-MM-DD, guide timezone) to the RFC 3339
+	// time it was last fetched without errors.
+	ProcessedDays map[string]string `json:"processedDays"`
+}
+
+// loadGuideState reads the state file, returning an empty state if it does
+// not exist yet.
+func loadGuideState(path string) (*guideState, error) {
+	state := &guideState{ProcessedDays: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.ProcessedDays == nil {
+		state.ProcessedDays = make(map[string]string)
+	}
+	return state, nil
+}
+
+func (s *guideState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *guideState) processed(day string) bool {
+	return s.ProcessedDays[day] != ""
+}
+
+func (s *guideState) markProcessed(day string, at time.Time) {
+	s.ProcessedDays[day] = at.Format(time.RFC3339)
+}
+
+// prune forgets days before today, which no guide window covers any more,
+// and returns how many it removed.
+func (s *guideState) prune(today string) int {
+	n := 0
+	for day := range s.ProcessedDays {
+		if day < today {
+			delete(s.ProcessedDays, day)
+			n++
+		}
+	}
+	return n
+}
+
+// loadPreviousPrograms returns the programs from an existing guide file, or
+// nil if there is none. Processed days are reused from that file, so without
+// one they are forgotten in state and fetched again.
+func loadPreviousPrograms(path string, state *guideState) ([]types.Program, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		state.ProcessedDays = make(map[string]string)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var guide types.Guide
+	if err := json.Unmarshal(data, &guide); err != nil {
+		return nil, err
+	}
+	return guide.Programs, nil
+}
+
+// programsInWindow returns the programs starting within [start, end).
+func programsInWindow(programs []types.Program, start, end time.Time) []types.Program {
+	var out []types.Program
+	for _, p := range programs {
+		t, err := time.Parse(time.RFC3339, p.Start)
+		if err != nil {
+			continue
+		}
+		if !t.Before(start) && t.Before(end) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
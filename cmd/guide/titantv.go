@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const titanTVBaseURL = "https://titantv.com/api"
+
+// titanTVBlockMinutes is the length of each schedule block requested from
+// TitanTV.
+const titanTVBlockMinutes = 360
+
+// titanTVSource implements GuideSource against the TitanTV web API.
+type titanTVSource struct {
+	baseURL    string
+	userID     string
+	lineupID   string
+	loc        *time.Location
+	client     *politeClient
+	categories *categoryMapper
+
+	// channelNumbers maps TitanTV channelIndex to the tuner channel number,
+	// populated by FetchChannels.
+	channelNumbers map[int]string
+}
+
+func newTitanTVSource(baseURL, userID, lineupID string, loc *time.Location, client *politeClient, categories *categoryMapper) *titanTVSource {
+	return &titanTVSource{
+		baseURL:    baseURL,
+		userID:     userID,
+		lineupID:   lineupID,
+		loc:        loc,
+		client:     client,
+		categories: categories,
+	}
+}
+
+func (s *titanTVSource) Name() string {
+	return "titantv"
+}
+
+func (s *titanTVSource) get(url string, out interface{}) error {
+	resp, err := s.client.Do(func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/149.0.0.0 Safari/537.36")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+func titanTVChannelNumber(ch types.TitanTVChannel) string {
+	channelNum := fmt.Sprintf("%d", ch.MajorChannel)
+	if ch.MinorChannel != 0 {
+		channelNum += fmt.Sprintf(".%d", ch.MinorChannel)
+	}
+	return channelNum
+}
+
+// titanTVDate reduces a TitanTV date or timestamp to YYYY-MM-DD.
+func titanTVDate(value string) string {
+	if len(value) < len("2006-01-02") {
+		return ""
+	}
+	if _, err := time.Parse("2006-01-02", value[:10]); err != nil {
+		return ""
+	}
+	return value[:10]
+}
+
+func titanTVAttributes(evt types.TitanTVEvent) programAttributes {
+	attrs := programAttributes{
+		Types:  []string{evt.ProgramType},
+		Genres: splitGenres(evt.Genres),
+	}
+	if evt.IsNew {
+		attrs.Flags = append(attrs.Flags, "new")
+	}
+	if evt.NewRepeat != "" {
+		attrs.Flags = append(attrs.Flags, evt.NewRepeat)
+	}
+	return attrs
+}
+
+func (s *titanTVSource) FetchChannels() ([]types.LineupData, error) {
+	log.Printf("Fetching guide data from TitanTV for UserID: %s and LineupID: %s", s.userID, s.lineupID)
+
+	var response types.TitanTVLineupResponse
+	url := fmt.Sprintf("%s/channel/%s/%s", s.baseURL, s.userID, s.lineupID)
+	if err := s.get(url, &response); err != nil {
+		return nil, err
+	}
+
+	s.channelNumbers = make(map[int]string)
+	var lineup []types.LineupData
+	for _, ch := range response.Channels {
+		channelNum := titanTVChannelNumber(ch)
+		s.channelNumbers[ch.ChannelIndex] = channelNum
+		lineup = append(lineup, types.LineupData{
+			StationID:       fmt.Sprintf("%d", ch.ChannelID),
+			ChannelNumber:   channelNum,
+			StationCallSign: ch.CallSign,
+			Logo:            ch.Logo,
+			Source:          "titantv/" + s.lineupID,
+		})
+	}
+	return lineup, nil
+}
+
+func (s *titanTVSource) fetchScheduleBlock(startTime time.Time) (*types.TitanTVScheduleResponse, error) {
+	dateStr := startTime.Format("200601021504")
+	url := fmt.Sprintf("%s/schedule/%s/%s/%s/%d", s.baseURL, s.userID, s.lineupID, dateStr, titanTVBlockMinutes)
+
+	var response types.TitanTVScheduleResponse
+	if err := s.get(url, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// parseTitanTVTime parses TitanTV ISO 8601 local times such as
+// "2026-01-29T10:00:00" (seconds are sometimes omitted).
+func parseTitanTVTime(value string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", value, loc)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02T15:04", value, loc)
+	}
+	return t, err
+}
+
+// FetchListings requests the window in fixed-size blocks. TitanTV returns the
+// whole lineup per block, so channels only restricts which results are kept.
+// A failed block does not stop the remaining blocks; the first error is
+// returned alongside whatever was fetched.
+func (s *titanTVSource) FetchListings(channels []types.LineupData, start, end time.Time) ([]types.Program, error) {
+	if s.channelNumbers == nil {
+		return nil, fmt.Errorf("FetchChannels must be called before FetchListings")
+	}
+
+	wanted := make(map[string]bool)
+	for _, ch := range channels {
+		wanted[ch.ChannelNumber] = true
+	}
+
+	var programs []types.Program
+	var firstErr error
+	block := titanTVBlockMinutes * time.Minute
+	for blockStart := start; blockStart.Before(end); blockStart = blockStart.Add(block) {
+		log.Printf("Fetching TitanTV block starting %s...", blockStart.Format("2006-01-02 15:04"))
+
+		schedResp, err := s.fetchScheduleBlock(blockStart)
+		if err != nil {
+			log.Printf("Error fetching schedule block %s: %v", blockStart.Format("2006-01-02 15:04"), err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("fetching schedule block %s: %w", blockStart.Format("2006-01-02 15:04"), err)
+			}
+			continue
+		}
+
+		for _, chSched := range schedResp.Channels {
+			channelNum, ok := s.channelNumbers[chSched.ChannelIndex]
+			if !ok {
+				log.Printf("Warning: No channel info found for index %d", chSched.ChannelIndex)
+				continue
+			}
+			if !wanted[channelNum] {
+				continue
+			}
+
+			for _, day := range chSched.Days {
+				for _, evt := range day.Events {
+					progStart, err := parseTitanTVTime(evt.StartTime, s.loc)
+					if err != nil {
+						log.Printf("Error parsing start time %s: %v", evt.StartTime, err)
+						continue
+					}
+					progEnd, err := parseTitanTVTime(evt.EndTime, s.loc)
+					if err != nil {
+						log.Printf("Error parsing end time %s: %v", evt.EndTime, err)
+						continue
+					}
+
+					prog := types.Program{
+						Channel:     channelNum,
+						Title:       evt.Title,
+						SubTitle:    evt.SubTitle,
+						Description: evt.Description,
+						Start:       progStart.In(s.loc).Format("2006-01-02T15:04:05-07:00"),
+						End:         progEnd.In(s.loc).Format("2006-01-02T15:04:05-07:00"),
+						Duration:    int(progEnd.Sub(progStart).Minutes()),
+						Category:    s.categories.Category(titanTVAttributes(evt)),
+						New:         evt.IsNew,
+
+						Season:          evt.SeasonNum,
+						Episode:         evt.EpisodeNum,
+						OriginalAirDate: titanTVDate(evt.OriginalAir),
+						Year:            evt.Year,
+						Rating:          evt.Rating,
+					}
+
+					programs = append(programs, prog)
+				}
+			}
+		}
+	}
+
+	return programs, firstErr
+}
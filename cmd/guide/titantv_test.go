@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitanTVSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/channel/"):
+			w.Write([]byte(`{"channels": [
+				{"channelId": 11, "majorChannel": 5, "minorChannel": 1, "callSign": "KING", "channelIndex": 1},
+				{"channelId": 12, "majorChannel": 9, "minorChannel": 0, "callSign": "KCTS", "channelIndex": 2}
+			]}`)) //nolint: errcheck
+		case strings.HasPrefix(r.URL.Path, "/schedule/"):
+			w.Write([]byte(`{"channels": [
+				{"channelIndex": 1, "days": [{"events": [
+					{"startTime": "2026-01-10T14:00:00", "endTime": "2026-01-10T16:00", "title": "Movie", "programType": "Movie", "isNew": true}
+				]}]},
+				{"channelIndex": 2, "days": [{"events": [
+					{"startTime": "2026-01-10T14:00:00", "endTime": "2026-01-10T15:00:00", "title": "Other", "description": "Pilot.",
+					 "seasonNum": 2, "episodeNum": 7, "originalAirDate": "2025-11-02T00:00:00", "rating": "TV-PG"}
+				]}]}
+			]}`)) //nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	src := newTitanTVSource(srv.URL, "user", "lineup", time.UTC, newTestClient(), newCategoryMapper(nil))
+
+	channels, err := src.FetchChannels()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(channels) != 2 || channels[0].ChannelNumber != "5.1" || channels[1].ChannelNumber != "9" {
+		t.Fatalf("unexpected channels: %+v", channels)
+	}
+
+	start := time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC)
+	programs, err := src.FetchListings(channels[:1], start, start.Add(6*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(programs) != 1 {
+		t.Fatalf("expected 1 program for 5.1, got %+v", programs)
+	}
+	p := programs[0]
+	if p.Channel != "5.1" || p.Category != "movie" || p.Duration != 120 || !p.New {
+		t.Errorf("unexpected program: %+v", p)
+	}
+
+	programs, err = src.FetchListings(channels[1:], start, start.Add(6*time.Hour))
+	if err != nil || len(programs) != 1 {
+		t.Fatalf("expected 1 program for 9, got %+v (err: %v)", programs, err)
+	}
+	p = programs[0]
+	if p.Description != "Pilot." || p.Season != 2 || p.Episode != 7 || p.OriginalAirDate != "2025-11-02" || p.Rating != "TV-PG" {
+		t.Errorf("unexpected extended metadata: %+v", p)
+	}
+}
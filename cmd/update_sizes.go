@@ -4,12 +4,12 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	pkgcfg "github.com/prziborowski/hdhr-dvr/pkg/config"
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
 	"github.com/prziborowski/hdhr-dvr/pkg/types"
 )
 
@@ -21,7 +21,7 @@ func main() {
 	}
 
 	// Open database
-	db, err := sql.Open("sqlite3", "./recordings.db")
+	db, err := sql.Open("sqlite3", "./recordings.db?_busy_timeout=5000")
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -58,6 +58,7 @@ func main() {
 		log.Printf("Error closing rows cursor: %v", err)
 	} // Close rows before performing updates to avoid database lock
 
+	fs := storage.NewLocal(config.StorageDir)
 	count := 0
 	updated := 0
 
@@ -70,17 +71,17 @@ func main() {
 		count++
 
 		// Determine the file path
-		tsFile := filepath.Join(config.StorageDir, r.GetFilePath())
+		tsFile := r.GetFilePath()
 		mp4File := strings.TrimSuffix(tsFile, filepath.Ext(tsFile)) + ".mp4"
 
 		var finalSize int64 = 0
 		found := false
 
 		// Prefer MP4 if it exists
-		if info, err := os.Stat(mp4File); err == nil {
+		if info, err := fs.Stat(mp4File); err == nil {
 			finalSize = info.Size()
 			found = true
-		} else if info, err := os.Stat(tsFile); err == nil {
+		} else if info, err := fs.Stat(tsFile); err == nil {
 			// Fallback to TS file
 			finalSize = info.Size()
 			found = true
@@ -0,0 +1,421 @@
+// Package client is a Go client for the DVR's HTTP API. It covers what
+// tools built around the DVR need: listing channels and recordings,
+// scheduling and deleting recordings, searching the guide, managing
+// auto-record keywords, following the event stream and downloading
+// recordings, resuming interrupted downloads.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/types"
+)
+
+const (
+	// apiPrefix is where the API version the client speaks is served.
+	apiPrefix = "/api/v1"
+	// apiVersion is sent in API-Version, so a server answering another
+	// version refuses requests instead of misreading them.
+	apiVersion = "1"
+)
+
+// retryDelay is how long DownloadRecording waits before its first retry,
+// growing by as much again for each one after.
+var retryDelay = time.Second
+
+// Client talks to one DVR server.
+type Client struct {
+	// BaseURL is the server's URL, including any basePath it is served
+	// under, e.g. "http://localhost:8080".
+	BaseURL string
+	// APIKey is sent as a bearer token when set.
+	APIKey string
+	// HTTPClient sends the requests; http.DefaultClient when nil. Event
+	// streams and downloads run as long as they take, so rather than a
+	// client timeout, bound calls with their context.
+	HTTPClient *http.Client
+	// Retries is how many times DownloadRecording resumes a transfer that
+	// failed part way.
+	Retries int
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL, apiKey string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), APIKey: apiKey, Retries: 3}
+}
+
+// Error is returned for a response with an error status. Message is the
+// server's {"error": ...} message or its plain-text body.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Channel is a channel as listed by the server.
+type Channel struct {
+	GuideNumber    string     `json:"guideNumber"`
+	GuideName      string     `json:"guideName"`
+	VideoCodec     string     `json:"videoCodec,omitempty"`
+	AudioCodec     string     `json:"audioCodec,omitempty"`
+	HD             bool       `json:"hd"`
+	SignalStrength int        `json:"signalStrength,omitempty"`
+	SignalQuality  int        `json:"signalQuality,omitempty"`
+	LastSeen       *time.Time `json:"lastSeen,omitempty"`
+	// Stale channels were missing from the lineup the server last fetched.
+	Stale    bool `json:"stale,omitempty"`
+	Favorite bool `json:"favorite,omitempty"`
+}
+
+// Recording is a recording as listed by the server.
+type Recording struct {
+	ID          int     `json:"id"`
+	ChannelID   string  `json:"channel_id"`
+	Date        string  `json:"date"`       // YYYY-MM-DD
+	StartTime   string  `json:"start_time"` // HH:MM
+	Duration    int     `json:"duration"`   // minutes
+	Status      string  `json:"status"`
+	Title       *string `json:"title,omitempty"`
+	FileSize    int     `json:"file_size"`
+	GuideNumber string  `json:"guide_number"`
+	GuideName   string  `json:"guide_name"`
+	ProgramID   *string `json:"program_id,omitempty"`
+	Priority    int     `json:"priority"`
+	// FilePath is relative to the recording's storage root.
+	FilePath        *string  `json:"file_path,omitempty"`
+	ActualDuration  *float64 `json:"actual_duration,omitempty"`
+	Watched         *bool    `json:"watched,omitempty"`
+	PositionSeconds *float64 `json:"position_seconds,omitempty"`
+}
+
+// RecordingRequest schedules a recording. Title and ProgramID are
+// optional; with ProgramID the recording follows guide changes.
+type RecordingRequest struct {
+	ChannelID   string   `json:"channelId"`
+	Date        string   `json:"date"`      // YYYY-MM-DD
+	StartTime   string   `json:"startTime"` // HH:MM
+	Duration    int      `json:"duration"`  // minutes
+	Title       *string  `json:"title,omitempty"`
+	ProgramID   *string  `json:"programId,omitempty"`
+	Commercials *string  `json:"commercials,omitempty"`
+	Filters     []string `json:"filters,omitempty"`
+}
+
+// KeywordRequest adds an auto-record keyword: programs whose title
+// contains Name, and that are in Category when it is set, get recorded.
+type KeywordRequest struct {
+	Name        string   `json:"name"`
+	Category    string   `json:"category,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"`
+	Commercials string   `json:"commercials,omitempty"` // "mark" or "cut"
+	Filters     []string `json:"filters,omitempty"`
+}
+
+// Logs are server log lines. Last is the sequence number to pass as since
+// to get only the lines logged after these.
+type Logs struct {
+	Lines []struct {
+		Seq  int64  `json:"seq"`
+		Text string `json:"text"`
+	} `json:"lines"`
+	Last int64 `json:"last"`
+}
+
+// Event is a server event, such as "recording.completed". Data depends on
+// the type; see the README for each type's fields.
+type Event struct {
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// ListChannels returns the enabled channels, or with all set every channel,
+// including disabled and stale ones.
+func (c *Client) ListChannels(ctx context.Context, all bool) ([]Channel, error) {
+	path := "/channels"
+	if all {
+		path += "?all=true"
+	}
+	var channels []Channel
+	err := c.do(ctx, "GET", path, nil, &channels)
+	return channels, err
+}
+
+// ListRecordings returns every recording.
+func (c *Client) ListRecordings(ctx context.Context) ([]Recording, error) {
+	var recs []Recording
+	err := c.do(ctx, "GET", "/recordings", nil, &recs)
+	return recs, err
+}
+
+// CreateRecording schedules a recording and returns it.
+func (c *Client) CreateRecording(ctx context.Context, req RecordingRequest) (types.Recording, error) {
+	var rec types.Recording
+	err := c.do(ctx, "POST", "/recordings", req, &rec)
+	return rec, err
+}
+
+// DeleteRecording deletes a recording, and its files if it has any.
+func (c *Client) DeleteRecording(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", "/recordings/"+strconv.Itoa(id), nil, nil)
+}
+
+// SearchGuide returns the guide programs matching query, at most limit of
+// them, or the server's default number when limit is zero.
+func (c *Client) SearchGuide(ctx context.Context, query string, limit int) ([]types.Program, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var programs []types.Program
+	err := c.do(ctx, "GET", "/guide/search?"+q.Encode(), nil, &programs)
+	return programs, err
+}
+
+// RefreshGuide starts regenerating the guide; the server reloads it once
+// done.
+func (c *Client) RefreshGuide(ctx context.Context) error {
+	return c.do(ctx, "POST", "/guide/refresh", nil, nil)
+}
+
+// ListKeywords returns the auto-record keywords.
+func (c *Client) ListKeywords(ctx context.Context) ([]types.Keyword, error) {
+	var keywords []types.Keyword
+	err := c.do(ctx, "GET", "/keywords", nil, &keywords)
+	return keywords, err
+}
+
+// CreateKeyword adds an auto-record keyword and returns it.
+func (c *Client) CreateKeyword(ctx context.Context, req KeywordRequest) (types.Keyword, error) {
+	var k types.Keyword
+	err := c.do(ctx, "POST", "/keywords", req, &k)
+	return k, err
+}
+
+// Logs returns the latest server log lines, at most lines of them, that
+// were logged after sequence number since.
+func (c *Client) Logs(ctx context.Context, since int64, lines int) (Logs, error) {
+	var logs Logs
+	err := c.do(ctx, "GET", fmt.Sprintf("/logs?since=%d&lines=%d", since, lines), nil, &logs)
+	return logs, err
+}
+
+// WatchEvents follows the server's event stream, calling handle for each
+// event, until ctx is done, handle returns an error or the server closes
+// the stream. It returns handle's error, ctx.Err(), or
+// io.ErrUnexpectedEOF when the stream ends, after which callers that
+// want to keep watching call it again.
+func (c *Client) WatchEvents(ctx context.Context, handle func(Event) error) error {
+	req, err := c.newRequest(ctx, "GET", "/events", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 1<<20)
+	var data []byte
+	// Only data: lines matter: the event: field repeats the type found in
+	// the data, and lines starting with ":" are keep-alives.
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return fmt.Errorf("decoding event: %w", err)
+			}
+			data = data[:0]
+			if err := handle(e); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// DownloadRecording writes the recording's file to f and returns its size.
+// When f already holds the start of it, from an interrupted download, only
+// the rest is fetched; a server that sends the whole file instead has f
+// rewritten from the start. A transfer that fails part way is resumed up
+// to Retries times, and only while the file on the server is unchanged.
+func (c *Client) DownloadRecording(ctx context.Context, id int, f *os.File) (int64, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	path := "/recordings/" + strconv.Itoa(id) + "/file"
+	var validator string
+	for attempt := 0; ; attempt++ {
+		n, v, err := c.download(ctx, path, f, offset, validator)
+		offset = n
+		if v != "" {
+			validator = v
+		}
+		if err == nil {
+			return offset, nil
+		}
+		if _, ok := err.(*Error); ok || attempt >= c.Retries || ctx.Err() != nil {
+			return offset, err
+		}
+		select {
+		case <-ctx.Done():
+			return offset, ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * retryDelay):
+		}
+	}
+}
+
+// download makes one attempt at fetching path into f from offset, and
+// returns how much of the file f then holds and the response's validator
+// for If-Range.
+func (c *Client) download(ctx context.Context, path string, f *os.File, offset int64, validator string) (int64, string, error) {
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return offset, "", err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return offset, "", err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, _, _ := strings.Cut(strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes "), "-"); start != strconv.FormatInt(offset, 10) {
+			return offset, "", fmt.Errorf("server resumed at %q, want byte %d", resp.Header.Get("Content-Range"), offset)
+		}
+	case http.StatusOK:
+		if offset > 0 {
+			if err := f.Truncate(0); err != nil {
+				return offset, "", err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return offset, "", err
+			}
+			offset = 0
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing is left past offset: f holds the whole file, unless it
+		// holds more than the server has.
+		if resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return offset, "", nil
+		}
+		return offset, "", responseError(resp)
+	default:
+		return offset, "", responseError(resp)
+	}
+
+	v := resp.Header.Get("ETag")
+	if v == "" {
+		v = resp.Header.Get("Last-Modified")
+	}
+	n, err := io.Copy(f, resp.Body)
+	return offset + n, v, err
+}
+
+// do sends a request with in, if non-nil, as its JSON body and decodes a
+// JSON response into out, if non-nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// newRequest builds a request for path under the API prefix.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+apiPrefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("API-Version", apiVersion)
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	return req, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// responseError reads an error response into an *Error.
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		return &Error{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequests(t *testing.T) {
+	var created RecordingRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("API-Version") != "1" || r.Header.Get("Authorization") != "Bearer k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.RequestURI() {
+		case "GET /dvr/api/v1/channels?all=true":
+			w.Write([]byte(`[{"guideNumber": "5.1", "guideName": "KPIX", "hd": true}, {"guideNumber": "7.1", "guideName": "KGO", "hd": false, "stale": true}]`)) //nolint: errcheck
+		case "GET /dvr/api/v1/recordings":
+			w.Write([]byte(`[{"id": 3, "channel_id": "5.1", "date": "2026-03-01", "start_time": "20:00", "duration": 60, "status": "completed", "title": "Nova"}]`)) //nolint: errcheck
+		case "POST /dvr/api/v1/recordings":
+			if r.Header.Get("Content-Type") != "application/json" {
+				http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&created) //nolint: errcheck
+			if created.ChannelID == "9.1" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": "Channel not found"}`)) //nolint: errcheck
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ID": 7, "ChannelID": "5.1", "Duration": 30, "Status": "pending"}`)) //nolint: errcheck
+		case "DELETE /dvr/api/v1/recordings/7":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "404 page not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL+"/dvr/", "k")
+	ctx := context.Background()
+
+	channels, err := c.ListChannels(ctx, true)
+	if err != nil || len(channels) != 2 || !channels[0].HD || channels[0].GuideName != "KPIX" || !channels[1].Stale {
+		t.Errorf("ListChannels = %+v, %v", channels, err)
+	}
+	recs, err := c.ListRecordings(ctx)
+	if err != nil || len(recs) != 1 || recs[0].ID != 3 || recs[0].StartTime != "20:00" || *recs[0].Title != "Nova" {
+		t.Errorf("ListRecordings = %+v, %v", recs, err)
+	}
+	title := "News"
+	rec, err := c.CreateRecording(ctx, RecordingRequest{ChannelID: "5.1", Date: "2026-03-02", StartTime: "18:00", Duration: 30, Title: &title})
+	if err != nil || rec.ID != 7 || rec.Status != "pending" || *created.Title != "News" || created.StartTime != "18:00" {
+		t.Errorf("CreateRecording = %+v, %v; sent %+v", rec, err, created)
+	}
+	if err := c.DeleteRecording(ctx, 7); err != nil {
+		t.Errorf("DeleteRecording: %v", err)
+	}
+
+	// JSON and plain-text errors both come back as *Error.
+	_, err = c.CreateRecording(ctx, RecordingRequest{ChannelID: "9.1"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Channel not found" {
+		t.Errorf("CreateRecording error %v", err)
+	}
+	err = c.DeleteRecording(ctx, 8)
+	if !errors.As(err, &apiErr) || apiErr.Message != "404 page not found" || err.Error() != "server returned 404: 404 page not found" {
+		t.Errorf("DeleteRecording error %v", err)
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/events" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": keep-alive\n\n")                                                                                                           //nolint: errcheck
+		io.WriteString(w, "event: recording.started\ndata: {\"type\":\"recording.started\",\"time\":\"2026-03-01T20:00:00Z\",\"data\":{\"id\":3}}\n\n") //nolint: errcheck
+		io.WriteString(w, "event: guide.updated\ndata: {\"type\":\"guide.updated\",\"time\":\"2026-03-01T20:05:00Z\"}\n\n")                             //nolint: errcheck
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+
+	var got []Event
+	err := c.WatchEvents(context.Background(), func(e Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != io.ErrUnexpectedEOF || len(got) != 2 {
+		t.Fatalf("WatchEvents = %v, %+v", err, got)
+	}
+	if got[0].Type != "recording.started" || string(got[0].Data) != `{"id":3}` || !got[0].Time.Equal(time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("first event %+v", got[0])
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	if err := c.WatchEvents(context.Background(), func(Event) error { n++; return stop }); err != stop || n != 1 {
+		t.Errorf("handler error: %v after %d events", err, n)
+	}
+}
+
+func TestDownloadRecording(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	modified := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC)
+	var ranges []string
+	cut, ignoreRange := false, false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/recordings/3/file" {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		if ignoreRange {
+			r.Header.Del("Range")
+		}
+		if cut {
+			// Drop the connection half way through the file.
+			cut = false
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			w.Write(content[:4000]) //nolint: errcheck
+			return
+		}
+		http.ServeContent(w, r, "3.ts", modified, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "3.ts")
+	download := func(partial []byte) (int64, error) {
+		t.Helper()
+		ranges = nil
+		if err := os.WriteFile(path, partial, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close() //nolint: errcheck
+		n, err := c.DownloadRecording(ctx, 3, f)
+		if got, _ := os.ReadFile(path); err == nil && !bytes.Equal(got, content) {
+			t.Errorf("file holds %d bytes, want the %d of the recording", len(got), len(content))
+		}
+		return n, err
+	}
+
+	if n, err := download(nil); err != nil || n != int64(len(content)) || ranges[0] != "" {
+		t.Errorf("fresh download = %d, %v, ranges %q", n, err, ranges)
+	}
+	if n, err := download(content[:2500]); err != nil || n != int64(len(content)) || strings.Join(ranges, ",") != "bytes=2500-" {
+		t.Errorf("resumed download = %d, %v, ranges %q", n, err, ranges)
+	}
+	cut = true
+	if n, err := download(nil); err != nil || n != int64(len(content)) || strings.Join(ranges, ",") != ",bytes=4000-" {
+		t.Errorf("interrupted download = %d, %v, ranges %q", n, err, ranges)
+	}
+	if n, err := download(content); err != nil || n != int64(len(content)) {
+		t.Errorf("complete download = %d, %v", n, err)
+	}
+	ignoreRange = true
+	if n, err := download([]byte("stale bytes of another file")); err != nil || n != int64(len(content)) {
+		t.Errorf("download without range support = %d, %v", n, err)
+	}
+	ignoreRange = false
+
+	var apiErr *Error
+	f, _ := os.Create(filepath.Join(t.TempDir(), "4.ts"))
+	defer f.Close() //nolint: errcheck
+	if _, err := c.DownloadRecording(ctx, 4, f); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("missing recording: %v", err)
+	}
+}
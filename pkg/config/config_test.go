@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -32,6 +34,9 @@ func TestLoadConfig_ValidAllFields(t *testing.T) {
 	assertString(t, "timezone", cfg.Timezone, "America/New_York")
 	assertString(t, "userID", cfg.UserID, "test-user-id")
 	assertString(t, "lineUpID", cfg.LineUpID, "test-lineup")
+	if len(cfg.LineUpIDs) != 1 || cfg.LineUpIDs[0] != "test-lineup" {
+		t.Errorf("lineUpIDs: expected [test-lineup], got %v", cfg.LineUpIDs)
+	}
 	assertInt(t, "days", cfg.Days, 5)
 	assertString(t, "guideFile", cfg.GuideFile, "epg.json")
 	assertString(t, "stateFile", cfg.StateFile, "state.json")
@@ -51,12 +56,18 @@ func TestLoadConfig_DefaultTimezone(t *testing.T) {
 	wd, _ := os.Getwd()
 	os.Chdir(tmpDir)   //nolint:errcheck
 	defer os.Chdir(wd) //nolint:errcheck
+	t.Setenv("TZ", "America/New_York")
 
 	cfg, err := LoadConfig()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	assertString(t, "timezone default", cfg.Timezone, "America/Los_Angeles")
+	assertString(t, "timezone default", cfg.Timezone, "America/New_York")
+
+	t.Setenv("DVR_TIMEZONE", "Mars/Olympus_Mons")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for an unknown timezone")
+	}
 }
 
 func TestLoadConfig_DaysClampedTo8_Zero(t *testing.T) {
@@ -145,6 +156,236 @@ func TestLoadConfig_DefaultStateFile(t *testing.T) {
 	assertString(t, "stateFile default", cfg.StateFile, "guide_state.json")
 }
 
+func TestLoadConfig_DefaultGuideSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := `{
+				"lineUpID": "test",
+				"storageDir": "/tmp/rec"
+			}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(tmpDir)   //nolint:errcheck
+	defer os.Chdir(wd) //nolint:errcheck
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertString(t, "guideSource default", cfg.GuideSource, "titantv")
+}
+
+func TestLoadConfig_StorageDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := `{
+				"lineUpID": "test",
+				"storageDirs": ["/mnt/disk1", "/mnt/disk2"]
+			}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(tmpDir)   //nolint:errcheck
+	defer os.Chdir(wd) //nolint:errcheck
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertString(t, "storageDir from storageDirs", cfg.StorageDir, "/mnt/disk1")
+	assertString(t, "storagePlacement default", cfg.StoragePlacement, "most-free")
+	if len(cfg.StorageDirs) != 2 {
+		t.Errorf("storageDirs: expected 2 entries, got %v", cfg.StorageDirs)
+	}
+}
+
+func TestLoadConfig_ServerDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "deviceURL": "http://10.0.0.5/"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(tmpDir)   //nolint:errcheck
+	defer os.Chdir(wd) //nolint:errcheck
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertInt(t, "port", cfg.Port, 8080)
+	assertString(t, "dbPath", cfg.DBPath, "./recordings.db")
+	assertString(t, "deviceURL", cfg.DeviceURL, "http://10.0.0.5")
+	assertString(t, "ffmpegPath", cfg.FFmpegPath, "ffmpeg")
+	assertString(t, "ffprobePath", cfg.FFprobePath, "ffprobe")
+	assertString(t, "basePath", cfg.BasePath, "")
+	if cfg.ListenAddr != "" || cfg.TLS != nil {
+		t.Errorf("expected plain HTTP on every interface, got %q %+v", cfg.ListenAddr, cfg.TLS)
+	}
+}
+
+func TestLoadConfig_TLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+	t.Setenv("DVR_LISTEN_ADDR", "127.0.0.1")
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "tls": {"selfSigned": true}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertString(t, "listenAddr", cfg.ListenAddr, "127.0.0.1")
+	assertString(t, "certFile", cfg.TLS.CertFile, "tls/cert.pem")
+	assertString(t, "keyFile", cfg.TLS.KeyFile, "tls/key.pem")
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "tls": {"certFile": "/etc/dvr/cert.pem"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for tls without keyFile")
+	}
+}
+
+func TestLoadConfig_InvalidAuthNetworks(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "auth": {"enabled": true, "fileAllowlist": ["192.168.1.5"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for a fileAllowlist entry that is not a CIDR")
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "auth": {"enabled": true, "proxy": {"trustedProxies": []}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for auth.proxy without trustedProxies")
+	}
+}
+
+func TestLoadConfig_RateLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "rateLimit": {"burst": 5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl := cfg.RateLimit; rl.RequestsPerSecond != 10 || rl.Burst != 5 || rl.FileRequestsPerSecond != 2 || rl.FileBurst != 10 {
+		t.Errorf("rateLimit defaults: %+v", rl)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "rateLimit": {"exempt": ["10.0.0.1"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for an exempt entry that is not a CIDR")
+	}
+}
+
+func TestLoadConfig_DBDriver(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	for _, tc := range []struct {
+		json string
+		ok   bool
+	}{
+		{`{"storageDir": "/tmp/rec"}`, true},
+		{`{"storageDir": "/tmp/rec", "dbDriver": "postgres", "dbDSN": "postgres://dvr@db/dvr"}`, true},
+		{`{"storageDir": "/tmp/rec", "dbDriver": "postgres"}`, false},
+		{`{"storageDir": "/tmp/rec", "dbDriver": "mysql"}`, false},
+	} {
+		if err := os.WriteFile(configPath, []byte(tc.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig()
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err %v", tc.json, err)
+		} else if err == nil && cfg.DBDriver == "" {
+			t.Errorf("%s: no driver", tc.json)
+		}
+	}
+}
+
+func TestLoadConfig_Backup(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "backup": {"at": "03:30"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := cfg.Backup; b.Dir != "backups" || b.Keep != 7 || b.At != "03:30" {
+		t.Errorf("backup defaults: %+v", b)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "backup": {"at": "3am"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for a backup time that is not HH:MM")
+	}
+}
+
+func TestLoadConfig_EnvOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "dvr.json")
+	configContent := `{
+				"storageDirs": ["/mnt/disk1", "/mnt/disk2"],
+				"port": 9000,
+				"timezone": "America/New_York"
+			}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DVR_CONFIG", configPath)
+	t.Setenv("DVR_PORT", "8181")
+	t.Setenv("DVR_DB_PATH", "/data/recordings.db")
+	t.Setenv("DVR_DEVICE_URL", "http://192.168.1.20")
+	t.Setenv("DVR_FFMPEG_PATH", "/opt/ffmpeg/bin/ffmpeg")
+	t.Setenv("DVR_STORAGE_DIR", "/recordings")
+	t.Setenv("DVR_BASE_PATH", "dvr/")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertInt(t, "port", cfg.Port, 8181)
+	assertString(t, "dbPath", cfg.DBPath, "/data/recordings.db")
+	assertString(t, "deviceURL", cfg.DeviceURL, "http://192.168.1.20")
+	assertString(t, "ffmpegPath", cfg.FFmpegPath, "/opt/ffmpeg/bin/ffmpeg")
+	assertString(t, "timezone from file", cfg.Timezone, "America/New_York")
+	assertString(t, "basePath", cfg.BasePath, "/dvr")
+	assertString(t, "storageDir", cfg.StorageDir, "/recordings")
+	if len(cfg.StorageDirs) != 1 || cfg.StorageDirs[0] != "/recordings" {
+		t.Errorf("storageDirs: expected [/recordings], got %v", cfg.StorageDirs)
+	}
+
+	t.Setenv("DVR_PORT", "http")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for invalid DVR_PORT")
+	}
+}
+
 func TestLoadConfig_InvalidJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "config.json")
@@ -184,3 +425,101 @@ func assertInt(t *testing.T, label string, got, want int) {
 		t.Fatalf("%s: expected %d, got %d", label, want, got)
 	}
 }
+
+func TestLoadConfig_Emulation(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "emulation": {"baseUrl": "http://dvr.lan:8080/"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := cfg.Emulation; len(e.DeviceID) != 8 || e.FriendlyName != "hdhr-dvr" || e.BaseURL != "http://dvr.lan:8080" {
+		t.Errorf("emulation defaults: %+v", e)
+	}
+	// The derived ID passes the check HDHomeRun clients make.
+	lookup := []uint64{0xA, 0x5, 0xF, 0x6, 0x7, 0xC, 0x1, 0xB, 0x9, 0x2, 0x8, 0xD, 0x4, 0x3, 0xE, 0x0}
+	id, _ := strconv.ParseUint(cfg.Emulation.DeviceID, 16, 32)
+	var sum uint64
+	for i := 28; i >= 0; i -= 4 {
+		if d := id >> i & 0xF; i%8 == 4 {
+			sum ^= lookup[d]
+		} else {
+			sum ^= d
+		}
+	}
+	if sum != 0 {
+		t.Errorf("device ID %s fails the checksum", cfg.Emulation.DeviceID)
+	}
+
+	for _, tc := range []struct {
+		json string
+		ok   bool
+	}{
+		{`{"storageDir": "/tmp/rec", "emulation": {"deviceId": "1234abcd"}}`, true},
+		{`{"storageDir": "/tmp/rec", "emulation": {"deviceId": "DVR"}}`, false},
+		{`{"storageDir": "/tmp/rec", "emulation": {"allowlist": ["192.168.1.5"]}}`, false},
+	} {
+		if err := os.WriteFile(configPath, []byte(tc.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig()
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err %v", tc.json, err)
+		} else if err == nil && cfg.Emulation.DeviceID != "1234ABCD" {
+			t.Errorf("%s: device ID %s", tc.json, cfg.Emulation.DeviceID)
+		}
+	}
+}
+
+func TestLoadConfig_RecordEngine(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "recordEngine": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := cfg.RecordEngine; len(e.StorageID) != 36 || e.FriendlyName != "hdhr-dvr" {
+		t.Errorf("recordEngine defaults: %+v", e)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "recordEngine": {"allowlist": ["tv.lan"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for an allowlist entry that is not a CIDR")
+	}
+}
+
+func TestLoadConfig_DLNA(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	t.Setenv("DVR_CONFIG", configPath)
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "dlna": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cfg.DLNA; len(d.UUID) != 36 || d.UUID != strings.ToLower(d.UUID) || d.FriendlyName != "hdhr-dvr" {
+		t.Errorf("dlna defaults: %+v", d)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"storageDir": "/tmp/rec", "dlna": {"allowlist": ["tv.lan"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for an allowlist entry that is not a CIDR")
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// localtimePath and timezonePath are where the system timezone is set on
+// Linux; tests point them elsewhere.
+var (
+	localtimePath = "/etc/localtime"
+	timezonePath  = "/etc/timezone"
+)
+
+// zoneName returns the IANA name in s, which may be a name such as
+// "America/New_York", a POSIX TZ value such as ":America/New_York", or a
+// path into a zoneinfo directory. It returns "" unless Go can load the zone.
+func zoneName(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ":")
+	if _, after, ok := strings.Cut(s, "zoneinfo/"); ok {
+		s = after
+	}
+	if s == "" || s == "Local" {
+		return ""
+	}
+	if _, err := time.LoadLocation(s); err != nil {
+		return ""
+	}
+	return s
+}
+
+// DetectTimezone returns the system timezone: the TZ variable when it
+// names a zone, else the zone /etc/localtime links to, else the one in
+// /etc/timezone. When none names a zone it returns "Local", which Go
+// resolves from /etc/localtime itself, or "UTC" without that file.
+func DetectTimezone() string {
+	if tz := zoneName(os.Getenv("TZ")); tz != "" {
+		return tz
+	}
+	if target, err := filepath.EvalSymlinks(localtimePath); err == nil {
+		if tz := zoneName(target); tz != "" {
+			return tz
+		}
+	}
+	if b, err := os.ReadFile(timezonePath); err == nil {
+		if tz := zoneName(string(b)); tz != "" {
+			return tz
+		}
+	}
+	if _, err := os.Stat(localtimePath); err == nil {
+		return "Local"
+	}
+	return "UTC"
+}
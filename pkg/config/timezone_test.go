@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectTimezone(t *testing.T) {
+	dir := t.TempDir()
+	zoneinfo := filepath.Join(dir, "usr", "share", "zoneinfo", "America")
+	if err := os.MkdirAll(zoneinfo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(zoneinfo, "Chicago"), []byte("TZif"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(l, z string) { localtimePath, timezonePath = l, z }(localtimePath, timezonePath)
+	localtimePath = filepath.Join(dir, "localtime")
+	timezonePath = filepath.Join(dir, "timezone")
+
+	// Nothing configured anywhere.
+	t.Setenv("TZ", "")
+	assertString(t, "no zone", DetectTimezone(), "UTC")
+
+	if err := os.WriteFile(timezonePath, []byte("Europe/Berlin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "/etc/timezone", DetectTimezone(), "Europe/Berlin")
+
+	if err := os.Symlink(filepath.Join(zoneinfo, "Chicago"), localtimePath); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "/etc/localtime link", DetectTimezone(), "America/Chicago")
+
+	t.Setenv("TZ", ":America/New_York")
+	assertString(t, "TZ", DetectTimezone(), "America/New_York")
+
+	// An unknown TZ falls through to the files.
+	t.Setenv("TZ", "Nowhere/Special")
+	assertString(t, "unknown TZ", DetectTimezone(), "America/Chicago")
+}
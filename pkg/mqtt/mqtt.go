@@ -0,0 +1,324 @@
+// Package mqtt is a minimal MQTT 3.1.1 client that publishes at QoS 0.
+// It covers what the DVR needs to report its state to a broker: connect
+// with credentials and a last will, publish retained or plain messages,
+// and keep the connection alive.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// Options configure a connection. KeepAlive defaults to 60 seconds.
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	// WillTopic, when set, is published by the broker with WillPayload if
+	// the connection is lost without a DISCONNECT.
+	WillTopic   string
+	WillPayload []byte
+	WillRetain  bool
+	// TLSConfig is used for tls:// and mqtts:// brokers.
+	TLSConfig *tls.Config
+}
+
+// Client is a connection to a broker. It is safe for concurrent use.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// ErrClosed is returned when publishing on a closed connection.
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// brokerAddr splits a broker URL ("tcp://host:1883", "tls://host:8883",
+// or a bare host[:port]) into its address and whether it uses TLS.
+func brokerAddr(broker string) (string, bool, error) {
+	if u, err := url.Parse(broker); err == nil && u.Host != "" {
+		var secure bool
+		switch u.Scheme {
+		case "tcp", "mqtt":
+		case "tls", "ssl", "mqtts":
+			secure = true
+		default:
+			return "", false, fmt.Errorf("mqtt: unsupported scheme %q", u.Scheme)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			port := "1883"
+			if secure {
+				port = "8883"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+		return host, secure, nil
+	}
+	if _, _, err := net.SplitHostPort(broker); err != nil {
+		return net.JoinHostPort(broker, "1883"), false, nil
+	}
+	return broker, false, nil
+}
+
+// Dial connects to broker and completes the MQTT handshake.
+func Dial(ctx context.Context, broker string, opts Options) (*Client, error) {
+	addr, secure, err := brokerAddr(broker)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if secure {
+		cfg := opts.TLSConfig
+		if cfg == nil {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg = &tls.Config{ServerName: host}
+		}
+		d := tls.Dialer{Config: cfg}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(ctx, conn, opts)
+	if err != nil {
+		conn.Close() //nolint: errcheck
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient performs the MQTT handshake over an established connection.
+func NewClient(ctx context.Context, conn net.Conn, opts Options) (*Client, error) {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 60 * time.Second
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) //nolint: errcheck
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second)) //nolint: errcheck
+	}
+	if _, err := conn.Write(connectPacket(opts)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if typ != packetConnack || len(body) != 2 {
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", typ)
+	}
+	if code := body[1]; code != 0 {
+		return nil, connackError(code)
+	}
+	conn.SetDeadline(time.Time{}) //nolint: errcheck
+
+	c := &Client{conn: conn, keepAlive: opts.KeepAlive, done: make(chan struct{})}
+	go c.readLoop(r)
+	go c.pingLoop()
+	return c, nil
+}
+
+func connackError(code byte) error {
+	switch code {
+	case 1:
+		return errors.New("mqtt: unacceptable protocol version")
+	case 2:
+		return errors.New("mqtt: client identifier rejected")
+	case 3:
+		return errors.New("mqtt: server unavailable")
+	case 4:
+		return errors.New("mqtt: bad user name or password")
+	case 5:
+		return errors.New("mqtt: not authorized")
+	}
+	return fmt.Errorf("mqtt: connection refused (code %d)", code)
+}
+
+// Publish sends payload to topic at QoS 0.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	var flags byte
+	if retain {
+		flags = 1
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(packet(packetPublish, flags, body))
+}
+
+// Done is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err returns why the connection ended, once Done is closed.
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Close disconnects cleanly, so the broker does not publish the will.
+func (c *Client) Close() error {
+	err := c.write(packet(packetDisconnect, 0, nil))
+	c.shutdown(ErrClosed)
+	return err
+}
+
+func (c *Client) write(p []byte) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive)) //nolint: errcheck
+	if _, err := c.conn.Write(p); err != nil {
+		c.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) shutdown(err error) {
+	c.once.Do(func() {
+		c.err = err
+		c.conn.Close() //nolint: errcheck
+		close(c.done)
+	})
+}
+
+// readLoop consumes what the broker sends. A connection that is silent
+// for half again the keep-alive has lost its PINGRESPs and is dropped.
+func (c *Client) readLoop(r *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2)) //nolint: errcheck
+		if _, _, err := readPacket(r); err != nil {
+			c.shutdown(err)
+			return
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if c.write(packet(packetPingreq, 0, nil)) != nil {
+				return
+			}
+		}
+	}
+}
+
+func connectPacket(opts Options) []byte {
+	flags := byte(0x02) // clean session
+	if opts.WillTopic != "" {
+		flags |= 0x04
+		if opts.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if opts.WillTopic != "" {
+		body = appendString(body, opts.WillTopic)
+		body = appendString(body, string(opts.WillPayload))
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return packet(packetConnect, 0, body)
+}
+
+// packet frames body with the fixed header of a packet.
+func packet(typ, flags byte, body []byte) []byte {
+	p := []byte{typ<<4 | flags}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readPacket reads one packet and returns its type and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		mult *= 128
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return first >> 4, body, nil
+}
@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// broker is the far end of a pipe that records what the client sends.
+type broker struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newPipe(t *testing.T) (net.Conn, *broker) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	return client, &broker{conn: server, r: bufio.NewReader(server)}
+}
+
+func (b *broker) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	typ, body, err := readPacket(b.r)
+	if err != nil {
+		t.Fatalf("broker read: %v", err)
+	}
+	return typ, body
+}
+
+func TestConnectAndPublish(t *testing.T) {
+	conn, b := newPipe(t)
+	type result struct {
+		c   *Client
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := NewClient(context.Background(), conn, Options{
+			ClientID: "dvr", Username: "u", Password: "p",
+			WillTopic: "dvr/status", WillPayload: []byte("offline"), WillRetain: true,
+		})
+		done <- result{c, err}
+	}()
+
+	typ, body := b.read(t)
+	if typ != packetConnect {
+		t.Fatalf("first packet type %d", typ)
+	}
+	want := connectPacket(Options{
+		ClientID: "dvr", Username: "u", Password: "p", KeepAlive: 60 * time.Second,
+		WillTopic: "dvr/status", WillPayload: []byte("offline"), WillRetain: true,
+	})
+	if !bytes.Equal(packet(typ, 0, body), want) {
+		t.Errorf("CONNECT %x, want %x", body, want)
+	}
+	if flags := body[7]; flags != 0x80|0x40|0x20|0x04|0x02 {
+		t.Errorf("connect flags %08b", flags)
+	}
+	b.conn.Write([]byte{packetConnack << 4, 2, 0, 0}) //nolint: errcheck
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+
+	go res.c.Publish("dvr/state", []byte(`{"tunersInUse":1}`), true) //nolint: errcheck
+	first, _ := b.r.Peek(1)
+	if first[0] != packetPublish<<4|1 {
+		t.Errorf("PUBLISH header %x, want retained", first[0])
+	}
+	typ, body = b.read(t)
+	if typ != packetPublish || string(body[2:2+9]) != "dvr/state" || string(body[11:]) != `{"tunersInUse":1}` {
+		t.Errorf("PUBLISH %d %q", typ, body)
+	}
+
+	go res.c.Close() //nolint: errcheck
+	if typ, _ := b.read(t); typ != packetDisconnect {
+		t.Errorf("close sent packet type %d", typ)
+	}
+	<-res.c.Done()
+	if err := res.c.Publish("x", nil, false); err != ErrClosed {
+		t.Errorf("publish after close: %v", err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	conn, b := newPipe(t)
+	go func() {
+		b.read(t)
+		b.conn.Write([]byte{packetConnack << 4, 2, 0, 4}) //nolint: errcheck
+	}()
+	if _, err := NewClient(context.Background(), conn, Options{ClientID: "dvr"}); err == nil || err.Error() != "mqtt: bad user name or password" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 300000} {
+		p := packet(packetPublish, 0, make([]byte, n))
+		typ, body, err := readPacket(bufio.NewReader(bytes.NewReader(p)))
+		if err != nil || typ != packetPublish || len(body) != n {
+			t.Errorf("length %d: got %d %d %v", n, typ, len(body), err)
+		}
+	}
+}
+
+func TestBrokerAddr(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		addr   string
+		secure bool
+	}{
+		{"tcp://mqtt.local", "mqtt.local:1883", false},
+		{"mqtts://mqtt.local", "mqtt.local:8883", true},
+		{"tls://10.0.0.2:8884", "10.0.0.2:8884", true},
+		{"mqtt.local", "mqtt.local:1883", false},
+		{"mqtt.local:1884", "mqtt.local:1884", false},
+	} {
+		addr, secure, err := brokerAddr(tc.in)
+		if err != nil || addr != tc.addr || secure != tc.secure {
+			t.Errorf("%s: got %s %v %v", tc.in, addr, secure, err)
+		}
+	}
+	if _, _, err := brokerAddr("ws://mqtt.local"); err == nil {
+		t.Error("ws:// accepted")
+	}
+}
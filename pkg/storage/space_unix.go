@@ -0,0 +1,24 @@
+//go:build unix
+
+package storage
+
+import "syscall"
+
+// FreeSpace returns the bytes available to unprivileged users on the
+// filesystem holding Root.
+func (l *Local) FreeSpace() (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(l.Root, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// TotalSpace returns the size of the filesystem holding Root.
+func (l *Local) TotalSpace() (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(l.Root, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), nil
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotLocal is returned by LocalPath for backends that have no on-disk
+// representation.
+var ErrNotLocal = errors.New("storage backend has no local path")
+
+// ErrOutsideRoot is returned for names that lead outside the backend root,
+// through ".." or, on disk, a symlink.
+var ErrOutsideRoot = errors.New("path is outside the storage root")
+
+// ValidName reports whether name is a relative, slash-separated name that
+// stays within a backend root: not empty or absolute, without ".." leading
+// out of it and without backslashes, which Windows takes for separators.
+func ValidName(name string) bool {
+	return name != "" && !strings.Contains(name, "\\") && filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// File is a readable, seekable recording file.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (os.FileInfo, error)
+}
+
+// Storage abstracts where recording files live. Names are relative to the
+// backend root and use forward slashes.
+type Storage interface {
+	Stat(name string) (os.FileInfo, error)
+	Open(name string) (File, error)
+	Create(name string) (io.WriteCloser, error)
+	Remove(name string) error
+	Rename(oldName, newName string) error
+	// List returns the names of all files under the root.
+	List() ([]string, error)
+	// LocalPath returns an on-disk path for name, creating parent directories
+	// as needed, for tools such as ffmpeg that write files themselves.
+	LocalPath(name string) (string, error)
+}
+
+// SpaceReporter is implemented by backends that can report their capacity.
+type SpaceReporter interface {
+	FreeSpace() (int64, error)
+	TotalSpace() (int64, error)
+}
+
+// Local stores recordings in a directory on the local filesystem.
+type Local struct {
+	Root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(name))
+}
+
+// resolve returns the on-disk path of name, once it has checked that name
+// is valid and that what it resolves to, following symlinks, is inside
+// Root. Parts of the path that do not exist yet are checked through their
+// deepest existing directory.
+func (l *Local) resolve(name string) (string, error) {
+	if !ValidName(name) {
+		return "", ErrOutsideRoot
+	}
+	p := l.path(name)
+	root, err := filepath.EvalSymlinks(l.Root)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing below a missing root can be a symlink.
+		return p, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for existing := p; ; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+			return "", ErrOutsideRoot
+		}
+		return p, nil
+	}
+}
+
+func (l *Local) Stat(name string) (os.FileInfo, error) {
+	p, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+// Open opens name for reading, once it has checked that the file it
+// resolves to, following symlinks, is inside Root.
+func (l *Local) Open(name string) (File, error) {
+	p, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (l *Local) Create(name string) (io.WriteCloser, error) {
+	p, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+func (l *Local) Remove(name string) error {
+	p, err := l.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (l *Local) Rename(oldName, newName string) error {
+	oldPath, err := l.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	p, err := l.resolve(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.Rename(oldPath, p)
+}
+
+func (l *Local) List() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(l.Root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return names, err
+}
+
+func (l *Local) LocalPath(name string) (string, error) {
+	p, err := l.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// Memory is an in-memory Storage, intended for tests.
+type Memory struct {
+	mu       sync.RWMutex
+	files    map[string]*memEntry
+	capacity int64
+}
+
+type memEntry struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{files: make(map[string]*memEntry), capacity: 1 << 40}
+}
+
+// SetCapacity sets the total size reported by TotalSpace and used by
+// FreeSpace.
+func (m *Memory) SetCapacity(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.capacity = n
+}
+
+// FreeSpace returns the capacity minus the size of all stored files.
+func (m *Memory) FreeSpace() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	free := m.capacity
+	for _, e := range m.files {
+		free -= int64(len(e.data))
+	}
+	if free < 0 {
+		free = 0
+	}
+	return free, nil
+}
+
+// TotalSpace returns the capacity set with SetCapacity.
+func (m *Memory) TotalSpace() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.capacity, nil
+}
+
+// WriteFile stores data under name, replacing any existing file.
+func (m *Memory) WriteFile(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &memEntry{data: append([]byte(nil), data...), modTime: time.Now()}
+}
+
+func (m *Memory) get(name string) (*memEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (m *Memory) Stat(name string) (os.FileInfo, error) {
+	e, err := m.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return memInfo{name: name, size: int64(len(e.data)), modTime: e.modTime}, nil
+}
+
+func (m *Memory) Open(name string) (File, error) {
+	if !ValidName(name) {
+		return nil, ErrOutsideRoot
+	}
+	e, err := m.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{Reader: bytes.NewReader(e.data), info: memInfo{name: name, size: int64(len(e.data)), modTime: e.modTime}}, nil
+}
+
+func (m *Memory) Create(name string) (io.WriteCloser, error) {
+	return &memWriter{m: m, name: name}, nil
+}
+
+func (m *Memory) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *Memory) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.files[oldName]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldName)
+	m.files[newName] = e
+	return nil
+}
+
+func (m *Memory) List() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *Memory) LocalPath(name string) (string, error) {
+	return "", ErrNotLocal
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return filepath.Base(i.name) }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() os.FileMode  { return 0644 }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Close() error               { return nil }
+func (f *memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+type memWriter struct {
+	m    *Memory
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.m.WriteFile(w.name, w.buf.Bytes())
+	return nil
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func exerciseStorage(t *testing.T, s Storage) {
+	w, err := s.Create("show/episode.ts")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	info, err := s.Stat("show/episode.ts")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 11 || info.Name() != "episode.ts" {
+		t.Fatalf("unexpected info: name=%q size=%d", info.Name(), info.Size())
+	}
+
+	f, err := s.Open("show/episode.ts")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := f.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close() //nolint: errcheck
+	if err != nil || string(data) != "world" {
+		t.Fatalf("expected %q after seek, got %q (err: %v)", "world", data, err)
+	}
+
+	if err := s.Rename("show/episode.ts", "show/episode.mp4"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	names, err := s.List()
+	if err != nil || len(names) != 1 || names[0] != "show/episode.mp4" {
+		t.Fatalf("unexpected List result %v (err: %v)", names, err)
+	}
+
+	if err := s.Remove("show/episode.mp4"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := s.Stat("show/episode.mp4"); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error after Remove, got %v", err)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	exerciseStorage(t, NewLocal(t.TempDir()))
+}
+
+func TestMemoryStorage(t *testing.T) {
+	exerciseStorage(t, NewMemory())
+}
+
+func TestLocalPath(t *testing.T) {
+	root := t.TempDir()
+	p, err := NewLocal(root).LocalPath("a/b/c.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != filepath.Join(root, "a", "b", "c.ts") {
+		t.Fatalf("unexpected path %q", p)
+	}
+	if info, err := os.Stat(filepath.Dir(p)); err != nil || !info.IsDir() {
+		t.Fatalf("expected parent directory to be created: %v", err)
+	}
+
+	if _, err := NewMemory().LocalPath("x.ts"); err != ErrNotLocal {
+		t.Fatalf("expected ErrNotLocal, got %v", err)
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	m := NewMemory()
+	m.SetCapacity(100)
+	m.WriteFile("a.ts", make([]byte, 30))
+	if free, err := m.FreeSpace(); err != nil || free != 70 {
+		t.Fatalf("expected 70 bytes free, got %d (err: %v)", free, err)
+	}
+	if total, _ := m.TotalSpace(); total != 100 {
+		t.Fatalf("expected 100 bytes total, got %d", total)
+	}
+
+	var s Storage = NewLocal(t.TempDir())
+	sr, ok := s.(SpaceReporter)
+	if !ok {
+		t.Skip("local FreeSpace not supported on this platform")
+	}
+	free, err := sr.FreeSpace()
+	if err != nil || free <= 0 {
+		t.Fatalf("expected positive free space, got %d (err: %v)", free, err)
+	}
+	if total, err := sr.TotalSpace(); err != nil || total < free {
+		t.Fatalf("expected total space of at least %d, got %d (err: %v)", free, total, err)
+	}
+}
+
+func TestOpenOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "recordings")
+	if err := os.MkdirAll(filepath.Join(root, "show"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"secret.txt": "secret", "recordings/show/a.mp4": "video"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "escape.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "show", "a.mp4"), filepath.Join(root, "inside.mp4")); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLocal(root)
+	for _, name := range []string{"../secret.txt", "show/../../secret.txt", "/etc/passwd", "", `..\secret.txt`, "escape.mp4"} {
+		if f, err := l.Open(name); err != ErrOutsideRoot {
+			if f != nil {
+				f.Close() //nolint: errcheck
+			}
+			t.Errorf("Open(%q): %v, want ErrOutsideRoot", name, err)
+		}
+	}
+	for _, name := range []string{"show/a.mp4", "inside.mp4"} {
+		f, err := l.Open(name)
+		if err != nil {
+			t.Errorf("Open(%q): %v", name, err)
+			continue
+		}
+		f.Close() //nolint: errcheck
+	}
+	if _, err := NewMemory().Open("../a.ts"); err != ErrOutsideRoot {
+		t.Errorf("memory Open: %v", err)
+	}
+}
+
+func TestLocalOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "recordings")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "a.ts"), []byte("elsewhere"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A directory inside the root that leads out of it.
+	if err := os.Symlink(outside, filepath.Join(root, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLocal(root)
+	for _, name := range []string{"../outside/a.ts", "linked/a.ts", "linked/new/b.ts", "/etc/passwd", ""} {
+		if _, err := l.Stat(name); err != ErrOutsideRoot {
+			t.Errorf("Stat(%q): %v", name, err)
+		}
+		if w, err := l.Create(name); err != ErrOutsideRoot {
+			if w != nil {
+				w.Close() //nolint: errcheck
+			}
+			t.Errorf("Create(%q): %v", name, err)
+		}
+		if _, err := l.LocalPath(name); err != ErrOutsideRoot {
+			t.Errorf("LocalPath(%q): %v", name, err)
+		}
+		if err := l.Rename(name, "show/a.ts"); err != ErrOutsideRoot {
+			t.Errorf("Rename(%q, ...): %v", name, err)
+		}
+		if err := l.Rename("show/a.ts", name); err != ErrOutsideRoot {
+			t.Errorf("Rename(..., %q): %v", name, err)
+		}
+		if err := l.Remove(name); err != ErrOutsideRoot {
+			t.Errorf("Remove(%q): %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "a.ts")); err != nil {
+		t.Errorf("file outside the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("directory created outside the root: %v", err)
+	}
+
+	// A root that does not exist yet is created on first use.
+	l = NewLocal(filepath.Join(dir, "new"))
+	if p, err := l.LocalPath("show/a.ts"); err != nil || p != filepath.Join(dir, "new", "show", "a.ts") {
+		t.Errorf("LocalPath under a new root: %q, %v", p, err)
+	}
+}
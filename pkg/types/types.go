@@ -4,11 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"hash/fnv"
 	"log"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/prziborowski/hdhr-dvr/pkg/storage"
 )
 
 type Channel struct {
@@ -24,14 +27,24 @@ type Channel struct {
 }
 
 type Program struct {
-	Channel  string `json:"channel"`
-	Title    string `json:"title"`
-	SubTitle string `json:"subtitle"`
-	Start    string `json:"start"`
-	End      string `json:"end"`
-	Duration int    `json:"duration"`
-	Category string `json:"category,omitempty"`
-	Video    struct {
+	// ID is a stable identifier for this airing; see ProgramID.
+	ID          string `json:"id,omitempty"`
+	Channel     string `json:"channel"`
+	Title       string `json:"title"`
+	SubTitle    string `json:"subtitle"`
+	Description string `json:"description,omitempty"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Duration    int    `json:"duration"`
+	Category    string `json:"category,omitempty"`
+	// Extended metadata, when the guide source provides it.
+	Season          int      `json:"season,omitempty"`
+	Episode         int      `json:"episode,omitempty"`
+	OriginalAirDate string   `json:"originalAirDate,omitempty"` // YYYY-MM-DD
+	Year            int      `json:"year,omitempty"`
+	Rating          string   `json:"rating,omitempty"`
+	Cast            []string `json:"cast,omitempty"`
+	Video           struct {
 		Quality string `json:"quality,omitempty"`
 	} `json:"video,omitempty"`
 	Audio struct {
@@ -40,6 +53,34 @@ type Program struct {
 	New bool `json:"new,omitempty"`
 }
 
+// ProgramID returns the identifier of a program airing built from the
+// provider station, the start time and a hash of the title, e.g.
+// "10021-1767312000-9f1c2a3b". It is the same every time the guide is
+// generated, and an airing moved to another time keeps its station and
+// title hash.
+func ProgramID(stationID string, start time.Time, title string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(title)))) //nolint: errcheck
+	return fmt.Sprintf("%s-%d-%08x", stationID, start.Unix(), h.Sum32())
+}
+
+// ParseProgramID splits an ID built by ProgramID into its parts.
+func ParseProgramID(id string) (stationID string, start time.Time, titleHash string, ok bool) {
+	i := strings.LastIndex(id, "-")
+	if i < 0 {
+		return "", time.Time{}, "", false
+	}
+	j := strings.LastIndex(id[:i], "-")
+	if j <= 0 {
+		return "", time.Time{}, "", false
+	}
+	unix, err := strconv.ParseInt(id[j+1:i], 10, 64)
+	if err != nil {
+		return "", time.Time{}, "", false
+	}
+	return id[:j], time.Unix(unix, 0), id[i+1:], true
+}
+
 type Recording struct {
 	ID        int
 	ChannelID string
@@ -50,9 +91,39 @@ type Recording struct {
 	Title     *string `json:"title,omitempty"`
 	CreatedAt time.Time
 	FileSize  int
+	// FileName is the recording's file relative to its storage root as last
+	// stored: the transport stream rendered from the filename template while
+	// capturing, then the MP4 after conversion. It is empty for recordings
+	// made before file names were stored.
+	FileName string
+
+	// start and startLoc cache StartAt.
+	start    time.Time
+	startLoc *time.Location
+}
+
+// StartAt returns the scheduled start of the recording in loc, parsed from
+// Date and StartTime on the first call and cached after. A Recording whose
+// Date or StartTime changes must be replaced, not edited.
+func (r *Recording) StartAt(loc *time.Location) (time.Time, error) {
+	if r.startLoc == loc && !r.start.IsZero() {
+		return r.start, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", r.Date+" "+r.StartTime, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.start, r.startLoc = t, loc
+	return t, nil
 }
 
+// GetFilePath returns the recording's file name relative to its storage
+// root: FileName when set, otherwise the original "DATE-HH:MM-title.ts"
+// form.
 func (r *Recording) GetFilePath() string {
+	if r.FileName != "" {
+		return r.FileName
+	}
 	var titleStr string
 	if r.Title != nil {
 		titleStr = *r.Title
@@ -74,6 +145,8 @@ type Store interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+	// PrepareContext prepares query once for repeated use.
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 }
 
 type Tx interface {
@@ -84,7 +157,7 @@ type Tx interface {
 	Rollback() error
 }
 
-func (r *Recording) CheckStatus(store Store, loc *time.Location, storageDir string) string {
+func (r *Recording) CheckStatus(store Store, loc *time.Location, fs storage.Storage) string {
 	var channelName string
 	err := store.QueryRowContext(context.Background(), "SELECT guide_name FROM channels WHERE guide_number = ?", r.ChannelID).Scan(&channelName)
 	if err != nil {
@@ -92,13 +165,13 @@ func (r *Recording) CheckStatus(store Store, loc *time.Location, storageDir stri
 		return "failed"
 	}
 
-	filePathTS := filepath.Join(storageDir, r.GetFilePath())
-	filePathMP4 := strings.TrimSuffix(filePathTS, filepath.Ext(filePathTS)) + ".mp4"
+	fileNameTS := r.GetFilePath()
+	fileNameMP4 := strings.TrimSuffix(fileNameTS, filepath.Ext(fileNameTS)) + ".mp4"
 
 	fileExists := false
-	if _, err := os.Stat(filePathTS); err == nil {
+	if _, err := fs.Stat(fileNameTS); err == nil {
 		fileExists = true
-	} else if _, err := os.Stat(filePathMP4); err == nil {
+	} else if _, err := fs.Stat(fileNameMP4); err == nil {
 		fileExists = true
 	}
 
@@ -139,6 +212,9 @@ type LineupData struct {
 	ChannelNumber   string `json:"channelNumber"`
 	StationCallSign string `json:"stationCallSign"`
 	Logo            string `json:"logo"`
+	// Source names the provider lineup the channel came from, e.g.
+	// "titantv/<lineupID>".
+	Source string `json:"source,omitempty"`
 }
 
 type ListingData struct {
@@ -202,12 +278,149 @@ type TitanTVScheduleResponse struct {
 	Channels []TitanTVChannelSchedule `json:"channels"`
 }
 
+// Schedules Direct API Response Types
+
+type SDTokenResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Token   string `json:"token"`
+}
+
+type SDLineupMap struct {
+	StationID string `json:"stationID"`
+	Channel   string `json:"channel"`
+	AtscMajor int    `json:"atscMajor"`
+	AtscMinor int    `json:"atscMinor"`
+}
+
+type SDStation struct {
+	StationID string `json:"stationID"`
+	Name      string `json:"name"`
+	Callsign  string `json:"callsign"`
+	Logo      struct {
+		URL string `json:"URL"`
+	} `json:"logo"`
+}
+
+type SDLineupResponse struct {
+	Map      []SDLineupMap `json:"map"`
+	Stations []SDStation   `json:"stations"`
+}
+
+type SDScheduleRequest struct {
+	StationID string   `json:"stationID"`
+	Date      []string `json:"date"`
+}
+
+type SDScheduleProgram struct {
+	ProgramID     string `json:"programID"`
+	AirDateTime   string `json:"airDateTime"` // RFC 3339, UTC
+	Duration      int    `json:"duration"`    // seconds
+	New           bool   `json:"new"`
+	LiveTapeDelay string `json:"liveTapeDelay"`
+}
+
+type SDScheduleResponse struct {
+	StationID string              `json:"stationID"`
+	Programs  []SDScheduleProgram `json:"programs"`
+}
+
+type SDProgram struct {
+	ProgramID string `json:"programID"`
+	Titles    []struct {
+		Title120 string `json:"title120"`
+	} `json:"titles"`
+	EpisodeTitle150 string `json:"episodeTitle150"`
+	Descriptions    struct {
+		Description1000 []SDDescription `json:"description1000"`
+		Description100  []SDDescription `json:"description100"`
+	} `json:"descriptions"`
+	Genres     []string `json:"genres"`
+	EntityType string   `json:"entityType"`
+	ShowType   string   `json:"showType"`
+	// Metadata holds season/episode numbers keyed by provider, e.g. "Gracenote".
+	Metadata        []map[string]SDEpisodeMetadata `json:"metadata"`
+	OriginalAirDate string                         `json:"originalAirDate"`
+	ContentRating   []struct {
+		Body string `json:"body"`
+		Code string `json:"code"`
+	} `json:"contentRating"`
+	Cast []struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	} `json:"cast"`
+	Movie struct {
+		Year string `json:"year"`
+	} `json:"movie"`
+}
+
+type SDEpisodeMetadata struct {
+	Season  int `json:"season"`
+	Episode int `json:"episode"`
+}
+
+type SDDescription struct {
+	DescriptionLanguage string `json:"descriptionLanguage"`
+	Description         string `json:"description"`
+}
+
+// Description returns the longest available description, preferring English.
+func (p SDProgram) Description() string {
+	for _, descs := range [][]SDDescription{p.Descriptions.Description1000, p.Descriptions.Description100} {
+		for _, d := range descs {
+			if d.DescriptionLanguage == "en" {
+				return d.Description
+			}
+		}
+		if len(descs) > 0 {
+			return descs[0].Description
+		}
+	}
+	return ""
+}
+
+// RecordingMetadata is the guide information captured for a recording when it
+// is scheduled, for use after the program has dropped out of the guide.
+type RecordingMetadata struct {
+	RecordingID     int      `json:"recordingId"`
+	Title           string   `json:"title"`
+	SubTitle        string   `json:"subtitle,omitempty"`
+	Description     string   `json:"description,omitempty"`
+	Category        string   `json:"category,omitempty"`
+	Season          int      `json:"season,omitempty"`
+	Episode         int      `json:"episode,omitempty"`
+	OriginalAirDate string   `json:"originalAirDate,omitempty"`
+	Year            int      `json:"year,omitempty"`
+	Rating          string   `json:"rating,omitempty"`
+	Cast            []string `json:"cast,omitempty"`
+	// Enrichment is the matching TMDB or TVDB entry, if one was found.
+	Enrichment *Enrichment `json:"enrichment,omitempty"`
+}
+
+// Enrichment identifies a recording in an online metadata database.
+// EpisodeID is empty for movies and for episodes that could not be matched.
+type Enrichment struct {
+	Provider   string `json:"provider"`
+	SeriesID   string `json:"seriesId"`
+	SeriesName string `json:"seriesName"`
+	EpisodeID  string `json:"episodeId,omitempty"`
+	Synopsis   string `json:"synopsis,omitempty"`
+	Year       int    `json:"year,omitempty"`
+	ImageURL   string `json:"imageUrl,omitempty"`
+	FanartURL  string `json:"fanartUrl,omitempty"`
+}
+
 type Keyword struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
 	Category  string    `json:"category,omitempty"`
 	Enabled   bool      `json:"enabled"`
 	CreatedAt time.Time `json:"created_at"`
+	// Commercials is the comskip mode ("mark" or "cut") for recordings
+	// scheduled by this keyword; empty uses the configured default.
+	Commercials string `json:"commercials,omitempty"`
+	// Filters are the built-in filters applied to its recordings.
+	Filters []string `json:"filters,omitempty"`
 }
 
 // StoreAdapter wraps *sql.DB to implement types.Store.
@@ -231,6 +444,10 @@ func (s *StoreAdapter) QueryRowContext(ctx context.Context, query string, args .
 	return s.db.QueryRowContext(ctx, query, args...)
 }
 
+func (s *StoreAdapter) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.db.PrepareContext(ctx, query)
+}
+
 func (s *StoreAdapter) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
 	tx, err := s.db.BeginTx(ctx, opts)
 	if err != nil {
@@ -2,6 +2,7 @@ package types
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGetFilePath_WithTitle(t *testing.T) {
@@ -33,6 +34,20 @@ func TestGetFilePath_WithoutTitle(t *testing.T) {
 	}
 }
 
+func TestGetFilePath_FileName(t *testing.T) {
+	title := "Test Show"
+	r := Recording{
+		ChannelID: "001",
+		Date:      "2026-01-01",
+		StartTime: "19:30",
+		Title:     &title,
+		FileName:  "Test Show - 2026-01-01 19-30 - KPIX.ts",
+	}
+	if got := r.GetFilePath(); got != r.FileName {
+		t.Fatalf("GetFilePath: expected %q, got %q", r.FileName, got)
+	}
+}
+
 func TestGetFilePath_TitleWithSpecialChars(t *testing.T) {
 	title := "Test Show & More (2026)"
 	r := Recording{
@@ -90,3 +105,61 @@ func TestLineupDataFields(t *testing.T) {
 		t.Fatal("expected StationID and ChannelNumber to match")
 	}
 }
+
+func TestSDProgramDescription(t *testing.T) {
+	var p SDProgram
+	if got := p.Description(); got != "" {
+		t.Fatalf("Description: expected empty, got %q", got)
+	}
+
+	p.Descriptions.Description100 = []SDDescription{{DescriptionLanguage: "en", Description: "Short."}}
+	p.Descriptions.Description1000 = []SDDescription{
+		{DescriptionLanguage: "es", Description: "Larga."},
+		{DescriptionLanguage: "en", Description: "Long."},
+	}
+	if got := p.Description(); got != "Long." {
+		t.Fatalf("Description: expected %q, got %q", "Long.", got)
+	}
+}
+
+func TestProgramID(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	id := ProgramID("10021", start, " The News ")
+	if id != ProgramID("10021", start.In(time.FixedZone("PST", -8*3600)), "the news") {
+		t.Errorf("expected the ID to ignore time zone, case and surrounding space")
+	}
+
+	station, parsed, hash, ok := ParseProgramID(id)
+	if !ok || station != "10021" || !parsed.Equal(start) || hash == "" {
+		t.Errorf("ParseProgramID(%q) = %q, %v, %q, %v", id, station, parsed, hash, ok)
+	}
+	moved := ProgramID("10021", start.Add(time.Hour), "The News")
+	if _, _, movedHash, _ := ParseProgramID(moved); movedHash != hash || moved == id {
+		t.Errorf("expected a moved airing to keep its title hash: %q vs %q", moved, id)
+	}
+
+	for _, bad := range []string{"", "abc", "x-y", "10021-soon-abcd"} {
+		if _, _, _, ok := ParseProgramID(bad); ok {
+			t.Errorf("ParseProgramID(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRecordingStartAt(t *testing.T) {
+	r := Recording{Date: "2026-03-08", StartTime: "20:00"}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	got, err := r.StartAt(ny)
+	if err != nil || !got.Equal(time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("StartAt = %v, %v", got, err)
+	}
+	if utc, _ := r.StartAt(time.UTC); !utc.Equal(time.Date(2026, 3, 8, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("StartAt in another location = %v", utc)
+	}
+	bad := Recording{Date: "2026-03-08", StartTime: "8pm"}
+	if _, err := bad.StartAt(time.UTC); err == nil {
+		t.Error("parsed a malformed start time")
+	}
+}
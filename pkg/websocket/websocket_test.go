@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455 section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close() //nolint: errcheck
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteText(append([]byte("echo "), msg...)); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint: errcheck
+
+	for _, msg := range []string{"hi", strings.Repeat("x", 200), strings.Repeat("y", 70000)} {
+		if err := c.WriteText([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Ping(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "echo "+msg {
+			t.Errorf("echo of %d bytes came back as %d bytes", len(msg), len(got))
+		}
+	}
+
+	if err := c.WriteJSON(map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.ReadMessage(); string(got) != `echo {"id":1}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	if _, err := Upgrade(w, httptest.NewRequest("GET", "/ws", nil)); err == nil {
+		t.Fatal("plain GET upgraded")
+	}
+	if w.Code != http.StatusUpgradeRequired {
+		t.Errorf("status %d", w.Code)
+	}
+}
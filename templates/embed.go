@@ -0,0 +1,10 @@
+// Package templates holds the web UI. It is embedded into the server binary
+// so that it runs from any working directory.
+package templates
+
+import "embed"
+
+// FS holds the UI's pages; styles and scripts are inline in them.
+//
+//go:embed *.html
+var FS embed.FS